@@ -0,0 +1,260 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package acceptance runs the plugin's end-to-end flows against a mounted
+// instance and a simulated chain, so forks can check they still conform.
+package acceptance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+
+	core "github.com/core-coin/go-core"
+	"github.com/core-coin/go-core/accounts/abi/bind/backends"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	gocore "github.com/core-coin/go-core/core"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/crypto"
+	"github.com/core-coin/go-core/params"
+	"github.com/core-coin/go-core/rlp"
+	"github.com/core-coin/go-core/rpc"
+	eddsa "github.com/core-coin/go-goldilocks"
+)
+
+// DefaultEnergyLimit is the block energy limit of the simulated chain
+const DefaultEnergyLimit uint64 = 8000000
+
+// SimulatedChain is an in-memory chain served over JSON-RPC
+type SimulatedChain struct {
+	Backend *backends.SimulatedBackend
+	URL     string
+	// AutoMine commits a block after every accepted transaction
+	AutoMine bool
+
+	faucet  *eddsa.PrivateKey
+	server  *httptest.Server
+	signer  types.Signer
+	chainID *big.Int
+}
+
+// NewSimulatedChain starts a simulated chain with a funded faucet account
+func NewSimulatedChain() (*SimulatedChain, error) {
+	faucet, err := crypto.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	balance, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	backend := backends.NewSimulatedBackend(gocore.GenesisAlloc{
+		crypto.PubkeyToAddress(eddsa.Ed448DerivePublicKey(*faucet)): {Balance: balance},
+	}, DefaultEnergyLimit)
+	chainID := params.AllCryptoreProtocolChanges.NetworkID
+	chain := &SimulatedChain{
+		Backend:  backend,
+		AutoMine: true,
+		faucet:   faucet,
+		signer:   types.NewNucleusSigner(chainID),
+		chainID:  chainID,
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("xcb", &chainService{chain: chain}); err != nil {
+		return nil, err
+	}
+	chain.server = httptest.NewServer(server)
+	chain.URL = chain.server.URL
+	return chain, nil
+}
+
+// ChainID returns the chain ID transactions must be signed for
+func (c *SimulatedChain) ChainID() *big.Int {
+	return new(big.Int).Set(c.chainID)
+}
+
+// Commit mines the pending transactions into a new block
+func (c *SimulatedChain) Commit() {
+	c.Backend.Commit()
+}
+
+// Close stops the RPC server and the chain
+func (c *SimulatedChain) Close() {
+	c.server.Close()
+	c.Backend.Close()
+}
+
+// Fund sends amount wei from the faucet to address and mines it
+func (c *SimulatedChain) Fund(ctx context.Context, address common.Address, amount *big.Int) error {
+	nonce, err := c.Backend.PendingNonceAt(ctx, crypto.PubkeyToAddress(eddsa.Ed448DerivePublicKey(*c.faucet)))
+	if err != nil {
+		return err
+	}
+	tx, err := types.SignTx(types.NewTransaction(nonce, address, amount, 21000, big.NewInt(1), nil), c.signer, c.faucet)
+	if err != nil {
+		return err
+	}
+	if err := c.Backend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	c.Commit()
+	return nil
+}
+
+// chainService implements the xcb RPC methods the plugin uses
+type chainService struct {
+	chain *SimulatedChain
+}
+
+func blockNumber(block string) (*big.Int, error) {
+	switch block {
+	case "", "latest", "pending":
+		return nil, nil
+	case "earliest":
+		return big.NewInt(0), nil
+	}
+	number, err := hexutil.DecodeBig(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number %q", block)
+	}
+	return number, nil
+}
+
+type callArgs struct {
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	Energy      hexutil.Uint64  `json:"energy"`
+	EnergyPrice *hexutil.Big    `json:"energyPrice"`
+	Value       *hexutil.Big    `json:"value"`
+	Data        hexutil.Bytes   `json:"data"`
+}
+
+func (args callArgs) message() core.CallMsg {
+	return core.CallMsg{
+		From:        args.From,
+		To:          args.To,
+		Energy:      uint64(args.Energy),
+		EnergyPrice: (*big.Int)(args.EnergyPrice),
+		Value:       (*big.Int)(args.Value),
+		Data:        args.Data,
+	}
+}
+
+func (s *chainService) NetworkId() hexutil.Big {
+	return hexutil.Big(*s.chain.ChainID())
+}
+
+func (s *chainService) GetBlockNumber(_ *string) hexutil.Uint64 {
+	return hexutil.Uint64(s.chain.Backend.Blockchain().CurrentBlock().NumberU64())
+}
+
+func (s *chainService) GetBlockByNumber(ctx context.Context, block string, full bool) (*types.Header, error) {
+	number, err := blockNumber(block)
+	if err != nil {
+		return nil, err
+	}
+	header, err := s.chain.Backend.HeaderByNumber(ctx, number)
+	if err != nil {
+		return nil, nil
+	}
+	return header, nil
+}
+
+func (s *chainService) GetBalance(ctx context.Context, address common.Address, block string) (*hexutil.Big, error) {
+	balance, err := s.chain.Backend.BalanceAt(ctx, address, nil)
+	return (*hexutil.Big)(balance), err
+}
+
+func (s *chainService) GetTransactionCount(ctx context.Context, address common.Address, block string) (hexutil.Uint64, error) {
+	if block == "pending" {
+		nonce, err := s.chain.Backend.PendingNonceAt(ctx, address)
+		return hexutil.Uint64(nonce), err
+	}
+	nonce, err := s.chain.Backend.NonceAt(ctx, address, nil)
+	return hexutil.Uint64(nonce), err
+}
+
+func (s *chainService) GetCode(ctx context.Context, address common.Address, block string) (hexutil.Bytes, error) {
+	if block == "pending" {
+		return s.chain.Backend.PendingCodeAt(ctx, address)
+	}
+	return s.chain.Backend.CodeAt(ctx, address, nil)
+}
+
+func (s *chainService) EnergyPrice(ctx context.Context) (*hexutil.Big, error) {
+	price, err := s.chain.Backend.SuggestEnergyPrice(ctx)
+	return (*hexutil.Big)(price), err
+}
+
+func (s *chainService) EstimateEnergy(ctx context.Context, args callArgs) (hexutil.Uint64, error) {
+	energy, err := s.chain.Backend.EstimateEnergy(ctx, args.message())
+	return hexutil.Uint64(energy), err
+}
+
+func (s *chainService) Call(ctx context.Context, args callArgs, block string) (hexutil.Bytes, error) {
+	if block == "pending" {
+		return s.chain.Backend.PendingCallContract(ctx, args.message())
+	}
+	return s.chain.Backend.CallContract(ctx, args.message(), nil)
+}
+
+// GetTransactionReceipt mirrors a node, which reports no contract address as null
+func (s *chainService) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	receipt, err := s.chain.Backend.TransactionReceipt(ctx, hash)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(receipt)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	if receipt.ContractAddress == (common.Address{}) {
+		fields["contractAddress"] = nil
+	}
+	return fields, nil
+}
+
+// SendRawTransaction validates what the simulated backend would otherwise panic on
+func (s *chainService) SendRawTransaction(ctx context.Context, raw hexutil.Bytes) (common.Hash, error) {
+	var tx types.Transaction
+	if err := rlp.DecodeBytes(raw, &tx); err != nil {
+		return common.Hash{}, err
+	}
+	sender, err := types.Sender(s.chain.signer, &tx)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("invalid sender: %v", err)
+	}
+	nonce, err := s.chain.Backend.PendingNonceAt(ctx, sender)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if tx.Nonce() < nonce {
+		return common.Hash{}, fmt.Errorf("nonce too low")
+	}
+	if tx.Nonce() > nonce {
+		return common.Hash{}, fmt.Errorf("nonce too high")
+	}
+	if err := s.chain.Backend.SendTransaction(ctx, &tx); err != nil {
+		return common.Hash{}, err
+	}
+	if s.chain.AutoMine {
+		s.chain.Commit()
+	}
+	return tx.Hash(), nil
+}
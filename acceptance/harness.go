@@ -0,0 +1,162 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acceptance
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/hashicorp/vault/api"
+	"github.com/pborman/uuid"
+)
+
+// confirmationDepth is the depth the harness configures and mines past
+const confirmationDepth = 2
+
+// TestingT is the subset of *testing.T the harness reports through
+type TestingT interface {
+	Helper()
+	Logf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Harness drives a mounted instance of the plugin against a simulated chain
+type Harness struct {
+	Client *api.Client
+	Mount  string
+	Chain  *SimulatedChain
+}
+
+func (h *Harness) path(subpath string) string {
+	return strings.Trim(h.Mount, "/") + "/" + subpath
+}
+
+func (h *Harness) write(t TestingT, subpath string, data map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	secret, err := h.Client.Logical().Write(h.path(subpath), data)
+	if err != nil {
+		t.Fatalf("write %s: %v", subpath, err)
+	}
+	if secret == nil {
+		return nil
+	}
+	return secret.Data
+}
+
+func (h *Harness) read(t TestingT, subpath string) map[string]interface{} {
+	t.Helper()
+	secret, err := h.Client.Logical().Read(h.path(subpath))
+	if err != nil {
+		t.Fatalf("read %s: %v", subpath, err)
+	}
+	if secret == nil {
+		t.Fatalf("read %s: no data", subpath)
+	}
+	return secret.Data
+}
+
+// Run checks the signature vectors, configures the mount for the simulated
+// chain and exercises the create, sign, send and confirm flows. The Vault
+// server must be able to reach Chain.URL, so this is meant for a dev server on
+// the same host.
+func (h *Harness) Run(t TestingT) {
+	t.Helper()
+	if err := CheckSignatureVectors(); err != nil {
+		t.Fatalf("signature format changed: %v", err)
+	}
+	h.write(t, "config", map[string]interface{}{
+		"rpc_url":            h.Chain.URL,
+		"chain_id":           h.Chain.ChainID().String(),
+		"confirmation_depth": confirmationDepth,
+	})
+	sender := h.createAccount(t)
+	recipient := h.createAccount(t)
+
+	address, err := common.HexToAddress(sender.address)
+	if err != nil {
+		t.Fatalf("account %s returned an invalid address %s: %v", sender.name, sender.address, err)
+	}
+	funds, _ := new(big.Int).SetString("1000000000000000000", 10)
+	if err := h.Chain.Fund(context.Background(), address, funds); err != nil {
+		t.Fatalf("fund %s: %v", sender.address, err)
+	}
+	balance := h.read(t, "accounts/"+sender.name+"/balance")
+	if fmt.Sprint(balance["balance"]) != funds.String() {
+		t.Fatalf("balance of %s is %v, want %s", sender.name, balance["balance"], funds)
+	}
+
+	signed := h.write(t, "accounts/"+sender.name+"/sign-tx", map[string]interface{}{
+		"to":     recipient.address,
+		"amount": "1000",
+		"nonce":  "0",
+	})
+	if signed["signed_transaction"] == nil || signed["transaction_hash"] == nil {
+		t.Fatalf("sign-tx returned no signed transaction: %v", signed)
+	}
+	t.Logf("signed %v offline", signed["transaction_hash"])
+
+	sent := h.write(t, "accounts/"+sender.name+"/transfer", map[string]interface{}{
+		"to":     recipient.address,
+		"amount": "1000",
+	})
+	hash := fmt.Sprint(sent["transaction_hash"])
+	if hash != signed["transaction_hash"] {
+		t.Fatalf("transfer sent %s, want the offline signature %v", hash, signed["transaction_hash"])
+	}
+	tx := h.read(t, "tx/"+hash)
+	if tx["status"] != "mined" && tx["status"] != "confirmed" {
+		t.Fatalf("transaction %s is %v after a block was mined, want mined", hash, tx["status"])
+	}
+	for i := 0; i < confirmationDepth; i++ {
+		h.Chain.Commit()
+	}
+	tx = h.read(t, "tx/"+hash)
+	if tx["status"] != "confirmed" {
+		t.Fatalf("transaction %s is %v after %d blocks, want confirmed", hash, tx["status"], confirmationDepth)
+	}
+
+	received := h.read(t, "accounts/"+recipient.name+"/balance")
+	if fmt.Sprint(received["balance"]) != "1000" {
+		t.Fatalf("balance of %s is %v, want 1000", recipient.name, received["balance"])
+	}
+	resolved := h.read(t, "addresses/"+recipient.address)
+	if resolved["name"] != recipient.name {
+		t.Fatalf("addresses/%s resolved to %v, want %s", recipient.address, resolved["name"], recipient.name)
+	}
+	t.Logf("create, sign, send and confirm passed on %s", h.Mount)
+}
+
+type testAccount struct {
+	name    string
+	address string
+}
+
+func (h *Harness) createAccount(t TestingT) testAccount {
+	t.Helper()
+	name := "acceptance-" + uuid.New()
+	account := h.write(t, "accounts/"+name, nil)
+	address, _ := account["address"].(string)
+	if address == "" {
+		t.Fatalf("account %s was created without an address", name)
+	}
+	again := h.write(t, "accounts/"+name, nil)
+	if again["address"] != address {
+		t.Fatalf("rewriting account %s changed its address", name)
+	}
+	return testAccount{name: name, address: address}
+}
@@ -0,0 +1,32 @@
+package acceptance
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// TestAcceptance runs the harness against the Vault server at VAULT_ADDR,
+// with the plugin mounted at VAULT_CORE_MOUNT, or vault-ethereum if unset.
+// It is skipped unless VAULT_ADDR is set.
+func TestAcceptance(t *testing.T) {
+	if os.Getenv(api.EnvVaultAddress) == "" {
+		t.Skipf("%s is not set", api.EnvVaultAddress)
+	}
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mount := os.Getenv("VAULT_CORE_MOUNT")
+	if mount == "" {
+		mount = "vault-ethereum"
+	}
+	chain, err := NewSimulatedChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	harness := &Harness{Client: client, Mount: mount, Chain: chain}
+	harness.Run(t)
+}
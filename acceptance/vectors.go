@@ -0,0 +1,206 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acceptance
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/core-coin/go-core/accounts"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/crypto"
+	"github.com/core-coin/go-core/rlp"
+	eddsa "github.com/core-coin/go-goldilocks"
+)
+
+// VectorKey is the private key every signature vector is signed with
+const VectorKey = "69bb68c3a00a0cd9cbf2cab316476228c758329bbfe0b1759e8634694a9497afea05bcbf24e2aa0627998d8ebe4bc7ab525bb6a2e3c6d9a17b"
+
+// VectorAddress is the address of VectorKey
+const VectorAddress = "cb578238092d6504fa8e2f71328aaa3f2a149b3768ba"
+
+// TxVector is a transaction with the exact bytes the signer must produce for
+// it. Core transactions carry the network ID in the signing hash the way
+// EIP-155 does; there are no typed (EIP-1559) transactions on the network.
+type TxVector struct {
+	Name        string
+	Nonce       uint64
+	To          string // empty for a contract creation
+	Value       int64
+	Energy      uint64
+	EnergyPrice int64
+	Data        string
+	NetworkID   int64
+	SigningHash string
+	Signed      string
+	Hash        string
+}
+
+// MessageVector is a message signed the way accounts/<name>/sign signs it:
+// the "\x19Core Signed Message:\n" prefixed SHA3 digest, like EIP-191
+type MessageVector struct {
+	Name      string
+	Message   string
+	Digest    string
+	Signature string
+}
+
+// TxVectors pins the signing hash, encoding and hash of transactions
+var TxVectors = []TxVector{
+	{
+		Name:        "transfer",
+		Nonce:       0,
+		To:          "cb270000000000000000000000000000000000000001",
+		Value:       1000,
+		Energy:      21000,
+		EnergyPrice: 1,
+		NetworkID:   1,
+		SigningHash: "0x9fbb1dd9edc4eb2fa41e75e226cb8b82a2ef18b43ca43dc0ea55950780c8cc0a",
+		Signed:      "0xf8ce80018252080196cb2700000000000000000000000000000000000000018203e880b8ab1e04bc15aeef55a13c444900674481ecc584de7199e2ea8c2a2ac02db34b9d79c8c386b2bce3e4de243a7f32fb29dd5ead202527a2bb10140078c9de0fa7b1b179ddbcde91b49494c3b600975f0b6ec11eb786365d08dd4cb94984f84eac7623dbe04bea032640439040d6d7edf50450250068d42254b8c78be6f3f23f4d8a8eb99d224ac7a26cbe7c53e300dc4ca667668b585cc461ea50fef2d474ad3dfe16ef52bae5d9fd45c34f2280",
+		Hash:        "0x8e039f08da1dc85184d96bb239a6db05f244edaa8445876cac514116ab2b341b",
+	},
+	{
+		Name:        "contract call on another network",
+		Nonce:       7,
+		To:          "cb270000000000000000000000000000000000000001",
+		Energy:      60000,
+		EnergyPrice: 1000000000,
+		Data:        "0xa9059cbb",
+		NetworkID:   3,
+		SigningHash: "0x015fc8a874843f1e170bbd01707b1f4879f12eb845afebdc443eccb29ca176b0",
+		Signed:      "0xf8d407843b9aca0082ea600396cb2700000000000000000000000000000000000000018084a9059cbbb8ab8c5dbc2ac0d0d4198f54423573205c4c8362ade7d97fe7d0e958d6f28c72b1a0cbdffe5d1f4babd119b53b52779dfdbb1f96e7e4be47396100f16d3da798f3c9acdd2bf3585b2f4d449f96f02ffcfbc27e4ee5346a06c3ff2dbb297bd3448142ceddf2c24ce3a0f7ae5ed64e7618fc5b3d0068d42254b8c78be6f3f23f4d8a8eb99d224ac7a26cbe7c53e300dc4ca667668b585cc461ea50fef2d474ad3dfe16ef52bae5d9fd45c34f2280",
+		Hash:        "0xfa536084a92aaf931e3c1adc4d35f52b65fdc5ecff9811af975a5c408c524908",
+	},
+	{
+		Name:        "contract creation",
+		Nonce:       1,
+		Energy:      100000,
+		EnergyPrice: 1,
+		Data:        "0x6080604052",
+		NetworkID:   1,
+		SigningHash: "0x79f5020ad42c2427140f5a2e29b0768b49e960f842407ad49381c72f1fc31745",
+		Signed:      "0xf8bc0101830186a0018080856080604052b8ab5c6389d0752879ef5b33c2978ed868465ad6df79337884ffd7e78bfc55e0667a6b891dcd8474b1affc055bba0512a7c55506d7afa548e4f7006d759ba9191866729299c32867955fd76e4bc669b346ff69995a2c2bfe067d4e8d7e3525765fc4b1da5e472d33294e60f46d7b6a15c6e0070068d42254b8c78be6f3f23f4d8a8eb99d224ac7a26cbe7c53e300dc4ca667668b585cc461ea50fef2d474ad3dfe16ef52bae5d9fd45c34f2280",
+		Hash:        "0xa74bc46bc67bffe7cbaeb97e729153db71aa7ba215456d6506a7aedba43bb5a3",
+	},
+}
+
+// MessageVectors pins the digest and signature of messages
+var MessageVectors = []MessageVector{
+	{
+		Name:      "text",
+		Message:   "hello",
+		Digest:    "0x1b73999586e902d53f5282d51f9aec46237f46a6ed4e9dbba2fb50cf9a87596d",
+		Signature: "0x6fe3be255765e2d92bae319042d2111571bf7a2588fff947e7674aae1e607e73008cfe2e329ed58c12e23ebf286de45ca5a81ce8c77aed9400b8fd39f5f60ac3b93711742ff4c25a1f03d5ff0df099e010e71d9f6d25afbe48ab63d6bb05acc650f6f1e4b143c38b5bb12b490aebbba52f0068d42254b8c78be6f3f23f4d8a8eb99d224ac7a26cbe7c53e300dc4ca667668b585cc461ea50fef2d474ad3dfe16ef52bae5d9fd45c34f2280",
+	},
+	{
+		Name:      "empty",
+		Message:   "",
+		Digest:    "0x5867195d981cc636da738545ce87775636904b5e5d1ff74bdafb66f4a9e303f1",
+		Signature: "0xc5c7052f21fc99648d53d86d0f2e238a5e29e10d609b63a60ba8826a626b26152f1c0bba91390636545c695761b6d997572b17d1e8dc574c8042b571bbdab92a02f4c26834f214085873fa84c9632760acb74f543b6590e91d5b7f2eba3c857252cbe5c85b23adfba49c1fb0c85d48703c0068d42254b8c78be6f3f23f4d8a8eb99d224ac7a26cbe7c53e300dc4ca667668b585cc461ea50fef2d474ad3dfe16ef52bae5d9fd45c34f2280",
+	},
+}
+
+// CheckSignatureVectors signs every vector with VectorKey and reports the
+// first output that is not byte for byte the pinned one. Ed448 signatures are
+// deterministic, so any difference is a change in the signing format.
+func CheckSignatureVectors() error {
+	key, err := crypto.HexToEDDSA(VectorKey)
+	if err != nil {
+		return err
+	}
+	if address := crypto.PubkeyToAddress(eddsa.Ed448DerivePublicKey(*key)).Hex(); address != VectorAddress {
+		return fmt.Errorf("vector key derives address %s, want %s", address, VectorAddress)
+	}
+	for _, vector := range TxVectors {
+		if err := vector.check(key); err != nil {
+			return fmt.Errorf("transaction vector %q: %v", vector.Name, err)
+		}
+	}
+	for _, vector := range MessageVectors {
+		if err := vector.check(key); err != nil {
+			return fmt.Errorf("message vector %q: %v", vector.Name, err)
+		}
+	}
+	return nil
+}
+
+func (vector TxVector) check(key *eddsa.PrivateKey) error {
+	var data []byte
+	if vector.Data != "" {
+		var err error
+		if data, err = hexutil.Decode(vector.Data); err != nil {
+			return err
+		}
+	}
+	var tx *types.Transaction
+	if vector.To == "" {
+		tx = types.NewContractCreation(vector.Nonce, big.NewInt(vector.Value), vector.Energy, big.NewInt(vector.EnergyPrice), data)
+	} else {
+		to, err := common.HexToAddress(vector.To)
+		if err != nil {
+			return err
+		}
+		tx = types.NewTransaction(vector.Nonce, to, big.NewInt(vector.Value), vector.Energy, big.NewInt(vector.EnergyPrice), data)
+	}
+	signer := types.NewNucleusSigner(big.NewInt(vector.NetworkID))
+	signed, err := types.SignTx(tx, signer, key)
+	if err != nil {
+		return err
+	}
+	// the signing hash covers the network ID, which SignTx sets
+	if hash := signer.Hash(signed).Hex(); hash != vector.SigningHash {
+		return fmt.Errorf("signing hash is %s, want %s", hash, vector.SigningHash)
+	}
+	raw, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		return err
+	}
+	if encoded := hexutil.Encode(raw); encoded != vector.Signed {
+		return fmt.Errorf("signed transaction is %s, want %s", encoded, vector.Signed)
+	}
+	if hash := signed.Hash().Hex(); hash != vector.Hash {
+		return fmt.Errorf("transaction hash is %s, want %s", hash, vector.Hash)
+	}
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return err
+	}
+	if sender.Hex() != VectorAddress {
+		return fmt.Errorf("recovered sender %s, want %s", sender.Hex(), VectorAddress)
+	}
+	return nil
+}
+
+func (vector MessageVector) check(key *eddsa.PrivateKey) error {
+	digest, _ := accounts.TextAndHash([]byte(vector.Message))
+	if encoded := hexutil.Encode(digest); encoded != vector.Digest {
+		return fmt.Errorf("digest is %s, want %s", encoded, vector.Digest)
+	}
+	signature, err := crypto.Sign(digest, key)
+	if err != nil {
+		return err
+	}
+	want, err := hexutil.Decode(vector.Signature)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(signature, want) {
+		return fmt.Errorf("signature is %s, want %s", hexutil.Encode(signature), vector.Signature)
+	}
+	return nil
+}
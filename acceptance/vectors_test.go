@@ -0,0 +1,9 @@
+package acceptance
+
+import "testing"
+
+func TestSignatureVectors(t *testing.T) {
+	if err := CheckSignatureVectors(); err != nil {
+		t.Fatal(err)
+	}
+}
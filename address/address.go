@@ -0,0 +1,331 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package address validates and formats the addresses of the chains the
+// plugin and the services around it deal with. Every Parse function accepts
+// surrounding whitespace and rejects anything that is not exactly one
+// well-formed address; Normalize returns the canonical form to store and
+// compare.
+package address
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/core-coin/go-core/common"
+	"golang.org/x/crypto/sha3"
+)
+
+// Chain is a family of addresses
+type Chain string
+
+const (
+	// Core addresses are ICAN: a network prefix, a checksum and 20 bytes, in hex
+	Core Chain = "core"
+	// Ethereum addresses are 20 bytes in hex, EIP-55 checksummed when mixed case
+	Ethereum Chain = "ethereum"
+	// Bitcoin addresses are base58check (P2PKH, P2SH) or segwit bech32 and bech32m
+	Bitcoin Chain = "bitcoin"
+	// Cosmos addresses are bech32 with the human readable part of their chain
+	Cosmos Chain = "cosmos"
+	// Solana addresses are 32 byte public keys in base58
+	Solana Chain = "solana"
+	// Tron addresses are the 20 bytes of an Ethereum address in base58check, with version 0x41
+	Tron Chain = "tron"
+)
+
+// Chains are the chains Normalize knows
+var Chains = []Chain{Core, Ethereum, Bitcoin, Cosmos, Solana, Tron}
+
+// tronVersion is the version byte of Tron addresses, which puts a T in front
+const tronVersion byte = 0x41
+
+// base58Alphabet is the alphabet of Bitcoin, Solana and Tron addresses
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// isBase58 reports whether input is made of base58 characters only; the
+// decoder of btcutil indexes a 256 entry table with each rune and panics
+// on anything past it
+func isBase58(input string) bool {
+	for i := 0; i < len(input); i++ {
+		if strings.IndexByte(base58Alphabet, input[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// trimHex removes whitespace and a 0x prefix
+func trimHex(input string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(input), "0x"), "0X")
+}
+
+// ParseCore validates and decodes a Core address. The input must be the full
+// address in a single case, with or without a 0x prefix, and must carry the
+// network prefix and ICAN checksum of the network the node is running.
+func ParseCore(input string, lowercaseOnly bool) (common.Address, error) {
+	hexAddress := trimHex(input)
+	if len(hexAddress) != 2*common.AddressLength {
+		return common.Address{}, fmt.Errorf("%q is not %d hex characters long", input, 2*common.AddressLength)
+	}
+	lower := strings.ToLower(hexAddress)
+	if hexAddress != lower && hexAddress != strings.ToUpper(hexAddress) {
+		return common.Address{}, fmt.Errorf("%q mixes upper and lower case", input)
+	}
+	if lowercaseOnly && hexAddress != lower {
+		return common.Address{}, fmt.Errorf("%q is not lowercase", input)
+	}
+	address, err := common.HexToAddress(lower)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%q: %v", input, err)
+	}
+	return address, nil
+}
+
+// ParseEthereum validates an Ethereum address and returns its 20 bytes. An
+// address in a single case is taken as is; one in mixed case must carry a
+// valid EIP-55 checksum.
+func ParseEthereum(input string) ([]byte, error) {
+	hexAddress := trimHex(input)
+	if len(hexAddress) != 40 {
+		return nil, fmt.Errorf("%q is not 40 hex characters long", input)
+	}
+	address, err := hex.DecodeString(hexAddress)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not hex", input)
+	}
+	if hexAddress != strings.ToLower(hexAddress) && hexAddress != strings.ToUpper(hexAddress) {
+		if FormatEthereum(address) != "0x"+hexAddress {
+			return nil, fmt.Errorf("%q has an invalid EIP-55 checksum", input)
+		}
+	}
+	return address, nil
+}
+
+// FormatEthereum returns the EIP-55 checksummed form of a 20 byte address
+func FormatEthereum(address []byte) string {
+	lower := hex.EncodeToString(address)
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(lower))
+	digest := hash.Sum(nil)
+	result := []byte(lower)
+	for i, c := range result {
+		nibble := digest[i/2] >> 4
+		if i%2 == 1 {
+			nibble = digest[i/2] & 0x0f
+		}
+		if c > '9' && nibble >= 8 {
+			result[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(result)
+}
+
+// BitcoinAddress is a decoded Bitcoin address
+type BitcoinAddress struct {
+	// Network is mainnet, testnet or regtest
+	Network string
+	// Type is p2pkh, p2sh, p2wpkh, p2wsh, p2tr or, for future witness versions, segwit
+	Type string
+	// Version is the witness version of a segwit address
+	Version byte
+	// Program is the hash or witness program the address pays to
+	Program []byte
+}
+
+var bitcoinSegwitNetworks = map[string]string{"bc": "mainnet", "tb": "testnet", "bcrt": "regtest"}
+
+// ParseBitcoin validates and decodes a Bitcoin address
+func ParseBitcoin(input string) (*BitcoinAddress, error) {
+	input = strings.TrimSpace(input)
+	lower := strings.ToLower(input)
+	for hrp, network := range bitcoinSegwitNetworks {
+		if strings.HasPrefix(lower, hrp+"1") {
+			return parseSegwit(input, hrp, network)
+		}
+	}
+	if !isBase58(input) {
+		return nil, fmt.Errorf("%q is neither base58check nor segwit", input)
+	}
+	payload, version, err := base58.CheckDecode(input)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither base58check nor segwit: %v", input, err)
+	}
+	if len(payload) != 20 {
+		return nil, fmt.Errorf("%q does not hold a 20 byte hash", input)
+	}
+	address := &BitcoinAddress{Program: payload}
+	switch version {
+	case 0x00:
+		address.Network, address.Type = "mainnet", "p2pkh"
+	case 0x05:
+		address.Network, address.Type = "mainnet", "p2sh"
+	case 0x6f:
+		address.Network, address.Type = "testnet", "p2pkh"
+	case 0xc4:
+		address.Network, address.Type = "testnet", "p2sh"
+	default:
+		return nil, fmt.Errorf("%q has the unknown version byte %#x", input, version)
+	}
+	return address, nil
+}
+
+// parseSegwit decodes a segwit address as BIP-173 and BIP-350 require:
+// bech32 for witness version 0, bech32m for the others
+func parseSegwit(input, hrp, network string) (*BitcoinAddress, error) {
+	decodedHRP, data, encoding, err := bech32.DecodeGeneric(input)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", input, err)
+	}
+	if decodedHRP != hrp || len(data) == 0 {
+		return nil, fmt.Errorf("%q is not a segwit address", input)
+	}
+	version := data[0]
+	program, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", input, err)
+	}
+	if version > 16 || len(program) < 2 || len(program) > 40 {
+		return nil, fmt.Errorf("%q has an invalid witness program", input)
+	}
+	if (version == 0) != (encoding == bech32.Version0) {
+		return nil, fmt.Errorf("%q uses the wrong checksum for witness version %d", input, version)
+	}
+	address := &BitcoinAddress{Network: network, Type: "segwit", Version: version, Program: program}
+	switch {
+	case version == 0 && len(program) == 20:
+		address.Type = "p2wpkh"
+	case version == 0 && len(program) == 32:
+		address.Type = "p2wsh"
+	case version == 0:
+		return nil, fmt.Errorf("%q has a witness program of %d bytes", input, len(program))
+	case version == 1 && len(program) == 32:
+		address.Type = "p2tr"
+	}
+	return address, nil
+}
+
+// ParseCosmos validates a Cosmos SDK address and returns its bytes. The
+// human readable part must be hrp, such as cosmos or osmo, unless hrp is
+// empty. Account addresses hold 20 bytes and module or contract addresses 32.
+func ParseCosmos(input, hrp string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+	decodedHRP, data, encoding, err := bech32.DecodeGeneric(input)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", input, err)
+	}
+	if encoding != bech32.Version0 {
+		return nil, fmt.Errorf("%q is bech32m, not bech32", input)
+	}
+	if hrp != "" && decodedHRP != hrp {
+		return nil, fmt.Errorf("%q does not start with %s1", input, hrp)
+	}
+	address, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", input, err)
+	}
+	if len(address) != 20 && len(address) != 32 {
+		return nil, fmt.Errorf("%q holds %d bytes, not 20 or 32", input, len(address))
+	}
+	return address, nil
+}
+
+// FormatCosmos encodes address bytes with a human readable part
+func FormatCosmos(hrp string, address []byte) (string, error) {
+	data, err := bech32.ConvertBits(address, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode(hrp, data)
+}
+
+// ParseSolana validates a Solana address and returns its 32 bytes
+func ParseSolana(input string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+	if !isBase58(input) {
+		return nil, fmt.Errorf("%q is not a base58 encoded 32 byte key", input)
+	}
+	address := base58.Decode(input)
+	if len(address) != 32 || base58.Encode(address) != input {
+		return nil, fmt.Errorf("%q is not a base58 encoded 32 byte key", input)
+	}
+	return address, nil
+}
+
+// ParseTron validates a Tron address and returns its 20 bytes
+func ParseTron(input string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+	if !isBase58(input) {
+		return nil, fmt.Errorf("%q is not a base58check Tron address", input)
+	}
+	address, version, err := base58.CheckDecode(input)
+	if err != nil || version != tronVersion || len(address) != 20 {
+		return nil, fmt.Errorf("%q is not a base58check Tron address", input)
+	}
+	return address, nil
+}
+
+// FormatTron returns the base58check form of a 20 byte Tron address
+func FormatTron(address []byte) string {
+	return base58.CheckEncode(address, tronVersion)
+}
+
+// Normalize validates an address of a chain and returns its canonical form:
+// lowercase hex without 0x for Core, EIP-55 for Ethereum, and lowercase for
+// bech32. Base58 addresses are case sensitive and returned as they are.
+func Normalize(chain Chain, input string) (string, error) {
+	switch chain {
+	case Core:
+		address, err := ParseCore(input, false)
+		if err != nil {
+			return "", err
+		}
+		return address.Hex(), nil
+	case Ethereum:
+		address, err := ParseEthereum(input)
+		if err != nil {
+			return "", err
+		}
+		return FormatEthereum(address), nil
+	case Bitcoin:
+		if _, err := ParseBitcoin(input); err != nil {
+			return "", err
+		}
+		input = strings.TrimSpace(input)
+		if lower := strings.ToLower(input); strings.HasPrefix(lower, "bc1") || strings.HasPrefix(lower, "tb1") || strings.HasPrefix(lower, "bcrt1") {
+			return lower, nil
+		}
+		return input, nil
+	case Cosmos:
+		if _, err := ParseCosmos(input, ""); err != nil {
+			return "", err
+		}
+		return strings.ToLower(strings.TrimSpace(input)), nil
+	case Solana:
+		if _, err := ParseSolana(input); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(input), nil
+	case Tron:
+		address, err := ParseTron(input)
+		if err != nil {
+			return "", err
+		}
+		return FormatTron(address), nil
+	}
+	return "", fmt.Errorf("unknown chain %q", chain)
+}
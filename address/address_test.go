@@ -0,0 +1,146 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package address
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestSegwitVectors(t *testing.T) {
+	// the valid addresses of BIP-173 and BIP-350 on the networks ParseBitcoin knows
+	for _, vector := range []struct{ address, network, kind, program string }{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "mainnet", "p2wpkh", "751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "testnet", "p2wsh", "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", "testnet", "p2wsh", "000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", "testnet", "p2tr", "000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "mainnet", "p2tr", "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "mainnet", "segwit", "751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", "mainnet", "segwit", "751e"},
+	} {
+		address, err := ParseBitcoin(vector.address)
+		if err != nil {
+			t.Fatalf("%s: %v", vector.address, err)
+		}
+		if address.Network != vector.network || address.Type != vector.kind || hex.EncodeToString(address.Program) != vector.program {
+			t.Fatalf("%s decoded as %s %s %x", vector.address, address.Network, address.Type, address.Program)
+		}
+		if normalized, _ := Normalize(Bitcoin, vector.address); normalized != strings.ToLower(vector.address) {
+			t.Fatalf("%s normalized to %s", vector.address, normalized)
+		}
+	}
+	// invalid addresses of BIP-350, and the BIP-173 addresses it invalidates
+	for _, address := range []string{
+		// bech32 where bech32m is required, and the other way round
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd",
+		"tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf",
+		"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL",
+		"tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47",
+		"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7k7grplx",
+		"bc1zw508d6qejxtdg4y5r3zarvaryvg6kdaj",
+		// witness version 17, a one byte program, a 16 byte version 0 program
+		"BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R",
+		"bc1pw5dgrnzv",
+		"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P",
+		// an unknown human readable part and a broken checksum
+		"tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",
+	} {
+		if _, err := ParseBitcoin(address); err == nil {
+			t.Fatalf("%s was accepted", address)
+		}
+	}
+}
+
+func TestBase58CheckVectors(t *testing.T) {
+	for _, vector := range []struct{ address, network, kind, hash string }{
+		// the coinbase address of the genesis block
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "mainnet", "p2pkh", "62e907b15cbf27d5425399ebf6f0fb50ebb88f18"},
+		// the P2SH and testnet examples of the Bitcoin wiki
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", "mainnet", "p2sh", "b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"},
+		{"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", "testnet", "p2pkh", "243f1394f44554f4ce3fd68649c19adc483ce924"},
+	} {
+		address, err := ParseBitcoin(vector.address)
+		if err != nil {
+			t.Fatalf("%s: %v", vector.address, err)
+		}
+		if address.Network != vector.network || address.Type != vector.kind || hex.EncodeToString(address.Program) != vector.hash {
+			t.Fatalf("%s decoded as %s %s %x", vector.address, address.Network, address.Type, address.Program)
+		}
+	}
+	for _, address := range []string{
+		"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb",
+		"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfN0",
+	} {
+		if _, err := ParseBitcoin(address); err == nil {
+			t.Fatalf("%s was accepted", address)
+		}
+	}
+}
+
+func TestSolanaVectors(t *testing.T) {
+	for _, vector := range []struct{ address, key string }{
+		// the system program and the SPL token program
+		{"11111111111111111111111111111111", strings.Repeat("00", 32)},
+		{"TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA", "06ddf6e1d765a193d9cbe146ceeb79ac1cb485ed5f5b37913a8cf5857eff00a9"},
+	} {
+		key, err := ParseSolana(vector.address)
+		if err != nil {
+			t.Fatalf("%s: %v", vector.address, err)
+		}
+		if hex.EncodeToString(key) != vector.key {
+			t.Fatalf("%s decoded as %x", vector.address, key)
+		}
+	}
+	for _, address := range []string{
+		// 31 bytes, a leading zero too many, and a character outside base58
+		"1111111111111111111111111111111",
+		"1TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+		"TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5D0",
+	} {
+		if _, err := ParseSolana(address); err == nil {
+			t.Fatalf("%s was accepted", address)
+		}
+	}
+}
+
+func TestCoreICANVectors(t *testing.T) {
+	// a mainnet address: cb, then the ISO 13616 check digits 57 of the 20 bytes
+	const ican = "cb57bbbb54cdf60fa666fd741be78f794d4608d67109"
+	for _, input := range []string{ican, "0x" + ican, strings.ToUpper(ican), " " + ican + "\n"} {
+		address, err := ParseCore(input, false)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		if address.Hex() != ican {
+			t.Fatalf("%q decoded as %s", input, address.Hex())
+		}
+	}
+	for _, input := range []string{
+		// the wrong check digits, a testnet address, mixed case, a byte short
+		"cb58bbbb54cdf60fa666fd741be78f794d4608d67109",
+		"ab792215c43fc213c02182c8389f2bc32408e2c50922",
+		"cb57BBBB54cdf60fa666fd741be78f794d4608d67109",
+		"cb57bbbb54cdf60fa666fd741be78f794d4608d671",
+	} {
+		if _, err := ParseCore(input, false); err == nil {
+			t.Fatalf("%q was accepted", input)
+		}
+	}
+	if _, err := ParseCore(strings.ToUpper(ican), true); err == nil {
+		t.Fatal("an uppercase address was accepted where only lowercase is")
+	}
+}
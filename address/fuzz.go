@@ -0,0 +1,42 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package address
+
+// FuzzNormalize feeds an address to the parser of every chain, as the
+// address book and the sanctions and travel rule checks take it from callers.
+// A Normalize that succeeds must return an address it parses again to
+// itself. Run it with go-fuzz:
+//
+//	go-fuzz-build -func FuzzNormalize
+//	go-fuzz -func FuzzNormalize -workdir testdata/fuzz/FuzzNormalize
+func FuzzNormalize(data []byte) int {
+	input := string(data)
+	interesting := 0
+	for _, chain := range Chains {
+		normalized, err := Normalize(chain, input)
+		if err != nil {
+			continue
+		}
+		interesting = 1
+		again, err := Normalize(chain, normalized)
+		if err != nil || again != normalized {
+			panic(string(chain) + ": " + normalized + " does not normalize to itself")
+		}
+	}
+	return interesting
+}
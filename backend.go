@@ -17,14 +17,28 @@ package main
 import (
 	"context"
 	"fmt"
+	"sync"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
 const (
 	// Symbol is the lowercase crypto token symbol
 	Symbol string = "eth"
+	// maxExternalResponse caps what is read of an answer from a service the
+	// mount calls out to: the policy hook, the screening and MFA APIs, the
+	// private relays, and shadow and transit mounts
+	maxExternalResponse int64 = 1 << 20
+)
+
+// Version and Commit identify the build of the plugin; set them with
+// -ldflags "-X main.Version=<version> -X main.Commit=<git commit>"
+var (
+	Version = "dev"
+	Commit  = "unknown"
 )
 
 // Factory returns the backend
@@ -57,25 +71,96 @@ func FactoryType(backendType logical.BackendType) logical.Factory {
 // Backend returns the backend
 func Backend(conf *logical.BackendConfig) (*PluginBackend, error) {
 	var b PluginBackend
+	b.rpcRegistry = newRPCRegistry()
+	b.headWatchers = newHeadWatchers()
+	b.accountIndex = newAccountIndex()
+	b.logSampler = newLogSampler(LogSampleWindow)
+	b.scrubber = &scrubber{}
+	b.decisionLog = newDecisionLog()
+	b.policyCache = newPolicyCache()
+	b.screeningCache = newScreeningCache()
+	b.sanctionsIndex = &sanctionsIndex{}
+	b.initStatus = &initStatus{}
 	b.Backend = &framework.Backend{
-		Help: "",
+		Help: backendHelp,
 		Paths: framework.PathAppend(
 			configPaths(&b),
+			freezePaths(&b),
+			logLevelPaths(&b),
+			rpcStatusPaths(&b),
+			healthPaths(&b),
+			infoPaths(&b),
+			pluginInfoPaths(&b),
 			accountPaths(&b),
+			addressPaths(&b),
+			chainPaths(&b),
+			decisionPaths(&b),
+			decodePaths(&b),
+			selectorPaths(&b),
+			addressBookPaths(&b),
+			canaryPaths(&b),
+			ceremonyPaths(&b),
+			clefPaths(&b),
+			grantPaths(&b),
+			sessionPaths(&b),
+			txPaths(&b),
+			spendPaths(&b),
+			disbursementPaths(&b),
+			exportPaths(&b),
+			proofPaths(&b),
+			importPaths(&b),
+			groupPaths(&b),
+			bundlePaths(&b),
+			mnemonicPaths(&b),
+			activityPaths(&b),
+			inventoryPaths(&b),
+			authorizationPaths(&b),
+			ticketPaths(&b),
+			mfaPaths(&b),
+			sanctionsPaths(&b),
+			backupPaths(&b),
+			shadowPaths(&b),
+			anomalyPaths(&b),
+			travelRulePaths(&b),
+			approvalPaths(&b),
+			templatePaths(&b),
+			schedulePaths(&b),
+			gasTankPaths(&b),
+			migrationPaths(&b),
+			blsPaths(&b),
+			keyPaths(&b),
+			ledgerPaths(&b),
+			profilePaths(&b),
 			convertPaths(&b),
 			erc20Paths(&b),
+			permitPaths(&b),
 		),
 		PathsSpecial: &logical.Paths{
 			Unauthenticated: []string{
+				"approval-callback/*",
 				"convert",
 				"test",
 			},
-			SealWrapStorage: []string{
-				"accounts/",
-			},
+			LocalStorage:    LocalPaths(&b),
+			SealWrapStorage: SealWrappedPaths(&b),
 		},
-		Secrets:     []*framework.Secret{},
-		BackendType: logical.TypeLogical,
+		Secrets: []*framework.Secret{
+			signingGrantSecret(&b),
+		},
+		InitializeFunc: b.initialize,
+		PeriodicFunc:   b.periodic,
+		Invalidate:     b.invalidate,
+		Clean:          b.clean,
+		BackendType:    logical.TypeLogical,
+	}
+	for _, path := range b.Backend.Paths {
+		for operation, callback := range path.Callbacks {
+			if _, ok := path.Fields["to_label"]; ok {
+				callback = b.withAddressLabels(callback)
+			}
+			path.Callbacks[operation] = withErrorCodes(b.withRequestLogging(callback))
+		}
+		documentOperations(path)
 	}
 	return &b, nil
 }
@@ -83,6 +168,69 @@ func Backend(conf *logical.BackendConfig) (*PluginBackend, error) {
 // PluginBackend implements the Backend for this plugin
 type PluginBackend struct {
 	*framework.Backend
+	rpcRegistry  *rpcRegistry
+	headWatchers *headWatchers
+	accountIndex *accountIndex
+	// envelopeLock serializes the creation of data keys and the mount key
+	envelopeLock sync.Mutex
+	// logLevel is the level last set from log_level
+	logLevel     hclog.Level
+	logLevelLock sync.Mutex
+	logSampler   *logSampler
+	scrubber     *scrubber
+	decisionLog  *decisionLog
+	policyCache  *policyCache
+	initStatus   *initStatus
+	// screeningCache holds the verdicts of the screening API
+	screeningCache *screeningCache
+	sanctionsIndex *sanctionsIndex
+	shadowStats    shadowStats
+	// slowRequestThreshold is the slow_request_threshold of config, as a time.Duration
+	slowRequestThreshold int64
+	slowRequests         uint64
+}
+
+// periodic is run by Vault about once a minute
+func (b *PluginBackend) periodic(ctx context.Context, req *logical.Request) error {
+	b.logSampler.flush(b.Logger())
+	// schedules, gas tanks, the inventory push and the sanctions list keep
+	// their state in replicated storage, so only the cluster that writes it
+	// runs them; each cluster tracks what it sent
+	if !b.replicaOnly() {
+		if err := b.runSchedules(ctx, req); err != nil {
+			b.Logger().Error("cannot run schedules", "error", err)
+		}
+		if err := b.refillGasTanks(ctx, req); err != nil {
+			b.Logger().Error("cannot refill gas tanks", "error", err)
+		}
+		if err := b.runInventoryPush(ctx, req); err != nil {
+			b.Logger().Error("cannot push inventory", "error", err)
+		}
+		if err := b.refreshSanctionsList(ctx, req); err != nil {
+			b.Logger().Error("cannot refresh the sanctions list", "error", err)
+		}
+	}
+	if err := b.watchHeads(ctx, req); err != nil {
+		b.Logger().Error("cannot subscribe to new heads", "error", err)
+	}
+	return b.trackTransactions(ctx, req)
+}
+
+// replicaOnly reports whether this node cannot write the replicated entries of
+// the mount, as on a performance secondary or performance standby, where
+// Vault forwards the requests that write them
+func (b *PluginBackend) replicaOnly() bool {
+	if b.System() == nil {
+		return false
+	}
+	return b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary | consts.ReplicationPerformanceStandby)
+}
+
+// clean is run by Vault when the plugin is unloaded
+func (b *PluginBackend) clean(ctx context.Context) {
+	b.headWatchers.stop(nil)
+	b.decisionLog.stop()
+	b.decisionLog.syncAll()
 }
 
 // QualifiedPath prepends the token symbol to the path
@@ -95,9 +243,38 @@ func ContractPath(contract, method string) string {
 	return fmt.Sprintf("%s/%s/%s", QualifiedPath("accounts/"+framework.GenericNameRegex("name")), contract, method)
 }
 
-// SealWrappedPaths returns the paths that are seal wrapped
+// LocalPaths returns the storage prefixes that are not replicated to
+// performance secondaries: the transactions a cluster sent and tracks, the
+// account activity it handled, the anomaly profiles it learned from the
+// transactions it signed, and the entry health writes. Keys, accounts,
+// config, anomaly freezes and the spend counters that enforce limits across
+// clusters are replicated, and every entry, local or not, is replicated to
+// DR secondaries.
+func LocalPaths(b *PluginBackend) []string {
+	return []string{
+		QualifiedPath("activity/"),
+		QualifiedPath("anomalies/"),
+		QualifiedPath("health/"),
+		QualifiedPath("tx/"),
+	}
+}
+
+// SealWrappedPaths returns the storage prefixes whose entries hold key
+// material: account mnemonics and their envelopes, the mnemonics accounts are
+// derived from, the mount and data keys, BLS keys, secp256r1, secp256k1 and
+// ed25519 keys, session keys, TOTP secrets, the ceremony attestor key and the
+// decision log chain key. Seals that can wrap entries, such as HSM and cloud
+// KMS seals, encrypt these with the seal as well as the barrier.
 func SealWrappedPaths(b *PluginBackend) []string {
 	return []string{
 		QualifiedPath("accounts/"),
+		QualifiedPath("bls-keys/"),
+		QualifiedPath("ceremony/"),
+		QualifiedPath("decisions/"),
+		QualifiedPath("envelope/"),
+		QualifiedPath("keys/"),
+		QualifiedPath("mfa/"),
+		QualifiedPath("mnemonics/"),
+		QualifiedPath("sessions/"),
 	}
 }
@@ -0,0 +1,244 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// BroadcastPublic sends transactions through the RPC endpoints to the public mempool
+	BroadcastPublic string = "public"
+	// BroadcastPrivate sends transactions only to the private relays
+	BroadcastPrivate string = "private"
+
+	// sendRawTransaction is the JSON-RPC method that broadcasts a signed transaction
+	sendRawTransaction string = "xcb_sendRawTransaction"
+)
+
+// broadcastSchema sets how an account broadcasts the transactions it sends
+var broadcastSchema = &framework.FieldSchema{
+	Type:          framework.TypeString,
+	AllowedValues: []interface{}{Empty, BroadcastPublic, BroadcastPrivate},
+	Description: `How the account broadcasts the transactions it sends: public through the RPC
+endpoints, or private to the private relays of the mount or of the chain only,
+so that large transfers are not front-run or sandwiched from the mempool. The
+mount's broadcast_mode if empty.`,
+}
+
+// parseBroadcast checks the broadcast of an account; Empty is the mount's
+func parseBroadcast(mode string) (string, error) {
+	switch mode {
+	case Empty, BroadcastPublic, BroadcastPrivate:
+		return mode, nil
+	}
+	return Empty, fmt.Errorf("%w: unknown broadcast %s", ErrInvalidInput, mode)
+}
+
+// broadcastMode returns how the account broadcasts under config
+func (account *AccountJSON) broadcastMode(config *ConfigJSON) string {
+	if account.Broadcast != Empty {
+		return account.Broadcast
+	}
+	return config.broadcastMode()
+}
+
+type broadcastKey struct{}
+
+// withBroadcast notes in the context whether the account's transactions go
+// to the private relays; every RPC client dialed with it then sends them
+// there and nowhere else
+func (b *PluginBackend) withBroadcast(ctx context.Context, req *logical.Request, name string) (context.Context, error) {
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return ctx, err
+	}
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, broadcastKey{}, accountJSON.broadcastMode(config) == BroadcastPrivate), nil
+}
+
+// privateBroadcast reports whether the transactions of the request go to the private relays
+func privateBroadcast(ctx context.Context) bool {
+	private, _ := ctx.Value(broadcastKey{}).(bool)
+	return private
+}
+
+// rpcMethods returns the methods of a JSON-RPC request or batch
+func rpcMethods(body []byte) []string {
+	var call struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &call); err == nil {
+		return []string{call.Method}
+	}
+	var batch []struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil
+	}
+	methods := make([]string, 0, len(batch))
+	for _, call := range batch {
+		methods = append(methods, call.Method)
+	}
+	return methods
+}
+
+// sendsTransaction reports whether a JSON-RPC request broadcasts a
+// transaction, and refuses a batch that does it among other calls: the relays
+// would be sent calls they do not answer, or the node a transaction it must
+// not see
+func sendsTransaction(body []byte) (bool, error) {
+	methods := rpcMethods(body)
+	sends := 0
+	for _, method := range methods {
+		if method == sendRawTransaction {
+			sends++
+		}
+	}
+	if sends > 0 && sends < len(methods) {
+		return false, fmt.Errorf("%w: a privately broadcast transaction cannot be batched with other calls", ErrInvalidInput)
+	}
+	return sends > 0, nil
+}
+
+// relayResult is the answer of one private relay
+type relayResult struct {
+	relay  string
+	status int
+	body   []byte
+	err    error
+}
+
+// accepted reports whether the relay took the transaction
+func (result *relayResult) accepted() bool {
+	if result.err != nil || result.status != http.StatusOK {
+		return false
+	}
+	var answer struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(result.body, &answer); err != nil {
+		return false
+	}
+	return answer.Error == nil || isAlreadyKnown(answer.Error.Message)
+}
+
+// isAlreadyKnown reports whether a relay refused a transaction only because it has it
+func isAlreadyKnown(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "already known") || strings.Contains(message, "known transaction")
+}
+
+// relayTransaction sends a JSON-RPC request that broadcasts a transaction to
+// every private relay at once, and returns the answer of one that accepted
+// it; if none did, the first refusal. It never falls back to the mempool.
+func relayTransaction(ctx context.Context, relays []string, body []byte, timeout time.Duration) (*relayResult, error) {
+	if len(relays) == 0 {
+		return nil, fmt.Errorf("%w: the account broadcasts privately and no private_relay_urls are configured", ErrInvalidInput)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	results := make([]*relayResult, len(relays))
+	var wg sync.WaitGroup
+	for i, relay := range relays {
+		wg.Add(1)
+		go func(i int, relay string) {
+			defer wg.Done()
+			results[i] = askRelay(ctx, relay, body, nil)
+		}(i, relay)
+	}
+	wg.Wait()
+	var refused *relayResult
+	for _, result := range results {
+		if result.accepted() {
+			return result, nil
+		}
+		if refused == nil && result.err == nil {
+			refused = result
+		}
+	}
+	if refused != nil {
+		return refused, nil
+	}
+	return nil, fmt.Errorf("%w: no private relay could be reached: %v", ErrRPCUnavailable, results[0].err)
+}
+
+// askRelay posts a JSON-RPC request to a relay with the headers given
+func askRelay(ctx context.Context, relay string, body []byte, header http.Header) *relayResult {
+	result := &relayResult{relay: relay}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, relay, bytes.NewReader(body))
+	if err != nil {
+		result.err = err
+		return result
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if requestID := requestIDFromContext(ctx); requestID != Empty {
+		request.Header.Set("X-Request-Id", requestID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		result.err = fmt.Errorf("%s: %v", relay, err)
+		return result
+	}
+	defer response.Body.Close()
+	result.status = response.StatusCode
+	if result.body, err = ioutil.ReadAll(io.LimitReader(response.Body, maxExternalResponse)); err != nil {
+		result.err = fmt.Errorf("%s: %v", relay, err)
+	}
+	return result
+}
+
+// relayRawTransaction broadcasts a signed transaction to the private relays
+// outside of a client, as the rebroadcast of a reorged transaction does
+func relayRawTransaction(ctx context.Context, config *ConfigJSON, encoded string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  sendRawTransaction,
+		"params":  []string{encoded},
+	})
+	if err != nil {
+		return err
+	}
+	result, err := relayTransaction(ctx, config.PrivateRelayURLs, body, time.Duration(config.rpcTimeout())*time.Second)
+	if err != nil {
+		return err
+	}
+	if !result.accepted() {
+		return fmt.Errorf("%s refused the transaction: %s", result.relay, strings.TrimSpace(string(result.body)))
+	}
+	return nil
+}
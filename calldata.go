@@ -0,0 +1,234 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// calldataRule constrains the decoded calldata of a transaction, such as
+// "erc20.transfer.tokens <= 1000e18" or "method in [approve, transfer]".
+// Fields are method, selector, signature and abi, which apply to every call,
+// or <abi>.<method>.<argument>, which applies only to calls of that method.
+type calldataRule struct {
+	text   string
+	field  string
+	op     string
+	values []string
+}
+
+// calldataRulesSchema is the field that sets calldata rules on the config or an account
+var calldataRulesSchema = &framework.FieldSchema{
+	Type:        framework.TypeStringSlice,
+	Description: `Rules the decoded calldata of a transaction must satisfy, such as "erc20.transfer.tokens <= 1000e18" or "method in [approve, transfer]". Calldata no known ABI or selector names has no method and fails rules on it.`,
+}
+
+var (
+	comparisonRule = regexp.MustCompile(`^([A-Za-z0-9_$.]+)\s*(==|!=|<=|>=|<|>)\s*(.+)$`)
+	membershipRule = regexp.MustCompile(`^([A-Za-z0-9_$.]+)\s+(not\s+in|in)\s+\[(.*)\]$`)
+)
+
+// parseCalldataRule parses one rule
+func parseCalldataRule(text string) (*calldataRule, error) {
+	text = strings.TrimSpace(text)
+	rule := &calldataRule{text: text}
+	if match := membershipRule.FindStringSubmatch(text); match != nil {
+		rule.field, rule.op = match[1], strings.Join(strings.Fields(match[2]), " ")
+		for _, value := range strings.Split(match[3], ",") {
+			if value = unquote(value); value != Empty {
+				rule.values = append(rule.values, value)
+			}
+		}
+	} else if match := comparisonRule.FindStringSubmatch(text); match != nil {
+		rule.field, rule.op, rule.values = match[1], match[2], []string{unquote(match[3])}
+	} else {
+		return nil, fmt.Errorf("%w: calldata rule %q is not <field> <op> <value>", ErrInvalidInput, text)
+	}
+	switch parts := strings.Split(rule.field, "."); len(parts) {
+	case 1:
+		switch rule.field {
+		case "method", "selector", "signature", "abi":
+		default:
+			return nil, fmt.Errorf("%w: calldata rule %q: unknown field %s", ErrInvalidInput, text, rule.field)
+		}
+	case 3:
+	default:
+		return nil, fmt.Errorf("%w: calldata rule %q: fields are method, selector, signature, abi or <abi>.<method>.<argument>", ErrInvalidInput, text)
+	}
+	switch rule.op {
+	case "<", "<=", ">", ">=":
+		if parseRuleNumber(rule.values[0]) == nil {
+			return nil, fmt.Errorf("%w: calldata rule %q compares with a value that is not a number", ErrInvalidInput, text)
+		}
+	}
+	return rule, nil
+}
+
+// parseCalldataRules parses rules as they are written to the config or an account
+func parseCalldataRules(texts []string) ([]string, error) {
+	rules := []string{}
+	for _, text := range texts {
+		rule, err := parseCalldataRule(text)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule.text)
+	}
+	return rules, nil
+}
+
+func unquote(value string) string {
+	return strings.Trim(strings.TrimSpace(value), `"'`)
+}
+
+// parseRuleNumber parses an integer, allowing an exponent such as 1000e18
+func parseRuleNumber(value string) *big.Int {
+	number, ok := new(big.Rat).SetString(value)
+	if !ok || !number.IsInt() {
+		return nil
+	}
+	return number.Num()
+}
+
+// check returns an error if call breaks the rule. Rules on the arguments of
+// another method do not apply.
+func (rule *calldataRule) check(call *DecodedCall) error {
+	var actual string
+	switch parts := strings.Split(rule.field, "."); rule.field {
+	case "method":
+		actual = call.Method
+	case "selector":
+		actual = call.Selector
+	case "signature":
+		actual = call.Signature
+	case "abi":
+		actual = call.ABI
+	default:
+		if call.ABI != parts[0] || call.Method != parts[1] {
+			return nil
+		}
+		value, ok := call.Arguments[parts[2]]
+		if !ok {
+			return fmt.Errorf("%w: calldata rule %q: %s has no argument %s", ErrPolicyViolation, rule.text, call.Signature, parts[2])
+		}
+		actual = fmt.Sprint(value)
+	}
+	var ok bool
+	switch rule.op {
+	case "==":
+		ok = ruleValuesEqual(actual, rule.values[0])
+	case "!=":
+		ok = !ruleValuesEqual(actual, rule.values[0])
+	case "in", "not in":
+		for _, value := range rule.values {
+			if ruleValuesEqual(actual, value) {
+				ok = true
+				break
+			}
+		}
+		ok = ok == (rule.op == "in")
+	default:
+		number := parseRuleNumber(actual)
+		if number == nil {
+			return fmt.Errorf("%w: calldata rule %q: %s is not a number", ErrPolicyViolation, rule.text, actual)
+		}
+		cmp := number.Cmp(parseRuleNumber(rule.values[0]))
+		switch rule.op {
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		}
+	}
+	if !ok {
+		return fmt.Errorf("%w: calldata breaks the rule %q", ErrPolicyViolation, rule.text)
+	}
+	return nil
+}
+
+// ruleValuesEqual compares numbers by value and anything else, such as
+// addresses and hex, without regard to case or a 0x prefix
+func ruleValuesEqual(actual, expected string) bool {
+	if a, e := parseRuleNumber(actual), parseRuleNumber(expected); a != nil && e != nil {
+		return a.Cmp(e) == 0
+	}
+	trim := func(value string) string {
+		return strings.TrimPrefix(strings.ToLower(value), "0x")
+	}
+	return trim(actual) == trim(expected)
+}
+
+type signingScopeKey struct{}
+
+// signingScope is a signing request and the account it signs for, with the
+// authorization it holds until it has signed
+type signingScope struct {
+	req           *logical.Request
+	account       string
+	authorization string
+}
+
+func withSigningScope(ctx context.Context, req *logical.Request, account string) context.Context {
+	return context.WithValue(ctx, signingScopeKey{}, &signingScope{req: req, account: account})
+}
+
+// checkCalldata decodes the calldata a request signs, notes it for the
+// decision log and enforces the calldata rules of the mount, of the account
+// and of its groups. Contract creations and transactions without data have no
+// calldata to check.
+func (b *PluginBackend) checkCalldata(ctx context.Context, scope *signingScope, config *ConfigJSON, accountJSON *AccountJSON, to *common.Address, data []byte) (*DecodedCall, error) {
+	if to == nil || len(data) == 0 {
+		return nil, nil
+	}
+	call := b.noteCall(ctx, scope.req.Storage, to, data)
+	if call == nil {
+		call = &DecodedCall{}
+	}
+	rules := append(append([]string{}, config.CalldataRules...), accountJSON.CalldataRules...)
+	groups, err := accountGroups(ctx, scope.req.Storage, scope.account)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		rules = append(rules, group.CalldataRules...)
+	}
+	if len(rules) == 0 {
+		return call, nil
+	}
+	for _, text := range rules {
+		rule, err := parseCalldataRule(text)
+		if err == nil {
+			err = rule.check(call)
+		}
+		if err != nil {
+			recordRule(ctx, "calldata", err)
+			return nil, err
+		}
+	}
+	recordRule(ctx, "calldata", nil)
+	return call, nil
+}
@@ -0,0 +1,121 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chains defines the adapters that sign the transactions of a chain.
+// An adapter knows how its chain serializes a transaction for signing, which
+// digest of that preimage the key signs, and how the signature is encoded
+// into the transaction that is broadcast; it never sees the key, which stays
+// behind a Signer. A chain is added as a package of its own that registers
+// its adapter from init, so that account management does not change.
+package chains
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+// Transaction is an unsigned transaction in the form its adapter takes
+type Transaction interface{}
+
+// Signer signs a digest with a key that does not leave it
+type Signer interface {
+	Sign(digest []byte) ([]byte, error)
+}
+
+// SignerFunc is a function that signs a digest
+type SignerFunc func(digest []byte) ([]byte, error)
+
+// Sign calls f
+func (f SignerFunc) Sign(digest []byte) ([]byte, error) {
+	return f(digest)
+}
+
+// Signed is a signed transaction
+type Signed struct {
+	// Transaction is the signed transaction in the form of the adapter
+	Transaction Transaction
+	// Raw is the transaction as it is broadcast
+	Raw []byte
+	// Hash identifies the transaction on its chain
+	Hash []byte
+}
+
+// Adapter signs the transactions of one chain
+type Adapter interface {
+	// Chain is the name the adapter is registered under
+	Chain() string
+	// Serialize returns the preimage of a transaction: the bytes its signature commits to
+	Serialize(tx Transaction) ([]byte, error)
+	// Hash returns the digest of a preimage that the key signs
+	Hash(preimage []byte) []byte
+	// Encode returns the transaction with the signature of its digest
+	Encode(tx Transaction, signature []byte) (*Signed, error)
+}
+
+// Factory returns the adapter of a chain for the network with the chain ID given
+type Factory func(chainID *big.Int) (Adapter, error)
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string]Factory{}
+)
+
+// Register makes the adapter of a chain available by name; it panics if the
+// name is taken, as two packages that claim one chain is a build mistake
+func Register(chain string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := registry[chain]; ok {
+		panic(fmt.Sprintf("chains: adapter %s registered twice", chain))
+	}
+	registry[chain] = factory
+}
+
+// New returns the adapter of a chain for the network with the chain ID given
+func New(chain string, chainID *big.Int) (Adapter, error) {
+	registryLock.RLock()
+	factory, ok := registry[chain]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no adapter for chain %s", chain)
+	}
+	return factory(chainID)
+}
+
+// Registered returns the names of the chains that have an adapter, sorted
+func Registered() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sign serializes, hashes, signs and encodes a transaction with an adapter
+func Sign(adapter Adapter, signer Signer, tx Transaction) (*Signed, error) {
+	preimage, err := adapter.Serialize(tx)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(adapter.Hash(preimage))
+	if err != nil {
+		return nil, err
+	}
+	return adapter.Encode(tx, signature)
+}
@@ -0,0 +1,116 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package core is the adapter of the Core blockchain, the chain of the
+// plugin's accounts: go-core transactions signed with Ed448 for a network ID.
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/crypto"
+	"github.com/core-coin/go-core/rlp"
+
+	"github.com/cryptohub-digital/vault-core/chains"
+)
+
+// Chain is the name the adapter is registered under
+const Chain string = "core"
+
+func init() {
+	chains.Register(Chain, func(chainID *big.Int) (chains.Adapter, error) {
+		return New(chainID)
+	})
+}
+
+// Adapter signs *types.Transaction for one network
+type Adapter struct {
+	signer types.NucleusSigner
+}
+
+// New returns the adapter of the network with the ID given
+func New(networkID *big.Int) (*Adapter, error) {
+	if networkID == nil || networkID.Sign() <= 0 || !networkID.IsInt64() {
+		return nil, fmt.Errorf("invalid network ID %v", networkID)
+	}
+	return &Adapter{signer: types.NewNucleusSigner(networkID)}, nil
+}
+
+// Chain returns the name of the chain
+func (a *Adapter) Chain() string {
+	return Chain
+}
+
+// Signer returns the go-core signer of the network, to recover senders with
+func (a *Adapter) Signer() types.Signer {
+	return a.signer
+}
+
+func transaction(tx chains.Transaction) (*types.Transaction, error) {
+	transaction, ok := tx.(*types.Transaction)
+	if !ok || transaction == nil {
+		return nil, fmt.Errorf("a %s transaction is a *types.Transaction, not %T", Chain, tx)
+	}
+	return transaction, nil
+}
+
+// Serialize returns the RLP list that NucleusSigner hashes: the fields of the
+// transaction with the network ID in place of the signature
+func (a *Adapter) Serialize(tx chains.Transaction) ([]byte, error) {
+	transaction, err := transaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes([]interface{}{
+		transaction.Nonce(),
+		transaction.EnergyPrice(),
+		transaction.Energy(),
+		transaction.To(),
+		transaction.Value(),
+		transaction.Data(),
+		uint(a.signer.NetworkID()),
+	})
+}
+
+// Hash returns the SHA3-256 of the preimage
+func (a *Adapter) Hash(preimage []byte) []byte {
+	return crypto.SHA3(preimage)
+}
+
+// Encode returns the signed transaction, RLP encoded
+func (a *Adapter) Encode(tx chains.Transaction, signature []byte) (*chains.Signed, error) {
+	transaction, err := transaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) != crypto.ExtendedSignatureLength {
+		return nil, fmt.Errorf("an Ed448 signature is %d bytes, not %d", crypto.ExtendedSignatureLength, len(signature))
+	}
+	signed, err := transaction.WithSignature(a.signer, signature)
+	if err != nil {
+		return nil, err
+	}
+	var raw bytes.Buffer
+	if err := signed.EncodeRLP(&raw); err != nil {
+		return nil, err
+	}
+	return &chains.Signed{
+		Transaction: signed,
+		Raw:         raw.Bytes(),
+		Hash:        signed.Hash().Bytes(),
+	}, nil
+}
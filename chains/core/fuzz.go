@@ -0,0 +1,56 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package core
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/rlp"
+)
+
+// FuzzTransaction decodes a signed transaction as decode, bundles and
+// broadcasts take it from callers, recovers its sender and serializes it
+// for signing. A transaction that decodes must encode back to the same
+// bytes. Run it with go-fuzz from this directory:
+//
+//	go-fuzz-build -func FuzzTransaction
+//	go-fuzz -func FuzzTransaction -workdir testdata/fuzz/FuzzTransaction
+func FuzzTransaction(data []byte) int {
+	var tx types.Transaction
+	if err := rlp.DecodeBytes(data, &tx); err != nil {
+		return 0
+	}
+	encoded, err := rlp.EncodeToBytes(&tx)
+	if err != nil {
+		panic(err)
+	}
+	if !bytes.Equal(encoded, data) {
+		panic("the transaction does not encode back to its bytes")
+	}
+	adapter, err := New(big.NewInt(1))
+	if err != nil {
+		panic(err)
+	}
+	if _, err := adapter.Serialize(&tx); err != nil {
+		panic(err)
+	}
+	types.Sender(adapter.Signer(), &tx)
+	return 1
+}
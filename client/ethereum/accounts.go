@@ -0,0 +1,392 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethereum
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Account is an account as the plugin returns it; its key never leaves Vault
+type Account struct {
+	Address            string   `json:"address"`
+	Index              int      `json:"index"`
+	Inclusions         []string `json:"inclusions"`
+	Exclusions         []string `json:"exclusions"`
+	AllowDigestSigning bool     `json:"allow_digest_signing"`
+	ChainIDs           []string `json:"chain_ids"`
+	SourceCIDRs        []string `json:"source_cidrs"`
+	SigningWindows     []string `json:"signing_windows"`
+	Tier               string   `json:"tier"`
+	ApproverGroups     []string `json:"approver_groups"`
+	Broadcast          string   `json:"broadcast"`
+	Sealed             bool     `json:"sealed"`
+	ShareThreshold     int      `json:"share_threshold"`
+	Destroyed          bool     `json:"destroyed"`
+	// PassphraseShares are returned once, when an account is sealed
+	PassphraseShares []string `json:"passphrase_shares,omitempty"`
+}
+
+// AccountRequest creates an account or updates its settings
+type AccountRequest struct {
+	// Mnemonic imports an account; one is generated when empty
+	Mnemonic           string   `json:"mnemonic,omitempty"`
+	Index              int      `json:"index,omitempty"`
+	Inclusions         []string `json:"inclusions,omitempty"`
+	Exclusions         []string `json:"exclusions,omitempty"`
+	AllowDigestSigning bool     `json:"allow_digest_signing,omitempty"`
+	ChainIDs           []string `json:"chain_ids,omitempty"`
+	// SourceCIDRs and SigningWindows, such as "mon-fri 09:00-17:00" in UTC, restrict signing
+	SourceCIDRs    []string `json:"source_cidrs,omitempty"`
+	SigningWindows []string `json:"signing_windows,omitempty"`
+	Tier           string   `json:"tier,omitempty"`
+	ApproverGroups []string `json:"approver_groups,omitempty"`
+	// Broadcast is public or private; the mount's broadcast_mode if empty
+	Broadcast     string `json:"broadcast,omitempty"`
+	SealShares    int    `json:"seal_shares,omitempty"`
+	SealThreshold int    `json:"seal_threshold,omitempty"`
+	// Force replaces the key of an existing account
+	Force bool `json:"force,omitempty"`
+	// AuthorizationID is the approved authorization a tier change uses
+	AuthorizationID string `json:"authorization_id,omitempty"`
+}
+
+// TransferRequest sends an amount to an address
+type TransferRequest struct {
+	To string `json:"to,omitempty"`
+	// ToLabel is an address book label, used instead of To
+	ToLabel  string `json:"to_label,omitempty"`
+	Amount   string `json:"amount"`
+	GasLimit string `json:"gas_limit,omitempty"`
+	GasPrice string `json:"gas_price,omitempty"`
+	// PassphraseShares unseal a sealed account for this request
+	PassphraseShares []string `json:"passphrase_shares,omitempty"`
+	// Memo is logged with the request for reconciliation; it is not signed
+	Memo string `json:"memo,omitempty"`
+	// AuthorizationID is the approved authorization a warm account's request uses
+	AuthorizationID string `json:"authorization_id,omitempty"`
+	// MFACode is the step-up code of a transaction at or above the MFA minimums
+	MFACode string `json:"mfa_code,omitempty"`
+	// TravelRule is the IVMS101 originator and beneficiary of the transfer
+	TravelRule map[string]interface{} `json:"travel_rule,omitempty"`
+}
+
+// SignTxRequest signs a transaction without sending it
+type SignTxRequest struct {
+	To       string `json:"to,omitempty"`
+	ToLabel  string `json:"to_label,omitempty"`
+	Amount   string `json:"amount,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+	GasLimit string `json:"gas_limit,omitempty"`
+	GasPrice string `json:"gas_price,omitempty"`
+
+	PassphraseShares []string `json:"passphrase_shares,omitempty"`
+	Memo             string   `json:"memo,omitempty"`
+	AuthorizationID  string   `json:"authorization_id,omitempty"`
+	MFACode          string   `json:"mfa_code,omitempty"`
+
+	TravelRule map[string]interface{} `json:"travel_rule,omitempty"`
+}
+
+// DeployRequest deploys a contract
+type DeployRequest struct {
+	Version  string `json:"version,omitempty"`
+	ABI      string `json:"abi"`
+	Bin      string `json:"bin"`
+	GasLimit string `json:"gas_limit,omitempty"`
+
+	PassphraseShares []string `json:"passphrase_shares,omitempty"`
+	Memo             string   `json:"memo,omitempty"`
+	AuthorizationID  string   `json:"authorization_id,omitempty"`
+	MFACode          string   `json:"mfa_code,omitempty"`
+}
+
+// SignRequest signs a message, prefixed as Core clients expect
+type SignRequest struct {
+	Message string `json:"message"`
+
+	PassphraseShares []string `json:"passphrase_shares,omitempty"`
+	Memo             string   `json:"memo,omitempty"`
+	AuthorizationID  string   `json:"authorization_id,omitempty"`
+}
+
+// SignDigestRequest signs a raw 32 byte digest, which the mount and the account must allow
+type SignDigestRequest struct {
+	Digest string `json:"digest"`
+
+	PassphraseShares []string `json:"passphrase_shares,omitempty"`
+	Memo             string   `json:"memo,omitempty"`
+	AuthorizationID  string   `json:"authorization_id,omitempty"`
+}
+
+// SignedTransaction is a transaction the plugin signed, and sent unless it came from SignTx
+type SignedTransaction struct {
+	TransactionHash   string `json:"transaction_hash"`
+	SignedTransaction string `json:"signed_transaction"`
+	From              string `json:"from"`
+	To                string `json:"to,omitempty"`
+	Contract          string `json:"contract,omitempty"`
+	Amount            string `json:"amount,omitempty"`
+	Nonce             string `json:"nonce"`
+	GasPrice          string `json:"gas_price"`
+	GasLimit          string `json:"gas_limit"`
+}
+
+// Signature is a signed message
+type Signature struct {
+	Signature     string `json:"signature"`
+	Address       string `json:"address"`
+	HashedMessage string `json:"hashedMessage"`
+}
+
+// DigestSignature is a signed digest
+type DigestSignature struct {
+	Signature string `json:"signature"`
+	Address   string `json:"address"`
+	Digest    string `json:"digest"`
+}
+
+// BundleTransaction is a transaction of a bundle: the fields of SignTx for
+// the account that signs it, or a SignedTransaction signed elsewhere
+type BundleTransaction struct {
+	Account           string `json:"account,omitempty"`
+	SignedTransaction string `json:"signed_transaction,omitempty"`
+	SignTxRequest
+}
+
+// BundleRequest signs a bundle for the private relays with an account as the searcher identity
+type BundleRequest struct {
+	Transactions               []*BundleTransaction `json:"transactions"`
+	BlockNumber                string               `json:"block_number,omitempty"`
+	MinTimestamp               int64                `json:"min_timestamp,omitempty"`
+	MaxTimestamp               int64                `json:"max_timestamp,omitempty"`
+	RevertingTransactionHashes []string             `json:"reverting_transaction_hashes,omitempty"`
+	Send                       bool                 `json:"send,omitempty"`
+
+	PassphraseShares []string `json:"passphrase_shares,omitempty"`
+	AuthorizationID  string   `json:"authorization_id,omitempty"`
+	MFACode          string   `json:"mfa_code,omitempty"`
+}
+
+// BundleRelayAnswer is what a private relay answered to a bundle
+type BundleRelayAnswer struct {
+	Relay    string      `json:"relay"`
+	Accepted bool        `json:"accepted"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// Bundle is a signed bundle: the JSON-RPC body to post to a relay with
+// Signature in the Header, and the relays' answers if it was sent
+type Bundle struct {
+	Identity     string               `json:"identity"`
+	BlockNumber  uint64               `json:"block_number"`
+	Bundle       string               `json:"bundle"`
+	Signature    string               `json:"signature"`
+	Header       string               `json:"header"`
+	Transactions []*SignedTransaction `json:"transactions"`
+	Relays       []*BundleRelayAnswer `json:"relays,omitempty"`
+	Accepted     int                  `json:"accepted,omitempty"`
+}
+
+// Activity is a page of the timeline of an account
+type Activity struct {
+	Events []ActivityEvent `json:"events"`
+	Next   string          `json:"next,omitempty"`
+}
+
+// ActivityEvent is one signing, sending, export or key event of an account
+type ActivityEvent struct {
+	ID                string `json:"id"`
+	Time              string `json:"time"`
+	Event             string `json:"event"`
+	Path              string `json:"path"`
+	EntityID          string `json:"entity_id,omitempty"`
+	Verdict           string `json:"verdict"`
+	ErrorCode         string `json:"error_code,omitempty"`
+	Reason            string `json:"reason,omitempty"`
+	TransactionHash   string `json:"transaction_hash,omitempty"`
+	TransactionStatus string `json:"transaction_status,omitempty"`
+	Confirmations     uint64 `json:"confirmations,omitempty"`
+	BlockNumber       uint64 `json:"block_number,omitempty"`
+	Chain             string `json:"chain,omitempty"`
+	ExportID          string `json:"export_id,omitempty"`
+	Memo              string `json:"memo,omitempty"`
+}
+
+// Balance is the balance of an account, in ore
+type Balance struct {
+	Address string `json:"address"`
+	Balance string `json:"balance"`
+}
+
+func accountPath(name string, operation ...string) string {
+	path := "accounts/" + url.PathEscape(name)
+	for _, part := range operation {
+		path += "/" + part
+	}
+	return path
+}
+
+// ListAccounts returns the names of the accounts
+func (c *Client) ListAccounts(ctx context.Context, page *Page) ([]string, error) {
+	return c.list(ctx, "accounts", page)
+}
+
+// ReadAccount returns an account
+func (c *Client) ReadAccount(ctx context.Context, name string) (*Account, error) {
+	var account Account
+	if err := c.read(ctx, accountPath(name), &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreateAccount creates an account, or updates the settings of an existing one
+func (c *Client) CreateAccount(ctx context.Context, name string, request *AccountRequest) (*Account, error) {
+	var account Account
+	if err := c.write(ctx, accountPath(name), request, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// DeleteAccount deletes an account
+func (c *Client) DeleteAccount(ctx context.Context, name string) error {
+	return c.delete(ctx, accountPath(name))
+}
+
+// DestroyAccount destroys the key of an account and keeps its record
+func (c *Client) DestroyAccount(ctx context.Context, name string) error {
+	return c.write(ctx, accountPath(name, "destroy"), nil, nil)
+}
+
+// Send signs a transfer from an account and sends it
+func (c *Client) Send(ctx context.Context, name string, request *TransferRequest) (*SignedTransaction, error) {
+	var tx SignedTransaction
+	if err := c.write(ctx, accountPath(name, "transfer"), request, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// SignTx signs a transaction from an account without sending it
+func (c *Client) SignTx(ctx context.Context, name string, request *SignTxRequest) (*SignedTransaction, error) {
+	var tx SignedTransaction
+	if err := c.write(ctx, accountPath(name, "sign-tx"), request, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Deploy deploys a contract from an account
+func (c *Client) Deploy(ctx context.Context, name string, request *DeployRequest) (*SignedTransaction, error) {
+	var tx SignedTransaction
+	if err := c.write(ctx, accountPath(name, "deploy"), request, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Sign signs a message with an account
+func (c *Client) Sign(ctx context.Context, name string, request *SignRequest) (*Signature, error) {
+	var signature Signature
+	if err := c.write(ctx, accountPath(name, "sign"), request, &signature); err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// SignDigest signs a raw digest with an account
+func (c *Client) SignDigest(ctx context.Context, name string, request *SignDigestRequest) (*DigestSignature, error) {
+	var signature DigestSignature
+	if err := c.write(ctx, accountPath(name, "sign-digest"), request, &signature); err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// SignBundle signs a bundle of transactions with an account as the searcher
+// identity, and posts it to the private relays if request.Send is set
+func (c *Client) SignBundle(ctx context.Context, identity string, request *BundleRequest) (*Bundle, error) {
+	var bundle Bundle
+	if err := c.write(ctx, accountPath(identity, "sign-bundle"), request, &bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// Activity returns a page of the timeline of an account, newest first. Pass
+// the Next of a page as the After of the following one.
+func (c *Client) Activity(ctx context.Context, name string, page *Page) (*Activity, error) {
+	r := c.request(http.MethodGet, accountPath(name, "activity"))
+	if page != nil && page.After != "" {
+		r.Params.Set("after", page.After)
+	}
+	if page != nil && page.Limit > 0 {
+		r.Params.Set("limit", strconv.Itoa(page.Limit))
+	}
+	var activity Activity
+	if err := c.do(ctx, r, &activity); err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+// AnomalyProfile is what an account usually does and whether an anomaly froze it
+type AnomalyProfile struct {
+	Transactions int    `json:"transactions"`
+	Hours        []int  `json:"hours"`
+	Destinations int    `json:"destinations"`
+	Frozen       bool   `json:"frozen"`
+	Reason       string `json:"reason,omitempty"`
+	FrozenAt     string `json:"frozen_at,omitempty"`
+	Days         map[string]struct {
+		Transactions int    `json:"transactions"`
+		Value        string `json:"value"`
+	} `json:"days"`
+}
+
+// Anomalies returns the profile the anomaly rules compare an account's transactions with
+func (c *Client) Anomalies(ctx context.Context, name string) (*AnomalyProfile, error) {
+	var profile AnomalyProfile
+	if err := c.read(ctx, accountPath(name, "anomalies"), &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// ResetAnomalies forgets what an account usually does; it does not unfreeze it
+func (c *Client) ResetAnomalies(ctx context.Context, name string) error {
+	return c.delete(ctx, accountPath(name, "anomalies"))
+}
+
+// UnfreezeAccount lets an account an anomaly froze sign again
+func (c *Client) UnfreezeAccount(ctx context.Context, name string) error {
+	return c.write(ctx, accountPath(name, "anomalies/unfreeze"), nil, nil)
+}
+
+// Balance returns the balance of an account
+func (c *Client) Balance(ctx context.Context, name string) (*Balance, error) {
+	var balance Balance
+	if err := c.read(ctx, accountPath(name, "balance"), &balance); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
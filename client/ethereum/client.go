@@ -0,0 +1,219 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ethereum is a typed client for a mount of the plugin. It wraps the
+// Vault API client so callers work with structs instead of request maps and
+// secrets, and with errors that carry the plugin's error codes.
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Error codes the plugin reports for refused requests
+const (
+	CodeNotConfigured        = "not_configured"
+	CodeAccountNotFound      = "account_not_found"
+	CodeAccountExists        = "account_exists"
+	CodeInvalidInput         = "invalid_input"
+	CodeInvalidAddress       = "invalid_address"
+	CodeInvalidChainID       = "invalid_chain_id"
+	CodePolicyViolation      = "policy_violation"
+	CodeSourceUnauthorized   = "source_unauthorized"
+	CodeRPCUnavailable       = "rpc_unavailable"
+	CodeNonceConflict        = "nonce_conflict"
+	CodeKeystoreDecrypt      = "keystore_decrypt"
+	CodeApprovalRequired     = "approval_required"
+	CodeMFARequired          = "mfa_required"
+	CodePolicyUnavailable    = "policy_unavailable"
+	CodeScreeningUnavailable = "screening_unavailable"
+	CodePriceUnavailable     = "price_unavailable"
+	CodeFrozen               = "frozen"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal"
+)
+
+// Error is a request the plugin or Vault refused
+type Error struct {
+	StatusCode int
+	// Code is one of the Code constants; internal for errors outside the plugin's taxonomy
+	Code    string
+	Message string
+	body    []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%s, status %d)", e.Message, e.Code, e.StatusCode)
+}
+
+// HasCode reports whether err is an Error with the given code
+func HasCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// Client calls one mount of the plugin
+type Client struct {
+	vault *api.Client
+	mount string
+}
+
+// New returns a client for the plugin mounted at mount
+func New(vault *api.Client, mount string) *Client {
+	return &Client{vault: vault, mount: strings.Trim(mount, "/")}
+}
+
+func (c *Client) request(method, path string) *api.Request {
+	return c.vault.NewRequest(method, "/v1/"+c.mount+"/"+path)
+}
+
+// do sends a request to the mount and decodes the data of the response into out
+func (c *Client) do(ctx context.Context, r *api.Request, out interface{}) error {
+	resp, err := c.vault.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		if resp == nil {
+			return err
+		}
+		return responseError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	secret, err := api.ParseSecret(resp.Body)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return nil
+	}
+	data, err := json.Marshal(secret.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// responseError turns an error response into an Error. The plugin answers
+// refusals with the error and its code in the data of the response; other
+// errors come from Vault as a list.
+func responseError(resp *api.Response) error {
+	e := &Error{StatusCode: resp.StatusCode, Code: CodeInternal}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		e.Message = err.Error()
+		return e
+	}
+	e.body = body
+	var decoded struct {
+		Errors []string `json:"errors"`
+		Data   struct {
+			Error     string `json:"error"`
+			ErrorCode string `json:"error_code"`
+		} `json:"data"`
+	}
+	switch {
+	case json.Unmarshal(body, &decoded) != nil:
+		e.Message = strings.TrimSpace(string(body))
+	case decoded.Data.ErrorCode != "":
+		e.Code = decoded.Data.ErrorCode
+		e.Message = decoded.Data.Error
+	case decoded.Data.Error != "":
+		e.Message = decoded.Data.Error
+	default:
+		e.Message = strings.Join(decoded.Errors, "; ")
+	}
+	return e
+}
+
+func (c *Client) read(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, c.request(http.MethodGet, path), out)
+}
+
+func (c *Client) write(ctx context.Context, path string, body interface{}, out interface{}) error {
+	r := c.request(http.MethodPut, path)
+	if body != nil {
+		if err := r.SetJSONBody(body); err != nil {
+			return err
+		}
+	}
+	return c.do(ctx, r, out)
+}
+
+// writeWrapped writes to a path whose response the plugin wraps and returns the wrapping token
+func (c *Client) writeWrapped(ctx context.Context, path string, body interface{}) (*api.SecretWrapInfo, error) {
+	r := c.request(http.MethodPut, path)
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+	resp, err := c.vault.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		if resp == nil {
+			return nil, err
+		}
+		return nil, responseError(resp)
+	}
+	secret, err := api.ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.WrapInfo == nil {
+		return nil, errors.New("the response was not wrapped")
+	}
+	return secret.WrapInfo, nil
+}
+
+func (c *Client) delete(ctx context.Context, path string) error {
+	return c.do(ctx, c.request(http.MethodDelete, path), nil)
+}
+
+// list returns the keys under a path; none when the path has no keys
+func (c *Client) list(ctx context.Context, path string, page *Page) ([]string, error) {
+	r := c.request(http.MethodGet, path)
+	r.Params.Set("list", "true")
+	if page != nil && page.After != "" {
+		r.Params.Set("after", page.After)
+	}
+	if page != nil && page.Limit > 0 {
+		r.Params.Set("limit", strconv.Itoa(page.Limit))
+	}
+	var keys struct {
+		Keys []string `json:"keys"`
+	}
+	err := c.do(ctx, r, &keys)
+	if HasCode(err, CodeInternal) && err.(*Error).StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	}
+	return keys.Keys, err
+}
+
+// Page selects part of a list: the keys after After, at most Limit of them
+type Page struct {
+	After string
+	Limit int
+}
@@ -0,0 +1,940 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethereum
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Config is the configuration of the mount. Write sends every field, so
+// read the config, change it and write it back to keep the other settings.
+type Config struct {
+	RPCURL               string   `json:"rpc_url"`
+	RPCURLs              []string `json:"rpc_urls"`
+	RPCStrategy          string   `json:"rpc_strategy"`
+	ChainID              string   `json:"chain_id"`
+	RPCTimeout           int      `json:"rpc_timeout"`
+	RPCRetries           int      `json:"rpc_retries"`
+	RPCBackoff           int      `json:"rpc_backoff"`
+	RPCCircuitThreshold  int      `json:"rpc_circuit_threshold"`
+	RPCCircuitCooldown   int      `json:"rpc_circuit_cooldown"`
+	BoundCIDRList        []string `json:"bound_cidr_list"`
+	Inclusions           []string `json:"inclusions"`
+	Exclusions           []string `json:"exclusions"`
+	AllowDigestSigning   bool     `json:"allow_digest_signing"`
+	ExportApproverGroups []string `json:"export_approver_groups"`
+	ExportApprovalTTL    int      `json:"export_approval_ttl"`
+	AuthorizerGroups     []string `json:"authorizer_groups"`
+	AuthorizationTTL     int      `json:"authorization_ttl"`
+	// ControlGroupOperations are export and rotate; the minimums are in wei and USD
+	ControlGroupOperations []string `json:"control_group_operations"`
+	ControlGroupMinAmount  string   `json:"control_group_min_amount"`
+	ControlGroupMinUSD     string   `json:"control_group_min_usd"`
+	// MFAMethod is totp or webhook; the minimums are in wei and USD
+	MFAMethod         string `json:"mfa_method"`
+	MFAWebhookURL     string `json:"mfa_webhook_url"`
+	MFAWebhookTimeout int    `json:"mfa_webhook_timeout"`
+	MFAMinAmount      string `json:"mfa_min_amount"`
+	MFAMinUSD         string `json:"mfa_min_usd"`
+	// AnomalyRules are volume_spike, new_destination and unusual_hours; AnomalyAction is approval or freeze
+	AnomalyRules                []string `json:"anomaly_rules,omitempty"`
+	AnomalyAction               string   `json:"anomaly_action,omitempty"`
+	AnomalySensitivity          string   `json:"anomaly_sensitivity,omitempty"`
+	AnomalyLearningTransactions int      `json:"anomaly_learning_transactions,omitempty"`
+	// ScreeningURL is the AML screening API; risks are low, medium, high or severe
+	ScreeningURL          string `json:"screening_url"`
+	ScreeningAPIKey       string `json:"screening_api_key,omitempty"`
+	ScreeningTimeout      int    `json:"screening_timeout"`
+	ScreeningCacheTTL     int    `json:"screening_cache_ttl"`
+	ScreeningApprovalRisk string `json:"screening_approval_risk"`
+	ScreeningBlockRisk    string `json:"screening_block_risk"`
+	// SanctionsListURL is fetched into the local sanctions list
+	SanctionsListURL         string `json:"sanctions_list_url"`
+	SanctionsRefreshInterval int    `json:"sanctions_refresh_interval"`
+	// ShadowURL is a mount every signing is repeated on and compared with
+	ShadowURL     string `json:"shadow_url"`
+	ShadowToken   string `json:"shadow_token,omitempty"`
+	ShadowTimeout int    `json:"shadow_timeout"`
+	// BroadcastMode private sends transactions to PrivateRelayURLs instead of the public mempool
+	BroadcastMode    string   `json:"broadcast_mode,omitempty"`
+	PrivateRelayURLs []string `json:"private_relay_urls,omitempty"`
+
+	LowercaseAddressesOnly bool   `json:"lowercase_addresses_only"`
+	ConfirmationDepth      int    `json:"confirmation_depth"`
+	RebroadcastReorged     bool   `json:"rebroadcast_reorged"`
+	NotificationWebhookURL string `json:"notification_webhook_url"`
+
+	ClefAccounts      []string `json:"clef_accounts"`
+	LogLevel          string   `json:"log_level"`
+	LogRedactPatterns []string `json:"log_redact_patterns"`
+
+	DecisionLogFile          string `json:"decision_log_file"`
+	DecisionLogHMAC          bool   `json:"decision_log_hmac"`
+	DecisionLogBuffer        int    `json:"decision_log_buffer"`
+	DecisionLogOverflow      string `json:"decision_log_overflow,omitempty"`
+	DecisionLogFsync         string `json:"decision_log_fsync,omitempty"`
+	DecisionLogFsyncBytes    int    `json:"decision_log_fsync_bytes,omitempty"`
+	DecisionLogFsyncInterval int    `json:"decision_log_fsync_interval,omitempty"`
+	SlowRequestThreshold     int    `json:"slow_request_threshold"`
+}
+
+// Transaction is a transaction the mount has sent and tracks
+type Transaction struct {
+	Hash          string `json:"hash"`
+	Account       string `json:"account"`
+	Chain         string `json:"chain,omitempty"`
+	Status        string `json:"status"`
+	BlockNumber   uint64 `json:"block_number,omitempty"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	Confirmations uint64 `json:"confirmations"`
+	Reorgs        int    `json:"reorgs"`
+	Rebroadcasts  int    `json:"rebroadcasts"`
+	LastError     string `json:"last_error,omitempty"`
+	Memo          string `json:"memo,omitempty"`
+	Private       bool   `json:"private,omitempty"`
+	SubmittedAt   string `json:"submitted_at"`
+	CheckedAt     string `json:"checked_at,omitempty"`
+}
+
+// Export is a request to export the key of an account or a BLS key
+type Export struct {
+	ID                string `json:"id"`
+	Account           string `json:"account,omitempty"`
+	BLSKey            string `json:"bls_key,omitempty"`
+	Status            string `json:"status"`
+	RequesterEntityID string `json:"requester_entity_id"`
+	ApproverEntityID  string `json:"approver_entity_id,omitempty"`
+	ApproverGroup     string `json:"approver_group,omitempty"`
+	CreatedAt         string `json:"created_at"`
+	ExpiresAt         string `json:"expires_at"`
+	ApprovedAt        string `json:"approved_at,omitempty"`
+	ReleasedAt        string `json:"released_at,omitempty"`
+	RejecterEntityID  string `json:"rejecter_entity_id,omitempty"`
+	RejectedAt        string `json:"rejected_at,omitempty"`
+	// Keystore is only returned by ReleaseExport
+	Keystore string `json:"keystore,omitempty"`
+}
+
+// Key is a secp256r1, secp256k1 or ed25519 key; only its public key leaves Vault
+type Key struct {
+	Name         string `json:"name"`
+	Curve        string `json:"curve"`
+	PublicKey    string `json:"public_key"`
+	PublicKeyPEM string `json:"public_key_pem"`
+	CreatedAt    string `json:"created_at"`
+	// StellarAccount is set for ed25519 keys, XRPLAddress for secp256k1 and ed25519 keys
+	StellarAccount string `json:"stellar_account,omitempty"`
+	XRPLAddress    string `json:"xrpl_address,omitempty"`
+	// EVMAddress and TronAddress are set for secp256k1 keys
+	EVMAddress  string `json:"evm_address,omitempty"`
+	TronAddress string `json:"tron_address,omitempty"`
+}
+
+// StellarSignature is a Stellar transaction signed with a key
+type StellarSignature struct {
+	TransactionHash string `json:"transaction_hash"`
+	Signature       string `json:"signature"`
+	Hint            string `json:"hint"`
+	SignedEnvelope  string `json:"signed_envelope"`
+	Signer          string `json:"signer"`
+	SourceAccount   string `json:"source_account"`
+}
+
+// XRPLSignature is an XRP Ledger transaction signed with a key
+type XRPLSignature struct {
+	TransactionHash  string `json:"transaction_hash"`
+	TxBlob           string `json:"tx_blob"`
+	SigningPublicKey string `json:"signing_public_key"`
+	Address          string `json:"address"`
+}
+
+// EVMTxRequest is a transaction for the EVM chain of a chain profile. Set
+// GasPrice on legacy chains such as bsc, the EIP-1559 fees on the others.
+type EVMTxRequest struct {
+	Profile              string `json:"profile"`
+	ChainID              string `json:"chain_id,omitempty"`
+	Nonce                string `json:"nonce,omitempty"`
+	To                   string `json:"to,omitempty"`
+	Value                string `json:"value,omitempty"`
+	Data                 string `json:"data,omitempty"`
+	GasLimit             string `json:"gas_limit"`
+	GasPrice             string `json:"gas_price,omitempty"`
+	MaxFeePerGas         string `json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas,omitempty"`
+}
+
+// EVMSignature is an EVM transaction signed with a key
+type EVMSignature struct {
+	TransactionHash   string `json:"transaction_hash"`
+	SignedTransaction string `json:"signed_transaction"`
+	From              string `json:"from"`
+	ChainID           string `json:"chain_id"`
+	GasModel          string `json:"gas_model"`
+}
+
+// TronSignature is the signature of a TRON transaction
+type TronSignature struct {
+	TransactionID string `json:"transaction_id"`
+	Signature     string `json:"signature"`
+	OwnerAddress  string `json:"owner_address"`
+}
+
+// SignTicketRequest describes the one signing request a sign ticket makes
+type SignTicketRequest struct {
+	// Operation is transfer, sign-tx, deploy, sign or sign-digest
+	Operation  string                 `json:"operation"`
+	Parameters map[string]interface{} `json:"parameters"`
+	TTL        int                    `json:"ttl,omitempty"`
+	// RedeemerEntityID is the only entity that can redeem the ticket
+	RedeemerEntityID string `json:"redeemer_entity_id,omitempty"`
+}
+
+// ChainProfile is how transactions for a chain other than Core are signed
+type ChainProfile struct {
+	Name          string `json:"name"`
+	Family        string `json:"family"`
+	ChainID       string `json:"chain_id,omitempty"`
+	GasModel      string `json:"gas_model"`
+	AddressFormat string `json:"address_format"`
+}
+
+// KeySignature is data signed with a key
+type KeySignature struct {
+	Signature string `json:"signature"`
+	PublicKey string `json:"public_key"`
+	Curve     string `json:"curve"`
+}
+
+// Authorization is an authorizer's approval of one request of an account
+type Authorization struct {
+	ID                string                 `json:"id"`
+	Account           string                 `json:"account"`
+	Path              string                 `json:"path"`
+	Parameters        map[string]interface{} `json:"parameters"`
+	Status            string                 `json:"status"`
+	RequesterEntityID string                 `json:"requester_entity_id"`
+	ApproverEntityID  string                 `json:"approver_entity_id,omitempty"`
+	ApproverGroup     string                 `json:"approver_group,omitempty"`
+	CreatedAt         string                 `json:"created_at"`
+	ExpiresAt         string                 `json:"expires_at"`
+	ApprovedAt        string                 `json:"approved_at,omitempty"`
+	RejecterEntityID  string                 `json:"rejecter_entity_id,omitempty"`
+	RejectedAt        string                 `json:"rejected_at,omitempty"`
+	UsedAt            string                 `json:"used_at,omitempty"`
+}
+
+// TOTPEnrollment is the TOTP key of an identity entity; Secret and URL are
+// only returned when it is enrolled
+type TOTPEnrollment struct {
+	EntityID  string `json:"entity_id"`
+	CreatedAt string `json:"created_at"`
+	Secret    string `json:"secret,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// SanctionsList describes the local list of sanctioned addresses
+type SanctionsList struct {
+	Count     int    `json:"count"`
+	SHA256    string `json:"sha256"`
+	Source    string `json:"source,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	LastFetch string `json:"last_fetch,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// TravelRuleRecord is the IVMS101 metadata a transaction was sent with
+type TravelRuleRecord struct {
+	TransactionHash string                 `json:"transaction_hash"`
+	Account         string                 `json:"account"`
+	Path            string                 `json:"path"`
+	EntityID        string                 `json:"entity_id,omitempty"`
+	Chain           string                 `json:"chain,omitempty"`
+	From            string                 `json:"from"`
+	To              string                 `json:"to"`
+	Amount          string                 `json:"amount"`
+	Contract        string                 `json:"contract,omitempty"`
+	Symbol          string                 `json:"symbol,omitempty"`
+	Memo            string                 `json:"memo,omitempty"`
+	CreatedAt       string                 `json:"created_at"`
+	IVMS101         map[string]interface{} `json:"ivms101"`
+}
+
+// AddressBookEntry is a labelled address
+type AddressBookEntry struct {
+	Label   string `json:"label,omitempty"`
+	Address string `json:"address"`
+	ChainID string `json:"chain_id,omitempty"`
+}
+
+// Chain is a chain that accounts are exposed on besides the mount's own
+type Chain struct {
+	ChainID    string   `json:"chain_id"`
+	RPCURL     string   `json:"rpc_url"`
+	RPCURLs    []string `json:"rpc_urls,omitempty"`
+	Inclusions []string `json:"inclusions,omitempty"`
+	Exclusions []string `json:"exclusions,omitempty"`
+	Accounts   []string `json:"accounts,omitempty"`
+	// PrivateRelayURLs are the private relays of the chain's network
+	PrivateRelayURLs []string `json:"private_relay_urls,omitempty"`
+}
+
+// Freeze is whether signing and exports are frozen on the mount
+type Freeze struct {
+	Frozen   bool   `json:"frozen"`
+	Reason   string `json:"reason,omitempty"`
+	FrozenAt string `json:"frozen_at,omitempty"`
+	FrozenBy string `json:"frozen_by,omitempty"`
+}
+
+// Check is the outcome of one health check
+type Check struct {
+	OK          bool   `json:"ok"`
+	Duration    string `json:"duration"`
+	Error       string `json:"error,omitempty"`
+	ChainID     string `json:"chain_id,omitempty"`
+	BlockNumber uint64 `json:"block_number,omitempty"`
+}
+
+// Health is the outcome of the health checks of the mount
+type Health struct {
+	Healthy      bool             `json:"healthy"`
+	Version      string           `json:"version"`
+	Storage      Check            `json:"storage"`
+	RPC          Check            `json:"rpc"`
+	Chains       map[string]Check `json:"chains"`
+	KDFBenchmark string           `json:"kdf_benchmark"`
+	SlowRequests uint64           `json:"slow_requests"`
+}
+
+// Inventory lists the accounts of the mount without any key material
+type Inventory struct {
+	Time     string             `json:"time"`
+	Accounts []InventoryAccount `json:"accounts"`
+}
+
+// InventoryAccount is an account of the inventory with its balance on every
+// chain it is exposed on; the mount's own chain has no name
+type InventoryAccount struct {
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	Labels    []string `json:"labels"`
+	Groups    []string `json:"groups"`
+	ChainIDs  []string `json:"chain_ids"`
+	Sealed    bool     `json:"sealed"`
+	Destroyed bool     `json:"destroyed"`
+	Chains    []struct {
+		Chain   string `json:"chain"`
+		ChainID string `json:"chain_id"`
+		Balance string `json:"balance,omitempty"`
+		Error   string `json:"error,omitempty"`
+	} `json:"chains"`
+}
+
+// SignatureScheme is how the plugin signs on a curve
+type SignatureScheme struct {
+	Scheme          string `json:"scheme"`
+	NonceGeneration string `json:"nonce_generation"`
+	LowS            bool   `json:"low_s"`
+}
+
+// Info describes the plugin and what the mount supports
+type Info struct {
+	Version          string                     `json:"version"`
+	Commit           string                     `json:"commit"`
+	TransactionTypes []string                   `json:"transaction_types"`
+	SignatureScheme  string                     `json:"signature_scheme"`
+	KeyCurves        []string                   `json:"key_curves"`
+	ChainAdapters    []string                   `json:"chain_adapters"`
+	NonceGeneration  string                     `json:"nonce_generation"`
+	SignatureSchemes map[string]SignatureScheme `json:"signature_schemes"`
+	Supported        []string                   `json:"supported"`
+	Enabled          []string                   `json:"enabled"`
+}
+
+// Supports reports whether the plugin supports a feature
+func (info *Info) Supports(feature string) bool {
+	for _, supported := range info.Supported {
+		if supported == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadConfig returns the configuration of the mount
+func (c *Client) ReadConfig(ctx context.Context) (*Config, error) {
+	var config Config
+	if err := c.read(ctx, "config", &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// WriteConfig replaces the configuration of the mount
+func (c *Client) WriteConfig(ctx context.Context, config *Config) (*Config, error) {
+	var written Config
+	if err := c.write(ctx, "config", config, &written); err != nil {
+		return nil, err
+	}
+	return &written, nil
+}
+
+// AccountForAddress returns the name of the account with an address
+func (c *Client) AccountForAddress(ctx context.Context, address string) (string, error) {
+	var result struct {
+		Name string `json:"name"`
+	}
+	if err := c.read(ctx, "addresses/"+url.PathEscape(address), &result); err != nil {
+		return "", err
+	}
+	return result.Name, nil
+}
+
+// ListTransactions returns the hashes of the transactions the mount tracks
+func (c *Client) ListTransactions(ctx context.Context, page *Page) ([]string, error) {
+	return c.list(ctx, "tx", page)
+}
+
+// ReadTransaction returns a transaction the mount tracks
+func (c *Client) ReadTransaction(ctx context.Context, hash string) (*Transaction, error) {
+	var tx Transaction
+	if err := c.read(ctx, "tx/"+url.PathEscape(hash), &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// RequestExport asks to export the key of an account
+func (c *Client) RequestExport(ctx context.Context, name string) (*Export, error) {
+	var export Export
+	if err := c.write(ctx, accountPath(name, "export"), nil, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// RequestAuthorizedExport requests the export of an account's key with an
+// approved authorization, for mounts that put exports under a control group
+func (c *Client) RequestAuthorizedExport(ctx context.Context, name, authorizationID string) (*Export, error) {
+	var export Export
+	body := map[string]interface{}{"authorization_id": authorizationID}
+	if err := c.write(ctx, accountPath(name, "export"), body, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// ReadExport returns an export request
+func (c *Client) ReadExport(ctx context.Context, id string) (*Export, error) {
+	var export Export
+	if err := c.read(ctx, "exports/"+url.PathEscape(id), &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// ApproveExport approves an export request made by someone else
+func (c *Client) ApproveExport(ctx context.Context, id string) (*Export, error) {
+	var export Export
+	if err := c.write(ctx, "exports/"+url.PathEscape(id)+"/approve", nil, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// RejectExport rejects an export request made by someone else
+func (c *Client) RejectExport(ctx context.Context, id string) (*Export, error) {
+	var export Export
+	if err := c.write(ctx, "exports/"+url.PathEscape(id)+"/reject", nil, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// ReleaseExport returns the key of an approved export as a keystore encrypted with passphrase
+func (c *Client) ReleaseExport(ctx context.Context, id, passphrase string) (*Export, error) {
+	var export Export
+	if err := c.write(ctx, "exports/"+url.PathEscape(id)+"/release", map[string]interface{}{"passphrase": passphrase}, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// CreateKey generates a key on the curve, or imports privateKey when it is not empty
+func (c *Client) CreateKey(ctx context.Context, name, curve, privateKey string) (*Key, error) {
+	var key Key
+	body := map[string]interface{}{"curve": curve}
+	if privateKey != "" {
+		body["private_key"] = privateKey
+	}
+	if err := c.write(ctx, "keys/"+url.PathEscape(name), body, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ReadKey returns the public key of a key
+func (c *Client) ReadKey(ctx context.Context, name string) (*Key, error) {
+	var key Key
+	if err := c.read(ctx, "keys/"+url.PathEscape(name), &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// SignWithKey signs data with a key
+func (c *Client) SignWithKey(ctx context.Context, name string, data []byte) (*KeySignature, error) {
+	var signature KeySignature
+	body := map[string]interface{}{"data": hex.EncodeToString(data), "encoding": "hex"}
+	if err := c.write(ctx, "keys/"+url.PathEscape(name)+"/sign", body, &signature); err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// SignStellarTx signs an unsigned base64 transaction envelope for the network with an ed25519 key
+func (c *Client) SignStellarTx(ctx context.Context, name, envelope, networkPassphrase string) (*StellarSignature, error) {
+	var signature StellarSignature
+	body := map[string]interface{}{"transaction_envelope": envelope, "network_passphrase": networkPassphrase}
+	if err := c.write(ctx, "keys/"+url.PathEscape(name)+"/stellar/sign-tx", body, &signature); err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// SignXRPLTx signs an unsigned hex transaction that carries the key's SigningPubKey
+func (c *Client) SignXRPLTx(ctx context.Context, name, txBlob string) (*XRPLSignature, error) {
+	var signature XRPLSignature
+	if err := c.write(ctx, "keys/"+url.PathEscape(name)+"/xrpl/sign-tx", map[string]interface{}{"tx_blob": txBlob}, &signature); err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// IssueSignTicket issues a sign ticket for a request of an account. The
+// ticket is returned wrapped; hand the wrapping token to the redeemer.
+func (c *Client) IssueSignTicket(ctx context.Context, name string, request *SignTicketRequest) (*api.SecretWrapInfo, error) {
+	return c.writeWrapped(ctx, accountPath(name, "sign-tickets"), request)
+}
+
+// RedeemSignTicket unwraps a sign ticket and makes the request it describes,
+// returning that request's response
+func (c *Client) RedeemSignTicket(ctx context.Context, wrappingToken string, passphraseShares []string) (map[string]interface{}, error) {
+	wrapped, err := c.vault.Logical().Unwrap(wrappingToken)
+	if err != nil {
+		return nil, err
+	}
+	if wrapped == nil {
+		return nil, errors.New("the wrapping token holds no ticket")
+	}
+	body := map[string]interface{}{"ticket": wrapped.Data["ticket"]}
+	if len(passphraseShares) > 0 {
+		body["passphrase_shares"] = passphraseShares
+	}
+	var result map[string]interface{}
+	if err := c.write(ctx, "sign-tickets/redeem", body, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReadChainProfile returns a built-in chain profile
+func (c *Client) ReadChainProfile(ctx context.Context, name string) (*ChainProfile, error) {
+	var profile ChainProfile
+	if err := c.read(ctx, "chain-profiles/"+url.PathEscape(name), &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// SignEVMTx signs a transaction for an EVM chain with a secp256k1 key
+func (c *Client) SignEVMTx(ctx context.Context, name string, request *EVMTxRequest) (*EVMSignature, error) {
+	var signature EVMSignature
+	if err := c.write(ctx, "keys/"+url.PathEscape(name)+"/evm/sign-tx", request, &signature); err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// SignTronTx signs the hex raw_data of a TRON transaction for a profile, tron if empty, with a secp256k1 key
+func (c *Client) SignTronTx(ctx context.Context, name, rawDataHex, profile string) (*TronSignature, error) {
+	var signature TronSignature
+	body := map[string]interface{}{"raw_data_hex": rawDataHex}
+	if profile != "" {
+		body["profile"] = profile
+	}
+	if err := c.write(ctx, "keys/"+url.PathEscape(name)+"/tron/sign-tx", body, &signature); err != nil {
+		return nil, err
+	}
+	return &signature, nil
+}
+
+// RequestAuthorization asks an authorizer to approve a request of an account:
+// path below the mount, such as accounts/<name>/sign-tx, with exactly the
+// parameters the request will carry
+func (c *Client) RequestAuthorization(ctx context.Context, name, path string, parameters map[string]interface{}) (*Authorization, error) {
+	var authorization Authorization
+	body := map[string]interface{}{"path": path, "parameters": parameters}
+	if err := c.write(ctx, accountPath(name, "authorizations"), body, &authorization); err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+// ReadAuthorization returns an authorization
+func (c *Client) ReadAuthorization(ctx context.Context, id string) (*Authorization, error) {
+	var authorization Authorization
+	if err := c.read(ctx, "authorizations/"+url.PathEscape(id), &authorization); err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+// ApproveAuthorization approves an authorization requested by someone else
+func (c *Client) ApproveAuthorization(ctx context.Context, id string) (*Authorization, error) {
+	var authorization Authorization
+	if err := c.write(ctx, "authorizations/"+url.PathEscape(id)+"/approve", nil, &authorization); err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+// RejectAuthorization rejects an authorization requested by someone else
+func (c *Client) RejectAuthorization(ctx context.Context, id string) (*Authorization, error) {
+	var authorization Authorization
+	if err := c.write(ctx, "authorizations/"+url.PathEscape(id)+"/reject", nil, &authorization); err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+// EnrollTOTP enrolls a TOTP key for the caller's entity. Load the URL into an
+// authenticator app; neither it nor the secret can be read again.
+func (c *Client) EnrollTOTP(ctx context.Context) (*TOTPEnrollment, error) {
+	var enrollment TOTPEnrollment
+	if err := c.write(ctx, "mfa/totp", nil, &enrollment); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// DeleteTOTP deletes the TOTP key of an entity, so it can enroll a new one
+func (c *Client) DeleteTOTP(ctx context.Context, entityID string) error {
+	return c.delete(ctx, "mfa/totp/"+url.PathEscape(entityID))
+}
+
+// ReadSanctionsList describes the local list of sanctioned addresses
+func (c *Client) ReadSanctionsList(ctx context.Context) (*SanctionsList, error) {
+	var list SanctionsList
+	if err := c.read(ctx, "sanctions", &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ReplaceSanctionsList replaces the local list of sanctioned addresses
+func (c *Client) ReplaceSanctionsList(ctx context.Context, addresses []string, source string) (*SanctionsList, error) {
+	var list SanctionsList
+	if err := c.write(ctx, "sanctions", map[string]interface{}{"addresses": addresses, "source": source}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Sanctioned reports whether an address is on the local list of sanctioned addresses
+func (c *Client) Sanctioned(ctx context.Context, address string) (bool, error) {
+	var check struct {
+		Sanctioned bool `json:"sanctioned"`
+	}
+	if err := c.write(ctx, "sanctions/check", map[string]interface{}{"address": address}, &check); err != nil {
+		return false, err
+	}
+	return check.Sanctioned, nil
+}
+
+// ShadowStats counts the signings compared with the shadow mount since the plugin started
+type ShadowStats struct {
+	ShadowURL    string `json:"shadow_url"`
+	Compared     uint64 `json:"compared"`
+	Matched      uint64 `json:"matched"`
+	Mismatched   uint64 `json:"mismatched"`
+	Failed       uint64 `json:"failed"`
+	LastError    string `json:"last_error,omitempty"`
+	LastMismatch *struct {
+		Time    string `json:"time"`
+		Path    string `json:"path"`
+		Field   string `json:"field"`
+		Primary string `json:"primary"`
+		Shadow  string `json:"shadow"`
+	} `json:"last_mismatch,omitempty"`
+}
+
+// ReadShadow returns how the signings repeated on the shadow mount compared
+func (c *Client) ReadShadow(ctx context.Context) (*ShadowStats, error) {
+	var stats ShadowStats
+	if err := c.read(ctx, "shadow", &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// PluginInfo is the build of the running plugin binary
+type PluginInfo struct {
+	SHA256       string   `json:"sha256"`
+	Version      string   `json:"version"`
+	Commit       string   `json:"commit"`
+	GoVersion    string   `json:"go_version"`
+	Platform     string   `json:"platform"`
+	Module       string   `json:"module"`
+	Dependencies []string `json:"dependencies"`
+	Attestation  *struct {
+		Document  string `json:"document"`
+		Signature string `json:"signature"`
+		Attestor  string `json:"attestor"`
+	} `json:"attestation,omitempty"`
+}
+
+// PluginVerification is how the running plugin binary compared with its registration
+type PluginVerification struct {
+	Verified   bool     `json:"verified"`
+	Mismatches []string `json:"mismatches"`
+	SHA256     string   `json:"sha256"`
+	Registered string   `json:"registered"`
+	Version    string   `json:"version"`
+	Commit     string   `json:"commit"`
+}
+
+// PluginInfo returns the SHA256 and the signed build attestation of the running plugin binary
+func (c *Client) PluginInfo(ctx context.Context) (*PluginInfo, error) {
+	var info PluginInfo
+	if err := c.read(ctx, "plugin-info", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// VerifyPlugin compares the running plugin binary with the SHA256 the plugin
+// catalog registered and, if not empty, a version and a commit
+func (c *Client) VerifyPlugin(ctx context.Context, sha256, version, commit string) (*PluginVerification, error) {
+	var verification PluginVerification
+	if err := c.write(ctx, "plugin-info/verify", map[string]interface{}{"sha256": sha256, "version": version, "commit": commit}, &verification); err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+// BackupVerification is the status of every account of a backup bundle
+type BackupVerification struct {
+	CreatedAt       string `json:"created_at"`
+	MountKeyID      string `json:"mount_key_id"`
+	MountKeyMatches bool   `json:"mount_key_matches"`
+	Restorable      bool   `json:"restorable"`
+	Failed          int    `json:"failed"`
+	Accounts        []struct {
+		Name    string `json:"name"`
+		Status  string `json:"status"`
+		Address string `json:"address"`
+		Sealed  bool   `json:"sealed"`
+		Error   string `json:"error,omitempty"`
+	} `json:"accounts"`
+}
+
+// BackupBundle returns the accounts of the mount, as stored, in a backup bundle
+func (c *Client) BackupBundle(ctx context.Context) (string, error) {
+	var backup struct {
+		Bundle string `json:"bundle"`
+	}
+	if err := c.read(ctx, "backup/bundle", &backup); err != nil {
+		return "", err
+	}
+	return backup.Bundle, nil
+}
+
+// VerifyBackup checks that a backup bundle restores every account it holds, without importing it
+func (c *Client) VerifyBackup(ctx context.Context, bundle string) (*BackupVerification, error) {
+	var verification BackupVerification
+	if err := c.write(ctx, "backup/verify", map[string]interface{}{"bundle": bundle}, &verification); err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+// ListTravelRule returns the hashes of the transactions sent with travel-rule metadata
+func (c *Client) ListTravelRule(ctx context.Context, page *Page) ([]string, error) {
+	return c.list(ctx, "travel-rule", page)
+}
+
+// ReadTravelRule returns the travel-rule metadata of a transaction
+func (c *Client) ReadTravelRule(ctx context.Context, hash string) (*TravelRuleRecord, error) {
+	var record TravelRuleRecord
+	if err := c.read(ctx, "travel-rule/"+hash, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ExportTravelRule returns the travel-rule records created from since until
+// until, oldest first; a zero time leaves that end open
+func (c *Client) ExportTravelRule(ctx context.Context, since, until time.Time) ([]TravelRuleRecord, error) {
+	r := c.request(http.MethodGet, "travel-rule/export")
+	if !since.IsZero() {
+		r.Params.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		r.Params.Set("until", until.UTC().Format(time.RFC3339))
+	}
+	var export struct {
+		Records []TravelRuleRecord `json:"records"`
+	}
+	if err := c.do(ctx, r, &export); err != nil {
+		return nil, err
+	}
+	return export.Records, nil
+}
+
+// ListAddressBook returns the labels of the address book
+func (c *Client) ListAddressBook(ctx context.Context, page *Page) ([]string, error) {
+	return c.list(ctx, "addressbook", page)
+}
+
+// ReadAddressBookEntry returns a labelled address
+func (c *Client) ReadAddressBookEntry(ctx context.Context, label string) (*AddressBookEntry, error) {
+	var entry AddressBookEntry
+	if err := c.read(ctx, "addressbook/"+url.PathEscape(label), &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// WriteAddressBookEntry labels an address
+func (c *Client) WriteAddressBookEntry(ctx context.Context, label string, entry *AddressBookEntry) (*AddressBookEntry, error) {
+	var written AddressBookEntry
+	if err := c.write(ctx, "addressbook/"+url.PathEscape(label), entry, &written); err != nil {
+		return nil, err
+	}
+	return &written, nil
+}
+
+// DeleteAddressBookEntry removes a label
+func (c *Client) DeleteAddressBookEntry(ctx context.Context, label string) error {
+	return c.delete(ctx, "addressbook/"+url.PathEscape(label))
+}
+
+// ListChains returns the names of the chains
+func (c *Client) ListChains(ctx context.Context) ([]string, error) {
+	return c.list(ctx, "chains", nil)
+}
+
+// ReadChain returns a chain
+func (c *Client) ReadChain(ctx context.Context, name string) (*Chain, error) {
+	var chain Chain
+	if err := c.read(ctx, "chains/"+url.PathEscape(name), &chain); err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// WriteChain creates or replaces a chain
+func (c *Client) WriteChain(ctx context.Context, name string, chain *Chain) (*Chain, error) {
+	var written Chain
+	if err := c.write(ctx, "chains/"+url.PathEscape(name), chain, &written); err != nil {
+		return nil, err
+	}
+	return &written, nil
+}
+
+// DeleteChain deletes a chain
+func (c *Client) DeleteChain(ctx context.Context, name string) error {
+	return c.delete(ctx, "chains/"+url.PathEscape(name))
+}
+
+// OnChain returns a client for the accounts of the mount exposed on a chain:
+// its account calls are made on that chain
+func (c *Client) OnChain(name string) *Client {
+	return &Client{vault: c.vault, mount: c.mount + "/chains/" + url.PathEscape(name)}
+}
+
+// ReadFreeze returns whether the mount is frozen
+func (c *Client) ReadFreeze(ctx context.Context) (*Freeze, error) {
+	var freeze Freeze
+	if err := c.read(ctx, "config/freeze", &freeze); err != nil {
+		return nil, err
+	}
+	return &freeze, nil
+}
+
+// Freeze refuses all signing and exports on the mount until Unfreeze
+func (c *Client) Freeze(ctx context.Context, reason string) (*Freeze, error) {
+	var freeze Freeze
+	if err := c.write(ctx, "config/freeze", map[string]interface{}{"frozen": true, "reason": reason}, &freeze); err != nil {
+		return nil, err
+	}
+	return &freeze, nil
+}
+
+// Unfreeze lifts a freeze
+func (c *Client) Unfreeze(ctx context.Context) error {
+	return c.delete(ctx, "config/freeze")
+}
+
+// Health runs the health checks of the mount. A failed check is reported in
+// the result, not as an error.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	err := c.read(ctx, "health", &health)
+	var e *Error
+	if errors.As(err, &e) && e.StatusCode == http.StatusServiceUnavailable && e.body != nil {
+		// an unhealthy mount answers 503 with the full result
+		if json.Unmarshal(e.body, &struct {
+			Data *Health `json:"data"`
+		}{&health}) == nil {
+			return &health, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Info returns the version of the plugin and the features of the mount
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	var info Info
+	if err := c.read(ctx, "info", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Inventory returns the accounts of the mount and, with balances, what they
+// hold on every chain
+func (c *Client) Inventory(ctx context.Context, balances bool) (*Inventory, error) {
+	r := c.request(http.MethodGet, "inventory")
+	r.Params.Set("balances", strconv.FormatBool(balances))
+	var inventory Inventory
+	if err := c.do(ctx, r, &inventory); err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
@@ -0,0 +1,361 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command vault-core-cli wraps the common flows of the plugin so operators do
+// not have to assemble vault write invocations by hand. It reads VAULT_ADDR,
+// VAULT_TOKEN and the other standard Vault client environment variables.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+)
+
+const usage = `Usage: vault-core-cli [-mount PATH] [-format table|json] <command> [args]
+
+Commands:
+    accounts list
+    accounts read <name>
+    accounts create <name> [-index N] [-mnemonic-file FILE] [-inclusions A,B] [-exclusions A,B]
+    accounts delete <name>
+    addresses read <address>
+    send <name> (-to ADDRESS | -to-label LABEL) -amount WEI [-gas-limit N] [-gas-price WEI] [-data HEX]
+    sign-tx <name> -file TX.json
+    tx read <hash>
+    export request <name>
+    export approve <id>
+    export release <id> -passphrase-file FILE
+    decisions verify -file FILE [-previous-hmac HEX]
+    plugin-info read
+    plugin-info verify [-plugin NAME | -sha256 HEX] [-version VERSION] [-commit COMMIT]
+`
+
+type cli struct {
+	client *api.Client
+	mount  string
+	format string
+}
+
+func main() {
+	flags := flag.NewFlagSet("vault-core-cli", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	mount := flags.String("mount", envOr("VAULT_CORE_MOUNT", "vault-ethereum"), "the path the plugin is mounted at")
+	format := flags.String("format", "table", "the output format: table or json")
+	flags.Parse(os.Args[1:])
+	if *format != "table" && *format != "json" {
+		fail(fmt.Errorf("unknown format %s", *format))
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		fail(err)
+	}
+	c := &cli{client: client, mount: strings.Trim(*mount, "/"), format: *format}
+	if err := c.run(flags.Args()); err != nil {
+		fail(err)
+	}
+}
+
+func (c *cli) run(args []string) error {
+	command, args := args[0], args[1:]
+	switch command {
+	case "accounts":
+		return c.accounts(args)
+	case "addresses":
+		if len(args) != 2 || args[0] != "read" {
+			return errUsage
+		}
+		return c.read("addresses/" + args[1])
+	case "send":
+		return c.send(args)
+	case "sign-tx":
+		return c.signTx(args)
+	case "tx":
+		if len(args) != 2 || args[0] != "read" {
+			return errUsage
+		}
+		return c.read("tx/" + args[1])
+	case "export":
+		return c.export(args)
+	case "decisions":
+		return c.decisions(args)
+	case "plugin-info":
+		return c.pluginInfo(args)
+	}
+	return errUsage
+}
+
+var errUsage = fmt.Errorf("invalid arguments\n\n%s", usage)
+
+func (c *cli) accounts(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if args[0] == "list" {
+		return c.list("accounts")
+	}
+	if len(args) < 2 {
+		return errUsage
+	}
+	name := args[1]
+	switch args[0] {
+	case "read":
+		return c.read("accounts/" + name)
+	case "delete":
+		_, err := c.client.Logical().Delete(c.path("accounts/" + name))
+		return err
+	case "create":
+		flags := flag.NewFlagSet("accounts create", flag.ExitOnError)
+		index := flags.Int("index", 0, "the BIP-44 index")
+		mnemonicFile := flags.String("mnemonic-file", "", "a file holding the mnemonic to import; one is generated if unset")
+		inclusions := flags.String("inclusions", "", "comma separated addresses the account may send to")
+		exclusions := flags.String("exclusions", "", "comma separated addresses the account may never send to")
+		flags.Parse(args[2:])
+		data := map[string]interface{}{"index": *index}
+		if *mnemonicFile != "" {
+			mnemonic, err := ioutil.ReadFile(*mnemonicFile)
+			if err != nil {
+				return err
+			}
+			data["mnemonic"] = strings.TrimSpace(string(mnemonic))
+		}
+		if *inclusions != "" {
+			data["inclusions"] = *inclusions
+		}
+		if *exclusions != "" {
+			data["exclusions"] = *exclusions
+		}
+		return c.write("accounts/"+name, data)
+	}
+	return errUsage
+}
+
+func (c *cli) send(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+	to := flags.String("to", "", "the destination address")
+	toLabel := flags.String("to-label", "", "the address book label of the destination")
+	amount := flags.String("amount", "", "the amount in wei")
+	gasLimit := flags.String("gas-limit", "", "the gas limit; estimated if unset")
+	gasPrice := flags.String("gas-price", "", "the gas price in wei; suggested by the node if unset")
+	txData := flags.String("data", "", "hex encoded call data")
+	flags.Parse(args[1:])
+	if (*to == "" && *toLabel == "") || *amount == "" {
+		return fmt.Errorf("send needs -to or -to-label, and -amount")
+	}
+	data := map[string]interface{}{"amount": *amount}
+	for key, value := range map[string]string{"to": *to, "to_label": *toLabel, "gas_limit": *gasLimit, "gas_price": *gasPrice, "data": *txData} {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	return c.write("accounts/"+args[0]+"/transfer", data)
+}
+
+func (c *cli) signTx(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	flags := flag.NewFlagSet("sign-tx", flag.ExitOnError)
+	file := flags.String("file", "", "a JSON file with the sign-tx fields: to, amount, data, nonce, gas_limit, gas_price, encoding")
+	flags.Parse(args[1:])
+	if *file == "" {
+		return fmt.Errorf("sign-tx needs -file")
+	}
+	contents, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(contents, &data); err != nil {
+		return fmt.Errorf("%s is not a JSON object: %v", *file, err)
+	}
+	return c.write("accounts/"+args[0]+"/sign-tx", data)
+}
+
+func (c *cli) export(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	switch args[0] {
+	case "request":
+		return c.write("accounts/"+args[1]+"/export", nil)
+	case "approve":
+		return c.write("exports/"+args[1]+"/approve", nil)
+	case "release":
+		flags := flag.NewFlagSet("export release", flag.ExitOnError)
+		passphraseFile := flags.String("passphrase-file", "", "a file holding the passphrase that encrypts the keystore")
+		flags.Parse(args[2:])
+		if *passphraseFile == "" {
+			return fmt.Errorf("export release needs -passphrase-file")
+		}
+		passphrase, err := ioutil.ReadFile(*passphraseFile)
+		if err != nil {
+			return err
+		}
+		return c.write("exports/"+args[1]+"/release", map[string]interface{}{"passphrase": strings.TrimSpace(string(passphrase))})
+	}
+	return errUsage
+}
+
+func (c *cli) decisions(args []string) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return errUsage
+	}
+	flags := flag.NewFlagSet("decisions verify", flag.ExitOnError)
+	file := flags.String("file", "", "a decision log file, or an archived part of one")
+	previousHMAC := flags.String("previous-hmac", "", "the hmac of the line before the first line of the file")
+	flags.Parse(args[1:])
+	if *file == "" {
+		return fmt.Errorf("decisions verify needs -file")
+	}
+	contents, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	secret, err := c.client.Logical().Write(c.path("decisions/verify"), map[string]interface{}{"log": string(contents), "previous_hmac": *previousHMAC})
+	if err != nil {
+		return err
+	}
+	if err := c.print(secret); err != nil {
+		return err
+	}
+	if secret == nil || secret.Data["verified"] != true {
+		return fmt.Errorf("%s does not verify", *file)
+	}
+	return nil
+}
+
+// pluginInfo checks the running plugin binary against the SHA256 its plugin
+// catalog entry registered, or one given by hand, such as the hash of a
+// reproducible build of the audited source
+func (c *cli) pluginInfo(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if args[0] == "read" {
+		return c.read("plugin-info")
+	}
+	if args[0] != "verify" {
+		return errUsage
+	}
+	flags := flag.NewFlagSet("plugin-info verify", flag.ExitOnError)
+	plugin := flags.String("plugin", "vault-core", "the name the plugin is registered under in the plugin catalog")
+	sha256 := flags.String("sha256", "", "the SHA256 to verify against instead of the plugin catalog's")
+	version := flags.String("version", "", "the version the plugin must have been built with")
+	commit := flags.String("commit", "", "the git commit the plugin must have been built from")
+	flags.Parse(args[1:])
+	if *sha256 == "" {
+		registration, err := c.client.Sys().GetPlugin(&api.GetPluginInput{Name: *plugin, Type: consts.PluginTypeSecrets})
+		if err != nil {
+			return fmt.Errorf("cannot read the plugin catalog entry of %s: %v", *plugin, err)
+		}
+		*sha256 = registration.SHA256
+	}
+	secret, err := c.client.Logical().Write(c.path("plugin-info/verify"), map[string]interface{}{"sha256": *sha256, "version": *version, "commit": *commit})
+	if err != nil {
+		return err
+	}
+	if err := c.print(secret); err != nil {
+		return err
+	}
+	if secret == nil || secret.Data["verified"] != true {
+		return fmt.Errorf("the plugin mounted at %s does not match %s", c.mount, *sha256)
+	}
+	return nil
+}
+
+func (c *cli) path(subpath string) string {
+	return c.mount + "/" + subpath
+}
+
+func (c *cli) read(subpath string) error {
+	secret, err := c.client.Logical().Read(c.path(subpath))
+	if err != nil {
+		return err
+	}
+	return c.print(secret)
+}
+
+func (c *cli) list(subpath string) error {
+	secret, err := c.client.Logical().List(c.path(subpath))
+	if err != nil {
+		return err
+	}
+	return c.print(secret)
+}
+
+func (c *cli) write(subpath string, data map[string]interface{}) error {
+	secret, err := c.client.Logical().Write(c.path(subpath), data)
+	if err != nil {
+		return err
+	}
+	return c.print(secret)
+}
+
+func (c *cli) print(secret *api.Secret) error {
+	if secret == nil {
+		if c.format == "json" {
+			fmt.Println("{}")
+		}
+		return nil
+	}
+	if c.format == "json" {
+		out, err := json.MarshalIndent(secret.Data, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	var keys []string
+	width := 0
+	for key := range secret.Data {
+		keys = append(keys, key)
+		if len(key) > width {
+			width = len(key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%-*s    %v\n", width, key, secret.Data[key])
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
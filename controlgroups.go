@@ -0,0 +1,85 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/core-coin/go-core/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// controlGroupExport puts export requests of accounts under the two-person rule
+	controlGroupExport string = "export"
+	// controlGroupRotate puts key replacements of accounts under the two-person rule
+	controlGroupRotate string = "rotate"
+)
+
+// controlled reports whether the config puts an operation under the two-person rule
+func (config *ConfigJSON) controlled(operation string) bool {
+	return util.Contains(config.ControlGroupOperations, operation)
+}
+
+// checkControlGroup holds an operation of any account, whatever its tier, to
+// an approved authorization when the config puts it under the two-person rule
+func (b *PluginBackend) checkControlGroup(ctx context.Context, req *logical.Request, config *ConfigJSON, name, operation string) error {
+	if !config.controlled(operation) {
+		return nil
+	}
+	err := b.useAuthorization(ctx, req, name)
+	recordRule(ctx, "control_group", err)
+	return err
+}
+
+// checkHighValue holds a transaction at or above control_group_min_amount,
+// or worth control_group_min_usd or more, to an approved authorization
+func (b *PluginBackend) checkHighValue(ctx context.Context, scope *signingScope, config *ConfigJSON, tx *types.Transaction, call *DecodedCall) error {
+	highValue, err := b.atOrAbove(ctx, config, tx, call, config.ControlGroupMinAmount, config.ControlGroupMinUSD)
+	if err != nil || !highValue {
+		return err
+	}
+	err = b.useAuthorization(ctx, scope.req, scope.account)
+	if err != nil {
+		err = fmt.Errorf("%w (the transaction is above the control group minimum)", err)
+	}
+	recordRule(ctx, "control_group", err)
+	return err
+}
+
+// atOrAbove reports whether a transaction sends at least minAmount wei or is
+// worth at least minUSD, priced as for the USD limits. An empty minimum never
+// matches.
+func (b *PluginBackend) atOrAbove(ctx context.Context, config *ConfigJSON, tx *types.Transaction, call *DecodedCall, minAmount, minUSD string) (bool, error) {
+	if amount := util.ValidNumber(minAmount); minAmount != Empty && amount != nil && tx.Value().Cmp(amount) >= 0 {
+		return true, nil
+	}
+	usd := parseUSD(minUSD)
+	if minUSD == Empty || usd == nil {
+		return false, nil
+	}
+	client, err := b.dialRPC(ctx, config)
+	if err != nil {
+		return false, err
+	}
+	value, _, err := valueInUSD(ctx, client, config, tx, call)
+	if err != nil {
+		return false, err
+	}
+	return value.Cmp(usd) >= 0, nil
+}
@@ -0,0 +1,727 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	verdictAllow string = "allow"
+	verdictDeny  string = "deny"
+
+	rulePass string = "pass"
+	ruleFail string = "fail"
+)
+
+// Decision records why a signing or export request was allowed or denied.
+// Digest is only set for the caller-supplied digests of sign-digest,
+// Authorization for requests an authorizer approved, and MFA for requests
+// that passed a step-up, with the method they passed. Screening holds the
+// verdicts of the screening API on the destinations of a transaction.
+type Decision struct {
+	Time          time.Time          `json:"time"`
+	RequestID     string             `json:"request_id"`
+	Path          string             `json:"path"`
+	Operation     string             `json:"operation"`
+	EntityID      string             `json:"entity_id,omitempty"`
+	Account       string             `json:"account,omitempty"`
+	Chain         string             `json:"chain,omitempty"`
+	To            string             `json:"to,omitempty"`
+	Amount        string             `json:"amount,omitempty"`
+	Call          *DecodedCall       `json:"call,omitempty"`
+	Digest        string             `json:"digest,omitempty"`
+	Memo          string             `json:"memo,omitempty"`
+	Authorization string             `json:"authorization,omitempty"`
+	MFA           string             `json:"mfa,omitempty"`
+	USD           *USDValuation      `json:"usd,omitempty"`
+	Screening     []ScreeningVerdict `json:"screening,omitempty"`
+	Rules         []DecisionRule     `json:"rules"`
+	Verdict       string             `json:"verdict"`
+	ErrorCode     string             `json:"error_code,omitempty"`
+	Reason        string             `json:"reason,omitempty"`
+}
+
+// DecisionRule is the outcome of one rule evaluated for a decision
+type DecisionRule struct {
+	Rule    string `json:"rule"`
+	Outcome string `json:"outcome"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type decisionKey struct{}
+
+// decisionRecorder collects the rules evaluated for one request
+type decisionRecorder struct {
+	sync.Mutex
+	signing       bool
+	account       string
+	chain         string
+	call          *DecodedCall
+	digest        string
+	memo          string
+	authorization string
+	mfa           string
+	usd           *USDValuation
+	screening     []ScreeningVerdict
+	anomalies     []*AnomalyObservationJSON
+	rules         []DecisionRule
+}
+
+func withDecisionRecorder(ctx context.Context) (context.Context, *decisionRecorder) {
+	recorder := &decisionRecorder{}
+	return context.WithValue(ctx, decisionKey{}, recorder), recorder
+}
+
+func decisionFromContext(ctx context.Context) *decisionRecorder {
+	recorder, _ := ctx.Value(decisionKey{}).(*decisionRecorder)
+	return recorder
+}
+
+// recordRule notes the outcome of a policy rule for the decision log
+func recordRule(ctx context.Context, rule string, err error) {
+	recorder := decisionFromContext(ctx)
+	if recorder == nil {
+		return
+	}
+	result := DecisionRule{Rule: rule, Outcome: rulePass}
+	if err != nil {
+		result.Outcome = ruleFail
+		result.Detail = err.Error()
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.rules = append(recorder.rules, result)
+}
+
+// markSigning makes the request one that is written to the decision log
+func markSigning(ctx context.Context, account string) {
+	recorder := decisionFromContext(ctx)
+	if recorder == nil {
+		return
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.signing = true
+	recorder.account = account
+}
+
+// noteChain records the chain a request is made on
+func noteChain(ctx context.Context, chain string) {
+	recorder := decisionFromContext(ctx)
+	if recorder == nil {
+		return
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.chain = chain
+}
+
+// maxMemoLength bounds the memo a signing request may carry
+const maxMemoLength int = 256
+
+// memoSchema is the reference a signing request carries into the decision
+// log, the account activity, the tracked transaction and notifications
+var memoSchema = &framework.FieldSchema{
+	Type:        framework.TypeString,
+	Description: "A free-form reference for reconciliation, such as an invoice or ticket number. It is logged, not signed.",
+}
+
+// noteMemo records the memo of a signing request, refusing one that is too
+// long to log or is not a string
+func noteMemo(ctx context.Context, data *framework.FieldData) error {
+	raw, ok := data.Raw["memo"]
+	if !ok || raw == nil {
+		return nil
+	}
+	memo, ok := raw.(string)
+	if !ok || len(memo) > maxMemoLength {
+		return fmt.Errorf("%w: memo must be a string of at most %d bytes", ErrInvalidInput, maxMemoLength)
+	}
+	recorder := decisionFromContext(ctx)
+	if recorder == nil {
+		return nil
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.memo = memo
+	return nil
+}
+
+// memoFromContext returns the memo of the signing request
+func memoFromContext(ctx context.Context) string {
+	recorder := decisionFromContext(ctx)
+	if recorder == nil {
+		return Empty
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	return recorder.memo
+}
+
+// noteDigest records the caller-supplied digest a request signs
+func noteDigest(ctx context.Context, digest []byte) {
+	recorder := decisionFromContext(ctx)
+	if recorder == nil {
+		return
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.digest = hexutil.Encode(digest)
+}
+
+// noteCall decodes the calldata a request signs, for the decision log and the
+// log of the request, so reviewers see the method and not only its selector
+func (b *PluginBackend) noteCall(ctx context.Context, s logical.Storage, to *common.Address, data []byte) *DecodedCall {
+	call, err := decodeCall(ctx, s, to, data)
+	if err != nil {
+		b.Logger().Warn("cannot decode calldata", "error", err)
+		return nil
+	}
+	if call == nil {
+		return nil
+	}
+	b.Logger().Info("calldata", "selector", call.Selector, "signature", call.Signature, "abi", call.ABI)
+	if recorder := decisionFromContext(ctx); recorder != nil {
+		recorder.Lock()
+		recorder.call = call
+		recorder.Unlock()
+	}
+	return call
+}
+
+// logDecision writes the decision for a request that signed, exported or
+// evaluated a policy rule. Requests that did neither leave no decision.
+func (b *PluginBackend) logDecision(ctx context.Context, req *logical.Request, recorder *decisionRecorder, err error) {
+	recorder.Lock()
+	defer recorder.Unlock()
+	if !recorder.signing && len(recorder.rules) == 0 {
+		return
+	}
+	decision := &Decision{
+		Time:          time.Now().UTC(),
+		RequestID:     req.ID,
+		Path:          req.Path,
+		Operation:     string(req.Operation),
+		EntityID:      req.EntityID,
+		Account:       recorder.account,
+		Chain:         recorder.chain,
+		Call:          recorder.call,
+		Digest:        recorder.digest,
+		Memo:          recorder.memo,
+		Authorization: recorder.authorization,
+		MFA:           recorder.mfa,
+		USD:           recorder.usd,
+		Screening:     recorder.screening,
+		Rules:         recorder.rules,
+		Verdict:       verdictAllow,
+	}
+	if to, ok := req.Data["to"].(string); ok {
+		decision.To = to
+	}
+	if amount, ok := req.Data["amount"].(string); ok {
+		decision.Amount = amount
+	}
+	if decision.Rules == nil {
+		decision.Rules = []DecisionRule{}
+	}
+	if err != nil {
+		decision.Verdict = verdictDeny
+		decision.ErrorCode = ErrorCode(err)
+		decision.Reason = err.Error()
+	}
+	line, jsonErr := json.Marshal(decision)
+	if jsonErr != nil {
+		b.Logger().Error("cannot encode decision", "error", jsonErr)
+		return
+	}
+	b.Logger().Named("decision").Info(string(line))
+	config, configErr := b.readConfig(ctx, req.Storage)
+	if configErr != nil || config.DecisionLogFile == Empty {
+		return
+	}
+	if writeErr := b.decisionLog.append(ctx, req.Storage, config, line, b.Logger()); writeErr != nil {
+		// a slow disk fails every decision the same way; say so once per window
+		if logged, suppressed := b.logSampler.allow("decision log " + writeErr.Error()); logged {
+			b.Logger().Error("cannot write the decision log", "file", config.DecisionLogFile, "error", writeErr, "suppressed", suppressed)
+		}
+	}
+}
+
+const (
+	decisionKeyStoragePath string = "decisions/chain-key"
+
+	overflowBlock string = "block"
+	overflowDrop  string = "drop"
+
+	fsyncNever    string = "never"
+	fsyncAlways   string = "always"
+	fsyncBytes    string = "bytes"
+	fsyncInterval string = "interval"
+)
+
+// decisionLog appends decisions to the decision log file. When the log is
+// chained every line ends with an HMAC over the line and the HMAC of the line
+// before it, so a line that is changed, removed or reordered breaks the chain.
+//
+// With decision_log_buffer set lines are queued and written by a goroutine
+// so a slow disk does not hold up signing; a full queue either blocks the
+// request or drops the decision, as decision_log_overflow says. Lines are
+// chained as they are written, so a dropped decision does not break the chain.
+type decisionLog struct {
+	sync.Mutex
+	key   []byte
+	heads map[string][]byte
+	// unsynced tracks what was written to each file since it was last synced
+	unsynced map[string]*unsyncedFile
+
+	queueLock sync.RWMutex
+	queue     chan *decisionLine
+	done      chan struct{}
+	size      int
+
+	written uint64
+	dropped uint64
+	failed  uint64
+}
+
+// decisionLine is a line waiting to be written to a decision log file
+type decisionLine struct {
+	path string
+	line []byte
+	// key chains the line when set
+	key   []byte
+	fsync fsyncPolicy
+}
+
+// fsyncPolicy says when a decision log file is synced to disk: after every
+// line, once bytes were written since the last sync, or at most interval
+// after a line was written. Without a sync the lines that were written last
+// may be lost if the host goes down.
+type fsyncPolicy struct {
+	mode     string
+	bytes    int
+	interval time.Duration
+}
+
+type unsyncedFile struct {
+	bytes int
+	timer *time.Timer
+}
+
+func newDecisionLog() *decisionLog {
+	return &decisionLog{heads: map[string][]byte{}, unsynced: map[string]*unsyncedFile{}}
+}
+
+// chainKey returns the HMAC key of the decision log, creating it on first use.
+// The key never leaves the barrier; logs are verified through decisions/verify.
+func (log *decisionLog) chainKey(ctx context.Context, s logical.Storage) ([]byte, error) {
+	log.Lock()
+	defer log.Unlock()
+	if log.key != nil {
+		return log.key, nil
+	}
+	entry, err := s.Get(ctx, QualifiedPath(decisionKeyStoragePath))
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		log.key = entry.Value
+		return log.key, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := s.Put(ctx, &logical.StorageEntry{Key: QualifiedPath(decisionKeyStoragePath), Value: key, SealWrap: true}); err != nil {
+		return nil, err
+	}
+	log.key = key
+	return log.key, nil
+}
+
+// append writes one JSON line to the decision log file of config, or queues it
+func (log *decisionLog) append(ctx context.Context, s logical.Storage, config *ConfigJSON, line []byte, logger hclog.Logger) error {
+	item := &decisionLine{
+		path: config.DecisionLogFile,
+		line: line,
+		fsync: fsyncPolicy{
+			mode:     config.DecisionLogFsync,
+			bytes:    config.DecisionLogFsyncBytes,
+			interval: time.Duration(config.DecisionLogFsyncInterval) * time.Second,
+		},
+	}
+	if config.DecisionLogHMAC {
+		key, err := log.chainKey(ctx, s)
+		if err != nil {
+			return err
+		}
+		item.key = key
+	}
+	if config.DecisionLogBuffer == 0 {
+		log.stop()
+		return log.write(item)
+	}
+	for {
+		log.queueLock.RLock()
+		if log.queue != nil && log.size == config.DecisionLogBuffer {
+			defer log.queueLock.RUnlock()
+			if config.DecisionLogOverflow != overflowDrop {
+				log.queue <- item
+				return nil
+			}
+			select {
+			case log.queue <- item:
+				return nil
+			default:
+				atomic.AddUint64(&log.dropped, 1)
+				return fmt.Errorf("the buffer of %d lines is full; the decision was dropped", log.size)
+			}
+		}
+		log.queueLock.RUnlock()
+		log.start(config.DecisionLogBuffer, logger)
+	}
+}
+
+// start replaces the queue with one of size lines, once the old one is written
+func (log *decisionLog) start(size int, logger hclog.Logger) {
+	log.queueLock.Lock()
+	defer log.queueLock.Unlock()
+	if log.queue != nil && log.size == size {
+		return
+	}
+	log.drain()
+	log.queue = make(chan *decisionLine, size)
+	log.done = make(chan struct{})
+	log.size = size
+	go log.run(log.queue, log.done, logger)
+}
+
+// stop writes out the queued lines and goes back to writing synchronously
+func (log *decisionLog) stop() {
+	log.queueLock.RLock()
+	queued := log.queue != nil
+	log.queueLock.RUnlock()
+	if !queued {
+		return
+	}
+	log.queueLock.Lock()
+	defer log.queueLock.Unlock()
+	log.drain()
+}
+
+func (log *decisionLog) drain() {
+	if log.queue == nil {
+		return
+	}
+	close(log.queue)
+	<-log.done
+	log.queue = nil
+	log.size = 0
+}
+
+func (log *decisionLog) run(queue chan *decisionLine, done chan struct{}, logger hclog.Logger) {
+	defer close(done)
+	for item := range queue {
+		if err := log.write(item); err != nil {
+			logger.Error("cannot write the decision log", "file", item.path, "error", err)
+		}
+	}
+}
+
+// write chains a line if it has a key and appends it to its file
+func (log *decisionLog) write(item *decisionLine) error {
+	log.Lock()
+	defer log.Unlock()
+	line := item.line
+	if item.key != nil {
+		previous, ok := log.heads[item.path]
+		if !ok {
+			// carry on the chain of a file written before the plugin restarted
+			var err error
+			previous, err = lastDecisionMAC(item.path)
+			if err != nil {
+				atomic.AddUint64(&log.failed, 1)
+				return err
+			}
+		}
+		mac := chainMAC(item.key, previous, line)
+		line = append(line[:len(line)-1:len(line)-1], fmt.Sprintf(`,"hmac":"%s"}`, hex.EncodeToString(mac))...)
+		log.heads[item.path] = mac
+	}
+	if err := log.appendLine(item.path, line, item.fsync); err != nil {
+		atomic.AddUint64(&log.failed, 1)
+		return err
+	}
+	atomic.AddUint64(&log.written, 1)
+	return nil
+}
+
+// appendLine appends one line to a file and syncs it as the policy says
+func (log *decisionLog) appendLine(path string, line []byte, policy fsyncPolicy) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	unsynced, ok := log.unsynced[path]
+	if !ok {
+		unsynced = &unsyncedFile{}
+		log.unsynced[path] = unsynced
+	}
+	unsynced.bytes += len(line) + 1
+	flush := false
+	switch policy.mode {
+	case fsyncAlways:
+		flush = true
+	case fsyncBytes:
+		flush = unsynced.bytes >= policy.bytes
+	case fsyncInterval:
+		if unsynced.timer == nil {
+			unsynced.timer = time.AfterFunc(policy.interval, func() { log.syncFile(path) })
+		}
+	}
+	if flush {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
+		delete(log.unsynced, path)
+	}
+	return file.Close()
+}
+
+// syncFile syncs the lines written to a file since it was last synced
+func (log *decisionLog) syncFile(path string) error {
+	log.Lock()
+	defer log.Unlock()
+	return log.syncLocked(path)
+}
+
+func (log *decisionLog) syncLocked(path string) error {
+	unsynced, ok := log.unsynced[path]
+	if !ok {
+		return nil
+	}
+	if unsynced.timer != nil {
+		unsynced.timer.Stop()
+	}
+	delete(log.unsynced, path)
+	// syncing any descriptor of a file flushes all of its written data
+	file, err := os.OpenFile(path, os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncAll syncs every file with lines that were not synced yet
+func (log *decisionLog) syncAll() {
+	log.Lock()
+	defer log.Unlock()
+	for path := range log.unsynced {
+		log.syncLocked(path)
+	}
+}
+
+// status reports the counters of the decision log since the plugin started
+func (log *decisionLog) status() map[string]interface{} {
+	log.queueLock.RLock()
+	defer log.queueLock.RUnlock()
+	return map[string]interface{}{
+		"buffer_size": log.size,
+		"queued":      len(log.queue),
+		"written":     atomic.LoadUint64(&log.written),
+		"dropped":     atomic.LoadUint64(&log.dropped),
+		"failed":      atomic.LoadUint64(&log.failed),
+	}
+}
+
+// chainMAC is the HMAC of a decision line, keyed by the chain key, over the
+// HMAC of the line before it and the line without its hmac field
+func chainMAC(key, previous, line []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(previous)
+	mac.Write(line)
+	return mac.Sum(nil)
+}
+
+// hmacSuffix matches the hmac field a chained line ends with
+var hmacSuffix = regexp.MustCompile(`,"hmac":"([0-9a-f]{64})"}$`)
+
+// splitChainedLine returns a chained line as it was before its hmac was added, and the hmac
+func splitChainedLine(line []byte) ([]byte, []byte, bool) {
+	match := hmacSuffix.FindSubmatchIndex(line)
+	if match == nil {
+		return nil, nil, false
+	}
+	mac, err := hex.DecodeString(string(line[match[2]:match[3]]))
+	if err != nil {
+		return nil, nil, false
+	}
+	unchained := append(append([]byte{}, line[:match[0]]...), '}')
+	return unchained, mac, true
+}
+
+// lastDecisionMAC returns the hmac of the last line of a decision log file;
+// nil starts a new chain
+func lastDecisionMAC(path string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(bytes.TrimRight(contents, "\n"), []byte("\n"))
+	if _, mac, ok := splitChainedLine(lines[len(lines)-1]); ok {
+		return mac, nil
+	}
+	return nil, nil
+}
+
+func decisionPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("decisions/status"),
+			HelpSynopsis: "Report how many decisions were written to the decision log file.",
+			HelpDescription: `
+
+Counts the decisions written to decision_log_file, those dropped because the
+buffer was full and those that could not be written, since the plugin last
+started, and how many lines are waiting in the buffer.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathDecisionsStatus,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("decisions/verify"),
+			HelpSynopsis: "Verify the hash chain of a decision log.",
+			HelpDescription: `
+
+With decision_log_hmac set, every line of the decision log file ends with an
+HMAC, keyed by a key that never leaves the Vault barrier, over the line and the
+HMAC of the line before it. POST the contents of a decision log, or of one
+archived part of it, to check that no line was changed, removed, inserted or
+reordered. To verify a part that does not start the chain, pass the hmac of
+the last line of the part before it as previous_hmac.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"log": {
+					Type:        framework.TypeString,
+					Description: "The contents of the decision log, one JSON line per decision.",
+				},
+				"previous_hmac": {
+					Type:        framework.TypeString,
+					Description: "The hmac of the line before the first line of log; empty when log starts the chain.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathDecisionsVerify,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathDecisionsStatus(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: b.decisionLog.status(),
+	}, nil
+}
+
+func (b *PluginBackend) pathDecisionsVerify(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := hex.DecodeString(data.Get("previous_hmac").(string))
+	if err != nil {
+		return nil, fmt.Errorf("%w: previous_hmac is not hex", ErrInvalidInput)
+	}
+	if len(previous) == 0 {
+		previous = nil
+	}
+	key, err := b.decisionLog.chainKey(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	verified := 0
+	for number, line := range strings.Split(data.Get("log").(string), "\n") {
+		if strings.TrimSpace(line) == Empty {
+			continue
+		}
+		unchained, mac, ok := splitChainedLine([]byte(strings.TrimRight(line, "\r")))
+		reason := Empty
+		switch {
+		case !ok:
+			reason = "the line has no hmac"
+		case !hmac.Equal(mac, chainMAC(key, previous, unchained)):
+			reason = "the hmac does not match the line and the line before it"
+		}
+		if reason != Empty {
+			return &logical.Response{
+				Data: map[string]interface{}{
+					"verified":     false,
+					"lines":        verified,
+					"invalid_line": number + 1,
+					"reason":       reason,
+				},
+			}, nil
+		}
+		previous = mac
+		verified++
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"verified":  true,
+			"lines":     verified,
+			"last_hmac": hex.EncodeToString(previous),
+		},
+	}, nil
+}
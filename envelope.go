@@ -0,0 +1,286 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// The key material of every account is encrypted under a data key of its own.
+// The data keys are wrapped under the mount key, which is kept in the same
+// storage: destroying an account deletes its data key from the live storage,
+// but a backup of the storage taken before holds both and restores it. With
+// envelope_transit_url set, each data key is wrapped instead under a transit
+// key of its own in another Vault, and destroying the account deletes that
+// transit key: every copy of the account, in backups and bundles too, is
+// then useless, as long as the transit mount is not backed up with this one.
+
+const mountKeyStoragePath string = "envelope/mount-key"
+
+// accountSecrets is the part of an account that is kept in its envelope
+type accountSecrets struct {
+	Mnemonic       string `json:"mnemonic,omitempty"`
+	SealedMnemonic string `json:"sealed_mnemonic,omitempty"`
+	PrivateKey     string `json:"private_key,omitempty"`
+}
+
+func dekStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("envelope/deks/%s", name))
+}
+
+func gcmSeal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func gcmOpen(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: sealed data is corrupt", ErrKeystoreDecrypt)
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+func readMountKey(ctx context.Context, s logical.Storage) ([]byte, error) {
+	entry, err := s.Get(ctx, QualifiedPath(mountKeyStoragePath))
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry.Value, nil
+}
+
+// readDataKey returns the data key of an account, nil if it has none
+func readDataKey(ctx context.Context, s logical.Storage, name string) ([]byte, error) {
+	wrapped, err := readTransitDataKey(ctx, s, name)
+	if err != nil {
+		return nil, err
+	}
+	if wrapped != nil {
+		_, token, err := envelopeTransit(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		dek, err := transitUnwrap(ctx, token, wrapped)
+		if err != nil {
+			return nil, wrapError(ErrKeystoreDecrypt, err)
+		}
+		return dek, nil
+	}
+	entry, err := s.Get(ctx, dekStoragePath(name))
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	mountKey, err := readMountKey(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if mountKey == nil {
+		return nil, fmt.Errorf("%w: this mount has lost its mount key", ErrKeystoreDecrypt)
+	}
+	dek, err := gcmOpen(mountKey, entry.Value, []byte(name))
+	if err != nil {
+		return nil, wrapError(ErrKeystoreDecrypt, err)
+	}
+	return dek, nil
+}
+
+// dataKey returns the data key of an account, creating it and, on first
+// use, the mount key. With a transit mount configured, a data key wrapped
+// under the mount key is wrapped again under a transit key.
+func (b *PluginBackend) dataKey(ctx context.Context, s logical.Storage, name string) ([]byte, error) {
+	b.envelopeLock.Lock()
+	defer b.envelopeLock.Unlock()
+	transitURL, token, err := envelopeTransit(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := readDataKey(ctx, s, name)
+	if err != nil {
+		return nil, err
+	}
+	if dek != nil {
+		if transitURL == Empty {
+			return dek, nil
+		}
+		wrapped, err := readTransitDataKey(ctx, s, name)
+		if err != nil || wrapped != nil {
+			return dek, err
+		}
+		if err := putTransitDataKey(ctx, s, name, transitURL, token, dek); err != nil {
+			return nil, err
+		}
+		if err := s.Delete(ctx, dekStoragePath(name)); err != nil {
+			return nil, err
+		}
+		return dek, nil
+	}
+	if transitURL != Empty {
+		dek = make([]byte, 32)
+		if _, err := rand.Read(dek); err != nil {
+			return nil, err
+		}
+		if err := putTransitDataKey(ctx, s, name, transitURL, token, dek); err != nil {
+			return nil, err
+		}
+		return dek, nil
+	}
+	mountKey, err := readMountKey(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if mountKey == nil {
+		mountKey = make([]byte, 32)
+		if _, err := rand.Read(mountKey); err != nil {
+			return nil, err
+		}
+		if err := s.Put(ctx, &logical.StorageEntry{Key: QualifiedPath(mountKeyStoragePath), Value: mountKey, SealWrap: true}); err != nil {
+			return nil, err
+		}
+	}
+	dek = make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	wrapped, err := gcmSeal(mountKey, dek, []byte(name))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Put(ctx, &logical.StorageEntry{Key: dekStoragePath(name), Value: wrapped, SealWrap: true}); err != nil {
+		return nil, err
+	}
+	return dek, nil
+}
+
+// putTransitDataKey wraps the data key of an account under a new transit key
+// and stores it
+func putTransitDataKey(ctx context.Context, s logical.Storage, name, url, token string, dek []byte) error {
+	wrapped, err := transitWrap(ctx, url, token, dek)
+	if err != nil {
+		return fmt.Errorf("%w: cannot wrap the data key of %s: %v", ErrKeystoreDecrypt, name, err)
+	}
+	entry, err := logical.StorageEntryJSON(transitDataKeyStoragePath(name), wrapped)
+	if err != nil {
+		return err
+	}
+	entry.SealWrap = true
+	return s.Put(ctx, entry)
+}
+
+// destroyDataKey deletes the data key of an account and, if it was wrapped
+// under a transit key, the transit key. It reports whether the data key was
+// wrapped under the mount key instead, and survives in storage backups.
+func destroyDataKey(ctx context.Context, s logical.Storage, name string) (bool, error) {
+	wrapped, err := readTransitDataKey(ctx, s, name)
+	if err != nil {
+		return false, err
+	}
+	if wrapped != nil {
+		_, token, err := envelopeTransit(ctx, s)
+		if err != nil {
+			return false, err
+		}
+		if err := transitDestroy(ctx, token, wrapped); err != nil {
+			return false, fmt.Errorf("cannot delete the transit key of %s: %v", name, err)
+		}
+		if err := s.Delete(ctx, transitDataKeyStoragePath(name)); err != nil {
+			return false, err
+		}
+	}
+	entry, err := s.Get(ctx, dekStoragePath(name))
+	if err != nil || entry == nil {
+		return false, err
+	}
+	return true, s.Delete(ctx, dekStoragePath(name))
+}
+
+// sealEnvelope returns the copy of an account that is stored: its key
+// material moved into an envelope under the account's data key
+func (b *PluginBackend) sealEnvelope(ctx context.Context, s logical.Storage, name string, accountJSON *AccountJSON) (*AccountJSON, error) {
+	dek, err := b.dataKey(ctx, s, name)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(dek)
+	secrets, err := json.Marshal(&accountSecrets{
+		Mnemonic:       accountJSON.Mnemonic,
+		SealedMnemonic: accountJSON.SealedMnemonic,
+		PrivateKey:     accountJSON.PrivateKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(secrets)
+	envelope, err := gcmSeal(dek, secrets, []byte(name))
+	if err != nil {
+		return nil, err
+	}
+	stored := *accountJSON
+	stored.Mnemonic = Empty
+	stored.SealedMnemonic = Empty
+	stored.PrivateKey = Empty
+	stored.Envelope = hexutil.Encode(envelope)
+	return &stored, nil
+}
+
+// openEnvelope restores the key material of an account from its envelope
+func openEnvelope(ctx context.Context, s logical.Storage, name string, accountJSON *AccountJSON) error {
+	if accountJSON.Envelope == Empty {
+		return nil
+	}
+	dek, err := readDataKey(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	if dek == nil {
+		return fmt.Errorf("%w: the data key of %s is missing", ErrKeystoreDecrypt, name)
+	}
+	defer util.ZeroBytes(dek)
+	envelope, err := hexutil.Decode(accountJSON.Envelope)
+	if err != nil {
+		return wrapError(ErrKeystoreDecrypt, err)
+	}
+	secretsJSON, err := gcmOpen(dek, envelope, []byte(name))
+	if err != nil {
+		return wrapError(ErrKeystoreDecrypt, err)
+	}
+	defer util.ZeroBytes(secretsJSON)
+	var secrets accountSecrets
+	if err := json.Unmarshal(secretsJSON, &secrets); err != nil {
+		return err
+	}
+	accountJSON.Mnemonic = secrets.Mnemonic
+	accountJSON.SealedMnemonic = secrets.SealedMnemonic
+	accountJSON.PrivateKey = secrets.PrivateKey
+	accountJSON.Envelope = Empty
+	return nil
+}
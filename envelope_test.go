@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+// fakeTransit answers the transit calls of the envelopes, keeping each
+// plaintext under the key it was encrypted with
+type fakeTransit struct {
+	sync.Mutex
+	keys map[string]map[string]string
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/transit/"), "/")
+	answer := map[string]interface{}{}
+	switch {
+	case parts[0] == "keys" && len(parts) == 2 && r.Method == http.MethodPost:
+		if f.keys[parts[1]] == nil {
+			f.keys[parts[1]] = map[string]string{}
+		}
+	case parts[0] == "keys" && len(parts) == 3:
+	case parts[0] == "keys" && r.Method == http.MethodDelete:
+		delete(f.keys, parts[1])
+	case parts[0] == "encrypt" && f.keys[parts[1]] != nil:
+		ciphertext := "vault:v1:" + uuid.New()
+		f.keys[parts[1]][ciphertext] = body["plaintext"].(string)
+		answer["ciphertext"] = ciphertext
+	case parts[0] == "decrypt" && f.keys[parts[1]] != nil:
+		answer["plaintext"] = f.keys[parts[1]][body["ciphertext"].(string)]
+	default:
+		http.Error(w, `{"errors":["no such key"]}`, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": answer})
+}
+
+func TestDestroyShredsBackups(t *testing.T) {
+	ctx := context.Background()
+	transit := httptest.NewServer(&fakeTransit{keys: map[string]map[string]string{}})
+	defer transit.Close()
+	b, storage := newTestBackend(t)
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"rpc_url":              "http://127.0.0.1:1",
+			"chain_id":             "3",
+			"envelope_transit_url": transit.URL + "/v1/transit",
+		},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("config: %v %v", err, resp)
+	}
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "accounts/shredded",
+		Storage:   storage,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("create: %v %v", err, resp)
+	}
+
+	// a backup of the storage, taken before the account is destroyed
+	backup := &logical.InmemStorage{}
+	keys, err := logical.CollectKeys(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		entry, err := storage.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := backup.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := readAccount(ctx, &logical.Request{Storage: backup}, "shredded"); err != nil {
+		t.Fatalf("the backup does not restore the account before it is destroyed: %v", err)
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "backup/bundle",
+		Storage:   storage,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bundle: %v %v", err, resp)
+	}
+	bundle := resp.Data["bundle"].(string)
+	if status := verifyBundle(t, b, storage, bundle); status != backupOK {
+		t.Fatalf("the bundle verified as %s before the account was destroyed", status)
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "accounts/shredded/destroy",
+		Storage:   storage,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("destroy: %v %v", err, resp)
+	}
+	if len(resp.Warnings) > 0 {
+		t.Fatalf("destroying an account wrapped under transit warned: %v", resp.Warnings)
+	}
+	if _, err := readAccount(ctx, &logical.Request{Storage: backup}, "shredded"); !errors.Is(err, ErrKeystoreDecrypt) {
+		t.Fatalf("the backup restored a destroyed account: %v", err)
+	}
+	if status := verifyBundle(t, b, storage, bundle); status != backupDestroyedSince {
+		t.Fatalf("a bundle taken before the account was destroyed verified as %s", status)
+	}
+}
+
+// verifyBundle returns the status backup/verify gives the one account of a bundle
+func verifyBundle(t *testing.T, b *PluginBackend, storage logical.Storage, bundle string) interface{} {
+	t.Helper()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "backup/verify",
+		Storage:   storage,
+		Data:      map[string]interface{}{"bundle": bundle},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("verify: %v %v", err, resp)
+	}
+	accounts := resp.Data["accounts"].([]map[string]interface{})
+	if len(accounts) != 1 {
+		t.Fatalf("the bundle holds %d accounts", len(accounts))
+	}
+	return accounts[0]["status"]
+}
@@ -0,0 +1,173 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// ErrCodeInternal is reported for errors outside of the taxonomy
+	ErrCodeInternal string = "internal"
+)
+
+var (
+	// ErrNotConfigured is returned when the mount has no configuration
+	ErrNotConfigured = errors.New("the plugin has not been configured yet")
+	// ErrAccountNotFound is returned when the named account does not exist
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrAccountExists is returned when an account or its key is already managed
+	ErrAccountExists = errors.New("account already exists")
+	// ErrInvalidInput is returned when a request parameter cannot be parsed
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrInvalidAddress is returned when an address fails validation
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrInvalidChainID is returned when the configured chain ID is unusable
+	ErrInvalidChainID = errors.New("invalid chain ID")
+	// ErrPolicyViolation is returned when inclusions/exclusions reject a destination
+	ErrPolicyViolation = errors.New("policy violation")
+	// ErrSourceUnauthorized is returned when CIDR restrictions reject the caller
+	ErrSourceUnauthorized = errors.New("source unauthorized")
+	// ErrRPCUnavailable is returned when the RPC node cannot be reached
+	ErrRPCUnavailable = errors.New("rpc unavailable")
+	// ErrNonceConflict is returned when the node rejects a transaction nonce
+	ErrNonceConflict = errors.New("nonce conflict")
+	// ErrKeystoreDecrypt is returned when a keystore cannot be decrypted
+	ErrKeystoreDecrypt = errors.New("keystore decryption failed")
+	// ErrApprovalRequired is returned when an operation lacks a valid approval
+	ErrApprovalRequired = errors.New("approval required")
+	// ErrMFARequired is returned when a transaction needs a step-up the request did not pass
+	ErrMFARequired = errors.New("mfa required")
+	// ErrPolicyUnavailable is returned when the policy hook cannot answer, so nothing is signed
+	ErrPolicyUnavailable = errors.New("policy hook unavailable")
+	// ErrScreeningUnavailable is returned when the screening API cannot answer, so nothing is signed
+	ErrScreeningUnavailable = errors.New("screening unavailable")
+	// ErrPriceUnavailable is returned when a USD limit applies but no fresh price is known
+	ErrPriceUnavailable = errors.New("price unavailable")
+	// ErrFrozen is returned for signing and exports while the mount is frozen
+	ErrFrozen = errors.New("the mount is frozen")
+	// ErrGroupFrozen is returned for signing while a group of the account is frozen
+	ErrGroupFrozen = errors.New("the group is frozen")
+	// ErrAccountFrozen is returned for signing while an anomaly has the account frozen
+	ErrAccountFrozen = errors.New("the account is frozen")
+	// ErrRateLimited is returned when an operation is repeated sooner than it may be
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// errorCodes maps each sentinel error to its machine-readable code
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrNotConfigured, "not_configured"},
+	{ErrAccountNotFound, "account_not_found"},
+	{ErrAccountExists, "account_exists"},
+	{ErrInvalidInput, "invalid_input"},
+	{ErrInvalidAddress, "invalid_address"},
+	{ErrInvalidChainID, "invalid_chain_id"},
+	{ErrPolicyViolation, "policy_violation"},
+	{ErrSourceUnauthorized, "source_unauthorized"},
+	{ErrRPCUnavailable, "rpc_unavailable"},
+	{ErrNonceConflict, "nonce_conflict"},
+	{ErrKeystoreDecrypt, "keystore_decrypt"},
+	{ErrApprovalRequired, "approval_required"},
+	{ErrMFARequired, "mfa_required"},
+	{ErrPolicyUnavailable, "policy_unavailable"},
+	{ErrScreeningUnavailable, "screening_unavailable"},
+	{ErrPriceUnavailable, "price_unavailable"},
+	{ErrFrozen, "frozen"},
+	{ErrGroupFrozen, "frozen"},
+	{ErrAccountFrozen, "frozen"},
+	{ErrRateLimited, "rate_limited"},
+}
+
+// ErrorCode returns the machine-readable code for an error
+func ErrorCode(err error) string {
+	for _, entry := range errorCodes {
+		if errors.Is(err, entry.err) {
+			return entry.code
+		}
+	}
+	return ErrCodeInternal
+}
+
+// classifySendError maps node rejections to the error taxonomy. A node
+// answers "already known" or "known transaction" only for a transaction of
+// the same hash that it already holds: the transaction was broadcast, and it
+// is not an error.
+func classifySendError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if isAlreadyKnown(err.Error()) {
+		return nil
+	}
+	message := strings.ToLower(err.Error())
+	for _, hint := range []string{"nonce too low", "nonce too high", "replacement transaction underpriced"} {
+		if strings.Contains(message, hint) {
+			return wrapError(ErrNonceConflict, err)
+		}
+	}
+	return err
+}
+
+// wrapError attaches a sentinel error to an underlying cause
+func wrapError(sentinel, cause error) error {
+	return &codedError{sentinel: sentinel, cause: cause}
+}
+
+type codedError struct {
+	sentinel error
+	cause    error
+}
+
+func (e *codedError) Error() string {
+	return e.sentinel.Error() + ": " + e.cause.Error()
+}
+
+func (e *codedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *codedError) Unwrap() error {
+	return e.cause
+}
+
+// withErrorCodes surfaces taxonomy errors as a 400 response carrying an error_code field
+func withErrorCodes(callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		resp, err := callback(ctx, req, data)
+		if err == nil {
+			return resp, nil
+		}
+		code := ErrorCode(err)
+		if code == ErrCodeInternal {
+			return resp, err
+		}
+		errResp := logical.ErrorResponse(err.Error())
+		errResp.Data["error_code"] = code
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrRateLimited) {
+			status = http.StatusTooManyRequests
+		}
+		return logical.RespondWithStatusCode(errResp, req, status)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// withSigningGuards wraps every operation that signs with, or exports, the
+// key of an account. Each guard is a step: the mount and group freezes, the
+// anomaly freeze, the canary alert, the restrictions and the tier of the
+// account. The transaction policies run later, in checkTransaction, on what
+// the operation is about to sign.
+func (b *PluginBackend) withSigningGuards(callback framework.OperationFunc) framework.OperationFunc {
+	return b.unlessFrozen(func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+		markSigning(ctx, name)
+		ctx = withSigningScope(ctx, req, name)
+		if err := noteMemo(ctx, data); err != nil {
+			return nil, err
+		}
+		travelRule, err := parseTravelRule(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkGroupFreeze(ctx, req.Storage, name); err != nil {
+			return nil, err
+		}
+		if err := checkAnomalyFreeze(ctx, req.Storage, name); err != nil {
+			return nil, err
+		}
+		canary, err := b.alertCanary(ctx, req, name)
+		if err != nil {
+			return nil, err
+		}
+		var resp *logical.Response
+		ctx, err = b.withBroadcast(ctx, req, name)
+		if err == nil {
+			err = b.checkRestrictions(ctx, req, name)
+		}
+		if err == nil {
+			err = b.checkTier(ctx, req, name)
+		}
+		if err == nil {
+			resp, err = callback(ctx, req, data)
+		}
+		if settleErr := settleAuthorization(ctx, err == nil); settleErr != nil {
+			b.Logger().Error("cannot mark the authorization of a signed request used", "account", name, "error", settleErr)
+			if resp != nil {
+				resp.AddWarning("the authorization of this request was not marked used: " + settleErr.Error())
+			}
+		}
+		if err == nil {
+			b.learnAnomalies(ctx, req, name)
+			if canary == nil {
+				b.shadowSign(ctx, req, data, resp)
+			}
+			// the transaction is signed; without its record the transfer cannot be reported
+			if recordErr := b.recordTravelRule(ctx, req, name, travelRule, resp); recordErr != nil {
+				b.Logger().Error("cannot record travel-rule metadata", "account", name, "transaction_hash", resp.Data["transaction_hash"], "error", recordErr)
+				resp.AddWarning("the travel-rule metadata of this transaction was not recorded: " + recordErr.Error())
+			}
+		}
+		b.recordActivity(ctx, req, name, &ActivityJSON{Event: activityEvent(req.Path, name)}, resp, err)
+		return resp, err
+	})
+}
+
+// keyPolicies returns the transaction policies a config sets that keys/
+// cannot enforce: they price, decode or learn Core transactions, and keys
+// sign those of other chains
+func keyPolicies(config *ConfigJSON) []string {
+	set := []string{}
+	for policy, on := range map[string]bool{
+		"control_group_min_amount": config.ControlGroupMinAmount != Empty,
+		"control_group_min_usd":    config.ControlGroupMinUSD != Empty,
+		"mfa_method":               config.MFAMethod != Empty,
+		"max_usd_per_tx":           config.MaxUSDPerTx != Empty,
+		"daily_usd_limit":          config.DailyUSDLimit != Empty,
+		"anomaly_rules":            len(config.AnomalyRules) > 0,
+		"calldata_rules":           len(config.CalldataRules) > 0,
+		"policy_hook_url":          config.PolicyHookURL != Empty,
+	} {
+		if on {
+			set = append(set, policy)
+		}
+	}
+	sort.Strings(set)
+	return set
+}
+
+// withKeyGuards wraps every operation that signs with a key of keys/. A key
+// has no account, so no tier, restriction, group or canary holds it; the
+// mount freeze does, and the operation screens what it signs. A key signs
+// nothing while the config sets a policy it cannot enforce.
+func (b *PluginBackend) withKeyGuards(callback framework.OperationFunc) framework.OperationFunc {
+	return b.unlessFrozen(func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		// key names share the decision log with accounts, whose names have no slash
+		markSigning(ctx, "keys/"+data.Get("name").(string))
+		config, err := b.configured(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if set := keyPolicies(config); len(set) > 0 {
+			err = fmt.Errorf("%w: keys cannot sign while the config sets %s, which only accounts enforce", ErrPolicyViolation, strings.Join(set, ", "))
+			recordRule(ctx, "key_policies", err)
+			return nil, err
+		}
+		return callback(ctx, req, data)
+	})
+}
@@ -0,0 +1,298 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/rpc"
+	"github.com/core-coin/go-core/xcbclient"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// headWatcher follows the head of a chain over a newHeads subscription and
+// refreshes the chain's unconfirmed transactions on every new block, in
+// place of the periodic poll
+type headWatcher struct {
+	sync.Mutex
+	chain  string
+	url    string
+	cancel context.CancelFunc
+	done   chan struct{}
+	// config is the chain's config as the periodic function last read it
+	config *ConfigJSON
+	// pending are the hashes of the unconfirmed transactions of the chain
+	pending  map[string]bool
+	head     uint64
+	headHash string
+	headAt   time.Time
+	err      string
+}
+
+// headWatchers holds a watcher for every chain with a WebSocket or IPC endpoint
+type headWatchers struct {
+	sync.Mutex
+	watchers map[string]*headWatcher
+}
+
+func newHeadWatchers() *headWatchers {
+	return &headWatchers{watchers: make(map[string]*headWatcher)}
+}
+
+// running reports whether the watcher is still subscribed
+func (w *headWatcher) running() bool {
+	select {
+	case <-w.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// follow hands an unconfirmed transaction to the watcher of its chain, and
+// reports whether there is one to take it
+func (h *headWatchers) follow(chain string, hash string) bool {
+	h.Lock()
+	w, ok := h.watchers[chain]
+	h.Unlock()
+	if !ok || !w.running() {
+		return false
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.pending[hash] = true
+	return true
+}
+
+// stop ends the subscriptions of the chains keep does not name, or all of
+// them if keep is nil
+func (h *headWatchers) stop(keep map[string]string) {
+	h.Lock()
+	defer h.Unlock()
+	for chain, w := range h.watchers {
+		if url, ok := keep[chain]; ok && url == w.url && w.running() {
+			continue
+		}
+		w.cancel()
+		delete(h.watchers, chain)
+	}
+}
+
+func (h *headWatchers) status() []map[string]interface{} {
+	h.Lock()
+	defer h.Unlock()
+	chains := make([]string, 0, len(h.watchers))
+	for chain := range h.watchers {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+	result := []map[string]interface{}{}
+	for _, chain := range chains {
+		w := h.watchers[chain]
+		w.Lock()
+		transport, _ := rpcTransportOf(w.url)
+		entry := map[string]interface{}{
+			"chain":      chain,
+			"url":        w.url,
+			"transport":  transport,
+			"subscribed": w.running(),
+			"pending":    len(w.pending),
+			"head":       w.head,
+			"head_hash":  w.headHash,
+			"last_error": w.err,
+		}
+		if !w.headAt.IsZero() {
+			entry["head_at"] = w.headAt.UTC().Format(time.RFC3339)
+		}
+		w.Unlock()
+		result = append(result, entry)
+	}
+	return result
+}
+
+// headURL returns the first WebSocket or IPC endpoint of a config whose
+// circuit is not open
+func (b *PluginBackend) headURL(config *ConfigJSON) string {
+	for _, url := range b.rpcRegistry.order(config.rpcURLs(), StrategyPriority) {
+		if transport, err := rpcTransportOf(url); err == nil && transport != TransportHTTP && b.rpcRegistry.available(url) {
+			return url
+		}
+	}
+	return Empty
+}
+
+// watchHeads is run periodically; it subscribes to the heads of every chain
+// that has a WebSocket or IPC endpoint, and resubscribes those whose
+// subscription dropped or whose endpoints changed
+func (b *PluginBackend) watchHeads(ctx context.Context, req *logical.Request) error {
+	config, err := b.readConfig(ctx, req.Storage)
+	if errors.Is(err, ErrNotConfigured) {
+		b.headWatchers.stop(nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	configs := map[string]*ConfigJSON{Empty: config}
+	names, err := req.Storage.List(ctx, QualifiedPath("chains/"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		chain, err := readChain(ctx, req.Storage, name)
+		if err != nil {
+			return err
+		}
+		if chain == nil {
+			continue
+		}
+		if configs[name], err = b.readConfig(withChain(ctx, name, chain), req.Storage); err != nil {
+			return err
+		}
+	}
+	keep := map[string]string{}
+	for chain, config := range configs {
+		if url := b.headURL(config); url != Empty {
+			keep[chain] = url
+		}
+	}
+	b.headWatchers.stop(keep)
+
+	b.headWatchers.Lock()
+	defer b.headWatchers.Unlock()
+	for chain, url := range keep {
+		if w, ok := b.headWatchers.watchers[chain]; ok {
+			w.Lock()
+			w.config = configs[chain]
+			w.Unlock()
+			continue
+		}
+		// the subscription outlives this request, so it is not canceled with it
+		watchCtx, cancel := context.WithCancel(context.Background())
+		w := &headWatcher{
+			chain:   chain,
+			url:     url,
+			cancel:  cancel,
+			done:    make(chan struct{}),
+			config:  configs[chain],
+			pending: map[string]bool{},
+		}
+		b.headWatchers.watchers[chain] = w
+		go b.followHeads(watchCtx, req.Storage, w, configs[chain])
+	}
+	return nil
+}
+
+// followHeads subscribes to newHeads and refreshes the pending transactions
+// of the watcher's chain on every head, until the subscription drops or the
+// watcher is stopped
+func (b *PluginBackend) followHeads(ctx context.Context, s logical.Storage, w *headWatcher, config *ConfigJSON) {
+	defer close(w.done)
+	fail := func(err error) {
+		w.Lock()
+		w.err = err.Error()
+		w.Unlock()
+		if ctx.Err() == nil {
+			b.rpcRegistry.recordFailure(w.url, err, config.circuitThreshold(), time.Duration(config.circuitCooldown())*time.Second)
+			b.Logger().Warn("the newHeads subscription dropped; transactions are polled until it is resubscribed", "chain", w.chain, "url", w.url, "error", err)
+		}
+	}
+	client, err := dialPersistentRPC(ctx, w.url, time.Duration(config.rpcTimeout())*time.Second)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer client.Close()
+	heads := make(chan *types.Header, 16)
+	subscription, err := xcbclient.NewClient(client).SubscribeNewHead(ctx, heads)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer subscription.Unsubscribe()
+	b.rpcRegistry.recordSuccess(w.url)
+	b.Logger().Debug("subscribed to newHeads", "chain", w.chain, "url", w.url)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-subscription.Err():
+			if err == nil {
+				err = errors.New("the node ended the subscription")
+			}
+			fail(err)
+			return
+		case head := <-heads:
+			w.Lock()
+			w.head, w.headHash, w.headAt = head.Number.Uint64(), head.Hash().Hex(), time.Now()
+			w.Unlock()
+			if err := b.refreshPending(ctx, s, w, client); err != nil && ctx.Err() == nil {
+				b.Logger().Warn("cannot refresh transactions on a new head", "chain", w.chain, "head", head.Number, "error", err)
+			}
+		}
+	}
+}
+
+// refreshPending refreshes the transactions the watcher follows, and stops
+// following those that are confirmed
+func (b *PluginBackend) refreshPending(ctx context.Context, s logical.Storage, w *headWatcher, client *rpc.Client) error {
+	w.Lock()
+	config := w.config
+	hashes := make([]string, 0, len(w.pending))
+	for hash := range w.pending {
+		hashes = append(hashes, hash)
+	}
+	w.Unlock()
+	sort.Strings(hashes)
+	var done []string
+	defer func() {
+		w.Lock()
+		for _, hash := range done {
+			delete(w.pending, hash)
+		}
+		w.Unlock()
+	}()
+	for _, hash := range hashes {
+		tx, err := readTx(ctx, s, common.HexToHash(hash))
+		if err != nil {
+			if errors.Is(err, ErrInvalidInput) {
+				// no longer tracked
+				done = append(done, hash)
+				continue
+			}
+			return err
+		}
+		if tx.Status == txConfirmed {
+			done = append(done, hash)
+			continue
+		}
+		if err := refreshTx(ctx, config, client, tx); err != nil {
+			return err
+		}
+		if err := writeTx(ctx, s, tx); err != nil {
+			return err
+		}
+		if tx.Status == txConfirmed {
+			done = append(done, hash)
+		}
+	}
+	return nil
+}
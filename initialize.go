@@ -0,0 +1,304 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryptohub-digital/vault-core/util"
+
+	"github.com/core-coin/go-core/accounts/keystore"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// InitStep reports one step of the initialization of the mount
+type InitStep struct {
+	Name     string
+	Duration time.Duration
+	Skipped  string
+	Error    string
+	Details  map[string]interface{}
+	// retried steps are done again by the requests that need them, so their
+	// failure does not make the mount unhealthy
+	retried bool
+}
+
+func (step *InitStep) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"name":     step.Name,
+		"ok":       step.Error == Empty,
+		"duration": step.Duration.String(),
+	}
+	if step.Skipped != Empty {
+		result["skipped"] = step.Skipped
+	}
+	if step.Error != Empty {
+		result["error"] = step.Error
+	}
+	for k, v := range step.Details {
+		result[k] = v
+	}
+	return result
+}
+
+// initStatus is what the last initialization of the mount did, for health
+type initStatus struct {
+	sync.RWMutex
+	started  time.Time
+	finished time.Time
+	steps    []*InitStep
+}
+
+func (status *initStatus) record(step *InitStep) {
+	status.Lock()
+	defer status.Unlock()
+	status.steps = append(status.steps, step)
+}
+
+// report returns the steps of the last initialization and whether all succeeded
+func (status *initStatus) report() (map[string]interface{}, bool) {
+	status.RLock()
+	defer status.RUnlock()
+	if status.started.IsZero() {
+		return map[string]interface{}{"done": false}, true
+	}
+	ok := true
+	steps := []map[string]interface{}{}
+	for _, step := range status.steps {
+		ok = ok && (step.Error == Empty || step.retried)
+		steps = append(steps, step.responseData())
+	}
+	result := map[string]interface{}{
+		"started": status.started.UTC().Format(time.RFC3339),
+		"done":    !status.finished.IsZero(),
+		"steps":   steps,
+	}
+	if !status.finished.IsZero() {
+		result["duration"] = status.finished.Sub(status.started).String()
+	}
+	return result, ok
+}
+
+// initialize is run by Vault once the mount is set up, before it serves
+// requests. It does up front what the first requests would otherwise wait
+// for: it migrates storage, validates the config, builds the account index,
+// benchmarks the key derivation functions and connects to the RPC endpoints.
+// Only a failed migration fails the mount; the other steps are reported by
+// the health endpoint, and those that requests do anyway are left for them
+// to retry.
+func (b *PluginBackend) initialize(ctx context.Context, ireq *logical.InitializationRequest) error {
+	if ireq.Storage == nil {
+		return nil
+	}
+	b.initStatus.Lock()
+	b.initStatus.started = time.Now()
+	b.initStatus.finished = time.Time{}
+	b.initStatus.steps = nil
+	b.initStatus.Unlock()
+	defer func() {
+		b.initStatus.Lock()
+		b.initStatus.finished = time.Now()
+		b.initStatus.Unlock()
+	}()
+	req := backgroundRequest(ireq.Storage, "initialize")
+
+	if err := b.initStep("migrate", func(step *InitStep) error {
+		if b.replicaOnly() {
+			step.Skipped = "replicated from the primary"
+			return nil
+		}
+		steps, err := b.migrate(ctx, req.Storage, false)
+		step.Details = map[string]interface{}{"migrations": len(steps)}
+		if isReadOnly(err) {
+			// a standby or performance secondary leaves migrations to the active node
+			step.Skipped = "read only"
+			return nil
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	var config *ConfigJSON
+	b.initStep("config", func(step *InitStep) error {
+		var err error
+		config, err = b.readConfig(ctx, req.Storage)
+		if errors.Is(err, ErrNotConfigured) {
+			step.Skipped = "not configured"
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.applyLogConfig(config)
+		return validateStoredConfig(config)
+	})
+
+	b.initStep("account_index", func(step *InitStep) error {
+		step.retried = true
+		if err := b.accountIndex.build(ctx, req); err != nil {
+			return err
+		}
+		b.accountIndex.RLock()
+		step.Details = map[string]interface{}{"accounts": len(b.accountIndex.names)}
+		b.accountIndex.RUnlock()
+		return nil
+	})
+
+	b.initStep("kdf_benchmark", func(step *InitStep) error {
+		step.Details = benchmarkKDFs(config)
+		return nil
+	})
+
+	if config == nil {
+		return nil
+	}
+	b.initStep("rpc", func(step *InitStep) error {
+		step.retried = true
+		step.Details = b.checkRPC(ctx, config)
+		delete(step.Details, "ok")
+		delete(step.Details, "duration")
+		if message, ok := step.Details["error"].(string); ok {
+			delete(step.Details, "error")
+			return errors.New(message)
+		}
+		return nil
+	})
+	if config.DecisionLogHMAC {
+		b.initStep("decision_log_key", func(step *InitStep) error {
+			step.retried = true
+			_, err := b.decisionLog.chainKey(ctx, req.Storage)
+			if isReadOnly(err) {
+				step.Skipped = "read only"
+				return nil
+			}
+			return err
+		})
+	}
+	return nil
+}
+
+// initStep runs and records one step of initialize
+func (b *PluginBackend) initStep(name string, fn func(step *InitStep) error) error {
+	step := &InitStep{Name: name}
+	start := time.Now()
+	err := fn(step)
+	step.Duration = time.Since(start)
+	level := hclog.Debug
+	if err != nil {
+		step.Error = err.Error()
+		level = hclog.Warn
+	}
+	b.initStatus.record(step)
+	b.Logger().Log(level, "initialized", "step", name, "duration", step.Duration.String(), "skipped", step.Skipped, "error", step.Error)
+	return err
+}
+
+// isReadOnly reports whether err is the refusal of a standby or secondary to write
+func isReadOnly(err error) bool {
+	return err != nil && (errors.Is(err, logical.ErrReadOnly) || strings.Contains(err.Error(), logical.ErrReadOnly.Error()))
+}
+
+// benchmarkKDFs times the key derivation of a signing request, which
+// stretches a mnemonic into a seed, and that of a keystore export with the
+// keystore_kdf of the config, if there is one
+func benchmarkKDFs(config *ConfigJSON) map[string]interface{} {
+	start := time.Now()
+	bip39.NewSeed(healthMnemonic, Empty)
+	seed := time.Since(start)
+
+	var err error
+	var kdf string
+	start = time.Now()
+	if config != nil && config.keystoreKDF() == util.KDFArgon2id {
+		params := config.argon2idParams()
+		argon2.IDKey([]byte(healthMnemonic), make([]byte, 32), params.Time, params.Memory, params.Threads, 32)
+		kdf = fmt.Sprintf("argon2id t=%d m=%d p=%d", params.Time, params.Memory, params.Threads)
+	} else {
+		_, err = scrypt.Key([]byte(healthMnemonic), make([]byte, 32), keystore.StandardScryptN, 8, keystore.StandardScryptP, 32)
+		kdf = fmt.Sprintf("scrypt n=%d r=8 p=%d", keystore.StandardScryptN, keystore.StandardScryptP)
+	}
+	keystoreKDF := time.Since(start)
+	result := map[string]interface{}{
+		"seed":         seed.String(),
+		"keystore":     keystoreKDF.String(),
+		"keystore_kdf": kdf,
+	}
+	if err != nil {
+		result["keystore_error"] = err.Error()
+	}
+	return result
+}
+
+// validateStoredConfig checks the stored config against the rules config
+// writes enforce, which may have changed since it was written
+func validateStoredConfig(config *ConfigJSON) error {
+	var problems []string
+	if strategy := config.rpcStrategy(); strategy != StrategyPriority && strategy != StrategyRoundRobin {
+		problems = append(problems, fmt.Sprintf("unknown rpc_strategy %s", strategy))
+	}
+	if len(config.rpcURLs()) == 0 {
+		problems = append(problems, "no RPC endpoint configured")
+	}
+	for _, rpcURL := range config.rpcURLs() {
+		if _, err := url.Parse(rpcURL); err != nil {
+			problems = append(problems, fmt.Sprintf("rpc_url %s: %v", rpcURL, err))
+		}
+	}
+	if config.LogLevel != Empty && hclog.LevelFromString(config.LogLevel) == hclog.NoLevel {
+		problems = append(problems, fmt.Sprintf("unknown log_level %s", config.LogLevel))
+	}
+	for _, pattern := range config.LogRedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("log_redact_patterns: %v", err))
+		}
+	}
+	if _, err := parseCalldataRules(config.CalldataRules); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if kdf := config.keystoreKDF(); kdf != util.KDFScrypt && kdf != util.KDFArgon2id {
+		problems = append(problems, fmt.Sprintf("unknown keystore_kdf %s", kdf))
+	}
+	if err := config.argon2idParams().Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := parseUSDLimit("max_usd_per_tx", config.MaxUSDPerTx); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := parseUSDLimit("daily_usd_limit", config.DailyUSDLimit); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := normalizeUSDPrices(config.USDPrices, config.LowercaseAddressesOnly); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := parseCron(config.inventoryPushCron()); err != nil {
+		problems = append(problems, fmt.Sprintf("inventory_push_cron: %v", err))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidInput, strings.Join(problems, "; "))
+	}
+	return nil
+}
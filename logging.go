@@ -0,0 +1,276 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/core-coin/go-core/crypto"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// redacted replaces the value of a sensitive field in the logs
+const redacted string = "[redacted]"
+
+// sensitiveFields are request fields whose values are never logged; a field
+// is sensitive when its name contains one of them
+var sensitiveFields = []string{
+	"mnemonic",
+	"passphrase",
+	"private_key",
+	"keystore",
+	"seed",
+	"secret",
+	"shares",
+}
+
+// sensitiveField reports whether the value of a field must not be logged
+func sensitiveField(key string) bool {
+	for _, sensitive := range sensitiveFields {
+		if strings.Contains(strings.ToLower(key), sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns a copy of request data that is safe to log
+func redact(data map[string]interface{}) map[string]interface{} {
+	safe := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		safe[key] = value
+		if sensitiveField(key) {
+			safe[key] = redacted
+		}
+	}
+	return safe
+}
+
+// requestLogger returns a logger that tags every line with the request it belongs to
+func (b *PluginBackend) requestLogger(req *logical.Request) hclog.Logger {
+	return b.Logger().With("request_id", req.ID, "operation", string(req.Operation), "path", req.Path)
+}
+
+type requestIDKey struct{}
+
+// withRequestID carries the Vault request ID to the RPC calls made for the request
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// traceParent returns a W3C traceparent header whose trace ID is the Vault
+// request ID, with a new span for every call. Vault request IDs are UUIDs;
+// anything else is hashed into a trace ID.
+func traceParent(requestID string) string {
+	traceID := strings.ReplaceAll(requestID, "-", "")
+	if _, err := hex.DecodeString(traceID); err != nil || len(traceID) != 32 {
+		traceID = hex.EncodeToString(crypto.SHA3([]byte(requestID))[:16])
+	}
+	spanID := make([]byte, 8)
+	rand.Read(spanID)
+	return fmt.Sprintf("00-%s-%s-01", strings.ToLower(traceID), hex.EncodeToString(spanID))
+}
+
+// withRequestLogging logs every operation and its outcome. Refusals from the
+// error taxonomy are expected and logged at info; anything else is an error.
+func (b *PluginBackend) withRequestLogging(callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		ctx = withRequestID(ctx, req.ID)
+		ctx, recorder := withDecisionRecorder(ctx)
+		ctx, timings := withRequestTimings(ctx)
+		storage := req.Storage
+		req.Storage = &timedStorage{Storage: storage, ctx: ctx}
+		defer func() { req.Storage = storage }()
+		logger := b.requestLogger(req)
+		if logger.IsTrace() {
+			logger.Trace("request", "data", redact(req.Data))
+		}
+		start := time.Now()
+		resp, err := callback(ctx, req, data)
+		duration := time.Since(start)
+		if threshold := time.Duration(atomic.LoadInt64(&b.slowRequestThreshold)); threshold > 0 && duration >= threshold {
+			count := atomic.AddUint64(&b.slowRequests, 1)
+			logger.Warn("slow request", append(timings.breakdown(duration), "slow_requests", count)...)
+		}
+		b.logDecision(ctx, req, recorder, err)
+		if err == nil {
+			logger.Debug("request handled", "duration", duration)
+			return resp, err
+		}
+		// an outage fails every request the same way; say so once per window
+		logged, suppressed := b.logSampler.allow(ErrorCode(err) + " " + err.Error())
+		if !logged {
+			return resp, err
+		}
+		if ErrorCode(err) == ErrCodeInternal {
+			logger.Error("request failed", "duration", duration, "error", err, "suppressed", suppressed)
+		} else {
+			logger.Info("request refused", "duration", duration, "error_code", ErrorCode(err), "error", err, "suppressed", suppressed)
+		}
+		return resp, err
+	}
+}
+
+// LogSampleWindow is how long identical failures are logged only once
+const LogSampleWindow = 30 * time.Second
+
+// logSampler rate limits identical log messages
+type logSampler struct {
+	sync.Mutex
+	window time.Duration
+	seen   map[string]*sampledMessage
+}
+
+type sampledMessage struct {
+	first      time.Time
+	suppressed int
+}
+
+func newLogSampler(window time.Duration) *logSampler {
+	return &logSampler{window: window, seen: map[string]*sampledMessage{}}
+}
+
+// allow reports whether a message is logged, and how many identical ones were
+// suppressed since it last was
+func (sampler *logSampler) allow(key string) (bool, int) {
+	sampler.Lock()
+	defer sampler.Unlock()
+	now := time.Now()
+	message, ok := sampler.seen[key]
+	if ok && now.Sub(message.first) < sampler.window {
+		message.suppressed++
+		return false, 0
+	}
+	suppressed := 0
+	if ok {
+		suppressed = message.suppressed
+	}
+	sampler.seen[key] = &sampledMessage{first: now}
+	return true, suppressed
+}
+
+// flush summarizes the messages whose window has passed and forgets them
+func (sampler *logSampler) flush(logger hclog.Logger) {
+	sampler.Lock()
+	defer sampler.Unlock()
+	now := time.Now()
+	for key, message := range sampler.seen {
+		if now.Sub(message.first) < sampler.window {
+			continue
+		}
+		if message.suppressed > 0 {
+			logger.Info(fmt.Sprintf("suppressed %d similar messages", message.suppressed), "message", key)
+		}
+		delete(sampler.seen, key)
+	}
+}
+
+// applyLogConfig sets the log level, the redaction patterns and the slow
+// request threshold of this mount from its config. An unset log_level leaves
+// the level as it is; the level Vault started the plugin with comes back when
+// the plugin is reloaded.
+func (b *PluginBackend) applyLogConfig(config *ConfigJSON) {
+	b.scrubber.setPatterns(config.LogRedactPatterns)
+	atomic.StoreInt64(&b.slowRequestThreshold, int64(time.Duration(config.SlowRequestThreshold)*time.Millisecond))
+	level := hclog.LevelFromString(config.LogLevel)
+	if level == hclog.NoLevel {
+		return
+	}
+	b.logLevelLock.Lock()
+	defer b.logLevelLock.Unlock()
+	if level != b.logLevel {
+		b.Logger().SetLevel(level)
+		b.logLevel = level
+	}
+}
+
+func logLevelPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("config/log-level"),
+			HelpSynopsis: "Change the log level of this mount at runtime.",
+			HelpDescription: `
+
+Set log_level without rewriting the rest of config. The new level applies at
+once to every log line of the mount, including those of requests already in
+flight. Vault does not pass signals on to plugins, so this endpoint takes the
+place of a SIGHUP.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"log_level": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{"trace", "debug", "info", "warn", "error"},
+					Description:   "The log level of this mount.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathLogLevelRead,
+				logical.UpdateOperation: b.pathLogLevelWrite,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathLogLevelRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"log_level": config.LogLevel,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathLogLevelWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	logLevel := strings.ToLower(data.Get("log_level").(string))
+	if level := hclog.LevelFromString(logLevel); level == hclog.NoLevel || level == hclog.Off {
+		return nil, fmt.Errorf("%w: unknown log_level %s", ErrInvalidInput, logLevel)
+	}
+	config.LogLevel = logLevel
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	b.applyLogConfig(config)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"log_level": config.LogLevel,
+		},
+	}, nil
+}
@@ -0,0 +1,348 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const schemaVersionStoragePath string = "schema/version"
+
+// migration upgrades the entries of one storage schema version to the next.
+// A migration must be safe to run again over entries it already upgraded, as
+// a run that is interrupted starts over.
+type migration struct {
+	version     int
+	description string
+	// run upgrades the entries that need it, or only counts them on a dry run
+	run func(ctx context.Context, b *PluginBackend, req *logical.Request, dryRun bool, step *MigrationStep) error
+}
+
+// migrations are applied in order; the last one's version is the schema
+// version this build writes
+var migrations = []migration{
+	{
+		version:     1,
+		description: "move the key material of accounts stored in the clear into envelopes",
+		run:         migrateAccountEnvelopes,
+	},
+	{
+		version:     2,
+		description: "record the address of every account and index it under addresses/",
+		run:         migrateAccountAddresses,
+	},
+	{
+		version:     3,
+		description: "rewrite the entries that hold key material so that seals which wrap entries wrap them",
+		run:         migrateSealWrap,
+	},
+}
+
+// SchemaVersion is the storage schema version this build of the plugin writes
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// MigrationStep reports the progress of one migration
+type MigrationStep struct {
+	Version     int
+	Description string
+	Scanned     int
+	Upgraded    int
+	Done        bool
+	Error       string
+}
+
+func (step *MigrationStep) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"version":     step.Version,
+		"description": step.Description,
+		"scanned":     step.Scanned,
+		"upgraded":    step.Upgraded,
+		"done":        step.Done,
+	}
+	if step.Error != Empty {
+		result["error"] = step.Error
+	}
+	return result
+}
+
+// migrationLock keeps a migration from running twice at once, as it would when
+// the migrations path is called while the mount initializes
+var migrationLock sync.Mutex
+
+func readSchemaVersion(ctx context.Context, s logical.Storage) (int, error) {
+	entry, err := s.Get(ctx, QualifiedPath(schemaVersionStoragePath))
+	if err != nil {
+		return 0, err
+	}
+	if entry == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(entry.Value))
+}
+
+func writeSchemaVersion(ctx context.Context, s logical.Storage, version int) error {
+	return s.Put(ctx, &logical.StorageEntry{Key: QualifiedPath(schemaVersionStoragePath), Value: []byte(strconv.Itoa(version))})
+}
+
+// migrate applies the migrations the storage has not had yet, in order, and
+// records the schema version after each. A dry run changes nothing and
+// reports what would be upgraded.
+func (b *PluginBackend) migrate(ctx context.Context, s logical.Storage, dryRun bool) ([]*MigrationStep, error) {
+	migrationLock.Lock()
+	defer migrationLock.Unlock()
+	current, err := readSchemaVersion(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if current > SchemaVersion() {
+		return nil, fmt.Errorf("the storage schema version %d is newer than the %d of this build of the plugin; upgrade the plugin", current, SchemaVersion())
+	}
+	req := &logical.Request{Storage: s, Operation: logical.UpdateOperation, Path: QualifiedPath("migrations")}
+	steps := []*MigrationStep{}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		step := &MigrationStep{Version: m.version, Description: m.description}
+		steps = append(steps, step)
+		b.Logger().Info("migrating storage", "version", m.version, "description", m.description, "dry_run", dryRun)
+		if err := m.run(ctx, b, req, dryRun, step); err != nil {
+			step.Error = err.Error()
+			return steps, fmt.Errorf("migration to storage schema version %d: %w", m.version, err)
+		}
+		if !dryRun {
+			if err := writeSchemaVersion(ctx, s, m.version); err != nil {
+				step.Error = err.Error()
+				return steps, err
+			}
+		}
+		step.Done = !dryRun
+		b.Logger().Info("migrated storage", "version", m.version, "scanned", step.Scanned, "upgraded", step.Upgraded, "dry_run", dryRun)
+	}
+	return steps, nil
+}
+
+// eachAccount calls fn with the stored form of every account, without
+// opening its envelope, and logs progress through large mounts
+func (b *PluginBackend) eachAccount(ctx context.Context, req *logical.Request, step *MigrationStep, fn func(name string, accountJSON *AccountJSON) error) error {
+	names, err := req.Storage.List(ctx, QualifiedPath("accounts/"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		entry, err := req.Storage.Get(ctx, QualifiedPath("accounts/"+name))
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		var accountJSON AccountJSON
+		if err := entry.DecodeJSON(&accountJSON); err != nil {
+			return fmt.Errorf("account %s: %v", name, err)
+		}
+		step.Scanned++
+		if err := fn(name, &accountJSON); err != nil {
+			return fmt.Errorf("account %s: %w", name, err)
+		}
+		if step.Scanned%100 == 0 {
+			b.Logger().Info("migrating storage", "version", step.Version, "scanned", step.Scanned, "of", len(names))
+		}
+	}
+	return nil
+}
+
+// migrateAccountEnvelopes seals the mnemonics of accounts written before
+// they were kept in envelopes
+func migrateAccountEnvelopes(ctx context.Context, b *PluginBackend, req *logical.Request, dryRun bool, step *MigrationStep) error {
+	return b.eachAccount(ctx, req, step, func(name string, accountJSON *AccountJSON) error {
+		if accountJSON.Destroyed || accountJSON.Envelope != Empty || (accountJSON.Mnemonic == Empty && accountJSON.SealedMnemonic == Empty && accountJSON.PrivateKey == Empty) {
+			return nil
+		}
+		step.Upgraded++
+		if dryRun {
+			return nil
+		}
+		return b.updateAccount(ctx, req, name, accountJSON)
+	})
+}
+
+// migrateAccountAddresses stores the address of accounts written before it
+// was kept with them, and indexes every account by its address
+func migrateAccountAddresses(ctx context.Context, b *PluginBackend, req *logical.Request, dryRun bool, step *MigrationStep) error {
+	return b.eachAccount(ctx, req, step, func(name string, accountJSON *AccountJSON) error {
+		if accountJSON.Destroyed {
+			return nil
+		}
+		stored := accountJSON.Address != Empty
+		if !stored {
+			if err := openEnvelope(ctx, req.Storage, name, accountJSON); err != nil {
+				return err
+			}
+		}
+		address, err := accountAddress(ctx, *accountJSON)
+		if err != nil {
+			return err
+		}
+		indexed, err := readAddressIndex(ctx, req, address)
+		if err != nil {
+			return err
+		}
+		if stored && indexed != Empty {
+			return nil
+		}
+		step.Upgraded++
+		if dryRun {
+			return nil
+		}
+		if !stored {
+			if err := b.updateAccount(ctx, req, name, accountJSON); err != nil {
+				return err
+			}
+		}
+		if indexed == Empty {
+			return b.indexAccount(ctx, req, address, name)
+		}
+		return nil
+	})
+}
+
+func migrationPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("migrations"),
+			HelpSynopsis: "Report or apply the storage migrations of the mount.",
+			HelpDescription: `
+
+The storage of a mount carries a schema version. When a newer build of the
+plugin is mounted, the migrations between the stored version and the one it
+writes are applied as the mount initializes. Reading this path reports the
+stored and current versions and the pending migrations. Writing it applies
+the pending migrations, or with dry_run only counts the entries they would
+upgrade.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"dry_run": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Only report what the pending migrations would upgrade.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathMigrationsRead,
+				logical.UpdateOperation: b.pathMigrationsWrite,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathMigrationsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	current, err := readSchemaVersion(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	pending := []map[string]interface{}{}
+	for _, m := range migrations {
+		if m.version > current {
+			pending = append(pending, map[string]interface{}{
+				"version":     m.version,
+				"description": m.description,
+			})
+		}
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"schema_version":        current,
+			"plugin_schema_version": SchemaVersion(),
+			"pending":               pending,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathMigrationsWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	dryRun := data.Get("dry_run").(bool)
+	steps, err := b.migrate(ctx, req.Storage, dryRun)
+	if err != nil && steps == nil {
+		return nil, err
+	}
+	report := []map[string]interface{}{}
+	for _, step := range steps {
+		report = append(report, step.responseData())
+	}
+	current, versionErr := readSchemaVersion(ctx, req.Storage)
+	if versionErr != nil {
+		return nil, versionErr
+	}
+	if err != nil {
+		// the steps that succeeded are kept; report them with the one that failed
+		resp := logical.ErrorResponse(err.Error())
+		resp.Data["schema_version"] = current
+		resp.Data["migrations"] = report
+		return resp, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"dry_run":        dryRun,
+			"schema_version": current,
+			"migrations":     report,
+		},
+	}, nil
+}
+
+// migrateSealWrap writes back every entry under the seal wrapped prefixes.
+// Vault wraps entries as they are written, so those written before their
+// prefix was seal wrapped, or before the seal could wrap, are only wrapped
+// once rewritten.
+func migrateSealWrap(ctx context.Context, b *PluginBackend, req *logical.Request, dryRun bool, step *MigrationStep) error {
+	for _, prefix := range SealWrappedPaths(b) {
+		view := logical.NewStorageView(req.Storage, prefix)
+		keys, err := logical.CollectKeys(ctx, view)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			entry, err := view.Get(ctx, key)
+			if err != nil {
+				return err
+			}
+			step.Scanned++
+			if entry == nil {
+				continue
+			}
+			step.Upgraded++
+			if dryRun {
+				continue
+			}
+			entry.SealWrap = true
+			if err := view.Put(ctx, entry); err != nil {
+				return fmt.Errorf("%s%s: %w", prefix, key, err)
+			}
+		}
+	}
+	return nil
+}
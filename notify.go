@@ -0,0 +1,91 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// notificationTimeout bounds the delivery of a notification
+const notificationTimeout = 10 * time.Second
+
+// Notification is a security event delivered to the configured webhook
+type Notification struct {
+	Event         string                 `json:"event"`
+	Time          time.Time              `json:"time"`
+	Path          string                 `json:"path"`
+	EntityID      string                 `json:"entity_id,omitempty"`
+	RemoteAddress string                 `json:"remote_address,omitempty"`
+	Memo          string                 `json:"memo,omitempty"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+}
+
+// notify logs a security event and delivers it to notification_webhook_url.
+// Delivery happens in the background so a slow or unreachable receiver never
+// delays or fails the request, and gives nothing away to the caller.
+func (b *PluginBackend) notify(config *ConfigJSON, req *logical.Request, event string, data map[string]interface{}) {
+	notification := &Notification{
+		Event:    event,
+		Time:     time.Now().UTC(),
+		Path:     req.Path,
+		EntityID: req.EntityID,
+		Data:     data,
+	}
+	if req.Connection != nil {
+		notification.RemoteAddress = req.Connection.RemoteAddr
+	}
+	if memo, ok := req.Data["memo"].(string); ok {
+		notification.Memo = memo
+	}
+	b.Logger().Warn("security event", "event", event, "request_id", req.ID, "path", req.Path, "entity_id", req.EntityID, "remote_address", notification.RemoteAddress)
+	if config.NotificationWebhookURL == Empty {
+		return
+	}
+	b.deliver(event, config.NotificationWebhookURL, notification)
+}
+
+// deliver posts a JSON body to a URL in the background, logging failures
+func (b *PluginBackend) deliver(event, url string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		b.Logger().Error("cannot encode notification", "event", event, "error", err)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		defer cancel()
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			b.Logger().Error("cannot deliver notification", "event", event, "error", err)
+			return
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			b.Logger().Error("cannot deliver notification", "event", event, "error", err)
+			return
+		}
+		response.Body.Close()
+		if response.StatusCode >= http.StatusMultipleChoices {
+			b.Logger().Error("notification rejected", "event", event, "status", response.StatusCode)
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const backendHelp = `
+The Core secrets engine manages HD wallet accounts and signs and broadcasts
+transactions and messages for them without the keys ever leaving Vault.
+
+Configure the RPC endpoints and chain through config, then create accounts
+under accounts/. Every account operation is also reachable through the
+account's address under addresses/.
+`
+
+// operationSummaries distinguishes the operations of paths that serve more than one
+var operationSummaries = map[string]map[logical.Operation]string{
+	QualifiedPath("config"): {
+		logical.ReadOperation:   "Read the configuration of this mount.",
+		logical.CreateOperation: "Configure this mount.",
+		logical.UpdateOperation: "Configure this mount.",
+	},
+	QualifiedPath("accounts/" + framework.GenericNameRegex("name")): {
+		logical.ReadOperation:   "Read an account.",
+		logical.CreateOperation: "Create an account from a generated or provided mnemonic.",
+		logical.UpdateOperation: "Update the settings of an account, or overwrite its key with force.",
+		logical.DeleteOperation: "Delete an account.",
+	},
+}
+
+// operationResponses returns the documented responses of an operation
+func operationResponses(operation logical.Operation) map[int][]framework.Response {
+	errorResponse := framework.Response{
+		Description: "The request was rejected; error_code identifies the cause.",
+		Example: &logical.Response{
+			Data: map[string]interface{}{
+				"error":      "invalid address: ...",
+				"error_code": ErrorCode(ErrInvalidAddress),
+			},
+		},
+	}
+	switch operation {
+	case logical.DeleteOperation:
+		return map[int][]framework.Response{
+			http.StatusNoContent:  {{Description: "The entry was deleted or did not exist."}},
+			http.StatusBadRequest: {errorResponse},
+		}
+	case logical.ListOperation:
+		return map[int][]framework.Response{
+			http.StatusOK: {{
+				Description: "The keys under this path.",
+				Example:     logical.ListResponse([]string{"..."}),
+			}},
+		}
+	}
+	return map[int][]framework.Response{
+		http.StatusOK:         {{Description: "OK"}},
+		http.StatusBadRequest: {errorResponse},
+	}
+}
+
+// documentOperations replaces the callbacks of a path with operations that
+// carry a summary and responses for path-help and the OpenAPI document
+func documentOperations(path *framework.Path) {
+	path.Operations = make(map[logical.Operation]framework.OperationHandler, len(path.Callbacks))
+	for operation, callback := range path.Callbacks {
+		summary := path.HelpSynopsis
+		if summaries, ok := operationSummaries[path.Pattern]; ok && summaries[operation] != Empty {
+			summary = summaries[operation]
+		}
+		path.Operations[operation] = &framework.PathOperation{
+			Callback:  callback,
+			Summary:   summary,
+			Responses: operationResponses(operation),
+		}
+	}
+	path.Callbacks = nil
+}
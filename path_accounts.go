@@ -30,7 +30,6 @@ import (
 	"github.com/core-coin/go-core/common/hexutil"
 	"github.com/core-coin/go-core/core/types"
 	"github.com/core-coin/go-core/xcbclient"
-	bip44 "github.com/cryptohub-digital/go-core-hdwallet"
 	"github.com/tyler-smith/go-bip39"
 
 	"github.com/hashicorp/vault/sdk/framework"
@@ -51,20 +50,122 @@ const (
 
 // AccountJSON is what we store for an Ethereum account
 type AccountJSON struct {
-	Index      int      `json:"index"`
-	Mnemonic   string   `json:"mnemonic"`
-	Inclusions []string `json:"inclusions"`
-	Exclusions []string `json:"exclusions"`
+	Index              int      `json:"index"`
+	Mnemonic           string   `json:"mnemonic"`
+	Inclusions         []string `json:"inclusions"`
+	Exclusions         []string `json:"exclusions"`
+	AllowDigestSigning bool     `json:"allow_digest_signing"`
+	// CalldataRules constrain the decoded calldata the account signs, on top of the mount's
+	CalldataRules []string `json:"calldata_rules,omitempty"`
+	// MaxUSDPerTx and DailyUSDLimit bound what the account signs for in USD, on top of the mount's
+	MaxUSDPerTx   string `json:"max_usd_per_tx,omitempty"`
+	DailyUSDLimit string `json:"daily_usd_limit,omitempty"`
+	// ChainIDs are the only chains the account signs transactions for, any if empty
+	ChainIDs []string `json:"chain_ids,omitempty"`
+	// SourceCIDRs and SigningWindows restrict where from and when the account signs
+	SourceCIDRs    []string `json:"source_cidrs,omitempty"`
+	SigningWindows []string `json:"signing_windows,omitempty"`
+	// Tier is hot, warm or cold; accounts without one are hot
+	Tier string `json:"tier,omitempty"`
+	// ApproverGroups approve the account's exports and authorizations in place of the mount's groups
+	ApproverGroups []string `json:"approver_groups,omitempty"`
+	// Broadcast is public or private; the mount's broadcast_mode if empty
+	Broadcast string `json:"broadcast,omitempty"`
+	// SealedMnemonic replaces Mnemonic for accounts that need passphrase shares to sign
+	SealedMnemonic string `json:"sealed_mnemonic,omitempty"`
+	ShareThreshold int    `json:"share_threshold,omitempty"`
+	Address        string `json:"address,omitempty"`
+	// PrivateKey is the key of an account imported from a keystore, which has no mnemonic
+	PrivateKey string `json:"private_key,omitempty"`
+	// ImportedFrom is the wallet format the account was imported from
+	ImportedFrom string `json:"imported_from,omitempty"`
+	// Envelope holds the mnemonics in storage, encrypted under the account's data key
+	Envelope  string `json:"envelope,omitempty"`
+	Destroyed bool   `json:"destroyed,omitempty"`
+}
+
+// responseData returns the same set of fields for every create, update and
+// read so that declarative clients see no spurious differences
+func (account *AccountJSON) responseData(address common.Address) map[string]interface{} {
+	inclusions, exclusions := account.Inclusions, account.Exclusions
+	if inclusions == nil {
+		inclusions = []string{}
+	}
+	if exclusions == nil {
+		exclusions = []string{}
+	}
+	calldataRules := account.CalldataRules
+	if calldataRules == nil {
+		calldataRules = []string{}
+	}
+	chainIDs := account.ChainIDs
+	if chainIDs == nil {
+		chainIDs = []string{}
+	}
+	approverGroups := account.ApproverGroups
+	if approverGroups == nil {
+		approverGroups = []string{}
+	}
+	sourceCIDRs, signingWindows := account.SourceCIDRs, account.SigningWindows
+	if sourceCIDRs == nil {
+		sourceCIDRs = []string{}
+	}
+	if signingWindows == nil {
+		signingWindows = []string{}
+	}
+	return map[string]interface{}{
+		"address":              address.Hex(),
+		"index":                account.Index,
+		"inclusions":           inclusions,
+		"exclusions":           exclusions,
+		"allow_digest_signing": account.AllowDigestSigning,
+		"calldata_rules":       calldataRules,
+		"max_usd_per_tx":       account.MaxUSDPerTx,
+		"daily_usd_limit":      account.DailyUSDLimit,
+		"chain_ids":            chainIDs,
+		"source_cidrs":         sourceCIDRs,
+		"signing_windows":      signingWindows,
+		"tier":                 account.tier(),
+		"approver_groups":      approverGroups,
+		"broadcast":            account.Broadcast,
+		"sealed":               account.sealed(),
+		"share_threshold":      account.ShareThreshold,
+		"destroyed":            account.Destroyed,
+		"imported_from":        account.ImportedFrom,
+	}
+}
+
+// digestSigningAllowed returns an error unless both the mount and the account
+// have opted out of strict mode and no group of the account holds it to
+// strict mode. In strict mode only payloads that this backend serialized
+// itself (transactions, prefixed messages) are signed.
+func digestSigningAllowed(ctx context.Context, s logical.Storage, config *ConfigJSON, name string, account *AccountJSON) error {
+	if !config.AllowDigestSigning {
+		return fmt.Errorf("%w: this mount refuses to sign caller-supplied digests", ErrPolicyViolation)
+	}
+	if !account.AllowDigestSigning {
+		return fmt.Errorf("%w: this account refuses to sign caller-supplied digests", ErrPolicyViolation)
+	}
+	groups, err := accountGroups(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	for groupName, group := range groups {
+		if group.StrictDigestSigning {
+			return fmt.Errorf("%w: group %s refuses to sign caller-supplied digests", ErrPolicyViolation, groupName)
+		}
+	}
+	return nil
 }
 
 // ValidAddress returns an error if the address is not included or if it is excluded
 func (account *AccountJSON) ValidAddress(toAddress *common.Address) error {
-	if util.Contains(account.Exclusions, toAddress.Hex()) {
-		return fmt.Errorf("%s is excludeded by this account", toAddress.Hex())
+	if util.ContainsAddress(account.Exclusions, *toAddress) {
+		return fmt.Errorf("%w: %s is excluded by this account", ErrPolicyViolation, toAddress.Hex())
 	}
 
-	if len(account.Inclusions) > 0 && !util.Contains(account.Inclusions, toAddress.Hex()) {
-		return fmt.Errorf("%s is not in the set of inclusions of this account", toAddress.Hex())
+	if len(account.Inclusions) > 0 && !util.ContainsAddress(account.Inclusions, *toAddress) {
+		return fmt.Errorf("%w: %s is not in the set of inclusions of this account", ErrPolicyViolation, toAddress.Hex())
 	}
 	return nil
 }
@@ -82,6 +183,7 @@ func accountPaths(b *PluginBackend) []*framework.Path {
 	return []*framework.Path{
 		{
 			Pattern: QualifiedPath("accounts/?"),
+			Fields:  listPageSchema(),
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.ListOperation: b.pathAccountsList,
 			},
@@ -98,9 +200,16 @@ func accountPaths(b *PluginBackend) []*framework.Path {
 Creates (or updates) an Ethereum account: an account controlled by a private key. Also
 The generator produces a high-entropy passphrase with the provided length and requirements.
 
+Writing an existing account with its own mnemonic and index, or without them,
+only updates its settings. A different mnemonic or index is refused unless
+force is set. An account derived by a build that derived the same key from
+every mnemonic records the address of that key and signs nothing; writing it
+with force derives its key again. Changing the tier or the approver groups of an account needs an
+authorization of the update, requested through accounts/<name>/authorizations.
+
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"mnemonic": {
 					Type:        framework.TypeString,
 					Default:     Empty,
@@ -119,6 +228,37 @@ The generator produces a high-entropy passphrase with the provided length and re
 					Type:        framework.TypeCommaStringSlice,
 					Description: "The list of accounts that this account can't send transactions to.",
 				},
+				"allow_digest_signing": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Allow this account to sign caller-supplied raw digests through sign-digest. The mount must allow it as well.",
+				},
+				"calldata_rules":   calldataRulesSchema,
+				"max_usd_per_tx":   maxUSDPerTxSchema,
+				"daily_usd_limit":  dailyUSDLimitSchema,
+				"chain_ids":        chainIDsSchema,
+				"source_cidrs":     sourceCIDRsSchema,
+				"signing_windows":  signingWindowsSchema,
+				"tier":             tierSchema,
+				"approver_groups":  approverGroupsSchema,
+				"broadcast":        broadcastSchema,
+				"authorization_id": authorizationIDSchema,
+				"seal_shares": {
+					Type:        framework.TypeInt,
+					Default:     0,
+					Description: "On create, seal the account and return this many passphrase shares. Vault alone cannot sign for a sealed account.",
+				},
+				"seal_threshold": {
+					Type:        framework.TypeInt,
+					Default:     0,
+					Description: "The number of passphrase shares a signing request on a sealed account must supply.",
+				},
+				"force": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "On update, allow a different mnemonic or index to overwrite the account's key.",
+				},
+				"ceremony_operators": ceremonyOperatorsSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -128,6 +268,38 @@ The generator produces a high-entropy passphrase with the provided length and re
 				logical.DeleteOperation: b.pathAccountsDelete,
 			},
 		},
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/destroy"),
+			HelpSynopsis: "Crypto-shred the key of an account.",
+			HelpDescription: `
+
+Delete the data key that the account's key material is encrypted under. The
+account stays behind, marked destroyed, so that its address and policies can
+still be read; delete it to remove it entirely.
+
+With envelope_transit_url configured, the data key is wrapped under a transit
+key of its own, which is deleted too: the account's ciphertext can then never
+be decrypted again, from storage backups and backup bundles included. Without
+it, the data key is wrapped under the mount key, which backups of the storage
+hold along with it: the account is gone from the live storage only, and
+backups taken before it was destroyed still restore it. An account's data key
+moves under a transit key when the account is next written after
+envelope_transit_url is set; backups taken before that still restore it.
+
+Accounts written before envelope encryption have no data key until their next
+update; destroying one removes its key from the account, but older backups
+still hold it.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathAccountDestroy,
+				logical.UpdateOperation: b.pathAccountDestroy,
+			},
+		},
 		{
 			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/transfer"),
 			HelpSynopsis: "Send ETH from an account.",
@@ -137,7 +309,7 @@ Send ETH from an account.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"to": {
 					Type:        framework.TypeString,
 					Description: "The address of the wallet to send ETH to.",
@@ -156,11 +328,17 @@ Send ETH from an account.
 					Description: "The gas price for the transaction in wei.",
 					Default:     "0",
 				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
+				"travel_rule":       travelRuleSchema,
+				"to_label":          toLabelSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.UpdateOperation: b.pathTransfer,
-				logical.CreateOperation: b.pathTransfer,
+				logical.UpdateOperation: b.withSigningGuards(b.pathTransfer),
+				logical.CreateOperation: b.withSigningGuards(b.pathTransfer),
 			},
 		},
 		{
@@ -172,8 +350,8 @@ Return the balance in wei for an address.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name":    {Type: framework.TypeString},
-				"address": {Type: framework.TypeString},
+				"name":    {Type: framework.TypeString, Description: "The name of the account."},
+				"address": {Type: framework.TypeString, Description: "Ignored; the account's own address is used."},
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -189,8 +367,8 @@ Sign a transaction.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name":    {Type: framework.TypeString},
-				"address": {Type: framework.TypeString},
+				"name":    {Type: framework.TypeString, Description: "The name of the account."},
+				"address": {Type: framework.TypeString, Description: "Ignored; the account's own address is used."},
 				"to": {
 					Type:        framework.TypeString,
 					Description: "The address of the wallet to send ETH to.",
@@ -200,9 +378,10 @@ Sign a transaction.
 					Description: "The data to sign.",
 				},
 				"encoding": {
-					Type:        framework.TypeString,
-					Default:     "utf8",
-					Description: "The encoding of the data to sign.",
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{Utf8Encoding, HexEncoding},
+					Default:       "utf8",
+					Description:   "The encoding of the data to sign.",
 				},
 				"amount": {
 					Type:        framework.TypeString,
@@ -222,11 +401,17 @@ Sign a transaction.
 					Description: "The gas price for the transaction in wei.",
 					Default:     "0",
 				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
+				"travel_rule":       travelRuleSchema,
+				"to_label":          toLabelSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.CreateOperation: b.pathSignTx,
-				logical.UpdateOperation: b.pathSignTx,
+				logical.CreateOperation: b.withSigningGuards(b.pathSignTx),
+				logical.UpdateOperation: b.withSigningGuards(b.pathSignTx),
 			},
 		},
 		{
@@ -238,8 +423,8 @@ Deploy a smart contract to the network.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name":    {Type: framework.TypeString},
-				"address": {Type: framework.TypeString},
+				"name":    {Type: framework.TypeString, Description: "The name of the account."},
+				"address": {Type: framework.TypeString, Description: "Ignored; the account's own address is used."},
 				"version": {
 					Type:        framework.TypeString,
 					Description: "The smart contract version.",
@@ -257,11 +442,15 @@ Deploy a smart contract to the network.
 					Description: "The gas limit for the transaction - defaults to 0 meaning estimate.",
 					Default:     "0",
 				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.UpdateOperation: b.pathDeploy,
-				logical.CreateOperation: b.pathDeploy,
+				logical.UpdateOperation: b.withSigningGuards(b.pathDeploy),
+				logical.CreateOperation: b.withSigningGuards(b.pathDeploy),
 			},
 		},
 		{
@@ -276,16 +465,51 @@ https://eth.wiki/json-rpc/API#eth_sign
 
 		`,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"message": {
 					Type:        framework.TypeString,
 					Description: "Message to sign.",
 				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.CreateOperation: b.pathSignMessage,
-				logical.UpdateOperation: b.pathSignMessage,
+				logical.CreateOperation: b.withSigningGuards(b.pathSignMessage),
+				logical.UpdateOperation: b.withSigningGuards(b.pathSignMessage),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sign-digest"),
+			HelpSynopsis: "Sign a caller-supplied 32 byte digest",
+			HelpDescription: `
+
+Sign a raw 32 byte digest, such as the statement of an L2 proof system,
+without hashing or prefixing it. The plugin cannot tell what a digest commits
+to: it may be the hash of a transaction the account never agreed to. Both
+the mount and the account must set allow_digest_signing, no group of the
+account may set strict_digest_signing, and since the path is its own, Vault
+policies grant it apart from sign and sign-tx.
+
+Decisions for digests carry the digest, so they stand apart in the decision
+log from the payloads the plugin serialized itself.
+
+		`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"digest": {
+					Type:        framework.TypeString,
+					Description: "The 32 byte digest to sign, in hex.",
+				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withSigningGuards(b.pathSignDigest),
+				logical.UpdateOperation: b.withSigningGuards(b.pathSignDigest),
 			},
 		},
 	}
@@ -296,7 +520,7 @@ func (b *PluginBackend) pathAccountsList(ctx context.Context, req *logical.Reque
 	if err != nil {
 		return nil, err
 	}
-	return logical.ListResponse(vals), nil
+	return logical.ListResponse(listPage(vals, data)), nil
 }
 
 func readAccount(ctx context.Context, req *logical.Request, name string) (*AccountJSON, error) {
@@ -306,15 +530,21 @@ func readAccount(ctx context.Context, req *logical.Request, name string) (*Accou
 		return nil, err
 	}
 	if entry == nil {
-		return nil, nil
+		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, name)
 	}
 
 	var accountJSON AccountJSON
 	err = entry.DecodeJSON(&accountJSON)
 
-	if entry == nil {
+	if err != nil {
 		return nil, fmt.Errorf("failed to deserialize account at %s", path)
 	}
+	if err := openEnvelope(ctx, req.Storage, name, &accountJSON); err != nil {
+		return nil, err
+	}
+	if err := unsealFromRequest(req, &accountJSON); err != nil {
+		return nil, err
+	}
 	return &accountJSON, nil
 }
 
@@ -325,21 +555,17 @@ func (b *PluginBackend) pathAccountsRead(ctx context.Context, req *logical.Reque
 	}
 	name := data.Get("name").(string)
 	accountJSON, err := readAccount(ctx, req, name)
-
-	_, account, err := getWalletAndAccount(*accountJSON)
 	if err != nil {
 		return nil, err
 	}
-	if err != nil || accountJSON == nil {
-		return nil, fmt.Errorf("Error reading account")
+
+	address, err := accountAddress(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
 	}
 
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"address":    account.Address.Hex(),
-			"inclusions": accountJSON.Inclusions,
-			"exclusions": accountJSON.Exclusions,
-		},
+		Data: accountJSON.responseData(address),
 	}, nil
 }
 
@@ -349,32 +575,163 @@ func (b *PluginBackend) pathAccountsDelete(ctx context.Context, req *logical.Req
 		return nil, err
 	}
 	name := data.Get("name").(string)
-	_, err = readAccount(ctx, req, name)
+	accountJSON, err := readAccount(ctx, req, name)
+	if errors.Is(err, ErrAccountNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	address, err := accountAddress(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 	if err := req.Storage.Delete(ctx, req.Path); err != nil {
 		return nil, err
 	}
+	if err := b.unindexAccount(ctx, req, address); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, canaryStoragePath(name)); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, attestationStoragePath(name)); err != nil {
+		return nil, err
+	}
+	if _, err := destroyDataKey(ctx, req.Storage, name); err != nil {
+		return nil, err
+	}
+	if err := deleteSessions(ctx, req, name); err != nil {
+		return nil, err
+	}
+	if err := leaveGroups(ctx, req.Storage, name); err != nil {
+		return nil, err
+	}
+	if err := deleteActivity(ctx, req.Storage, name); err != nil {
+		return nil, err
+	}
+	if err := deleteAnomalyProfile(ctx, req.Storage, name); err != nil {
+		return nil, err
+	}
 	return nil, nil
 }
 
-func getWalletAndAccount(accountJSON AccountJSON) (*bip44.Wallet, *accounts.Account, error) {
-	hdwallet, err := bip44.NewFromMnemonic(accountJSON.Mnemonic)
+func (b *PluginBackend) pathAccountDestroy(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	path := QualifiedPath(fmt.Sprintf("accounts/%s", name))
+	entry, err := req.Storage.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, name)
+	}
+	var accountJSON AccountJSON
+	if err := entry.DecodeJSON(&accountJSON); err != nil {
+		return nil, fmt.Errorf("failed to deserialize account at %s", path)
+	}
+	var warnings []string
+	if !accountJSON.Destroyed {
+		if accountJSON.Envelope == Empty {
+			warnings = append(warnings, "this account predates envelope encryption: storage backups taken before now still hold its key")
+			if accountJSON.Address == Empty {
+				address, err := accountAddress(ctx, accountJSON)
+				if err != nil {
+					return nil, err
+				}
+				accountJSON.Address = address.Hex()
+			}
+		}
+		// the tombstone is written first so that no account is left with an envelope and no key
+		accountJSON.Mnemonic = Empty
+		accountJSON.SealedMnemonic = Empty
+		accountJSON.PrivateKey = Empty
+		accountJSON.Envelope = Empty
+		accountJSON.Destroyed = true
+		entry, err := logical.StorageEntryJSON(path, &accountJSON)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+	inBackups, err := destroyDataKey(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if inBackups {
+		warnings = append(warnings, "the data key of this account was wrapped under the mount key, which storage backups hold with it: backups taken before now still restore the account; set envelope_transit_url to wrap data keys under transit keys that destroy deletes")
+	}
+	if err := deleteSessions(ctx, req, name); err != nil {
+		return nil, err
+	}
+	address, err := accountAddress(ctx, accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	b.recordActivity(ctx, req, name, &ActivityJSON{Event: activityDestroyed}, nil, nil)
+	return &logical.Response{
+		Data:     accountJSON.responseData(address),
+		Warnings: warnings,
+	}, nil
+}
+
+func getWalletAndAccount(ctx context.Context, accountJSON AccountJSON) (signingWallet, *accounts.Account, error) {
+	if accountJSON.Destroyed {
+		return nil, nil, fmt.Errorf("%w: this account has been destroyed", ErrAccountNotFound)
+	}
+	if accountJSON.sealed() && accountJSON.Mnemonic == Empty {
+		return nil, nil, fmt.Errorf("%w: this account is sealed and needs %d passphrase_shares", ErrApprovalRequired, accountJSON.ShareThreshold)
+	}
+	if accountJSON.PrivateKey != Empty {
+		wallet, err := newKeyWallet(accountJSON.PrivateKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return wallet, &wallet.account, nil
+	}
+	// the seed is stretched from the mnemonic with PBKDF2 every time
+	kdfDone := timed(ctx, kdfTime)
+	hdwallet, err := util.NewHDWallet(accountJSON.Mnemonic)
+	kdfDone()
 	if err != nil {
 		return nil, nil, err
 	}
-	derivationPath := fmt.Sprintf(DerivationPath, accountJSON.Index)
-	path := bip44.MustParseDerivationPath(derivationPath)
-	account, err := hdwallet.Derive(path, true)
+	defer hdwallet.Zero()
+	wallet, err := deriveKeyWallet(hdwallet, accountJSON.Index)
 	if err != nil {
 		return nil, nil, err
 	}
-	return hdwallet, &account, nil
+	if accountJSON.Address != Empty {
+		// go-core-hdwallet v0.0.1 derived the zero key from every mnemonic, and
+		// the accounts it derived recorded the address of that key
+		if address, err := common.HexToAddress(accountJSON.Address); err != nil || address != wallet.account.Address {
+			return nil, nil, fmt.Errorf("%w: the mnemonic derives %s, not the recorded address %s; re-key the account with force", ErrKeystoreDecrypt, wallet.account.Address.Hex(), accountJSON.Address)
+		}
+	}
+	return wallet, &wallet.account, nil
+}
+
+// deriveKeyWallet derives the key of an index of a mnemonic
+func deriveKeyWallet(hdwallet *util.HDWallet, index int) (*keyWallet, error) {
+	path, err := accounts.ParseDerivationPath(fmt.Sprintf(DerivationPath, index))
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	key, err := hdwallet.DeriveKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return keyWalletFor(key), nil
 }
 
 func (b *PluginBackend) pathAccountsCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	_, err := b.configured(ctx, req)
+	config, err := b.configured(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -389,6 +746,10 @@ func (b *PluginBackend) pathAccountsCreate(ctx context.Context, req *logical.Req
 	}
 	index := data.Get("index").(int)
 	mnemonic := data.Get("mnemonic").(string)
+	operators := data.Get("ceremony_operators").([]string)
+	if len(operators) > 0 && mnemonic != Empty {
+		return nil, fmt.Errorf("%w: a ceremony generates its own key; do not supply a mnemonic", ErrInvalidInput)
+	}
 	if mnemonic == Empty {
 		entropy, err := bip39.NewEntropy(128)
 		if err != nil {
@@ -402,38 +763,130 @@ func (b *PluginBackend) pathAccountsCreate(ctx context.Context, req *logical.Req
 	if err != nil {
 		return nil, err
 	}
-	accountJSON := &AccountJSON{
-		Index:      index,
-		Mnemonic:   mnemonic,
-		Inclusions: util.Dedup(inclusions),
-		Exclusions: util.Dedup(exclusions),
+	inclusions, err = config.normalizeAddresses(inclusions)
+	if err != nil {
+		return nil, err
 	}
-	_, account, err := getWalletAndAccount(*accountJSON)
+	exclusions, err = config.normalizeAddresses(exclusions)
 	if err != nil {
 		return nil, err
 	}
+	calldataRules, err := parseCalldataRules(data.Get("calldata_rules").([]string))
+	if err != nil {
+		return nil, err
+	}
+	maxUSDPerTx, err := parseUSDLimit("max_usd_per_tx", data.Get("max_usd_per_tx").(string))
+	if err != nil {
+		return nil, err
+	}
+	dailyUSDLimit, err := parseUSDLimit("daily_usd_limit", data.Get("daily_usd_limit").(string))
+	if err != nil {
+		return nil, err
+	}
+	chainIDs, err := parseChainIDs(data.Get("chain_ids").([]string))
+	if err != nil {
+		return nil, err
+	}
+	sourceCIDRs, err := parseSourceCIDRs(data.Get("source_cidrs").([]string))
+	if err != nil {
+		return nil, err
+	}
+	signingWindows, err := parseSigningWindows(data.Get("signing_windows").([]string))
+	if err != nil {
+		return nil, err
+	}
+	tier, err := parseTier(data.Get("tier").(string))
+	if err != nil {
+		return nil, err
+	}
+	broadcast, err := parseBroadcast(data.Get("broadcast").(string))
+	if err != nil {
+		return nil, err
+	}
+	accountJSON := &AccountJSON{
+		Index:              index,
+		Mnemonic:           mnemonic,
+		Inclusions:         inclusions,
+		Exclusions:         exclusions,
+		AllowDigestSigning: data.Get("allow_digest_signing").(bool),
+		CalldataRules:      calldataRules,
+		MaxUSDPerTx:        maxUSDPerTx,
+		DailyUSDLimit:      dailyUSDLimit,
+		ChainIDs:           chainIDs,
+		SourceCIDRs:        sourceCIDRs,
+		SigningWindows:     signingWindows,
+		Tier:               tier,
+		ApproverGroups:     util.Dedup(data.Get("approver_groups").([]string)),
+		Broadcast:          broadcast,
+	}
+	_, account, err := getWalletAndAccount(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkDuplicateAccount(ctx, req, account.Address, name); err != nil {
+		return nil, err
+	}
+	var shares []string
+	if sealShares := data.Get("seal_shares").(int); sealShares > 0 {
+		shares, err = sealAccount(accountJSON, account.Address, sealShares, data.Get("seal_threshold").(int))
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	err = b.updateAccount(ctx, req, name, accountJSON)
 	if err != nil {
 		return nil, err
 	}
+	if err := b.indexAccount(ctx, req, account.Address, name); err != nil {
+		return nil, err
+	}
 
+	responseData := accountJSON.responseData(account.Address)
+	if len(operators) > 0 {
+		attestation, err := attestCeremony(ctx, req, name, account.Address, index, operators)
+		if err != nil {
+			return nil, err
+		}
+		responseData["attestation"] = attestation.responseData()
+	}
+	if shares != nil {
+		// the shares are returned once and never stored
+		responseData["passphrase_shares"] = shares
+	}
+	b.recordActivity(ctx, req, name, &ActivityJSON{Event: activityCreated}, nil, nil)
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"address":    account.Address.Hex(),
-			"inclusions": accountJSON.Inclusions,
-			"exclusions": accountJSON.Exclusions,
-		},
+		Data: responseData,
 	}, nil
 }
 
 func (b *PluginBackend) updateAccount(ctx context.Context, req *logical.Request, name string, accountJSON *AccountJSON) error {
 	path := QualifiedPath(fmt.Sprintf("accounts/%s", name))
+	if accountJSON.Destroyed {
+		return fmt.Errorf("%w: %s has been destroyed", ErrAccountNotFound, name)
+	}
+	if accountJSON.Address == Empty {
+		address, err := accountAddress(ctx, *accountJSON)
+		if err != nil {
+			return err
+		}
+		accountJSON.Address = address.Hex()
+	}
+	stored := *accountJSON
+	if stored.sealed() {
+		// never persist a mnemonic unsealed for this request
+		stored.Mnemonic = Empty
+	}
+	sealed, err := b.sealEnvelope(ctx, req.Storage, name, &stored)
+	if err != nil {
+		return err
+	}
 
-	entry, err := logical.StorageEntryJSON(path, accountJSON)
+	entry, err := storageEntryJSON(path, sealed)
 	if err != nil {
 		return err
 	}
+	entry.SealWrap = true
 
 	err = req.Storage.Put(ctx, entry)
 	if err != nil {
@@ -443,7 +896,7 @@ func (b *PluginBackend) updateAccount(ctx context.Context, req *logical.Request,
 }
 
 func (b *PluginBackend) pathAccountUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	_, err := b.configured(ctx, req)
+	config, err := b.configured(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -453,32 +906,157 @@ func (b *PluginBackend) pathAccountUpdate(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
-	var inclusions []string
+	address, err := accountAddress(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	// supplying the key material the account already has is a no-op, anything else overwrites the key
+	mnemonic := data.Get("mnemonic").(string)
+	index, indexOk := data.GetOk("index")
+	keyReplaced := (mnemonic != Empty && mnemonic != accountJSON.Mnemonic) || (indexOk && index.(int) != accountJSON.Index)
+	if !keyReplaced && data.Get("force").(bool) && accountJSON.Mnemonic != Empty && accountJSON.PrivateKey == Empty {
+		// the accounts go-core-hdwallet v0.0.1 derived record the address of
+		// the zero key; forcing an update derives their key again
+		derived := *accountJSON
+		derived.Address = Empty
+		_, account, err := getWalletAndAccount(ctx, derived)
+		if err != nil {
+			return nil, err
+		}
+		keyReplaced = account.Address != address
+	}
+	if keyReplaced {
+		if !data.Get("force").(bool) {
+			return nil, fmt.Errorf("%w: %s has a different key; set force=true to overwrite it", ErrAccountExists, name)
+		}
+		if err := b.checkControlGroup(ctx, req, config, name, controlGroupRotate); err != nil {
+			return nil, err
+		}
+		if mnemonic != Empty {
+			accountJSON.Mnemonic = mnemonic
+			accountJSON.SealedMnemonic = Empty
+			accountJSON.ShareThreshold = 0
+			accountJSON.PrivateKey = Empty
+			accountJSON.ImportedFrom = Empty
+			accountJSON.Address = Empty
+		} else if accountJSON.PrivateKey != Empty {
+			return nil, fmt.Errorf("%w: %s was imported with a key and has no mnemonic to derive another index from", ErrInvalidInput, name)
+		}
+		if indexOk {
+			accountJSON.Index = index.(int)
+		}
+		accountJSON.Address = Empty
+		_, account, err := getWalletAndAccount(ctx, *accountJSON)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.checkDuplicateAccount(ctx, req, account.Address, name); err != nil {
+			return nil, err
+		}
+		if err := b.unindexAccount(ctx, req, address); err != nil {
+			return nil, err
+		}
+		if err := b.indexAccount(ctx, req, account.Address, name); err != nil {
+			return nil, err
+		}
+		address = account.Address
+	}
+
 	if inclusionsRaw, ok := data.GetOk("inclusions"); ok {
-		inclusions = inclusionsRaw.([]string)
+		accountJSON.Inclusions, err = config.normalizeAddresses(inclusionsRaw.([]string))
+		if err != nil {
+			return nil, err
+		}
 	}
-	var exclusions []string
 	if exclusionsRaw, ok := data.GetOk("exclusions"); ok {
-		exclusions = exclusionsRaw.([]string)
+		accountJSON.Exclusions, err = config.normalizeAddresses(exclusionsRaw.([]string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if allowDigestSigning, ok := data.GetOk("allow_digest_signing"); ok {
+		accountJSON.AllowDigestSigning = allowDigestSigning.(bool)
+	}
+	if calldataRulesRaw, ok := data.GetOk("calldata_rules"); ok {
+		accountJSON.CalldataRules, err = parseCalldataRules(calldataRulesRaw.([]string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if maxUSDPerTxRaw, ok := data.GetOk("max_usd_per_tx"); ok {
+		accountJSON.MaxUSDPerTx, err = parseUSDLimit("max_usd_per_tx", maxUSDPerTxRaw.(string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dailyUSDLimitRaw, ok := data.GetOk("daily_usd_limit"); ok {
+		accountJSON.DailyUSDLimit, err = parseUSDLimit("daily_usd_limit", dailyUSDLimitRaw.(string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if chainIDsRaw, ok := data.GetOk("chain_ids"); ok {
+		accountJSON.ChainIDs, err = parseChainIDs(chainIDsRaw.([]string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sourceCIDRsRaw, ok := data.GetOk("source_cidrs"); ok {
+		accountJSON.SourceCIDRs, err = parseSourceCIDRs(sourceCIDRsRaw.([]string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if signingWindowsRaw, ok := data.GetOk("signing_windows"); ok {
+		accountJSON.SigningWindows, err = parseSigningWindows(signingWindowsRaw.([]string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tierRaw, ok := data.GetOk("tier"); ok {
+		tier, err := parseTier(tierRaw.(string))
+		if err != nil {
+			return nil, err
+		}
+		if tier != accountJSON.Tier {
+			// a tier change is approved like a warm account's request
+			err = b.useAuthorization(ctx, req, name)
+			recordRule(ctx, "tier_change", err)
+			if err != nil {
+				return nil, err
+			}
+			accountJSON.Tier = tier
+		}
+	}
+	if approverGroupsRaw, ok := data.GetOk("approver_groups"); ok {
+		approverGroups := util.Dedup(approverGroupsRaw.([]string))
+		if strings.Join(approverGroups, ",") != strings.Join(accountJSON.ApproverGroups, ",") {
+			// whoever could name the approvers could approve their own requests
+			err = b.useAuthorization(ctx, req, name)
+			recordRule(ctx, "approver_groups_change", err)
+			if err != nil {
+				return nil, err
+			}
+			accountJSON.ApproverGroups = approverGroups
+		}
+	}
+	if broadcastRaw, ok := data.GetOk("broadcast"); ok {
+		if accountJSON.Broadcast, err = parseBroadcast(broadcastRaw.(string)); err != nil {
+			return nil, err
+		}
 	}
-	accountJSON.Inclusions = inclusions
-	accountJSON.Exclusions = exclusions
 
 	err = b.updateAccount(ctx, req, name, accountJSON)
 	if err != nil {
 		return nil, err
 	}
-	_, account, err := getWalletAndAccount(*accountJSON)
-	if err != nil {
-		return nil, err
+	if keyReplaced {
+		b.recordActivity(ctx, req, name, &ActivityJSON{Event: activityKeyReplaced}, nil, nil)
 	}
 
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"address":    account.Address.Hex(),
-			"inclusions": accountJSON.Inclusions,
-			"exclusions": accountJSON.Exclusions,
-		},
+		Data: accountJSON.responseData(address),
 	}, nil
 
 }
@@ -494,8 +1072,8 @@ func pathExistenceCheck(ctx context.Context, req *logical.Request, data *framewo
 
 // returns (nonce, toAddress, amount, gasPrice, gasLimit, error)
 
-func (b *PluginBackend) getData(client *xcbclient.Client, fromAddress common.Address, data *framework.FieldData) (*TransactionParams, error) {
-	transactionParams, err := b.getBaseData(client, fromAddress, data, "to")
+func (b *PluginBackend) getData(ctx context.Context, config *ConfigJSON, client *xcbclient.Client, fromAddress common.Address, data *framework.FieldData) (*TransactionParams, error) {
+	transactionParams, err := b.getBaseData(ctx, config, client, fromAddress, data, "to")
 	if err != nil {
 		return nil, err
 	}
@@ -522,14 +1100,18 @@ func (b *PluginBackend) getData(client *xcbclient.Client, fromAddress common.Add
 }
 
 // NewWalletTransactor is used with Token contracts
-func (b *PluginBackend) NewWalletTransactor(chainID *big.Int, hdwallet *bip44.Wallet, account *accounts.Account) (*bind.TransactOpts, error) {
+func (b *PluginBackend) NewWalletTransactor(ctx context.Context, chainID *big.Int, hdwallet signingWallet, account *accounts.Account) (*bind.TransactOpts, error) {
 	return &bind.TransactOpts{
-		From: account.Address,
+		From:    account.Address,
+		Context: ctx,
 		Signer: func(signer types.Signer, address common.Address, tx *types.Transaction) (*types.Transaction, error) {
 			if address != account.Address {
 				return nil, errors.New("not authorized to sign this account")
 			}
-			signedTx, err := hdwallet.SignTx(*account, tx, chainID)
+			if err := b.checkTransaction(ctx, tx); err != nil {
+				return nil, err
+			}
+			signedTx, err := signCoreTransaction(chainID, walletSigner(hdwallet, *account), tx)
 			if err != nil {
 				return nil, err
 			}
@@ -539,7 +1121,7 @@ func (b *PluginBackend) NewWalletTransactor(chainID *big.Int, hdwallet *bip44.Wa
 	}, nil
 }
 
-func (b *PluginBackend) getBaseData(client *xcbclient.Client, fromAddress common.Address, data *framework.FieldData, addressField string) (*TransactionParams, error) {
+func (b *PluginBackend) getBaseData(ctx context.Context, config *ConfigJSON, client *xcbclient.Client, fromAddress common.Address, data *framework.FieldData, addressField string) (*TransactionParams, error) {
 	var err error
 	var address common.Address
 	nonceData := "0"
@@ -550,7 +1132,7 @@ func (b *PluginBackend) getBaseData(client *xcbclient.Client, fromAddress common
 	if ok {
 		amount = util.ValidNumber(data.Get("amount").(string))
 		if amount == nil {
-			return nil, fmt.Errorf("invalid amount")
+			return nil, fmt.Errorf("%w: invalid amount", ErrInvalidInput)
 		}
 	} else {
 		amount = util.ValidNumber("0")
@@ -562,7 +1144,7 @@ func (b *PluginBackend) getBaseData(client *xcbclient.Client, fromAddress common
 		nonceIn := util.ValidNumber(nonceData)
 		nonce = nonceIn.Uint64()
 	} else {
-		nonce, err = client.PendingNonceAt(context.Background(), fromAddress)
+		nonce, err = client.PendingNonceAt(ctx, fromAddress)
 		if err != nil {
 			return nil, err
 		}
@@ -572,23 +1154,23 @@ func (b *PluginBackend) getBaseData(client *xcbclient.Client, fromAddress common
 	if ok {
 		gasPriceIn = util.ValidNumber(data.Get("gas_price").(string))
 		if gasPriceIn == nil {
-			return nil, fmt.Errorf("invalid gas price")
+			return nil, fmt.Errorf("%w: invalid gas price", ErrInvalidInput)
 		}
 	} else {
 		gasPriceIn = util.ValidNumber("0")
 	}
 
 	if big.NewInt(0).Cmp(gasPriceIn) == 0 {
-		gasPriceIn, err = client.SuggestEnergyPrice(context.Background())
+		gasPriceIn, err = client.SuggestEnergyPrice(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	if addressField != Empty {
-		address, err = common.HexToAddress(data.Get(addressField).(string))
+		address, err = config.parseAddress(data.Get(addressField).(string))
         if err != nil {
-            return nil, err
+            return nil, wrapError(ErrInvalidAddress, err)
         }
 		return &TransactionParams{
 			Nonce:    nonce,
@@ -618,11 +1200,11 @@ func (b *PluginBackend) pathTransfer(ctx context.Context, req *logical.Request,
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("cannot connect to " + config.getRPCURL())
+		return nil, err
 	}
 
 	accountJSON, err := readAccount(ctx, req, name)
@@ -630,20 +1212,20 @@ func (b *PluginBackend) pathTransfer(ctx context.Context, req *logical.Request,
 		return nil, err
 	}
 
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	transactionParams, err := b.getData(client, account.Address, data)
+	transactionParams, err := b.getData(ctx, config, client, account.Address, data)
 
 	if err != nil {
 		return nil, err
 	}
 	accountJSON.Inclusions = append(accountJSON.Inclusions, config.Inclusions...)
 	accountJSON.Inclusions = append(accountJSON.Inclusions, accountJSON.Inclusions...)
-	if len(accountJSON.Inclusions) > 0 && !util.Contains(accountJSON.Inclusions, transactionParams.Address.Hex()) {
-		return nil, fmt.Errorf("%s violates the inclusions %+v", transactionParams.Address.Hex(), accountJSON.Inclusions)
+	if len(accountJSON.Inclusions) > 0 && !util.ContainsAddress(accountJSON.Inclusions, *transactionParams.Address) {
+		return nil, fmt.Errorf("%w: %s violates the inclusions %+v", ErrPolicyViolation, transactionParams.Address.Hex(), accountJSON.Inclusions)
 	}
 	err = config.ValidAddress(transactionParams.Address)
 	if err != nil {
@@ -655,12 +1237,18 @@ func (b *PluginBackend) pathTransfer(ctx context.Context, req *logical.Request,
 	}
 
 	tx := types.NewTransaction(transactionParams.Nonce, *transactionParams.Address, transactionParams.Amount, transactionParams.GasLimit, transactionParams.GasPrice, txDataToSign)
-	signedTx, err := wallet.SignTx(*account, tx, chainID)
+	if err := b.checkTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	signedTx, err := signCoreTransaction(chainID, walletSigner(wallet, *account), tx)
 	if err != nil {
 		return nil, err
 	}
-	err = client.SendTransaction(context.Background(), signedTx)
+	err = client.SendTransaction(ctx, signedTx)
 	if err != nil {
+		return nil, classifySendError(err)
+	}
+	if err := trackTransaction(ctx, req, name, signedTx); err != nil {
 		return nil, err
 	}
 
@@ -691,11 +1279,11 @@ func (b *PluginBackend) pathDeploy(ctx context.Context, req *logical.Request, da
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("cannot connect to " + config.getRPCURL())
+		return nil, err
 	}
 
 	accountJSON, err := readAccount(ctx, req, name)
@@ -703,12 +1291,12 @@ func (b *PluginBackend) pathDeploy(ctx context.Context, req *logical.Request, da
 		return nil, err
 	}
 
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, Empty)
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, Empty)
 
 	if err != nil {
 		return nil, err
@@ -724,7 +1312,7 @@ func (b *PluginBackend) pathDeploy(ctx context.Context, req *logical.Request, da
 		return nil, err
 	}
 	binRaw := common.FromHex(binData)
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -742,6 +1330,9 @@ func (b *PluginBackend) pathDeploy(ctx context.Context, req *logical.Request, da
 	transactOpts.EnergyLimit = gasLimit
 	contractAddress, tx, _, err := bind.DeployContract(transactOpts, parsed, binRaw, client)
 	if err != nil {
+		return nil, classifySendError(err)
+	}
+	if err := trackTransaction(ctx, req, name, tx); err != nil {
 		return nil, err
 	}
 	//	b.LogTx(tx)
@@ -767,16 +1358,16 @@ func (b *PluginBackend) pathSignTx(ctx context.Context, req *logical.Request, da
 	if err != nil {
 		return nil, err
 	}
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("cannot connect to " + config.getRPCURL())
+		return nil, err
 	}
 
 	name := data.Get("name").(string)
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 	dataOrFile := data.Get("data").(string)
 	encoding := data.Get("encoding").(string)
@@ -788,25 +1379,25 @@ func (b *PluginBackend) pathSignTx(ctx context.Context, req *logical.Request, da
 	} else if encoding == "utf8" {
 		txDataToSign = []byte(dataOrFile)
 	} else {
-		return nil, fmt.Errorf("invalid encoding encountered - %s", encoding)
+		return nil, fmt.Errorf("%w: invalid encoding encountered - %s", ErrInvalidInput, encoding)
 	}
 	accountJSON, err := readAccount(ctx, req, name)
 	if err != nil {
 		return nil, err
 	}
 
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
-	transactionParams, err := b.getData(client, account.Address, data)
+	transactionParams, err := b.getData(ctx, config, client, account.Address, data)
 	if err != nil {
 		return nil, err
 	}
 
 	accountJSON.Inclusions = append(accountJSON.Inclusions, config.Inclusions...)
-	if len(accountJSON.Inclusions) > 0 && !util.Contains(accountJSON.Inclusions, transactionParams.Address.Hex()) {
-		return nil, fmt.Errorf("%s violates the set of inclusions %+v", transactionParams.Address.Hex(), accountJSON.Inclusions)
+	if len(accountJSON.Inclusions) > 0 && !util.ContainsAddress(accountJSON.Inclusions, *transactionParams.Address) {
+		return nil, fmt.Errorf("%w: %s violates the set of inclusions %+v", ErrPolicyViolation, transactionParams.Address.Hex(), accountJSON.Inclusions)
 	}
 	err = config.ValidAddress(transactionParams.Address)
 	if err != nil {
@@ -818,8 +1409,15 @@ func (b *PluginBackend) pathSignTx(ctx context.Context, req *logical.Request, da
 	}
 
 	tx := types.NewTransaction(transactionParams.Nonce, *transactionParams.Address, transactionParams.Amount, transactionParams.GasLimit, transactionParams.GasPrice, txDataToSign)
+	if err := b.checkTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
 
-	signedTx, err := wallet.SignTx(*account, tx, chainID)
+	signer, err := accountSigner(ctx, req, name, wallet, *account)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := signCoreTransaction(chainID, signer, tx)
 	if err != nil {
 		return nil, err
 	}
@@ -853,23 +1451,23 @@ func (b *PluginBackend) pathReadBalance(ctx context.Context, req *logical.Reques
 		return nil, err
 	}
 
-	_, account, err := getWalletAndAccount(*accountJSON)
+	address, err := accountAddress(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
-	balance, err := client.BalanceAt(context.Background(), account.Address, nil)
+	balance, err := client.BalanceAt(ctx, address, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"address": account.Address.Hex(),
+			"address": address.Hex(),
 			"balance": balance.String(),
 		},
 	}, nil
@@ -878,7 +1476,7 @@ func (b *PluginBackend) pathReadBalance(ctx context.Context, req *logical.Reques
 
 // LogTx is for debugging
 func (b *PluginBackend) LogTx(tx *types.Transaction) {
-	b.Logger().Info(fmt.Sprintf("\nTX DATA: %s\nGAS: %d\nGAS PRICE: %d\nVALUE: %d\nNONCE: %d\nTO: %s\n", hexutil.Encode(tx.Data()), tx.Energy(), tx.EnergyPrice(), tx.Value(), tx.Nonce(), tx.To().Hex()))
+	b.Logger().Debug("transaction", "to", tx.To().Hex(), "nonce", tx.Nonce(), "value", tx.Value(), "energy", tx.Energy(), "energy_price", tx.EnergyPrice(), "data_length", len(tx.Data()))
 }
 
 func (b *PluginBackend) pathSignMessage(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -890,14 +1488,18 @@ func (b *PluginBackend) pathSignMessage(ctx context.Context, req *logical.Reques
 		return nil, err
 	}
 
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
 	hashedMessage, _ := accounts.TextAndHash([]byte(message))
 
-	signedMessage, err := wallet.SignHash(*account, []byte(hashedMessage))
+	signer, err := accountSigner(ctx, req, name, wallet, *account)
+	if err != nil {
+		return nil, err
+	}
+	signedMessage, err := signer.Sign(hashedMessage)
 	if err != nil {
 		return nil, err
 	}
@@ -910,3 +1512,47 @@ func (b *PluginBackend) pathSignMessage(ctx context.Context, req *logical.Reques
 		},
 	}, nil
 }
+
+func (b *PluginBackend) pathSignDigest(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	err = digestSigningAllowed(ctx, req.Storage, config, name, accountJSON)
+	recordRule(ctx, "digest_signing", err)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := hexutil.Decode(data.Get("digest").(string))
+	if err != nil || len(digest) != common.HashLength {
+		return nil, fmt.Errorf("%w: digest must be %d bytes of 0x-prefixed hex", ErrInvalidInput, common.HashLength)
+	}
+	noteDigest(ctx, digest)
+
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := accountSigner(ctx, req, name, wallet, *account)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(digest)
+	if err != nil {
+		return nil, err
+	}
+	b.Logger().Warn("signed a caller-supplied digest", "account", name, "digest", hexutil.Encode(digest), "entity_id", req.EntityID)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signature": hexutil.Encode(signature),
+			"address":   account.Address,
+			"digest":    hexutil.Encode(digest),
+		},
+	}, nil
+}
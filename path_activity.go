@@ -0,0 +1,256 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// maxActivity is the number of events kept for each account; older ones are pruned
+	maxActivity int = 1000
+	// DefaultActivityPage is the number of events a page of activity returns
+	DefaultActivityPage int = 50
+
+	activityCreated     string = "created"
+	activityImported    string = "imported"
+	activityKeyReplaced string = "key_replaced"
+	activityDestroyed   string = "destroyed"
+	activityExport      string = "export_release"
+)
+
+// ActivityJSON is one event in the timeline of an account
+type ActivityJSON struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Path      string    `json:"path"`
+	EntityID  string    `json:"entity_id,omitempty"`
+	Verdict   string    `json:"verdict"`
+	ErrorCode string    `json:"error_code,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	// TransactionHash is the transaction the event signed or sent, if any
+	TransactionHash string `json:"transaction_hash,omitempty"`
+	Chain           string `json:"chain,omitempty"`
+	ExportID        string `json:"export_id,omitempty"`
+	Memo            string `json:"memo,omitempty"`
+}
+
+func (activity *ActivityJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"id":      activity.ID,
+		"time":    activity.Time.Format(time.RFC3339Nano),
+		"event":   activity.Event,
+		"path":    activity.Path,
+		"verdict": activity.Verdict,
+	}
+	for key, value := range map[string]string{
+		"entity_id":        activity.EntityID,
+		"error_code":       activity.ErrorCode,
+		"reason":           activity.Reason,
+		"transaction_hash": activity.TransactionHash,
+		"chain":            activity.Chain,
+		"export_id":        activity.ExportID,
+		"memo":             activity.Memo,
+	} {
+		if value != Empty {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func activityStoragePath(name, id string) string {
+	return QualifiedPath(fmt.Sprintf("activity/%s/%s", name, id))
+}
+
+func activityPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/activity"),
+			HelpSynopsis: "Return the timeline of an account, newest first.",
+			HelpDescription: `
+
+Return what happened with an account: the messages, digests and transactions
+it signed or was refused, the transfers and deployments it sent, its export
+requests, approvals and releases, and its creation, import, key replacement
+and destruction. Events that sent a transaction carry its hash and, while the
+transaction is tracked, its status and confirmations.
+
+Events are returned newest first, limit at a time; pass the next of a page as
+after to read the following one. The last 1000 events of each account are
+kept. Like tracked transactions they are kept in local storage, so under
+performance replication each cluster holds the events it handled. Deleting an
+account deletes its timeline; the decision log keeps the record.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"after": {
+					Type:        framework.TypeString,
+					Description: "Return only the events older than the one with this ID.",
+				},
+				"limit": {
+					Type:        framework.TypeInt,
+					Default:     DefaultActivityPage,
+					Description: "The most events to return.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathActivityRead,
+			},
+		},
+	}
+}
+
+// activityEvent names the event of a signing request: its path below the account
+func activityEvent(path, name string) string {
+	return strings.TrimPrefix(path, QualifiedPath(fmt.Sprintf("accounts/%s/", name)))
+}
+
+// recordActivity adds an event to the timeline of an account. The timeline
+// is a convenience for support staff, so it never fails the request.
+func (b *PluginBackend) recordActivity(ctx context.Context, req *logical.Request, name string, activity *ActivityJSON, resp *logical.Response, err error) {
+	now := time.Now().UTC()
+	activity.ID = fmt.Sprintf("%s-%s", now.Format("20060102T150405.000000000Z"), uuid.New()[:8])
+	activity.Time = now
+	activity.Path = req.Path
+	activity.EntityID = req.EntityID
+	activity.Verdict = verdictAllow
+	if err != nil {
+		activity.Verdict = verdictDeny
+		activity.ErrorCode = ErrorCode(err)
+		activity.Reason = err.Error()
+	}
+	if resp != nil && resp.Data != nil {
+		if hash, ok := resp.Data["transaction_hash"].(string); ok {
+			activity.TransactionHash = hash
+		}
+	}
+	if recorder := decisionFromContext(ctx); recorder != nil {
+		recorder.Lock()
+		activity.Chain = recorder.chain
+		activity.Memo = recorder.memo
+		recorder.Unlock()
+	}
+	if writeErr := b.writeActivity(ctx, req.Storage, name, activity); writeErr != nil && !isReadOnly(writeErr) {
+		b.Logger().Warn("cannot record account activity", "account", name, "event", activity.Event, "error", writeErr)
+	}
+}
+
+func (b *PluginBackend) writeActivity(ctx context.Context, s logical.Storage, name string, activity *ActivityJSON) error {
+	entry, err := logical.StorageEntryJSON(activityStoragePath(name, activity.ID), activity)
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+	ids, err := s.List(ctx, QualifiedPath(fmt.Sprintf("activity/%s/", name)))
+	if err != nil || len(ids) <= maxActivity {
+		return err
+	}
+	sort.Strings(ids)
+	for _, id := range ids[:len(ids)-maxActivity] {
+		if err := s.Delete(ctx, activityStoragePath(name, id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteActivity removes the timeline of an account that is deleted
+func deleteActivity(ctx context.Context, s logical.Storage, name string) error {
+	ids, err := s.List(ctx, QualifiedPath(fmt.Sprintf("activity/%s/", name)))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.Delete(ctx, activityStoragePath(name, id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *PluginBackend) pathActivityRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	if _, err := readAccount(ctx, req, name); err != nil {
+		return nil, err
+	}
+	limit := data.Get("limit").(int)
+	if limit <= 0 || limit > maxActivity {
+		return nil, fmt.Errorf("%w: limit must be 1 to %d", ErrInvalidInput, maxActivity)
+	}
+	ids, err := req.Storage.List(ctx, QualifiedPath(fmt.Sprintf("activity/%s/", name)))
+	if err != nil {
+		return nil, err
+	}
+	// IDs sort by time, so the newest are last
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	if after := data.Get("after").(string); after != Empty {
+		ids = ids[sort.Search(len(ids), func(i int) bool { return ids[i] < after }):]
+	}
+	next := Empty
+	if len(ids) > limit {
+		ids = ids[:limit]
+		next = ids[limit-1]
+	}
+
+	events := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		entry, err := req.Storage.Get(ctx, activityStoragePath(name, id))
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		var activity ActivityJSON
+		if err := entry.DecodeJSON(&activity); err != nil {
+			return nil, err
+		}
+		event := activity.responseData()
+		if activity.TransactionHash != Empty {
+			// the tracker keeps the status; a pruned or foreign transaction has none
+			if tx, err := readTx(ctx, req.Storage, common.HexToHash(activity.TransactionHash)); err == nil {
+				event["transaction_status"] = tx.Status
+				event["confirmations"] = tx.Confirmations
+				if tx.BlockHash != Empty {
+					event["block_number"] = tx.BlockNumber
+				}
+			}
+		}
+		events = append(events, event)
+	}
+	responseData := map[string]interface{}{
+		"events": events,
+	}
+	if next != Empty {
+		responseData["next"] = next
+	}
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
@@ -0,0 +1,228 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// AddressBookJSON is what we store for an address book label
+type AddressBookJSON struct {
+	Address string `json:"address"`
+	ChainID string `json:"chain_id"`
+}
+
+// toLabelSchema is the field that names the recipient by its address book label
+var toLabelSchema = &framework.FieldSchema{
+	Type:        framework.TypeString,
+	Description: "The address book label of the recipient; used instead of to.",
+}
+
+func addressBookPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("addressbook/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathAddressBookList,
+			},
+			HelpSynopsis: "List all the address book labels.",
+			HelpDescription: `
+			All the address book labels will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("addressbook/" + framework.GenericNameRegex("label")),
+			HelpSynopsis: "Create, read, update or delete an address book label.",
+			HelpDescription: `
+
+Map a human-readable label to an address. The transfer and sign-tx paths of
+accounts, and the ERC-20 transfer path, accept to_label in place of to; the
+response carries both the label and the address it resolved to, so both are
+recorded by the audit devices.
+
+When chain_id is set the label only resolves while this mount is configured
+for that chain.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"label": {Type: framework.TypeString, Description: "The label."},
+				"address": {
+					Type:        framework.TypeString,
+					Description: "The address the label resolves to.",
+				},
+				"chain_id": {
+					Type:        framework.TypeString,
+					Description: "The chain the label is scoped to; unscoped if unset.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathAddressBookRead,
+				logical.CreateOperation: b.pathAddressBookWrite,
+				logical.UpdateOperation: b.pathAddressBookWrite,
+				logical.DeleteOperation: b.pathAddressBookDelete,
+			},
+		},
+	}
+}
+
+func readAddressBookEntry(ctx context.Context, req *logical.Request, label string) (*AddressBookJSON, error) {
+	entry, err := req.Storage.Get(ctx, QualifiedPath(fmt.Sprintf("addressbook/%s", label)))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var addressBookJSON AddressBookJSON
+	if err := entry.DecodeJSON(&addressBookJSON); err != nil {
+		return nil, err
+	}
+	return &addressBookJSON, nil
+}
+
+func (entry *AddressBookJSON) responseData(label string) map[string]interface{} {
+	return map[string]interface{}{
+		"label":    label,
+		"address":  entry.Address,
+		"chain_id": entry.ChainID,
+	}
+}
+
+func (b *PluginBackend) pathAddressBookList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("addressbook/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathAddressBookRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	label := data.Get("label").(string)
+	entry, err := readAddressBookEntry(ctx, req, label)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: entry.responseData(label),
+	}, nil
+}
+
+func (b *PluginBackend) pathAddressBookWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	label := data.Get("label").(string)
+	address, err := config.parseAddress(data.Get("address").(string))
+	if err != nil {
+		return nil, wrapError(ErrInvalidAddress, err)
+	}
+	chainID := data.Get("chain_id").(string)
+	if chainID != Empty {
+		parsed, ok := new(big.Int).SetString(chainID, 10)
+		if !ok || parsed.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: %s is not a chain ID", ErrInvalidChainID, chainID)
+		}
+		chainID = parsed.String()
+	}
+	addressBookJSON := &AddressBookJSON{
+		Address: address.Hex(),
+		ChainID: chainID,
+	}
+	entry, err := logical.StorageEntryJSON(QualifiedPath(fmt.Sprintf("addressbook/%s", label)), addressBookJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: addressBookJSON.responseData(label),
+	}, nil
+}
+
+func (b *PluginBackend) pathAddressBookDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, QualifiedPath(fmt.Sprintf("addressbook/%s", data.Get("label").(string)))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// withAddressLabels resolves to_label into to before anything else sees the
+// request, so inclusions, exclusions and grant destinations apply to the
+// resolved address, and adds the label to the response
+func (b *PluginBackend) withAddressLabels(callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		labelRaw, ok := data.GetOk("to_label")
+		label, _ := labelRaw.(string)
+		if !ok || label == Empty {
+			return callback(ctx, req, data)
+		}
+		config, err := b.configured(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := readAddressBookEntry(ctx, req, label)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("%w: no address book label %s", ErrInvalidAddress, label)
+		}
+		if entry.ChainID != Empty {
+			chainID := util.ValidNumber(config.ChainID)
+			if chainID == nil {
+				return nil, ErrInvalidChainID
+			}
+			if chainID.String() != entry.ChainID {
+				return nil, fmt.Errorf("%w: label %s is scoped to chain %s", ErrPolicyViolation, label, entry.ChainID)
+			}
+		}
+		if to, ok := data.GetOk("to"); ok && to.(string) != Empty {
+			address, err := config.parseAddress(to.(string))
+			if err != nil {
+				return nil, wrapError(ErrInvalidAddress, err)
+			}
+			if address.Hex() != entry.Address {
+				return nil, fmt.Errorf("%w: to %s does not match label %s", ErrInvalidAddress, address.Hex(), label)
+			}
+		}
+		data.Raw["to"] = entry.Address
+		resp, err := callback(ctx, req, data)
+		if resp != nil && resp.Data != nil && err == nil {
+			resp.Data["to_label"] = label
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// AddressRegex matches a Core address with an optional 0x prefix
+const AddressRegex string = "(0x)?[0-9a-fA-F]{44}"
+
+// AddressJSON is the index entry mapping an address to its account name
+type AddressJSON struct {
+	Name string `json:"name"`
+}
+
+func addressPaths(b *PluginBackend) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern: QualifiedPath("addresses/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathAddressesList,
+			},
+			HelpSynopsis: "List all the indexed account addresses.",
+			HelpDescription: `
+			All the indexed account addresses will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("addresses/(?P<address>" + AddressRegex + ")"),
+			HelpSynopsis: "Return the account name for an address.",
+			HelpDescription: `
+
+Return the name of the account that controls an address.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"address": {Type: framework.TypeString, Description: "The address of the account."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathAddressRead,
+			},
+		},
+	}
+
+	// every accounts/<name>/<operation> path is also reachable as addresses/<address>/<operation>
+	return append(paths, aliasAccountPaths(b, QualifiedPath("addresses/(?P<address>"+AddressRegex+")"), "address", "The address of the account.", b.byAddress)...)
+}
+
+// aliasAccountPaths copies the accounts/<name>/<operation> paths under another
+// prefix whose capture field is resolved to an account name by wrap. When
+// operations are given only those are copied.
+func aliasAccountPaths(b *PluginBackend, prefix, field, description string, wrap func(framework.OperationFunc) framework.OperationFunc, operations ...string) []*framework.Path {
+	var paths []*framework.Path
+	accountPrefix := QualifiedPath("accounts/" + framework.GenericNameRegex("name"))
+	for _, path := range accountPaths(b) {
+		suffix := strings.TrimPrefix(path.Pattern, accountPrefix)
+		if suffix == path.Pattern || !strings.HasPrefix(suffix, "/") {
+			continue
+		}
+		if len(operations) > 0 && !util.Contains(operations, strings.TrimPrefix(suffix, "/")) {
+			continue
+		}
+		fields := map[string]*framework.FieldSchema{
+			field: {Type: framework.TypeString, Description: description},
+		}
+		for key, schema := range path.Fields {
+			if key != field {
+				fields[key] = schema
+			}
+		}
+		callbacks := make(map[logical.Operation]framework.OperationFunc, len(path.Callbacks))
+		for operation, callback := range path.Callbacks {
+			callbacks[operation] = wrap(callback)
+		}
+		paths = append(paths, &framework.Path{
+			Pattern:         prefix + suffix,
+			HelpSynopsis:    path.HelpSynopsis,
+			HelpDescription: path.HelpDescription,
+			Fields:          fields,
+			ExistenceCheck:  path.ExistenceCheck,
+			Callbacks:       callbacks,
+		})
+	}
+	return paths
+}
+
+func addressIndexPath(address common.Address) string {
+	return QualifiedPath(fmt.Sprintf("addresses/%s", address.Hex()))
+}
+
+// readAddressIndex returns the account name indexed for an address, or Empty
+func readAddressIndex(ctx context.Context, req *logical.Request, address common.Address) (string, error) {
+	entry, err := req.Storage.Get(ctx, addressIndexPath(address))
+	if err != nil {
+		return Empty, err
+	}
+	if entry == nil {
+		return Empty, nil
+	}
+	var addressJSON AddressJSON
+	if err := entry.DecodeJSON(&addressJSON); err != nil {
+		return Empty, err
+	}
+	return addressJSON.Name, nil
+}
+
+func writeAddressIndex(ctx context.Context, req *logical.Request, address common.Address, name string) error {
+	entry, err := logical.StorageEntryJSON(addressIndexPath(address), &AddressJSON{Name: name})
+	if err != nil {
+		return err
+	}
+	return req.Storage.Put(ctx, entry)
+}
+
+func deleteAddressIndex(ctx context.Context, req *logical.Request, address common.Address) error {
+	return req.Storage.Delete(ctx, addressIndexPath(address))
+}
+
+// checkDuplicateAccount returns an error if the address already belongs to a differently named account
+func (b *PluginBackend) checkDuplicateAccount(ctx context.Context, req *logical.Request, address common.Address, name string) error {
+	indexed, err := b.resolveAccountName(ctx, req, address)
+	if err != nil && !errors.Is(err, ErrAccountNotFound) {
+		return err
+	}
+	if indexed != Empty && indexed != name {
+		return fmt.Errorf("%w: %s is already managed by account %s", ErrAccountExists, address.Hex(), indexed)
+	}
+	return nil
+}
+
+// resolveAccountName looks an address up in the in-memory index, and then in
+// the addresses/ entries for accounts another node may have created since
+func (b *PluginBackend) resolveAccountName(ctx context.Context, req *logical.Request, address common.Address) (string, error) {
+	if err := b.accountIndex.build(ctx, req); err != nil {
+		return Empty, err
+	}
+	if name, ok := b.accountIndex.lookup(address); ok {
+		return name, nil
+	}
+	name, err := readAddressIndex(ctx, req, address)
+	if err != nil {
+		return Empty, err
+	}
+	if name == Empty {
+		return Empty, fmt.Errorf("%w: no account controls %s", ErrAccountNotFound, address.Hex())
+	}
+	b.accountIndex.set(address, name)
+	return name, nil
+}
+
+// indexAccount records the account that controls an address
+func (b *PluginBackend) indexAccount(ctx context.Context, req *logical.Request, address common.Address, name string) error {
+	if err := writeAddressIndex(ctx, req, address, name); err != nil {
+		return err
+	}
+	b.accountIndex.set(address, name)
+	return nil
+}
+
+// unindexAccount forgets the account that controlled an address
+func (b *PluginBackend) unindexAccount(ctx context.Context, req *logical.Request, address common.Address) error {
+	if err := deleteAddressIndex(ctx, req, address); err != nil {
+		return err
+	}
+	b.accountIndex.remove(address)
+	return nil
+}
+
+// byAddress resolves the address in the request path to an account name before calling the account handler
+func (b *PluginBackend) byAddress(callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		config, err := b.configured(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		address, err := config.parseAddress(data.Get("address").(string))
+		if err != nil {
+			return nil, wrapError(ErrInvalidAddress, err)
+		}
+		name, err := b.resolveAccountName(ctx, req, address)
+		if err != nil {
+			return nil, err
+		}
+		data.Raw["name"] = name
+		return callback(ctx, req, data)
+	}
+}
+
+func (b *PluginBackend) pathAddressesList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("addresses/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathAddressRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	address, err := config.parseAddress(data.Get("address").(string))
+	if err != nil {
+		return nil, wrapError(ErrInvalidAddress, err)
+	}
+	name, err := b.resolveAccountName(ctx, req, address)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address": address.Hex(),
+			"name":    name,
+		},
+	}, nil
+}
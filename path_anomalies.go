@@ -0,0 +1,541 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/core/types"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	anomalyVolumeSpike    string = "volume_spike"
+	anomalyNewDestination string = "new_destination"
+	anomalyUnusualHours   string = "unusual_hours"
+
+	anomalyActionApproval string = "approval"
+	anomalyActionFreeze   string = "freeze"
+
+	sensitivityLow    string = "low"
+	sensitivityMedium string = "medium"
+	sensitivityHigh   string = "high"
+
+	// DefaultAnomalyLearningTransactions is how many transactions an account signs before its anomalies are looked for
+	DefaultAnomalyLearningTransactions int = 50
+
+	// anomalyDays is the number of days of volume a profile keeps
+	anomalyDays int = 30
+	// maxAnomalyDestinations bounds the destinations a profile remembers; the least recent are forgotten
+	maxAnomalyDestinations int = 10000
+
+	eventAccountFrozen   string = "account_frozen"
+	eventAccountUnfrozen string = "account_unfrozen"
+)
+
+// anomalyRules are the rules anomaly_rules can turn on
+var anomalyRules = []string{anomalyNewDestination, anomalyUnusualHours, anomalyVolumeSpike}
+
+// anomalyThresholds is what a sensitivity makes an anomaly: a day whose count
+// or value of transactions is spikeFactor times the daily mean, and an hour of
+// the day in which at most hourShare of the learned transactions were signed
+var anomalyThresholds = map[string]struct {
+	spikeFactor int64
+	hourShare   float64
+}{
+	sensitivityLow:    {spikeFactor: 10, hourShare: 0},
+	sensitivityMedium: {spikeFactor: 5, hourShare: 0.01},
+	sensitivityHigh:   {spikeFactor: 3, hourShare: 0.05},
+}
+
+// anomalyLock serializes the updates of anomaly profiles
+var anomalyLock sync.Mutex
+
+// AnomalyDayJSON is the volume an account signed in one day
+type AnomalyDayJSON struct {
+	Transactions int    `json:"transactions"`
+	Value        string `json:"value"`
+}
+
+// AnomalyProfileJSON is what an account usually does, learned from the
+// transactions it signed
+type AnomalyProfileJSON struct {
+	Transactions int                        `json:"transactions"`
+	Days         map[string]*AnomalyDayJSON `json:"days"`
+	Hours        [24]int                    `json:"hours"`
+	Destinations map[string]time.Time       `json:"destinations"`
+	// Freeze and Anomaly are where earlier versions kept the anomaly freeze,
+	// in local storage; they are read until the account is unfrozen
+	Freeze  *FreezeJSON             `json:"freeze,omitempty"`
+	Anomaly *AnomalyObservationJSON `json:"anomaly,omitempty"`
+}
+
+// AnomalyFreezeJSON is the anomaly freeze of an account. Unlike profiles it
+// is replicated, so an account an anomaly froze is frozen on every cluster.
+type AnomalyFreezeJSON struct {
+	Freeze *FreezeJSON `json:"freeze"`
+	// Anomaly is the transaction that froze the account, learned when it is unfrozen
+	Anomaly *AnomalyObservationJSON `json:"anomaly,omitempty"`
+}
+
+// AnomalyObservationJSON is a transaction the anomaly rules looked at. One
+// that passed is learned once the request that signs it succeeds.
+type AnomalyObservationJSON struct {
+	account      string
+	Time         time.Time `json:"time"`
+	Value        *big.Int  `json:"value"`
+	Destinations []string  `json:"destinations"`
+}
+
+func anomalyStoragePath(name string) string {
+	return QualifiedPath("anomalies/" + name)
+}
+
+func anomalyFreezeStoragePath(name string) string {
+	return QualifiedPath("anomaly-freezes/" + name)
+}
+
+func anomalyPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/anomalies"),
+			HelpSynopsis: "Return or reset what an account usually does.",
+			HelpDescription: `
+
+Return the profile the anomaly rules compare the transactions of an account
+with: the transactions it signed, its daily volume over the last 30 days, the
+hours of the day it signs in and the number of destinations it has sent to,
+and whether an anomaly froze it. Delete the profile to relearn the account
+from scratch, for instance after its use changed; deleting does not unfreeze
+it.
+
+The rules in the config's anomaly_rules are looked at once an account has
+signed anomaly_learning_transactions transactions:
+
+  volume_spike     the transactions or the value signed today exceed the
+                   daily mean of the previous days by the sensitivity's factor
+  new_destination  the transaction sends to, or calls with, an address the
+                   account never sent to
+  unusual_hours    the account hardly ever signs at this hour of the day (UTC)
+
+How far from the profile a transaction must be is set by anomaly_sensitivity.
+By anomaly_action an anomalous transaction needs an approved authorization,
+or is refused and freezes the account until it is unfrozen. Profiles are kept
+in local storage, so under performance replication each cluster learns from
+the transactions it signs; a freeze is replicated and stops the account on
+every cluster.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathAnomaliesRead,
+				logical.DeleteOperation: b.pathAnomaliesDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/anomalies/unfreeze"),
+			HelpSynopsis: "Unfreeze an account an anomaly froze.",
+			HelpDescription: `
+
+Let an account sign again after an anomaly froze it. The transaction that
+froze it is learned with the unfreeze, so repeating it is not an anomaly
+again. Unfreezing raises an account_unfrozen event.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathAnomaliesUnfreeze,
+			},
+		},
+	}
+}
+
+func readAnomalyProfile(ctx context.Context, s logical.Storage, name string) (*AnomalyProfileJSON, error) {
+	entry, err := s.Get(ctx, anomalyStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	profile := &AnomalyProfileJSON{
+		Days:         map[string]*AnomalyDayJSON{},
+		Destinations: map[string]time.Time{},
+	}
+	if entry == nil {
+		return profile, nil
+	}
+	if err := entry.DecodeJSON(profile); err != nil {
+		return nil, err
+	}
+	if profile.Days == nil {
+		profile.Days = map[string]*AnomalyDayJSON{}
+	}
+	if profile.Destinations == nil {
+		profile.Destinations = map[string]time.Time{}
+	}
+	return profile, nil
+}
+
+func writeAnomalyProfile(ctx context.Context, s logical.Storage, name string, profile *AnomalyProfileJSON) error {
+	entry, err := logical.StorageEntryJSON(anomalyStoragePath(name), profile)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// readAnomalyFreeze returns the anomaly freeze of an account, whose Freeze is
+// nil if it is not frozen
+func readAnomalyFreeze(ctx context.Context, s logical.Storage, name string) (*AnomalyFreezeJSON, error) {
+	entry, err := s.Get(ctx, anomalyFreezeStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		var freeze AnomalyFreezeJSON
+		if err := entry.DecodeJSON(&freeze); err != nil {
+			return nil, err
+		}
+		return &freeze, nil
+	}
+	profile, err := readAnomalyProfile(ctx, s, name)
+	if err != nil {
+		return nil, err
+	}
+	return &AnomalyFreezeJSON{Freeze: profile.Freeze, Anomaly: profile.Anomaly}, nil
+}
+
+func writeAnomalyFreeze(ctx context.Context, s logical.Storage, name string, freeze *AnomalyFreezeJSON) error {
+	entry, err := logical.StorageEntryJSON(anomalyFreezeStoragePath(name), freeze)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// learn adds a signed transaction to the profile
+func (profile *AnomalyProfileJSON) learn(observation *AnomalyObservationJSON) {
+	profile.Transactions++
+	profile.Hours[observation.Time.Hour()]++
+	key := observation.Time.Format("2006-01-02")
+	day, ok := profile.Days[key]
+	if !ok {
+		day = &AnomalyDayJSON{Value: "0"}
+		profile.Days[key] = day
+	}
+	day.Transactions++
+	value, _ := new(big.Int).SetString(day.Value, 10)
+	if value == nil {
+		value = new(big.Int)
+	}
+	day.Value = value.Add(value, observation.Value).String()
+	oldest := observation.Time.AddDate(0, 0, -anomalyDays).Format("2006-01-02")
+	for key := range profile.Days {
+		if key < oldest {
+			delete(profile.Days, key)
+		}
+	}
+	for _, destination := range observation.Destinations {
+		profile.Destinations[destination] = observation.Time
+	}
+	if excess := len(profile.Destinations) - maxAnomalyDestinations; excess > 0 {
+		destinations := make([]string, 0, len(profile.Destinations))
+		for destination := range profile.Destinations {
+			destinations = append(destinations, destination)
+		}
+		sort.Slice(destinations, func(i, j int) bool {
+			return profile.Destinations[destinations[i]].Before(profile.Destinations[destinations[j]])
+		})
+		for _, destination := range destinations[:excess] {
+			delete(profile.Destinations, destination)
+		}
+	}
+}
+
+// anomalies returns the rules an observation breaks
+func (profile *AnomalyProfileJSON) anomalies(config *ConfigJSON, observation *AnomalyObservationJSON) []string {
+	thresholds := anomalyThresholds[config.anomalySensitivity()]
+	found := []string{}
+	for _, rule := range config.AnomalyRules {
+		switch rule {
+		case anomalyVolumeSpike:
+			today := observation.Time.Format("2006-01-02")
+			count, value, days := int64(0), new(big.Int), int64(0)
+			for key, day := range profile.Days {
+				if key == today {
+					continue
+				}
+				days++
+				count += int64(day.Transactions)
+				if dayValue, ok := new(big.Int).SetString(day.Value, 10); ok {
+					value.Add(value, dayValue)
+				}
+			}
+			if days == 0 {
+				continue
+			}
+			todayCount, todayValue := int64(1), new(big.Int).Set(observation.Value)
+			if day, ok := profile.Days[today]; ok {
+				todayCount += int64(day.Transactions)
+				if dayValue, ok := new(big.Int).SetString(day.Value, 10); ok {
+					todayValue.Add(todayValue, dayValue)
+				}
+			}
+			// compare today times the days with the sum rather than divide into a mean
+			spikeValue := new(big.Int).Mul(value, big.NewInt(thresholds.spikeFactor))
+			if todayCount*days > thresholds.spikeFactor*count ||
+				(value.Sign() > 0 && new(big.Int).Mul(todayValue, big.NewInt(days)).Cmp(spikeValue) > 0) {
+				found = append(found, rule)
+			}
+		case anomalyNewDestination:
+			for _, destination := range observation.Destinations {
+				if _, ok := profile.Destinations[destination]; !ok {
+					found = append(found, rule)
+					break
+				}
+			}
+		case anomalyUnusualHours:
+			if float64(profile.Hours[observation.Time.Hour()]) <= thresholds.hourShare*float64(profile.Transactions) {
+				found = append(found, rule)
+			}
+		}
+	}
+	return found
+}
+
+// checkAnomalies compares a transaction with the profile of the account and,
+// if it is anomalous, asks for an authorization or freezes the account
+func (b *PluginBackend) checkAnomalies(ctx context.Context, scope *signingScope, config *ConfigJSON, tx *types.Transaction, call *DecodedCall) error {
+	if len(config.AnomalyRules) == 0 {
+		return nil
+	}
+	observation := &AnomalyObservationJSON{
+		account: scope.account,
+		Time:    time.Now().UTC(),
+		Value:   tx.Value(),
+	}
+	for _, destination := range destinations(tx, call) {
+		observation.Destinations = append(observation.Destinations, strings.ToLower(destination))
+	}
+	anomalyLock.Lock()
+	profile, err := readAnomalyProfile(ctx, scope.req.Storage, scope.account)
+	anomalyLock.Unlock()
+	if err != nil {
+		return err
+	}
+	var found []string
+	if profile.Transactions >= config.anomalyLearningTransactions() {
+		found = profile.anomalies(config, observation)
+	}
+	if len(found) > 0 {
+		reason := "anomalous transaction: " + strings.Join(found, ", ")
+		if config.anomalyAction() == anomalyActionFreeze {
+			err = b.freezeAccount(ctx, scope.req, config, scope.account, reason, observation)
+		} else if err = b.useAuthorization(ctx, scope.req, scope.account); err != nil {
+			err = fmt.Errorf("%w (%s)", err, reason)
+		}
+	}
+	recordRule(ctx, "anomaly", err)
+	if err != nil {
+		return err
+	}
+	if recorder := decisionFromContext(ctx); recorder != nil {
+		recorder.Lock()
+		recorder.anomalies = append(recorder.anomalies, observation)
+		recorder.Unlock()
+	}
+	return nil
+}
+
+// freezeAccount freezes an account for an anomaly and returns the refusal of
+// the transaction, which is kept to be learned if the account is unfrozen
+func (b *PluginBackend) freezeAccount(ctx context.Context, req *logical.Request, config *ConfigJSON, name, reason string, observation *AnomalyObservationJSON) error {
+	anomalyLock.Lock()
+	defer anomalyLock.Unlock()
+	freeze := &AnomalyFreezeJSON{
+		Freeze: &FreezeJSON{
+			Reason:   reason,
+			FrozenAt: observation.Time,
+			FrozenBy: req.EntityID,
+		},
+		Anomaly: observation,
+	}
+	if err := writeAnomalyFreeze(ctx, req.Storage, name, freeze); err != nil {
+		return err
+	}
+	b.notify(config, req, eventAccountFrozen, map[string]interface{}{
+		"account": name,
+		"reason":  reason,
+	})
+	return fmt.Errorf("%w: %s", ErrAccountFrozen, reason)
+}
+
+// checkAnomalyFreeze refuses to sign for an account an anomaly froze
+func checkAnomalyFreeze(ctx context.Context, s logical.Storage, name string) error {
+	freeze, err := readAnomalyFreeze(ctx, s, name)
+	if err != nil || freeze.Freeze == nil {
+		return err
+	}
+	err = fmt.Errorf("%w since %s: %s", ErrAccountFrozen, freeze.Freeze.FrozenAt.Format(time.RFC3339), freeze.Freeze.Reason)
+	recordRule(ctx, "anomaly_freeze", err)
+	return err
+}
+
+// learnAnomalies adds the transactions a successful request signed for an
+// account to its profile. Like the activity timeline it never fails the request.
+func (b *PluginBackend) learnAnomalies(ctx context.Context, req *logical.Request, name string) {
+	recorder := decisionFromContext(ctx)
+	if recorder == nil {
+		return
+	}
+	recorder.Lock()
+	observations, kept := []*AnomalyObservationJSON{}, []*AnomalyObservationJSON{}
+	for _, observation := range recorder.anomalies {
+		if observation.account == name {
+			observations = append(observations, observation)
+		} else {
+			kept = append(kept, observation)
+		}
+	}
+	recorder.anomalies = kept
+	recorder.Unlock()
+	if len(observations) == 0 {
+		return
+	}
+	anomalyLock.Lock()
+	defer anomalyLock.Unlock()
+	profile, err := readAnomalyProfile(ctx, req.Storage, name)
+	if err == nil {
+		for _, observation := range observations {
+			profile.learn(observation)
+		}
+		err = writeAnomalyProfile(ctx, req.Storage, name, profile)
+	}
+	if err != nil {
+		b.Logger().Warn("cannot learn the transactions of an account", "account", name, "error", err)
+	}
+}
+
+// deleteAnomalyProfile removes the profile and the freeze of an account that is deleted
+func deleteAnomalyProfile(ctx context.Context, s logical.Storage, name string) error {
+	if err := s.Delete(ctx, anomalyFreezeStoragePath(name)); err != nil {
+		return err
+	}
+	return s.Delete(ctx, anomalyStoragePath(name))
+}
+
+func (profile *AnomalyProfileJSON) responseData(freeze *AnomalyFreezeJSON) map[string]interface{} {
+	days := make(map[string]interface{}, len(profile.Days))
+	for key, day := range profile.Days {
+		days[key] = map[string]interface{}{
+			"transactions": day.Transactions,
+			"value":        day.Value,
+		}
+	}
+	result := map[string]interface{}{
+		"transactions": profile.Transactions,
+		"days":         days,
+		"hours":        profile.Hours[:],
+		"destinations": len(profile.Destinations),
+		"frozen":       freeze.Freeze != nil,
+	}
+	if freeze.Freeze != nil {
+		result["reason"] = freeze.Freeze.Reason
+		result["frozen_at"] = freeze.Freeze.FrozenAt.Format(time.RFC3339)
+	}
+	return result
+}
+
+func (b *PluginBackend) pathAnomaliesRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	if _, err := readAccount(ctx, req, name); err != nil {
+		return nil, err
+	}
+	profile, err := readAnomalyProfile(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	freeze, err := readAnomalyFreeze(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: profile.responseData(freeze),
+	}, nil
+}
+
+func (b *PluginBackend) pathAnomaliesDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	anomalyLock.Lock()
+	defer anomalyLock.Unlock()
+	freeze, err := readAnomalyFreeze(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	// a freeze an earlier version kept in the profile moves out of it
+	if freeze.Freeze != nil {
+		if err := writeAnomalyFreeze(ctx, req.Storage, name, freeze); err != nil {
+			return nil, err
+		}
+	}
+	return nil, req.Storage.Delete(ctx, anomalyStoragePath(name))
+}
+
+func (b *PluginBackend) pathAnomaliesUnfreeze(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	if _, err := readAccount(ctx, req, name); err != nil {
+		return nil, err
+	}
+	anomalyLock.Lock()
+	defer anomalyLock.Unlock()
+	freeze, err := readAnomalyFreeze(ctx, req.Storage, name)
+	if err != nil || freeze.Freeze == nil {
+		return nil, err
+	}
+	profile, err := readAnomalyProfile(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if freeze.Anomaly != nil {
+		profile.learn(freeze.Anomaly)
+	}
+	profile.Freeze, profile.Anomaly = nil, nil
+	if err := writeAnomalyProfile(ctx, req.Storage, name, profile); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, anomalyFreezeStoragePath(name)); err != nil {
+		return nil, err
+	}
+	b.notify(config, req, eventAccountUnfrozen, map[string]interface{}{
+		"account": name,
+		"reason":  freeze.Freeze.Reason,
+	})
+	return &logical.Response{
+		Data: profile.responseData(&AnomalyFreezeJSON{}),
+	}, nil
+}
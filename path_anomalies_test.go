@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAnomalyFreezeIsReplicated(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	req := &logical.Request{Storage: storage}
+	observation := &AnomalyObservationJSON{Time: time.Now()}
+	if err := b.freezeAccount(ctx, req, &ConfigJSON{}, "frozen", "new_destination", observation); !errors.Is(err, ErrAccountFrozen) {
+		t.Fatalf("freezing refused the transaction with %v", err)
+	}
+	keys, err := logical.CollectKeys(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		for _, prefix := range LocalPaths(b) {
+			if strings.HasPrefix(key, prefix) && strings.HasSuffix(key, "/frozen") {
+				t.Fatalf("the freeze is kept in %s, which is not replicated", key)
+			}
+		}
+	}
+	if err := checkAnomalyFreeze(ctx, storage, "frozen"); !errors.Is(err, ErrAccountFrozen) {
+		t.Fatalf("a frozen account was let through: %v", err)
+	}
+
+	// a freeze an earlier version kept in the local profile still holds
+	legacy := &AnomalyProfileJSON{Freeze: &FreezeJSON{Reason: "volume_spike", FrozenAt: time.Now()}}
+	if err := writeAnomalyProfile(ctx, storage, "legacy", legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAnomalyFreeze(ctx, storage, "legacy"); !errors.Is(err, ErrAccountFrozen) {
+		t.Fatalf("a freeze kept in the profile was lost: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// pagerDutyEventsURL is the PagerDuty Events API v2
+	pagerDutyEventsURL string = "https://events.pagerduty.com/v2/enqueue"
+	// approvalCallbackSkew is how old or early the timestamp of a callback may be
+	approvalCallbackSkew = 5 * time.Minute
+
+	actionApprove string = "approve"
+	actionReject  string = "reject"
+)
+
+func approvalPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("approval-callback/" + framework.GenericNameRegex("id")),
+			HelpSynopsis: "Approve or reject an export request from a signed callback.",
+			HelpDescription: `
+
+Approve or reject a pending export request on behalf of an approver, for the
+relay behind the Slack or PagerDuty approval requests. The path takes no Vault
+token; instead signature must be the hex HMAC-SHA256, keyed with
+approval_callback_secret, of the ID, action, approver and timestamp joined by
+newlines. The timestamp, in Unix seconds, must be within five minutes. The
+approver is the identity entity the relay vouches for and is held to the same
+rules as exports/<id>/approve.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString, Description: "The ID of the export request."},
+				"action": {
+					Type:        framework.TypeString,
+					Description: "approve or reject.",
+				},
+				"approver": {
+					Type:        framework.TypeString,
+					Description: "The identity entity ID of the approver.",
+				},
+				"timestamp": {
+					Type:        framework.TypeString,
+					Description: "When the approver acted, in Unix seconds.",
+				},
+				"signature": {
+					Type:        framework.TypeString,
+					Description: "The hex HMAC-SHA256 of the callback.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.unlessFrozen(b.pathApprovalCallback),
+			},
+		},
+	}
+}
+
+// approvalLink is the deep link to a pending export request
+func approvalLink(config *ConfigJSON, id string) string {
+	if config.ApprovalLinkURL == Empty {
+		return Empty
+	}
+	return strings.ReplaceAll(config.ApprovalLinkURL, "{id}", id)
+}
+
+// requestApproval posts an approval request for a pending export to Slack
+// and PagerDuty. Like notifications it is delivered in the background.
+func (b *PluginBackend) requestApproval(config *ConfigJSON, export *ExportJSON) {
+	subject := "account " + export.Account
+	if export.BLSKey != Empty {
+		subject = "BLS key " + export.BLSKey
+	}
+	summary := fmt.Sprintf("Export of %s requested by entity %s awaits approval until %s", subject, export.RequesterEntityID, export.ExpiresAt.UTC().Format(time.RFC3339))
+	link := approvalLink(config, export.ID)
+	if config.ApprovalSlackWebhookURL != Empty {
+		text := summary + " (exports/" + export.ID + ")"
+		if link != Empty {
+			text += "\n<" + link + "|Review the request>"
+		}
+		b.deliver("approval_requested", config.ApprovalSlackWebhookURL, map[string]interface{}{"text": text})
+	}
+	if config.ApprovalPagerDutyRoutingKey != Empty {
+		event := map[string]interface{}{
+			"routing_key":  config.ApprovalPagerDutyRoutingKey,
+			"event_action": "trigger",
+			"dedup_key":    "export-" + export.ID,
+			"payload": map[string]interface{}{
+				"summary":  summary,
+				"source":   "vault-core",
+				"severity": "warning",
+				"custom_details": map[string]interface{}{
+					"export_id": export.ID,
+					"requester": export.RequesterEntityID,
+				},
+			},
+		}
+		if link != Empty {
+			event["links"] = []map[string]string{{"href": link, "text": "Review the request"}}
+		}
+		b.deliver("approval_requested", pagerDutyEventsURL, event)
+	}
+}
+
+// resolveApproval tells Slack and PagerDuty that an export request was decided
+func (b *PluginBackend) resolveApproval(config *ConfigJSON, export *ExportJSON, action, approver string) {
+	if config.ApprovalSlackWebhookURL != Empty {
+		b.deliver("approval_resolved", config.ApprovalSlackWebhookURL, map[string]interface{}{
+			"text": fmt.Sprintf("Export request %s: %s by entity %s", export.ID, action, approver),
+		})
+	}
+	if config.ApprovalPagerDutyRoutingKey != Empty {
+		b.deliver("approval_resolved", pagerDutyEventsURL, map[string]interface{}{
+			"routing_key":  config.ApprovalPagerDutyRoutingKey,
+			"event_action": "resolve",
+			"dedup_key":    "export-" + export.ID,
+		})
+	}
+}
+
+// callbackSignature is the HMAC a relay signs an approval callback with
+func callbackSignature(secret, id, action, approver, timestamp string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{id, action, approver, timestamp}, "\n")))
+	return mac.Sum(nil)
+}
+
+func (b *PluginBackend) pathApprovalCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if config.ApprovalCallbackSecret == Empty {
+		return nil, fmt.Errorf("%w: approval callbacks are disabled until approval_callback_secret is configured", ErrApprovalRequired)
+	}
+	id := data.Get("id").(string)
+	action := data.Get("action").(string)
+	approver := data.Get("approver").(string)
+	timestamp := data.Get("timestamp").(string)
+	signature, err := hex.DecodeString(data.Get("signature").(string))
+	if err != nil || !hmac.Equal(signature, callbackSignature(config.ApprovalCallbackSecret, id, action, approver, timestamp)) {
+		return nil, fmt.Errorf("%w: the callback signature is invalid", ErrApprovalRequired)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: timestamp must be Unix seconds", ErrInvalidInput)
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > approvalCallbackSkew || skew < -approvalCallbackSkew {
+		return nil, fmt.Errorf("%w: the callback is stale", ErrApprovalRequired)
+	}
+	defer lockExport(id)()
+	export, err := readExport(ctx, req, id)
+	if err != nil {
+		return nil, err
+	}
+	switch action {
+	case actionApprove, actionReject:
+	default:
+		return nil, fmt.Errorf("%w: action must be %s or %s", ErrInvalidInput, actionApprove, actionReject)
+	}
+	if err := b.decideExport(ctx, req, config, export, approver, action); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: export.responseData(),
+	}, nil
+}
@@ -0,0 +1,483 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// DefaultAuthorizationTTL is how long an authorization may wait for approval and use, in seconds
+	DefaultAuthorizationTTL int = 3600
+
+	authorizationPending  string = "pending"
+	authorizationApproved string = "approved"
+	authorizationUsed     string = "used"
+	authorizationRejected string = "rejected"
+	authorizationExpired  string = "expired"
+
+	eventAuthorizationRequested string = "authorization_requested"
+
+	// redactedPrefix marks a secret parameter an authorization holds only the digest of
+	redactedPrefix string = "sha256:"
+)
+
+// authorizationLock serializes the use of authorizations, so two requests cannot both use one
+var authorizationLock sync.Mutex
+
+// authorizationsHeld are the authorizations signing requests hold until they
+// have signed; no other request can use one meanwhile
+var authorizationsHeld = map[string]bool{}
+
+// AuthorizationJSON is an authorizer's approval of exactly one request: a path
+// of the mount with its parameters, made by the requester
+type AuthorizationJSON struct {
+	ID      string `json:"id"`
+	Account string `json:"account"`
+	Path    string `json:"path"`
+	// Parameters are shown to the authorizer; the request must carry the same
+	Parameters        map[string]interface{} `json:"parameters"`
+	ParametersHash    string                 `json:"parameters_hash"`
+	RequesterEntityID string                 `json:"requester_entity_id"`
+	CreatedAt         time.Time              `json:"created_at"`
+	ExpiresAt         time.Time              `json:"expires_at"`
+	ApproverEntityID  string                 `json:"approver_entity_id,omitempty"`
+	ApproverGroup     string                 `json:"approver_group,omitempty"`
+	ApprovedAt        time.Time              `json:"approved_at"`
+	RejecterEntityID  string                 `json:"rejecter_entity_id,omitempty"`
+	RejectedAt        time.Time              `json:"rejected_at"`
+	UsedAt            time.Time              `json:"used_at"`
+}
+
+func (authorization *AuthorizationJSON) status(now time.Time) string {
+	switch {
+	case !authorization.UsedAt.IsZero():
+		return authorizationUsed
+	case !authorization.RejectedAt.IsZero():
+		return authorizationRejected
+	case now.After(authorization.ExpiresAt):
+		return authorizationExpired
+	case !authorization.ApprovedAt.IsZero():
+		return authorizationApproved
+	}
+	return authorizationPending
+}
+
+func (authorization *AuthorizationJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"id":                  authorization.ID,
+		"account":             authorization.Account,
+		"path":                authorization.Path,
+		"parameters":          authorization.Parameters,
+		"status":              authorization.status(time.Now()),
+		"requester_entity_id": authorization.RequesterEntityID,
+		"created_at":          authorization.CreatedAt.UTC().Format(time.RFC3339),
+		"expires_at":          authorization.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if !authorization.ApprovedAt.IsZero() {
+		result["approver_entity_id"] = authorization.ApproverEntityID
+		result["approver_group"] = authorization.ApproverGroup
+		result["approved_at"] = authorization.ApprovedAt.UTC().Format(time.RFC3339)
+	}
+	if !authorization.RejectedAt.IsZero() {
+		result["rejecter_entity_id"] = authorization.RejecterEntityID
+		result["rejected_at"] = authorization.RejectedAt.UTC().Format(time.RFC3339)
+	}
+	if !authorization.UsedAt.IsZero() {
+		result["used_at"] = authorization.UsedAt.UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+// authorizationIDSchema is the field a request names its approved authorization with
+var authorizationIDSchema = &framework.FieldSchema{
+	Type:        framework.TypeString,
+	Description: "The ID of an approved authorization of this request, which it uses up.",
+}
+
+func authorizationPaths(b *PluginBackend) []*framework.Path {
+	idField := map[string]*framework.FieldSchema{
+		"id": {Type: framework.TypeString, Description: "The ID of the authorization."},
+	}
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/authorizations"),
+			HelpSynopsis: "Ask an authorizer to approve one request for an account.",
+			HelpDescription: `
+
+Create a pending authorization of one request: path is the path of the mount
+the request will be made to, such as accounts/<name>/sign-tx, and parameters
+are exactly the parameters it will carry, without authorization_id. A member
+of one of the authorizer_groups other than the requester approves it through
+authorizations/<id>/approve; an account's approver_groups replace
+authorizer_groups for it. The requester then makes the request with
+authorization_id set; the parameters must match, and the authorization is
+used up by that request whatever its outcome.
+
+Signing requests for warm accounts, changes to the tier or approver groups of
+an account, and the operations and transactions control_group_operations,
+control_group_min_amount and control_group_min_usd name need an
+authorization. So do signing requests from outside an account's source_cidrs
+or outside its signing_windows, as exceptions, and transactions to
+destinations the screening API rates screening_approval_risk or higher. Passphrase shares are never part of one, and a mnemonic is
+shown to the authorizer only as its SHA-256.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"path": {
+					Type:        framework.TypeString,
+					Description: "The path the request will be made to, below the mount.",
+				},
+				"parameters": {
+					Type:        framework.TypeMap,
+					Description: "The parameters the request will carry.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathAuthorizationRequest,
+				logical.UpdateOperation: b.pathAuthorizationRequest,
+			},
+		},
+		{
+			Pattern: QualifiedPath("authorizations/?"),
+			Fields:  listPageSchema(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathAuthorizationsList,
+			},
+			HelpSynopsis: "List all the authorizations.",
+			HelpDescription: `
+			All the authorizations will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("authorizations/" + framework.GenericNameRegex("id")),
+			HelpSynopsis: "Return an authorization: what it approves and whether it is pending, approved, used, rejected or expired.",
+			Fields:       idField,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathAuthorizationRead,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("authorizations/" + framework.GenericNameRegex("id") + "/approve"),
+			HelpSynopsis: "Approve a pending authorization. The caller must belong to an authorizer group and must not be the requester.",
+			Fields:       idField,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.unlessFrozen(b.pathAuthorizationApprove),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("authorizations/" + framework.GenericNameRegex("id") + "/reject"),
+			HelpSynopsis: "Reject a pending authorization. The caller must belong to an authorizer group and must not be the requester.",
+			Fields:       idField,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathAuthorizationReject,
+			},
+		},
+	}
+}
+
+func authorizationStoragePath(id string) string {
+	return QualifiedPath(fmt.Sprintf("authorizations/%s", id))
+}
+
+func readAuthorization(ctx context.Context, s logical.Storage, id string) (*AuthorizationJSON, error) {
+	entry, err := s.Get(ctx, authorizationStoragePath(id))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: no authorization %s", ErrInvalidInput, id)
+	}
+	var authorization AuthorizationJSON
+	if err := entry.DecodeJSON(&authorization); err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+func writeAuthorization(ctx context.Context, s logical.Storage, authorization *AuthorizationJSON) error {
+	entry, err := logical.StorageEntryJSON(authorizationStoragePath(authorization.ID), authorization)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// redactParameters replaces the mnemonic a key replacement carries with its
+// digest, so that authorizing it does not store or show the key
+func redactParameters(parameters map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(parameters))
+	for key, value := range parameters {
+		redacted[key] = value
+	}
+	if mnemonic, ok := parameters["mnemonic"].(string); ok && mnemonic != Empty {
+		digest := sha256.Sum256([]byte(mnemonic))
+		redacted["mnemonic"] = redactedPrefix + hex.EncodeToString(digest[:])
+	}
+	return redacted
+}
+
+// parametersHash hashes the parameters of a request, leaving out the ones
+// that are not authorized: the authorization itself and passphrase shares
+func parametersHash(parameters map[string]interface{}) (string, error) {
+	authorized := make(map[string]interface{}, len(parameters))
+	for key, value := range redactParameters(parameters) {
+		if key != "authorization_id" && key != "passphrase_shares" && key != "mfa_code" {
+			authorized[key] = value
+		}
+	}
+	// maps are encoded with sorted keys
+	encoded, err := json.Marshal(authorized)
+	if err != nil {
+		return Empty, err
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func (b *PluginBackend) pathAuthorizationRequest(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.EntityID == Empty {
+		return nil, fmt.Errorf("%w: authorizations must be requested by an identity entity", ErrApprovalRequired)
+	}
+	name := data.Get("name").(string)
+	groups, err := approverGroups(ctx, req, name, config.AuthorizerGroups)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("%w: authorizations are disabled until authorizer_groups is configured", ErrApprovalRequired)
+	}
+	path := strings.Trim(data.Get("path").(string), "/")
+	if path == Empty {
+		return nil, fmt.Errorf("%w: path is required", ErrInvalidInput)
+	}
+	parameters := data.Get("parameters").(map[string]interface{})
+	if _, ok := parameters["passphrase_shares"]; ok {
+		return nil, fmt.Errorf("%w: passphrase shares are supplied with the request, not authorized", ErrInvalidInput)
+	}
+	parameters = redactParameters(parameters)
+	hash, err := parametersHash(parameters)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	authorization := &AuthorizationJSON{
+		ID:                uuid.New(),
+		Account:           name,
+		Path:              path,
+		Parameters:        parameters,
+		ParametersHash:    hash,
+		RequesterEntityID: req.EntityID,
+		CreatedAt:         now,
+		ExpiresAt:         now.Add(time.Duration(config.authorizationTTL()) * time.Second),
+	}
+	if err := writeAuthorization(ctx, req.Storage, authorization); err != nil {
+		return nil, err
+	}
+	b.notify(config, req, eventAuthorizationRequested, map[string]interface{}{
+		"authorization_id": authorization.ID,
+		"account":          name,
+		"path":             path,
+	})
+	return &logical.Response{
+		Data: authorization.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathAuthorizationsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ids, err := req.Storage.List(ctx, QualifiedPath("authorizations/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(listPage(ids, data)), nil
+}
+
+func (b *PluginBackend) pathAuthorizationRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	authorization, err := readAuthorization(ctx, req.Storage, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: authorization.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathAuthorizationApprove(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.pathAuthorizationDecide(ctx, req, data, actionApprove)
+}
+
+func (b *PluginBackend) pathAuthorizationReject(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.pathAuthorizationDecide(ctx, req, data, actionReject)
+}
+
+func (b *PluginBackend) pathAuthorizationDecide(ctx context.Context, req *logical.Request, data *framework.FieldData, action string) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	authorizationLock.Lock()
+	defer authorizationLock.Unlock()
+	authorization, err := readAuthorization(ctx, req.Storage, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if status := authorization.status(time.Now()); status != authorizationPending {
+		return nil, fmt.Errorf("%w: authorization is %s", ErrApprovalRequired, status)
+	}
+	if req.EntityID == authorization.RequesterEntityID {
+		return nil, fmt.Errorf("%w: the requester cannot decide their own authorization", ErrApprovalRequired)
+	}
+	groups, err := approverGroups(ctx, req, authorization.Account, config.AuthorizerGroups)
+	if err != nil {
+		return nil, err
+	}
+	group, err := b.identityGroup(groups, req.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	if group == Empty {
+		return nil, fmt.Errorf("%w: caller is not a member of an authorizer group", ErrApprovalRequired)
+	}
+	if action == actionReject {
+		authorization.RejecterEntityID = req.EntityID
+		authorization.RejectedAt = time.Now()
+	} else {
+		authorization.ApproverEntityID = req.EntityID
+		authorization.ApproverGroup = group
+		authorization.ApprovedAt = time.Now()
+	}
+	if err := writeAuthorization(ctx, req.Storage, authorization); err != nil {
+		return nil, err
+	}
+	b.recordActivity(ctx, req, authorization.Account, &ActivityJSON{Event: "authorization_" + action}, nil, nil)
+	return &logical.Response{
+		Data: authorization.responseData(),
+	}, nil
+}
+
+// useAuthorization uses up the approved authorization the request names for
+// the account. Several signing steps of one request, such as the transactions
+// of a batch, share it. Behind the signing guards it is only held, and
+// settleAuthorization uses it up once the operation has signed: a request
+// that fails to sign keeps it.
+func (b *PluginBackend) useAuthorization(ctx context.Context, req *logical.Request, account string) error {
+	id, _ := req.Data["authorization_id"].(string)
+	if id == Empty {
+		return fmt.Errorf("%w: request an authorization of this request through accounts/%s/authorizations and pass its authorization_id", ErrApprovalRequired, account)
+	}
+	recorder := decisionFromContext(ctx)
+	if recorder != nil {
+		recorder.Lock()
+		used := recorder.authorization
+		recorder.Unlock()
+		if used == id {
+			return nil
+		}
+	}
+
+	authorizationLock.Lock()
+	defer authorizationLock.Unlock()
+	authorization, err := readAuthorization(ctx, req.Storage, id)
+	if err != nil {
+		return err
+	}
+	if status := authorization.status(time.Now()); status != authorizationApproved {
+		return fmt.Errorf("%w: authorization %s is %s", ErrApprovalRequired, id, status)
+	}
+	hash, err := parametersHash(req.Data)
+	if err != nil {
+		return err
+	}
+	switch {
+	case authorization.Account != account:
+		return fmt.Errorf("%w: authorization %s is for account %s", ErrApprovalRequired, id, authorization.Account)
+	case authorization.Path != strings.Trim(req.Path, "/"):
+		return fmt.Errorf("%w: authorization %s is for %s", ErrApprovalRequired, id, authorization.Path)
+	case authorization.RequesterEntityID != req.EntityID:
+		return fmt.Errorf("%w: authorization %s was requested by another entity", ErrApprovalRequired, id)
+	case authorization.ParametersHash != hash:
+		return fmt.Errorf("%w: the parameters differ from those authorization %s approved", ErrApprovalRequired, id)
+	}
+	if scope, _ := ctx.Value(signingScopeKey{}).(*signingScope); scope != nil {
+		if authorizationsHeld[id] {
+			return fmt.Errorf("%w: authorization %s is held by another request", ErrApprovalRequired, id)
+		}
+		authorizationsHeld[id] = true
+		scope.authorization = id
+	} else {
+		authorization.UsedAt = time.Now()
+		if err := writeAuthorization(ctx, req.Storage, authorization); err != nil {
+			return err
+		}
+	}
+	if recorder != nil {
+		recorder.Lock()
+		recorder.authorization = id
+		recorder.Unlock()
+	}
+	return nil
+}
+
+// settleAuthorization uses up the authorization a signing request holds once
+// it has signed, and releases it when it has not. An authorization that
+// cannot be marked used stays held, so this node never lets it sign again.
+func settleAuthorization(ctx context.Context, signed bool) error {
+	scope, _ := ctx.Value(signingScopeKey{}).(*signingScope)
+	if scope == nil || scope.authorization == Empty {
+		return nil
+	}
+	id := scope.authorization
+	scope.authorization = Empty
+	authorizationLock.Lock()
+	defer authorizationLock.Unlock()
+	if !signed {
+		delete(authorizationsHeld, id)
+		if recorder := decisionFromContext(ctx); recorder != nil {
+			recorder.Lock()
+			if recorder.authorization == id {
+				recorder.authorization = Empty
+			}
+			recorder.Unlock()
+		}
+		return nil
+	}
+	authorization, err := readAuthorization(ctx, scope.req.Storage, id)
+	if err != nil {
+		return err
+	}
+	authorization.UsedAt = time.Now()
+	if err := writeAuthorization(ctx, scope.req.Storage, authorization); err != nil {
+		return err
+	}
+	delete(authorizationsHeld, id)
+	return nil
+}
@@ -0,0 +1,362 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// backupBundleVersion is the format of the bundles backup/bundle writes
+	backupBundleVersion int = 1
+
+	backupOK             string = "ok"
+	backupDestroyed      string = "destroyed"
+	backupDestroyedSince string = "destroyed_since_bundle"
+	backupMissingDataKey string = "missing_data_key"
+	backupBadDataKey     string = "data_key_undecryptable"
+	backupBadEnvelope    string = "envelope_undecryptable"
+	backupBadKey         string = "key_invalid"
+	backupWrongAddress   string = "address_mismatch"
+	backupPlaintext      string = "not_enveloped"
+)
+
+// BackupBundleJSON is the stored form of the accounts of a mount: their
+// envelopes and their data keys, still wrapped under the mount key or under
+// transit keys. Without those keys it discloses no key material.
+type BackupBundleJSON struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// MountKeyID fingerprints the mount key the data keys are wrapped under
+	MountKeyID string                  `json:"mount_key_id"`
+	Accounts   map[string]*AccountJSON `json:"accounts"`
+	DataKeys   map[string][]byte       `json:"data_keys"`
+	// TransitDataKeys are the data keys wrapped under transit keys, which
+	// destroying their account deletes
+	TransitDataKeys map[string]*TransitDataKeyJSON `json:"transit_data_keys,omitempty"`
+}
+
+// mountKeyID returns a fingerprint of a mount key, which tells whether two
+// bundles were wrapped under the same key without saying anything about it
+func mountKeyID(mountKey []byte) string {
+	if mountKey == nil {
+		return Empty
+	}
+	hash := sha256.Sum256(append([]byte("vault-core mount key id:"), mountKey...))
+	return hexutil.Encode(hash[:8])[2:]
+}
+
+func backupPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("backup/bundle"),
+			HelpSynopsis: "Return the accounts of this mount as a backup bundle.",
+			HelpDescription: `
+
+Return every account as it is stored: its settings, its address and its key
+material in an envelope, with the data key of the envelope wrapped under the
+mount key or, with envelope_transit_url set, under the account's transit key.
+Neither key is in the bundle, so the bundle is only restorable by this mount
+or one restored from a storage backup of it, and useless to anyone else.
+Accounts that predate envelope encryption would hold their key in the clear
+and are left out; the warnings name them until the migrations have upgraded
+them.
+
+Destroying an account later deletes its transit key, and the bundle no longer
+restores it. A data key wrapped under the mount key is not shredded by
+destroy: the bundle restores the account for as long as it is kept, and the
+warnings name those accounts.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathBackupBundle,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("backup/verify"),
+			HelpSynopsis: "Check that a backup bundle restores every account it holds.",
+			HelpDescription: `
+
+Check, for every account of a backup bundle, that its data key unwraps under
+the current mount key, that its envelope opens under the data key and that
+the key it holds derives the account's address. Nothing is imported or
+written, and no key material is returned: each account is reported with its
+status.
+
+  ok                      the account restores
+  destroyed               the account was destroyed; it has nothing to restore
+  destroyed_since_bundle  the account was destroyed after the bundle was taken
+  missing_data_key        the bundle has no data key for the envelope
+  data_key_undecryptable  the data key does not unwrap under the mount key
+  envelope_undecryptable  the envelope does not open under its data key
+  key_invalid             the envelope holds no usable key
+  address_mismatch        the key derives another address than the account's
+  not_enveloped           the key is in the clear in the bundle
+
+Sealed accounts are checked as far as their envelope; that their passphrase
+shares unseal them cannot be known without the shares. Accounts destroyed
+since the bundle was taken are reported as destroyed_since_bundle rather than
+restorable; the error says whether the bundle still holds their data key
+under the mount key. Run it on a schedule against the latest bundle to know
+the disaster recovery artifacts restore.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"bundle": {
+					Type:        framework.TypeString,
+					Description: "The backup bundle, as backup/bundle returns it, in JSON.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathBackupVerify,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathBackupBundle(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	mountKey, err := readMountKey(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &BackupBundleJSON{
+		Version:         backupBundleVersion,
+		CreatedAt:       time.Now().UTC(),
+		MountKeyID:      mountKeyID(mountKey),
+		Accounts:        map[string]*AccountJSON{},
+		DataKeys:        map[string][]byte{},
+		TransitDataKeys: map[string]*TransitDataKeyJSON{},
+	}
+	names, err := req.Storage.List(ctx, QualifiedPath("accounts/"))
+	if err != nil {
+		return nil, err
+	}
+	var skipped, mountWrapped []string
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		entry, err := req.Storage.Get(ctx, QualifiedPath("accounts/"+name))
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		var accountJSON AccountJSON
+		if err := entry.DecodeJSON(&accountJSON); err != nil {
+			return nil, fmt.Errorf("account %s: %v", name, err)
+		}
+		if accountJSON.Mnemonic != Empty || accountJSON.SealedMnemonic != Empty || accountJSON.PrivateKey != Empty {
+			skipped = append(skipped, name)
+			continue
+		}
+		bundle.Accounts[name] = &accountJSON
+		transitKey, err := readTransitDataKey(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if transitKey != nil {
+			bundle.TransitDataKeys[name] = transitKey
+			continue
+		}
+		if entry, err = req.Storage.Get(ctx, dekStoragePath(name)); err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			bundle.DataKeys[name] = entry.Value
+			mountWrapped = append(mountWrapped, name)
+		}
+	}
+	encoded, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"bundle":       string(encoded),
+			"accounts":     len(bundle.Accounts),
+			"created_at":   bundle.CreatedAt.Format(time.RFC3339),
+			"mount_key_id": bundle.MountKeyID,
+		},
+	}
+	if len(skipped) > 0 {
+		resp.AddWarning(fmt.Sprintf("accounts left out that predate envelope encryption; run the migrations to include them: %s", strings.Join(skipped, ", ")))
+	}
+	if len(mountWrapped) > 0 {
+		resp.AddWarning(fmt.Sprintf("the data keys of these accounts are wrapped under the mount key, and destroying them will not shred them in this bundle; set envelope_transit_url and write them to wrap them under transit keys: %s", strings.Join(mountWrapped, ", ")))
+	}
+	return resp, nil
+}
+
+// verifyBackupAccount returns the status of an account of a backup bundle
+// and, if it is not ok, why
+func verifyBackupAccount(ctx context.Context, s logical.Storage, mountKey []byte, name string, stored *AccountJSON, wrappedKey []byte, transitKey *TransitDataKeyJSON) (string, error) {
+	if stored.Destroyed {
+		return backupDestroyed, nil
+	}
+	entry, err := s.Get(ctx, QualifiedPath("accounts/"+name))
+	if err != nil {
+		return backupBadKey, err
+	}
+	if entry != nil {
+		var current AccountJSON
+		if err := entry.DecodeJSON(&current); err != nil {
+			return backupBadKey, err
+		}
+		if current.Destroyed {
+			if transitKey == nil && wrappedKey != nil {
+				return backupDestroyedSince, fmt.Errorf("the bundle still holds its data key under the mount key")
+			}
+			return backupDestroyedSince, fmt.Errorf("its transit key was deleted")
+		}
+	}
+	accountJSON := *stored
+	if accountJSON.Envelope == Empty {
+		if accountJSON.Mnemonic != Empty || accountJSON.SealedMnemonic != Empty || accountJSON.PrivateKey != Empty {
+			return backupPlaintext, nil
+		}
+		return backupBadKey, fmt.Errorf("the account has no envelope")
+	}
+	var dek []byte
+	switch {
+	case transitKey != nil:
+		_, token, err := envelopeTransit(ctx, s)
+		if err != nil {
+			return backupBadDataKey, err
+		}
+		if dek, err = transitUnwrap(ctx, token, transitKey); err != nil {
+			return backupBadDataKey, err
+		}
+	case wrappedKey == nil:
+		return backupMissingDataKey, nil
+	case mountKey == nil:
+		return backupBadDataKey, fmt.Errorf("this mount has no mount key")
+	default:
+		if dek, err = gcmOpen(mountKey, wrappedKey, []byte(name)); err != nil {
+			return backupBadDataKey, err
+		}
+	}
+	defer util.ZeroBytes(dek)
+	envelope, err := hexutil.Decode(accountJSON.Envelope)
+	if err != nil {
+		return backupBadEnvelope, err
+	}
+	secretsJSON, err := gcmOpen(dek, envelope, []byte(name))
+	if err != nil {
+		return backupBadEnvelope, err
+	}
+	defer util.ZeroBytes(secretsJSON)
+	var secrets accountSecrets
+	if err := json.Unmarshal(secretsJSON, &secrets); err != nil {
+		return backupBadKey, err
+	}
+	accountJSON.Mnemonic, accountJSON.SealedMnemonic, accountJSON.PrivateKey = secrets.Mnemonic, secrets.SealedMnemonic, secrets.PrivateKey
+	if accountJSON.sealed() {
+		// the mnemonic is encrypted under the key the passphrase shares split
+		return backupOK, nil
+	}
+	if accountJSON.Mnemonic == Empty && accountJSON.PrivateKey == Empty {
+		return backupBadKey, fmt.Errorf("the envelope holds no key")
+	}
+	// the recorded address is compared below rather than refused
+	accountJSON.Address = Empty
+	_, account, err := getWalletAndAccount(ctx, accountJSON)
+	if err != nil {
+		return backupBadKey, err
+	}
+	if stored.Address != Empty {
+		address, err := common.HexToAddress(stored.Address)
+		if err != nil || account.Address != address {
+			return backupWrongAddress, fmt.Errorf("the key derives %s", account.Address.Hex())
+		}
+	}
+	return backupOK, nil
+}
+
+func (b *PluginBackend) pathBackupVerify(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	var bundle BackupBundleJSON
+	if err := json.Unmarshal([]byte(data.Get("bundle").(string)), &bundle); err != nil {
+		return nil, fmt.Errorf("%w: bundle is not a backup bundle: %v", ErrInvalidInput, err)
+	}
+	if bundle.Version != backupBundleVersion {
+		return nil, fmt.Errorf("%w: bundle version %d is not supported", ErrInvalidInput, bundle.Version)
+	}
+	mountKey, err := readMountKey(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(bundle.Accounts))
+	for name := range bundle.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	accounts := make([]map[string]interface{}, 0, len(names))
+	failed, destroyedSince := 0, 0
+	for _, name := range names {
+		stored := bundle.Accounts[name]
+		if stored == nil {
+			continue
+		}
+		status, err := verifyBackupAccount(ctx, req.Storage, mountKey, name, stored, bundle.DataKeys[name], bundle.TransitDataKeys[name])
+		result := map[string]interface{}{
+			"name":    name,
+			"status":  status,
+			"address": stored.Address,
+			"sealed":  stored.ShareThreshold > 0,
+		}
+		if err != nil {
+			result["error"] = err.Error()
+		}
+		switch status {
+		case backupOK, backupDestroyed:
+		case backupDestroyedSince:
+			destroyedSince++
+		default:
+			failed++
+		}
+		accounts = append(accounts, result)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"created_at":        bundle.CreatedAt.Format(time.RFC3339),
+			"mount_key_id":      bundle.MountKeyID,
+			"mount_key_matches": mountKey != nil && bundle.MountKeyID == mountKeyID(mountKey),
+			"accounts":          accounts,
+			"restorable":        failed == 0,
+			"failed":            failed,
+			"destroyed_since":   destroyedSince,
+		},
+	}, nil
+}
@@ -0,0 +1,220 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// BLSKeyJSON is what we store for a BLS validator key imported from an EIP-2335 keystore
+type BLSKeyJSON struct {
+	SecretKey   string `json:"secret_key"`
+	Pubkey      string `json:"pubkey"`
+	Path        string `json:"path"`
+	Description string `json:"description"`
+}
+
+func (key *BLSKeyJSON) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"pubkey":      key.Pubkey,
+		"path":        key.Path,
+		"description": key.Description,
+	}
+}
+
+func blsPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("bls-keys/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathBLSKeysList,
+			},
+			HelpSynopsis: "List all the BLS keys at a path.",
+			HelpDescription: `
+			All the BLS keys will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("bls-keys/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Import, read or delete a BLS validator key.",
+			HelpDescription: `
+
+Import a BLS12-381 secret key from an EIP-2335 (version 4) keystore, as
+written by the deposit tooling. The keystore is decrypted with the password
+and only the secret key, public key, path and description are kept.
+
+The public key is taken from the keystore as is; it is not derived from the
+secret key. BLS keys are held for custody and export only: this mount does not
+sign with them. Re-importing the same key is a no-op; importing a different
+key under the same name is rejected.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the BLS key."},
+				"keystore": {
+					Type:        framework.TypeString,
+					Description: "The EIP-2335 keystore JSON.",
+				},
+				"password": {
+					Type:        framework.TypeString,
+					Description: "The password that decrypts the keystore.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathBLSKeyRead,
+				logical.CreateOperation: b.pathBLSKeyImport,
+				logical.UpdateOperation: b.pathBLSKeyImport,
+				logical.DeleteOperation: b.pathBLSKeyDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("bls-keys/" + framework.GenericNameRegex("name") + "/export"),
+			HelpSynopsis: "Request the export of a BLS key.",
+			HelpDescription: `
+
+Create a pending export request for a BLS key. It is approved and released
+through exports/<id>/approve and exports/<id>/release like an account export;
+the release returns an EIP-2335 keystore.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the BLS key."},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.unlessFrozen(b.pathBLSKeyExportRequest),
+				logical.UpdateOperation: b.unlessFrozen(b.pathBLSKeyExportRequest),
+			},
+		},
+	}
+}
+
+func readBLSKey(ctx context.Context, req *logical.Request, name string) (*BLSKeyJSON, error) {
+	entry, err := req.Storage.Get(ctx, QualifiedPath(fmt.Sprintf("bls-keys/%s", name)))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: no BLS key %s", ErrAccountNotFound, name)
+	}
+	var key BLSKeyJSON
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (b *PluginBackend) pathBLSKeysList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("bls-keys/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathBLSKeyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	key, err := readBLSKey(ctx, req, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: key.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathBLSKeyImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	keystoreJSON := data.Get("keystore").(string)
+	if keystoreJSON == Empty {
+		return nil, fmt.Errorf("%w: keystore is required", ErrInvalidInput)
+	}
+	kdfDone := timed(ctx, kdfTime)
+	keystore, secret, err := util.DecryptEIP2335([]byte(keystoreJSON), data.Get("password").(string))
+	kdfDone()
+	if err != nil {
+		return nil, wrapError(ErrKeystoreDecrypt, err)
+	}
+	defer util.ZeroBytes(secret)
+	if err := util.ValidBLSSecretKey(secret); err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	pubkey := strings.TrimPrefix(strings.ToLower(keystore.Pubkey), "0x")
+	if decoded, err := hex.DecodeString(pubkey); err != nil || len(decoded) != 48 {
+		return nil, fmt.Errorf("%w: keystore pubkey must be a 48 byte hex string", ErrInvalidInput)
+	}
+	key := &BLSKeyJSON{
+		SecretKey:   hex.EncodeToString(secret),
+		Pubkey:      pubkey,
+		Path:        keystore.Path,
+		Description: keystore.Description,
+	}
+
+	existing, err := readBLSKey(ctx, req, name)
+	if err == nil {
+		if existing.SecretKey != key.SecretKey {
+			return nil, fmt.Errorf("%w: BLS key %s holds a different key", ErrAccountExists, name)
+		}
+		return &logical.Response{
+			Data: existing.responseData(),
+		}, nil
+	}
+	entry, err := logical.StorageEntryJSON(QualifiedPath(fmt.Sprintf("bls-keys/%s", name)), key)
+	if err != nil {
+		return nil, err
+	}
+	entry.SealWrap = true
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: key.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathBLSKeyDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, QualifiedPath(fmt.Sprintf("bls-keys/%s", data.Get("name").(string)))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *PluginBackend) pathBLSKeyExportRequest(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	if _, err := readBLSKey(ctx, req, name); err != nil {
+		return nil, err
+	}
+	return b.requestExport(ctx, req, &ExportJSON{BLSKey: name})
+}
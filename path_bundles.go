@@ -0,0 +1,327 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/crypto"
+	"github.com/core-coin/go-core/rlp"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// sendBundle is the JSON-RPC method of the relays that takes a bundle
+	sendBundle string = "xcb_sendBundle"
+	// bundleSignatureHeader carries the identity signature of a bundle
+	bundleSignatureHeader string = "X-Flashbots-Signature"
+)
+
+func bundlePaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sign-bundle"),
+			HelpSynopsis: "Sign a bundle of transactions and its relay signature with this account as identity.",
+			HelpDescription: `
+
+Build a bundle for the private relays: transactions that land in the target
+block together and in order, or not at all. Each transaction is either signed
+as accounts/<account>/sign-tx would, with the same fields and the same rules,
+limits and approvals, or given already signed in signed_transaction, as the
+transaction a bundle backruns. A transaction left without a nonce follows the
+previous one its account signed in the bundle. If any fails to sign, nothing
+is returned.
+
+The account named in the path is the searcher identity the relays know the
+bundle by: it signs the Core Signed Message of the hex SHA3 of the JSON-RPC
+body, and the header X-Flashbots-Signature: <address>:<signature> is returned
+with the body it covers. The execution keys and the identity key never leave
+Vault. With send set the bundle is posted to every private_relay_urls of the
+mount or the chain, and what each answered is returned.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account that signs as the searcher identity."},
+				"transactions": {
+					Type:        framework.TypeSlice,
+					Description: "The transactions of the bundle, in order: objects with the account that signs and the fields of sign-tx, or with signed_transaction.",
+				},
+				"block_number": {
+					Type:        framework.TypeString,
+					Description: "The block the bundle targets, decimal or 0x-prefixed hex. The block after the head if empty.",
+				},
+				"min_timestamp": {
+					Type:        framework.TypeInt,
+					Description: "The earliest block timestamp the bundle is valid at, in Unix seconds; not bounded if 0.",
+				},
+				"max_timestamp": {
+					Type:        framework.TypeInt,
+					Description: "The latest block timestamp the bundle is valid at, in Unix seconds; not bounded if 0.",
+				},
+				"reverting_transaction_hashes": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The hashes of the transactions of the bundle that may revert without the bundle being dropped.",
+				},
+				"send": {
+					Type:        framework.TypeBool,
+					Description: "Post the bundle to the private relays.",
+				},
+				"passphrase_shares": passphraseSharesSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.unlessFrozen(b.pathSignBundle),
+			},
+		},
+	}
+}
+
+// bundleBlock parses the block a bundle targets
+func bundleBlock(number string) (uint64, error) {
+	if strings.HasPrefix(number, "0x") {
+		return hexutil.DecodeUint64(number)
+	}
+	return strconv.ParseUint(number, 10, 64)
+}
+
+// bundleRelayAnswer is what a relay answered to a bundle
+func bundleRelayAnswer(result *relayResult) map[string]interface{} {
+	answer := map[string]interface{}{
+		"relay":    result.relay,
+		"accepted": result.accepted(),
+	}
+	if result.err != nil {
+		answer["error"] = result.err.Error()
+		return answer
+	}
+	var reply struct {
+		Result interface{} `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	switch {
+	case json.Unmarshal(result.body, &reply) != nil:
+		answer["error"] = fmt.Sprintf("status %d: %s", result.status, strings.TrimSpace(string(result.body)))
+	case reply.Error != nil:
+		answer["error"] = reply.Error.Message
+	default:
+		answer["result"] = reply.Result
+	}
+	return answer
+}
+
+// postBundle posts a signed bundle to every relay at once; unlike a
+// transaction, a bundle is sent to all of them so that any builder may land it
+func postBundle(ctx context.Context, relays []string, body []byte, signature string, timeout time.Duration) []map[string]interface{} {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	header := http.Header{}
+	header.Set(bundleSignatureHeader, signature)
+	answers := make([]map[string]interface{}, len(relays))
+	var wg sync.WaitGroup
+	for i, relay := range relays {
+		wg.Add(1)
+		go func(i int, relay string) {
+			defer wg.Done()
+			answers[i] = bundleRelayAnswer(askRelay(ctx, relay, body, header))
+		}(i, relay)
+	}
+	wg.Wait()
+	return answers
+}
+
+func (b *PluginBackend) pathSignBundle(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	identity := data.Get("name").(string)
+	send := data.Get("send").(bool)
+	if send && len(config.PrivateRelayURLs) == 0 {
+		return nil, fmt.Errorf("%w: a bundle is sent to the private relays and no private_relay_urls are configured", ErrInvalidInput)
+	}
+	transactions := data.Get("transactions").([]interface{})
+	if len(transactions) == 0 || len(transactions) > maxBatchTransactions {
+		return nil, fmt.Errorf("%w: a bundle holds 1 to %d transactions", ErrInvalidInput, maxBatchTransactions)
+	}
+	items := make([]map[string]interface{}, len(transactions))
+	for i, transaction := range transactions {
+		item, ok := transaction.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: transaction %d is not an object", ErrInvalidInput, i)
+		}
+		account, _ := item["account"].(string)
+		signed, _ := item["signed_transaction"].(string)
+		if (account == Empty) == (signed == Empty) {
+			return nil, fmt.Errorf("%w: transaction %d needs either an account or a signed_transaction", ErrInvalidInput, i)
+		}
+		items[i] = item
+	}
+
+	var block uint64
+	if number := data.Get("block_number").(string); number != Empty {
+		if block, err = bundleBlock(number); err != nil {
+			return nil, fmt.Errorf("%w: block_number %s: %v", ErrInvalidInput, number, err)
+		}
+	} else {
+		client, err := b.dialRPC(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			return nil, err
+		}
+		block = head + 1
+	}
+
+	nonces := map[string]uint64{}
+	raws := make([]string, 0, len(items))
+	results := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		result := map[string]interface{}{"index": i}
+		if signed, _ := item["signed_transaction"].(string); signed != Empty {
+			encoded, err := decodeHex(signed)
+			if err != nil {
+				return nil, fmt.Errorf("%w: transaction %d is not hex", ErrInvalidInput, i)
+			}
+			var tx types.Transaction
+			if err := rlp.DecodeBytes(encoded, &tx); err != nil {
+				return nil, fmt.Errorf("%w: transaction %d: %v", ErrInvalidInput, i, err)
+			}
+			result["transaction_hash"] = tx.Hash().Hex()
+			result["signed_transaction"] = hexutil.Encode(encoded)
+			raws = append(raws, hexutil.Encode(encoded))
+			results = append(results, result)
+			continue
+		}
+		account := item["account"].(string)
+		raw := map[string]interface{}{}
+		for k, v := range item {
+			if k != "account" {
+				raw[k] = v
+			}
+		}
+		raw["name"] = account
+		if next, ok := nonces[account]; ok && raw["nonce"] == nil {
+			raw["nonce"] = strconv.FormatUint(next, 10)
+		}
+		resp, err := b.accountOperation(ctx, req, "sign-tx", raw)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		case resp == nil:
+			return nil, fmt.Errorf("transaction %d: nothing was signed", i)
+		case resp.IsError():
+			return nil, fmt.Errorf("transaction %d: %v", i, resp.Error())
+		}
+		nonce, err := strconv.ParseUint(fmt.Sprint(resp.Data["nonce"]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: nonce %v: %v", i, resp.Data["nonce"], err)
+		}
+		nonces[account] = nonce + 1
+		result["account"] = account
+		for k, v := range resp.Data {
+			result[k] = v
+		}
+		raws = append(raws, fmt.Sprint(resp.Data["signed_transaction"]))
+		results = append(results, result)
+	}
+
+	bundle := map[string]interface{}{
+		"txs":         raws,
+		"blockNumber": hexutil.EncodeUint64(block),
+	}
+	if min := data.Get("min_timestamp").(int); min > 0 {
+		bundle["minTimestamp"] = min
+	}
+	if max := data.Get("max_timestamp").(int); max > 0 {
+		bundle["maxTimestamp"] = max
+	}
+	if reverting := data.Get("reverting_transaction_hashes").([]string); len(reverting) > 0 {
+		bundle["revertingTxHashes"] = reverting
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  sendBundle,
+		"params":  []interface{}{bundle},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]interface{}{
+		"name":    identity,
+		"message": crypto.SHA3Hash(body).Hex(),
+	}
+	if shares, ok := data.GetOk("passphrase_shares"); ok {
+		raw["passphrase_shares"] = shares
+	}
+	resp, err := b.accountOperation(ctx, req, "sign", raw)
+	if err != nil {
+		return nil, fmt.Errorf("identity %s: %w", identity, err)
+	}
+	if resp == nil || resp.IsError() {
+		return nil, fmt.Errorf("identity %s did not sign the bundle", identity)
+	}
+	accountJSON, err := readAccount(ctx, req, identity)
+	if err != nil {
+		return nil, err
+	}
+	address, err := accountAddress(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	signature := address.Hex() + ":" + fmt.Sprint(resp.Data["signature"])
+
+	responseData := map[string]interface{}{
+		"identity":     address.Hex(),
+		"block_number": block,
+		"bundle":       string(body),
+		"signature":    signature,
+		"header":       bundleSignatureHeader,
+		"transactions": results,
+	}
+	if send {
+		answers := postBundle(ctx, config.PrivateRelayURLs, body, signature, time.Duration(config.rpcTimeout())*time.Second)
+		accepted := 0
+		for _, answer := range answers {
+			if answer["accepted"] == true {
+				accepted++
+			}
+		}
+		responseData["relays"] = answers
+		responseData["accepted"] = accepted
+		b.Logger().Info("sent bundle", "identity", identity, "transactions", len(raws), "block", block, "relays", len(answers), "accepted", accepted, "entity_id", req.EntityID)
+	} else {
+		b.Logger().Info("signed bundle", "identity", identity, "transactions", len(raws), "block", block, "entity_id", req.EntityID)
+	}
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
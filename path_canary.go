@@ -0,0 +1,227 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/core-coin/go-core/accounts"
+	"github.com/core-coin/go-core/crypto"
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/chains"
+)
+
+const eventCanaryUsed string = "canary_used"
+
+// CanaryJSON marks an account as a canary. It is stored apart from the
+// account so that nothing under accounts/ tells a caller it is one.
+type CanaryJSON struct {
+	Fabricate bool      `json:"fabricate"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func canaryPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("canaries/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathCanariesList,
+			},
+			HelpSynopsis: "List all the canary accounts.",
+			HelpDescription: `
+			All the accounts marked as canaries will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("canaries/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Mark an account as a canary.",
+			HelpDescription: `
+
+Any attempt to sign with or export a canary account raises a canary_used
+security event: it is logged and POSTed to notification_webhook_url. The
+account otherwise looks and behaves like any other account.
+
+With fabricate set, sign and sign-tx return a well-formed signature that
+carries the account's public key but is made with a throwaway key, so the
+caller learns nothing until it verifies the signature, which is useless on
+chain. Transactions this mount broadcasts itself
+are signed normally.
+
+Grant access to canaries/ only to the operators that manage them.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"fabricate": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Return fabricated signatures from sign and sign-tx.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathCanaryRead,
+				logical.CreateOperation: b.pathCanaryWrite,
+				logical.UpdateOperation: b.pathCanaryWrite,
+				logical.DeleteOperation: b.pathCanaryDelete,
+			},
+		},
+	}
+}
+
+func canaryStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("canaries/%s", name))
+}
+
+// readCanary returns nil if the account is not a canary
+func readCanary(ctx context.Context, req *logical.Request, name string) (*CanaryJSON, error) {
+	entry, err := req.Storage.Get(ctx, canaryStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var canary CanaryJSON
+	if err := entry.DecodeJSON(&canary); err != nil {
+		return nil, err
+	}
+	return &canary, nil
+}
+
+func (canary *CanaryJSON) responseData(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":       name,
+		"fabricate":  canary.Fabricate,
+		"created_at": canary.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func (b *PluginBackend) pathCanariesList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("canaries/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathCanaryRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	canary, err := readCanary(ctx, req, name)
+	if err != nil || canary == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: canary.responseData(name),
+	}, nil
+}
+
+func (b *PluginBackend) pathCanaryWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	if _, err := readAccount(ctx, req, name); err != nil {
+		return nil, err
+	}
+	canary, err := readCanary(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if canary == nil {
+		canary = &CanaryJSON{CreatedAt: time.Now()}
+	}
+	canary.Fabricate = data.Get("fabricate").(bool)
+	entry, err := logical.StorageEntryJSON(canaryStoragePath(name), canary)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: canary.responseData(name),
+	}, nil
+}
+
+func (b *PluginBackend) pathCanaryDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, canaryStoragePath(data.Get("name").(string)))
+}
+
+// alertCanary raises a canary_used event when the account is a canary, and
+// returns its canary, nil if it is not one
+func (b *PluginBackend) alertCanary(ctx context.Context, req *logical.Request, name string) (*CanaryJSON, error) {
+	canary, err := readCanary(ctx, req, name)
+	if err != nil || canary == nil {
+		return nil, err
+	}
+	recordRule(ctx, "canary_alert", nil)
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	b.notify(config, req, eventCanaryUsed, map[string]interface{}{
+		"account":    name,
+		"operation":  string(req.Operation),
+		"fabricated": canary.Fabricate,
+	})
+	return canary, nil
+}
+
+// accountSigner signs digests with the key of an account, or fabricates
+// signatures when the account is a canary that fabricates them. A core
+// signature carries the public key that made it, so a fabricated one is made
+// with a throwaway key and carries the account's public key instead: it reads
+// as the account's, and only fails to verify.
+func accountSigner(ctx context.Context, req *logical.Request, name string, wallet signingWallet, account accounts.Account) (chains.Signer, error) {
+	canary, err := readCanary(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if canary == nil || !canary.Fabricate {
+		return walletSigner(wallet, account), nil
+	}
+	privateKey, err := wallet.PrivateKey(account)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := eddsa.Ed448DerivePublicKey(*privateKey)
+	return chains.SignerFunc(func(digest []byte) ([]byte, error) {
+		throwaway, err := crypto.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signature, err := crypto.Sign(digest, throwaway)
+		if err != nil {
+			return nil, err
+		}
+		return append(signature[:crypto.SignatureLength], publicKey[:]...), nil
+	}), nil
+}
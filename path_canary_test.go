@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/core-coin/go-core/accounts"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/crypto"
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestFabricatedSignatureCarriesAccountKey(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	for _, req := range []*logical.Request{
+		{Operation: logical.CreateOperation, Path: "accounts/decoy"},
+		{Operation: logical.CreateOperation, Path: "canaries/decoy", Data: map[string]interface{}{"fabricate": true}},
+	} {
+		req.Storage = storage
+		if resp, err := b.HandleRequest(ctx, req); err != nil || resp.IsError() {
+			t.Fatalf("%s: %v %v", req.Path, err, resp)
+		}
+	}
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "accounts/decoy/sign",
+		Storage:   storage,
+		Data:      map[string]interface{}{"message": "canary"},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("sign: %v %v", err, resp)
+	}
+	signature, err := hexutil.Decode(resp.Data["signature"].(string))
+	if err != nil || len(signature) != crypto.ExtendedSignatureLength {
+		t.Fatalf("the fabricated signature is malformed: %v", err)
+	}
+	publicKey := signature[crypto.SignatureLength:]
+	var key eddsa.PublicKey
+	copy(key[:], publicKey)
+	if address := crypto.PubkeyToAddress(key); address != resp.Data["address"].(common.Address) {
+		t.Fatalf("the fabricated signature carries the key of %s, not of the account", address.Hex())
+	}
+	hash, _ := accounts.TextAndHash([]byte("canary"))
+	if crypto.VerifySignature(publicKey, hash, signature) {
+		t.Fatal("a fabricated signature verifies")
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/crypto"
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// CeremonyEntropySource describes how ceremony keys are generated
+	CeremonyEntropySource string = "crypto/rand (operating system CSPRNG) through BIP-39"
+	// CeremonyEntropyBits is the entropy of a generated mnemonic
+	CeremonyEntropyBits int = 128
+	// CeremonyKeyDerivation describes how the key is derived from the mnemonic
+	CeremonyKeyDerivation string = "BIP-32 secp256k1 child of the path, expanded with SHAKE-256 into an Ed448 key"
+
+	attestorStoragePath string = "ceremony/attestor"
+)
+
+// CeremonyAttestation documents the generation of an account's key
+type CeremonyAttestation struct {
+	Account        string    `json:"account"`
+	Address        string    `json:"address"`
+	DerivationPath string    `json:"derivation_path"`
+	KeyDerivation  string    `json:"key_derivation"`
+	GeneratedAt    time.Time `json:"generated_at"`
+	EntropySource  string    `json:"entropy_source"`
+	EntropyBits    int       `json:"entropy_bits"`
+	Operators      []string  `json:"operators"`
+	RequestedBy    string    `json:"requested_by"`
+	RequestID      string    `json:"request_id"`
+	MountAccessor  string    `json:"mount_accessor"`
+}
+
+// AttestationJSON is what we store for an attestation: the document exactly
+// as it was signed, and the signature of the mount's attestor key over it
+type AttestationJSON struct {
+	Document  string `json:"document"`
+	Signature string `json:"signature"`
+	Attestor  string `json:"attestor"`
+}
+
+// ceremonyOperatorsSchema is the account field that turns on ceremony mode
+var ceremonyOperatorsSchema = &framework.FieldSchema{
+	Type:        framework.TypeCommaStringSlice,
+	Description: "On create, generate the key in a ceremony attested by these operators; the mnemonic must not be supplied.",
+}
+
+func ceremonyPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/attestation"),
+			HelpSynopsis: "Read the key ceremony attestation of an account.",
+			HelpDescription: `
+
+Return the attestation written when the account was created with
+ceremony_operators: when and how the key was generated, by whose request and
+in front of which operators, and the address that resulted. The document is
+returned exactly as signed; an auditor checks the signature over SHA3 of it
+against the address of ceremony/attestor. An attestation without a
+key_derivation was written by a build that derived the zero key from every
+mnemonic, and attests nothing about the account's key.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathAttestationRead,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("ceremony/attestor"),
+			HelpSynopsis: "Read the address of the key that signs ceremony attestations.",
+			HelpDescription: `
+
+Return the address of this mount's attestor key so that auditors can pin it.
+The key signs ceremony attestations and plugin-info build attestations; it is
+generated on the first of either and never leaves the mount.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathAttestorRead,
+			},
+		},
+	}
+}
+
+func attestationStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("attestations/%s", name))
+}
+
+// attestor returns the mount's attestor key, generating it on first use
+func attestor(ctx context.Context, req *logical.Request, generate bool) (*eddsa.PrivateKey, error) {
+	entry, err := req.Storage.Get(ctx, QualifiedPath(attestorStoragePath))
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		return crypto.ToEDDSA(entry.Value)
+	}
+	if !generate {
+		return nil, nil
+	}
+	key, err := crypto.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, &logical.StorageEntry{
+		Key:      QualifiedPath(attestorStoragePath),
+		Value:    crypto.FromEDDSA(key),
+		SealWrap: true,
+	}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// keyAddress returns the address of a private key
+func keyAddress(key *eddsa.PrivateKey) common.Address {
+	return crypto.PubkeyToAddress(eddsa.Ed448DerivePublicKey(*key))
+}
+
+// attestCeremony signs and stores the attestation of a newly generated account
+func attestCeremony(ctx context.Context, req *logical.Request, name string, address common.Address, index int, operators []string) (*AttestationJSON, error) {
+	if address == keyAddress(&eddsa.PrivateKey{}) {
+		return nil, fmt.Errorf("%w: the mnemonic of %s derived the zero key", ErrKeystoreDecrypt, name)
+	}
+	key, err := attestor(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	document, err := json.Marshal(&CeremonyAttestation{
+		Account:        name,
+		Address:        address.Hex(),
+		DerivationPath: fmt.Sprintf(DerivationPath, index),
+		KeyDerivation:  CeremonyKeyDerivation,
+		GeneratedAt:    time.Now().UTC(),
+		EntropySource:  CeremonyEntropySource,
+		EntropyBits:    CeremonyEntropyBits,
+		Operators:      operators,
+		RequestedBy:    req.EntityID,
+		RequestID:      req.ID,
+		MountAccessor:  req.MountAccessor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	signature, err := crypto.Sign(crypto.SHA3(document), key)
+	if err != nil {
+		return nil, err
+	}
+	attestation := &AttestationJSON{
+		Document:  string(document),
+		Signature: hexutil.Encode(signature),
+		Attestor:  keyAddress(key).Hex(),
+	}
+	entry, err := logical.StorageEntryJSON(attestationStoragePath(name), attestation)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return attestation, nil
+}
+
+func (attestation *AttestationJSON) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"document":  attestation.Document,
+		"signature": attestation.Signature,
+		"attestor":  attestation.Attestor,
+	}
+}
+
+func (b *PluginBackend) pathAttestationRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	entry, err := req.Storage.Get(ctx, attestationStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: account %s was not created in a ceremony", ErrAccountNotFound, name)
+	}
+	var attestation AttestationJSON
+	if err := entry.DecodeJSON(&attestation); err != nil {
+		return nil, err
+	}
+	resp := &logical.Response{
+		Data: attestation.responseData(),
+	}
+	var document CeremonyAttestation
+	if err := json.Unmarshal([]byte(attestation.Document), &document); err != nil {
+		return nil, err
+	}
+	if document.KeyDerivation == Empty {
+		resp.AddWarning("this ceremony was held by a build that derived the zero key from every mnemonic: the attested address is that of the zero key, and the account must be re-keyed")
+	}
+	return resp, nil
+}
+
+func (b *PluginBackend) pathAttestorRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	key, err := attestor(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: no ceremony has been held and plugin-info has not been read on this mount", ErrAccountNotFound)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address": keyAddress(key).Hex(),
+		},
+	}, nil
+}
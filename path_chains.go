@@ -0,0 +1,338 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// ChainJSON is an additional chain the accounts of this mount are exposed on.
+// It replaces the network, its private relays and the address policy of the
+// mount's config; every other setting is shared.
+type ChainJSON struct {
+	ChainID    string   `json:"chain_id"`
+	RPC        string   `json:"rpc_url"`
+	RPCURLs    []string `json:"rpc_urls"`
+	Inclusions []string `json:"inclusions"`
+	Exclusions []string `json:"exclusions"`
+	Accounts   []string `json:"accounts"`
+	// PrivateRelayURLs are the private relays of the chain's network, in place of the mount's
+	PrivateRelayURLs []string `json:"private_relay_urls,omitempty"`
+}
+
+type chainContextKey struct{}
+
+type chainContext struct {
+	name  string
+	chain *ChainJSON
+}
+
+func (chain *ChainJSON) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"chain_id":   chain.ChainID,
+		"rpc_url":    chain.RPC,
+		"rpc_urls":   chain.RPCURLs,
+		"inclusions": chain.Inclusions,
+		"exclusions": chain.Exclusions,
+		"accounts":   chain.Accounts,
+
+		"private_relay_urls": chain.PrivateRelayURLs,
+	}
+}
+
+// apply overrides the mount's config with the chain's
+func (chain *ChainJSON) apply(config *ConfigJSON) {
+	config.ChainID = chain.ChainID
+	config.RPC = chain.RPC
+	config.RPCURLs = chain.RPCURLs
+	config.Inclusions = chain.Inclusions
+	config.Exclusions = chain.Exclusions
+	config.PrivateRelayURLs = chain.PrivateRelayURLs
+}
+
+// chainIDsSchema pins an account to the chains it may sign transactions for
+var chainIDsSchema = &framework.FieldSchema{
+	Type: framework.TypeCommaStringSlice,
+	Description: `The only chain IDs this account signs transactions for, on the mount and on
+chains/<chain>/accounts/<name>, and permits for; any chain if empty. Messages carry no
+chain ID and are not restricted.`,
+}
+
+// parseChainIDs normalizes the chain IDs an account is pinned to
+func parseChainIDs(chainIDs []string) ([]string, error) {
+	var normalized []string
+	for _, chainID := range chainIDs {
+		parsed := util.ValidNumber(chainID)
+		if parsed == nil || parsed.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: %s is not a chain ID", ErrInvalidChainID, chainID)
+		}
+		if !util.Contains(normalized, parsed.String()) {
+			normalized = append(normalized, parsed.String())
+		}
+	}
+	return normalized, nil
+}
+
+// pinnedTo reports whether the account signs transactions for the chain ID
+func (account *AccountJSON) pinnedTo(chainID string) bool {
+	if len(account.ChainIDs) == 0 {
+		return true
+	}
+	parsed := util.ValidNumber(chainID)
+	return parsed != nil && util.Contains(account.ChainIDs, parsed.String())
+}
+
+// checkChainPin refuses to sign for a chain the account is not pinned to.
+// config is that of the chain the request is made on.
+func checkChainPin(ctx context.Context, config *ConfigJSON, accountJSON *AccountJSON) error {
+	if len(accountJSON.ChainIDs) == 0 {
+		return nil
+	}
+	var err error
+	if !accountJSON.pinnedTo(config.ChainID) {
+		err = fmt.Errorf("%w: the account is pinned to chain IDs %s, not %s", ErrPolicyViolation, strings.Join(accountJSON.ChainIDs, ", "), config.ChainID)
+	}
+	recordRule(ctx, "chain_pin", err)
+	return err
+}
+
+// withChain makes readConfig return the config of the chain for the rest of a request
+func withChain(ctx context.Context, name string, chain *ChainJSON) context.Context {
+	return context.WithValue(ctx, chainContextKey{}, &chainContext{name: name, chain: chain})
+}
+
+// chainFromContext returns the chain a request is made on, if it is not the mount's own
+func chainFromContext(ctx context.Context) (string, *ChainJSON) {
+	if value, ok := ctx.Value(chainContextKey{}).(*chainContext); ok {
+		return value.name, value.chain
+	}
+	return Empty, nil
+}
+
+func chainPaths(b *PluginBackend) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern: QualifiedPath("chains/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathChainsList,
+			},
+			HelpSynopsis: "List all the chains the accounts are exposed on.",
+			HelpDescription: `
+			All the chains will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("chains/" + framework.GenericNameRegex("chain")),
+			HelpSynopsis: "Configure a further chain for the accounts of this mount.",
+			HelpDescription: `
+
+Expose the accounts of this mount on another network - an L2 next to mainnet,
+say - under chains/<chain>/accounts/<name>/. Operations there use the chain's
+chain_id, RPC endpoints, inclusions and exclusions in place of those in config,
+and share the key material of accounts/<name>. Because the paths are distinct,
+Vault policies can grant each chain separately.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"chain": {Type: framework.TypeString, Description: "The name of the chain."},
+				"chain_id": {
+					Type:        framework.TypeString,
+					Description: "The ID of the network.",
+				},
+				"rpc_url": {
+					Type:        framework.TypeString,
+					Description: "The RPC address of the network: an http(s):// or ws(s):// URL, or the absolute path of the node's IPC socket.",
+				},
+				"rpc_urls": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Additional RPC addresses for the network, used when rpc_url is unavailable.",
+				},
+				"inclusions": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Only these accounts may be transacted with on this chain.",
+				},
+				"exclusions": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "These accounts can never be transacted with on this chain.",
+				},
+				"accounts": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The only accounts exposed on this chain; all of them if unset.",
+				},
+				"private_relay_urls": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The private relays of the network that privately broadcast transactions are sent to on this chain; the mount's are not used.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathChainRead,
+				logical.CreateOperation: b.pathChainWrite,
+				logical.UpdateOperation: b.pathChainWrite,
+				logical.DeleteOperation: b.pathChainDelete,
+			},
+		},
+	}
+	prefix := QualifiedPath("chains/" + framework.GenericNameRegex("chain") + "/accounts/" + framework.GenericNameRegex("name"))
+	return append(paths, aliasAccountPaths(b, prefix, "chain", "The name of the chain.", b.onChain, "transfer", "balance", "sign-tx", "deploy", "sign")...)
+}
+
+func chainStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("chains/%s", name))
+}
+
+func readChain(ctx context.Context, s logical.Storage, name string) (*ChainJSON, error) {
+	entry, err := s.Get(ctx, chainStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var chain ChainJSON
+	if err := entry.DecodeJSON(&chain); err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// onChain runs an account operation against the chain named in the path
+func (b *PluginBackend) onChain(callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("chain").(string)
+		chain, err := readChain(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if chain == nil {
+			return nil, fmt.Errorf("%w: chain %s is not configured", ErrNotConfigured, name)
+		}
+		if len(chain.Accounts) > 0 && !util.Contains(chain.Accounts, data.Get("name").(string)) {
+			err = fmt.Errorf("%w: account %s is not exposed on chain %s", ErrPolicyViolation, data.Get("name").(string), name)
+		}
+		noteChain(ctx, name)
+		recordRule(ctx, "chain_accounts", err)
+		if err != nil {
+			return nil, err
+		}
+		return callback(withChain(ctx, name, chain), req, data)
+	}
+}
+
+func (b *PluginBackend) pathChainsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := req.Storage.List(ctx, QualifiedPath("chains/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathChainRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := readChain(ctx, req.Storage, data.Get("chain").(string))
+	if err != nil || chain == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: chain.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathChainWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("chain").(string)
+	chain, err := readChain(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		chain = &ChainJSON{}
+	}
+	if chainID, ok := data.GetOk("chain_id"); ok {
+		chain.ChainID = chainID.(string)
+	}
+	if rpcURL, ok := data.GetOk("rpc_url"); ok {
+		chain.RPC = rpcURL.(string)
+	}
+	if rpcURLs, ok := data.GetOk("rpc_urls"); ok {
+		chain.RPCURLs = util.Dedup(rpcURLs.([]string))
+	}
+	if inclusions, ok := data.GetOk("inclusions"); ok {
+		if chain.Inclusions, err = config.normalizeAddresses(inclusions.([]string)); err != nil {
+			return nil, err
+		}
+	}
+	if exclusions, ok := data.GetOk("exclusions"); ok {
+		if chain.Exclusions, err = config.normalizeAddresses(exclusions.([]string)); err != nil {
+			return nil, err
+		}
+	}
+	if accounts, ok := data.GetOk("accounts"); ok {
+		chain.Accounts = util.Dedup(accounts.([]string))
+	}
+	if privateRelayURLs, ok := data.GetOk("private_relay_urls"); ok {
+		chain.PrivateRelayURLs = util.Dedup(privateRelayURLs.([]string))
+		for _, relayURL := range chain.PrivateRelayURLs {
+			if parsed, err := url.Parse(relayURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				return nil, fmt.Errorf("%w: private_relay_urls must be http or https URLs", ErrInvalidInput)
+			}
+		}
+	}
+	if chain.ChainID == Empty || chain.RPC == Empty {
+		return nil, fmt.Errorf("%w: a chain needs a chain_id and an rpc_url", ErrInvalidInput)
+	}
+	if err := validRPCURLs(append([]string{chain.RPC}, chain.RPCURLs...)...); err != nil {
+		return nil, err
+	}
+	entry, err := logical.StorageEntryJSON(chainStoragePath(name), chain)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: chain.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathChainDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, chainStoragePath(data.Get("chain").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
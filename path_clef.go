@@ -0,0 +1,277 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/core-coin/go-core/accounts"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/rlp"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// ClefAPIVersion is the version of the clef external API this mount implements
+	ClefAPIVersion string = "6.0.0"
+
+	clefErrorCode = -32000
+)
+
+// clefTxArgs are the transaction arguments of account_signTransaction
+type clefTxArgs struct {
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	Energy      hexutil.Uint64  `json:"energy"`
+	EnergyPrice hexutil.Big     `json:"energyPrice"`
+	Value       hexutil.Big     `json:"value"`
+	Nonce       hexutil.Uint64  `json:"nonce"`
+	Data        *hexutil.Bytes  `json:"data"`
+	Input       *hexutil.Bytes  `json:"input,omitempty"`
+}
+
+// clefSignTxResult mirrors the result clef returns for account_signTransaction
+type clefSignTxResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+func clefPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("clef"),
+			HelpSynopsis: "A JSON-RPC endpoint compatible with the clef external signer.",
+			HelpDescription: `
+
+Accepts a single JSON-RPC 2.0 request and answers with a JSON-RPC response,
+so that nodes and tooling configured for clef can use this mount as their
+external signer. The supported methods are:
+
+  account_list             the addresses of the clef_accounts
+  account_signTransaction  signs through accounts/<name>/sign-tx
+  account_signData         text/plain only, signs through accounts/<name>/sign
+  account_version          the clef external API version
+
+Only the accounts named in clef_accounts are listed or signed for, and every
+policy of the account paths (inclusions, exclusions, canaries) applies.
+Contract creations, typed data and batch requests are not supported.
+
+Vault requires a token on every request while clef clients send none, so point
+the client at a Vault Agent listener with use_auto_auth_token set, at
+/v1/<mount>/clef.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"jsonrpc": {Type: framework.TypeString, Description: "The JSON-RPC version; 2.0."},
+				"method":  {Type: framework.TypeString, Description: "The JSON-RPC method."},
+				"params":  {Type: framework.TypeSlice, Description: "The JSON-RPC parameters."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathClef,
+			},
+		},
+	}
+}
+
+func clefResponse(id interface{}, result interface{}, err error) (*logical.Response, error) {
+	message := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+	}
+	if err != nil {
+		message["error"] = map[string]interface{}{
+			"code":    clefErrorCode,
+			"message": err.Error(),
+		}
+	} else {
+		message["result"] = result
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+// clefParam decodes the JSON-RPC parameter at index into target
+func clefParam(params []interface{}, index int, target interface{}) error {
+	if index >= len(params) {
+		return fmt.Errorf("%w: missing parameter %d", ErrInvalidInput, index)
+	}
+	encoded, err := json.Marshal(params[index])
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(encoded, target); err != nil {
+		return wrapError(ErrInvalidInput, err)
+	}
+	return nil
+}
+
+func (b *PluginBackend) pathClef(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id := req.Data["id"]
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.ClefAccounts) == 0 {
+		return nil, fmt.Errorf("%w: the clef endpoint is disabled until clef_accounts is configured", ErrApprovalRequired)
+	}
+	params, _ := data.Get("params").([]interface{})
+
+	var result interface{}
+	switch method := data.Get("method").(string); method {
+	case "account_list":
+		result, err = b.clefList(ctx, req, config)
+	case "account_signTransaction":
+		result, err = b.clefSignTransaction(ctx, req, config, params)
+	case "account_signData":
+		result, err = b.clefSignData(ctx, req, config, params)
+	case "account_version":
+		result = ClefAPIVersion
+	default:
+		err = fmt.Errorf("the method %s does not exist/is not available", method)
+	}
+	return clefResponse(id, result, err)
+}
+
+func (b *PluginBackend) clefList(ctx context.Context, req *logical.Request, config *ConfigJSON) ([]string, error) {
+	addresses := make([]string, 0, len(config.ClefAccounts))
+	for _, name := range config.ClefAccounts {
+		accountJSON, err := readAccount(ctx, req, name)
+		if err != nil {
+			return nil, err
+		}
+		address, err := accountAddress(ctx, *accountJSON)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address.Hex())
+	}
+	return addresses, nil
+}
+
+// clefAccount resolves a from address to one of the clef_accounts
+func (b *PluginBackend) clefAccount(ctx context.Context, req *logical.Request, config *ConfigJSON, address common.Address) (string, error) {
+	name, err := b.resolveAccountName(ctx, req, address)
+	if err != nil {
+		return Empty, err
+	}
+	if !util.Contains(config.ClefAccounts, name) {
+		return Empty, fmt.Errorf("%w: %s is not one of the clef_accounts", ErrPolicyViolation, address.Hex())
+	}
+	return name, nil
+}
+
+// accountOperation calls the handler of an accounts/<name>/<operation> path,
+// such as sign-tx or erc20/transfer, as if the request had been made to it
+func (b *PluginBackend) accountOperation(ctx context.Context, req *logical.Request, operation string, raw map[string]interface{}) (*logical.Response, error) {
+	pattern := QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/" + operation)
+	for _, path := range append(accountPaths(b), erc20Paths(b)...) {
+		if path.Pattern == pattern {
+			return path.Callbacks[logical.UpdateOperation](ctx, req, &framework.FieldData{Raw: raw, Schema: path.Fields})
+		}
+	}
+	return nil, fmt.Errorf("no account operation %s", operation)
+}
+
+func (b *PluginBackend) clefSignTransaction(ctx context.Context, req *logical.Request, config *ConfigJSON, params []interface{}) (*clefSignTxResult, error) {
+	var args clefTxArgs
+	if err := clefParam(params, 0, &args); err != nil {
+		return nil, err
+	}
+	if args.To == nil {
+		return nil, fmt.Errorf("%w: contract creation is not supported", ErrInvalidInput)
+	}
+	name, err := b.clefAccount(ctx, req, config, args.From)
+	if err != nil {
+		return nil, err
+	}
+	input := args.Data
+	if input == nil {
+		input = args.Input
+	}
+	raw := map[string]interface{}{
+		"name":      name,
+		"to":        args.To.Hex(),
+		"amount":    args.Value.ToInt().String(),
+		"nonce":     strconv.FormatUint(uint64(args.Nonce), 10),
+		"gas_limit": strconv.FormatUint(uint64(args.Energy), 10),
+		"gas_price": args.EnergyPrice.ToInt().String(),
+		"encoding":  HexEncoding,
+	}
+	if input != nil {
+		raw["data"] = hex.EncodeToString(*input)
+	}
+	resp, err := b.accountOperation(ctx, req, "sign-tx", raw)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := hexutil.Decode(resp.Data["signed_transaction"].(string))
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(signed, tx); err != nil {
+		return nil, err
+	}
+	return &clefSignTxResult{Raw: signed, Tx: tx}, nil
+}
+
+func (b *PluginBackend) clefSignData(ctx context.Context, req *logical.Request, config *ConfigJSON, params []interface{}) (hexutil.Bytes, error) {
+	var contentType string
+	if err := clefParam(params, 0, &contentType); err != nil {
+		return nil, err
+	}
+	if contentType != accounts.MimetypeTextPlain {
+		return nil, fmt.Errorf("%w: content type %s is not supported", ErrInvalidInput, contentType)
+	}
+	var address common.Address
+	if err := clefParam(params, 1, &address); err != nil {
+		return nil, err
+	}
+	var message hexutil.Bytes
+	if err := clefParam(params, 2, &message); err != nil {
+		return nil, err
+	}
+	name, err := b.clefAccount(ctx, req, config, address)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.accountOperation(ctx, req, "sign", map[string]interface{}{
+		"name":    name,
+		"message": string(message),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Decode(resp.Data["signature"].(string))
+}
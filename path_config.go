@@ -17,11 +17,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
 
 	"github.com/cryptohub-digital/vault-core/util"
 
 	"github.com/core-coin/go-core/common"
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/cidrutil"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -66,17 +71,139 @@ type ConfigJSON struct {
 	Inclusions    []string `json:"inclusions"`
 	Exclusions    []string `json:"exclusions"`
 	RPC           string   `json:"rpc_url"`
+	RPCURLs       []string `json:"rpc_urls"`
+	RPCStrategy   string   `json:"rpc_strategy"`
 	ChainID       string   `json:"chain_id"`
+	RPCTimeout    int      `json:"rpc_timeout"`
+	RPCRetries    int      `json:"rpc_retries"`
+	RPCBackoff    int      `json:"rpc_backoff"`
+	CircuitLimit  int      `json:"rpc_circuit_threshold"`
+	CircuitReset  int      `json:"rpc_circuit_cooldown"`
+	// AllowDigestSigning turns strict mode off for accounts that also opt in
+	AllowDigestSigning   bool     `json:"allow_digest_signing"`
+	ExportApproverGroups []string `json:"export_approver_groups"`
+	ExportApprovalTTL    int      `json:"export_approval_ttl"`
+	// AuthorizerGroups approve the requests of warm accounts and tier changes
+	AuthorizerGroups []string `json:"authorizer_groups"`
+	AuthorizationTTL int      `json:"authorization_ttl"`
+	// ControlGroupOperations, and transactions at or above the minimums, need an authorization on every account
+	ControlGroupOperations []string `json:"control_group_operations"`
+	ControlGroupMinAmount  string   `json:"control_group_min_amount"`
+	ControlGroupMinUSD     string   `json:"control_group_min_usd"`
+	// MFAMethod is how transactions at or above the MFA minimums are stepped up: totp or webhook
+	MFAMethod         string `json:"mfa_method"`
+	MFAWebhookURL     string `json:"mfa_webhook_url"`
+	MFAWebhookTimeout int    `json:"mfa_webhook_timeout"`
+	MFAMinAmount      string `json:"mfa_min_amount"`
+	MFAMinUSD         string `json:"mfa_min_usd"`
+	// AnomalyRules compare each transaction with what its account usually does; AnomalyAction says what an anomaly does
+	AnomalyRules                []string `json:"anomaly_rules"`
+	AnomalyAction               string   `json:"anomaly_action"`
+	AnomalySensitivity          string   `json:"anomaly_sensitivity"`
+	AnomalyLearningTransactions int      `json:"anomaly_learning_transactions"`
+	// KeystoreKDF is the key derivation function of the keystores exports are encrypted in
+	KeystoreKDF           string `json:"keystore_kdf"`
+	KeystoreArgon2Time    int    `json:"keystore_argon2_time"`
+	KeystoreArgon2Memory  int    `json:"keystore_argon2_memory"`
+	KeystoreArgon2Threads int    `json:"keystore_argon2_threads"`
+	// LowercaseAddressesOnly rejects address input that is not in lowercase canonical form
+	LowercaseAddressesOnly bool `json:"lowercase_addresses_only"`
+	ConfirmationDepth      int  `json:"confirmation_depth"`
+	RebroadcastReorged     bool `json:"rebroadcast_reorged"`
+	// NotificationWebhookURL receives security events such as canary use
+	NotificationWebhookURL string `json:"notification_webhook_url"`
+	// ApprovalSlackWebhookURL and ApprovalPagerDutyRoutingKey receive pending export requests
+	ApprovalSlackWebhookURL     string `json:"approval_slack_webhook_url"`
+	ApprovalPagerDutyRoutingKey string `json:"approval_pagerduty_routing_key"`
+	// ApprovalLinkURL is the deep link to a pending export request, with {id} for its ID
+	ApprovalLinkURL string `json:"approval_link_url"`
+	// ApprovalCallbackSecret keys the HMAC of approval callbacks; it is never returned
+	ApprovalCallbackSecret string `json:"approval_callback_secret"`
+	// ClefAccounts are the accounts the clef compatible endpoint may sign for
+	ClefAccounts []string `json:"clef_accounts"`
+	// LogLevel overrides the log level of this mount
+	LogLevel string `json:"log_level"`
+	// LogRedactPatterns are masked wherever they appear in the logs
+	LogRedactPatterns []string `json:"log_redact_patterns"`
+	// DecisionLogFile receives a JSON line for every signing decision
+	DecisionLogFile string `json:"decision_log_file"`
+	// DecisionLogHMAC chains the lines of the decision log file with an HMAC
+	DecisionLogHMAC bool `json:"decision_log_hmac"`
+	// DecisionLogBuffer queues that many lines for the decision log file; 0 writes them synchronously
+	DecisionLogBuffer   int    `json:"decision_log_buffer"`
+	DecisionLogOverflow string `json:"decision_log_overflow"`
+	// DecisionLogFsync says when the decision log file is synced to disk
+	DecisionLogFsync         string `json:"decision_log_fsync"`
+	DecisionLogFsyncBytes    int    `json:"decision_log_fsync_bytes"`
+	DecisionLogFsyncInterval int    `json:"decision_log_fsync_interval"`
+	// CalldataRules constrain the decoded calldata of every account of the mount
+	CalldataRules []string `json:"calldata_rules"`
+	// PolicyHookURL is asked, as OPA's data API is, whether to sign each transaction
+	PolicyHookURL      string `json:"policy_hook_url"`
+	PolicyHookTimeout  int    `json:"policy_hook_timeout"`
+	PolicyHookCacheTTL int    `json:"policy_hook_cache_ttl"`
+	// ScreeningURL is asked the risk of each destination; ScreeningAPIKey is never returned
+	ScreeningURL          string `json:"screening_url"`
+	ScreeningAPIKey       string `json:"screening_api_key"`
+	ScreeningTimeout      int    `json:"screening_timeout"`
+	ScreeningCacheTTL     int    `json:"screening_cache_ttl"`
+	ScreeningApprovalRisk string `json:"screening_approval_risk"`
+	ScreeningBlockRisk    string `json:"screening_block_risk"`
+	// SanctionsListURL is fetched into the local sanctions list every SanctionsRefreshInterval seconds
+	SanctionsListURL         string `json:"sanctions_list_url"`
+	SanctionsRefreshInterval int    `json:"sanctions_refresh_interval"`
+	// ShadowURL is the API path of a mount every signing is repeated on and compared with; ShadowToken is never returned
+	ShadowURL     string `json:"shadow_url"`
+	ShadowToken   string `json:"shadow_token"`
+	ShadowTimeout int    `json:"shadow_timeout"`
+	// EnvelopeTransitURL is the API path of a transit mount that wraps each data key under a key of its own;
+	// EnvelopeTransitToken is never returned
+	EnvelopeTransitURL   string `json:"envelope_transit_url"`
+	EnvelopeTransitToken string `json:"envelope_transit_token"`
+	// BroadcastMode is public or private; private transactions are sent to PrivateRelayURLs, not to the mempool
+	BroadcastMode    string   `json:"broadcast_mode"`
+	PrivateRelayURLs []string `json:"private_relay_urls"`
+	// USDPrices price the native coin and tokens for the USD limits
+	USDPrices      map[string]string `json:"usd_prices"`
+	USDPriceMaxAge int               `json:"usd_price_max_age"`
+	MaxUSDPerTx    string            `json:"max_usd_per_tx"`
+	DailyUSDLimit  string            `json:"daily_usd_limit"`
+	// SlowRequestThreshold logs requests that take this many milliseconds or more
+	SlowRequestThreshold int `json:"slow_request_threshold"`
+	// ProofOfControlInterval is the least number of seconds between two proofs of control
+	ProofOfControlInterval int `json:"proof_of_control_interval"`
+	// InventoryPushURL is the bucket URL inventory snapshots are PUT to
+	InventoryPushURL    string `json:"inventory_push_url"`
+	InventoryPushCron   string `json:"inventory_push_cron"`
+	InventoryPushFormat string `json:"inventory_push_format"`
+	InventoryPushRegion string `json:"inventory_push_region"`
+	// InventoryPushSecretAccessKey signs the pushes with InventoryPushAccessKeyID; it is never returned
+	InventoryPushAccessKeyID     string `json:"inventory_push_access_key_id"`
+	InventoryPushSecretAccessKey string `json:"inventory_push_secret_access_key"`
+}
+
+// parseAddress validates address input according to this mount's rules
+func (config *ConfigJSON) parseAddress(input string) (common.Address, error) {
+	return util.ParseAddress(input, config.LowercaseAddressesOnly)
+}
+
+// normalizeAddresses validates a list of addresses and returns their canonical form
+func (config *ConfigJSON) normalizeAddresses(inputs []string) ([]string, error) {
+	addresses, err := util.NormalizeAddresses(inputs, config.LowercaseAddressesOnly)
+	if err != nil {
+		return nil, wrapError(ErrInvalidAddress, err)
+	}
+	return addresses, nil
 }
 
 // ValidAddress returns an error if the address is not included or if it is excluded
 func (config *ConfigJSON) ValidAddress(toAddress *common.Address) error {
-	if util.Contains(config.Exclusions, toAddress.Hex()) {
-		return fmt.Errorf("%s is excludeded by this mount", toAddress.Hex())
+	if util.ContainsAddress(config.Exclusions, *toAddress) {
+		return fmt.Errorf("%w: %s is excluded by this mount", ErrPolicyViolation, toAddress.Hex())
 	}
 
-	if len(config.Inclusions) > 0 && !util.Contains(config.Inclusions, toAddress.Hex()) {
-		return fmt.Errorf("%s is not in the set of inclusions of this mount", toAddress.Hex())
+	if len(config.Inclusions) > 0 && !util.ContainsAddress(config.Inclusions, *toAddress) {
+		return fmt.Errorf("%w: %s is not in the set of inclusions of this mount", ErrPolicyViolation, toAddress.Hex())
 	}
 	return nil
 }
@@ -114,7 +241,45 @@ func configPaths(b *PluginBackend) []*framework.Path {
 				"rpc_url": {
 					Type:        framework.TypeString,
 					Default:     InfuraRinkeby,
-					Description: "The RPC address of the Ethereum network",
+					Description: "The RPC address of the Ethereum network: an http(s):// or ws(s):// URL, or the absolute path of the node's IPC socket",
+				},
+				"rpc_urls": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Additional RPC addresses for the same network, used when rpc_url is unavailable",
+				},
+				"rpc_strategy": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{StrategyPriority, StrategyRoundRobin},
+					Default:       StrategyPriority,
+					Description: `How calls are spread over rpc_url and rpc_urls:
+
+					priority - try rpc_url first, then rpc_urls in order (default)
+					round-robin - rotate the first endpoint tried on every call`,
+				},
+				"rpc_timeout": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultRPCTimeout,
+					Description: "How long to wait for the RPC node to connect and respond to a single call; over WebSocket and IPC, only to connect",
+				},
+				"rpc_retries": {
+					Type:        framework.TypeInt,
+					Default:     DefaultRPCRetries,
+					Description: "How many times a failed RPC call is retried; a broadcast is never retried",
+				},
+				"rpc_backoff": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultRPCBackoff,
+					Description: "The delay before the first retry; doubled for each further retry",
+				},
+				"rpc_circuit_threshold": {
+					Type:        framework.TypeInt,
+					Default:     DefaultCircuitThreshold,
+					Description: "Consecutive RPC failures after which calls are rejected without contacting the node",
+				},
+				"rpc_circuit_cooldown": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultCircuitCooldown,
+					Description: "How long calls are rejected once the circuit opens",
 				},
 				"inclusions": {
 					Type:        framework.TypeCommaStringSlice,
@@ -124,6 +289,346 @@ func configPaths(b *PluginBackend) []*framework.Path {
 					Type:        framework.TypeCommaStringSlice,
 					Description: "These accounts can never be transacted with",
 				},
+				"allow_digest_signing": {
+					Type:    framework.TypeBool,
+					Default: false,
+					Description: `Allow accounts that opt in to sign caller-supplied raw digests
+through accounts/<name>/sign-digest. By default the mount is strict and only signs payloads it serialized itself.`,
+				},
+				"export_approver_groups": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Identity group names or IDs whose members may approve key exports, unless an account names its own approver_groups. Export is disabled when unset.",
+				},
+				"export_approval_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultExportApprovalTTL,
+					Description: "How long an export request remains valid for approval and release",
+				},
+				"authorizer_groups": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Identity group names or IDs whose members may approve the signing requests of warm accounts and tier changes, unless an account names its own approver_groups. Both are refused when unset.",
+				},
+				"authorization_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultAuthorizationTTL,
+					Description: "How long an authorization remains valid for approval and use",
+				},
+				"control_group_operations": {
+					Type: framework.TypeCommaStringSlice,
+					Description: `Operations every account, whatever its tier, performs only with an approved
+authorization: export, its export requests, and rotate, the replacement of its key.`,
+				},
+				"control_group_min_amount": {
+					Type:        framework.TypeString,
+					Description: "Transactions that send this many wei or more need an approved authorization on every account.",
+				},
+				"control_group_min_usd": {
+					Type:        framework.TypeString,
+					Description: "Transactions worth this many USD or more, priced as for the USD limits, need an approved authorization on every account.",
+				},
+				"mfa_method": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{Empty, mfaTOTP, mfaWebhook},
+					Description: `How the requester of a transaction at or above the MFA minimums steps up
+before it is signed: totp, with a code of the TOTP key they enrolled through
+mfa/totp in mfa_code, or webhook, which mfa_webhook_url challenges. No
+step-up if unset.`,
+				},
+				"mfa_webhook_url": {
+					Type:        framework.TypeString,
+					Description: "An http or https URL that is posted the requester, account, destination, amount and mfa_code of each transaction that needs a step-up, and answers {\"allow\": true} once the requester approves it, by a Duo push for example.",
+				},
+				"mfa_webhook_timeout": {
+					Type:        framework.TypeInt,
+					Default:     DefaultMFAWebhookTimeout,
+					Description: "Seconds to wait for the MFA webhook before refusing to sign.",
+				},
+				"mfa_min_amount": {
+					Type:        framework.TypeString,
+					Description: "Transactions that send this many wei or more need a step-up. With neither minimum set, every transaction does.",
+				},
+				"mfa_min_usd": {
+					Type:        framework.TypeString,
+					Description: "Transactions worth this many USD or more, priced as for the USD limits, need a step-up.",
+				},
+				"anomaly_rules": {
+					Type: framework.TypeCommaStringSlice,
+					Description: `The anomaly rules every transaction is checked with once its account has
+learned enough: volume_spike, new_destination and unusual_hours. See
+accounts/<name>/anomalies.`,
+				},
+				"anomaly_action": {
+					Type:          framework.TypeString,
+					Default:       anomalyActionApproval,
+					AllowedValues: []interface{}{anomalyActionApproval, anomalyActionFreeze},
+					Description:   "What an anomalous transaction does: approval asks for an approved authorization, freeze refuses it and freezes the account.",
+				},
+				"anomaly_sensitivity": {
+					Type:          framework.TypeString,
+					Default:       sensitivityMedium,
+					AllowedValues: []interface{}{sensitivityLow, sensitivityMedium, sensitivityHigh},
+					Description:   "How far from what an account usually does a transaction is an anomaly: low, medium or high, which finds the most.",
+				},
+				"anomaly_learning_transactions": {
+					Type:        framework.TypeInt,
+					Default:     DefaultAnomalyLearningTransactions,
+					Description: "The transactions an account signs before the anomaly rules apply to it.",
+				},
+				"keystore_kdf": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{util.KDFScrypt, util.KDFArgon2id},
+					Default:       util.KDFScrypt,
+					Description: `The key derivation function of the keystores account exports are
+encrypted in: scrypt, which every Core wallet reads, or argon2id, which is
+memory hard and tuned by the keystore_argon2 fields but only read by this
+plugin's import path. BLS exports are always EIP-2335, which has no argon2id.`,
+				},
+				"keystore_argon2_time": {
+					Type:        framework.TypeInt,
+					Default:     int(util.DefaultArgon2idParams.Time),
+					Description: "The passes argon2id makes over its memory.",
+				},
+				"keystore_argon2_memory": {
+					Type:        framework.TypeInt,
+					Default:     int(util.DefaultArgon2idParams.Memory),
+					Description: "The memory argon2id uses, in KiB.",
+				},
+				"keystore_argon2_threads": {
+					Type:        framework.TypeInt,
+					Default:     int(util.DefaultArgon2idParams.Threads),
+					Description: "The lanes argon2id computes in parallel.",
+				},
+				"lowercase_addresses_only": {
+					Type:    framework.TypeBool,
+					Default: false,
+					Description: `Only accept addresses in lowercase canonical form. Mixed-case
+addresses and addresses with a bad network prefix or checksum are always rejected.`,
+				},
+				"confirmation_depth": {
+					Type:        framework.TypeInt,
+					Default:     DefaultConfirmationDepth,
+					Description: "The number of blocks after which a broadcast transaction is considered confirmed",
+				},
+				"rebroadcast_reorged": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Re-broadcast transactions dropped by a reorg instead of only flagging them",
+				},
+				"notification_webhook_url": {
+					Type:        framework.TypeString,
+					Description: "A URL that security events, such as the use of a canary account, are POSTed to as JSON",
+				},
+				"approval_slack_webhook_url": {
+					Type:        framework.TypeString,
+					Description: "A Slack incoming webhook that every pending export request is posted to, with a link to it, and told when the request is decided.",
+				},
+				"approval_pagerduty_routing_key": {
+					Type:        framework.TypeString,
+					Description: "The routing key of a PagerDuty Events API v2 integration that an incident is raised on for every pending export request and resolved when it is decided.",
+				},
+				"approval_link_url": {
+					Type:        framework.TypeString,
+					Description: "The link posted with an approval request; {id} is replaced with the ID of the export request.",
+				},
+				"approval_callback_secret": {
+					Type:        framework.TypeString,
+					Description: "The secret approval-callback/<id> requests are signed with. Callbacks are refused while it is unset. It is never returned.",
+				},
+				"clef_accounts": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Names of the accounts the clef compatible endpoint may list and sign for. The endpoint is disabled when unset.",
+				},
+				"log_level": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{"trace", "debug", "info", "warn", "error"},
+					Description:   "The log level of this mount. Vault only shows what its own log level lets through.",
+				},
+				"log_redact_patterns": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Regular expressions whose matches are masked in every log line, on top of private keys, mnemonics and sensitive field names.",
+				},
+				"decision_log_file": {
+					Type:        framework.TypeString,
+					Description: "A file on the Vault host that every signing decision is appended to as a JSON line. Decisions are always logged under the decision logger as well.",
+				},
+				"decision_log_hmac": {
+					Type:        framework.TypeBool,
+					Description: "End every line of decision_log_file with an HMAC over the line and the line before it, so the log is tamper evident. Verify a log with decisions/verify.",
+				},
+				"decision_log_buffer": {
+					Type:        framework.TypeInt,
+					Default:     0,
+					Description: "Queue up to this many lines for decision_log_file and write them in the background, so a slow disk does not hold up signing. 0 writes every decision before the request returns.",
+				},
+				"decision_log_overflow": {
+					Type:          framework.TypeString,
+					Default:       overflowBlock,
+					AllowedValues: []interface{}{overflowBlock, overflowDrop},
+					Description:   "What happens when the decision_log_buffer is full: block waits for room, drop drops the decision and counts it under decisions/status.",
+				},
+				"decision_log_fsync": {
+					Type:          framework.TypeString,
+					Default:       fsyncNever,
+					AllowedValues: []interface{}{fsyncNever, fsyncAlways, fsyncBytes, fsyncInterval},
+					Description:   "When decision_log_file is synced to disk: never leaves it to the operating system, always syncs every line, bytes syncs once decision_log_fsync_bytes were written, interval syncs decision_log_fsync_interval seconds after a line was written.",
+				},
+				"decision_log_fsync_bytes": {
+					Type:        framework.TypeInt,
+					Default:     1048576,
+					Description: "With decision_log_fsync set to bytes, how many bytes are written between syncs.",
+				},
+				"decision_log_fsync_interval": {
+					Type:        framework.TypeInt,
+					Default:     1,
+					Description: "With decision_log_fsync set to interval, the most seconds a written line waits to be synced.",
+				},
+				"calldata_rules": calldataRulesSchema,
+				"policy_hook_url": {
+					Type:        framework.TypeString,
+					Description: "An http or https URL, such as an OPA data API document, that is posted {\"input\": ...} with the transaction, account and decoded calldata before each transaction is signed. Only an answer of {\"result\": true} or {\"result\": {\"allow\": true}} lets it be signed; when the hook cannot be reached nothing is signed.",
+				},
+				"policy_hook_timeout": {
+					Type:        framework.TypeInt,
+					Default:     DefaultPolicyHookTimeout,
+					Description: "Seconds to wait for the policy hook before refusing to sign.",
+				},
+				"policy_hook_cache_ttl": {
+					Type:        framework.TypeInt,
+					Default:     0,
+					Description: "Seconds to reuse an answer of the policy hook for the same transaction and context. 0 asks every time.",
+				},
+				"screening_url": {
+					Type: framework.TypeString,
+					Description: `An http or https URL of an AML screening API, or of an adapter to Chainalysis
+or TRM, that is posted {"address": ..., "chain_id": ...} for each destination
+of a transaction, its recipient and the addresses its call passes, before it
+is signed, and answers {"risk": "low", "medium", "high" or "severe",
+"reason": ...}. When it cannot be reached nothing is signed.`,
+				},
+				"screening_api_key": {
+					Type:        framework.TypeString,
+					Description: "A bearer token sent to the screening API. It is never returned.",
+				},
+				"screening_timeout": {
+					Type:        framework.TypeInt,
+					Default:     DefaultScreeningTimeout,
+					Description: "Seconds to wait for the screening API before refusing to sign.",
+				},
+				"screening_cache_ttl": {
+					Type:        framework.TypeInt,
+					Default:     DefaultScreeningCacheTTL,
+					Description: "Seconds to reuse a verdict of the screening API on an address. 0 asks every time.",
+				},
+				"screening_approval_risk": {
+					Type:          framework.TypeString,
+					Default:       riskHigh,
+					AllowedValues: []interface{}{riskLow, riskMedium, riskHigh, riskSevere},
+					Description:   "Transactions to a destination of this risk or higher need an approved authorization.",
+				},
+				"screening_block_risk": {
+					Type:          framework.TypeString,
+					Default:       riskSevere,
+					AllowedValues: []interface{}{riskLow, riskMedium, riskHigh, riskSevere},
+					Description:   "Transactions to a destination of this risk or higher are refused.",
+				},
+				"sanctions_list_url": {
+					Type:        framework.TypeString,
+					Description: "An http or https URL of a list of sanctioned addresses, one per line or a JSON array, that replaces the list of sanctions when fetched. A failed or empty fetch keeps the list.",
+				},
+				"sanctions_refresh_interval": {
+					Type:        framework.TypeInt,
+					Default:     DefaultSanctionsRefreshInterval,
+					Description: "Seconds between two fetches of sanctions_list_url.",
+				},
+				"shadow_url": {
+					Type: framework.TypeString,
+					Description: `The API URL of a mount to repeat every sign, sign-tx and sign-digest on and
+compare the signatures with, such as https://vault-b:8200/v1/core. See shadow.`,
+				},
+				"shadow_token": {
+					Type:        framework.TypeString,
+					Description: "The Vault token sent to the shadow mount. It is never returned.",
+				},
+				"shadow_timeout": {
+					Type:        framework.TypeInt,
+					Default:     DefaultShadowTimeout,
+					Description: "Seconds to wait for the shadow mount to sign before counting the comparison as failed.",
+				},
+				"envelope_transit_url": {
+					Type: framework.TypeString,
+					Description: `The API URL of a transit mount, such as https://vault-kms:8200/v1/transit, to
+wrap the data key of every account under a transit key of its own rather than
+under the mount key. Destroying an account deletes its transit key, which
+shreds the account in every backup of this mount's storage. The transit mount
+must be in a Vault whose storage is not backed up along with this one's.`,
+				},
+				"envelope_transit_token": {
+					Type:        framework.TypeString,
+					Description: "The Vault token sent to the transit mount. It is never returned.",
+				},
+				"broadcast_mode": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{BroadcastPublic, BroadcastPrivate},
+					Default:       BroadcastPublic,
+					Description: `How the accounts broadcast the transactions they send, unless their own
+broadcast says otherwise:
+
+					public - through the RPC endpoints, to the public mempool (default)
+					private - only to private_relay_urls, which keep it out of the mempool`,
+				},
+				"private_relay_urls": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The http or https URLs of the private relays, such as Flashbots Protect or an MEV-Share endpoint, that privately broadcast transactions are sent to. Every relay is sent each transaction.",
+				},
+				"usd_prices": {
+					Type:        framework.TypeKVPairs,
+					Description: "The USD prices the USD limits value transactions at, keyed by native for the native coin or by the address of an ERC-20 token. Each is the price of one whole coin or token, or the address of a Chainlink aggregator whose latestRoundData answers it.",
+				},
+				"usd_price_max_age": {
+					Type:        framework.TypeInt,
+					Default:     DefaultUSDPriceMaxAge,
+					Description: "Seconds since its last update after which the answer of a price feed is stale and nothing is signed.",
+				},
+				"max_usd_per_tx":  maxUSDPerTxSchema,
+				"daily_usd_limit": dailyUSDLimitSchema,
+				"proof_of_control_interval": {
+					Type:        framework.TypeInt,
+					Default:     DefaultProofOfControlInterval,
+					Description: "The least number of seconds between two proofs of control. 0 lets them be made back to back.",
+				},
+				"inventory_push_url": {
+					Type:        framework.TypeString,
+					Description: "An S3 or Google Cloud Storage bucket URL, with a key prefix if any, that snapshots of the inventory are PUT to, such as https://bucket.s3.eu-west-1.amazonaws.com/monitoring or https://storage.googleapis.com/bucket/monitoring. Nothing is pushed while it is unset.",
+				},
+				"inventory_push_cron": {
+					Type:        framework.TypeString,
+					Default:     DefaultInventoryPushCron,
+					Description: "When to push a snapshot of the inventory, as a crontab expression in UTC or a macro such as @hourly.",
+				},
+				"inventory_push_format": {
+					Type:          framework.TypeString,
+					Default:       formatJSON,
+					AllowedValues: []interface{}{formatJSON, formatCSV},
+					Description:   "The format of the pushed snapshots: json or csv.",
+				},
+				"inventory_push_region": {
+					Type:        framework.TypeString,
+					Default:     DefaultInventoryPushRegion,
+					Description: "The region pushes are signed for; auto for Google Cloud Storage.",
+				},
+				"inventory_push_access_key_id": {
+					Type:        framework.TypeString,
+					Description: "The AWS access key ID, or Google Cloud Storage HMAC access ID, pushes are signed with.",
+				},
+				"inventory_push_secret_access_key": {
+					Type:        framework.TypeString,
+					Description: "The secret of inventory_push_access_key_id. It is never returned.",
+				},
+				"slow_request_threshold": {
+					Type:        framework.TypeInt,
+					Default:     0,
+					Description: "Log a warning, with the time spent in storage, key derivation and RPC calls, for every request that takes this many milliseconds or more. 0 turns it off.",
+				},
 				"bound_cidr_list": {
 					Type: framework.TypeCommaStringSlice,
 					Description: `Comma separated string or list of CIDR blocks.
@@ -139,6 +644,304 @@ func (config *ConfigJSON) getRPCURL() string {
 	return config.RPC
 }
 
+// rpcURLs returns rpc_url followed by the fallback endpoints, without duplicates
+func (config *ConfigJSON) rpcURLs() []string {
+	var urls []string
+	if config.RPC != Empty {
+		urls = append(urls, config.RPC)
+	}
+	return util.Dedup(append(urls, config.RPCURLs...))
+}
+
+func (config *ConfigJSON) rpcStrategy() string {
+	if config.RPCStrategy == Empty {
+		return StrategyPriority
+	}
+	return config.RPCStrategy
+}
+
+func (config *ConfigJSON) exportApprovalTTL() int {
+	if config.ExportApprovalTTL <= 0 {
+		return DefaultExportApprovalTTL
+	}
+	return config.ExportApprovalTTL
+}
+
+func (config *ConfigJSON) authorizationTTL() int {
+	if config.AuthorizationTTL <= 0 {
+		return DefaultAuthorizationTTL
+	}
+	return config.AuthorizationTTL
+}
+
+// anomalyAction returns what an anomalous transaction does
+func (config *ConfigJSON) anomalyAction() string {
+	if config.AnomalyAction == Empty {
+		return anomalyActionApproval
+	}
+	return config.AnomalyAction
+}
+
+func (config *ConfigJSON) anomalySensitivity() string {
+	if config.AnomalySensitivity == Empty {
+		return sensitivityMedium
+	}
+	return config.AnomalySensitivity
+}
+
+// anomalyLearningTransactions returns the transactions an account signs
+// before the anomaly rules apply; 0 applies them from the first
+func (config *ConfigJSON) anomalyLearningTransactions() int {
+	if config.AnomalyLearningTransactions < 0 {
+		return DefaultAnomalyLearningTransactions
+	}
+	return config.AnomalyLearningTransactions
+}
+
+// screeningApprovalRisk returns the risk from which destinations need an authorization
+func (config *ConfigJSON) screeningApprovalRisk() string {
+	if config.ScreeningApprovalRisk == Empty {
+		return riskHigh
+	}
+	return config.ScreeningApprovalRisk
+}
+
+// screeningBlockRisk returns the risk from which destinations are refused
+func (config *ConfigJSON) screeningBlockRisk() string {
+	if config.ScreeningBlockRisk == Empty {
+		return riskSevere
+	}
+	return config.ScreeningBlockRisk
+}
+
+// sanctionsRefreshInterval returns the seconds between two fetches of sanctions_list_url
+func (config *ConfigJSON) sanctionsRefreshInterval() int {
+	if config.SanctionsRefreshInterval <= 0 {
+		return DefaultSanctionsRefreshInterval
+	}
+	return config.SanctionsRefreshInterval
+}
+
+// shadowTimeout returns the seconds the shadow mount has to sign
+func (config *ConfigJSON) shadowTimeout() int {
+	if config.ShadowTimeout <= 0 {
+		return DefaultShadowTimeout
+	}
+	return config.ShadowTimeout
+}
+
+// broadcastMode returns how accounts without a broadcast of their own broadcast
+func (config *ConfigJSON) broadcastMode() string {
+	if config.BroadcastMode == Empty {
+		return BroadcastPublic
+	}
+	return config.BroadcastMode
+}
+
+// keystoreKDF returns the KDF of export keystores; configs written before it was set export with scrypt
+func (config *ConfigJSON) keystoreKDF() string {
+	if config.KeystoreKDF == Empty {
+		return util.KDFScrypt
+	}
+	return config.KeystoreKDF
+}
+
+// argon2idParams returns the argon2id costs, the defaults for configs written before they were set
+func (config *ConfigJSON) argon2idParams() util.Argon2idParams {
+	params := util.DefaultArgon2idParams
+	if config.KeystoreArgon2Time > 0 {
+		params.Time = uint32(config.KeystoreArgon2Time)
+	}
+	if config.KeystoreArgon2Memory > 0 {
+		params.Memory = uint32(config.KeystoreArgon2Memory)
+	}
+	if config.KeystoreArgon2Threads > 0 {
+		params.Threads = uint8(config.KeystoreArgon2Threads)
+	}
+	return params
+}
+
+func (config *ConfigJSON) inventoryPushCron() string {
+	if config.InventoryPushCron == Empty {
+		return DefaultInventoryPushCron
+	}
+	return config.InventoryPushCron
+}
+
+func (config *ConfigJSON) inventoryPushFormat() string {
+	if config.InventoryPushFormat == Empty {
+		return formatJSON
+	}
+	return config.InventoryPushFormat
+}
+
+func (config *ConfigJSON) inventoryPushRegion() string {
+	if config.InventoryPushRegion == Empty {
+		return DefaultInventoryPushRegion
+	}
+	return config.InventoryPushRegion
+}
+
+func (config *ConfigJSON) confirmationDepth() int {
+	if config.ConfirmationDepth <= 0 {
+		return DefaultConfirmationDepth
+	}
+	return config.ConfirmationDepth
+}
+
+func (config *ConfigJSON) rpcTimeout() int {
+	if config.RPCTimeout <= 0 {
+		return DefaultRPCTimeout
+	}
+	return config.RPCTimeout
+}
+
+func (config *ConfigJSON) rpcRetries() int {
+	if config.RPCRetries < 0 {
+		return 0
+	}
+	return config.RPCRetries
+}
+
+func (config *ConfigJSON) rpcBackoff() int {
+	if config.RPCBackoff < 0 {
+		return 0
+	}
+	return config.RPCBackoff
+}
+
+func (config *ConfigJSON) circuitThreshold() int {
+	if config.CircuitLimit <= 0 {
+		return DefaultCircuitThreshold
+	}
+	return config.CircuitLimit
+}
+
+func (config *ConfigJSON) circuitCooldown() int {
+	if config.CircuitReset <= 0 {
+		return DefaultCircuitCooldown
+	}
+	return config.CircuitReset
+}
+
+func (config *ConfigJSON) responseData() map[string]interface{} {
+	usdPrices := config.USDPrices
+	if usdPrices == nil {
+		usdPrices = map[string]string{}
+	}
+	privateRelayURLs := config.PrivateRelayURLs
+	if privateRelayURLs == nil {
+		privateRelayURLs = []string{}
+	}
+	return map[string]interface{}{
+		"bound_cidr_list":       config.BoundCIDRList,
+		"inclusions":            config.Inclusions,
+		"exclusions":            config.Exclusions,
+		"rpc_url":               config.RPC,
+		"rpc_urls":              config.RPCURLs,
+		"rpc_strategy":          config.rpcStrategy(),
+		"chain_id":              config.ChainID,
+		"rpc_timeout":           config.rpcTimeout(),
+		"rpc_retries":           config.rpcRetries(),
+		"rpc_backoff":           config.rpcBackoff(),
+		"rpc_circuit_threshold": config.circuitThreshold(),
+		"rpc_circuit_cooldown":  config.circuitCooldown(),
+		"allow_digest_signing":  config.AllowDigestSigning,
+
+		"export_approver_groups": config.ExportApproverGroups,
+		"export_approval_ttl":    config.exportApprovalTTL(),
+
+		"authorizer_groups": config.AuthorizerGroups,
+		"authorization_ttl": config.authorizationTTL(),
+
+		"control_group_operations": config.ControlGroupOperations,
+		"control_group_min_amount": config.ControlGroupMinAmount,
+		"control_group_min_usd":    config.ControlGroupMinUSD,
+
+		"mfa_method":          config.MFAMethod,
+		"mfa_webhook_url":     config.MFAWebhookURL,
+		"mfa_webhook_timeout": config.MFAWebhookTimeout,
+		"mfa_min_amount":      config.MFAMinAmount,
+		"mfa_min_usd":         config.MFAMinUSD,
+
+		"anomaly_rules":                 config.AnomalyRules,
+		"anomaly_action":                config.anomalyAction(),
+		"anomaly_sensitivity":           config.anomalySensitivity(),
+		"anomaly_learning_transactions": config.anomalyLearningTransactions(),
+
+		"keystore_kdf":            config.keystoreKDF(),
+		"keystore_argon2_time":    config.argon2idParams().Time,
+		"keystore_argon2_memory":  config.argon2idParams().Memory,
+		"keystore_argon2_threads": config.argon2idParams().Threads,
+
+		"lowercase_addresses_only": config.LowercaseAddressesOnly,
+
+		"confirmation_depth":  config.confirmationDepth(),
+		"rebroadcast_reorged": config.RebroadcastReorged,
+
+		"notification_webhook_url": config.NotificationWebhookURL,
+		"clef_accounts":            config.ClefAccounts,
+
+		"approval_slack_webhook_url":     config.ApprovalSlackWebhookURL,
+		"approval_pagerduty_routing_key": config.ApprovalPagerDutyRoutingKey,
+		"approval_link_url":              config.ApprovalLinkURL,
+		"approval_callback_secret_set":   config.ApprovalCallbackSecret != Empty,
+
+		"log_level":           config.LogLevel,
+		"log_redact_patterns": config.LogRedactPatterns,
+
+		"decision_log_file":           config.DecisionLogFile,
+		"decision_log_hmac":           config.DecisionLogHMAC,
+		"decision_log_buffer":         config.DecisionLogBuffer,
+		"decision_log_overflow":       config.DecisionLogOverflow,
+		"decision_log_fsync":          config.DecisionLogFsync,
+		"decision_log_fsync_bytes":    config.DecisionLogFsyncBytes,
+		"decision_log_fsync_interval": config.DecisionLogFsyncInterval,
+
+		"slow_request_threshold": config.SlowRequestThreshold,
+
+		"calldata_rules": config.CalldataRules,
+
+		"policy_hook_url":       config.PolicyHookURL,
+		"policy_hook_timeout":   config.PolicyHookTimeout,
+		"policy_hook_cache_ttl": config.PolicyHookCacheTTL,
+
+		"screening_url":           config.ScreeningURL,
+		"screening_api_key_set":   config.ScreeningAPIKey != Empty,
+		"screening_timeout":       config.ScreeningTimeout,
+		"screening_cache_ttl":     config.ScreeningCacheTTL,
+		"screening_approval_risk": config.screeningApprovalRisk(),
+		"screening_block_risk":    config.screeningBlockRisk(),
+
+		"sanctions_list_url":         config.SanctionsListURL,
+		"sanctions_refresh_interval": config.sanctionsRefreshInterval(),
+
+		"shadow_url":       config.ShadowURL,
+		"shadow_token_set": config.ShadowToken != Empty,
+		"shadow_timeout":   config.shadowTimeout(),
+
+		"envelope_transit_url":       config.EnvelopeTransitURL,
+		"envelope_transit_token_set": config.EnvelopeTransitToken != Empty,
+
+		"broadcast_mode":     config.broadcastMode(),
+		"private_relay_urls": privateRelayURLs,
+
+		"usd_prices":        usdPrices,
+		"usd_price_max_age": config.USDPriceMaxAge,
+		"max_usd_per_tx":    config.MaxUSDPerTx,
+		"daily_usd_limit":   config.DailyUSDLimit,
+
+		"proof_of_control_interval": config.ProofOfControlInterval,
+
+		"inventory_push_url":                   config.InventoryPushURL,
+		"inventory_push_cron":                  config.inventoryPushCron(),
+		"inventory_push_format":                config.inventoryPushFormat(),
+		"inventory_push_region":                config.inventoryPushRegion(),
+		"inventory_push_access_key_id":         config.InventoryPushAccessKeyID,
+		"inventory_push_secret_access_key_set": config.InventoryPushSecretAccessKey != Empty,
+	}
+}
+
 func (b *PluginBackend) pathWriteConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	rpcURL := data.Get("rpc_url").(string)
 	chainID := data.Get("chain_id").(string)
@@ -146,6 +949,91 @@ func (b *PluginBackend) pathWriteConfig(ctx context.Context, req *logical.Reques
 	if boundCIDRListRaw, ok := data.GetOk("bound_cidr_list"); ok {
 		boundCIDRList = boundCIDRListRaw.([]string)
 	}
+	var rpcURLs []string
+	if rpcURLsRaw, ok := data.GetOk("rpc_urls"); ok {
+		rpcURLs = rpcURLsRaw.([]string)
+	}
+	if err := validRPCURLs(append([]string{rpcURL}, rpcURLs...)...); err != nil {
+		return nil, err
+	}
+	rpcStrategy := data.Get("rpc_strategy").(string)
+	if rpcStrategy != StrategyPriority && rpcStrategy != StrategyRoundRobin {
+		return nil, fmt.Errorf("%w: unknown rpc_strategy %s", ErrInvalidInput, rpcStrategy)
+	}
+	var exportApproverGroups []string
+	if exportApproverGroupsRaw, ok := data.GetOk("export_approver_groups"); ok {
+		exportApproverGroups = exportApproverGroupsRaw.([]string)
+	}
+	var authorizerGroups []string
+	if authorizerGroupsRaw, ok := data.GetOk("authorizer_groups"); ok {
+		authorizerGroups = authorizerGroupsRaw.([]string)
+	}
+	var controlGroupOperations []string
+	if controlGroupOperationsRaw, ok := data.GetOk("control_group_operations"); ok {
+		controlGroupOperations = util.Dedup(controlGroupOperationsRaw.([]string))
+	}
+	for _, operation := range controlGroupOperations {
+		if !util.Contains([]string{controlGroupExport, controlGroupRotate}, operation) {
+			return nil, fmt.Errorf("%w: unknown control group operation %s", ErrInvalidInput, operation)
+		}
+	}
+	controlGroupMinAmount := data.Get("control_group_min_amount").(string)
+	if controlGroupMinAmount != Empty {
+		minAmount := util.ValidNumber(controlGroupMinAmount)
+		if minAmount == nil {
+			return nil, fmt.Errorf("%w: control_group_min_amount must be an amount in wei", ErrInvalidInput)
+		}
+		controlGroupMinAmount = minAmount.String()
+	}
+	controlGroupMinUSD, err := parseUSDLimit("control_group_min_usd", data.Get("control_group_min_usd").(string))
+	if err != nil {
+		return nil, err
+	}
+	mfaMethod := data.Get("mfa_method").(string)
+	mfaWebhookURL := data.Get("mfa_webhook_url").(string)
+	if mfaWebhookURL != Empty {
+		if parsed, err := url.Parse(mfaWebhookURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%w: mfa_webhook_url must be an http or https URL", ErrInvalidInput)
+		}
+	}
+	if mfaMethod == mfaWebhook && mfaWebhookURL == Empty {
+		return nil, fmt.Errorf("%w: mfa_method webhook needs mfa_webhook_url", ErrInvalidInput)
+	}
+	mfaMinAmount := data.Get("mfa_min_amount").(string)
+	if mfaMinAmount != Empty {
+		minAmount := util.ValidNumber(mfaMinAmount)
+		if minAmount == nil {
+			return nil, fmt.Errorf("%w: mfa_min_amount must be an amount in wei", ErrInvalidInput)
+		}
+		mfaMinAmount = minAmount.String()
+	}
+	mfaMinUSD, err := parseUSDLimit("mfa_min_usd", data.Get("mfa_min_usd").(string))
+	if err != nil {
+		return nil, err
+	}
+	var anomalyRulesList []string
+	if anomalyRulesRaw, ok := data.GetOk("anomaly_rules"); ok {
+		anomalyRulesList = util.Dedup(anomalyRulesRaw.([]string))
+	}
+	for _, rule := range anomalyRulesList {
+		if !util.Contains(anomalyRules, rule) {
+			return nil, fmt.Errorf("%w: unknown anomaly rule %s", ErrInvalidInput, rule)
+		}
+	}
+	anomalyAction, anomalySensitivity := data.Get("anomaly_action").(string), data.Get("anomaly_sensitivity").(string)
+	if anomalyAction != anomalyActionApproval && anomalyAction != anomalyActionFreeze {
+		return nil, fmt.Errorf("%w: anomaly_action must be approval or freeze", ErrInvalidInput)
+	}
+	if _, ok := anomalyThresholds[anomalySensitivity]; !ok {
+		return nil, fmt.Errorf("%w: anomaly_sensitivity must be low, medium or high", ErrInvalidInput)
+	}
+	if data.Get("anomaly_learning_transactions").(int) < 0 {
+		return nil, fmt.Errorf("%w: anomaly_learning_transactions cannot be negative", ErrInvalidInput)
+	}
+	var clefAccounts []string
+	if clefAccountsRaw, ok := data.GetOk("clef_accounts"); ok {
+		clefAccounts = clefAccountsRaw.([]string)
+	}
 	var inclusions []string
 	if inclusionsRaw, ok := data.GetOk("inclusions"); ok {
 		inclusions = inclusionsRaw.([]string)
@@ -154,12 +1042,277 @@ func (b *PluginBackend) pathWriteConfig(ctx context.Context, req *logical.Reques
 	if exclusionsRaw, ok := data.GetOk("exclusions"); ok {
 		exclusions = exclusionsRaw.([]string)
 	}
+	notificationWebhookURL := data.Get("notification_webhook_url").(string)
+	if notificationWebhookURL != Empty {
+		if parsed, err := url.Parse(notificationWebhookURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%w: notification_webhook_url must be an http or https URL", ErrInvalidInput)
+		}
+	}
+	for _, field := range []string{"approval_slack_webhook_url", "approval_link_url"} {
+		if value := data.Get(field).(string); value != Empty {
+			if parsed, err := url.Parse(value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				return nil, fmt.Errorf("%w: %s must be an http or https URL", ErrInvalidInput, field)
+			}
+		}
+	}
+	logLevel := strings.ToLower(data.Get("log_level").(string))
+	if logLevel != Empty && (hclog.LevelFromString(logLevel) == hclog.NoLevel || logLevel == "off") {
+		return nil, fmt.Errorf("%w: unknown log_level %s", ErrInvalidInput, logLevel)
+	}
+	var logRedactPatterns []string
+	if logRedactPatternsRaw, ok := data.GetOk("log_redact_patterns"); ok {
+		logRedactPatterns = logRedactPatternsRaw.([]string)
+	}
+	for _, pattern := range logRedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("%w: log_redact_patterns: %v", ErrInvalidInput, err)
+		}
+	}
+	decisionLogBuffer := data.Get("decision_log_buffer").(int)
+	if decisionLogBuffer < 0 {
+		return nil, fmt.Errorf("%w: decision_log_buffer cannot be negative", ErrInvalidInput)
+	}
+	decisionLogOverflow := data.Get("decision_log_overflow").(string)
+	if decisionLogOverflow != overflowBlock && decisionLogOverflow != overflowDrop {
+		return nil, fmt.Errorf("%w: decision_log_overflow must be %s or %s", ErrInvalidInput, overflowBlock, overflowDrop)
+	}
+	decisionLogFsync := data.Get("decision_log_fsync").(string)
+	switch decisionLogFsync {
+	case fsyncNever, fsyncAlways:
+	case fsyncBytes:
+		if data.Get("decision_log_fsync_bytes").(int) <= 0 {
+			return nil, fmt.Errorf("%w: decision_log_fsync_bytes must be positive", ErrInvalidInput)
+		}
+	case fsyncInterval:
+		if data.Get("decision_log_fsync_interval").(int) <= 0 {
+			return nil, fmt.Errorf("%w: decision_log_fsync_interval must be positive", ErrInvalidInput)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown decision_log_fsync %s", ErrInvalidInput, decisionLogFsync)
+	}
+	slowRequestThreshold := data.Get("slow_request_threshold").(int)
+	if slowRequestThreshold < 0 {
+		return nil, fmt.Errorf("%w: slow_request_threshold cannot be negative", ErrInvalidInput)
+	}
+	policyHookURL := data.Get("policy_hook_url").(string)
+	if policyHookURL != Empty {
+		if parsed, err := url.Parse(policyHookURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%w: policy_hook_url must be an http or https URL", ErrInvalidInput)
+		}
+	}
+	if data.Get("policy_hook_timeout").(int) <= 0 {
+		return nil, fmt.Errorf("%w: policy_hook_timeout must be positive", ErrInvalidInput)
+	}
+	if data.Get("policy_hook_cache_ttl").(int) < 0 {
+		return nil, fmt.Errorf("%w: policy_hook_cache_ttl cannot be negative", ErrInvalidInput)
+	}
+	calldataRules, err := parseCalldataRules(data.Get("calldata_rules").([]string))
+	if err != nil {
+		return nil, err
+	}
+	keystoreKDF := data.Get("keystore_kdf").(string)
+	if keystoreKDF != util.KDFScrypt && keystoreKDF != util.KDFArgon2id {
+		return nil, fmt.Errorf("%w: unknown keystore_kdf %s", ErrInvalidInput, keystoreKDF)
+	}
+	argon2Time, argon2Memory, argon2Threads := data.Get("keystore_argon2_time").(int), data.Get("keystore_argon2_memory").(int), data.Get("keystore_argon2_threads").(int)
+	if argon2Time < 1 || argon2Memory < 1 || argon2Threads < 1 || argon2Threads > 255 || argon2Memory > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: keystore_argon2_time, keystore_argon2_memory and keystore_argon2_threads must be positive, threads at most 255", ErrInvalidInput)
+	}
+	if err := (util.Argon2idParams{Time: uint32(argon2Time), Memory: uint32(argon2Memory), Threads: uint8(argon2Threads)}).Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	screeningURL := data.Get("screening_url").(string)
+	if screeningURL != Empty {
+		if parsed, err := url.Parse(screeningURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%w: screening_url must be an http or https URL", ErrInvalidInput)
+		}
+	}
+	screeningApprovalRisk, screeningBlockRisk := data.Get("screening_approval_risk").(string), data.Get("screening_block_risk").(string)
+	if riskRank(screeningApprovalRisk) < 0 || riskRank(screeningBlockRisk) < 0 {
+		return nil, fmt.Errorf("%w: screening risks must be low, medium, high or severe", ErrInvalidInput)
+	}
+	sanctionsListURL := data.Get("sanctions_list_url").(string)
+	if sanctionsListURL != Empty {
+		if parsed, err := url.Parse(sanctionsListURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%w: sanctions_list_url must be an http or https URL", ErrInvalidInput)
+		}
+	}
+	shadowURL := data.Get("shadow_url").(string)
+	if shadowURL != Empty {
+		if parsed, err := url.Parse(shadowURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%w: shadow_url must be an http or https URL", ErrInvalidInput)
+		}
+	}
+	envelopeTransitURL := strings.TrimSuffix(data.Get("envelope_transit_url").(string), "/")
+	if envelopeTransitURL != Empty {
+		if parsed, err := url.Parse(envelopeTransitURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%w: envelope_transit_url must be an http or https URL", ErrInvalidInput)
+		}
+	}
+	broadcastMode := data.Get("broadcast_mode").(string)
+	if broadcastMode != BroadcastPublic && broadcastMode != BroadcastPrivate {
+		return nil, fmt.Errorf("%w: unknown broadcast_mode %s", ErrInvalidInput, broadcastMode)
+	}
+	privateRelayURLs := util.Dedup(data.Get("private_relay_urls").([]string))
+	for _, relayURL := range privateRelayURLs {
+		if parsed, err := url.Parse(relayURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("%w: private_relay_urls must be http or https URLs", ErrInvalidInput)
+		}
+	}
+	if broadcastMode == BroadcastPrivate && len(privateRelayURLs) == 0 {
+		return nil, fmt.Errorf("%w: broadcast_mode private needs private_relay_urls", ErrInvalidInput)
+	}
+	if data.Get("screening_cache_ttl").(int) < 0 {
+		return nil, fmt.Errorf("%w: screening_cache_ttl cannot be negative", ErrInvalidInput)
+	}
+	if data.Get("proof_of_control_interval").(int) < 0 {
+		return nil, fmt.Errorf("%w: proof_of_control_interval cannot be negative", ErrInvalidInput)
+	}
+	inventoryPushURL := data.Get("inventory_push_url").(string)
+	inventoryPushFormat := data.Get("inventory_push_format").(string)
+	if inventoryPushURL != Empty {
+		if parsed, err := url.Parse(inventoryPushURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.RawQuery != Empty {
+			return nil, fmt.Errorf("%w: inventory_push_url must be an http or https URL without a query", ErrInvalidInput)
+		}
+		if data.Get("inventory_push_access_key_id").(string) == Empty || data.Get("inventory_push_secret_access_key").(string) == Empty {
+			return nil, fmt.Errorf("%w: inventory_push_url needs inventory_push_access_key_id and inventory_push_secret_access_key", ErrInvalidInput)
+		}
+	}
+	if _, err := parseCron(data.Get("inventory_push_cron").(string)); err != nil {
+		return nil, err
+	}
+	if inventoryPushFormat != formatJSON && inventoryPushFormat != formatCSV {
+		return nil, fmt.Errorf("%w: unknown inventory_push_format %s", ErrInvalidInput, inventoryPushFormat)
+	}
+	if data.Get("usd_price_max_age").(int) <= 0 {
+		return nil, fmt.Errorf("%w: usd_price_max_age must be positive", ErrInvalidInput)
+	}
+	maxUSDPerTx, err := parseUSDLimit("max_usd_per_tx", data.Get("max_usd_per_tx").(string))
+	if err != nil {
+		return nil, err
+	}
+	dailyUSDLimit, err := parseUSDLimit("daily_usd_limit", data.Get("daily_usd_limit").(string))
+	if err != nil {
+		return nil, err
+	}
+	lowercaseAddressesOnly := data.Get("lowercase_addresses_only").(bool)
+	usdPrices, err := normalizeUSDPrices(data.Get("usd_prices").(map[string]string), lowercaseAddressesOnly)
+	if err != nil {
+		return nil, err
+	}
+	inclusions, err = util.NormalizeAddresses(inclusions, lowercaseAddressesOnly)
+	if err != nil {
+		return nil, wrapError(ErrInvalidAddress, err)
+	}
+	exclusions, err = util.NormalizeAddresses(exclusions, lowercaseAddressesOnly)
+	if err != nil {
+		return nil, wrapError(ErrInvalidAddress, err)
+	}
 	configBundle := ConfigJSON{
 		BoundCIDRList: boundCIDRList,
 		Inclusions:    inclusions,
 		Exclusions:    exclusions,
 		ChainID:       chainID,
 		RPC:           rpcURL,
+		RPCURLs:       util.Dedup(rpcURLs),
+		RPCStrategy:   rpcStrategy,
+		RPCTimeout:    data.Get("rpc_timeout").(int),
+		RPCRetries:    data.Get("rpc_retries").(int),
+		RPCBackoff:    data.Get("rpc_backoff").(int),
+		CircuitLimit:  data.Get("rpc_circuit_threshold").(int),
+		CircuitReset:  data.Get("rpc_circuit_cooldown").(int),
+
+		AllowDigestSigning:   data.Get("allow_digest_signing").(bool),
+		ExportApproverGroups: util.Dedup(exportApproverGroups),
+		ExportApprovalTTL:    data.Get("export_approval_ttl").(int),
+		AuthorizerGroups:     util.Dedup(authorizerGroups),
+		AuthorizationTTL:     data.Get("authorization_ttl").(int),
+
+		ControlGroupOperations: controlGroupOperations,
+		ControlGroupMinAmount:  controlGroupMinAmount,
+		ControlGroupMinUSD:     controlGroupMinUSD,
+
+		MFAMethod:         mfaMethod,
+		MFAWebhookURL:     mfaWebhookURL,
+		MFAWebhookTimeout: data.Get("mfa_webhook_timeout").(int),
+		MFAMinAmount:      mfaMinAmount,
+		MFAMinUSD:         mfaMinUSD,
+
+		AnomalyRules:                anomalyRulesList,
+		AnomalyAction:               anomalyAction,
+		AnomalySensitivity:          anomalySensitivity,
+		AnomalyLearningTransactions: data.Get("anomaly_learning_transactions").(int),
+
+		KeystoreKDF:           keystoreKDF,
+		KeystoreArgon2Time:    data.Get("keystore_argon2_time").(int),
+		KeystoreArgon2Memory:  data.Get("keystore_argon2_memory").(int),
+		KeystoreArgon2Threads: data.Get("keystore_argon2_threads").(int),
+
+		LowercaseAddressesOnly: lowercaseAddressesOnly,
+
+		ConfirmationDepth:  data.Get("confirmation_depth").(int),
+		RebroadcastReorged: data.Get("rebroadcast_reorged").(bool),
+
+		NotificationWebhookURL: notificationWebhookURL,
+		ClefAccounts:           util.Dedup(clefAccounts),
+
+		ApprovalSlackWebhookURL:     data.Get("approval_slack_webhook_url").(string),
+		ApprovalPagerDutyRoutingKey: data.Get("approval_pagerduty_routing_key").(string),
+		ApprovalLinkURL:             data.Get("approval_link_url").(string),
+		ApprovalCallbackSecret:      data.Get("approval_callback_secret").(string),
+
+		LogLevel:          logLevel,
+		LogRedactPatterns: logRedactPatterns,
+
+		DecisionLogFile:          data.Get("decision_log_file").(string),
+		DecisionLogHMAC:          data.Get("decision_log_hmac").(bool),
+		DecisionLogBuffer:        decisionLogBuffer,
+		DecisionLogOverflow:      decisionLogOverflow,
+		DecisionLogFsync:         decisionLogFsync,
+		DecisionLogFsyncBytes:    data.Get("decision_log_fsync_bytes").(int),
+		DecisionLogFsyncInterval: data.Get("decision_log_fsync_interval").(int),
+
+		SlowRequestThreshold: slowRequestThreshold,
+
+		CalldataRules: calldataRules,
+
+		PolicyHookURL:      policyHookURL,
+		PolicyHookTimeout:  data.Get("policy_hook_timeout").(int),
+		PolicyHookCacheTTL: data.Get("policy_hook_cache_ttl").(int),
+
+		ScreeningURL:          screeningURL,
+		ScreeningAPIKey:       data.Get("screening_api_key").(string),
+		ScreeningTimeout:      data.Get("screening_timeout").(int),
+		ScreeningCacheTTL:     data.Get("screening_cache_ttl").(int),
+		ScreeningApprovalRisk: screeningApprovalRisk,
+		ScreeningBlockRisk:    screeningBlockRisk,
+
+		SanctionsListURL:         sanctionsListURL,
+		SanctionsRefreshInterval: data.Get("sanctions_refresh_interval").(int),
+
+		ShadowURL:     shadowURL,
+		ShadowToken:   data.Get("shadow_token").(string),
+		ShadowTimeout: data.Get("shadow_timeout").(int),
+
+		EnvelopeTransitURL:   envelopeTransitURL,
+		EnvelopeTransitToken: data.Get("envelope_transit_token").(string),
+
+		BroadcastMode:    broadcastMode,
+		PrivateRelayURLs: privateRelayURLs,
+
+		USDPrices:      usdPrices,
+		USDPriceMaxAge: data.Get("usd_price_max_age").(int),
+		MaxUSDPerTx:    maxUSDPerTx,
+		DailyUSDLimit:  dailyUSDLimit,
+
+		ProofOfControlInterval: data.Get("proof_of_control_interval").(int),
+
+		InventoryPushURL:             inventoryPushURL,
+		InventoryPushCron:            data.Get("inventory_push_cron").(string),
+		InventoryPushFormat:          inventoryPushFormat,
+		InventoryPushRegion:          data.Get("inventory_push_region").(string),
+		InventoryPushAccessKeyID:     data.Get("inventory_push_access_key_id").(string),
+		InventoryPushSecretAccessKey: data.Get("inventory_push_secret_access_key").(string),
 	}
 	entry, err := logical.StorageEntryJSON("config", configBundle)
 
@@ -170,15 +1323,10 @@ func (b *PluginBackend) pathWriteConfig(ctx context.Context, req *logical.Reques
 	if err := req.Storage.Put(ctx, entry); err != nil {
 		return nil, err
 	}
+	b.applyLogConfig(&configBundle)
 	// Return the secret
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"bound_cidr_list": configBundle.BoundCIDRList,
-			"inclusions":      configBundle.Inclusions,
-			"exclusions":      configBundle.Exclusions,
-			"rpc_url":         configBundle.RPC,
-			"chain_id":        configBundle.ChainID,
-		},
+		Data: configBundle.responseData(),
 	}, nil
 }
 
@@ -194,13 +1342,7 @@ func (b *PluginBackend) pathReadConfig(ctx context.Context, req *logical.Request
 
 	// Return the secret
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"bound_cidr_list": configBundle.BoundCIDRList,
-			"inclusions":      configBundle.Inclusions,
-			"exclusions":      configBundle.Exclusions,
-			"rpc_url":         configBundle.RPC,
-			"chain_id":        configBundle.ChainID,
-		},
+		Data: configBundle.responseData(),
 	}, nil
 }
 
@@ -212,7 +1354,7 @@ func (b *PluginBackend) readConfig(ctx context.Context, s logical.Storage) (*Con
 	}
 
 	if entry == nil {
-		return nil, fmt.Errorf("the plugin has not been configured yet")
+		return nil, ErrNotConfigured
 	}
 
 	var result ConfigJSON
@@ -221,6 +1363,9 @@ func (b *PluginBackend) readConfig(ctx context.Context, s logical.Storage) (*Con
 			return nil, fmt.Errorf("error reading configuration: %s", err)
 		}
 	}
+	if _, chain := chainFromContext(ctx); chain != nil {
+		chain.apply(&result)
+	}
 
 	return &result, nil
 }
@@ -233,6 +1378,7 @@ func (b *PluginBackend) configured(ctx context.Context, req *logical.Request) (*
 	if validConnection, err := b.validIPConstraints(config, req); !validConnection {
 		return nil, err
 	}
+	b.applyLogConfig(config)
 
 	return config, nil
 }
@@ -240,7 +1386,7 @@ func (b *PluginBackend) configured(ctx context.Context, req *logical.Request) (*
 func (b *PluginBackend) validIPConstraints(config *ConfigJSON, req *logical.Request) (bool, error) {
 	if len(config.BoundCIDRList) != 0 {
 		if req.Connection == nil || req.Connection.RemoteAddr == "" {
-			return false, fmt.Errorf("failed to get connection information")
+			return false, fmt.Errorf("%w: failed to get connection information", ErrSourceUnauthorized)
 		}
 
 		belongs, err := cidrutil.IPBelongsToCIDRBlocksSlice(req.Connection.RemoteAddr, config.BoundCIDRList)
@@ -248,7 +1394,7 @@ func (b *PluginBackend) validIPConstraints(config *ConfigJSON, req *logical.Requ
 			return false, errwrap.Wrapf("failed to verify the CIDR restrictions set on the role: {{err}}", err)
 		}
 		if !belongs {
-			return false, fmt.Errorf("source address %q unauthorized through CIDR restrictions on the role", req.Connection.RemoteAddr)
+			return false, fmt.Errorf("%w: source address %q unauthorized through CIDR restrictions on the role", ErrSourceUnauthorized, req.Connection.RemoteAddr)
 		}
 	}
 	return true, nil
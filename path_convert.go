@@ -139,7 +139,7 @@ func ValidUnit(unit string) (string, error) {
 	case "usd", "USD":
 		return USD, nil
 	}
-	return "", fmt.Errorf("Unknown unit %s", unit)
+	return "", fmt.Errorf("%w: unknown unit %s", ErrInvalidInput, unit)
 }
 
 // ToWeiMultiplier returns the multipler to convert a unit to wei
@@ -256,7 +256,7 @@ func (b *PluginBackend) pathConvertWrite(ctx context.Context, req *logical.Reque
 	amountFrom := data.Get("amount").(string)
 	amount, err := decimal.NewFromString(amountFrom)
 	if err != nil || amount.IsNegative() {
-		return nil, fmt.Errorf("amount is either not a number or is negative")
+		return nil, fmt.Errorf("%w: amount is either not a number or is negative", ErrInvalidInput)
 	}
 
 	unitTo, err := ValidUnit(data.Get("unit_to").(string))
@@ -264,7 +264,7 @@ func (b *PluginBackend) pathConvertWrite(ctx context.Context, req *logical.Reque
 		return nil, err
 	}
 	if unitFrom == unitTo {
-		return nil, fmt.Errorf("Conversion from %s to %s makes no sense", unitFrom, unitTo)
+		return nil, fmt.Errorf("%w: conversion from %s to %s makes no sense", ErrInvalidInput, unitFrom, unitTo)
 	}
 	if unitFrom == USD || unitTo == USD {
 		oneETHInWei := ConvertToWei(ETH, oneETH)
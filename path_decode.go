@@ -0,0 +1,406 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/core-coin/go-core/accounts/abi"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/rlp"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/contracts/erc20"
+	"github.com/cryptohub-digital/vault-core/contracts/erc721"
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// ABIJSON is a contract ABI registered to decode calldata
+type ABIJSON struct {
+	ABI string `json:"abi"`
+	// Addresses are the contracts the ABI is for; it matches any contract if empty
+	Addresses []string `json:"addresses"`
+}
+
+// builtinABIs decode calls to standard token contracts without registering them
+var builtinABIs = map[string]string{
+	"erc20":  erc20.Erc20ABI,
+	"erc721": erc721.Erc721ABI,
+}
+
+func abiStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("abis/%s", name))
+}
+
+func decodePaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("abis/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathABIsList,
+			},
+			HelpSynopsis: "List the registered contract ABIs.",
+			HelpDescription: `
+			All the registered contract ABIs will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("abis/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Register a contract ABI to decode calldata with.",
+			HelpDescription: `
+
+Register the JSON ABI of a contract so decode can name the method a
+transaction calls and its arguments. With addresses set the ABI is only used
+for calls to those contracts. The ERC-20 and ERC-721 ABIs are always known.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the ABI."},
+				"abi": {
+					Type:        framework.TypeString,
+					Description: "The JSON ABI of the contract.",
+				},
+				"addresses": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The contracts the ABI is for; any contract if unset.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathABIRead,
+				logical.CreateOperation: b.pathABIWrite,
+				logical.UpdateOperation: b.pathABIWrite,
+				logical.DeleteOperation: b.pathABIDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("decode"),
+			HelpSynopsis: "Decode a raw transaction or calldata.",
+			HelpDescription: `
+
+Decode a signed raw transaction, as sign-tx returns it, into its sender,
+recipient, amount and energy, and name the method its data calls with the
+decoded arguments, using the registered ABIs and the ERC-20 and ERC-721 ABIs.
+Approvers can see what a transaction does before they approve it. Pass data,
+and optionally to, to decode calldata alone.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"transaction": {
+					Type:        framework.TypeString,
+					Description: "The hex encoded RLP of a signed transaction.",
+				},
+				"data": {
+					Type:        framework.TypeString,
+					Description: "Hex encoded calldata to decode instead of a transaction.",
+				},
+				"to": {
+					Type:        framework.TypeString,
+					Description: "The contract data is sent to; picks the ABI registered for it.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathDecode,
+			},
+		},
+	}
+}
+
+func readABI(ctx context.Context, s logical.Storage, name string) (*ABIJSON, error) {
+	entry, err := s.Get(ctx, abiStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var abiJSON ABIJSON
+	if err := entry.DecodeJSON(&abiJSON); err != nil {
+		return nil, err
+	}
+	return &abiJSON, nil
+}
+
+// DecodedCall is calldata matched to a method of a known ABI
+type DecodedCall struct {
+	Selector  string `json:"selector"`
+	ABI       string `json:"abi,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// Candidates are the signatures the selector registry has for a selector shared by several
+	Candidates []string               `json:"candidates,omitempty"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+}
+
+func (call *DecodedCall) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"selector": call.Selector,
+	}
+	if call.ABI != Empty {
+		result["abi"] = call.ABI
+	}
+	if call.Method != Empty {
+		result["method"] = call.Method
+		result["signature"] = call.Signature
+	}
+	if call.Arguments != nil {
+		result["arguments"] = call.Arguments
+	}
+	if call.Candidates != nil {
+		result["candidates"] = call.Candidates
+	}
+	return result
+}
+
+// decodeCall names the method calldata calls. ABIs registered for the
+// contract come first, then those registered for any contract, then the
+// builtin ones, then the selector registry. It returns nil for data too short
+// to hold a selector.
+func decodeCall(ctx context.Context, s logical.Storage, to *common.Address, data []byte) (*DecodedCall, error) {
+	if len(data) < 4 {
+		return nil, nil
+	}
+	call := &DecodedCall{Selector: hexutil.Encode(data[:4])}
+	names, err := s.List(ctx, QualifiedPath("abis/"))
+	if err != nil {
+		return nil, err
+	}
+	var forContract, forAny []string
+	for _, name := range names {
+		abiJSON, err := readABI(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case abiJSON == nil:
+		case len(abiJSON.Addresses) == 0:
+			forAny = append(forAny, name)
+		case to != nil && util.Contains(abiJSON.Addresses, to.Hex()):
+			forContract = append(forContract, name)
+		}
+	}
+	for _, name := range append(forContract, forAny...) {
+		abiJSON, err := readABI(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if matchCall(call, name, abiJSON.ABI, data) {
+			return call, nil
+		}
+	}
+	for _, name := range []string{"erc20", "erc721"} {
+		if matchCall(call, name, builtinABIs[name], data) {
+			return call, nil
+		}
+	}
+	return call, lookupSelector(ctx, s, call, data)
+}
+
+// matchCall fills in call if the ABI has a method for the selector of data
+func matchCall(call *DecodedCall, name, definition string, data []byte) bool {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		return false
+	}
+	method, err := parsed.MethodById(data[:4])
+	if err != nil {
+		return false
+	}
+	arguments := map[string]interface{}{}
+	if err := method.Inputs.UnpackIntoMap(arguments, data[4:]); err != nil {
+		return false
+	}
+	for key, value := range arguments {
+		arguments[key] = formatArgument(value)
+	}
+	call.ABI = name
+	call.Method = method.Name
+	call.Signature = method.Sig
+	call.Arguments = arguments
+	return true
+}
+
+// formatArgument makes a decoded argument readable: addresses and bytes as
+// hex, integers as decimal strings
+func formatArgument(value interface{}) interface{} {
+	switch v := value.(type) {
+	case common.Address:
+		return v.Hex()
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return hexutil.Encode(v)
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(bytes), rv)
+			return hexutil.Encode(bytes)
+		}
+		fallthrough
+	case reflect.Slice:
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = formatArgument(rv.Index(i).Interface())
+		}
+		return result
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprintf("%d", rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("%d", rv.Uint())
+	}
+	return value
+}
+
+// decodeHex decodes hex with or without its 0x prefix
+func decodeHex(input string) ([]byte, error) {
+	input = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(input), "0x"), "0X")
+	if input == Empty {
+		return nil, fmt.Errorf("empty hex")
+	}
+	return hex.DecodeString(input)
+}
+
+func (b *PluginBackend) pathABIsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := req.Storage.List(ctx, QualifiedPath("abis/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathABIRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	abiJSON, err := readABI(ctx, req.Storage, data.Get("name").(string))
+	if err != nil || abiJSON == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"abi":       abiJSON.ABI,
+			"addresses": abiJSON.Addresses,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathABIWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	definition := data.Get("abi").(string)
+	if _, err := abi.JSON(strings.NewReader(definition)); err != nil {
+		return nil, fmt.Errorf("%w: abi: %v", ErrInvalidInput, err)
+	}
+	addresses, err := config.normalizeAddresses(data.Get("addresses").([]string))
+	if err != nil {
+		return nil, err
+	}
+	abiJSON := &ABIJSON{ABI: definition, Addresses: addresses}
+	entry, err := logical.StorageEntryJSON(abiStoragePath(data.Get("name").(string)), abiJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *PluginBackend) pathABIDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, abiStoragePath(data.Get("name").(string)))
+}
+
+func (b *PluginBackend) pathDecode(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if raw := data.Get("transaction").(string); raw != Empty {
+		encoded, err := decodeHex(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: transaction is not hex", ErrInvalidInput)
+		}
+		var tx types.Transaction
+		if err := rlp.DecodeBytes(encoded, &tx); err != nil {
+			return nil, fmt.Errorf("%w: transaction: %v", ErrInvalidInput, err)
+		}
+		result := map[string]interface{}{
+			"hash":              tx.Hash().Hex(),
+			"nonce":             tx.Nonce(),
+			"amount":            tx.Value().String(),
+			"gas_limit":         tx.Energy(),
+			"gas_price":         tx.EnergyPrice().String(),
+			"network_id":        tx.NetworkID(),
+			"data":              hexutil.Encode(tx.Data()),
+			"contract_creation": tx.To() == nil,
+		}
+		if tx.To() != nil {
+			result["to"] = tx.To().Hex()
+		}
+		if from, err := types.Sender(types.MakeSigner(new(big.Int).SetUint64(uint64(tx.NetworkID()))), &tx); err == nil {
+			result["from"] = from.Hex()
+		}
+		call, err := decodeCall(ctx, req.Storage, tx.To(), tx.Data())
+		if err != nil {
+			return nil, err
+		}
+		if call != nil {
+			result["call"] = call.responseData()
+		}
+		return &logical.Response{Data: result}, nil
+	}
+	calldata, err := decodeHex(data.Get("data").(string))
+	if err != nil {
+		return nil, fmt.Errorf("%w: pass a transaction or hex encoded data", ErrInvalidInput)
+	}
+	var to *common.Address
+	if input := data.Get("to").(string); input != Empty {
+		address, err := config.parseAddress(input)
+		if err != nil {
+			return nil, wrapError(ErrInvalidAddress, err)
+		}
+		to = &address
+	}
+	call, err := decodeCall(ctx, req.Storage, to, calldata)
+	if err != nil {
+		return nil, err
+	}
+	if call == nil {
+		return nil, fmt.Errorf("%w: data is too short to call a method", ErrInvalidInput)
+	}
+	return &logical.Response{Data: call.responseData()}, nil
+}
@@ -0,0 +1,461 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// DefaultDisbursementBatchSize is the number of recipients paid by one run
+	DefaultDisbursementBatchSize int = 20
+	// MaxDisbursementBatchSize bounds the time a run holds the request
+	MaxDisbursementBatchSize int = 200
+	// MaxDisbursementRecipients keeps a disbursement within one storage entry
+	MaxDisbursementRecipients int = 5000
+
+	disbursementPending    string = "pending"
+	disbursementSubmitting string = "submitting"
+	disbursementSent       string = "sent"
+	disbursementFailed     string = "failed"
+)
+
+// DisbursementJSON is a list of payments made from one account
+type DisbursementJSON struct {
+	Account    string                  `json:"account"`
+	Token      string                  `json:"token"`
+	BatchSize  int                     `json:"batch_size"`
+	CreatedAt  time.Time               `json:"created_at"`
+	Recipients []DisbursementRecipient `json:"recipients"`
+}
+
+// DisbursementRecipient is one payment of a disbursement and how far it got
+type DisbursementRecipient struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Status  string `json:"status"`
+	TxHash  string `json:"tx_hash,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func disbursementPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("disbursements/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathDisbursementsList,
+			},
+			HelpSynopsis: "List all the disbursements.",
+			HelpDescription: `
+			All the disbursements will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("disbursements/" + framework.GenericNameRegex("id")),
+			HelpSynopsis: "Create, read or delete a disbursement.",
+			HelpDescription: `
+
+Create a list of payments from one account, such as an airdrop. recipients is
+either CSV with an address and an amount per line (a header line is skipped)
+or a JSON array of {"address": ..., "amount": ...} objects. Without token the
+amounts are in wei and paid by transfer; with token they are whole tokens and
+paid by erc20/transfer.
+
+Every recipient is checked against the inclusions and exclusions when the
+disbursement is created, and each payment goes through the account's transfer
+path when it is run, so the account's policies apply to every one. Nothing is
+sent until disbursements/<id>/run is called.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString, Description: "The name of the disbursement."},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "The account the payments are made from.",
+				},
+				"token": {
+					Type:        framework.TypeString,
+					Description: "The address of the ERC-20 token to pay in; the native coin if unset.",
+				},
+				"recipients": {
+					Type:        framework.TypeString,
+					Description: "The recipients and amounts, as CSV or a JSON array.",
+				},
+				"batch_size": {
+					Type:        framework.TypeInt,
+					Default:     DefaultDisbursementBatchSize,
+					Description: "The number of recipients paid by each run.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathDisbursementRead,
+				logical.CreateOperation: b.pathDisbursementCreate,
+				logical.DeleteOperation: b.pathDisbursementDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("disbursements/" + framework.GenericNameRegex("id") + "/run"),
+			HelpSynopsis: "Pay the next batch of a disbursement.",
+			HelpDescription: `
+
+Pay the next batch_size pending recipients, one transaction each, in order.
+Each recipient is marked submitting before its transaction is signed and sent
+or failed after, so a run that is interrupted never pays anyone twice: a
+recipient left submitting must be checked on chain by an operator. A run
+stops at the first RPC or nonce error and leaves the rest pending; any other
+error fails that recipient only. With retry_failed the failed recipients are
+made pending again first.
+
+Grant access to this path only to the operators that may send from the
+account.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString, Description: "The name of the disbursement."},
+				"retry_failed": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Make the failed recipients pending again before the run.",
+				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathDisbursementRun,
+				logical.UpdateOperation: b.pathDisbursementRun,
+			},
+		},
+	}
+}
+
+func disbursementStoragePath(id string) string {
+	return QualifiedPath(fmt.Sprintf("disbursements/%s", id))
+}
+
+func readDisbursement(ctx context.Context, req *logical.Request, id string) (*DisbursementJSON, error) {
+	entry, err := req.Storage.Get(ctx, disbursementStoragePath(id))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var disbursement DisbursementJSON
+	if err := entry.DecodeJSON(&disbursement); err != nil {
+		return nil, err
+	}
+	return &disbursement, nil
+}
+
+func writeDisbursement(ctx context.Context, req *logical.Request, id string, disbursement *DisbursementJSON) error {
+	entry, err := storageEntryJSON(disbursementStoragePath(id), disbursement)
+	if err != nil {
+		return err
+	}
+	return req.Storage.Put(ctx, entry)
+}
+
+// parseRecipients reads recipients from CSV or, if it starts with [, JSON
+func parseRecipients(input string) ([]DisbursementRecipient, error) {
+	input = strings.TrimSpace(input)
+	var recipients []DisbursementRecipient
+	if strings.HasPrefix(input, "[") {
+		if err := json.Unmarshal([]byte(input), &recipients); err != nil {
+			return nil, err
+		}
+		return recipients, nil
+	}
+	reader := csv.NewReader(strings.NewReader(input))
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "address") {
+			continue
+		}
+		recipients = append(recipients, DisbursementRecipient{Address: record[0], Amount: record[1]})
+	}
+	return recipients, nil
+}
+
+func (disbursement *DisbursementJSON) counts() map[string]int {
+	counts := map[string]int{
+		disbursementPending:    0,
+		disbursementSubmitting: 0,
+		disbursementSent:       0,
+		disbursementFailed:     0,
+	}
+	for _, recipient := range disbursement.Recipients {
+		counts[recipient.Status]++
+	}
+	return counts
+}
+
+func (disbursement *DisbursementJSON) responseData(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         id,
+		"account":    disbursement.Account,
+		"token":      disbursement.Token,
+		"batch_size": disbursement.BatchSize,
+		"created_at": disbursement.CreatedAt.UTC().Format(time.RFC3339),
+		"counts":     disbursement.counts(),
+	}
+}
+
+func (b *PluginBackend) pathDisbursementsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("disbursements/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathDisbursementRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := data.Get("id").(string)
+	disbursement, err := readDisbursement(ctx, req, id)
+	if err != nil || disbursement == nil {
+		return nil, err
+	}
+	recipients := make([]map[string]interface{}, 0, len(disbursement.Recipients))
+	for _, recipient := range disbursement.Recipients {
+		recipientData := map[string]interface{}{
+			"address": recipient.Address,
+			"amount":  recipient.Amount,
+			"status":  recipient.Status,
+		}
+		if recipient.TxHash != Empty {
+			recipientData["tx_hash"] = recipient.TxHash
+			if tx, err := readTx(ctx, req.Storage, common.HexToHash(recipient.TxHash)); err == nil {
+				recipientData["tx_status"] = tx.Status
+			}
+		}
+		if recipient.Error != Empty {
+			recipientData["error"] = recipient.Error
+		}
+		recipients = append(recipients, recipientData)
+	}
+	responseData := disbursement.responseData(id)
+	responseData["recipients"] = recipients
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
+
+func (b *PluginBackend) pathDisbursementCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := data.Get("id").(string)
+	existing, err := readDisbursement(ctx, req, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: disbursement %s already exists", ErrInvalidInput, id)
+	}
+	name := data.Get("account").(string)
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	token := data.Get("token").(string)
+	if token != Empty {
+		tokenAddress, err := config.parseAddress(token)
+		if err != nil {
+			return nil, wrapError(ErrInvalidAddress, err)
+		}
+		token = tokenAddress.Hex()
+	}
+	batchSize := data.Get("batch_size").(int)
+	if batchSize < 1 || batchSize > MaxDisbursementBatchSize {
+		return nil, fmt.Errorf("%w: batch_size must be between 1 and %d", ErrInvalidInput, MaxDisbursementBatchSize)
+	}
+
+	recipients, err := parseRecipients(data.Get("recipients").(string))
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	if len(recipients) == 0 || len(recipients) > MaxDisbursementRecipients {
+		return nil, fmt.Errorf("%w: a disbursement needs between 1 and %d recipients", ErrInvalidInput, MaxDisbursementRecipients)
+	}
+	for i := range recipients {
+		address, err := config.parseAddress(recipients[i].Address)
+		if err != nil {
+			return nil, fmt.Errorf("%w: recipient %d: %v", ErrInvalidAddress, i+1, err)
+		}
+		if err := config.ValidAddress(&address); err != nil {
+			return nil, fmt.Errorf("recipient %d: %w", i+1, err)
+		}
+		if err := accountJSON.ValidAddress(&address); err != nil {
+			return nil, fmt.Errorf("recipient %d: %w", i+1, err)
+		}
+		amount, ok := new(big.Int).SetString(strings.TrimSpace(recipients[i].Amount), 10)
+		if !ok || amount.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: recipient %d: %q is not a positive amount", ErrInvalidInput, i+1, recipients[i].Amount)
+		}
+		recipients[i] = DisbursementRecipient{
+			Address: address.Hex(),
+			Amount:  amount.String(),
+			Status:  disbursementPending,
+		}
+	}
+
+	disbursement := &DisbursementJSON{
+		Account:    name,
+		Token:      token,
+		BatchSize:  batchSize,
+		CreatedAt:  time.Now(),
+		Recipients: recipients,
+	}
+	if err := writeDisbursement(ctx, req, id, disbursement); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: disbursement.responseData(id),
+	}, nil
+}
+
+func (b *PluginBackend) pathDisbursementDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, disbursementStoragePath(data.Get("id").(string)))
+}
+
+// pay sends one payment of a disbursement through the account's transfer path
+func (b *PluginBackend) pay(ctx context.Context, req *logical.Request, disbursement *DisbursementJSON, recipient *DisbursementRecipient) (string, error) {
+	raw := map[string]interface{}{
+		"name": disbursement.Account,
+		"to":   recipient.Address,
+	}
+	operation := "transfer"
+	if disbursement.Token != Empty {
+		operation = erc20Contract + "/transfer"
+		raw["contract"] = disbursement.Token
+		raw["tokens"] = recipient.Amount
+	} else {
+		raw["amount"] = recipient.Amount
+	}
+	if shares, ok := req.Data["passphrase_shares"]; ok {
+		raw["passphrase_shares"] = shares
+	}
+	if memo, ok := req.Data["memo"]; ok {
+		raw["memo"] = memo
+	}
+	resp, err := b.accountOperation(ctx, req, operation, raw)
+	if err != nil {
+		return Empty, err
+	}
+	return resp.Data["transaction_hash"].(string), nil
+}
+
+func (b *PluginBackend) pathDisbursementRun(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := data.Get("id").(string)
+	disbursement, err := readDisbursement(ctx, req, id)
+	if err != nil {
+		return nil, err
+	}
+	if disbursement == nil {
+		return nil, fmt.Errorf("%w: no disbursement %s", ErrInvalidInput, id)
+	}
+	if data.Get("retry_failed").(bool) {
+		for i := range disbursement.Recipients {
+			if disbursement.Recipients[i].Status == disbursementFailed {
+				disbursement.Recipients[i].Status = disbursementPending
+				disbursement.Recipients[i].Error = Empty
+			}
+		}
+	}
+
+	var processed []DisbursementRecipient
+	var runErr error
+	for i := range disbursement.Recipients {
+		if len(processed) == disbursement.BatchSize {
+			break
+		}
+		recipient := &disbursement.Recipients[i]
+		if recipient.Status != disbursementPending {
+			continue
+		}
+		recipient.Status = disbursementSubmitting
+		if err := writeDisbursement(ctx, req, id, disbursement); err != nil {
+			return nil, err
+		}
+		hash, err := b.pay(ctx, req, disbursement, recipient)
+		switch {
+		case err == nil:
+			recipient.Status = disbursementSent
+			recipient.TxHash = hash
+		case errors.Is(err, ErrRPCUnavailable) || errors.Is(err, ErrNonceConflict):
+			recipient.Status = disbursementPending
+			runErr = err
+		default:
+			recipient.Status = disbursementFailed
+			recipient.Error = err.Error()
+		}
+		if err := writeDisbursement(ctx, req, id, disbursement); err != nil {
+			return nil, err
+		}
+		if runErr != nil {
+			break
+		}
+		processed = append(processed, *recipient)
+	}
+	if runErr != nil && len(processed) == 0 {
+		return nil, runErr
+	}
+
+	responseData := disbursement.responseData(id)
+	responseData["processed"] = processed
+	resp := &logical.Response{
+		Data: responseData,
+	}
+	if runErr != nil {
+		resp.AddWarning(fmt.Sprintf("the run stopped early: %v", runErr))
+	}
+	return resp, nil
+}
@@ -13,9 +13,7 @@ import (
 	"math/big"
 
 	"github.com/core-coin/go-core/accounts/abi/bind"
-	"github.com/core-coin/go-core/common"
 	"github.com/core-coin/go-core/common/hexutil"
-	"github.com/core-coin/go-core/xcbclient"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/cryptohub-digital/vault-core/contracts/erc20"
@@ -51,7 +49,7 @@ Return the balance for an address's ERC-20 holdings.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-20 token.",
@@ -71,7 +69,7 @@ Return the total supply for a ERC-20 token.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-20 token.",
@@ -92,7 +90,7 @@ Transfer some ERC-20 holdings to another address.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-20 token.",
@@ -106,11 +104,17 @@ Transfer some ERC-20 holdings to another address.
 					Default:     "0",
 					Description: "The number of tokens to transfer.",
 				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
+				"travel_rule":       travelRuleSchema,
+				"to_label":          toLabelSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.CreateOperation: b.pathERC20Transfer,
-				logical.UpdateOperation: b.pathERC20Transfer,
+				logical.CreateOperation: b.withSigningGuards(b.pathERC20Transfer),
+				logical.UpdateOperation: b.withSigningGuards(b.pathERC20Transfer),
 			},
 		},
 		{
@@ -122,7 +126,7 @@ Transfer some ERC-20 holdings from another address to this address.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-20 token.",
@@ -136,11 +140,15 @@ Transfer some ERC-20 holdings from another address to this address.
 					Default:     "0",
 					Description: "The number of tokens to transfer.",
 				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.CreateOperation: b.pathERC20TransferFrom,
-				logical.UpdateOperation: b.pathERC20TransferFrom,
+				logical.CreateOperation: b.withSigningGuards(b.pathERC20TransferFrom),
+				logical.UpdateOperation: b.withSigningGuards(b.pathERC20TransferFrom),
 			},
 		},
 		{
@@ -153,7 +161,7 @@ If this function is called again it overwrites the current allowance with _value
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-20 token.",
@@ -167,11 +175,15 @@ If this function is called again it overwrites the current allowance with _value
 					Default:     "0",
 					Description: "The number of tokens to transfer.",
 				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.CreateOperation: b.pathERC20Approve,
-				logical.UpdateOperation: b.pathERC20Approve,
+				logical.CreateOperation: b.withSigningGuards(b.pathERC20Approve),
+				logical.UpdateOperation: b.withSigningGuards(b.pathERC20Approve),
 			},
 		},
 	}
@@ -188,32 +200,32 @@ func (b *PluginBackend) pathERC20BalanceOf(ctx context.Context, req *logical.Req
 	if err != nil {
 		return nil, err
 	}
-	_, account, err := getWalletAndAccount(*accountJSON)
+	address, err := accountAddress(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	contractAddress, err := common.HexToAddress(data.Get("contract").(string))
+	contractAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	instance, err := erc20.NewErc20(contractAddress, client)
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 	erc20CallerSession := &erc20.Erc20CallerSession{
 		Contract: &instance.Erc20Caller, // Generic contract caller binding to set the session for
 		CallOpts: *callOpts,             // Call options to use throughout this session
 	}
 
-	bal, err := erc20CallerSession.BalanceOf(account.Address)
+	bal, err := erc20CallerSession.BalanceOf(address)
 	if err != nil {
 		return nil, err
 	}
@@ -260,22 +272,22 @@ func (b *PluginBackend) pathERC20Transfer(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -284,7 +296,7 @@ func (b *PluginBackend) pathERC20Transfer(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
 	erc20CallerSession := &erc20.Erc20CallerSession{
 		Contract: &instance.Erc20Caller, // Generic contract caller binding to set the session for
@@ -306,7 +318,7 @@ func (b *PluginBackend) pathERC20Transfer(ctx context.Context, req *logical.Requ
 		return nil, err
 	}
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, "to")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "to")
 	if err != nil {
 		return nil, err
 	}
@@ -314,7 +326,7 @@ func (b *PluginBackend) pathERC20Transfer(ctx context.Context, req *logical.Requ
 	if ok {
 		tokens = util.ValidNumber(data.Get("tokens").(string))
 		if tokens == nil {
-			return nil, fmt.Errorf("number of tokens are required")
+			return nil, fmt.Errorf("%w: number of tokens are required", ErrInvalidInput)
 		}
 	} else {
 		tokens = util.ValidNumber("0")
@@ -329,7 +341,7 @@ func (b *PluginBackend) pathERC20Transfer(ctx context.Context, req *logical.Requ
 		return nil, err
 	}
 	tokenAmount := util.TokenAmount(tokens.Int64(), decimals)
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -345,6 +357,9 @@ func (b *PluginBackend) pathERC20Transfer(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
+	if err := trackTokenTransfer(ctx, req, name, tx, tokenAddress, tokenAmount); err != nil {
+		return nil, err
+	}
 
 	var signedTxBuff bytes.Buffer
 	tx.EncodeRLP(&signedTxBuff)
@@ -372,21 +387,21 @@ func (b *PluginBackend) pathERC20TotalSupply(ctx context.Context, req *logical.R
 		return nil, err
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	contractAddress, err := common.HexToAddress(data.Get("contract").(string))
+	contractAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	instance, err := erc20.NewErc20(contractAddress, client)
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 	erc20CallerSession := &erc20.Erc20CallerSession{
 		Contract: &instance.Erc20Caller, // Generic contract caller binding to set the session for
 		CallOpts: *callOpts,             // Call options to use throughout this session
@@ -439,22 +454,22 @@ func (b *PluginBackend) pathERC20Approve(ctx context.Context, req *logical.Reque
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -463,7 +478,7 @@ func (b *PluginBackend) pathERC20Approve(ctx context.Context, req *logical.Reque
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
 	erc20CallerSession := &erc20.Erc20CallerSession{
 		Contract: &instance.Erc20Caller, // Generic contract caller binding to set the session for
@@ -485,7 +500,7 @@ func (b *PluginBackend) pathERC20Approve(ctx context.Context, req *logical.Reque
 		return nil, err
 	}
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, "spender")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "spender")
 	if err != nil {
 		return nil, err
 	}
@@ -502,13 +517,13 @@ func (b *PluginBackend) pathERC20Approve(ctx context.Context, req *logical.Reque
 	if ok {
 		tokens = util.ValidNumber(data.Get("tokens").(string))
 		if tokens == nil {
-			return nil, fmt.Errorf("number of tokens are required")
+			return nil, fmt.Errorf("%w: number of tokens are required", ErrInvalidInput)
 		}
 	} else {
 		tokens = util.ValidNumber("0")
 	}
 	tokenAmount := util.TokenAmount(tokens.Int64(), decimals)
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -524,6 +539,9 @@ func (b *PluginBackend) pathERC20Approve(ctx context.Context, req *logical.Reque
 	if err != nil {
 		return nil, err
 	}
+	if err := trackTransaction(ctx, req, name, tx); err != nil {
+		return nil, err
+	}
 
 	var signedTxBuff bytes.Buffer
 	tx.EncodeRLP(&signedTxBuff)
@@ -556,22 +574,22 @@ func (b *PluginBackend) pathERC20TransferFrom(ctx context.Context, req *logical.
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -580,7 +598,7 @@ func (b *PluginBackend) pathERC20TransferFrom(ctx context.Context, req *logical.
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
 	erc20CallerSession := &erc20.Erc20CallerSession{
 		Contract: &instance.Erc20Caller, // Generic contract caller binding to set the session for
@@ -602,7 +620,7 @@ func (b *PluginBackend) pathERC20TransferFrom(ctx context.Context, req *logical.
 		return nil, err
 	}
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, "from")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "from")
 	if err != nil {
 		return nil, err
 	}
@@ -619,13 +637,13 @@ func (b *PluginBackend) pathERC20TransferFrom(ctx context.Context, req *logical.
 	if ok {
 		tokens = util.ValidNumber(data.Get("tokens").(string))
 		if tokens == nil {
-			return nil, fmt.Errorf("number of tokens are required")
+			return nil, fmt.Errorf("%w: number of tokens are required", ErrInvalidInput)
 		}
 	} else {
 		tokens = util.ValidNumber("0")
 	}
 	tokenAmount := util.TokenAmount(tokens.Int64(), decimals)
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -641,6 +659,9 @@ func (b *PluginBackend) pathERC20TransferFrom(ctx context.Context, req *logical.
 	if err != nil {
 		return nil, err
 	}
+	if err := trackTransaction(ctx, req, name, tx); err != nil {
+		return nil, err
+	}
 
 	var signedTxBuff bytes.Buffer
 	tx.EncodeRLP(&signedTxBuff)
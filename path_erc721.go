@@ -11,9 +11,7 @@ import (
 	"fmt"
 
 	"github.com/core-coin/go-core/accounts/abi/bind"
-	"github.com/core-coin/go-core/common"
 	"github.com/core-coin/go-core/common/hexutil"
-	"github.com/core-coin/go-core/xcbclient"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/cryptohub-digital/vault-core/contracts/erc721"
@@ -137,7 +135,7 @@ Transfers the ownership of an NFT from one address to another address.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -159,6 +157,8 @@ Transfers the ownership of an NFT from one address to another address.
 					Default:     "utf8",
 					Description: "The encoding of the data.",
 				},
+				"authorization_id": authorizationIDSchema,
+				"mfa_code":         mfaCodeSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -175,7 +175,7 @@ Set or reaffirm the approved address for an NFT.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -189,6 +189,8 @@ Set or reaffirm the approved address for an NFT.
 					Type:        framework.TypeString,
 					Description: "The NFT to approve.",
 				},
+				"authorization_id": authorizationIDSchema,
+				"mfa_code":         mfaCodeSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -206,7 +208,7 @@ msg.senders assets.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -220,6 +222,8 @@ msg.senders assets.
 					Description: "True if the operators is approved, false to revoke approval.",
 					Default:     false,
 				},
+				"authorization_id": authorizationIDSchema,
+				"mfa_code":         mfaCodeSchema,
 			},
 			ExistenceCheck: pathExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -237,7 +241,7 @@ considered invalid, and this function throws for queries about the zero address.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -263,7 +267,7 @@ invalid, and queries about them do throw.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -288,7 +292,7 @@ Get the approved address for a single NFT.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -313,7 +317,7 @@ Returns true if operator is an approved operator for owner, false otherwise.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -342,7 +346,7 @@ TokenByIndex is a free data retrieval call binding the contract method 0x4f6ccce
 		
 		`,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -367,7 +371,7 @@ TokenByIndex is a free data retrieval call binding the contract method 0x4f6ccce
 		
 		`,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -397,7 +401,7 @@ TokenByIndex is a free data retrieval call binding the contract method 0x4f6ccce
 		
 		`,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -418,7 +422,7 @@ TokenByIndex is a free data retrieval call binding the contract method 0x4f6ccce
 		
 		`,
 			Fields: map[string]*framework.FieldSchema{
-				"name": {Type: framework.TypeString},
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
 				"contract": {
 					Type:        framework.TypeString,
 					Description: "The address of the ERC-721 NFT.",
@@ -475,29 +479,29 @@ func (b *PluginBackend) pathERC721SafeTransferFrom(ctx context.Context, req *log
 	} else if encoding == "utf8" {
 		additionalData = []byte(dataOrFile)
 	} else {
-		return nil, fmt.Errorf("invalid encoding encountered - %s", encoding)
+		return nil, fmt.Errorf("%w: invalid encoding encountered - %s", ErrInvalidInput, encoding)
 	}
 
 	accountJSON, err := readAccount(ctx, req, name)
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -506,9 +510,9 @@ func (b *PluginBackend) pathERC721SafeTransferFrom(ctx context.Context, req *log
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, "to")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "to")
 	if err != nil {
 		return nil, err
 	}
@@ -521,7 +525,7 @@ func (b *PluginBackend) pathERC721SafeTransferFrom(ctx context.Context, req *log
 	if err != nil {
 		return nil, err
 	}
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -537,6 +541,9 @@ func (b *PluginBackend) pathERC721SafeTransferFrom(ctx context.Context, req *log
 	if err != nil {
 		return nil, err
 	}
+	if err := trackTransaction(ctx, req, name, tx); err != nil {
+		return nil, err
+	}
 
 	var signedTxBuff bytes.Buffer
 	tx.EncodeRLP(&signedTxBuff)
@@ -581,22 +588,22 @@ func (b *PluginBackend) pathERC721Approve(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -605,9 +612,9 @@ func (b *PluginBackend) pathERC721Approve(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, "approved")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "approved")
 	if err != nil {
 		return nil, err
 	}
@@ -620,7 +627,7 @@ func (b *PluginBackend) pathERC721Approve(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -636,6 +643,9 @@ func (b *PluginBackend) pathERC721Approve(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
+	if err := trackTransaction(ctx, req, name, tx); err != nil {
+		return nil, err
+	}
 
 	var signedTxBuff bytes.Buffer
 	tx.EncodeRLP(&signedTxBuff)
@@ -677,22 +687,22 @@ func (b *PluginBackend) pathERC721SetApprovalForAll(ctx context.Context, req *lo
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -701,9 +711,9 @@ func (b *PluginBackend) pathERC721SetApprovalForAll(ctx context.Context, req *lo
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, "operator")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "operator")
 	if err != nil {
 		return nil, err
 	}
@@ -716,7 +726,7 @@ func (b *PluginBackend) pathERC721SetApprovalForAll(ctx context.Context, req *lo
 	if err != nil {
 		return nil, err
 	}
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -732,6 +742,9 @@ func (b *PluginBackend) pathERC721SetApprovalForAll(ctx context.Context, req *lo
 	if err != nil {
 		return nil, err
 	}
+	if err := trackTransaction(ctx, req, name, tx); err != nil {
+		return nil, err
+	}
 
 	var signedTxBuff bytes.Buffer
 	tx.EncodeRLP(&signedTxBuff)
@@ -771,22 +784,22 @@ func (b *PluginBackend) pathERC721BalanceOf(ctx context.Context, req *logical.Re
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -795,9 +808,9 @@ func (b *PluginBackend) pathERC721BalanceOf(ctx context.Context, req *logical.Re
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, "owner")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "owner")
 	if err != nil {
 		return nil, err
 	}
@@ -810,7 +823,7 @@ func (b *PluginBackend) pathERC721BalanceOf(ctx context.Context, req *logical.Re
 	if err != nil {
 		return nil, err
 	}
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -858,22 +871,22 @@ func (b *PluginBackend) pathERC721OwnerOf(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -882,9 +895,9 @@ func (b *PluginBackend) pathERC721OwnerOf(ctx context.Context, req *logical.Requ
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -932,22 +945,22 @@ func (b *PluginBackend) pathERC721GetApproved(ctx context.Context, req *logical.
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -956,9 +969,9 @@ func (b *PluginBackend) pathERC721GetApproved(ctx context.Context, req *logical.
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -1006,22 +1019,22 @@ func (b *PluginBackend) pathERC721IsApprovedForAll(ctx context.Context, req *log
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -1030,18 +1043,18 @@ func (b *PluginBackend) pathERC721IsApprovedForAll(ctx context.Context, req *log
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
-	transactionParams, err := b.getBaseData(client, account.Address, data, "owner")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "owner")
 	if err != nil {
 		return nil, err
 	}
 	owner := *transactionParams.Address
-	transactionParams, err = b.getBaseData(client, account.Address, data, "operator")
+	transactionParams, err = b.getBaseData(ctx, config, client, account.Address, data, "operator")
 	if err != nil {
 		return nil, err
 	}
@@ -1080,22 +1093,22 @@ func (b *PluginBackend) pathERC721TokenByIndex(ctx context.Context, req *logical
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -1104,9 +1117,9 @@ func (b *PluginBackend) pathERC721TokenByIndex(ctx context.Context, req *logical
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -1144,22 +1157,22 @@ func (b *PluginBackend) pathERC721TokenOfOwnerByIndex(ctx context.Context, req *
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -1168,15 +1181,15 @@ func (b *PluginBackend) pathERC721TokenOfOwnerByIndex(ctx context.Context, req *
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
 	index := util.ValidNumber(data.Get("index").(string))
 
-	transactionParams, err := b.getBaseData(client, account.Address, data, "owner")
+	transactionParams, err := b.getBaseData(ctx, config, client, account.Address, data, "owner")
 	if err != nil {
 		return nil, err
 	}
@@ -1214,22 +1227,22 @@ func (b *PluginBackend) pathERC721Metadata(ctx context.Context, req *logical.Req
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -1238,9 +1251,9 @@ func (b *PluginBackend) pathERC721Metadata(ctx context.Context, req *logical.Req
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
@@ -1286,22 +1299,22 @@ func (b *PluginBackend) pathERC721TokenURI(ctx context.Context, req *logical.Req
 	if err != nil {
 		return nil, err
 	}
-	wallet, account, err := getWalletAndAccount(*accountJSON)
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenAddress, err := common.HexToAddress(data.Get("contract").(string))
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrInvalidAddress, err)
 	}
 
 	chainID := util.ValidNumber(config.ChainID)
 	if chainID == nil {
-		return nil, fmt.Errorf("invalid chain ID")
+		return nil, ErrInvalidChainID
 	}
 
-	client, err := xcbclient.Dial(config.getRPCURL())
+	client, err := b.dialRPC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -1310,9 +1323,9 @@ func (b *PluginBackend) pathERC721TokenURI(ctx context.Context, req *logical.Req
 	if err != nil {
 		return nil, err
 	}
-	callOpts := &bind.CallOpts{}
+	callOpts := &bind.CallOpts{Context: ctx}
 
-	transactOpts, err := b.NewWalletTransactor(chainID, wallet, account)
+	transactOpts, err := b.NewWalletTransactor(ctx, chainID, wallet, account)
 	if err != nil {
 		return nil, err
 	}
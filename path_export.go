@@ -0,0 +1,523 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/core-coin/go-core/accounts/keystore"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// DefaultExportApprovalTTL is how long an export request may wait for approval and release, in seconds
+	DefaultExportApprovalTTL int = 3600
+
+	exportPending  string = "pending"
+	exportApproved string = "approved"
+	exportReleased string = "released"
+	exportRejected string = "rejected"
+	exportExpired  string = "expired"
+)
+
+// ExportJSON is a pending, approved or released export of an account's key
+type ExportJSON struct {
+	ID                string    `json:"id"`
+	Account           string    `json:"account"`
+	BLSKey            string    `json:"bls_key,omitempty"`
+	RequesterEntityID string    `json:"requester_entity_id"`
+	CreatedAt         time.Time `json:"created_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	ApproverEntityID  string    `json:"approver_entity_id"`
+	ApproverGroup     string    `json:"approver_group,omitempty"`
+	ApprovedAt        time.Time `json:"approved_at"`
+	ReleasedAt        time.Time `json:"released_at"`
+	RejecterEntityID  string    `json:"rejecter_entity_id,omitempty"`
+	RejectedAt        time.Time `json:"rejected_at"`
+}
+
+func (export *ExportJSON) status(now time.Time) string {
+	switch {
+	case !export.ReleasedAt.IsZero():
+		return exportReleased
+	case !export.RejectedAt.IsZero():
+		return exportRejected
+	case now.After(export.ExpiresAt):
+		return exportExpired
+	case !export.ApprovedAt.IsZero():
+		return exportApproved
+	}
+	return exportPending
+}
+
+func (export *ExportJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"id":                  export.ID,
+		"account":             export.Account,
+		"status":              export.status(time.Now()),
+		"requester_entity_id": export.RequesterEntityID,
+		"created_at":          export.CreatedAt.UTC().Format(time.RFC3339),
+		"expires_at":          export.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if export.BLSKey != Empty {
+		delete(result, "account")
+		result["bls_key"] = export.BLSKey
+	}
+	if !export.ApprovedAt.IsZero() {
+		result["approver_entity_id"] = export.ApproverEntityID
+		result["approver_group"] = export.ApproverGroup
+		result["approved_at"] = export.ApprovedAt.UTC().Format(time.RFC3339)
+	}
+	if !export.RejectedAt.IsZero() {
+		result["rejecter_entity_id"] = export.RejecterEntityID
+		result["rejected_at"] = export.RejectedAt.UTC().Format(time.RFC3339)
+	}
+	if !export.ReleasedAt.IsZero() {
+		result["released_at"] = export.ReleasedAt.UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+func exportPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/export"),
+			HelpSynopsis: "Request the export of an account's private key.",
+			HelpDescription: `
+
+Create a pending export request. A member of one of the configured approver
+groups, other than the requester, must approve the request through
+exports/<id>/approve before the requester can release the keystore through
+exports/<id>/release. With approval_slack_webhook_url or
+approval_pagerduty_routing_key configured the request is posted there for the
+approvers. When control_group_operations includes export, the request itself
+needs an approved authorization first.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name":             {Type: framework.TypeString, Description: "The name of the account."},
+				"authorization_id": authorizationIDSchema,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withSigningGuards(b.pathExportRequest),
+				logical.UpdateOperation: b.withSigningGuards(b.pathExportRequest),
+			},
+		},
+		{
+			Pattern: QualifiedPath("exports/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathExportsList,
+			},
+			HelpSynopsis: "List all the export requests.",
+			HelpDescription: `
+			All the export requests will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("exports/" + framework.GenericNameRegex("id")),
+			HelpSynopsis: "Return the state of an export request.",
+			HelpDescription: `
+
+Return the state of an export request: pending, approved, rejected, released
+or expired.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString, Description: "The ID of the export request."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathExportRead,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("exports/" + framework.GenericNameRegex("id") + "/approve"),
+			HelpSynopsis: "Approve an export request.",
+			HelpDescription: `
+
+Approve a pending export request. The caller must belong to a configured
+approver group and must not be the requester.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString, Description: "The ID of the export request."},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.unlessFrozen(b.pathExportApprove),
+				logical.UpdateOperation: b.unlessFrozen(b.pathExportApprove),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("exports/" + framework.GenericNameRegex("id") + "/reject"),
+			HelpSynopsis: "Reject an export request.",
+			HelpDescription: `
+
+Reject a pending export request so it can no longer be approved or released.
+The caller must belong to a configured approver group and must not be the
+requester.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString, Description: "The ID of the export request."},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.unlessFrozen(b.pathExportReject),
+				logical.UpdateOperation: b.unlessFrozen(b.pathExportReject),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("exports/" + framework.GenericNameRegex("id") + "/release"),
+			HelpSynopsis: "Release the keystore of an approved export request.",
+			HelpDescription: `
+
+Return the account's private key as a JSON keystore encrypted with the
+provided passphrase. Only the requester may release an export, only once,
+and only before the request expires.
+
+The keystore key is derived with the keystore_kdf of the config: scrypt, or
+argon2id with the keystore_argon2 costs. Core wallets only read scrypt
+keystores; argon2id ones are read back by accounts/<name>/import.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString, Description: "The ID of the export request."},
+				"passphrase": {
+					Type:        framework.TypeString,
+					Description: "The passphrase used to encrypt the exported keystore.",
+				},
+				"passphrase_shares": passphraseSharesSchema,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.unlessFrozen(b.pathExportRelease),
+				logical.UpdateOperation: b.unlessFrozen(b.pathExportRelease),
+			},
+		},
+	}
+}
+
+func readExport(ctx context.Context, req *logical.Request, id string) (*ExportJSON, error) {
+	entry, err := req.Storage.Get(ctx, QualifiedPath(fmt.Sprintf("exports/%s", id)))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: no export request %s", ErrInvalidInput, id)
+	}
+	var export ExportJSON
+	if err := entry.DecodeJSON(&export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// exportLocks makes reading, checking and writing an export request one step,
+// so that two releases of one approved export cannot both hand out the key.
+// Request ids hash onto a fixed set of locks, which does not grow with them.
+var exportLocks = locksutil.CreateLocks()
+
+// lockExport locks the export request id and returns its unlock
+func lockExport(id string) func() {
+	lock := locksutil.LockForKey(exportLocks, id)
+	lock.Lock()
+	return lock.Unlock
+}
+
+func writeExport(ctx context.Context, req *logical.Request, export *ExportJSON) error {
+	entry, err := logical.StorageEntryJSON(QualifiedPath(fmt.Sprintf("exports/%s", export.ID)), export)
+	if err != nil {
+		return err
+	}
+	return req.Storage.Put(ctx, entry)
+}
+
+// approverGroupsSchema names the identity groups that approve for one account
+var approverGroupsSchema = &framework.FieldSchema{
+	Type: framework.TypeCommaStringSlice,
+	Description: `Identity group names or IDs whose members approve this account's exports and
+authorizations, in place of export_approver_groups and authorizer_groups. Membership
+is looked up when an approver decides, so the roster follows the groups. Changing
+them on an existing account needs an authorization.`,
+}
+
+// approverGroups returns the groups that approve for an account: its own, or
+// those of the mount. A BLS key has no account and uses the mount's.
+func approverGroups(ctx context.Context, req *logical.Request, account string, groups []string) ([]string, error) {
+	if account == Empty {
+		return groups, nil
+	}
+	accountJSON, err := readAccount(ctx, req, account)
+	if err != nil {
+		return nil, err
+	}
+	if len(accountJSON.ApproverGroups) > 0 {
+		return accountJSON.ApproverGroups, nil
+	}
+	return groups, nil
+}
+
+// identityGroup returns the first of the identity groups, named or by ID,
+// that the entity belongs to as Vault resolves its membership now, or Empty
+// if it belongs to none. Groups synced from an identity provider are
+// resolved the same way, so removing someone there removes them here.
+func (b *PluginBackend) identityGroup(names []string, entityID string) (string, error) {
+	if entityID == Empty {
+		return Empty, nil
+	}
+	groups, err := b.System().GroupsForEntity(entityID)
+	if err != nil {
+		return Empty, err
+	}
+	for _, group := range groups {
+		if util.Contains(names, group.ID) || util.Contains(names, group.Name) {
+			return group.Name, nil
+		}
+	}
+	return Empty, nil
+}
+
+func (b *PluginBackend) pathExportRequest(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.requestExport(ctx, req, &ExportJSON{Account: data.Get("name").(string)})
+}
+
+// requestExport stores a pending export of the account or BLS key named in export
+func (b *PluginBackend) requestExport(ctx context.Context, req *logical.Request, export *ExportJSON) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.EntityID == Empty {
+		return nil, fmt.Errorf("%w: export requests must be made by an identity entity", ErrApprovalRequired)
+	}
+	if export.BLSKey != Empty {
+		if _, err := readBLSKey(ctx, req, export.BLSKey); err != nil {
+			return nil, err
+		}
+	}
+	groups, err := approverGroups(ctx, req, export.Account, config.ExportApproverGroups)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("%w: export is disabled until export_approver_groups is configured", ErrApprovalRequired)
+	}
+	if export.Account != Empty {
+		if err := b.checkControlGroup(ctx, req, config, export.Account, controlGroupExport); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	export.ID = uuid.New()
+	export.RequesterEntityID = req.EntityID
+	export.CreatedAt = now
+	export.ExpiresAt = now.Add(time.Duration(config.exportApprovalTTL()) * time.Second)
+	if err := writeExport(ctx, req, export); err != nil {
+		return nil, err
+	}
+	b.requestApproval(config, export)
+	return &logical.Response{
+		Data: export.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathExportsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("exports/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathExportRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	export, err := readExport(ctx, req, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: export.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathExportApprove(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.pathExportDecide(ctx, req, data, actionApprove)
+}
+
+func (b *PluginBackend) pathExportReject(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.pathExportDecide(ctx, req, data, actionReject)
+}
+
+func (b *PluginBackend) pathExportDecide(ctx context.Context, req *logical.Request, data *framework.FieldData, action string) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := data.Get("id").(string)
+	defer lockExport(id)()
+	export, err := readExport(ctx, req, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.decideExport(ctx, req, config, export, req.EntityID, action); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: export.responseData(),
+	}, nil
+}
+
+// decideExport approves or rejects a pending export request for an approver
+func (b *PluginBackend) decideExport(ctx context.Context, req *logical.Request, config *ConfigJSON, export *ExportJSON, entityID, action string) error {
+	if status := export.status(time.Now()); status != exportPending {
+		return fmt.Errorf("%w: export request is %s", ErrApprovalRequired, status)
+	}
+	if entityID == export.RequesterEntityID {
+		return fmt.Errorf("%w: the requester cannot decide their own export", ErrApprovalRequired)
+	}
+	groups, err := approverGroups(ctx, req, export.Account, config.ExportApproverGroups)
+	if err != nil {
+		return err
+	}
+	group, err := b.identityGroup(groups, entityID)
+	if err != nil {
+		return err
+	}
+	if group == Empty {
+		return fmt.Errorf("%w: caller is not a member of an export approver group", ErrApprovalRequired)
+	}
+
+	if action == actionReject {
+		export.RejecterEntityID = entityID
+		export.RejectedAt = time.Now()
+	} else {
+		export.ApproverEntityID = entityID
+		export.ApproverGroup = group
+		export.ApprovedAt = time.Now()
+	}
+	if err := writeExport(ctx, req, export); err != nil {
+		return err
+	}
+	if export.Account != Empty {
+		b.recordActivity(ctx, req, export.Account, &ActivityJSON{Event: "export_" + action, ExportID: export.ID}, nil, nil)
+	}
+	b.resolveApproval(config, export, export.status(time.Now()), entityID)
+	return nil
+}
+
+func (b *PluginBackend) pathExportRelease(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	id := data.Get("id").(string)
+	defer lockExport(id)()
+	export, err := readExport(ctx, req, id)
+	if err != nil {
+		return nil, err
+	}
+	if status := export.status(time.Now()); status != exportApproved {
+		return nil, fmt.Errorf("%w: export request is %s", ErrApprovalRequired, status)
+	}
+	if req.EntityID != export.RequesterEntityID {
+		return nil, fmt.Errorf("%w: only the requester can release an export", ErrApprovalRequired)
+	}
+	passphrase := data.Get("passphrase").(string)
+	if passphrase == Empty {
+		return nil, fmt.Errorf("%w: passphrase is required", ErrInvalidInput)
+	}
+	if export.BLSKey != Empty {
+		return b.releaseBLSKey(ctx, req, export, passphrase)
+	}
+
+	accountJSON, err := readAccount(ctx, req, export.Account)
+	if err != nil {
+		return nil, err
+	}
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := wallet.PrivateKey(*account)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroKey(privateKey)
+
+	// mark the export released before handing out the key so it is single use
+	export.ReleasedAt = time.Now()
+	if err := writeExport(ctx, req, export); err != nil {
+		return nil, err
+	}
+	var keystoreJSON []byte
+	kdfDone := timed(ctx, kdfTime)
+	if config.keystoreKDF() == util.KDFArgon2id {
+		keystoreJSON, err = util.EncryptKeyArgon2id(ctx, privateKey, &account.Address, uuid.NewRandom(), passphrase, config.argon2idParams())
+	} else {
+		keystoreJSON, err = util.EncryptKey(ctx, privateKey, &account.Address, uuid.NewRandom(), passphrase, keystore.StandardScryptN, keystore.StandardScryptP)
+	}
+	kdfDone()
+	if err != nil {
+		return nil, err
+	}
+	b.recordActivity(ctx, req, export.Account, &ActivityJSON{Event: activityExport, ExportID: export.ID}, nil, nil)
+
+	responseData := export.responseData()
+	responseData["address"] = account.Address.Hex()
+	responseData["keystore"] = string(keystoreJSON)
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
+
+// releaseBLSKey returns a BLS key as an EIP-2335 keystore encrypted with the passphrase
+func (b *PluginBackend) releaseBLSKey(ctx context.Context, req *logical.Request, export *ExportJSON, passphrase string) (*logical.Response, error) {
+	key, err := readBLSKey(ctx, req, export.BLSKey)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(key.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(secret)
+
+	export.ReleasedAt = time.Now()
+	if err := writeExport(ctx, req, export); err != nil {
+		return nil, err
+	}
+	kdfDone := timed(ctx, kdfTime)
+	keystoreJSON, err := util.EncryptEIP2335(secret, key.Pubkey, key.Path, key.Description, passphrase, util.KDFScrypt)
+	kdfDone()
+	if err != nil {
+		return nil, err
+	}
+
+	responseData := export.responseData()
+	responseData["pubkey"] = key.Pubkey
+	responseData["keystore"] = string(keystoreJSON)
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
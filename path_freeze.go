@@ -0,0 +1,182 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	eventFrozen   string = "mount_frozen"
+	eventUnfrozen string = "mount_unfrozen"
+
+	freezeStoragePath string = "config/freeze"
+)
+
+// FreezeJSON is stored while the mount is frozen
+type FreezeJSON struct {
+	Reason   string    `json:"reason"`
+	FrozenAt time.Time `json:"frozen_at"`
+	FrozenBy string    `json:"frozen_by"`
+}
+
+func freezePaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("config/freeze"),
+			HelpSynopsis: "Freeze or unfreeze all signing and exports on this mount.",
+			HelpDescription: `
+
+While the mount is frozen every operation that signs - transfers, sign-tx,
+deploy, sign, token transfers and approvals, permits, disbursement runs, clef
+and grants - and every export request, approval and release is refused. Reads
+such as balances, accounts and transactions keep working. Freezing and
+unfreezing raise mount_frozen and mount_unfrozen events.
+
+Vault does not let a plugin add a sys/ endpoint; to freeze several mounts at
+once grant incident responders update on <mount>/config/freeze for each.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"frozen": {
+					Type:        framework.TypeBool,
+					Default:     true,
+					Description: "Whether the mount is frozen.",
+				},
+				"reason": {
+					Type:        framework.TypeString,
+					Description: "Why the mount is frozen; returned with every refusal.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathFreezeRead,
+				logical.UpdateOperation: b.pathFreezeWrite,
+				logical.DeleteOperation: b.pathFreezeDelete,
+			},
+		},
+	}
+}
+
+func readFreeze(ctx context.Context, s logical.Storage) (*FreezeJSON, error) {
+	entry, err := s.Get(ctx, QualifiedPath(freezeStoragePath))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var freeze FreezeJSON
+	if err := entry.DecodeJSON(&freeze); err != nil {
+		return nil, err
+	}
+	return &freeze, nil
+}
+
+// unlessFrozen refuses an operation while the mount is frozen
+func (b *PluginBackend) unlessFrozen(callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		freeze, err := readFreeze(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if freeze != nil {
+			err = fmt.Errorf("%w since %s: %s", ErrFrozen, freeze.FrozenAt.Format(time.RFC3339), freeze.Reason)
+		}
+		recordRule(ctx, "freeze", err)
+		if err != nil {
+			return nil, err
+		}
+		return callback(ctx, req, data)
+	}
+}
+
+func (freeze *FreezeJSON) responseData() map[string]interface{} {
+	if freeze == nil {
+		return map[string]interface{}{
+			"frozen": false,
+		}
+	}
+	return map[string]interface{}{
+		"frozen":    true,
+		"reason":    freeze.Reason,
+		"frozen_at": freeze.FrozenAt.Format(time.RFC3339),
+		"frozen_by": freeze.FrozenBy,
+	}
+}
+
+func (b *PluginBackend) pathFreezeRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	freeze, err := readFreeze(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: freeze.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathFreezeWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if !data.Get("frozen").(bool) {
+		return b.pathFreezeDelete(ctx, req, data)
+	}
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	freeze := &FreezeJSON{
+		Reason:   data.Get("reason").(string),
+		FrozenAt: time.Now().UTC(),
+		FrozenBy: req.EntityID,
+	}
+	entry, err := logical.StorageEntryJSON(QualifiedPath(freezeStoragePath), freeze)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	b.notify(config, req, eventFrozen, map[string]interface{}{
+		"reason": freeze.Reason,
+	})
+	return &logical.Response{
+		Data: freeze.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathFreezeDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	freeze, err := readFreeze(ctx, req.Storage)
+	if err != nil || freeze == nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, QualifiedPath(freezeStoragePath)); err != nil {
+		return nil, err
+	}
+	b.notify(config, req, eventUnfrozen, map[string]interface{}{
+		"reason": freeze.Reason,
+	})
+	return nil, nil
+}
@@ -0,0 +1,521 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/cryptohub-digital/vault-core/util"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// DefaultGasTankCooldown is how long an account is left alone after a top-up, in seconds
+	DefaultGasTankCooldown int = 600
+
+	topUpSent   string = "sent"
+	topUpFailed string = "failed"
+)
+
+// GasTankJSON is an account that keeps other accounts funded
+type GasTankJSON struct {
+	Account   string   `json:"account"`
+	Accounts  []string `json:"accounts"`
+	Threshold string   `json:"threshold"`
+	Target    string   `json:"target"`
+	// MaxTopUp and DailyLimit bound what the tank sends, in wei; unlimited if empty
+	MaxTopUp   string `json:"max_top_up,omitempty"`
+	DailyLimit string `json:"daily_limit,omitempty"`
+	Cooldown   int    `json:"cooldown"`
+	Paused     bool   `json:"paused"`
+	// LastTopUp is when each account was last topped up
+	LastTopUp map[string]time.Time `json:"last_top_up"`
+}
+
+// TopUpJSON is one top-up made by a gas tank
+type TopUpJSON struct {
+	Time            time.Time `json:"time"`
+	Account         string    `json:"account"`
+	Address         string    `json:"address"`
+	Balance         string    `json:"balance"`
+	Amount          string    `json:"amount"`
+	Status          string    `json:"status"`
+	TransactionHash string    `json:"transaction_hash,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+func (topUp *TopUpJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"time":    topUp.Time.UTC().Format(time.RFC3339),
+		"account": topUp.Account,
+		"address": topUp.Address,
+		"balance": topUp.Balance,
+		"amount":  topUp.Amount,
+		"status":  topUp.Status,
+	}
+	if topUp.TransactionHash != Empty {
+		result["transaction_hash"] = topUp.TransactionHash
+	}
+	if topUp.Error != Empty {
+		result["error"] = topUp.Error
+	}
+	return result
+}
+
+func gasTankStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("gas-tanks/%s", name))
+}
+
+func topUpsStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("gas-tank-top-ups/%s/", name))
+}
+
+func gasTankPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("gas-tanks/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathGasTanksList,
+			},
+			HelpSynopsis: "List the gas tanks.",
+			HelpDescription: `
+			All the gas tanks will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("gas-tanks/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Create, read, update or delete a gas tank.",
+			HelpDescription: `
+
+A gas tank is an account that keeps other accounts of the mount funded. About
+once a minute, Vault's periodic function reads the balance of every account of
+the tank, and sends any account below threshold enough to reach target, from
+the tank's account through its transfer path, so the policies of that account
+apply. A top-up is capped at max_top_up, and all the top-ups of the last 24
+hours at daily_limit; an account that was topped up is left alone for
+cooldown seconds while its top-up confirms. Amounts are in wei. The tank's
+account cannot be sealed as nobody is there to supply passphrase shares.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the gas tank."},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "The account that pays for top-ups.",
+				},
+				"accounts": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The accounts to keep funded.",
+				},
+				"threshold": {
+					Type:        framework.TypeString,
+					Description: "Top up an account whose balance drops below this, in wei.",
+				},
+				"target": {
+					Type:        framework.TypeString,
+					Description: "The balance to top up to, in wei.",
+				},
+				"max_top_up": {
+					Type:        framework.TypeString,
+					Description: "The most one top-up sends, in wei.",
+				},
+				"daily_limit": {
+					Type:        framework.TypeString,
+					Description: "The most the tank sends in 24 hours, in wei.",
+				},
+				"cooldown": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultGasTankCooldown,
+					Description: "How long to leave an account alone after a top-up.",
+				},
+				"paused": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Make no top-ups.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathGasTankRead,
+				logical.CreateOperation: b.pathGasTankWrite,
+				logical.UpdateOperation: b.pathGasTankWrite,
+				logical.DeleteOperation: b.pathGasTankDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("gas-tanks/" + framework.GenericNameRegex("name") + "/refill"),
+			HelpSynopsis: "Top up the accounts of a gas tank now rather than at the next periodic check.",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the gas tank."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathGasTankRefill,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("gas-tanks/" + framework.GenericNameRegex("name") + "/top-ups"),
+			HelpSynopsis: "Return the top-ups a gas tank made, oldest first.",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the gas tank."},
+				"since": {
+					Type:        framework.TypeString,
+					Description: "Only return top-ups made since this time, in RFC 3339.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathGasTankTopUps,
+			},
+		},
+	}
+}
+
+func readGasTank(ctx context.Context, s logical.Storage, name string) (*GasTankJSON, error) {
+	entry, err := s.Get(ctx, gasTankStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: no gas tank %s", ErrInvalidInput, name)
+	}
+	var tank GasTankJSON
+	if err := entry.DecodeJSON(&tank); err != nil {
+		return nil, err
+	}
+	if tank.LastTopUp == nil {
+		tank.LastTopUp = map[string]time.Time{}
+	}
+	return &tank, nil
+}
+
+func writeGasTank(ctx context.Context, s logical.Storage, name string, tank *GasTankJSON) error {
+	entry, err := logical.StorageEntryJSON(gasTankStoragePath(name), tank)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// readTopUps returns the top-ups of a gas tank made since a time, oldest first
+func readTopUps(ctx context.Context, s logical.Storage, name string, since time.Time) ([]*TopUpJSON, error) {
+	keys, err := s.List(ctx, topUpsStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	var topUps []*TopUpJSON
+	for _, key := range keys {
+		entry, err := s.Get(ctx, topUpsStoragePath(name)+key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		var topUp TopUpJSON
+		if err := entry.DecodeJSON(&topUp); err != nil {
+			return nil, err
+		}
+		if !topUp.Time.Before(since) {
+			topUps = append(topUps, &topUp)
+		}
+	}
+	return topUps, nil
+}
+
+func (tank *GasTankJSON) responseData() map[string]interface{} {
+	lastTopUp := map[string]string{}
+	for account, t := range tank.LastTopUp {
+		lastTopUp[account] = t.UTC().Format(time.RFC3339)
+	}
+	return map[string]interface{}{
+		"account":     tank.Account,
+		"accounts":    tank.Accounts,
+		"threshold":   tank.Threshold,
+		"target":      tank.Target,
+		"max_top_up":  tank.MaxTopUp,
+		"daily_limit": tank.DailyLimit,
+		"cooldown":    tank.Cooldown,
+		"paused":      tank.Paused,
+		"last_top_up": lastTopUp,
+	}
+}
+
+func (b *PluginBackend) pathGasTanksList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := req.Storage.List(ctx, QualifiedPath("gas-tanks/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathGasTankRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	tank, err := readGasTank(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: tank.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathGasTankWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	tank := &GasTankJSON{
+		Account:    data.Get("account").(string),
+		Accounts:   data.Get("accounts").([]string),
+		Threshold:  data.Get("threshold").(string),
+		Target:     data.Get("target").(string),
+		MaxTopUp:   data.Get("max_top_up").(string),
+		DailyLimit: data.Get("daily_limit").(string),
+		Cooldown:   data.Get("cooldown").(int),
+		Paused:     data.Get("paused").(bool),
+		LastTopUp:  map[string]time.Time{},
+	}
+	if existing, err := readGasTank(ctx, req.Storage, name); err == nil {
+		tank.LastTopUp = existing.LastTopUp
+	}
+	threshold, target := util.ValidNumber(tank.Threshold), util.ValidNumber(tank.Target)
+	if threshold == nil || target == nil || target.Cmp(threshold) <= 0 {
+		return nil, fmt.Errorf("%w: threshold and target must be amounts in wei and target above threshold", ErrInvalidInput)
+	}
+	for _, limit := range []string{tank.MaxTopUp, tank.DailyLimit} {
+		if limit != Empty && util.ValidNumber(limit) == nil {
+			return nil, fmt.Errorf("%w: max_top_up and daily_limit must be amounts in wei", ErrInvalidInput)
+		}
+	}
+	if tank.Cooldown < 0 {
+		return nil, fmt.Errorf("%w: cooldown cannot be negative", ErrInvalidInput)
+	}
+	if len(tank.Accounts) == 0 {
+		return nil, fmt.Errorf("%w: a gas tank needs accounts to keep funded", ErrInvalidInput)
+	}
+	accountJSON, err := readAccount(ctx, req, tank.Account)
+	if err != nil {
+		return nil, err
+	}
+	if accountJSON.sealed() {
+		return nil, fmt.Errorf("%w: the account of a gas tank cannot be sealed", ErrInvalidInput)
+	}
+	for _, account := range tank.Accounts {
+		if account == tank.Account {
+			return nil, fmt.Errorf("%w: a gas tank cannot top up its own account", ErrInvalidInput)
+		}
+		if _, err := readAccount(ctx, req, account); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeGasTank(ctx, req.Storage, name, tank); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: tank.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathGasTankDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, gasTankStoragePath(data.Get("name").(string)))
+}
+
+func (b *PluginBackend) pathGasTankRefill(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	tank, err := readGasTank(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	topUps, err := b.refill(ctx, req, config, name, tank)
+	if err != nil {
+		return nil, err
+	}
+	made := []map[string]interface{}{}
+	for _, topUp := range topUps {
+		made = append(made, topUp.responseData())
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"top_ups": made,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathGasTankTopUps(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var since time.Time
+	if value := data.Get("since").(string); value != Empty {
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("%w: since must be a time in RFC 3339", ErrInvalidInput)
+		}
+	}
+	topUps, err := readTopUps(ctx, req.Storage, data.Get("name").(string), since)
+	if err != nil {
+		return nil, err
+	}
+	made := []map[string]interface{}{}
+	for _, topUp := range topUps {
+		made = append(made, topUp.responseData())
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"top_ups": made,
+		},
+	}, nil
+}
+
+// refillGasTanks is called by the periodic function to top up the accounts of every gas tank
+func (b *PluginBackend) refillGasTanks(ctx context.Context, req *logical.Request) error {
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		if errors.Is(err, ErrNotConfigured) {
+			return nil
+		}
+		return err
+	}
+	names, err := req.Storage.List(ctx, QualifiedPath("gas-tanks/"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		tank, err := readGasTank(ctx, req.Storage, name)
+		if err != nil {
+			return err
+		}
+		if tank.Paused {
+			continue
+		}
+		if _, err := b.refill(ctx, backgroundRequest(req.Storage, fmt.Sprintf("gas-tanks/%s/refill", name)), config, name, tank); err != nil {
+			b.Logger().Warn("cannot refill gas tank", "gas_tank", name, "error", err)
+		}
+	}
+	return nil
+}
+
+// refill tops up every account of a tank that is below its threshold and
+// records each top-up, sent or failed. It stops at the daily limit.
+func (b *PluginBackend) refill(ctx context.Context, req *logical.Request, config *ConfigJSON, name string, tank *GasTankJSON) ([]*TopUpJSON, error) {
+	client, err := b.dialRPC(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sent := new(big.Int)
+	recent, err := readTopUps(ctx, req.Storage, name, now.Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	for _, topUp := range recent {
+		if amount, ok := new(big.Int).SetString(topUp.Amount, 10); ok && topUp.Status == topUpSent {
+			sent.Add(sent, amount)
+		}
+	}
+	threshold, target := util.ValidNumber(tank.Threshold), util.ValidNumber(tank.Target)
+	var topUps []*TopUpJSON
+	for _, account := range tank.Accounts {
+		if last, ok := tank.LastTopUp[account]; ok && now.Sub(last) < time.Duration(tank.Cooldown)*time.Second {
+			continue
+		}
+		accountJSON, err := readAccount(ctx, req, account)
+		if err != nil {
+			return topUps, err
+		}
+		address, err := accountAddress(ctx, *accountJSON)
+		if err != nil {
+			return topUps, err
+		}
+		balance, err := client.BalanceAt(ctx, address, nil)
+		if err != nil {
+			return topUps, err
+		}
+		if balance.Cmp(threshold) >= 0 {
+			continue
+		}
+		amount := new(big.Int).Sub(target, balance)
+		if tank.MaxTopUp != Empty {
+			if max := util.ValidNumber(tank.MaxTopUp); amount.Cmp(max) > 0 {
+				amount = max
+			}
+		}
+		if tank.DailyLimit != Empty {
+			left := new(big.Int).Sub(util.ValidNumber(tank.DailyLimit), sent)
+			if left.Sign() <= 0 {
+				b.Logger().Warn("gas tank reached its daily limit", "gas_tank", name, "daily_limit", tank.DailyLimit)
+				break
+			}
+			if amount.Cmp(left) > 0 {
+				amount = left
+			}
+		}
+		topUp := &TopUpJSON{
+			Time:    time.Now(),
+			Account: account,
+			Address: address.Hex(),
+			Balance: balance.String(),
+			Amount:  amount.String(),
+			Status:  topUpSent,
+		}
+		topUpCtx, recorder := withDecisionRecorder(ctx)
+		resp, err := b.accountOperation(topUpCtx, req, "transfer", map[string]interface{}{
+			"name":   tank.Account,
+			"to":     address.Hex(),
+			"amount": amount.String(),
+		})
+		b.logDecision(topUpCtx, req, recorder, err)
+		if err != nil {
+			topUp.Status = topUpFailed
+			topUp.Error = err.Error()
+			b.Logger().Warn("gas tank top-up failed", "gas_tank", name, "account", account, "error", err)
+		} else {
+			topUp.TransactionHash = resp.Data["transaction_hash"].(string)
+			sent.Add(sent, amount)
+			tank.LastTopUp[account] = topUp.Time
+		}
+		entry, err := logical.StorageEntryJSON(topUpsStoragePath(name)+topUp.Time.UTC().Format("20060102T150405.000000000Z")+"-"+account, topUp)
+		if err != nil {
+			return topUps, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return topUps, err
+		}
+		topUps = append(topUps, topUp)
+	}
+	return topUps, writeGasTank(ctx, req.Storage, name, tank)
+}
@@ -0,0 +1,303 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// SecretSigningGrantType is the lease type of a signing grant
+	SecretSigningGrantType string = "signing_grant"
+	// DefaultGrantTTL is the default lifetime of a signing grant, in seconds
+	DefaultGrantTTL int = 3600
+)
+
+// GrantJSON is what we store for a signing grant
+type GrantJSON struct {
+	ID                  string    `json:"id"`
+	Account             string    `json:"account"`
+	AllowedDestinations []string  `json:"allowed_destinations"`
+	MaxAmount           string    `json:"max_amount"`
+	ExpiresAt           time.Time `json:"expires_at"`
+}
+
+func signingGrantSecret(b *PluginBackend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretSigningGrantType,
+		Fields: map[string]*framework.FieldSchema{
+			"grant_id": {
+				Type:        framework.TypeString,
+				Description: "The grant ID to use under grants/<grant_id>/.",
+			},
+		},
+		Renew:  b.grantRenew,
+		Revoke: b.grantRevoke,
+	}
+}
+
+func grantPaths(b *PluginBackend) []*framework.Path {
+	paths := []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/grants"),
+			HelpSynopsis: "Issue a short-lived signing grant for an account.",
+			HelpDescription: `
+
+Issue a signing grant as a lease. Until the lease expires or is revoked the
+grant ID can be used with grants/<grant_id>/transfer and
+grants/<grant_id>/sign-tx, within the grant's constraints. The constraints
+apply to the decoded calldata too: every address a transaction or its
+calldata names must be an allowed destination, the tokens of an ERC-20
+transfer, transferFrom or approve may not exceed max_amount, and calldata no
+ABI decodes is refused. Messages cannot be held to the constraints, so a grant
+does not sign them.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultGrantTTL,
+					Description: "The lifetime of the grant.",
+				},
+				"max_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "The maximum lifetime of the grant including renewals. Defaults to the mount's max TTL.",
+				},
+				"allowed_destinations": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The only addresses the grant may send transactions to.",
+				},
+				"max_amount": {
+					Type:        framework.TypeString,
+					Description: "The largest amount in wei a single transaction under the grant may carry, or in base units of the token for an ERC-20 call.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathGrantCreate,
+				logical.UpdateOperation: b.pathGrantCreate,
+			},
+		},
+	}
+	prefix := QualifiedPath("grants/" + framework.GenericNameRegex("grant_id"))
+	return append(paths, aliasAccountPaths(b, prefix, "grant_id", "The ID of an active signing grant.", b.byGrant, "transfer", "sign-tx")...)
+}
+
+func readGrant(ctx context.Context, req *logical.Request, id string) (*GrantJSON, error) {
+	entry, err := req.Storage.Get(ctx, QualifiedPath(fmt.Sprintf("grants/%s", id)))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var grant GrantJSON
+	if err := entry.DecodeJSON(&grant); err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func writeGrant(ctx context.Context, req *logical.Request, grant *GrantJSON) error {
+	entry, err := logical.StorageEntryJSON(QualifiedPath(fmt.Sprintf("grants/%s", grant.ID)), grant)
+	if err != nil {
+		return err
+	}
+	return req.Storage.Put(ctx, entry)
+}
+
+func (b *PluginBackend) pathGrantCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	if _, err := readAccount(ctx, req, name); err != nil {
+		return nil, err
+	}
+	var allowedDestinations []string
+	if allowedDestinationsRaw, ok := data.GetOk("allowed_destinations"); ok {
+		allowedDestinations, err = config.normalizeAddresses(allowedDestinationsRaw.([]string))
+		if err != nil {
+			return nil, err
+		}
+	}
+	maxAmount := data.Get("max_amount").(string)
+	if maxAmount != Empty && util.ValidNumber(maxAmount) == nil {
+		return nil, fmt.Errorf("%w: invalid max_amount", ErrInvalidInput)
+	}
+
+	ttl := time.Duration(data.Get("ttl").(int)) * time.Second
+	maxTTL := time.Duration(data.Get("max_ttl").(int)) * time.Second
+	grant := &GrantJSON{
+		ID:                  uuid.New(),
+		Account:             name,
+		AllowedDestinations: allowedDestinations,
+		MaxAmount:           maxAmount,
+		ExpiresAt:           time.Now().Add(ttl),
+	}
+	if err := writeGrant(ctx, req, grant); err != nil {
+		return nil, err
+	}
+
+	resp := b.Secret(SecretSigningGrantType).Response(map[string]interface{}{
+		"grant_id":             grant.ID,
+		"account":              grant.Account,
+		"allowed_destinations": grant.AllowedDestinations,
+		"max_amount":           grant.MaxAmount,
+	}, map[string]interface{}{
+		"grant_id": grant.ID,
+	})
+	resp.Secret.TTL = ttl
+	resp.Secret.MaxTTL = maxTTL
+	return resp, nil
+}
+
+func (b *PluginBackend) grantRenew(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id, _ := req.Secret.InternalData["grant_id"].(string)
+	grant, err := readGrant(ctx, req, id)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		return nil, fmt.Errorf("%w: signing grant %s was revoked", ErrApprovalRequired, id)
+	}
+	resp, err := framework.LeaseExtend(0, 0, b.System())(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+	grant.ExpiresAt = time.Now().Add(resp.Secret.TTL)
+	if err := writeGrant(ctx, req, grant); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (b *PluginBackend) grantRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id, _ := req.Secret.InternalData["grant_id"].(string)
+	if id == Empty {
+		return nil, nil
+	}
+	return nil, req.Storage.Delete(ctx, QualifiedPath(fmt.Sprintf("grants/%s", id)))
+}
+
+type grantKey struct{}
+
+// byGrant resolves the grant in the request path to its account and enforces
+// the grant's constraints before calling the account handler
+func (b *PluginBackend) byGrant(callback framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		config, err := b.configured(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		id := data.Get("grant_id").(string)
+		grant, err := readGrant(ctx, req, id)
+		if err != nil {
+			return nil, err
+		}
+		err = checkGrant(config, grant, id, data)
+		recordRule(ctx, "grant", err)
+		if err != nil {
+			return nil, err
+		}
+		data.Raw["name"] = grant.Account
+		return callback(context.WithValue(ctx, grantKey{}, grant), req, data)
+	}
+}
+
+// checkGrant enforces the constraints of a grant on a request
+func checkGrant(config *ConfigJSON, grant *GrantJSON, id string, data *framework.FieldData) error {
+	if grant == nil || time.Now().After(grant.ExpiresAt) {
+		return fmt.Errorf("%w: signing grant %s is not active", ErrApprovalRequired, id)
+	}
+	if to, ok := data.GetOk("to"); ok && len(grant.AllowedDestinations) > 0 {
+		address, err := config.parseAddress(to.(string))
+		if err != nil {
+			return wrapError(ErrInvalidAddress, err)
+		}
+		if !util.ContainsAddress(grant.AllowedDestinations, address) {
+			return fmt.Errorf("%w: %s is not an allowed destination of this grant", ErrPolicyViolation, address.Hex())
+		}
+	}
+	if grant.MaxAmount != Empty {
+		amount := util.ValidNumber(Empty)
+		if amountRaw, ok := data.GetOk("amount"); ok {
+			amount = util.ValidNumber(amountRaw.(string))
+		}
+		if amount == nil || amount.Cmp(util.ValidNumber(grant.MaxAmount)) > 0 {
+			return fmt.Errorf("%w: amount exceeds the grant's max_amount of %s", ErrPolicyViolation, grant.MaxAmount)
+		}
+	}
+	return nil
+}
+
+// checkGrantCall holds the transaction a request under a grant signs to the
+// grant's constraints, including the addresses and tokens of its decoded
+// calldata, which checkGrant cannot see in the request fields
+func checkGrantCall(ctx context.Context, tx *types.Transaction, call *DecodedCall) error {
+	grant, _ := ctx.Value(grantKey{}).(*GrantJSON)
+	if grant == nil || (len(grant.AllowedDestinations) == 0 && grant.MaxAmount == Empty) {
+		return nil
+	}
+	err := grant.checkCall(tx, call)
+	recordRule(ctx, "grant_calldata", err)
+	return err
+}
+
+func (grant *GrantJSON) checkCall(tx *types.Transaction, call *DecodedCall) error {
+	if call != nil && call.ABI == Empty {
+		return fmt.Errorf("%w: calldata with selector %s is not decoded by any ABI and cannot be held to the grant", ErrPolicyViolation, call.Selector)
+	}
+	if len(grant.AllowedDestinations) > 0 {
+		if tx.To() == nil {
+			return fmt.Errorf("%w: a grant with allowed_destinations cannot create contracts", ErrPolicyViolation)
+		}
+		for _, destination := range destinations(tx, call) {
+			address, err := common.HexToAddress(destination)
+			if err != nil {
+				return wrapError(ErrInvalidAddress, err)
+			}
+			if !util.ContainsAddress(grant.AllowedDestinations, address) {
+				return fmt.Errorf("%w: %s is not an allowed destination of this grant", ErrPolicyViolation, address.Hex())
+			}
+		}
+	}
+	if grant.MaxAmount != Empty {
+		maxAmount := util.ValidNumber(grant.MaxAmount)
+		if tx.Value().Cmp(maxAmount) > 0 {
+			return fmt.Errorf("%w: amount exceeds the grant's max_amount of %s", ErrPolicyViolation, grant.MaxAmount)
+		}
+		if call != nil && call.ABI == erc20Contract && (call.Method == "transfer" || call.Method == "transferFrom" || call.Method == "approve") {
+			tokens, ok := new(big.Int).SetString(fmt.Sprint(call.Arguments["tokens"]), 10)
+			if !ok || tokens.Cmp(maxAmount) > 0 {
+				return fmt.Errorf("%w: tokens exceed the grant's max_amount of %s", ErrPolicyViolation, grant.MaxAmount)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/core-coin/go-core/accounts/abi"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/crypto"
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/contracts/erc20"
+)
+
+func testAddress(t *testing.T) common.Address {
+	key, err := crypto.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypto.PubkeyToAddress(eddsa.Ed448DerivePublicKey(*key))
+}
+
+func TestGrantChecksERC20Calldata(t *testing.T) {
+	token, allowed, other := testAddress(t), testAddress(t), testAddress(t)
+	parsed, err := abi.JSON(strings.NewReader(erc20.Erc20ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant := &GrantJSON{AllowedDestinations: []string{token.Hex(), allowed.Hex()}, MaxAmount: "1000"}
+	transfer := func(to common.Address, tokens int64) (*types.Transaction, *DecodedCall) {
+		data, err := parsed.Pack("transfer", to, big.NewInt(tokens))
+		if err != nil {
+			t.Fatal(err)
+		}
+		call, err := decodeCall(context.Background(), &logical.InmemStorage{}, &token, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.NewTransaction(0, token, big.NewInt(0), 60000, big.NewInt(1), data), call
+	}
+
+	if err := grant.checkCall(transfer(allowed, 1000)); err != nil {
+		t.Fatalf("a transfer within the grant was refused: %v", err)
+	}
+	if err := grant.checkCall(transfer(other, 1000)); err == nil {
+		t.Fatal("a transfer to a destination the grant does not allow was signed")
+	}
+	if err := grant.checkCall(transfer(allowed, 1001)); err == nil {
+		t.Fatal("a transfer of more tokens than max_amount was signed")
+	}
+	tx, _ := transfer(allowed, 1)
+	if err := grant.checkCall(tx, &DecodedCall{Selector: "0xdeadbeef"}); err == nil {
+		t.Fatal("calldata no ABI decodes was signed")
+	}
+}
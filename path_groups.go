@@ -0,0 +1,499 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	eventGroupFrozen   string = "group_frozen"
+	eventGroupUnfrozen string = "group_unfrozen"
+
+	// maxBatchTransactions bounds the transactions of one sign-batch request
+	maxBatchTransactions int = 100
+)
+
+// GroupJSON is what we store for a group of accounts. Its rules and limits
+// apply to every member on top of the mount's and the member's own.
+type GroupJSON struct {
+	Members       []string `json:"members"`
+	CalldataRules []string `json:"calldata_rules,omitempty"`
+	MaxUSDPerTx   string   `json:"max_usd_per_tx,omitempty"`
+	DailyUSDLimit string   `json:"daily_usd_limit,omitempty"`
+	// StrictDigestSigning keeps the members from signing caller-supplied digests
+	StrictDigestSigning bool `json:"strict_digest_signing,omitempty"`
+	// Freeze is set while the members of the group are frozen
+	Freeze *FreezeJSON `json:"freeze,omitempty"`
+}
+
+func (group *GroupJSON) responseData(name string) map[string]interface{} {
+	members, calldataRules := group.Members, group.CalldataRules
+	if members == nil {
+		members = []string{}
+	}
+	if calldataRules == nil {
+		calldataRules = []string{}
+	}
+	return map[string]interface{}{
+		"name":                  name,
+		"members":               members,
+		"calldata_rules":        calldataRules,
+		"max_usd_per_tx":        group.MaxUSDPerTx,
+		"daily_usd_limit":       group.DailyUSDLimit,
+		"freeze":                group.Freeze.responseData(),
+		"strict_digest_signing": group.StrictDigestSigning,
+	}
+}
+
+func (group *GroupJSON) hasMember(account string) bool {
+	for _, member := range group.Members {
+		if member == account {
+			return true
+		}
+	}
+	return false
+}
+
+func groupStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("groups/%s", name))
+}
+
+func groupPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("groups/?"),
+			HelpSynopsis: "List the groups of accounts.",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathGroupsList,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("groups/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Create, read, update or delete a group of accounts.",
+			HelpDescription: `
+
+Group accounts, such as hot-wallets or staking, to hold them to the same
+rules. The calldata rules and USD limits of a group apply to each member on
+top of those of the mount and of the member, the strictest limit winning; an
+account in several groups is held to all of them. With strict_digest_signing
+the members of a group, such as hot-wallets, refuse caller-supplied digests
+at sign-digest even where the mount and the member allow them, and sign only
+what the plugin serialized itself. A group is frozen through
+groups/<name>/freeze and its members sign together through
+groups/<name>/sign-batch.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the group."},
+				"members": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The accounts in the group.",
+				},
+				"calldata_rules": {
+					Type:        framework.TypeStringSlice,
+					Description: "Rules the decoded calldata signed by the members must meet, on top of the mount's and the member's.",
+				},
+				"max_usd_per_tx": {
+					Type:        framework.TypeString,
+					Description: "The most a transaction signed by a member may be worth in USD.",
+				},
+				"daily_usd_limit": {
+					Type:        framework.TypeString,
+					Description: "The most each member may sign for in USD in a UTC day.",
+				},
+				"strict_digest_signing": {
+					Type:        framework.TypeBool,
+					Description: "Whether the members refuse to sign caller-supplied digests, whatever the mount and the member allow.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathGroupRead,
+				logical.CreateOperation: b.pathGroupWrite,
+				logical.UpdateOperation: b.pathGroupWrite,
+				logical.DeleteOperation: b.pathGroupDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("groups/" + framework.GenericNameRegex("name") + "/freeze"),
+			HelpSynopsis: "Freeze or unfreeze the signing of the members of a group.",
+			HelpDescription: `
+
+While a group is frozen its members refuse every operation that signs, as
+they would if the mount were frozen; reads keep working. Freezing and
+unfreezing raise group_frozen and group_unfrozen events.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the group."},
+				"frozen": {
+					Type:        framework.TypeBool,
+					Default:     true,
+					Description: "Whether the group is frozen.",
+				},
+				"reason": {
+					Type:        framework.TypeString,
+					Description: "Why the group is frozen; returned with every refusal.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathGroupFreezeWrite,
+				logical.DeleteOperation: b.pathGroupFreezeDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("groups/" + framework.GenericNameRegex("name") + "/sign-batch"),
+			HelpSynopsis: "Sign a batch of transactions with the members of a group.",
+			HelpDescription: `
+
+Sign each transaction of the batch as accounts/<account>/sign-tx would, with
+the same fields and the same rules, limits and approvals. Every account must
+be a member of the group. Each transaction is signed on its own: the result
+of each is returned in order, and one that is refused does not stop the
+others. Give the nonce of transactions that an account signs more than once.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the group."},
+				"transactions": {
+					Type:        framework.TypeSlice,
+					Description: "The transactions to sign: objects with the account that signs and the fields of sign-tx.",
+				},
+				"authorization_id": authorizationIDSchema,
+				"mfa_code":         mfaCodeSchema,
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.unlessFrozen(b.pathGroupSignBatch),
+			},
+		},
+	}
+}
+
+func readGroup(ctx context.Context, s logical.Storage, name string) (*GroupJSON, error) {
+	entry, err := s.Get(ctx, groupStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var group GroupJSON
+	if err := entry.DecodeJSON(&group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func writeGroup(ctx context.Context, s logical.Storage, name string, group *GroupJSON) error {
+	entry, err := logical.StorageEntryJSON(groupStoragePath(name), group)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// accountGroups returns the groups an account is a member of, by name
+func accountGroups(ctx context.Context, s logical.Storage, account string) (map[string]*GroupJSON, error) {
+	names, err := s.List(ctx, QualifiedPath("groups/"))
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string]*GroupJSON{}
+	for _, name := range names {
+		group, err := readGroup(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if group != nil && group.hasMember(account) {
+			groups[name] = group
+		}
+	}
+	return groups, nil
+}
+
+// leaveGroups removes a deleted account from the groups it was in
+func leaveGroups(ctx context.Context, s logical.Storage, account string) error {
+	groups, err := accountGroups(ctx, s, account)
+	if err != nil {
+		return err
+	}
+	for name, group := range groups {
+		members := []string{}
+		for _, member := range group.Members {
+			if member != account {
+				members = append(members, member)
+			}
+		}
+		group.Members = members
+		if err := writeGroup(ctx, s, name, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGroupFreeze refuses to sign for an account while a group it is in is frozen
+func checkGroupFreeze(ctx context.Context, s logical.Storage, account string) error {
+	groups, err := accountGroups(ctx, s, account)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if freeze := groups[name].Freeze; freeze != nil {
+			err = fmt.Errorf("%w: %s is in group %s, frozen since %s: %s", ErrGroupFrozen, account, name, freeze.FrozenAt.Format(time.RFC3339), freeze.Reason)
+			break
+		}
+	}
+	if len(groups) > 0 {
+		recordRule(ctx, "group_freeze", err)
+	}
+	return err
+}
+
+func (b *PluginBackend) pathGroupsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("groups/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathGroupRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	group, err := readGroup(ctx, req.Storage, name)
+	if err != nil || group == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: group.responseData(name),
+	}, nil
+}
+
+func (b *PluginBackend) pathGroupWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	group, err := readGroup(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		group = &GroupJSON{}
+	}
+	if membersRaw, ok := data.GetOk("members"); ok {
+		members := []string{}
+		seen := map[string]bool{}
+		for _, member := range membersRaw.([]string) {
+			member = strings.TrimSpace(member)
+			if member == Empty || seen[member] {
+				continue
+			}
+			if _, err := readAccount(ctx, req, member); err != nil {
+				return nil, err
+			}
+			seen[member] = true
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		group.Members = members
+	}
+	if calldataRulesRaw, ok := data.GetOk("calldata_rules"); ok {
+		if group.CalldataRules, err = parseCalldataRules(calldataRulesRaw.([]string)); err != nil {
+			return nil, err
+		}
+	}
+	if maxUSDPerTxRaw, ok := data.GetOk("max_usd_per_tx"); ok {
+		if group.MaxUSDPerTx, err = parseUSDLimit("max_usd_per_tx", maxUSDPerTxRaw.(string)); err != nil {
+			return nil, err
+		}
+	}
+	if dailyUSDLimitRaw, ok := data.GetOk("daily_usd_limit"); ok {
+		if group.DailyUSDLimit, err = parseUSDLimit("daily_usd_limit", dailyUSDLimitRaw.(string)); err != nil {
+			return nil, err
+		}
+	}
+	if strictDigestSigning, ok := data.GetOk("strict_digest_signing"); ok {
+		group.StrictDigestSigning = strictDigestSigning.(bool)
+	}
+	if err := writeGroup(ctx, req.Storage, name, group); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: group.responseData(name),
+	}, nil
+}
+
+func (b *PluginBackend) pathGroupDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	group, err := readGroup(ctx, req.Storage, name)
+	if err != nil || group == nil {
+		return nil, err
+	}
+	if group.Freeze != nil {
+		return nil, fmt.Errorf("%w: group %s is frozen; unfreeze it before deleting it", ErrInvalidInput, name)
+	}
+	return nil, req.Storage.Delete(ctx, groupStoragePath(name))
+}
+
+func (b *PluginBackend) pathGroupFreezeWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if !data.Get("frozen").(bool) {
+		return b.pathGroupFreezeDelete(ctx, req, data)
+	}
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	group, err := readGroup(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, fmt.Errorf("%w: group %s", ErrInvalidInput, name)
+	}
+	group.Freeze = &FreezeJSON{
+		Reason:   data.Get("reason").(string),
+		FrozenAt: time.Now().UTC(),
+		FrozenBy: req.EntityID,
+	}
+	if err := writeGroup(ctx, req.Storage, name, group); err != nil {
+		return nil, err
+	}
+	b.notify(config, req, eventGroupFrozen, map[string]interface{}{
+		"group":   name,
+		"members": group.Members,
+		"reason":  group.Freeze.Reason,
+	})
+	return &logical.Response{
+		Data: group.responseData(name),
+	}, nil
+}
+
+func (b *PluginBackend) pathGroupFreezeDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	group, err := readGroup(ctx, req.Storage, name)
+	if err != nil || group == nil || group.Freeze == nil {
+		return nil, err
+	}
+	reason := group.Freeze.Reason
+	group.Freeze = nil
+	if err := writeGroup(ctx, req.Storage, name, group); err != nil {
+		return nil, err
+	}
+	b.notify(config, req, eventGroupUnfrozen, map[string]interface{}{
+		"group":   name,
+		"members": group.Members,
+		"reason":  reason,
+	})
+	return nil, nil
+}
+
+func (b *PluginBackend) pathGroupSignBatch(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	group, err := readGroup(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, fmt.Errorf("%w: group %s", ErrInvalidInput, name)
+	}
+	transactions := data.Get("transactions").([]interface{})
+	if len(transactions) == 0 || len(transactions) > maxBatchTransactions {
+		return nil, fmt.Errorf("%w: a batch holds 1 to %d transactions", ErrInvalidInput, maxBatchTransactions)
+	}
+	items := make([]map[string]interface{}, len(transactions))
+	for i, transaction := range transactions {
+		item, ok := transaction.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: transaction %d is not an object", ErrInvalidInput, i)
+		}
+		account, _ := item["account"].(string)
+		if !group.hasMember(account) {
+			return nil, fmt.Errorf("%w: transaction %d: %q is not a member of group %s", ErrInvalidInput, i, account, name)
+		}
+		items[i] = item
+	}
+
+	var signTx *framework.Path
+	for _, path := range accountPaths(b) {
+		if strings.HasSuffix(path.Pattern, "/sign-tx") {
+			signTx = path
+		}
+	}
+	results := []map[string]interface{}{}
+	signed := 0
+	for i, item := range items {
+		raw := map[string]interface{}{}
+		for k, v := range item {
+			if k != "account" {
+				raw[k] = v
+			}
+		}
+		raw["name"] = item["account"]
+		result := map[string]interface{}{"index": i, "account": item["account"]}
+		resp, err := b.withSigningGuards(b.pathSignTx)(ctx, req, &framework.FieldData{Raw: raw, Schema: signTx.Fields})
+		switch {
+		case err != nil:
+			result["error"] = err.Error()
+			result["error_code"] = ErrorCode(err)
+		case resp == nil:
+			result["error"] = "nothing was signed"
+		case resp.IsError():
+			result["error"] = resp.Error().Error()
+		default:
+			for k, v := range resp.Data {
+				result[k] = v
+			}
+			signed++
+		}
+		results = append(results, result)
+	}
+	b.Logger().Info("signed batch", "group", name, "transactions", len(items), "signed", signed, "entity_id", req.EntityID)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"group":        name,
+			"signed":       signed,
+			"failed":       len(items) - signed,
+			"transactions": results,
+		},
+	}, nil
+}
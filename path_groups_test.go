@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestGroupStrictDigestSigning(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(ctx, &logical.Request{Operation: operation, Path: path, Storage: storage, Data: data})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return resp
+	}
+	refused := func(resp *logical.Response) bool {
+		return resp != nil && resp.Data[logical.HTTPStatusCode] == http.StatusBadRequest
+	}
+	digest := map[string]interface{}{"digest": "0x1b73999586e902d53f5282d51f9aec46237f46a6ed4e9dbba2fb50cf9a87596d"}
+
+	request(logical.UpdateOperation, "config", map[string]interface{}{"allow_digest_signing": true})
+	request(logical.CreateOperation, "accounts/hot", map[string]interface{}{"allow_digest_signing": true})
+	if resp := request(logical.UpdateOperation, "accounts/hot/sign-digest", digest); resp == nil || resp.Data["signature"] == nil {
+		t.Fatalf("the mount and the account allow digests, but sign-digest was refused: %v", resp)
+	}
+	request(logical.CreateOperation, "groups/hot-wallets", map[string]interface{}{"members": "hot", "strict_digest_signing": true})
+	if resp := request(logical.UpdateOperation, "accounts/hot/sign-digest", digest); !refused(resp) {
+		t.Fatalf("a member of a strict group signed a digest: %v", resp)
+	}
+	request(logical.UpdateOperation, "groups/hot-wallets", map[string]interface{}{"strict_digest_signing": false})
+	if resp := request(logical.UpdateOperation, "accounts/hot/sign-digest", digest); resp == nil || resp.Data["signature"] == nil {
+		t.Fatalf("the group left strict mode, but sign-digest was refused: %v", resp)
+	}
+}
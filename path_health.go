@@ -0,0 +1,156 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	healthStoragePath string = "health/check"
+
+	// healthMnemonic is the public BIP-39 test vector the KDF benchmark stretches
+	healthMnemonic string = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+)
+
+func healthPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("health"),
+			HelpSynopsis: "Check that the plugin can serve signing requests.",
+			HelpDescription: `
+
+Return the plugin version, whether storage can be written and read back, the
+latest block of the mount's RPC endpoints and of every configured chain, how
+long it takes to stretch a mnemonic into a seed, which every signing request
+does, and what the initialization of the mount did. The response has status
+503 when any check fails, so it can be used as a load balancer or monitoring
+probe; give the probe a token whose policy allows reading <mount>/health.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathHealthRead,
+			},
+		},
+	}
+}
+
+// checkStorage writes an entry, reads it back and deletes it
+func checkStorage(ctx context.Context, s logical.Storage) error {
+	value := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+	if err := s.Put(ctx, &logical.StorageEntry{Key: QualifiedPath(healthStoragePath), Value: value}); err != nil {
+		return err
+	}
+	entry, err := s.Get(ctx, QualifiedPath(healthStoragePath))
+	if err != nil {
+		return err
+	}
+	if entry == nil || !bytes.Equal(entry.Value, value) {
+		return fmt.Errorf("storage did not return what was written")
+	}
+	return s.Delete(ctx, QualifiedPath(healthStoragePath))
+}
+
+// checkRPC returns the latest block of the RPC endpoints of a config
+func (b *PluginBackend) checkRPC(ctx context.Context, config *ConfigJSON) map[string]interface{} {
+	start := time.Now()
+	result := map[string]interface{}{
+		"chain_id": config.ChainID,
+	}
+	client, err := b.dialRPC(ctx, config)
+	var block uint64
+	if err == nil {
+		block, err = client.BlockNumber(ctx)
+	}
+	result["ok"] = err == nil
+	result["duration"] = time.Since(start).String()
+	if err != nil {
+		result["error"] = err.Error()
+	} else {
+		result["block_number"] = block
+	}
+	return result
+}
+
+func (b *PluginBackend) pathHealthRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	healthy := true
+
+	start := time.Now()
+	storage := map[string]interface{}{"ok": true}
+	if err := checkStorage(ctx, req.Storage); err != nil {
+		healthy = false
+		storage["ok"] = false
+		storage["error"] = err.Error()
+	}
+	storage["duration"] = time.Since(start).String()
+
+	rpc := b.checkRPC(ctx, config)
+	healthy = healthy && rpc["ok"].(bool)
+	chains := map[string]interface{}{}
+	names, err := req.Storage.List(ctx, QualifiedPath("chains/"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		chain, err := readChain(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if chain == nil {
+			continue
+		}
+		chainConfig := *config
+		chain.apply(&chainConfig)
+		chains[name] = b.checkRPC(ctx, &chainConfig)
+		healthy = healthy && chains[name].(map[string]interface{})["ok"].(bool)
+	}
+
+	initialization, initialized := b.initStatus.report()
+	healthy = healthy && initialized
+
+	start = time.Now()
+	bip39.NewSeed(healthMnemonic, Empty)
+	kdf := time.Since(start)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"healthy":        healthy,
+			"version":        Version,
+			"storage":        storage,
+			"rpc":            rpc,
+			"chains":         chains,
+			"kdf_benchmark":  kdf.String(),
+			"initialization": initialization,
+			"slow_requests":  atomic.LoadUint64(&b.slowRequests),
+		},
+	}
+	if !healthy {
+		return logical.RespondWithStatusCode(resp, req, http.StatusServiceUnavailable)
+	}
+	return resp, nil
+}
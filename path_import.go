@@ -0,0 +1,397 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/cryptohub-digital/vault-core/chains"
+	"github.com/cryptohub-digital/vault-core/chains/core"
+	"github.com/cryptohub-digital/vault-core/util"
+
+	"github.com/core-coin/go-core/accounts"
+	"github.com/core-coin/go-core/accounts/keystore"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/crypto"
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// ImportKeystore is a keystore v3 file, as Core wallets and the export path write
+	ImportKeystore string = "keystore"
+	// ImportMetaMask is the encrypted vault of a MetaMask extension
+	ImportMetaMask string = "metamask"
+	// ImportPresale is an Ethereum presale wallet
+	ImportPresale string = "presale"
+
+	// metaMaskIterations is the PBKDF2 iteration count of vaults without key metadata
+	metaMaskIterations int = 10000
+	// metaMaskHDKeyring is the keyring type that holds the mnemonic of a vault
+	metaMaskHDKeyring string = "HD Key Tree"
+)
+
+// signingWallet is what signing needs from the wallet of an account,
+// whether its key is derived from a mnemonic or was imported as is
+type signingWallet interface {
+	SignHash(account accounts.Account, hash []byte) ([]byte, error)
+	SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	PrivateKey(account accounts.Account) (*eddsa.PrivateKey, error)
+}
+
+// keyWallet signs with the private key of an imported account
+type keyWallet struct {
+	key     *eddsa.PrivateKey
+	account accounts.Account
+}
+
+func newKeyWallet(privateKey string) (*keyWallet, error) {
+	keyBytes, err := hexutil.Decode(privateKey)
+	if err != nil {
+		return nil, wrapError(ErrKeystoreDecrypt, err)
+	}
+	key, err := crypto.ToEDDSA(keyBytes)
+	if err != nil {
+		return nil, wrapError(ErrKeystoreDecrypt, err)
+	}
+	return keyWalletFor(key), nil
+}
+
+func keyWalletFor(key *eddsa.PrivateKey) *keyWallet {
+	public := eddsa.Ed448DerivePublicKey(*key)
+	return &keyWallet{key: key, account: accounts.Account{Address: crypto.PubkeyToAddress(public)}}
+}
+
+func (w *keyWallet) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	if account.Address != w.account.Address {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return crypto.Sign(hash, w.key)
+}
+
+func (w *keyWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if account.Address != w.account.Address {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return types.SignTx(tx, types.MakeSigner(chainID), w.key)
+}
+
+func (w *keyWallet) PrivateKey(account accounts.Account) (*eddsa.PrivateKey, error) {
+	if account.Address != w.account.Address {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return w.key, nil
+}
+
+// walletSigner signs digests with the key of an account behind its wallet
+func walletSigner(wallet signingWallet, account accounts.Account) chains.Signer {
+	return chains.SignerFunc(func(digest []byte) ([]byte, error) {
+		return wallet.SignHash(account, digest)
+	})
+}
+
+// keySigner signs digests with a private key
+func keySigner(key *eddsa.PrivateKey) chains.Signer {
+	return chains.SignerFunc(func(digest []byte) ([]byte, error) {
+		return crypto.Sign(digest, key)
+	})
+}
+
+// signCoreTransaction signs a transaction with the Core adapter of the network
+func signCoreTransaction(chainID *big.Int, signer chains.Signer, tx *types.Transaction) (*types.Transaction, error) {
+	adapter, err := chains.New(core.Chain, chainID)
+	if err != nil {
+		return nil, wrapError(ErrInvalidChainID, err)
+	}
+	signed, err := chains.Sign(adapter, signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	return signed.Transaction.(*types.Transaction), nil
+}
+
+func importPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/import"),
+			HelpSynopsis: "Create an account from the export of another wallet.",
+			HelpDescription: `
+
+Create an account from a wallet file, decrypted with its passphrase, and keep
+its key in an envelope like that of any other account:
+
+  keystore  A keystore v3 file, as Core wallets and accounts/<name>/export
+            write it, with a scrypt, pbkdf2 or argon2id key derivation.
+            The account signs with the key of the file.
+  metamask  The encrypted vault of a MetaMask extension, as its state logs
+            or the extension storage hold it. The account derives its key
+            from the mnemonic of the vault at index.
+
+Ethereum keys are secp256k1 keys and cannot sign for the Ed448 addresses of
+Core: keystores of Ethereum wallets such as geth and MyEtherWallet, presale
+wallets, and the imported keys of a MetaMask vault are refused. The format is
+detected when it is not given. Settings such as inclusions and limits are
+written to accounts/<name> once the account exists.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"format": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{ImportKeystore, ImportMetaMask, ImportPresale},
+					Description:   "The format of file; detected if unset.",
+				},
+				"file": {
+					Type:        framework.TypeString,
+					Description: "The wallet file, as JSON.",
+				},
+				"passphrase": {
+					Type:        framework.TypeString,
+					Description: "The passphrase the file is encrypted with.",
+				},
+				"index": {
+					Type:        framework.TypeInt,
+					Default:     0,
+					Description: "For a MetaMask vault, the BIP-44 index of the account to derive from its mnemonic.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathAccountImport,
+			},
+		},
+	}
+}
+
+// detectImportFormat tells the formats apart by their fields
+func detectImportFormat(file map[string]json.RawMessage) (string, error) {
+	switch {
+	case file["crypto"] != nil || file["Crypto"] != nil:
+		return ImportKeystore, nil
+	case file["encseed"] != nil:
+		return ImportPresale, nil
+	case file["data"] != nil && file["iv"] != nil && file["salt"] != nil:
+		return ImportMetaMask, nil
+	}
+	return Empty, fmt.Errorf("%w: file is not a keystore, MetaMask vault or presale wallet", ErrInvalidInput)
+}
+
+// decryptKeystore returns the private key of a keystore v3 file. MyEtherWallet
+// writes the crypto section as Crypto.
+func decryptKeystore(file map[string]json.RawMessage, passphrase string) (key []byte, err error) {
+	section := file["crypto"]
+	if section == nil {
+		section = file["Crypto"]
+	}
+	var cryptoJSON keystore.CryptoJSON
+	if err := json.Unmarshal(section, &cryptoJSON); err != nil {
+		return nil, fmt.Errorf("%w: the crypto section of the keystore: %v", ErrInvalidInput, err)
+	}
+	// the keystore package assumes well-formed KDF parameters
+	defer func() {
+		if r := recover(); r != nil {
+			key, err = nil, fmt.Errorf("%w: malformed keystore: %v", ErrInvalidInput, r)
+		}
+	}()
+	if cryptoJSON.KDF == util.KDFArgon2id {
+		key, err = util.DecryptDataArgon2id(cryptoJSON, passphrase)
+	} else if err = util.CheckKDFCosts(cryptoJSON.KDF, cryptoJSON.KDFParams); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	} else {
+		key, err = keystore.DecryptDataV3(cryptoJSON, passphrase)
+	}
+	if errors.Is(err, keystore.ErrDecrypt) {
+		// Core keystores are MACed with SHA3, so an Ethereum one never verifies
+		return nil, fmt.Errorf("%w: wrong passphrase, or an Ethereum keystore such as those of geth and MyEtherWallet, whose key cannot sign for Core", ErrKeystoreDecrypt)
+	}
+	if err != nil {
+		return nil, wrapError(ErrKeystoreDecrypt, err)
+	}
+	if len(key) != crypto.PrivkeyLength {
+		return nil, fmt.Errorf("%w: the keystore holds a %d byte key, not a %d byte Ed448 key", ErrInvalidInput, len(key), crypto.PrivkeyLength)
+	}
+	return key, nil
+}
+
+type metaMaskVault struct {
+	Data        string `json:"data"`
+	IV          string `json:"iv"`
+	Salt        string `json:"salt"`
+	KeyMetadata *struct {
+		Algorithm string `json:"algorithm"`
+		Params    struct {
+			Iterations int `json:"iterations"`
+		} `json:"params"`
+	} `json:"keyMetadata"`
+}
+
+type metaMaskKeyring struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type metaMaskHDKeyringData struct {
+	// Mnemonic is a string, or in newer vaults the bytes of one
+	Mnemonic json.RawMessage `json:"mnemonic"`
+}
+
+// decryptMetaMask returns the mnemonic of a MetaMask vault: AES-256-GCM under
+// a PBKDF2-SHA256 key, with the salt, IV and ciphertext in base64
+func decryptMetaMask(raw []byte, passphrase string) (string, error) {
+	var vault metaMaskVault
+	if err := json.Unmarshal(raw, &vault); err != nil {
+		return Empty, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	iterations := metaMaskIterations
+	if vault.KeyMetadata != nil {
+		if vault.KeyMetadata.Algorithm != "PBKDF2" || vault.KeyMetadata.Params.Iterations <= 0 {
+			return Empty, fmt.Errorf("%w: unsupported MetaMask key derivation %s", ErrInvalidInput, vault.KeyMetadata.Algorithm)
+		}
+		iterations = vault.KeyMetadata.Params.Iterations
+	}
+	var fields [3][]byte
+	for i, value := range []string{vault.Salt, vault.IV, vault.Data} {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return Empty, fmt.Errorf("%w: the MetaMask vault is not base64: %v", ErrInvalidInput, err)
+		}
+		fields[i] = decoded
+	}
+	salt, iv, data := fields[0], fields[1], fields[2]
+	key := pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return Empty, err
+	}
+	if len(iv) == 0 {
+		return Empty, fmt.Errorf("%w: the MetaMask vault has no IV", ErrInvalidInput)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return Empty, err
+	}
+	plaintext, err := gcm.Open(nil, iv, data, nil)
+	if err != nil {
+		return Empty, fmt.Errorf("%w: wrong passphrase or damaged MetaMask vault", ErrKeystoreDecrypt)
+	}
+	var keyrings []metaMaskKeyring
+	if err := json.Unmarshal(plaintext, &keyrings); err != nil {
+		return Empty, fmt.Errorf("%w: the MetaMask vault holds no keyrings: %v", ErrInvalidInput, err)
+	}
+	for _, keyring := range keyrings {
+		if keyring.Type != metaMaskHDKeyring {
+			continue
+		}
+		var hdKeyring metaMaskHDKeyringData
+		if err := json.Unmarshal(keyring.Data, &hdKeyring); err != nil {
+			return Empty, fmt.Errorf("%w: cannot read the HD keyring of the MetaMask vault", ErrInvalidInput)
+		}
+		var mnemonic string
+		if err := json.Unmarshal(hdKeyring.Mnemonic, &mnemonic); err != nil {
+			var mnemonicBytes []byte
+			var numbers []int
+			if err := json.Unmarshal(hdKeyring.Mnemonic, &numbers); err != nil {
+				return Empty, fmt.Errorf("%w: cannot read the mnemonic of the MetaMask vault", ErrInvalidInput)
+			}
+			for _, n := range numbers {
+				mnemonicBytes = append(mnemonicBytes, byte(n))
+			}
+			mnemonic = string(mnemonicBytes)
+		}
+		if !bip39.IsMnemonicValid(mnemonic) {
+			return Empty, fmt.Errorf("%w: the mnemonic of the MetaMask vault is not a BIP-39 mnemonic", ErrInvalidInput)
+		}
+		return mnemonic, nil
+	}
+	return Empty, fmt.Errorf("%w: the MetaMask vault has no mnemonic; its imported keys are secp256k1 keys", ErrInvalidInput)
+}
+
+func (b *PluginBackend) pathAccountImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	existing, err := req.Storage.Get(ctx, QualifiedPath(fmt.Sprintf("accounts/%s", name)))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAccountExists, name)
+	}
+	raw := []byte(strings.TrimSpace(data.Get("file").(string)))
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("%w: file is not JSON: %v", ErrInvalidInput, err)
+	}
+	format := data.Get("format").(string)
+	if format == Empty {
+		if format, err = detectImportFormat(file); err != nil {
+			return nil, err
+		}
+	}
+	passphrase := data.Get("passphrase").(string)
+
+	accountJSON := &AccountJSON{ImportedFrom: format}
+	switch format {
+	case ImportKeystore:
+		key, err := decryptKeystore(file, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		accountJSON.PrivateKey = hexutil.Encode(key)
+	case ImportMetaMask:
+		mnemonic, err := decryptMetaMask(raw, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		accountJSON.Mnemonic = mnemonic
+		accountJSON.Index = data.Get("index").(int)
+	case ImportPresale:
+		return nil, fmt.Errorf("%w: a presale wallet holds a secp256k1 key, which cannot sign for a Core address", ErrInvalidInput)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %s", ErrInvalidInput, format)
+	}
+
+	_, account, err := getWalletAndAccount(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkDuplicateAccount(ctx, req, account.Address, name); err != nil {
+		return nil, err
+	}
+	if err := b.updateAccount(ctx, req, name, accountJSON); err != nil {
+		return nil, err
+	}
+	if err := b.indexAccount(ctx, req, account.Address, name); err != nil {
+		return nil, err
+	}
+	b.Logger().Info("imported account", "name", name, "format", format, "address", account.Address.Hex())
+	b.recordActivity(ctx, req, name, &ActivityJSON{Event: activityImported}, nil, nil)
+	return &logical.Response{
+		Data: accountJSON.responseData(account.Address),
+	}, nil
+}
@@ -0,0 +1,209 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/chains"
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// TransactionTypes are the transaction types sign-tx and transfer produce.
+// Core has no typed transactions: every transaction is a legacy one priced in energy.
+var TransactionTypes = []string{"legacy"}
+
+// SignatureScheme is the scheme of the signatures the plugin makes with an
+// account; keys/ and the ledger routes sign on the curves of SignatureSchemes
+const SignatureScheme = "ed448"
+
+// KeyCurves are the curves keys/ holds keys on, besides the Ed448 of accounts
+var KeyCurves = []string{util.CurveSecp256r1, util.CurveSecp256k1, util.CurveEd25519}
+
+// NonceGeneration is how the nonces of account signatures are made. Ed448
+// derives the nonce from a SHAKE256 hash of the secret key prefix and the
+// message, as RFC 8032 specifies, so the same key and digest always give the
+// same signature. Keys on other curves make theirs as SignatureSchemes says.
+const NonceGeneration = "deterministic_rfc8032"
+
+// SignatureSchemeJSON is how the plugin signs on a curve
+type SignatureSchemeJSON struct {
+	Scheme          string `json:"scheme"`
+	NonceGeneration string `json:"nonce_generation"`
+	LowS            bool   `json:"low_s,omitempty"`
+}
+
+// SignatureSchemes are the schemes and nonces of each curve the plugin signs
+// on. secp256k1 signatures, of keys and of the EVM, XRPL and TRON routes, use
+// RFC 6979 nonces and a low S. secp256r1 signatures come from crypto/ecdsa,
+// which hedges the nonce with random bytes, so they differ on every call and
+// their S is left as the curve gives it.
+var SignatureSchemes = map[string]SignatureSchemeJSON{
+	util.CurveEd448:     {Scheme: "ed448", NonceGeneration: NonceGeneration},
+	util.CurveSecp256k1: {Scheme: "ecdsa", NonceGeneration: "deterministic_rfc6979", LowS: true},
+	util.CurveSecp256r1: {Scheme: "ecdsa", NonceGeneration: "hedged_random"},
+	util.CurveEd25519:   {Scheme: "ed25519", NonceGeneration: "deterministic_rfc8032"},
+}
+
+// features this build of the plugin supports, whatever the mount's config
+var features = []string{
+	"activity",
+	"address_book",
+	"anomaly_rules",
+	"approval_callbacks",
+	"approval_requests",
+	"approver_groups",
+	"argon2id_keystores",
+	"authorizations",
+	"backup_verify",
+	"bls_keys",
+	"bundles",
+	"calldata_rules",
+	"canaries",
+	"ceremony_attestation",
+	"chain_profiles",
+	"chains",
+	"clef",
+	"control_groups",
+	"decode",
+	"decision_log",
+	"digest_signing",
+	"disbursements",
+	"erc20",
+	"erc721",
+	"evm",
+	"exports",
+	"freeze",
+	"gas_tanks",
+	"grants",
+	"groups",
+	"health",
+	"imports",
+	"inventory",
+	"keys",
+	"mfa",
+	"migrations",
+	"mnemonics",
+	"permits",
+	"plugin_info",
+	"policy_hook",
+	"private_broadcast",
+	"proof_of_control",
+	"rpc_subscriptions",
+	"sanctions",
+	"schedules",
+	"screening",
+	"selectors",
+	"sessions",
+	"shadow_signing",
+	"sign_tickets",
+	"signing_restrictions",
+	"spend_report",
+	"stellar",
+	"templates",
+	"tiers",
+	"travel_rule",
+	"tron",
+	"usd_limits",
+	"xrpl",
+}
+
+func infoPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("info"),
+			HelpSynopsis: "Return the version of the plugin and the features of this mount.",
+			HelpDescription: `
+
+Return the version and git commit of the plugin, the transaction types it
+signs, the chains it has a signing adapter for and its features, so clients
+can detect what a mount supports instead of trying. signature_scheme and
+nonce_generation describe the Ed448 signatures of accounts; signature_schemes
+gives the scheme, nonces and S normalization of every curve the plugin signs
+on. Only secp256r1 nonces are random: its signatures differ on every call. supported lists what this build can do; enabled lists what this
+mount's config turns on, and is empty until the mount is configured.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathInfoRead,
+			},
+		},
+	}
+}
+
+// enabledFeatures are the features a config turns on
+func enabledFeatures(config *ConfigJSON) []string {
+	enabled := []string{}
+	for feature, on := range map[string]bool{
+		"calldata_rules":      len(config.CalldataRules) > 0,
+		"clef":                len(config.ClefAccounts) > 0,
+		"decision_log_file":   config.DecisionLogFile != Empty,
+		"decision_log_hmac":   config.DecisionLogFile != Empty && config.DecisionLogHMAC,
+		"digest_signing":      config.AllowDigestSigning,
+		"export_approvals":    len(config.ExportApproverGroups) > 0,
+		"authorizations":      len(config.AuthorizerGroups) > 0,
+		"control_groups":      len(config.ControlGroupOperations) > 0 || config.ControlGroupMinAmount != Empty || config.ControlGroupMinUSD != Empty,
+		"mfa":                 config.MFAMethod != Empty,
+		"anomaly_rules":       len(config.AnomalyRules) > 0,
+		"approval_callbacks":  config.ApprovalCallbackSecret != Empty,
+		"approval_requests":   config.ApprovalSlackWebhookURL != Empty || config.ApprovalPagerDutyRoutingKey != Empty,
+		"notifications":       config.NotificationWebhookURL != Empty,
+		"inventory_push":      config.InventoryPushURL != Empty,
+		"policy_hook":         config.PolicyHookURL != Empty,
+		"screening":           config.ScreeningURL != Empty,
+		"shadow_signing":      config.ShadowURL != Empty,
+		"usd_limits":          config.MaxUSDPerTx != Empty || config.DailyUSDLimit != Empty,
+		"reorg_rebroadcast":   config.RebroadcastReorged,
+		"rpc_subscriptions":   config.subscribable(),
+		"private_broadcast":   len(config.PrivateRelayURLs) > 0,
+		"lowercase_addresses": config.LowercaseAddressesOnly,
+	} {
+		if on {
+			enabled = append(enabled, feature)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+
+func (b *PluginBackend) pathInfoRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	enabled := []string{}
+	config, err := b.configured(ctx, req)
+	switch {
+	case err == nil:
+		enabled = enabledFeatures(config)
+	case !errors.Is(err, ErrNotConfigured):
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"version":           Version,
+			"commit":            Commit,
+			"transaction_types": TransactionTypes,
+			"signature_scheme":  SignatureScheme,
+			"key_curves":        KeyCurves,
+			"chain_adapters":    chains.Registered(),
+			"nonce_generation":  NonceGeneration,
+			"signature_schemes": SignatureSchemes,
+			"supported":         features,
+			"enabled":           enabled,
+		},
+	}, nil
+}
@@ -0,0 +1,512 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/xcbclient"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// DefaultInventoryPushCron is when inventory snapshots are pushed unless configured
+	DefaultInventoryPushCron string = "@daily"
+	// DefaultInventoryPushRegion is the region S3 requests are signed for unless configured
+	DefaultInventoryPushRegion string = "us-east-1"
+
+	// inventoryPushTimeout bounds the upload of one snapshot
+	inventoryPushTimeout = 30 * time.Second
+)
+
+// InventoryJSON is the public inventory of the mount: its accounts, where they
+// are exposed and what they hold, without any key material
+type InventoryJSON struct {
+	Time     time.Time           `json:"time"`
+	Accounts []*InventoryAccount `json:"accounts"`
+}
+
+// InventoryAccount is an account of the inventory
+type InventoryAccount struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	// Labels are the address book labels that resolve to the address
+	Labels    []string          `json:"labels"`
+	Groups    []string          `json:"groups"`
+	ChainIDs  []string          `json:"chain_ids"`
+	Sealed    bool              `json:"sealed"`
+	Destroyed bool              `json:"destroyed"`
+	Chains    []*InventoryChain `json:"chains"`
+}
+
+// InventoryChain is the balance of an account on the mount's chain, whose
+// name is empty, or on one of chains/<chain>
+type InventoryChain struct {
+	Chain   string `json:"chain"`
+	ChainID string `json:"chain_id"`
+	Balance string `json:"balance,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// InventoryPushJSON is the state of the scheduled inventory push
+type InventoryPushJSON struct {
+	// Cron is the inventory_push_cron NextPush was planned with
+	Cron       string    `json:"cron"`
+	NextPush   time.Time `json:"next_push"`
+	LastPush   time.Time `json:"last_push"`
+	LastObject string    `json:"last_object"`
+	LastError  string    `json:"last_error"`
+}
+
+func (push *InventoryPushJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"cron":        push.Cron,
+		"last_object": push.LastObject,
+		"last_error":  push.LastError,
+	}
+	if !push.NextPush.IsZero() {
+		result["next_push"] = push.NextPush.UTC().Format(time.RFC3339)
+	}
+	if !push.LastPush.IsZero() {
+		result["last_push"] = push.LastPush.UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+func inventoryPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("inventory"),
+			HelpSynopsis: "Return the addresses of the mount, where they are exposed and their balances.",
+			HelpDescription: `
+
+Return every account of the mount for monitoring systems: its address, the
+address book labels that resolve to it, its groups, the chains it is pinned
+to, and its balance in wei on the mount's chain and on each of chains/<chain>
+it is exposed on. Nothing secret is returned. A balance that cannot be read is
+reported with the error instead of failing the inventory.
+
+As csv there is one row per account and chain.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"format": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{formatJSON, formatCSV},
+					Default:       formatJSON,
+					Description:   "The inventory format: json or csv.",
+				},
+				"balances": {
+					Type:        framework.TypeBool,
+					Default:     true,
+					Description: "Read the balances; false returns the addresses without calling any RPC endpoint.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathInventoryRead,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("inventory/push"),
+			HelpSynopsis: "Return the state of the scheduled inventory push, or push a snapshot now.",
+			HelpDescription: `
+
+With inventory_push_url configured, a snapshot of the inventory is PUT to the
+bucket on inventory_push_cron as inventory-<time>.json or .csv. Requests are
+signed with AWS Signature Version 4, which S3 accepts with access keys and
+Google Cloud Storage accepts with HMAC keys at https://storage.googleapis.com.
+Snapshots are pushed by the cluster that writes replicated storage.
+
+Reading returns when the next snapshot is pushed and how the last push went;
+writing pushes one now.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathInventoryPushRead,
+				logical.UpdateOperation: b.pathInventoryPushWrite,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathInventoryRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	format := data.Get("format").(string)
+	if format != formatJSON && format != formatCSV {
+		return nil, fmt.Errorf("%w: unknown format %s", ErrInvalidInput, format)
+	}
+	inventory, err := b.buildInventory(ctx, req, config, data.Get("balances").(bool))
+	if err != nil {
+		return nil, err
+	}
+	if format == formatCSV {
+		body, err := inventory.encodeCSV()
+		if err != nil {
+			return nil, err
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: "text/csv",
+				logical.HTTPRawBody:     body,
+				logical.HTTPStatusCode:  http.StatusOK,
+			},
+		}, nil
+	}
+	accounts := make([]interface{}, 0, len(inventory.Accounts))
+	for _, account := range inventory.Accounts {
+		accounts = append(accounts, account)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"time":     inventory.Time.Format(time.RFC3339),
+			"accounts": accounts,
+		},
+	}, nil
+}
+
+// buildInventory lists the accounts of the mount with their labels, groups
+// and, if balances is set, their balance on every chain they are exposed on
+func (b *PluginBackend) buildInventory(ctx context.Context, req *logical.Request, config *ConfigJSON, balances bool) (*InventoryJSON, error) {
+	labels := map[common.Address][]string{}
+	names, err := req.Storage.List(ctx, QualifiedPath("addressbook/"))
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range names {
+		entry, err := readAddressBookEntry(ctx, req, label)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		if address, err := common.HexToAddress(entry.Address); err == nil {
+			labels[address] = append(labels[address], label)
+		}
+	}
+	groups := map[string][]string{}
+	if names, err = req.Storage.List(ctx, QualifiedPath("groups/")); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		group, err := readGroup(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if group == nil {
+			continue
+		}
+		for _, member := range group.Members {
+			groups[member] = append(groups[member], name)
+		}
+	}
+	if names, err = req.Storage.List(ctx, QualifiedPath("chains/")); err != nil {
+		return nil, err
+	}
+	chains := map[string]*ChainJSON{}
+	for _, name := range names {
+		chain, err := readChain(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if chain != nil {
+			chains[name] = chain
+		}
+	}
+	sort.Strings(names)
+	// the mount's own chain comes first, under no name
+	names = append([]string{Empty}, names...)
+	clients := map[string]*xcbclient.Client{}
+	dialErrors := map[string]error{}
+	chainConfig := func(name string) *ConfigJSON {
+		if name == Empty {
+			return config
+		}
+		chainConfig := *config
+		chains[name].apply(&chainConfig)
+		return &chainConfig
+	}
+
+	inventory := &InventoryJSON{Time: time.Now().UTC(), Accounts: []*InventoryAccount{}}
+	accountNames, err := req.Storage.List(ctx, QualifiedPath("accounts/"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(accountNames)
+	for _, name := range accountNames {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		accountJSON, err := readAccount(ctx, req, name)
+		if err != nil {
+			return nil, err
+		}
+		address, err := accountAddress(ctx, *accountJSON)
+		if err != nil {
+			return nil, err
+		}
+		account := &InventoryAccount{
+			Name:      name,
+			Address:   address.Hex(),
+			Labels:    labels[address],
+			Groups:    groups[name],
+			ChainIDs:  accountJSON.ChainIDs,
+			Sealed:    accountJSON.sealed(),
+			Destroyed: accountJSON.Destroyed,
+			Chains:    []*InventoryChain{},
+		}
+		for _, list := range []*[]string{&account.Labels, &account.Groups, &account.ChainIDs} {
+			if *list == nil {
+				*list = []string{}
+			}
+			sort.Strings(*list)
+		}
+		for _, chainName := range names {
+			if chainName != Empty && len(chains[chainName].Accounts) > 0 && !util.Contains(chains[chainName].Accounts, name) {
+				continue
+			}
+			chainConfig := chainConfig(chainName)
+			if !accountJSON.pinnedTo(chainConfig.ChainID) {
+				continue
+			}
+			chain := &InventoryChain{Chain: chainName, ChainID: chainConfig.ChainID}
+			account.Chains = append(account.Chains, chain)
+			if !balances {
+				continue
+			}
+			client, ok := clients[chainName]
+			if !ok && dialErrors[chainName] == nil {
+				if client, err = b.dialRPC(ctx, chainConfig); err != nil {
+					dialErrors[chainName] = err
+				} else {
+					clients[chainName] = client
+				}
+			}
+			if dialErrors[chainName] != nil {
+				chain.Error = dialErrors[chainName].Error()
+				continue
+			}
+			balance, err := client.BalanceAt(ctx, address, nil)
+			if err != nil {
+				chain.Error = err.Error()
+				continue
+			}
+			chain.Balance = balance.String()
+		}
+		inventory.Accounts = append(inventory.Accounts, account)
+	}
+	return inventory, nil
+}
+
+// encodeCSV writes one row per account and chain, and one for an account exposed on none
+func (inventory *InventoryJSON) encodeCSV() ([]byte, error) {
+	var buff bytes.Buffer
+	writer := csv.NewWriter(&buff)
+	writer.Write([]string{"account", "address", "labels", "groups", "chain", "chain_id", "balance", "error"})
+	for _, account := range inventory.Accounts {
+		row := []string{account.Name, account.Address, strings.Join(account.Labels, ";"), strings.Join(account.Groups, ";")}
+		if len(account.Chains) == 0 {
+			writer.Write(append(row, Empty, Empty, Empty, Empty))
+		}
+		for _, chain := range account.Chains {
+			writer.Write(append(row[:4:4], chain.Chain, chain.ChainID, chain.Balance, chain.Error))
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+func inventoryPushStoragePath() string {
+	return QualifiedPath("inventory/push")
+}
+
+func readInventoryPush(ctx context.Context, s logical.Storage) (*InventoryPushJSON, error) {
+	entry, err := s.Get(ctx, inventoryPushStoragePath())
+	if err != nil {
+		return nil, err
+	}
+	var push InventoryPushJSON
+	if entry == nil {
+		return &push, nil
+	}
+	if err := entry.DecodeJSON(&push); err != nil {
+		return nil, err
+	}
+	return &push, nil
+}
+
+func writeInventoryPush(ctx context.Context, s logical.Storage, push *InventoryPushJSON) error {
+	entry, err := logical.StorageEntryJSON(inventoryPushStoragePath(), push)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// plan sets the next push after t from the configured cron
+func (push *InventoryPushJSON) plan(config *ConfigJSON, t time.Time) error {
+	push.Cron = config.inventoryPushCron()
+	cron, err := parseCron(push.Cron)
+	if err != nil {
+		return err
+	}
+	push.NextPush = cron.next(t)
+	return nil
+}
+
+func (b *PluginBackend) pathInventoryPushRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	push, err := readInventoryPush(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: push.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathInventoryPushWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if config.InventoryPushURL == Empty {
+		return nil, fmt.Errorf("%w: inventory_push_url is not configured", ErrNotConfigured)
+	}
+	push, err := readInventoryPush(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	err = b.pushInventory(ctx, req, config, push)
+	if writeErr := writeInventoryPush(ctx, req.Storage, push); writeErr != nil {
+		return nil, writeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: push.responseData(),
+	}, nil
+}
+
+// runInventoryPush pushes a snapshot of the inventory when inventory_push_cron is due
+func (b *PluginBackend) runInventoryPush(ctx context.Context, req *logical.Request) error {
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		if errors.Is(err, ErrNotConfigured) {
+			return nil
+		}
+		return err
+	}
+	if config.InventoryPushURL == Empty {
+		return nil
+	}
+	push, err := readInventoryPush(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if push.Cron != config.inventoryPushCron() || push.NextPush.IsZero() {
+		if err := push.plan(config, now); err != nil {
+			return err
+		}
+		return writeInventoryPush(ctx, req.Storage, push)
+	}
+	if now.Before(push.NextPush) {
+		return nil
+	}
+	if err := b.pushInventory(ctx, req, config, push); err != nil {
+		b.Logger().Error("cannot push inventory", "error", err)
+	}
+	if err := push.plan(config, now); err != nil {
+		return err
+	}
+	return writeInventoryPush(ctx, req.Storage, push)
+}
+
+// pushInventory uploads a snapshot of the inventory and records the outcome in push
+func (b *PluginBackend) pushInventory(ctx context.Context, req *logical.Request, config *ConfigJSON, push *InventoryPushJSON) error {
+	push.LastPush = time.Now().UTC()
+	object, err := b.uploadInventory(ctx, req, config)
+	push.LastError = Empty
+	if err != nil {
+		push.LastError = err.Error()
+		return err
+	}
+	push.LastObject = object
+	b.Logger().Info("inventory pushed", "object", object)
+	return nil
+}
+
+func (b *PluginBackend) uploadInventory(ctx context.Context, req *logical.Request, config *ConfigJSON) (string, error) {
+	inventory, err := b.buildInventory(ctx, req, config, true)
+	if err != nil {
+		return Empty, err
+	}
+	var body []byte
+	contentType := "application/json"
+	if config.inventoryPushFormat() == formatCSV {
+		body, err = inventory.encodeCSV()
+		contentType = "text/csv"
+	} else {
+		body, err = json.Marshal(inventory)
+	}
+	if err != nil {
+		return Empty, err
+	}
+	object := strings.TrimSuffix(config.InventoryPushURL, "/") + "/inventory-" + inventory.Time.Format("20060102T150405Z") + "." + config.inventoryPushFormat()
+
+	ctx, cancel := context.WithTimeout(ctx, inventoryPushTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, object, bytes.NewReader(body))
+	if err != nil {
+		return Empty, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	util.SignV4(request, body, config.inventoryPushRegion(), "s3", config.InventoryPushAccessKeyID, config.InventoryPushSecretAccessKey, time.Now())
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return Empty, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusMultipleChoices {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return Empty, fmt.Errorf("the bucket answered %d: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return object, nil
+}
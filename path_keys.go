@@ -0,0 +1,336 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/address"
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// KeyJSON is what we store for a key on a curve other than the Ed448 of accounts
+type KeyJSON struct {
+	Curve      string    `json:"curve"`
+	PrivateKey string    `json:"private_key"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (key *KeyJSON) responseData(name string) (map[string]interface{}, error) {
+	privateKey, err := hexutil.Decode(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(privateKey)
+	publicKey, publicKeyPEM, err := util.CurvePublicKey(key.Curve, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"name":           name,
+		"curve":          key.Curve,
+		"public_key":     hexutil.Encode(publicKey),
+		"public_key_pem": publicKeyPEM,
+		"created_at":     key.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if key.Curve == util.CurveEd25519 {
+		result["stellar_account"] = util.StellarAccount(publicKey)
+	}
+	if xrplPublicKey, err := util.XRPLPublicKey(key.Curve, privateKey); err == nil {
+		result["xrpl_address"] = util.XRPLAddress(xrplPublicKey)
+	}
+	if key.Curve == util.CurveSecp256k1 {
+		evmAddress, err := util.EVMAddress(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		result["evm_address"] = address.FormatEthereum(evmAddress)
+		result["tron_address"] = address.FormatTron(evmAddress)
+	}
+	return result, nil
+}
+
+func keyPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("keys/?"),
+			Fields:  listPageSchema(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathKeysList,
+			},
+			HelpSynopsis: "List all the keys at a path.",
+			HelpDescription: `
+			All the secp256r1, secp256k1 and ed25519 keys will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("keys/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Generate, import, read or delete a secp256r1, secp256k1 or ed25519 key.",
+			HelpDescription: `
+
+Keep a key on a curve other than the Ed448 of Core accounts, for protocols and
+PKI that sign with NIST P-256 (secp256r1), secp256k1 or Ed25519. A key is
+generated unless private_key imports one: the 32 byte scalar of a secp256r1 or
+secp256k1 key or the 32 byte seed of an ed25519 key. Only the public key is
+ever returned, raw and as a PEM SubjectPublicKeyInfo, with the Stellar account
+of an ed25519 key and the XRP Ledger address of a secp256k1 or ed25519 key.
+
+Keys are not accounts: the transaction, token and policy paths of accounts do
+not use them. They sign data through keys/<name>/sign, Stellar transactions
+through keys/<name>/stellar/sign-tx, XRP Ledger transactions through
+keys/<name>/xrpl/sign-tx, and EVM and TRON transactions through
+keys/<name>/evm/sign-tx and keys/<name>/tron/sign-tx. A key has no tier,
+restrictions, group or canary; the mount freeze, the sanctions list and
+screening hold it, but the control group minimums, MFA, USD limits, anomaly
+rules, calldata rules and the policy hook only understand Core transactions,
+so while any of them is set a key signs nothing.
+Writing an existing key without private_key, or with its own, is a no-op; a
+different key under the same name is rejected.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the key."},
+				"curve": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{util.CurveSecp256r1, util.CurveSecp256k1, util.CurveEd25519},
+					Description:   "The curve of the key.",
+				},
+				"private_key": {
+					Type:        framework.TypeString,
+					Description: "The hex private key to import. If not provided, one is generated.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathKeyRead,
+				logical.CreateOperation: b.pathKeyWrite,
+				logical.UpdateOperation: b.pathKeyWrite,
+				logical.DeleteOperation: b.pathKeyDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("keys/" + framework.GenericNameRegex("name") + "/sign"),
+			HelpSynopsis: "Sign data with a secp256r1, secp256k1 or ed25519 key.",
+			HelpDescription: `
+
+Sign data with a key. The ECDSA keys return the ASN.1 DER signature of the
+SHA-256 of the data, as X.509 and WebAuthn verify it; secp256r1 nonces are
+drawn at random, so its signatures of the same data differ, and secp256k1
+nonces follow RFC 6979. An ed25519 key returns the 64 byte RFC 8032 signature
+of the data itself. The data may be a transaction of any chain, which is not
+decoded, so while screening_url or a sanctions list is set nothing is signed.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the key."},
+				"data": {
+					Type:        framework.TypeString,
+					Description: "The data to sign.",
+				},
+				"encoding": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{Utf8Encoding, HexEncoding},
+					Default:       Utf8Encoding,
+					Description:   "The encoding of the data to sign.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withKeyGuards(b.pathKeySign),
+				logical.UpdateOperation: b.withKeyGuards(b.pathKeySign),
+			},
+		},
+	}
+}
+
+func keyStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("keys/%s", name))
+}
+
+func readKey(ctx context.Context, req *logical.Request, name string) (*KeyJSON, error) {
+	entry, err := req.Storage.Get(ctx, keyStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: no key %s", ErrAccountNotFound, name)
+	}
+	var key KeyJSON
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (b *PluginBackend) pathKeysList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("keys/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(listPage(vals, data)), nil
+}
+
+func (b *PluginBackend) pathKeyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	key, err := readKey(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	responseData, err := key.responseData(name)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
+
+func (b *PluginBackend) pathKeyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	curve := data.Get("curve").(string)
+	switch curve {
+	case util.CurveSecp256r1, util.CurveSecp256k1, util.CurveEd25519:
+	case util.CurveEd448:
+		return nil, fmt.Errorf("%w: ed448 keys are accounts; create them under accounts/", ErrInvalidInput)
+	default:
+		return nil, fmt.Errorf("%w: curve must be %s, %s or %s", ErrInvalidInput, util.CurveSecp256r1, util.CurveSecp256k1, util.CurveEd25519)
+	}
+	existing, err := readKey(ctx, req, name)
+	if err != nil && !errors.Is(err, ErrAccountNotFound) {
+		return nil, err
+	}
+	privateKeyHex := data.Get("private_key").(string)
+	if existing != nil && privateKeyHex == Empty && existing.Curve == curve {
+		// writing a key without key material leaves it as it is
+		responseData, err := existing.responseData(name)
+		if err != nil {
+			return nil, err
+		}
+		return &logical.Response{
+			Data: responseData,
+		}, nil
+	}
+	var privateKey []byte
+	if privateKeyHex != Empty {
+		privateKey, err = hex.DecodeString(strings.TrimPrefix(privateKeyHex, "0x"))
+		if err != nil {
+			return nil, wrapError(ErrInvalidInput, err)
+		}
+		if _, _, err := util.CurvePublicKey(curve, privateKey); err != nil {
+			return nil, wrapError(ErrInvalidInput, err)
+		}
+	} else {
+		privateKey, err = util.GenerateCurveKey(curve)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer util.ZeroBytes(privateKey)
+	key := &KeyJSON{
+		Curve:      curve,
+		PrivateKey: hexutil.Encode(privateKey),
+		CreatedAt:  time.Now(),
+	}
+
+	if existing != nil {
+		if existing.Curve != key.Curve || existing.PrivateKey != key.PrivateKey {
+			return nil, fmt.Errorf("%w: key %s holds a different key", ErrAccountExists, name)
+		}
+		key = existing
+	} else {
+		entry, err := logical.StorageEntryJSON(keyStoragePath(name), key)
+		if err != nil {
+			return nil, err
+		}
+		entry.SealWrap = true
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+	responseData, err := key.responseData(name)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
+
+func (b *PluginBackend) pathKeyDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, keyStoragePath(data.Get("name").(string)))
+}
+
+func (b *PluginBackend) pathKeySign(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	key, err := readKey(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.refuseUnscreened(ctx, req, "raw data"); err != nil {
+		return nil, err
+	}
+	message := []byte(data.Get("data").(string))
+	if data.Get("encoding").(string) == HexEncoding {
+		message, err = util.Decode(message)
+		if err != nil {
+			return nil, wrapError(ErrInvalidInput, err)
+		}
+	}
+	privateKey, err := hexutil.Decode(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(privateKey)
+	signature, err := util.SignWithCurve(key.Curve, privateKey, message)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _, err := util.CurvePublicKey(key.Curve, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signature":  hexutil.Encode(signature),
+			"public_key": hexutil.Encode(publicKey),
+			"curve":      key.Curve,
+		},
+	}, nil
+}
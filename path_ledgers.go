@@ -0,0 +1,455 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/address"
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+func ledgerPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("keys/" + framework.GenericNameRegex("name") + "/stellar/sign-tx"),
+			HelpSynopsis: "Sign a Stellar transaction with an ed25519 key.",
+			HelpDescription: `
+
+Sign an unsigned v1 transaction envelope, base64 XDR as the Stellar SDKs
+encode it, for the network named by its passphrase. The signature of the
+transaction hash is returned with its hint and in a signed envelope ready to
+submit; to gather the signatures of a multisig account, sign the unsigned
+envelope with each key and combine them. Only the source account, fee and
+sequence number are decoded, so no account policy applies, and while
+screening_url or a sanctions list is set the transaction is refused: its
+destinations cannot be screened.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the key."},
+				"transaction_envelope": {
+					Type:        framework.TypeString,
+					Description: "The unsigned transaction envelope, base64 XDR.",
+				},
+				"network_passphrase": {
+					Type:        framework.TypeString,
+					Default:     util.StellarPublicNetwork,
+					Description: "The passphrase of the network the transaction is for.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withKeyGuards(b.pathStellarSignTx),
+				logical.UpdateOperation: b.withKeyGuards(b.pathStellarSignTx),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("keys/" + framework.GenericNameRegex("name") + "/xrpl/sign-tx"),
+			HelpSynopsis: "Sign an XRP Ledger transaction with a secp256k1 or ed25519 key.",
+			HelpDescription: `
+
+Sign a transaction in the canonical binary format of the XRP Ledger, hex as
+ripple-binary-codec encodes it. The transaction must carry the key's
+SigningPubKey, which reading the key returns with its address, and no
+TxnSignature. The signed transaction is returned ready to submit, with its
+hash. Only the SigningPubKey is decoded, so no account policy applies, and
+while screening_url or a sanctions list is set the transaction is refused:
+its destinations cannot be screened.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the key."},
+				"tx_blob": {
+					Type:        framework.TypeString,
+					Description: "The unsigned transaction, hex.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withKeyGuards(b.pathXRPLSignTx),
+				logical.UpdateOperation: b.withKeyGuards(b.pathXRPLSignTx),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("keys/" + framework.GenericNameRegex("name") + "/evm/sign-tx"),
+			HelpSynopsis: "Sign a transaction for an EVM chain with a secp256k1 key.",
+			HelpDescription: `
+
+Sign a transaction for the EVM chain of a chain profile - ethereum, bsc,
+polygon and the others chain-profiles/ lists. The profile sets the chain ID,
+which the signature commits to, and the gas model: on a legacy chain such as
+BSC pass gas_price, on an EIP-1559 one max_fee_per_gas and
+max_priority_fee_per_gas; the fields of the other model are refused rather
+than ignored. A chain_id that is passed must be the profile's. The raw
+transaction is returned ready to broadcast, with its hash. No account policy
+applies, but the recipient, and the address a token transfer, transferFrom or
+approve in the calldata sends to, are held to the sanctions list and the
+screening API; a key has no authorizations, so a destination at or above
+screening_approval_risk refuses the transaction.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name":    {Type: framework.TypeString, Description: "The name of the key."},
+				"profile": {Type: framework.TypeString, Description: "The chain profile of the transaction."},
+				"chain_id": {
+					Type:        framework.TypeString,
+					Description: "The chain ID the caller expects; it must be the profile's.",
+				},
+				"nonce":     {Type: framework.TypeString, Description: "The nonce of the transaction."},
+				"to":        {Type: framework.TypeString, Description: "The address the transaction is sent to; a contract creation if empty."},
+				"value":     {Type: framework.TypeString, Description: "The amount sent, in wei."},
+				"data":      {Type: framework.TypeString, Description: "The calldata, hex."},
+				"gas_limit": {Type: framework.TypeString, Description: "The gas limit of the transaction."},
+				"gas_price": {
+					Type:        framework.TypeString,
+					Description: "The gas price in wei, on legacy chains.",
+				},
+				"max_fee_per_gas": {
+					Type:        framework.TypeString,
+					Description: "The most paid per gas in wei, on EIP-1559 chains.",
+				},
+				"max_priority_fee_per_gas": {
+					Type:        framework.TypeString,
+					Description: "The tip per gas in wei, on EIP-1559 chains.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withKeyGuards(b.pathEVMSignTx),
+				logical.UpdateOperation: b.withKeyGuards(b.pathEVMSignTx),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("keys/" + framework.GenericNameRegex("name") + "/tron/sign-tx"),
+			HelpSynopsis: "Sign a TRON transaction with a secp256k1 key.",
+			HelpDescription: `
+
+Sign the raw_data of a TRON transaction, hex protobuf as TronWeb and the
+/wallet APIs return it in raw_data_hex. The transaction ID, the SHA-256 of
+raw_data, is returned with the signature to add to the transaction's
+signature list, and the base58check address of the key. The raw data is not
+decoded, so no account policy applies, and while screening_url or a sanctions
+list is set the transaction is refused: its destinations cannot be screened.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the key."},
+				"raw_data_hex": {
+					Type:        framework.TypeString,
+					Description: "The raw_data of the transaction, hex.",
+				},
+				"profile": {
+					Type:        framework.TypeString,
+					Default:     "tron",
+					Description: "The chain profile of the transaction: tron, tron-nile or tron-shasta.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withKeyGuards(b.pathTronSignTx),
+				logical.UpdateOperation: b.withKeyGuards(b.pathTronSignTx),
+			},
+		},
+	}
+}
+
+// readKeyMaterial returns a key for signing, with its decoded private key,
+// which the caller zeroes once it has signed
+func readKeyMaterial(ctx context.Context, req *logical.Request, name string) (*KeyJSON, []byte, error) {
+	key, err := readKey(ctx, req, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey, err := hexutil.Decode(key.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, privateKey, nil
+}
+
+func (b *PluginBackend) pathStellarSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	key, privateKey, err := readKeyMaterial(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(privateKey)
+	if key.Curve != util.CurveEd25519 {
+		return nil, fmt.Errorf("%w: Stellar transactions are signed with ed25519 keys, not %s", ErrInvalidInput, key.Curve)
+	}
+	envelope, err := base64.StdEncoding.DecodeString(data.Get("transaction_envelope").(string))
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	tx, err := util.ParseStellarEnvelope(envelope)
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	if err := b.refuseUnscreened(ctx, req, "Stellar transactions"); err != nil {
+		return nil, err
+	}
+	networkPassphrase := data.Get("network_passphrase").(string)
+	hash := util.StellarTransactionHash(networkPassphrase, tx.XDR)
+	noteDigest(ctx, hash)
+	signer := ed25519.NewKeyFromSeed(privateKey)
+	publicKey := []byte(signer.Public().(ed25519.PublicKey))
+	signature := ed25519.Sign(signer, hash)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"transaction_hash":   hex.EncodeToString(hash),
+			"signature":          base64.StdEncoding.EncodeToString(signature),
+			"hint":               base64.StdEncoding.EncodeToString(publicKey[len(publicKey)-4:]),
+			"signed_envelope":    base64.StdEncoding.EncodeToString(util.StellarSignedEnvelope(tx.XDR, publicKey, signature)),
+			"signer":             util.StellarAccount(publicKey),
+			"source_account":     tx.SourceAccount,
+			"fee":                tx.Fee,
+			"sequence_number":    fmt.Sprintf("%d", tx.SequenceNum),
+			"network_passphrase": networkPassphrase,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathXRPLSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	key, privateKey, err := readKeyMaterial(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(privateKey)
+	blob, err := hex.DecodeString(strings.TrimPrefix(data.Get("tx_blob").(string), "0x"))
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	if err := b.refuseUnscreened(ctx, req, "XRP Ledger transactions"); err != nil {
+		return nil, err
+	}
+	publicKey, err := util.XRPLPublicKey(key.Curve, privateKey)
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	signed, hash, err := util.XRPLSign(key.Curve, privateKey, blob)
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"transaction_hash":   strings.ToUpper(hex.EncodeToString(hash)),
+			"tx_blob":            strings.ToUpper(hex.EncodeToString(signed)),
+			"signing_public_key": strings.ToUpper(hex.EncodeToString(publicKey)),
+			"address":            util.XRPLAddress(publicKey),
+		},
+	}, nil
+}
+
+// readSecp256k1Key returns the private key of a key that signs for EVM chains and TRON
+func readSecp256k1Key(ctx context.Context, req *logical.Request, name string) ([]byte, error) {
+	key, privateKey, err := readKeyMaterial(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if key.Curve != util.CurveSecp256k1 {
+		util.ZeroBytes(privateKey)
+		return nil, fmt.Errorf("%w: EVM and TRON transactions are signed with secp256k1 keys, not %s", ErrInvalidInput, key.Curve)
+	}
+	return privateKey, nil
+}
+
+// evmTokenCalls are the token calls that send value to an address argument,
+// by selector, with the index of that argument
+var evmTokenCalls = map[string]int{
+	"a9059cbb": 0, // transfer(address,uint256)
+	"095ea7b3": 0, // approve(address,uint256)
+	"23b872dd": 1, // transferFrom(address,address,uint256)
+}
+
+// evmDestinations returns where an EVM transaction sends value: its recipient
+// and the address a token call in its calldata sends to
+func evmDestinations(to, data []byte) []string {
+	var addresses []string
+	if len(to) > 0 {
+		addresses = append(addresses, address.FormatEthereum(to))
+	}
+	if len(data) >= 4 {
+		index, ok := evmTokenCalls[hex.EncodeToString(data[:4])]
+		if end := 4 + 32*(index+1); ok && len(data) >= end {
+			addresses = append(addresses, address.FormatEthereum(data[end-20:end]))
+		}
+	}
+	return util.Dedup(addresses)
+}
+
+// parseQuantity parses an optional decimal field of a transaction
+func parseQuantity(data *framework.FieldData, field string) (*big.Int, error) {
+	quantity := util.ValidNumber(data.Get(field).(string))
+	if quantity == nil {
+		return nil, fmt.Errorf("%w: %s is not a number", ErrInvalidInput, field)
+	}
+	return quantity, nil
+}
+
+func (b *PluginBackend) pathEVMSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	profileName := data.Get("profile").(string)
+	profile, err := readChainProfile(profileName, familyEVM)
+	if err != nil {
+		return nil, err
+	}
+	chainID := big.NewInt(profile.ChainID)
+	if expected := data.Get("chain_id").(string); expected != Empty {
+		if parsed := util.ValidNumber(expected); parsed == nil || parsed.Cmp(chainID) != 0 {
+			return nil, fmt.Errorf("%w: the chain ID of %s is %s, not %s", ErrInvalidChainID, profileName, chainID, expected)
+		}
+	}
+	tx := &util.EVMTransaction{ChainID: chainID, DynamicFee: profile.GasModel == gasModelEIP1559}
+	var fees []string
+	if tx.DynamicFee {
+		fees = []string{"max_fee_per_gas", "max_priority_fee_per_gas"}
+		if data.Get("gas_price").(string) != Empty {
+			return nil, fmt.Errorf("%w: %s prices gas with EIP-1559 fees; pass max_fee_per_gas and max_priority_fee_per_gas, not gas_price", ErrInvalidInput, profileName)
+		}
+	} else {
+		fees = []string{"gas_price"}
+		if data.Get("max_fee_per_gas").(string) != Empty || data.Get("max_priority_fee_per_gas").(string) != Empty {
+			return nil, fmt.Errorf("%w: %s prices gas with a legacy gas price; pass gas_price, not EIP-1559 fees", ErrInvalidInput, profileName)
+		}
+	}
+	for _, field := range append(fees, "gas_limit") {
+		if data.Get(field).(string) == Empty {
+			return nil, fmt.Errorf("%w: %s is required for %s", ErrInvalidInput, field, profileName)
+		}
+	}
+	quantities := map[string]*big.Int{}
+	for _, field := range append(fees, "nonce", "gas_limit", "value") {
+		if quantities[field], err = parseQuantity(data, field); err != nil {
+			return nil, err
+		}
+	}
+	if !quantities["nonce"].IsUint64() || !quantities["gas_limit"].IsUint64() {
+		return nil, fmt.Errorf("%w: the nonce and gas limit must fit in 64 bits", ErrInvalidInput)
+	}
+	tx.Nonce = quantities["nonce"].Uint64()
+	tx.GasLimit = quantities["gas_limit"].Uint64()
+	tx.Value = quantities["value"]
+	tx.GasPrice = quantities["gas_price"]
+	tx.MaxFeePerGas = quantities["max_fee_per_gas"]
+	tx.MaxPriorityFeePerGas = quantities["max_priority_fee_per_gas"]
+	if tx.DynamicFee && tx.MaxPriorityFeePerGas.Cmp(tx.MaxFeePerGas) > 0 {
+		return nil, fmt.Errorf("%w: max_priority_fee_per_gas is more than max_fee_per_gas", ErrInvalidInput)
+	}
+	if to := data.Get("to").(string); to != Empty {
+		if tx.To, err = address.ParseEthereum(to); err != nil {
+			return nil, wrapError(ErrInvalidAddress, err)
+		}
+	}
+	if tx.Data, err = hex.DecodeString(strings.TrimPrefix(data.Get("data").(string), "0x")); err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	noteChain(ctx, profileName)
+	if err := b.checkKeyDestinations(ctx, req, chainID.String(), evmDestinations(tx.To, tx.Data)); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := readSecp256k1Key(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(privateKey)
+	from, err := util.EVMAddress(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	signed, hash, err := util.SignEVMTransaction(privateKey, tx)
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	noteDigest(ctx, hash)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"transaction_hash":   hexutil.Encode(hash),
+			"signed_transaction": hexutil.Encode(signed),
+			"from":               address.FormatEthereum(from),
+			"profile":            profileName,
+			"chain_id":           chainID.String(),
+			"gas_model":          profile.GasModel,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathTronSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	profileName := data.Get("profile").(string)
+	if _, err := readChainProfile(profileName, familyTron); err != nil {
+		return nil, err
+	}
+	rawData, err := hex.DecodeString(strings.TrimPrefix(data.Get("raw_data_hex").(string), "0x"))
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	if len(rawData) == 0 {
+		return nil, fmt.Errorf("%w: raw_data_hex is required", ErrInvalidInput)
+	}
+	if err := b.refuseUnscreened(ctx, req, "TRON transactions"); err != nil {
+		return nil, err
+	}
+	privateKey, err := readSecp256k1Key(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(privateKey)
+	from, err := util.EVMAddress(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	txID, signature, err := util.SignTronTransaction(privateKey, rawData)
+	if err != nil {
+		return nil, err
+	}
+	noteDigest(ctx, txID)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"transaction_id": hex.EncodeToString(txID),
+			"signature":      hex.EncodeToString(signature),
+			"owner_address":  address.FormatTron(from),
+			"profile":        profileName,
+		},
+	}, nil
+}
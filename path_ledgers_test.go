@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestKeySigningIsScreened(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	handle := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+	if resp, err := handle("keys/evm", map[string]interface{}{"curve": "secp256k1"}); refused(resp, err) {
+		t.Fatalf("key: %v %v", err, resp)
+	}
+	sanctioned := "0x1111111111111111111111111111111111111111"
+	signTx := func(data string) (*logical.Response, error) {
+		return handle("keys/evm/evm/sign-tx", map[string]interface{}{
+			"profile":                  "ethereum",
+			"nonce":                    "0",
+			"to":                       "0x2222222222222222222222222222222222222222",
+			"value":                    "0",
+			"data":                     data,
+			"gas_limit":                "60000",
+			"max_fee_per_gas":          "2",
+			"max_priority_fee_per_gas": "1",
+		})
+	}
+	transfer := "a9059cbb" + strings.Repeat("0", 24) + strings.TrimPrefix(sanctioned, "0x") + strings.Repeat("0", 63) + "1"
+	if resp, err := signTx(transfer); refused(resp, err) {
+		t.Fatalf("a token transfer was refused with no sanctions list: %v %v", err, resp)
+	}
+	if resp, err := handle("sanctions", map[string]interface{}{"addresses": []string{sanctioned}}); refused(resp, err) {
+		t.Fatalf("sanctions: %v %v", err, resp)
+	}
+	if resp, err := signTx(transfer); !refused(resp, err) {
+		t.Fatal("a token transfer to a sanctioned address was signed")
+	}
+	if resp, err := signTx(Empty); refused(resp, err) {
+		t.Fatalf("a transaction to an address that is not sanctioned was refused: %v %v", err, resp)
+	}
+	if resp, err := handle("keys/evm/tron/sign-tx", map[string]interface{}{"raw_data_hex": "0a02"}); !refused(resp, err) {
+		t.Fatal("a TRON transaction, whose destinations are not decoded, was signed while a sanctions list is set")
+	}
+	if resp, err := handle("keys/evm/sign", map[string]interface{}{"data": "raw"}); !refused(resp, err) {
+		t.Fatal("raw data was signed while a sanctions list is set")
+	}
+}
+
+// refused reports whether a request failed, as an error or as the error
+// response a handler's error becomes
+func refused(resp *logical.Response, err error) bool {
+	return err != nil || resp.IsError() || (resp != nil && resp.Data[logical.HTTPStatusCode] != nil)
+}
+
+func TestKeysRefuseAccountPolicies(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	handle := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+	if resp, err := handle("keys/p256", map[string]interface{}{"curve": "secp256r1"}); refused(resp, err) {
+		t.Fatalf("key: %v %v", err, resp)
+	}
+	if resp, err := handle("keys/p256/sign", map[string]interface{}{"data": "raw"}); refused(resp, err) {
+		t.Fatalf("sign: %v %v", err, resp)
+	}
+	if resp, err := handle("config", map[string]interface{}{"policy_hook_url": "http://127.0.0.1:1/v1/data/allow"}); refused(resp, err) {
+		t.Fatalf("config: %v %v", err, resp)
+	}
+	if resp, err := handle("keys/p256/sign", map[string]interface{}{"data": "raw"}); !refused(resp, err) {
+		t.Fatal("a key signed while a policy hook it cannot consult is set")
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/core/types"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	mfaTOTP    string = "totp"
+	mfaWebhook string = "webhook"
+
+	// DefaultMFAWebhookTimeout bounds a call to the MFA webhook, in seconds,
+	// long enough for a push approval on a phone
+	DefaultMFAWebhookTimeout int = 30
+	// totpSecretLength is the size of an enrolled TOTP secret, in bytes
+	totpSecretLength int = 20
+	// totpIssuer names the mount in authenticator apps
+	totpIssuer string = "vault-core"
+)
+
+// mfaLock serializes TOTP checks, so a code cannot be used twice
+var mfaLock sync.Mutex
+
+// mfaCodeSchema is the field a request passes its step-up code in
+var mfaCodeSchema = &framework.FieldSchema{
+	Type:        framework.TypeString,
+	Description: "The current code of the caller's TOTP key, or the code the MFA webhook expects, when the transaction needs a step-up.",
+}
+
+// TOTPEnrollmentJSON is the TOTP key of an identity entity
+type TOTPEnrollmentJSON struct {
+	EntityID  string    `json:"entity_id"`
+	Secret    []byte    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastStep is the time step of the last code used, which cannot be used again
+	LastStep uint64 `json:"last_step"`
+}
+
+func (enrollment *TOTPEnrollmentJSON) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"entity_id":  enrollment.EntityID,
+		"created_at": enrollment.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// mfaInput is what the MFA webhook is asked to challenge
+type mfaInput struct {
+	EntityID string `json:"entity_id,omitempty"`
+	Account  string `json:"account"`
+	Path     string `json:"path"`
+	Chain    string `json:"chain,omitempty"`
+	ChainID  string `json:"chain_id"`
+	To       string `json:"to,omitempty"`
+	Amount   string `json:"amount"`
+	Code     string `json:"mfa_code,omitempty"`
+}
+
+func mfaPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("mfa/totp/?"),
+			HelpSynopsis: "Enroll the caller's TOTP key, or list the entities that enrolled one.",
+			HelpDescription: `
+
+Enroll a TOTP key for the identity entity of the caller. The secret and an
+otpauth:// URL for an authenticator app are returned once and never again.
+When mfa_method is totp, transactions that need a step-up are signed only
+with a current code of the requester's key in mfa_code, and each code is
+used once. An entity that has a key cannot enroll another; an operator
+deletes the old one through mfa/totp/<entity_id> first.
+
+`,
+			Fields: listPageSchema(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation:   b.pathTOTPList,
+				logical.UpdateOperation: b.pathTOTPEnroll,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("mfa/totp/" + framework.GenericNameRegex("entity_id")),
+			HelpSynopsis: "Return whether an entity has enrolled a TOTP key, or delete its key.",
+			Fields: map[string]*framework.FieldSchema{
+				"entity_id": {Type: framework.TypeString, Description: "The ID of the identity entity."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathTOTPRead,
+				logical.DeleteOperation: b.pathTOTPDelete,
+			},
+		},
+	}
+}
+
+func totpStoragePath(entityID string) string {
+	return QualifiedPath(fmt.Sprintf("mfa/totp/%s", entityID))
+}
+
+func readTOTPEnrollment(ctx context.Context, s logical.Storage, entityID string) (*TOTPEnrollmentJSON, error) {
+	entry, err := s.Get(ctx, totpStoragePath(entityID))
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	var enrollment TOTPEnrollmentJSON
+	if err := entry.DecodeJSON(&enrollment); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+func writeTOTPEnrollment(ctx context.Context, s logical.Storage, enrollment *TOTPEnrollmentJSON) error {
+	entry, err := logical.StorageEntryJSON(totpStoragePath(enrollment.EntityID), enrollment)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func (b *PluginBackend) pathTOTPEnroll(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	if req.EntityID == Empty {
+		return nil, fmt.Errorf("%w: a TOTP key is enrolled by an identity entity", ErrInvalidInput)
+	}
+	mfaLock.Lock()
+	defer mfaLock.Unlock()
+	existing, err := readTOTPEnrollment(ctx, req.Storage, req.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: entity %s has already enrolled a TOTP key", ErrInvalidInput, req.EntityID)
+	}
+	secret := make([]byte, totpSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	enrollment := &TOTPEnrollmentJSON{
+		EntityID:  req.EntityID,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := writeTOTPEnrollment(ctx, req.Storage, enrollment); err != nil {
+		return nil, err
+	}
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	query := url.Values{}
+	query.Set("secret", encoded)
+	query.Set("issuer", totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(util.TOTPDigits))
+	query.Set("period", fmt.Sprint(util.TOTPPeriod))
+	otpURL := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + totpIssuer + ":" + req.EntityID, RawQuery: query.Encode()}
+	responseData := enrollment.responseData()
+	responseData["secret"] = encoded
+	responseData["url"] = otpURL.String()
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
+
+func (b *PluginBackend) pathTOTPList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ids, err := req.Storage.List(ctx, QualifiedPath("mfa/totp/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(listPage(ids, data)), nil
+}
+
+func (b *PluginBackend) pathTOTPRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	enrollment, err := readTOTPEnrollment(ctx, req.Storage, data.Get("entity_id").(string))
+	if err != nil || enrollment == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: enrollment.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathTOTPDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	mfaLock.Lock()
+	defer mfaLock.Unlock()
+	return nil, req.Storage.Delete(ctx, totpStoragePath(data.Get("entity_id").(string)))
+}
+
+// checkMFA holds a transaction at or above mfa_min_amount, or worth
+// mfa_min_usd or more, or any transaction when neither is set, to a step-up
+// of the requester through mfa_method. Several transactions of one request
+// share a step-up.
+func (b *PluginBackend) checkMFA(ctx context.Context, scope *signingScope, config *ConfigJSON, tx *types.Transaction, call *DecodedCall) error {
+	if config.MFAMethod == Empty {
+		return nil
+	}
+	recorder := decisionFromContext(ctx)
+	if recorder != nil {
+		recorder.Lock()
+		passed := recorder.mfa
+		recorder.Unlock()
+		if passed != Empty {
+			return nil
+		}
+	}
+	if config.MFAMinAmount != Empty || config.MFAMinUSD != Empty {
+		risky, err := b.atOrAbove(ctx, config, tx, call, config.MFAMinAmount, config.MFAMinUSD)
+		if err != nil || !risky {
+			return err
+		}
+	}
+	code, _ := scope.req.Data["mfa_code"].(string)
+	var err error
+	switch config.MFAMethod {
+	case mfaTOTP:
+		err = verifyTOTP(ctx, scope.req, code)
+	case mfaWebhook:
+		input := &mfaInput{
+			EntityID: scope.req.EntityID,
+			Account:  scope.account,
+			Path:     scope.req.Path,
+			ChainID:  config.ChainID,
+			Amount:   tx.Value().String(),
+			Code:     code,
+		}
+		if recorder != nil {
+			recorder.Lock()
+			input.Chain = recorder.chain
+			recorder.Unlock()
+		}
+		if tx.To() != nil {
+			input.To = tx.To().Hex()
+		}
+		err = b.askMFAWebhook(ctx, config, input)
+	}
+	recordRule(ctx, "mfa", err)
+	if err == nil && recorder != nil {
+		recorder.Lock()
+		recorder.mfa = config.MFAMethod
+		recorder.Unlock()
+	}
+	return err
+}
+
+// verifyTOTP accepts a code of the requester's TOTP key for the current time
+// step or the one on either side of it, once
+func verifyTOTP(ctx context.Context, req *logical.Request, code string) error {
+	if code == Empty {
+		return fmt.Errorf("%w: pass a current code of your TOTP key as mfa_code", ErrMFARequired)
+	}
+	if req.EntityID == Empty {
+		return fmt.Errorf("%w: a TOTP step-up needs an identity entity", ErrMFARequired)
+	}
+	mfaLock.Lock()
+	defer mfaLock.Unlock()
+	enrollment, err := readTOTPEnrollment(ctx, req.Storage, req.EntityID)
+	if err != nil {
+		return err
+	}
+	if enrollment == nil {
+		return fmt.Errorf("%w: entity %s has not enrolled a TOTP key through mfa/totp", ErrMFARequired, req.EntityID)
+	}
+	now := util.TOTPStep(time.Now())
+	for step := now - 1; step <= now+1; step++ {
+		if step <= enrollment.LastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(util.TOTP(enrollment.Secret, step)), []byte(code)) == 1 {
+			enrollment.LastStep = step
+			return writeTOTPEnrollment(ctx, req.Storage, enrollment)
+		}
+	}
+	return fmt.Errorf("%w: mfa_code is wrong, expired or already used", ErrMFARequired)
+}
+
+// askMFAWebhook posts the transaction to mfa_webhook_url, which challenges
+// the requester, by a push to Duo for example, and answers {"allow": true}
+// once they approve it. Any other answer, or none, refuses the transaction.
+func (b *PluginBackend) askMFAWebhook(ctx context.Context, config *ConfigJSON, input *mfaInput) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	timeout := DefaultMFAWebhookTimeout
+	if config.MFAWebhookTimeout > 0 {
+		timeout = config.MFAWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, config.MFAWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		b.Logger().Error("MFA webhook failed; refusing to sign", "url", config.MFAWebhookURL, "error", err)
+		return wrapError(ErrMFARequired, err)
+	}
+	defer response.Body.Close()
+	answer, err := ioutil.ReadAll(io.LimitReader(response.Body, maxExternalResponse))
+	if err != nil {
+		return wrapError(ErrMFARequired, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: the MFA webhook answered status %d", ErrMFARequired, response.StatusCode)
+	}
+	var result struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(answer, &result); err != nil {
+		return fmt.Errorf("%w: cannot decode the answer of the MFA webhook: %v", ErrMFARequired, err)
+	}
+	if !result.Allow {
+		if result.Reason != Empty {
+			return fmt.Errorf("%w: the step-up was refused: %s", ErrMFARequired, result.Reason)
+		}
+		return fmt.Errorf("%w: the step-up was refused", ErrMFARequired)
+	}
+	return nil
+}
@@ -0,0 +1,474 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/tyler-smith/go-bip39"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// maxDeriveRange bounds the accounts one derive-range request creates
+	maxDeriveRange int = 10000
+	// maxDeriveWorkers bounds the parallel workers of a derive-range request
+	maxDeriveWorkers int = 32
+	// deriveCheckpoint is how many accounts are derived between two writes of the progress
+	deriveCheckpoint int = 100
+
+	// DeriveRunning is the state of a derive-range that has not finished
+	DeriveRunning string = "running"
+	// DeriveDone is the state of a derive-range that created every account of its range
+	DeriveDone string = "done"
+	// DeriveFailed is the state of a derive-range that could not create some accounts
+	DeriveFailed string = "failed"
+)
+
+// MnemonicJSON is a stored mnemonic that accounts are derived from
+type MnemonicJSON struct {
+	Mnemonic  string    `json:"mnemonic"`
+	CreatedAt time.Time `json:"created_at"`
+	// NextIndex is the index after the last range derived in full
+	NextIndex int `json:"next_index"`
+}
+
+// DeriveJobJSON is the progress of the last derive-range of a mnemonic
+type DeriveJobJSON struct {
+	Start     int               `json:"start"`
+	Count     int               `json:"count"`
+	Prefix    string            `json:"prefix"`
+	Workers   int               `json:"workers"`
+	State     string            `json:"state"`
+	Derived   int               `json:"derived"`
+	Existing  int               `json:"existing"`
+	Failed    map[string]string `json:"failed"`
+	StartedAt time.Time         `json:"started_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+func (job *DeriveJobJSON) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"start":      job.Start,
+		"count":      job.Count,
+		"prefix":     job.Prefix,
+		"workers":    job.Workers,
+		"state":      job.State,
+		"derived":    job.Derived,
+		"existing":   job.Existing,
+		"failed":     job.Failed,
+		"remaining":  job.Count - job.Derived - job.Existing - len(job.Failed),
+		"started_at": job.StartedAt.Format(time.RFC3339),
+		"updated_at": job.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func mnemonicStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("mnemonics/%s", name))
+}
+
+func deriveJobStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("derive-jobs/%s", name))
+}
+
+// deriveLocks keeps two derive-range requests of one mnemonic from running at once
+var deriveLocks sync.Map
+
+func mnemonicPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("mnemonics/?"),
+			HelpSynopsis: "List the mnemonics accounts are derived from.",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathMnemonicsList,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("mnemonics/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Create, read or delete a mnemonic that accounts are derived from.",
+			HelpDescription: `
+
+Keep a mnemonic to derive many accounts from with derive-range. The mnemonic
+is generated unless one is supplied, and is never returned. Every account
+derived from it holds its own copy, so deleting the mnemonic leaves them as
+they are.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the mnemonic."},
+				"mnemonic": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "The BIP-39 mnemonic; generated if unset.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathMnemonicRead,
+				logical.CreateOperation: b.pathMnemonicCreate,
+				logical.DeleteOperation: b.pathMnemonicDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("mnemonics/" + framework.GenericNameRegex("name") + "/derive-range"),
+			HelpSynopsis: "Derive a range of accounts from a mnemonic in parallel.",
+			HelpDescription: `
+
+Create the accounts <prefix>-<index> for count indexes from start, deriving
+them from the mnemonic in parallel workers. The seed is stretched from the
+mnemonic once for the whole range rather than once per account. Progress is
+written every 100 accounts and can be read from this path while the request
+runs. A request that is interrupted resumes when it is made again: accounts
+of the range that already exist with the derived address are counted as
+existing and skipped. Unless start is given, the range starts after the last
+range that was derived in full.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the mnemonic."},
+				"start": {
+					Type:        framework.TypeInt,
+					Default:     -1,
+					Description: "The first index to derive; after the last range derived in full if unset.",
+				},
+				"count": {
+					Type:        framework.TypeInt,
+					Description: fmt.Sprintf("The number of accounts to derive, at most %d.", maxDeriveRange),
+				},
+				"prefix": {
+					Type:        framework.TypeString,
+					Description: "The prefix of the names of the accounts; the name of the mnemonic if unset.",
+				},
+				"workers": {
+					Type:        framework.TypeInt,
+					Default:     0,
+					Description: fmt.Sprintf("The parallel workers, at most %d; the number of CPUs if unset.", maxDeriveWorkers),
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathDeriveRangeRead,
+				logical.UpdateOperation: b.pathDeriveRange,
+			},
+		},
+	}
+}
+
+func readMnemonic(ctx context.Context, s logical.Storage, name string) (*MnemonicJSON, error) {
+	entry, err := s.Get(ctx, mnemonicStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var mnemonic MnemonicJSON
+	if err := entry.DecodeJSON(&mnemonic); err != nil {
+		return nil, err
+	}
+	return &mnemonic, nil
+}
+
+func writeMnemonic(ctx context.Context, s logical.Storage, name string, mnemonic *MnemonicJSON) error {
+	entry, err := logical.StorageEntryJSON(mnemonicStoragePath(name), mnemonic)
+	if err != nil {
+		return err
+	}
+	entry.SealWrap = true
+	return s.Put(ctx, entry)
+}
+
+func readDeriveJob(ctx context.Context, s logical.Storage, name string) (*DeriveJobJSON, error) {
+	entry, err := s.Get(ctx, deriveJobStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var job DeriveJobJSON
+	if err := entry.DecodeJSON(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func writeDeriveJob(ctx context.Context, s logical.Storage, name string, job *DeriveJobJSON) error {
+	job.UpdatedAt = time.Now().UTC()
+	entry, err := logical.StorageEntryJSON(deriveJobStoragePath(name), job)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func (b *PluginBackend) pathMnemonicsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("mnemonics/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathMnemonicRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	mnemonic, err := readMnemonic(ctx, req.Storage, name)
+	if err != nil || mnemonic == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":       name,
+			"created_at": mnemonic.CreatedAt.Format(time.RFC3339),
+			"next_index": mnemonic.NextIndex,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathMnemonicCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	phrase := data.Get("mnemonic").(string)
+	if phrase == Empty {
+		entropy, err := bip39.NewEntropy(128)
+		if err != nil {
+			return nil, err
+		}
+		if phrase, err = bip39.NewMnemonic(entropy); err != nil {
+			return nil, err
+		}
+	}
+	if !bip39.IsMnemonicValid(phrase) {
+		return nil, fmt.Errorf("%w: mnemonic is not a BIP-39 mnemonic", ErrInvalidInput)
+	}
+	mnemonic := &MnemonicJSON{Mnemonic: phrase, CreatedAt: time.Now().UTC()}
+	if err := writeMnemonic(ctx, req.Storage, name, mnemonic); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":       name,
+			"created_at": mnemonic.CreatedAt.Format(time.RFC3339),
+			"next_index": mnemonic.NextIndex,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathMnemonicDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	if err := req.Storage.Delete(ctx, deriveJobStoragePath(name)); err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, mnemonicStoragePath(name))
+}
+
+func (b *PluginBackend) pathDeriveRangeRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	job, err := readDeriveJob(ctx, req.Storage, data.Get("name").(string))
+	if err != nil || job == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: job.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathDeriveRange(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, err := b.configured(ctx, req); err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	lock, _ := deriveLocks.LoadOrStore(name, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	mnemonic, err := readMnemonic(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if mnemonic == nil {
+		return nil, fmt.Errorf("%w: mnemonic %s", ErrInvalidInput, name)
+	}
+	start := data.Get("start").(int)
+	if start < 0 {
+		start = mnemonic.NextIndex
+	}
+	count := data.Get("count").(int)
+	if count < 1 || count > maxDeriveRange {
+		return nil, fmt.Errorf("%w: count must be 1 to %d", ErrInvalidInput, maxDeriveRange)
+	}
+	prefix := data.Get("prefix").(string)
+	if prefix == Empty {
+		prefix = name
+	}
+	workers := data.Get("workers").(int)
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > maxDeriveWorkers {
+		workers = maxDeriveWorkers
+	}
+	job := &DeriveJobJSON{
+		Start:     start,
+		Count:     count,
+		Prefix:    prefix,
+		Workers:   workers,
+		State:     DeriveRunning,
+		Failed:    map[string]string{},
+		StartedAt: time.Now().UTC(),
+	}
+	if err := writeDeriveJob(ctx, req.Storage, name, job); err != nil {
+		return nil, err
+	}
+
+	// the seed is stretched once for the whole range
+	kdfDone := timed(ctx, kdfTime)
+	hdwallet, err := util.NewHDWallet(mnemonic.Mnemonic)
+	kdfDone()
+	if err != nil {
+		return nil, err
+	}
+	defer hdwallet.Zero()
+	indexes := make(chan int)
+	var progress sync.Mutex
+	// claimLock makes checking that an address is free and claiming it one step
+	var claimLock sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				existing, err := b.deriveAccount(ctx, req, hdwallet, mnemonic.Mnemonic, prefix, index, &claimLock)
+				progress.Lock()
+				switch {
+				case err != nil:
+					job.Failed[fmt.Sprint(index)] = err.Error()
+				case existing:
+					job.Existing++
+				default:
+					job.Derived++
+				}
+				done := job.Derived + job.Existing + len(job.Failed)
+				var checkpointErr error
+				if done%deriveCheckpoint == 0 {
+					b.Logger().Info("deriving accounts", "mnemonic", name, "done", done, "of", count)
+					checkpointErr = writeDeriveJob(ctx, req.Storage, name, job)
+				}
+				progress.Unlock()
+				if checkpointErr != nil {
+					b.Logger().Warn("cannot record the progress of a derivation", "mnemonic", name, "error", checkpointErr)
+				}
+			}
+		}()
+	}
+	for index := start; index < start+count; index++ {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	job.State = DeriveDone
+	if len(job.Failed) > 0 {
+		job.State = DeriveFailed
+	}
+	if err := writeDeriveJob(ctx, req.Storage, name, job); err != nil {
+		return nil, err
+	}
+	if job.State == DeriveDone && start+count > mnemonic.NextIndex {
+		mnemonic.NextIndex = start + count
+		if err := writeMnemonic(ctx, req.Storage, name, mnemonic); err != nil {
+			return nil, err
+		}
+	}
+	b.Logger().Info("derived accounts", "mnemonic", name, "derived", job.Derived, "existing", job.Existing, "failed", len(job.Failed))
+	resp := &logical.Response{
+		Data: job.responseData(),
+	}
+	if len(job.Failed) > 0 {
+		failed := make([]string, 0, len(job.Failed))
+		for index := range job.Failed {
+			failed = append(failed, index)
+		}
+		sort.Strings(failed)
+		resp.AddWarning(fmt.Sprintf("%d accounts could not be derived, at indexes %v; derive the range again to retry them", len(failed), failed))
+	}
+	return resp, nil
+}
+
+// deriveAccount creates the account of one index of a range, and reports
+// whether it already existed with the derived address
+func (b *PluginBackend) deriveAccount(ctx context.Context, req *logical.Request, hdwallet *util.HDWallet, mnemonic, prefix string, index int, claimLock *sync.Mutex) (bool, error) {
+	name := fmt.Sprintf("%s-%d", prefix, index)
+	wallet, err := deriveKeyWallet(hdwallet, index)
+	if err != nil {
+		return false, err
+	}
+	account := wallet.account
+	entry, err := req.Storage.Get(ctx, QualifiedPath("accounts/"+name))
+	if err != nil {
+		return false, err
+	}
+	if entry != nil {
+		var stored AccountJSON
+		if err := entry.DecodeJSON(&stored); err != nil {
+			return false, err
+		}
+		if address, err := common.HexToAddress(stored.Address); err == nil && address == account.Address {
+			return true, nil
+		}
+		return false, fmt.Errorf("%w: %s holds a different key", ErrAccountExists, name)
+	}
+	claimLock.Lock()
+	err = b.checkDuplicateAccount(ctx, req, account.Address, name)
+	if err == nil {
+		err = b.indexAccount(ctx, req, account.Address, name)
+	}
+	claimLock.Unlock()
+	if err != nil {
+		return false, err
+	}
+	accountJSON := &AccountJSON{
+		Index:    index,
+		Mnemonic: mnemonic,
+		Address:  account.Address.Hex(),
+	}
+	if err := b.updateAccount(ctx, req, name, accountJSON); err != nil {
+		if unindexErr := b.unindexAccount(ctx, req, account.Address); unindexErr != nil {
+			b.Logger().Warn("cannot release the address of an account that was not derived", "name", name, "error", unindexErr)
+		}
+		return false, err
+	}
+	b.recordActivity(ctx, req, name, &ActivityJSON{Event: activityCreated}, nil, nil)
+	return false, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// probeMnemonic is the BIP-39 test mnemonic
+const probeMnemonic string = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func newTestBackend(t *testing.T) (*PluginBackend, logical.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+	config := &logical.BackendConfig{StorageView: storage}
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data:      map[string]interface{}{"rpc_url": "http://127.0.0.1:1", "chain_id": "3"},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("config: %v %v", err, resp)
+	}
+	return b, storage
+}
+
+func TestDeriveRangeDistinctAddresses(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "mnemonics/probe",
+		Storage:   storage,
+		Data:      map[string]interface{}{"mnemonic": probeMnemonic},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("mnemonic: %v %v", err, resp)
+	}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "mnemonics/probe/derive-range",
+		Storage:   storage,
+		Data:      map[string]interface{}{"count": 2, "start": 0},
+	}
+	resp, err = b.HandleRequest(ctx, req)
+	if err != nil || resp.Data[logical.HTTPStatusCode] != nil {
+		t.Fatalf("derive-range: %v %v", err, resp)
+	}
+	first, err := readAccount(ctx, req, "probe-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := readAccount(ctx, req, "probe-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Address == second.Address {
+		t.Fatalf("indexes 0 and 1 derived the same address %s", first.Address)
+	}
+}
+
+func TestDeriveIndexesDistinctAddresses(t *testing.T) {
+	_, first, err := getWalletAndAccount(context.Background(), AccountJSON{Mnemonic: probeMnemonic, Index: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := getWalletAndAccount(context.Background(), AccountJSON{Mnemonic: probeMnemonic, Index: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Address == second.Address {
+		t.Fatalf("indexes 0 and 1 derived the same address %s", first.Address.Hex())
+	}
+}
+
+func TestZeroKeyAddressRefused(t *testing.T) {
+	// the address go-core-hdwallet v0.0.1 recorded for every derived account
+	zero := keyWalletFor(&eddsa.PrivateKey{})
+	accountJSON := AccountJSON{Mnemonic: probeMnemonic, Address: zero.account.Address.Hex()}
+	if _, _, err := getWalletAndAccount(context.Background(), accountJSON); !errors.Is(err, ErrKeystoreDecrypt) {
+		t.Fatalf("an account recording the zero key's address was not refused: %v", err)
+	}
+	accountJSON.Address = Empty
+	_, account, err := getWalletAndAccount(context.Background(), accountJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Address == zero.account.Address {
+		t.Fatal("the mnemonic derived the zero key")
+	}
+}
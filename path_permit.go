@@ -0,0 +1,361 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/core-coin/go-core/accounts/abi"
+	"github.com/core-coin/go-core/accounts/abi/bind"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/common/math"
+	"github.com/core-coin/go-core/crypto"
+	"github.com/core-coin/go-core/signer/core"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// PermitEIP2612 is the permit of EIP-2612: a value with a deadline
+	PermitEIP2612 string = "eip2612"
+	// PermitDAI is the permit of the DAI token: all or nothing with an expiry
+	PermitDAI string = "dai"
+
+	defaultPermitVersion string = "1"
+)
+
+// permitABI holds the views of a token that permit signing reads
+const permitABI = `[
+	{"constant":true,"inputs":[{"name":"owner","type":"address"}],"name":"nonces","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[],"name":"version","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[],"name":"DOMAIN_SEPARATOR","outputs":[{"name":"","type":"bytes32"}],"stateMutability":"view","type":"function"}
+]`
+
+var permitDomainType = []core.Type{
+	{Name: "name", Type: "string"},
+	{Name: "version", Type: "string"},
+	{Name: "networkId", Type: "uint256"},
+	{Name: "verifyingContract", Type: "address"},
+}
+
+var permitTypes = map[string][]core.Type{
+	PermitEIP2612: {
+		{Name: "owner", Type: "address"},
+		{Name: "spender", Type: "address"},
+		{Name: "value", Type: "uint256"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "deadline", Type: "uint256"},
+	},
+	PermitDAI: {
+		{Name: "holder", Type: "address"},
+		{Name: "spender", Type: "address"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+		{Name: "allowed", Type: "bool"},
+	},
+}
+
+func permitPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      ContractPath(erc20Contract, "permit"),
+			HelpSynopsis: "Sign a permit for an ERC-20 token",
+			HelpDescription: `
+
+Build and sign the typed data of a permit, so that the spender can submit the
+approval on chain and pay for it. The style is eip2612 (owner, spender, value,
+nonce, deadline) or dai (holder, spender, nonce, expiry, allowed).
+
+The nonce, the token name and its version are read from the token when they
+are not given; a token without version() is taken to be version 1. When the
+token is reachable its DOMAIN_SEPARATOR() is checked against the one built
+here. Nothing is broadcast.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"contract": {
+					Type:        framework.TypeString,
+					Description: "The address of the ERC-20 token.",
+				},
+				"spender": {
+					Type:        framework.TypeString,
+					Description: "The address of the spender.",
+				},
+				"value": {
+					Type:        framework.TypeString,
+					Default:     "0",
+					Description: "The allowance in the token's smallest unit (eip2612).",
+				},
+				"deadline": {
+					Type:        framework.TypeString,
+					Description: "The unix time after which the permit is void; the expiry for dai, where 0 never expires.",
+				},
+				"allowed": {
+					Type:        framework.TypeBool,
+					Default:     true,
+					Description: "Whether the permit grants or revokes the allowance (dai).",
+				},
+				"nonce": {
+					Type:        framework.TypeString,
+					Description: "The permit nonce of the account; read from the token if unset.",
+				},
+				"token_name": {
+					Type:        framework.TypeString,
+					Description: "The name in the token's domain; read from the token if unset.",
+				},
+				"token_version": {
+					Type:        framework.TypeString,
+					Description: "The version in the token's domain; read from the token if unset.",
+				},
+				"style": {
+					Type:          framework.TypeString,
+					Default:       PermitEIP2612,
+					AllowedValues: []interface{}{PermitEIP2612, PermitDAI},
+					Description:   "The permit style: eip2612 or dai.",
+				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withSigningGuards(b.pathERC20Permit),
+				logical.UpdateOperation: b.withSigningGuards(b.pathERC20Permit),
+			},
+		},
+	}
+}
+
+// permitNumber parses a non-negative decimal field
+func permitNumber(data *framework.FieldData, field string) (*big.Int, error) {
+	value, ok := new(big.Int).SetString(data.Get(field).(string), 10)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("%w: %s must be a non-negative integer", ErrInvalidInput, field)
+	}
+	return value, nil
+}
+
+// permitToken reads the permit views of a token
+type permitToken struct {
+	contract *bind.BoundContract
+	opts     *bind.CallOpts
+}
+
+func (b *PluginBackend) permitToken(ctx context.Context, config *ConfigJSON, address common.Address) (*permitToken, error) {
+	parsed, err := abi.JSON(strings.NewReader(permitABI))
+	if err != nil {
+		return nil, err
+	}
+	client, err := b.dialRPC(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &permitToken{
+		contract: bind.NewBoundContract(address, parsed, client, client, client),
+		opts:     &bind.CallOpts{Context: ctx},
+	}, nil
+}
+
+func (token *permitToken) nonce(owner common.Address) (*big.Int, error) {
+	nonce := new(*big.Int)
+	if err := token.contract.Call(token.opts, nonce, "nonces", owner); err != nil {
+		return nil, err
+	}
+	return *nonce, nil
+}
+
+func (token *permitToken) stringView(method string) (string, error) {
+	value := new(string)
+	err := token.contract.Call(token.opts, value, method)
+	return *value, err
+}
+
+func (token *permitToken) domainSeparator() ([32]byte, error) {
+	separator := new([32]byte)
+	err := token.contract.Call(token.opts, separator, "DOMAIN_SEPARATOR")
+	return *separator, err
+}
+
+func (b *PluginBackend) pathERC20Permit(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	style := data.Get("style").(string)
+	if _, ok := permitTypes[style]; !ok {
+		return nil, fmt.Errorf("%w: style must be %s or %s", ErrInvalidInput, PermitEIP2612, PermitDAI)
+	}
+
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	// the domain of a permit binds it to the chain like a transaction
+	if err := checkChainPin(ctx, config, accountJSON); err != nil {
+		return nil, err
+	}
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenAddress, err := config.parseAddress(data.Get("contract").(string))
+	if err != nil {
+		return nil, wrapError(ErrInvalidAddress, err)
+	}
+	spender, err := config.parseAddress(data.Get("spender").(string))
+	if err != nil {
+		return nil, wrapError(ErrInvalidAddress, err)
+	}
+	if err := config.ValidAddress(&spender); err != nil {
+		return nil, err
+	}
+	if err := accountJSON.ValidAddress(&spender); err != nil {
+		return nil, err
+	}
+
+	chainID, ok := new(big.Int).SetString(config.ChainID, 10)
+	if !ok {
+		return nil, ErrInvalidChainID
+	}
+	if data.Get("deadline").(string) == Empty {
+		return nil, fmt.Errorf("%w: deadline is required", ErrInvalidInput)
+	}
+	deadline, err := permitNumber(data, "deadline")
+	if err != nil {
+		return nil, err
+	}
+	value, err := permitNumber(data, "value")
+	if err != nil {
+		return nil, err
+	}
+
+	// the token is only dialled for what the request leaves out
+	var token *permitToken
+	readToken := func() error {
+		if token != nil {
+			return nil
+		}
+		var err error
+		token, err = b.permitToken(ctx, config, tokenAddress)
+		return err
+	}
+
+	var nonce *big.Int
+	if data.Get("nonce").(string) != Empty {
+		if nonce, err = permitNumber(data, "nonce"); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := readToken(); err != nil {
+			return nil, err
+		}
+		if nonce, err = token.nonce(account.Address); err != nil {
+			return nil, fmt.Errorf("%w: reading nonces(): %v", ErrRPCUnavailable, err)
+		}
+	}
+	tokenName := data.Get("token_name").(string)
+	if tokenName == Empty {
+		if err := readToken(); err != nil {
+			return nil, err
+		}
+		if tokenName, err = token.stringView("name"); err != nil {
+			return nil, fmt.Errorf("%w: reading name(): %v", ErrRPCUnavailable, err)
+		}
+	}
+	tokenVersion := data.Get("token_version").(string)
+	if tokenVersion == Empty {
+		if err := readToken(); err != nil {
+			return nil, err
+		}
+		if tokenVersion, err = token.stringView("version"); err != nil || tokenVersion == Empty {
+			tokenVersion = defaultPermitVersion
+		}
+	}
+
+	message := core.TypedDataMessage{
+		"spender": spender.Hex(),
+		"nonce":   nonce.String(),
+	}
+	if style == PermitDAI {
+		message["holder"] = account.Address.Hex()
+		message["expiry"] = deadline.String()
+		message["allowed"] = data.Get("allowed").(bool)
+	} else {
+		message["owner"] = account.Address.Hex()
+		message["value"] = value.String()
+		message["deadline"] = deadline.String()
+	}
+	typedData := core.TypedData{
+		Types: core.Types{
+			"CIP712Domain": permitDomainType,
+			"Permit":       permitTypes[style],
+		},
+		PrimaryType: "Permit",
+		Domain: core.TypedDataDomain{
+			Name:              tokenName,
+			Version:           tokenVersion,
+			NetworkId:         (*math.HexOrDecimal256)(chainID),
+			VerifyingContract: tokenAddress.Hex(),
+		},
+		Message: message,
+	}
+	domainSeparator, err := typedData.HashStruct("CIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	if token != nil {
+		// tokens that predate DOMAIN_SEPARATOR() are not checked
+		if onChainSeparator, err := token.domainSeparator(); err == nil && !bytes.Equal(onChainSeparator[:], domainSeparator) {
+			return nil, fmt.Errorf("%w: the domain separator of %s is %s, not %s; check token_name and token_version", ErrInvalidInput, tokenAddress.Hex(), hexutil.Encode(onChainSeparator[:]), domainSeparator)
+		}
+	}
+	structHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	digest := crypto.SHA3([]byte("\x19\x01"), domainSeparator, structHash)
+
+	signer, err := accountSigner(ctx, req, name, wallet, *account)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signature":        hexutil.Encode(signature),
+			"digest":           hexutil.Encode(digest),
+			"domain_separator": domainSeparator.String(),
+			"typed_data":       typedData.Map(),
+			"address":          account.Address.Hex(),
+			"spender":          spender.Hex(),
+			"nonce":            nonce.String(),
+			"deadline":         deadline.String(),
+			"style":            style,
+		},
+	}, nil
+}
@@ -0,0 +1,258 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// PluginBuild describes the binary the plugin is running from. It holds
+// nothing that changes between two runs of the same binary, so the document
+// an attestor signs over it is the same every time it is read.
+type PluginBuild struct {
+	SHA256       string   `json:"sha256"`
+	Version      string   `json:"version"`
+	Commit       string   `json:"commit"`
+	GoVersion    string   `json:"go_version"`
+	Platform     string   `json:"platform"`
+	Module       string   `json:"module"`
+	Dependencies []string `json:"dependencies"`
+}
+
+// executableHash is the SHA256 of the plugin binary; the binary does not
+// change while it runs, so it is hashed once
+var executableHash struct {
+	sync.Once
+	sum string
+	err error
+}
+
+// pluginSHA256 returns the SHA256 of the running plugin binary, hex encoded
+// the way Vault's plugin catalog registers it
+func pluginSHA256() (string, error) {
+	executableHash.Do(func() {
+		path, err := os.Executable()
+		if err != nil {
+			executableHash.err = err
+			return
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			executableHash.err = err
+			return
+		}
+		defer file.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			executableHash.err = err
+			return
+		}
+		executableHash.sum = hex.EncodeToString(hash.Sum(nil))
+	})
+	return executableHash.sum, executableHash.err
+}
+
+// pluginBuild returns the build of the running plugin
+func pluginBuild() (*PluginBuild, error) {
+	sum, err := pluginSHA256()
+	if err != nil {
+		return nil, fmt.Errorf("cannot hash the plugin binary: %v", err)
+	}
+	build := &PluginBuild{
+		SHA256:       sum,
+		Version:      Version,
+		Commit:       Commit,
+		GoVersion:    runtime.Version(),
+		Platform:     runtime.GOOS + "/" + runtime.GOARCH,
+		Dependencies: []string{},
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		build.Module = info.Main.Path
+		for _, dependency := range info.Deps {
+			if dependency.Replace != nil {
+				dependency = dependency.Replace
+			}
+			build.Dependencies = append(build.Dependencies, strings.TrimSpace(dependency.Path+" "+dependency.Version+" "+dependency.Sum))
+		}
+	}
+	return build, nil
+}
+
+func pluginInfoPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("plugin-info"),
+			HelpSynopsis: "Return the SHA256 of the running plugin binary and a signed build attestation.",
+			HelpDescription: `
+
+Return the SHA256 of the binary this plugin is running from, the version and
+git commit it was built with, the Go toolchain and platform, and every module
+compiled into it with its go.sum hash. The same fields are returned as an
+attestation document signed by the mount's attestor key, so an auditor who
+pinned the address of ceremony/attestor can keep the document as proof of
+what was deployed. The attestor key is generated on first read; a standby
+cannot store it and returns the document unsigned until the active node has
+been read.
+
+The binary is built reproducibly (make build, or the Dockerfile): the same
+source and toolchain give the same SHA256, so an auditor who builds the
+audited commit compares their hash with the one returned here and with the
+one Vault's plugin catalog registered.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathPluginInfoRead,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("plugin-info/verify"),
+			HelpSynopsis: "Check the running plugin binary against its plugin catalog registration.",
+			HelpDescription: `
+
+Compare the SHA256 of the running binary with the sha256 the plugin was
+registered with in Vault's plugin catalog (vault plugin info secret <name>),
+or with the hash of a reproducible build of the audited source. Give version
+and commit to check those too. Vault refuses to start a plugin whose binary
+does not match its registration, so a mismatch means the binary was swapped
+after the plugin started or the catalog entry was re-registered since.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"sha256": {
+					Type:        framework.TypeString,
+					Description: "The SHA256 the plugin catalog registered, hex encoded.",
+				},
+				"version": {
+					Type:        framework.TypeString,
+					Description: "The version the binary must have been built with; not checked if empty.",
+				},
+				"commit": {
+					Type:        framework.TypeString,
+					Description: "The git commit the binary must have been built from; not checked if empty.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathPluginInfoVerify,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathPluginInfoRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	build, err := pluginBuild()
+	if err != nil {
+		return nil, err
+	}
+	document, err := json.Marshal(build)
+	if err != nil {
+		return nil, err
+	}
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"sha256":       build.SHA256,
+			"version":      build.Version,
+			"commit":       build.Commit,
+			"go_version":   build.GoVersion,
+			"platform":     build.Platform,
+			"module":       build.Module,
+			"dependencies": build.Dependencies,
+		},
+	}
+	key, err := attestor(ctx, req, true)
+	switch {
+	case isReadOnly(err):
+		if key, err = attestor(ctx, req, false); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+	if key == nil {
+		resp.AddWarning("this mount has no attestor key yet and cannot store one here; read plugin-info on the active node to have the attestation signed")
+		return resp, nil
+	}
+	signature, err := crypto.Sign(crypto.SHA3(document), key)
+	if err != nil {
+		return nil, err
+	}
+	resp.Data["attestation"] = (&AttestationJSON{
+		Document:  string(document),
+		Signature: hexutil.Encode(signature),
+		Attestor:  keyAddress(key).Hex(),
+	}).responseData()
+	return resp, nil
+}
+
+func (b *PluginBackend) pathPluginInfoVerify(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	registered := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(data.Get("sha256").(string)), "0x"))
+	if registered == Empty {
+		return nil, fmt.Errorf("%w: sha256 is required", ErrInvalidInput)
+	}
+	if _, err := hex.DecodeString(registered); err != nil || len(registered) != sha256.Size*2 {
+		return nil, fmt.Errorf("%w: sha256 %s is not a hex encoded SHA256", ErrInvalidInput, registered)
+	}
+	build, err := pluginBuild()
+	if err != nil {
+		return nil, err
+	}
+	mismatches := []string{}
+	if build.SHA256 != registered {
+		mismatches = append(mismatches, "sha256")
+	}
+	if version := data.Get("version").(string); version != Empty && version != build.Version {
+		mismatches = append(mismatches, "version")
+	}
+	if commit := data.Get("commit").(string); commit != Empty && !sameCommit(build.Commit, commit) {
+		mismatches = append(mismatches, "commit")
+	}
+	if len(mismatches) > 0 {
+		b.Logger().Error("the running plugin does not match its registration", "mismatches", strings.Join(mismatches, ","), "sha256", build.SHA256, "registered", registered)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"verified":   len(mismatches) == 0,
+			"mismatches": mismatches,
+			"sha256":     build.SHA256,
+			"registered": registered,
+			"version":    build.Version,
+			"commit":     build.Commit,
+		},
+	}, nil
+}
+
+// sameCommit reports whether two git commits are the same, either of them
+// possibly abbreviated the way git rev-parse --short does
+func sameCommit(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if len(a) < 7 || len(b) < 7 {
+		return a == b
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
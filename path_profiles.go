@@ -0,0 +1,138 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	familyEVM  string = "evm"
+	familyTron string = "tron"
+
+	gasModelLegacy  string = "legacy"
+	gasModelEIP1559 string = "eip1559"
+	gasModelTron    string = "energy"
+)
+
+// chainProfile is what signing for a chain other than Core needs to get
+// right: how its transactions are serialized, its chain ID and how gas is paid
+type chainProfile struct {
+	Family   string
+	ChainID  int64
+	GasModel string
+	Address  string
+}
+
+// chainProfiles are built in rather than configured, because a profile that
+// is wrong signs transactions that are wrong
+var chainProfiles = map[string]chainProfile{
+	"ethereum":    {Family: familyEVM, ChainID: 1, GasModel: gasModelEIP1559, Address: "hex"},
+	"sepolia":     {Family: familyEVM, ChainID: 11155111, GasModel: gasModelEIP1559, Address: "hex"},
+	"bsc":         {Family: familyEVM, ChainID: 56, GasModel: gasModelLegacy, Address: "hex"},
+	"bsc-testnet": {Family: familyEVM, ChainID: 97, GasModel: gasModelLegacy, Address: "hex"},
+	"polygon":     {Family: familyEVM, ChainID: 137, GasModel: gasModelEIP1559, Address: "hex"},
+	"arbitrum":    {Family: familyEVM, ChainID: 42161, GasModel: gasModelEIP1559, Address: "hex"},
+	"optimism":    {Family: familyEVM, ChainID: 10, GasModel: gasModelEIP1559, Address: "hex"},
+	"avalanche":   {Family: familyEVM, ChainID: 43114, GasModel: gasModelEIP1559, Address: "hex"},
+	"base":        {Family: familyEVM, ChainID: 8453, GasModel: gasModelEIP1559, Address: "hex"},
+	"tron":        {Family: familyTron, GasModel: gasModelTron, Address: "base58check"},
+	"tron-nile":   {Family: familyTron, GasModel: gasModelTron, Address: "base58check"},
+	"tron-shasta": {Family: familyTron, GasModel: gasModelTron, Address: "base58check"},
+}
+
+func (profile chainProfile) responseData(name string) map[string]interface{} {
+	result := map[string]interface{}{
+		"name":           name,
+		"family":         profile.Family,
+		"gas_model":      profile.GasModel,
+		"address_format": profile.Address,
+	}
+	if profile.ChainID != 0 {
+		result["chain_id"] = fmt.Sprintf("%d", profile.ChainID)
+	}
+	return result
+}
+
+// readChainProfile returns a profile of the family a signing path signs for
+func readChainProfile(name, family string) (chainProfile, error) {
+	profile, ok := chainProfiles[name]
+	if !ok {
+		return profile, fmt.Errorf("%w: there is no chain profile %s", ErrInvalidInput, name)
+	}
+	if profile.Family != family {
+		return profile, fmt.Errorf("%w: %s is a %s chain profile, not %s", ErrInvalidInput, name, profile.Family, family)
+	}
+	return profile, nil
+}
+
+func profilePaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("chain-profiles/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathChainProfilesList,
+			},
+			HelpSynopsis: "List the chain profiles keys sign transactions with.",
+			HelpDescription: `
+			All the built-in chain profiles will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("chain-profiles/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Return a chain profile.",
+			HelpDescription: `
+
+Return how transactions for a chain are signed: the family of its
+serialization, evm or tron, its chain ID, its gas model - legacy gas prices,
+EIP-1559 fees or TRON energy - and the format of its addresses. Profiles are
+built in so that signing for BSC or TRON needs no parameters that can be got
+wrong; keys/<name>/evm/sign-tx and keys/<name>/tron/sign-tx take one.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the chain profile."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathChainProfileRead,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathChainProfilesList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names := make([]string, 0, len(chainProfiles))
+	for name := range chainProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return logical.ListResponse(names), nil
+}
+
+func (b *PluginBackend) pathChainProfileRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	profile, ok := chainProfiles[name]
+	if !ok {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: profile.responseData(name),
+	}, nil
+}
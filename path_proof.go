@@ -0,0 +1,292 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/accounts"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// DefaultProofOfControlInterval is the least number of seconds between two proofs of control
+	DefaultProofOfControlInterval int = 300
+	// maxChallengeLength bounds the challenge a proof of control signs
+	maxChallengeLength int = 1024
+)
+
+// proofLock serializes proofs of control, so two cannot both pass the interval
+var proofLock sync.Mutex
+
+// ProofJSON is a proof of control: a challenge signed by the accounts of the mount
+type ProofJSON struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	EntityID string    `json:"entity_id"`
+	// Challenge is signed as a message, as accounts/<name>/sign signs it
+	Challenge  string            `json:"challenge"`
+	Hash       string            `json:"hash"`
+	Signatures map[string]string `json:"signatures"`
+	Accounts   map[string]string `json:"accounts"`
+	// Skipped are the accounts that could not sign, and why
+	Skipped map[string]string `json:"skipped"`
+}
+
+func (proof *ProofJSON) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"id":         proof.ID,
+		"time":       proof.Time.Format(time.RFC3339),
+		"entity_id":  proof.EntityID,
+		"challenge":  proof.Challenge,
+		"hash":       proof.Hash,
+		"signatures": proof.Signatures,
+		"accounts":   proof.Accounts,
+		"skipped":    proof.Skipped,
+	}
+}
+
+func proofStoragePath(id string) string {
+	return QualifiedPath(fmt.Sprintf("proof-of-control/%s", id))
+}
+
+func proofPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("proof-of-control"),
+			HelpSynopsis: "Sign a challenge with the accounts of the mount to prove they are controlled.",
+			HelpDescription: `
+
+Sign the challenge of an exchange or auditor with every account of the mount,
+or with the accounts listed, and return the signature of each address. The
+challenge is signed as a message, exactly as accounts/<name>/sign signs it,
+so any verifier of personal messages checks the signatures. Sealed accounts,
+which need passphrase shares, warm and cold accounts, and destroyed accounts
+are reported as skipped; canary accounts only sign when they are listed.
+
+Proofs are at least proof_of_control_interval seconds apart, are written to
+the decision log, and are kept under proof-of-control/reports for audits.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"challenge": {
+					Type:        framework.TypeString,
+					Description: "The challenge to sign.",
+				},
+				"accounts": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The accounts that sign; every account of the mount if empty.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.unlessFrozen(b.pathProofOfControl),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("proof-of-control/reports/?"),
+			HelpSynopsis: "List the proofs of control made by the mount.",
+			Fields:       listPageSchema(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathProofsList,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("proof-of-control/reports/" + framework.GenericNameRegex("id")),
+			HelpSynopsis: "Return a proof of control made by the mount.",
+			Fields: map[string]*framework.FieldSchema{
+				"id": {Type: framework.TypeString, Description: "The ID of the proof."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathProofRead,
+			},
+		},
+	}
+}
+
+func readProof(ctx context.Context, s logical.Storage, id string) (*ProofJSON, error) {
+	entry, err := s.Get(ctx, proofStoragePath(id))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var proof ProofJSON
+	if err := entry.DecodeJSON(&proof); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// lastProof returns the latest proof of control; IDs sort by time
+func lastProof(ctx context.Context, s logical.Storage) (*ProofJSON, error) {
+	ids, err := s.List(ctx, QualifiedPath("proof-of-control/"))
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	sort.Strings(ids)
+	return readProof(ctx, s, ids[len(ids)-1])
+}
+
+func (b *PluginBackend) pathProofOfControl(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	challenge := data.Get("challenge").(string)
+	if challenge == Empty || len(challenge) > maxChallengeLength {
+		return nil, fmt.Errorf("%w: challenge must be 1 to %d bytes", ErrInvalidInput, maxChallengeLength)
+	}
+	names := data.Get("accounts").([]string)
+	listed := len(names) > 0
+	if !listed {
+		if names, err = req.Storage.List(ctx, QualifiedPath("accounts/")); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	markSigning(ctx, strings.Join(names, ","))
+
+	proofLock.Lock()
+	defer proofLock.Unlock()
+	last, err := lastProof(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Duration(config.ProofOfControlInterval) * time.Second
+	if last != nil && time.Since(last.Time) < interval {
+		err = fmt.Errorf("%w: the last proof of control, %s, was made at %s; the next may be made at %s", ErrRateLimited, last.ID, last.Time.Format(time.RFC3339), last.Time.Add(interval).Format(time.RFC3339))
+	}
+	recordRule(ctx, "proof_of_control_interval", err)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, _ := accounts.TextAndHash([]byte(challenge))
+	now := time.Now().UTC()
+	proof := &ProofJSON{
+		ID:         fmt.Sprintf("%s-%s", now.Format("20060102T150405Z"), uuid.New()[:8]),
+		Time:       now,
+		EntityID:   req.EntityID,
+		Challenge:  challenge,
+		Hash:       hexutil.Encode(hash),
+		Signatures: map[string]string{},
+		Accounts:   map[string]string{},
+		Skipped:    map[string]string{},
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		canary, err := readCanary(ctx, req, name)
+		if err != nil {
+			return nil, err
+		}
+		if canary != nil && !listed {
+			continue
+		}
+		if canary != nil {
+			recordRule(ctx, "canary_alert", nil)
+			b.notify(config, req, eventCanaryUsed, map[string]interface{}{
+				"account":    name,
+				"operation":  string(req.Operation),
+				"fabricated": canary.Fabricate,
+			})
+		}
+		address, signature, err := b.proveControl(ctx, req, name, hash)
+		if err != nil {
+			proof.Skipped[name] = err.Error()
+			continue
+		}
+		proof.Signatures[address] = signature
+		proof.Accounts[address] = name
+	}
+	entry, err := logical.StorageEntryJSON(proofStoragePath(proof.ID), proof)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	b.Logger().Info("proof of control", "id", proof.ID, "signed", len(proof.Signatures), "skipped", len(proof.Skipped), "entity_id", req.EntityID)
+	return &logical.Response{
+		Data: proof.responseData(),
+	}, nil
+}
+
+// proveControl signs the hash of a challenge with one account
+func (b *PluginBackend) proveControl(ctx context.Context, req *logical.Request, name string, hash []byte) (string, string, error) {
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return Empty, Empty, err
+	}
+	if accountJSON.Destroyed {
+		return Empty, Empty, fmt.Errorf("the account is destroyed")
+	}
+	if accountJSON.sealed() {
+		return Empty, Empty, fmt.Errorf("the account is sealed; prove it with passphrase shares through accounts/%s/sign", name)
+	}
+	switch accountJSON.tier() {
+	case TierCold:
+		return Empty, Empty, fmt.Errorf("the account is cold and does not sign online")
+	case TierWarm:
+		return Empty, Empty, fmt.Errorf("the account is warm; prove it with an authorization through accounts/%s/sign", name)
+	}
+	if err := checkGroupFreeze(ctx, req.Storage, name); err != nil {
+		return Empty, Empty, err
+	}
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
+	if err != nil {
+		return Empty, Empty, err
+	}
+	signer, err := accountSigner(ctx, req, name, wallet, *account)
+	if err != nil {
+		return Empty, Empty, err
+	}
+	signature, err := signer.Sign(hash)
+	if err != nil {
+		return Empty, Empty, err
+	}
+	return account.Address.Hex(), hexutil.Encode(signature), nil
+}
+
+func (b *PluginBackend) pathProofsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ids, err := req.Storage.List(ctx, QualifiedPath("proof-of-control/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(listPage(ids, data)), nil
+}
+
+func (b *PluginBackend) pathProofRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	proof, err := readProof(ctx, req.Storage, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if proof == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: proof.responseData(),
+	}, nil
+}
@@ -0,0 +1,380 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// DefaultSanctionsRefreshInterval is how often sanctions_list_url is fetched, in seconds
+	DefaultSanctionsRefreshInterval int = 86400
+	// sanctionsListLimit caps the list read from sanctions_list_url
+	sanctionsListLimit int64 = 16 << 20
+	// sanctionsFetchTimeout bounds a fetch of sanctions_list_url
+	sanctionsFetchTimeout = time.Minute
+)
+
+// SanctionsListJSON is the local list of sanctioned addresses, such as the
+// digital currency addresses of OFAC's SDN list
+type SanctionsListJSON struct {
+	Addresses []string  `json:"addresses"`
+	Source    string    `json:"source,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// SHA256 identifies the addresses, so a node rebuilds its index only when they change
+	SHA256 string `json:"sha256"`
+	// LastFetch and LastError are the last fetch of sanctions_list_url
+	LastFetch time.Time `json:"last_fetch"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+func (list *SanctionsListJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"count":  len(list.Addresses),
+		"sha256": list.SHA256,
+	}
+	if list.Source != Empty {
+		result["source"] = list.Source
+	}
+	if !list.UpdatedAt.IsZero() {
+		result["updated_at"] = list.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	if !list.LastFetch.IsZero() {
+		result["last_fetch"] = list.LastFetch.UTC().Format(time.RFC3339)
+	}
+	if list.LastError != Empty {
+		result["last_error"] = list.LastError
+	}
+	return result
+}
+
+// sanctionsIndex holds the stored list as a set, rebuilt when its hash changes
+type sanctionsIndex struct {
+	sync.Mutex
+	sha256    string
+	addresses map[string]bool
+}
+
+func sanctionsPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("sanctions"),
+			HelpSynopsis: "Replace, read or delete the local list of sanctioned addresses.",
+			HelpDescription: `
+
+Keep a list of sanctioned addresses, such as the digital currency addresses of
+OFAC's SDN list, in the mount. While it holds any address, no transaction is
+signed whose recipient, or an address its call passes, is on it, whatever the
+approvals, and no screening vendor is needed for it. Hex addresses match
+whatever their case and 0x prefix.
+
+Writing addresses, or list, replaces the whole list. list is the text of a
+list file: one address per line, or a JSON array of addresses; lines starting
+with # are ignored. Set sanctions_list_url in the config to have the list
+fetched and replaced every sanctions_refresh_interval instead.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"addresses": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The sanctioned addresses.",
+				},
+				"list": {
+					Type:        framework.TypeString,
+					Description: "The sanctioned addresses as the text of a list file, in place of addresses.",
+				},
+				"source": {
+					Type:        framework.TypeString,
+					Description: "Where the list comes from, such as the date of the SDN list it was taken from.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathSanctionsRead,
+				logical.UpdateOperation: b.pathSanctionsWrite,
+				logical.DeleteOperation: b.pathSanctionsDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("sanctions/check"),
+			HelpSynopsis: "Return whether an address is on the local list of sanctioned addresses.",
+			Fields: map[string]*framework.FieldSchema{
+				"address": {Type: framework.TypeString, Description: "The address to check."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathSanctionsCheck,
+				logical.UpdateOperation: b.pathSanctionsCheck,
+			},
+		},
+	}
+}
+
+func sanctionsStoragePath() string {
+	return QualifiedPath("sanctions/list")
+}
+
+func readSanctionsList(ctx context.Context, s logical.Storage) (*SanctionsListJSON, error) {
+	entry, err := s.Get(ctx, sanctionsStoragePath())
+	if err != nil {
+		return nil, err
+	}
+	list := &SanctionsListJSON{}
+	if entry == nil {
+		return list, nil
+	}
+	if err := entry.DecodeJSON(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func writeSanctionsList(ctx context.Context, s logical.Storage, list *SanctionsListJSON) error {
+	entry, err := logical.StorageEntryJSON(sanctionsStoragePath(), list)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// normalizeSanctioned puts an address in the form the list holds: hex
+// addresses in lowercase without 0x, others, such as base58 ones, as they are
+func normalizeSanctioned(input string) string {
+	trimmed := strings.TrimSpace(input)
+	bare := strings.TrimPrefix(strings.TrimPrefix(trimmed, "0x"), "0X")
+	if _, err := hex.DecodeString(bare); err == nil && bare != Empty {
+		return strings.ToLower(bare)
+	}
+	return trimmed
+}
+
+// parseSanctionsList reads a list file: a JSON array of addresses, or one
+// address per line with # comments
+func parseSanctionsList(text string) ([]string, error) {
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "[") {
+		var addresses []string
+		if err := json.Unmarshal([]byte(trimmed), &addresses); err != nil {
+			return nil, fmt.Errorf("%w: the list is not a JSON array of addresses: %v", ErrInvalidInput, err)
+		}
+		return addresses, nil
+	}
+	var addresses []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == Empty || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addresses = append(addresses, strings.Fields(line)[0])
+	}
+	return addresses, nil
+}
+
+// replaceSanctionsList stores a new set of sanctioned addresses in the list
+func replaceSanctionsList(list *SanctionsListJSON, addresses []string, source string) error {
+	normalized := make([]string, 0, len(addresses))
+	for _, raw := range addresses {
+		address := normalizeSanctioned(raw)
+		if address == Empty || strings.ContainsAny(address, " \t,") {
+			return fmt.Errorf("%w: %q is not an address", ErrInvalidInput, raw)
+		}
+		normalized = append(normalized, address)
+	}
+	normalized = util.Dedup(normalized)
+	sort.Strings(normalized)
+	hash := sha256.Sum256([]byte(strings.Join(normalized, "\n")))
+	list.Addresses = normalized
+	list.Source = source
+	list.UpdatedAt = time.Now().UTC()
+	list.SHA256 = hex.EncodeToString(hash[:])
+	return nil
+}
+
+func (b *PluginBackend) pathSanctionsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	list, err := readSanctionsList(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: list.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathSanctionsWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	addresses := data.Get("addresses").([]string)
+	if text := data.Get("list").(string); text != Empty {
+		if len(addresses) > 0 {
+			return nil, fmt.Errorf("%w: pass addresses or list, not both", ErrInvalidInput)
+		}
+		parsed, err := parseSanctionsList(text)
+		if err != nil {
+			return nil, err
+		}
+		addresses = parsed
+	}
+	list, err := readSanctionsList(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := replaceSanctionsList(list, addresses, data.Get("source").(string)); err != nil {
+		return nil, err
+	}
+	if err := writeSanctionsList(ctx, req.Storage, list); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: list.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathSanctionsDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, sanctionsStoragePath())
+}
+
+func (b *PluginBackend) pathSanctionsCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	address := data.Get("address").(string)
+	if address == Empty {
+		return nil, fmt.Errorf("%w: address is required", ErrInvalidInput)
+	}
+	hit, _, err := b.sanctioned(ctx, req.Storage, []string{address})
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address":    address,
+			"sanctioned": hit != Empty,
+		},
+	}, nil
+}
+
+// sanctioned returns the first of the addresses that is on the local list,
+// and whether there is a list at all
+func (b *PluginBackend) sanctioned(ctx context.Context, s logical.Storage, addresses []string) (string, bool, error) {
+	list, err := readSanctionsList(ctx, s)
+	if err != nil || len(list.Addresses) == 0 {
+		return Empty, false, err
+	}
+	index := b.sanctionsIndex
+	index.Lock()
+	defer index.Unlock()
+	if index.sha256 != list.SHA256 {
+		index.addresses = make(map[string]bool, len(list.Addresses))
+		for _, address := range list.Addresses {
+			index.addresses[address] = true
+		}
+		index.sha256 = list.SHA256
+	}
+	for _, address := range addresses {
+		if index.addresses[normalizeSanctioned(address)] {
+			return address, true, nil
+		}
+	}
+	return Empty, true, nil
+}
+
+// checkSanctions refuses a transaction to an address on the local list.
+// Sanctions admit no exceptions, so no authorization lets it through.
+func (b *PluginBackend) checkSanctions(ctx context.Context, s logical.Storage, addresses []string) error {
+	hit, listed, err := b.sanctioned(ctx, s, addresses)
+	if err != nil || !listed {
+		return err
+	}
+	if hit != Empty {
+		err = fmt.Errorf("%w: %s is on the sanctions list", ErrPolicyViolation, hit)
+	}
+	recordRule(ctx, "sanctions", err)
+	return err
+}
+
+// refreshSanctionsList fetches sanctions_list_url when the list is older than
+// sanctions_refresh_interval. A failed fetch keeps the list it has.
+func (b *PluginBackend) refreshSanctionsList(ctx context.Context, req *logical.Request) error {
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		if errors.Is(err, ErrNotConfigured) {
+			return nil
+		}
+		return err
+	}
+	if config.SanctionsListURL == Empty {
+		return nil
+	}
+	list, err := readSanctionsList(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if now.Before(list.LastFetch.Add(time.Duration(config.sanctionsRefreshInterval()) * time.Second)) {
+		return nil
+	}
+	list.LastFetch = now.UTC()
+	list.LastError = Empty
+	addresses, err := fetchSanctionsList(ctx, config.SanctionsListURL)
+	if err == nil {
+		err = replaceSanctionsList(list, addresses, config.SanctionsListURL)
+	}
+	if err != nil {
+		list.LastError = err.Error()
+		b.Logger().Error("cannot fetch the sanctions list; keeping the one stored", "url", config.SanctionsListURL, "error", err)
+	} else {
+		b.Logger().Info("sanctions list updated", "count", len(list.Addresses), "sha256", list.SHA256)
+	}
+	return writeSanctionsList(ctx, req.Storage, list)
+}
+
+func fetchSanctionsList(ctx context.Context, listURL string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sanctionsFetchTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, sanctionsListLimit))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", response.StatusCode)
+	}
+	addresses, err := parseSanctionsList(string(body))
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		// an empty answer is more likely a broken mirror than a lifted list
+		return nil, fmt.Errorf("the list is empty")
+	}
+	return addresses, nil
+}
@@ -0,0 +1,570 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// DefaultScheduleRetryDelay is how long a failed run waits before it is retried, in seconds
+	DefaultScheduleRetryDelay int = 300
+
+	runSucceeded string = "succeeded"
+	runFailed    string = "failed"
+)
+
+// ScheduleJSON executes a template on a cron schedule
+type ScheduleJSON struct {
+	Template   string                 `json:"template"`
+	Parameters map[string]interface{} `json:"parameters"`
+	Cron       string                 `json:"cron"`
+	// Jitter delays every run by up to this many seconds
+	Jitter     int  `json:"jitter"`
+	MaxRetries int  `json:"max_retries"`
+	RetryDelay int  `json:"retry_delay"`
+	Paused     bool `json:"paused"`
+	// NextRun is when the schedule runs next; Attempt counts the retries of that run
+	NextRun time.Time `json:"next_run"`
+	Attempt int       `json:"attempt"`
+}
+
+// RunJSON is the result of one run of a schedule
+type RunJSON struct {
+	Time            time.Time `json:"time"`
+	Attempt         int       `json:"attempt"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	TransactionHash string    `json:"transaction_hash,omitempty"`
+}
+
+// cronSchedule is a parsed five field cron expression
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// anyDay and anyWeekday are set when the field is *, as cron matches
+	// either the day of the month or of the week when both are restricted
+	anyDay, anyWeekday bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// parseCron parses minute, hour, day of month, month and day of week, each
+// a *, a number, a range or a list of them, optionally with a /step
+func parseCron(expression string) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expression)]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: cron must have five fields or be a macro such as @daily", ErrInvalidInput)
+	}
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]map[int]bool, 5)
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: cron field %q: %v", ErrInvalidInput, field, err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &cronSchedule{
+		minutes: sets[0], hours: sets[1], days: sets[2], months: sets[3], weekdays: sets[4],
+		anyDay: fields[2] == "*", anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return nil, errors.New("invalid step")
+			}
+			part = part[:i]
+		}
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, errors.New("not a number")
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, errors.New("not a number")
+				}
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("out of the range %d-%d", min, max)
+		}
+		for value := low; value <= high; value += step {
+			set[value] = true
+		}
+	}
+	return set, nil
+}
+
+// next returns the first minute after t the schedule matches, or the zero
+// time if it matches none in the next five years
+func (schedule *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(5, 0, 0); t.Before(end); {
+		if !schedule.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		day, weekday := schedule.days[t.Day()], schedule.weekdays[int(t.Weekday())]
+		dayMatches := day && weekday
+		switch {
+		case schedule.anyDay && !schedule.anyWeekday:
+			dayMatches = weekday
+		case !schedule.anyDay && schedule.anyWeekday:
+			dayMatches = day
+		case !schedule.anyDay && !schedule.anyWeekday:
+			dayMatches = day || weekday
+		}
+		if !dayMatches {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.hours[t.Hour()] {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !schedule.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func scheduleStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("schedules/%s", name))
+}
+
+func runStoragePath(name, id string) string {
+	return QualifiedPath(fmt.Sprintf("schedule-runs/%s/%s", name, id))
+}
+
+func schedulePaths(b *PluginBackend) []*framework.Path {
+	nameField := map[string]*framework.FieldSchema{
+		"name": {Type: framework.TypeString, Description: "The name of the schedule."},
+	}
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("schedules/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathSchedulesList,
+			},
+			HelpSynopsis: "List the schedules.",
+			HelpDescription: `
+			All the schedules will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("schedules/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Create, read, update or delete a schedule that executes a template.",
+			HelpDescription: `
+
+Execute a template with fixed parameters on a cron schedule, such as weekly
+payroll or daily reward claims. cron has the five fields of crontab (minute,
+hour, day of month, month, day of week) in UTC, or is a macro such as @daily.
+Schedules are checked by Vault's periodic function about once a minute, so a
+run may start up to a minute late, plus up to jitter seconds. A failed run is
+retried max_retries times, retry_delay seconds apart, before the schedule
+waits for its next time. Every attempt is recorded under
+schedules/<name>/runs/. Templates of sealed accounts cannot be scheduled as
+nobody is there to supply passphrase shares.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the schedule."},
+				"template": {
+					Type:        framework.TypeString,
+					Description: "The template to execute.",
+				},
+				"parameters": {
+					Type:        framework.TypeMap,
+					Description: "The parameters to execute the template with.",
+				},
+				"cron": {
+					Type:        framework.TypeString,
+					Description: "When to execute the template, as a crontab expression in UTC.",
+				},
+				"jitter": {
+					Type:        framework.TypeDurationSecond,
+					Default:     0,
+					Description: "Delay every run by a random time up to this long.",
+				},
+				"max_retries": {
+					Type:        framework.TypeInt,
+					Default:     0,
+					Description: "How many times to retry a failed run.",
+				},
+				"retry_delay": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultScheduleRetryDelay,
+					Description: "How long to wait before retrying a failed run.",
+				},
+				"paused": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Do not run the schedule until it is resumed.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathScheduleRead,
+				logical.CreateOperation: b.pathScheduleWrite,
+				logical.UpdateOperation: b.pathScheduleWrite,
+				logical.DeleteOperation: b.pathScheduleDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("schedules/" + framework.GenericNameRegex("name") + "/pause"),
+			HelpSynopsis: "Stop running a schedule until it is resumed.",
+			Fields:       nameField,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathSchedulePause,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("schedules/" + framework.GenericNameRegex("name") + "/resume"),
+			HelpSynopsis: "Resume a paused schedule from its next time.",
+			Fields:       nameField,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathScheduleResume,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("schedules/" + framework.GenericNameRegex("name") + "/runs/?"),
+			HelpSynopsis: "List the runs of a schedule, oldest first.",
+			Fields:       nameField,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathScheduleRunsList,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("schedules/" + framework.GenericNameRegex("name") + "/runs/" + framework.GenericNameRegex("run")),
+			HelpSynopsis: "Return the result of a run of a schedule.",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the schedule."},
+				"run":  {Type: framework.TypeString, Description: "The ID of the run."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathScheduleRunRead,
+			},
+		},
+	}
+}
+
+func readSchedule(ctx context.Context, s logical.Storage, name string) (*ScheduleJSON, error) {
+	entry, err := s.Get(ctx, scheduleStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: no schedule %s", ErrInvalidInput, name)
+	}
+	var schedule ScheduleJSON
+	if err := entry.DecodeJSON(&schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func writeSchedule(ctx context.Context, s logical.Storage, name string, schedule *ScheduleJSON) error {
+	entry, err := logical.StorageEntryJSON(scheduleStoragePath(name), schedule)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func (schedule *ScheduleJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"template":    schedule.Template,
+		"parameters":  schedule.Parameters,
+		"cron":        schedule.Cron,
+		"jitter":      schedule.Jitter,
+		"max_retries": schedule.MaxRetries,
+		"retry_delay": schedule.RetryDelay,
+		"paused":      schedule.Paused,
+		"attempt":     schedule.Attempt,
+	}
+	if !schedule.NextRun.IsZero() {
+		result["next_run"] = schedule.NextRun.UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+// plan sets the next run of the schedule after t, with jitter
+func (schedule *ScheduleJSON) plan(t time.Time) error {
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+	schedule.Attempt = 0
+	schedule.NextRun = cron.next(t)
+	if !schedule.NextRun.IsZero() && schedule.Jitter > 0 {
+		schedule.NextRun = schedule.NextRun.Add(time.Duration(rand.Int63n(int64(schedule.Jitter))) * time.Second)
+	}
+	return nil
+}
+
+func (b *PluginBackend) pathSchedulesList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := req.Storage.List(ctx, QualifiedPath("schedules/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathScheduleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := readSchedule(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: schedule.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathScheduleWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	schedule := &ScheduleJSON{
+		Template:   data.Get("template").(string),
+		Parameters: data.Get("parameters").(map[string]interface{}),
+		Cron:       data.Get("cron").(string),
+		Jitter:     data.Get("jitter").(int),
+		MaxRetries: data.Get("max_retries").(int),
+		RetryDelay: data.Get("retry_delay").(int),
+		Paused:     data.Get("paused").(bool),
+	}
+	if schedule.Jitter < 0 || schedule.MaxRetries < 0 || schedule.RetryDelay <= 0 {
+		return nil, fmt.Errorf("%w: jitter and max_retries cannot be negative and retry_delay must be positive", ErrInvalidInput)
+	}
+	template, err := readTemplate(ctx, req.Storage, schedule.Template)
+	if err != nil {
+		return nil, err
+	}
+	// refuse parameters that could never execute now rather than at the first run
+	if _, _, _, err := template.render(config, schedule.Parameters); err != nil {
+		return nil, err
+	}
+	if err := schedule.plan(time.Now()); err != nil {
+		return nil, err
+	}
+	if schedule.NextRun.IsZero() {
+		return nil, fmt.Errorf("%w: cron never matches", ErrInvalidInput)
+	}
+	if err := writeSchedule(ctx, req.Storage, data.Get("name").(string), schedule); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: schedule.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathScheduleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, scheduleStoragePath(data.Get("name").(string)))
+}
+
+func (b *PluginBackend) pathSchedulePause(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.setSchedulePaused(ctx, req, data.Get("name").(string), true)
+}
+
+func (b *PluginBackend) pathScheduleResume(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.setSchedulePaused(ctx, req, data.Get("name").(string), false)
+}
+
+func (b *PluginBackend) setSchedulePaused(ctx context.Context, req *logical.Request, name string, paused bool) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := readSchedule(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if !paused && schedule.Paused {
+		// runs missed while paused are skipped
+		if err := schedule.plan(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	schedule.Paused = paused
+	if err := writeSchedule(ctx, req.Storage, name, schedule); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: schedule.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathScheduleRunsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := req.Storage.List(ctx, QualifiedPath(fmt.Sprintf("schedule-runs/%s/", data.Get("name").(string))))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathScheduleRunRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := req.Storage.Get(ctx, runStoragePath(data.Get("name").(string), data.Get("run").(string)))
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	var run RunJSON
+	if err := entry.DecodeJSON(&run); err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"time":    run.Time.UTC().Format(time.RFC3339),
+		"attempt": run.Attempt,
+		"status":  run.Status,
+	}
+	if run.Error != Empty {
+		result["error"] = run.Error
+	}
+	if run.TransactionHash != Empty {
+		result["transaction_hash"] = run.TransactionHash
+	}
+	return &logical.Response{Data: result}, nil
+}
+
+// runSchedules is called by the periodic function to execute every schedule that is due
+func (b *PluginBackend) runSchedules(ctx context.Context, req *logical.Request) error {
+	if _, err := b.readConfig(ctx, req.Storage); err != nil {
+		if errors.Is(err, ErrNotConfigured) {
+			return nil
+		}
+		return err
+	}
+	names, err := req.Storage.List(ctx, QualifiedPath("schedules/"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range names {
+		schedule, err := readSchedule(ctx, req.Storage, name)
+		if err != nil {
+			return err
+		}
+		if schedule.Paused || schedule.NextRun.IsZero() || now.Before(schedule.NextRun) {
+			continue
+		}
+		run := b.runSchedule(ctx, req.Storage, name, schedule)
+		entry, err := logical.StorageEntryJSON(runStoragePath(name, run.Time.UTC().Format("20060102T150405Z")+"-"+strconv.Itoa(run.Attempt)), run)
+		if err != nil {
+			return err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return err
+		}
+		if run.Status == runFailed && schedule.Attempt < schedule.MaxRetries {
+			schedule.Attempt++
+			schedule.NextRun = now.Add(time.Duration(schedule.RetryDelay) * time.Second)
+		} else if err := schedule.plan(now); err != nil {
+			return err
+		}
+		if err := writeSchedule(ctx, req.Storage, name, schedule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backgroundRequest is the request the periodic function signs with, so
+// that what it signs is decided and logged like any other request
+func backgroundRequest(s logical.Storage, path string) *logical.Request {
+	return &logical.Request{
+		ID:        uuid.New(),
+		Operation: logical.UpdateOperation,
+		Path:      QualifiedPath(path),
+		Storage:   s,
+	}
+}
+
+// runSchedule executes the template of a schedule as a request of its own,
+// so it is decided and logged like any other signing request
+func (b *PluginBackend) runSchedule(ctx context.Context, s logical.Storage, name string, schedule *ScheduleJSON) *RunJSON {
+	req := backgroundRequest(s, fmt.Sprintf("schedules/%s/execute", name))
+	ctx, recorder := withDecisionRecorder(ctx)
+	resp, err := b.executeTemplate(ctx, req, schedule.Template, schedule.Parameters, nil)
+	if err == nil && resp != nil && resp.IsError() {
+		err = resp.Error()
+	}
+	b.logDecision(ctx, req, recorder, err)
+	run := &RunJSON{Time: time.Now(), Attempt: schedule.Attempt, Status: runSucceeded}
+	if err != nil {
+		run.Status = runFailed
+		run.Error = err.Error()
+		b.Logger().Warn("scheduled run failed", "schedule", name, "attempt", schedule.Attempt, "error", err)
+		return run
+	}
+	if hash, ok := resp.Data["transaction_hash"].(string); ok {
+		run.TransactionHash = hash
+	}
+	return run
+}
@@ -0,0 +1,303 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/core-coin/go-core/accounts/abi"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// SelectorJSON holds the function signatures known for a selector. Distinct
+// signatures can share a selector, so there may be more than one.
+type SelectorJSON struct {
+	Signatures []string `json:"signatures"`
+}
+
+var signaturePattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*\([A-Za-z0-9_$,()\[\]]*\)$`)
+
+func selectorStoragePath(selector string) string {
+	return QualifiedPath(fmt.Sprintf("selectors/%s", selector))
+}
+
+// selectorOf is the selector Core computes for a function signature. Core
+// hashes signatures with SHA3 where Ethereum uses Keccak, so the hex
+// signatures of an Ethereum registry do not apply; they are recomputed.
+func selectorOf(signature string) string {
+	return hexutil.Encode(crypto.SHA3([]byte(signature))[:4])
+}
+
+func selectorPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("selectors/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathSelectorsList,
+			},
+			HelpSynopsis: "List the selectors with known function signatures.",
+			HelpDescription: `
+			All the selectors with known function signatures will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("selectors/" + `(?P<selector>0x[0-9a-f]{8})`),
+			HelpSynopsis: "Read or delete the function signatures of a selector.",
+			HelpDescription: `
+
+Return the function signatures known for a selector, or forget them.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"selector": {Type: framework.TypeString, Description: "The selector, as 0x and 8 lowercase hex digits."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathSelectorRead,
+				logical.DeleteOperation: b.pathSelectorDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("selectors/import"),
+			HelpSynopsis: "Add function signatures to the selector registry.",
+			HelpDescription: `
+
+Add function signatures so decode, the logs and the decision log can name the
+method calldata calls when no registered ABI has it. Pass signatures, or an
+export of the 4byte directory: its JSON (a list, or a page with results) or
+one signature per line, optionally after its hex signature. Selectors are
+computed from the text signatures with the SHA3 hash Core uses; the hex
+signatures of the export are Keccak hashes and are ignored.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"signatures": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Function signatures, such as transfer(address,uint256).",
+				},
+				"export": {
+					Type:        framework.TypeString,
+					Description: "An export of the 4byte directory.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathSelectorsImport,
+			},
+		},
+	}
+}
+
+func readSelector(ctx context.Context, s logical.Storage, selector string) (*SelectorJSON, error) {
+	entry, err := s.Get(ctx, selectorStoragePath(selector))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var selectorJSON SelectorJSON
+	if err := entry.DecodeJSON(&selectorJSON); err != nil {
+		return nil, err
+	}
+	return &selectorJSON, nil
+}
+
+// exportSignatures reads the text signatures of a 4byte directory export
+func exportSignatures(export string) []string {
+	type signature struct {
+		TextSignature string `json:"text_signature"`
+	}
+	var page struct {
+		Results []signature `json:"results"`
+	}
+	var list []signature
+	var signatures []string
+	switch {
+	case json.Unmarshal([]byte(export), &list) == nil:
+	case json.Unmarshal([]byte(export), &page) == nil:
+		list = page.Results
+	default:
+		for _, line := range strings.Split(export, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) > 10 && strings.HasPrefix(line, "0x") {
+				line = strings.TrimLeft(line[10:], " \t,;")
+			}
+			if line != Empty {
+				signatures = append(signatures, line)
+			}
+		}
+		return signatures
+	}
+	for _, item := range list {
+		signatures = append(signatures, item.TextSignature)
+	}
+	return signatures
+}
+
+// lookupSelector names the method of calldata no ABI matched from the
+// registry. Arguments are decoded when the first signature's types parse.
+func lookupSelector(ctx context.Context, s logical.Storage, call *DecodedCall, data []byte) error {
+	selectorJSON, err := readSelector(ctx, s, call.Selector)
+	if err != nil || selectorJSON == nil || len(selectorJSON.Signatures) == 0 {
+		return err
+	}
+	signature := selectorJSON.Signatures[0]
+	call.Method = signature[:strings.Index(signature, "(")]
+	call.Signature = signature
+	if len(selectorJSON.Signatures) > 1 {
+		call.Candidates = selectorJSON.Signatures
+	}
+	types := splitTypes(signature[len(call.Method)+1 : len(signature)-1])
+	inputs := abi.Arguments{}
+	for i, name := range types {
+		typ, err := abi.NewType(name, "", nil)
+		if err != nil {
+			return nil
+		}
+		inputs = append(inputs, abi.Argument{Name: fmt.Sprintf("arg%d", i), Type: typ})
+	}
+	arguments := map[string]interface{}{}
+	if err := inputs.UnpackIntoMap(arguments, data[4:]); err != nil {
+		return nil
+	}
+	for key, value := range arguments {
+		arguments[key] = formatArgument(value)
+	}
+	call.Arguments = arguments
+	return nil
+}
+
+// splitTypes splits the parameter list of a signature at its top level commas
+func splitTypes(parameters string) []string {
+	var types []string
+	depth, start := 0, 0
+	for i, c := range parameters {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				types = append(types, parameters[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if parameters != Empty {
+		types = append(types, parameters[start:])
+	}
+	return types
+}
+
+func (b *PluginBackend) pathSelectorsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := req.Storage.List(ctx, QualifiedPath("selectors/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathSelectorRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	selectorJSON, err := readSelector(ctx, req.Storage, data.Get("selector").(string))
+	if err != nil || selectorJSON == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signatures": selectorJSON.Signatures,
+		},
+	}, nil
+}
+
+func (b *PluginBackend) pathSelectorDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, selectorStoragePath(data.Get("selector").(string)))
+}
+
+func (b *PluginBackend) pathSelectorsImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	signatures := data.Get("signatures").([]string)
+	if export := data.Get("export").(string); export != Empty {
+		signatures = append(signatures, exportSignatures(export)...)
+	}
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("%w: pass signatures or an export", ErrInvalidInput)
+	}
+	bySelector := map[string][]string{}
+	skipped := 0
+	for _, signature := range signatures {
+		signature = strings.TrimSpace(signature)
+		if !signaturePattern.MatchString(signature) {
+			skipped++
+			continue
+		}
+		selector := selectorOf(signature)
+		bySelector[selector] = append(bySelector[selector], signature)
+	}
+	imported := 0
+	for selector, added := range bySelector {
+		selectorJSON, err := readSelector(ctx, req.Storage, selector)
+		if err != nil {
+			return nil, err
+		}
+		if selectorJSON == nil {
+			selectorJSON = &SelectorJSON{}
+		}
+		for _, signature := range added {
+			if !util.Contains(selectorJSON.Signatures, signature) {
+				selectorJSON.Signatures = append(selectorJSON.Signatures, signature)
+				imported++
+			}
+		}
+		sort.Strings(selectorJSON.Signatures)
+		entry, err := logical.StorageEntryJSON(selectorStoragePath(selector), selectorJSON)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"imported": imported,
+			"skipped":  skipped,
+		},
+	}, nil
+}
@@ -0,0 +1,440 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/core-coin/go-core/accounts"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/crypto"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// DefaultSessionTTL is the default lifetime of a session key, in seconds
+	DefaultSessionTTL int = 3600
+	// MaxSessionTTL is the longest lifetime of a session key, in seconds
+	MaxSessionTTL int = 7 * 24 * 3600
+)
+
+// SessionAuthorization is the document by which an account delegates to a session key
+type SessionAuthorization struct {
+	Account   string    `json:"account"`
+	Session   string    `json:"session"`
+	ChainID   string    `json:"chain_id"`
+	Contracts []string  `json:"contracts"`
+	MaxValue  string    `json:"max_value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SessionJSON is a session key and the scope it was authorized for
+type SessionJSON struct {
+	ID            string    `json:"id"`
+	Account       string    `json:"account"`
+	Key           string    `json:"key"`
+	Address       string    `json:"address"`
+	Contracts     []string  `json:"contracts"`
+	MaxValue      string    `json:"max_value"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	Authorization string    `json:"authorization"`
+	Signature     string    `json:"signature"`
+}
+
+func sessionPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sessions/?"),
+			HelpSynopsis: "Issue a session key for an account, or list its session keys.",
+			HelpDescription: `
+
+Generate a new key pair that may sign transactions on behalf of the account
+for a limited scope: only to the given contracts, for no more than max_value
+per transaction, and only until it expires. The account signs the scope and
+the session's address as a personal message; the authorization document and
+its signature are returned so that a contract or an off-chain service can
+check that the session key speaks for the account. The account's own key is
+never used by the session.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"contracts": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The only addresses the session key may send transactions to.",
+				},
+				"max_value": {
+					Type:        framework.TypeString,
+					Default:     "0",
+					Description: "The largest value in wei a single transaction of the session may carry.",
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Default:     DefaultSessionTTL,
+					Description: "The lifetime of the session key.",
+				},
+				"passphrase_shares": passphraseSharesSchema,
+				"authorization_id":  authorizationIDSchema,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation:   b.pathSessionsList,
+				logical.CreateOperation: b.withSigningGuards(b.pathSessionCreate),
+				logical.UpdateOperation: b.withSigningGuards(b.pathSessionCreate),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sessions/" + framework.GenericNameRegex("id")),
+			HelpSynopsis: "Read or revoke a session key.",
+			HelpDescription: `
+
+Return the scope, address and authorization of a session key; its private key
+is never returned. Deleting the session revokes it at once.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"id":   {Type: framework.TypeString, Description: "The ID of the session."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathSessionRead,
+				logical.DeleteOperation: b.pathSessionDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sessions/" + framework.GenericNameRegex("id") + "/sign-tx"),
+			HelpSynopsis: "Sign a transaction with a session key.",
+			HelpDescription: `
+
+Sign a transaction from the session's address, within the scope of the
+session. The policy of the account and of the mount applies as well.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"id":   {Type: framework.TypeString, Description: "The ID of the session."},
+				"to": {
+					Type:        framework.TypeString,
+					Description: "The address of the contract to call.",
+				},
+				"data": {
+					Type:        framework.TypeString,
+					Description: "The hex encoded call data.",
+				},
+				"amount": {
+					Type:        framework.TypeString,
+					Description: "Amount of ETH (in wei).",
+				},
+				"nonce": {
+					Type:        framework.TypeString,
+					Description: "The transaction nonce.",
+				},
+				"gas_limit": {
+					Type:        framework.TypeString,
+					Description: "The gas limit for the transaction - defaults to 21000.",
+					Default:     "21000",
+				},
+				"gas_price": {
+					Type:        framework.TypeString,
+					Description: "The gas price for the transaction in wei.",
+					Default:     "0",
+				},
+				"memo":             memoSchema,
+				"authorization_id": authorizationIDSchema,
+				"mfa_code":         mfaCodeSchema,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.withSigningGuards(b.pathSessionSignTx),
+				logical.UpdateOperation: b.withSigningGuards(b.pathSessionSignTx),
+			},
+		},
+	}
+}
+
+func sessionStoragePath(name, id string) string {
+	return QualifiedPath(fmt.Sprintf("sessions/%s/%s", name, id))
+}
+
+func readSession(ctx context.Context, req *logical.Request, name, id string) (*SessionJSON, error) {
+	entry, err := req.Storage.Get(ctx, sessionStoragePath(name, id))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: session %s of %s", ErrAccountNotFound, id, name)
+	}
+	var session SessionJSON
+	if err := entry.DecodeJSON(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// deleteSessions revokes every session key of an account
+func deleteSessions(ctx context.Context, req *logical.Request, name string) error {
+	ids, err := req.Storage.List(ctx, QualifiedPath(fmt.Sprintf("sessions/%s/", name)))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := req.Storage.Delete(ctx, sessionStoragePath(name, id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (session *SessionJSON) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"id":            session.ID,
+		"account":       session.Account,
+		"address":       session.Address,
+		"contracts":     session.Contracts,
+		"max_value":     session.MaxValue,
+		"expires_at":    session.ExpiresAt.Format(time.RFC3339),
+		"expired":       time.Now().After(session.ExpiresAt),
+		"authorization": session.Authorization,
+		"signature":     session.Signature,
+	}
+}
+
+func (b *PluginBackend) pathSessionsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := req.Storage.List(ctx, QualifiedPath(fmt.Sprintf("sessions/%s/", data.Get("name").(string))))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathSessionCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	wallet, account, err := getWalletAndAccount(ctx, *accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	var contracts []string
+	if contractsRaw, ok := data.GetOk("contracts"); ok {
+		if contracts, err = config.normalizeAddresses(contractsRaw.([]string)); err != nil {
+			return nil, err
+		}
+	}
+	maxValue, ok := new(big.Int).SetString(data.Get("max_value").(string), 10)
+	if !ok || maxValue.Sign() < 0 {
+		return nil, fmt.Errorf("%w: invalid max_value", ErrInvalidInput)
+	}
+	ttl := data.Get("ttl").(int)
+	if ttl <= 0 || ttl > MaxSessionTTL {
+		return nil, fmt.Errorf("%w: ttl must be between 1s and %ds", ErrInvalidInput, MaxSessionTTL)
+	}
+
+	key, err := crypto.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.New()
+	session := &SessionJSON{
+		ID:        id,
+		Account:   name,
+		Key:       hexutil.Encode(crypto.FromEDDSA(key)),
+		Address:   keyAddress(key).Hex(),
+		Contracts: contracts,
+		MaxValue:  maxValue.String(),
+		ExpiresAt: time.Now().UTC().Add(time.Duration(ttl) * time.Second),
+	}
+	authorization, err := json.Marshal(&SessionAuthorization{
+		Account:   account.Address.Hex(),
+		Session:   session.Address,
+		ChainID:   config.ChainID,
+		Contracts: session.Contracts,
+		MaxValue:  session.MaxValue,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	hashedAuthorization, _ := accounts.TextAndHash(authorization)
+	signer, err := accountSigner(ctx, req, name, wallet, *account)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(hashedAuthorization)
+	if err != nil {
+		return nil, err
+	}
+	session.Authorization = string(authorization)
+	session.Signature = hexutil.Encode(signature)
+
+	entry, err := logical.StorageEntryJSON(sessionStoragePath(name, id), session)
+	if err != nil {
+		return nil, err
+	}
+	entry.SealWrap = true
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: session.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathSessionRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	session, err := readSession(ctx, req, data.Get("name").(string), data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: session.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathSessionDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, sessionStoragePath(data.Get("name").(string), data.Get("id").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *PluginBackend) pathSessionSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	chainID := util.ValidNumber(config.ChainID)
+	if chainID == nil {
+		return nil, ErrInvalidChainID
+	}
+	name := data.Get("name").(string)
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+	if accountJSON.Destroyed {
+		return nil, fmt.Errorf("%w: account %s has been destroyed", ErrAccountNotFound, name)
+	}
+	if err := checkChainPin(ctx, config, accountJSON); err != nil {
+		return nil, err
+	}
+	session, err := readSession(ctx, req, name, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		err = fmt.Errorf("%w: session %s has expired", ErrApprovalRequired, session.ID)
+		recordRule(ctx, "session", err)
+		return nil, err
+	}
+	var callData []byte
+	if dataRaw := data.Get("data").(string); dataRaw != Empty {
+		if callData, err = util.Decode([]byte(dataRaw)); err != nil {
+			return nil, wrapError(ErrInvalidInput, err)
+		}
+	}
+	keyBytes, err := hexutil.Decode(session.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer util.ZeroBytes(keyBytes)
+	key, err := crypto.ToEDDSA(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	from := keyAddress(key)
+
+	client, err := b.dialRPC(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	transactionParams, err := b.getData(ctx, config, client, from, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(session.Contracts) > 0 && !util.ContainsAddress(session.Contracts, *transactionParams.Address) {
+		err = fmt.Errorf("%w: %s is not a contract of session %s", ErrPolicyViolation, transactionParams.Address.Hex(), session.ID)
+	} else if maxValue := util.ValidNumber(session.MaxValue); maxValue == nil || transactionParams.Amount.Cmp(maxValue) > 0 {
+		err = fmt.Errorf("%w: amount exceeds the session's max_value of %s", ErrPolicyViolation, session.MaxValue)
+	}
+	recordRule(ctx, "session", err)
+	if err != nil {
+		return nil, err
+	}
+	accountJSON.Inclusions = append(accountJSON.Inclusions, config.Inclusions...)
+	if len(accountJSON.Inclusions) > 0 && !util.ContainsAddress(accountJSON.Inclusions, *transactionParams.Address) {
+		return nil, fmt.Errorf("%w: %s violates the set of inclusions %+v", ErrPolicyViolation, transactionParams.Address.Hex(), accountJSON.Inclusions)
+	}
+	if err := config.ValidAddress(transactionParams.Address); err != nil {
+		return nil, err
+	}
+	if err := accountJSON.ValidAddress(transactionParams.Address); err != nil {
+		return nil, err
+	}
+
+	tx := types.NewTransaction(transactionParams.Nonce, *transactionParams.Address, transactionParams.Amount, transactionParams.GasLimit, transactionParams.GasPrice, callData)
+	if err := b.checkTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	signedTx, err := signCoreTransaction(chainID, keySigner(key), tx)
+	if err != nil {
+		return nil, err
+	}
+	var signedTxBuff bytes.Buffer
+	signedTx.EncodeRLP(&signedTxBuff)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"transaction_hash":   signedTx.Hash().Hex(),
+			"signed_transaction": hexutil.Encode(signedTxBuff.Bytes()),
+			"session":            session.ID,
+			"from":               from.Hex(),
+			"to":                 transactionParams.Address.String(),
+			"amount":             transactionParams.Amount.String(),
+			"nonce":              strconv.FormatUint(transactionParams.Nonce, 10),
+			"gas_price":          transactionParams.GasPrice.String(),
+			"gas_limit":          strconv.FormatUint(transactionParams.GasLimit, 10),
+		},
+	}, nil
+}
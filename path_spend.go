@@ -0,0 +1,210 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	spendPeriodDay   string = "day"
+	spendPeriodMonth string = "month"
+
+	formatJSON string = "json"
+	formatCSV  string = "csv"
+)
+
+// spendPeriod aggregates what an account sent and paid in fees during one day or month
+type spendPeriod struct {
+	Period       string
+	Transactions int
+	Pending      int
+	Value        *big.Int
+	Fees         *big.Int
+	Tokens       map[string]*big.Int
+}
+
+func (p *spendPeriod) add(tx *TxJSON) {
+	p.Transactions++
+	if value, ok := new(big.Int).SetString(tx.Value, 10); ok {
+		p.Value.Add(p.Value, value)
+	}
+	if tx.BlockHash == Empty {
+		// the fee is only known once the transaction is mined
+		p.Pending++
+	} else if energyPrice, ok := new(big.Int).SetString(tx.EnergyPrice, 10); ok {
+		p.Fees.Add(p.Fees, new(big.Int).Mul(energyPrice, new(big.Int).SetUint64(tx.EnergyUsed)))
+	}
+	if tx.Token != Empty {
+		amount, ok := new(big.Int).SetString(tx.TokenAmount, 10)
+		if !ok {
+			return
+		}
+		if _, ok := p.Tokens[tx.Token]; !ok {
+			p.Tokens[tx.Token] = new(big.Int)
+		}
+		p.Tokens[tx.Token].Add(p.Tokens[tx.Token], amount)
+	}
+}
+
+func (p *spendPeriod) responseData() map[string]interface{} {
+	tokens := make(map[string]interface{}, len(p.Tokens))
+	for token, amount := range p.Tokens {
+		tokens[token] = amount.String()
+	}
+	return map[string]interface{}{
+		"period":       p.Period,
+		"transactions": p.Transactions,
+		"pending":      p.Pending,
+		"value":        p.Value.String(),
+		"fees":         p.Fees.String(),
+		"tokens":       tokens,
+	}
+}
+
+func spendPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/spend-report"),
+			HelpSynopsis: "Report the value sent and fees paid by an account.",
+			HelpDescription: `
+
+Aggregate the transactions this mount broadcast for an account by day or
+month: the number of transactions, the value sent in wei, the fees paid in wei
+and the amount of each token transferred. Fees of transactions that are not
+mined yet are not included; they are counted as pending.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"period": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{spendPeriodDay, spendPeriodMonth},
+					Default:       spendPeriodMonth,
+					Description:   "The period to aggregate by: day or month.",
+				},
+				"format": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{formatJSON, formatCSV},
+					Default:       formatJSON,
+					Description:   "The report format: json or csv.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathSpendReport,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathSpendReport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	if _, err := readAccount(ctx, req, name); err != nil {
+		return nil, err
+	}
+	var layout string
+	switch period := data.Get("period").(string); period {
+	case spendPeriodDay:
+		layout = "2006-01-02"
+	case spendPeriodMonth:
+		layout = "2006-01"
+	default:
+		return nil, fmt.Errorf("%w: unknown period %s", ErrInvalidInput, period)
+	}
+	format := data.Get("format").(string)
+	if format != formatJSON && format != formatCSV {
+		return nil, fmt.Errorf("%w: unknown format %s", ErrInvalidInput, format)
+	}
+
+	hashes, err := req.Storage.List(ctx, QualifiedPath("tx/"))
+	if err != nil {
+		return nil, err
+	}
+	periods := make(map[string]*spendPeriod)
+	for _, hash := range hashes {
+		tx, err := readTx(ctx, req.Storage, common.HexToHash(hash))
+		if err != nil {
+			return nil, err
+		}
+		if tx.Account != name || tx.Status == txReorged {
+			continue
+		}
+		key := tx.SubmittedAt.UTC().Format(layout)
+		if _, ok := periods[key]; !ok {
+			periods[key] = &spendPeriod{Period: key, Value: new(big.Int), Fees: new(big.Int), Tokens: make(map[string]*big.Int)}
+		}
+		periods[key].add(tx)
+	}
+	var keys []string
+	for key := range periods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if format == formatCSV {
+		return spendReportCSV(keys, periods)
+	}
+	report := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		report = append(report, periods[key].responseData())
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"account": name,
+			"periods": report,
+		},
+	}, nil
+}
+
+// spendReportCSV writes one row per period for the native currency and one per token
+func spendReportCSV(keys []string, periods map[string]*spendPeriod) (*logical.Response, error) {
+	var buff bytes.Buffer
+	writer := csv.NewWriter(&buff)
+	writer.Write([]string{"period", "asset", "transactions", "pending", "value", "fees"})
+	for _, key := range keys {
+		period := periods[key]
+		writer.Write([]string{period.Period, Symbol, strconv.Itoa(period.Transactions), strconv.Itoa(period.Pending), period.Value.String(), period.Fees.String()})
+		var tokens []string
+		for token := range period.Tokens {
+			tokens = append(tokens, token)
+		}
+		sort.Strings(tokens)
+		for _, token := range tokens {
+			writer.Write([]string{period.Period, token, Empty, Empty, period.Tokens[token].String(), Empty})
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "text/csv",
+			logical.HTTPRawBody:     buff.Bytes(),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
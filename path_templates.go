@@ -0,0 +1,538 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/common/math"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/rlp"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// TemplateJSON is a transaction with placeholders that callers fill in with
+// parameters of the declared types and ranges
+type TemplateJSON struct {
+	Account string `json:"account"`
+	// To, Amount and Data may hold {{parameter}} placeholders; in Data each
+	// is replaced with the 32 byte ABI encoding of the parameter
+	To         string                        `json:"to"`
+	Amount     string                        `json:"amount"`
+	Data       string                        `json:"data"`
+	Parameters map[string]*TemplateParameter `json:"parameters"`
+	GasLimit   string                        `json:"gas_limit"`
+	GasPrice   string                        `json:"gas_price"`
+	// MaxGasPrice refuses to sign when the gas price, such as the node suggests it, is higher
+	MaxGasPrice string `json:"max_gas_price"`
+	// Send broadcasts what execute signs
+	Send bool `json:"send"`
+}
+
+// TemplateParameter declares a parameter of a template
+type TemplateParameter struct {
+	// Type is address, bool, bytes32, uint<N> or int<N>
+	Type    string   `json:"type"`
+	Min     string   `json:"min,omitempty"`
+	Max     string   `json:"max,omitempty"`
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	integerTypePattern = regexp.MustCompile(`^(u?)int([0-9]*)$`)
+)
+
+func templateStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("templates/%s", name))
+}
+
+func templatePaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("templates/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathTemplatesList,
+			},
+			HelpSynopsis: "List the transaction templates.",
+			HelpDescription: `
+			All the transaction templates will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("templates/" + framework.GenericNameRegex("name")),
+			HelpSynopsis: "Create, read, update or delete a transaction template.",
+			HelpDescription: `
+
+A template is a transaction from an account with {{parameter}} placeholders
+in to, amount and data. Every parameter is declared in parameters with its
+type (address, bool, bytes32, uint<N> or int<N>) and optionally min, max and
+allowed values. In data each placeholder becomes the 32 byte ABI encoding of
+the parameter, so a token transfer is 0x<selector>{{recipient}}{{amount}}.
+Automation that may only execute templates can only sign transactions of
+those shapes.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the template."},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "The account that signs the transaction.",
+				},
+				"to": {
+					Type:        framework.TypeString,
+					Description: "The recipient, or a placeholder for an address parameter.",
+				},
+				"amount": {
+					Type:        framework.TypeString,
+					Default:     "0",
+					Description: "The amount in wei, or a placeholder for an integer parameter.",
+				},
+				"data": {
+					Type:        framework.TypeString,
+					Description: "Hex encoded calldata with placeholders.",
+				},
+				"parameters": {
+					Type:        framework.TypeMap,
+					Description: `The parameters, as {"amount": {"type": "uint256", "max": "1000e18"}}.`,
+				},
+				"gas_limit": {
+					Type:        framework.TypeString,
+					Default:     "21000",
+					Description: "The gas limit of the transaction.",
+				},
+				"gas_price": {
+					Type:        framework.TypeString,
+					Default:     "0",
+					Description: "The gas price in wei; 0 uses the price the node suggests.",
+				},
+				"max_gas_price": {
+					Type:        framework.TypeString,
+					Description: "Refuse to sign when the gas price is higher than this.",
+				},
+				"send": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Broadcast the transaction execute signs.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathTemplateRead,
+				logical.CreateOperation: b.pathTemplateWrite,
+				logical.UpdateOperation: b.pathTemplateWrite,
+				logical.DeleteOperation: b.pathTemplateDelete,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("templates/" + framework.GenericNameRegex("name") + "/execute"),
+			HelpSynopsis: "Sign, and send if the template says so, a transaction from a template.",
+			HelpDescription: `
+
+Fill in the placeholders of a template with parameters, which must be exactly
+the declared ones and within their types and ranges, then sign the
+transaction as sign-tx of the template's account does, under the same
+policies. With send set on the template it is broadcast and tracked as well.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the template."},
+				"parameters": {
+					Type:        framework.TypeMap,
+					Description: "The values of the parameters of the template.",
+				},
+				"passphrase_shares": passphraseSharesSchema,
+				"memo":              memoSchema,
+				"authorization_id":  authorizationIDSchema,
+				"mfa_code":          mfaCodeSchema,
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.pathTemplateExecute,
+				logical.UpdateOperation: b.pathTemplateExecute,
+			},
+		},
+	}
+}
+
+func readTemplate(ctx context.Context, s logical.Storage, name string) (*TemplateJSON, error) {
+	entry, err := s.Get(ctx, templateStoragePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: no template %s", ErrInvalidInput, name)
+	}
+	var template TemplateJSON
+	if err := entry.DecodeJSON(&template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (template *TemplateJSON) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"account":       template.Account,
+		"to":            template.To,
+		"amount":        template.Amount,
+		"data":          template.Data,
+		"parameters":    template.Parameters,
+		"gas_limit":     template.GasLimit,
+		"gas_price":     template.GasPrice,
+		"max_gas_price": template.MaxGasPrice,
+		"send":          template.Send,
+	}
+}
+
+// integerBits returns the size and signedness of an integer type, or 0 if it is not one
+func integerBits(typ string) (int, bool) {
+	match := integerTypePattern.FindStringSubmatch(typ)
+	if match == nil {
+		return 0, false
+	}
+	bits := 256
+	if match[2] != Empty {
+		bits, _ = strconv.Atoi(match[2])
+		if bits == 0 || bits > 256 || bits%8 != 0 {
+			return 0, false
+		}
+	}
+	return bits, match[1] == Empty
+}
+
+// validate checks the declaration of a parameter
+func (parameter *TemplateParameter) validate(name string) error {
+	switch parameter.Type {
+	case "address", "bool", "bytes32":
+		if parameter.Min != Empty || parameter.Max != Empty {
+			return fmt.Errorf("%w: parameter %s: only integers have a min or max", ErrInvalidInput, name)
+		}
+		return nil
+	}
+	if bits, _ := integerBits(parameter.Type); bits == 0 {
+		return fmt.Errorf("%w: parameter %s: unknown type %q", ErrInvalidInput, name, parameter.Type)
+	}
+	for _, bound := range []string{parameter.Min, parameter.Max} {
+		if bound != Empty && parseRuleNumber(bound) == nil {
+			return fmt.Errorf("%w: parameter %s: %s is not an integer", ErrInvalidInput, name, bound)
+		}
+	}
+	return nil
+}
+
+// encode checks a value against the parameter and returns it as text, for
+// to and amount, and as its 32 byte ABI word, for data
+func (parameter *TemplateParameter) encode(config *ConfigJSON, name string, raw interface{}) (string, []byte, error) {
+	value := strings.TrimSpace(fmt.Sprint(raw))
+	if number, ok := raw.(json.Number); ok {
+		value = number.String()
+	}
+	if len(parameter.Allowed) > 0 {
+		allowed := false
+		for _, candidate := range parameter.Allowed {
+			allowed = allowed || ruleValuesEqual(value, candidate)
+		}
+		if !allowed {
+			return Empty, nil, fmt.Errorf("%w: parameter %s is not one of the allowed values", ErrPolicyViolation, name)
+		}
+	}
+	word := make([]byte, 32)
+	switch parameter.Type {
+	case "address":
+		address, err := config.parseAddress(value)
+		if err != nil {
+			return Empty, nil, fmt.Errorf("%w: parameter %s: %v", ErrInvalidAddress, name, err)
+		}
+		copy(word[32-len(address):], address[:])
+		return address.Hex(), word, nil
+	case "bool":
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return Empty, nil, fmt.Errorf("%w: parameter %s is not a bool", ErrInvalidInput, name)
+		}
+		if flag {
+			word[31] = 1
+		}
+		return strconv.FormatBool(flag), word, nil
+	case "bytes32":
+		decoded, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+		if err != nil || len(decoded) > 32 {
+			return Empty, nil, fmt.Errorf("%w: parameter %s is not at most 32 hex encoded bytes", ErrInvalidInput, name)
+		}
+		copy(word, decoded)
+		return hexutil.Encode(word), word, nil
+	}
+	number := parseRuleNumber(value)
+	if number == nil {
+		return Empty, nil, fmt.Errorf("%w: parameter %s is not an integer", ErrInvalidInput, name)
+	}
+	bits, signed := integerBits(parameter.Type)
+	low, high := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if signed {
+		high.Rsh(high, 1)
+		low.Neg(high)
+	}
+	if number.Cmp(low) < 0 || number.Cmp(high) >= 0 {
+		return Empty, nil, fmt.Errorf("%w: parameter %s does not fit in %s", ErrInvalidInput, name, parameter.Type)
+	}
+	if parameter.Min != Empty && number.Cmp(parseRuleNumber(parameter.Min)) < 0 {
+		return Empty, nil, fmt.Errorf("%w: parameter %s is below its min of %s", ErrPolicyViolation, name, parameter.Min)
+	}
+	if parameter.Max != Empty && number.Cmp(parseRuleNumber(parameter.Max)) > 0 {
+		return Empty, nil, fmt.Errorf("%w: parameter %s is above its max of %s", ErrPolicyViolation, name, parameter.Max)
+	}
+	return number.String(), math.PaddedBigBytes(math.U256(new(big.Int).Set(number)), 32), nil
+}
+
+// placeholders returns the parameters a field refers to
+func placeholders(field string) []string {
+	var names []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(field, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// render fills in the placeholders of the template
+func (template *TemplateJSON) render(config *ConfigJSON, parameters map[string]interface{}) (to, amount, data string, err error) {
+	for name := range parameters {
+		if template.Parameters[name] == nil {
+			return Empty, Empty, Empty, fmt.Errorf("%w: the template has no parameter %s", ErrInvalidInput, name)
+		}
+	}
+	texts := map[string]string{}
+	words := map[string]string{}
+	for name, parameter := range template.Parameters {
+		raw, ok := parameters[name]
+		if !ok {
+			return Empty, Empty, Empty, fmt.Errorf("%w: parameter %s is required", ErrInvalidInput, name)
+		}
+		text, word, err := parameter.encode(config, name, raw)
+		if err != nil {
+			return Empty, Empty, Empty, err
+		}
+		texts[name] = text
+		words[name] = hex.EncodeToString(word)
+	}
+	fill := func(field string, values map[string]string) string {
+		return placeholderPattern.ReplaceAllStringFunc(field, func(match string) string {
+			return values[placeholderPattern.FindStringSubmatch(match)[1]]
+		})
+	}
+	return fill(template.To, texts), fill(template.Amount, texts), strings.TrimPrefix(fill(template.Data, words), "0x"), nil
+}
+
+func (b *PluginBackend) pathTemplatesList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := req.Storage.List(ctx, QualifiedPath("templates/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *PluginBackend) pathTemplateRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	template, err := readTemplate(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: template.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathTemplateWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	template := &TemplateJSON{
+		Account:     data.Get("account").(string),
+		To:          strings.TrimSpace(data.Get("to").(string)),
+		Amount:      strings.TrimSpace(data.Get("amount").(string)),
+		Data:        strings.TrimSpace(data.Get("data").(string)),
+		Parameters:  map[string]*TemplateParameter{},
+		GasLimit:    data.Get("gas_limit").(string),
+		GasPrice:    data.Get("gas_price").(string),
+		MaxGasPrice: data.Get("max_gas_price").(string),
+		Send:        data.Get("send").(bool),
+	}
+	if _, err := readAccount(ctx, req, template.Account); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(data.Get("parameters"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encoded, &template.Parameters); err != nil {
+		return nil, fmt.Errorf("%w: parameters: %v", ErrInvalidInput, err)
+	}
+	for name, parameter := range template.Parameters {
+		if parameter == nil || !placeholderPattern.MatchString("{{"+name+"}}") {
+			return nil, fmt.Errorf("%w: invalid parameter %s", ErrInvalidInput, name)
+		}
+		if err := parameter.validate(name); err != nil {
+			return nil, err
+		}
+	}
+	for field, value := range map[string]string{"to": template.To, "amount": template.Amount, "data": template.Data} {
+		for _, name := range placeholders(value) {
+			if template.Parameters[name] == nil {
+				return nil, fmt.Errorf("%w: %s refers to the undeclared parameter %s", ErrInvalidInput, field, name)
+			}
+		}
+	}
+	// a placeholder must stand for the whole of to or amount
+	if names := placeholders(template.To); len(names) > 0 {
+		if placeholderPattern.ReplaceAllString(template.To, Empty) != Empty || template.Parameters[names[0]].Type != "address" {
+			return nil, fmt.Errorf("%w: to must be an address or a placeholder for an address parameter", ErrInvalidInput)
+		}
+	} else if _, err := config.parseAddress(template.To); err != nil {
+		return nil, wrapError(ErrInvalidAddress, err)
+	}
+	if names := placeholders(template.Amount); len(names) > 0 {
+		if placeholderPattern.ReplaceAllString(template.Amount, Empty) != Empty {
+			return nil, fmt.Errorf("%w: amount must be a number or a placeholder for an integer parameter", ErrInvalidInput)
+		}
+		if bits, _ := integerBits(template.Parameters[names[0]].Type); bits == 0 {
+			return nil, fmt.Errorf("%w: amount must be a placeholder for an integer parameter", ErrInvalidInput)
+		}
+	} else if parseRuleNumber(template.Amount) == nil {
+		return nil, fmt.Errorf("%w: invalid amount", ErrInvalidInput)
+	}
+	if _, err := hex.DecodeString(strings.TrimPrefix(placeholderPattern.ReplaceAllString(template.Data, strings.Repeat("00", 32)), "0x")); err != nil {
+		return nil, fmt.Errorf("%w: data is not hex with placeholders", ErrInvalidInput)
+	}
+	if template.MaxGasPrice != Empty && parseRuleNumber(template.MaxGasPrice) == nil {
+		return nil, fmt.Errorf("%w: invalid max_gas_price", ErrInvalidInput)
+	}
+	entry, err := logical.StorageEntryJSON(templateStoragePath(data.Get("name").(string)), template)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: template.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathTemplateDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, templateStoragePath(data.Get("name").(string)))
+}
+
+func (b *PluginBackend) pathTemplateExecute(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	return b.executeTemplate(ctx, req, name, data.Get("parameters").(map[string]interface{}), data.Get("passphrase_shares").([]string))
+}
+
+// executeTemplate signs a transaction from a template through sign-tx, and
+// sends it if the template says so
+func (b *PluginBackend) executeTemplate(ctx context.Context, req *logical.Request, name string, parameters map[string]interface{}, shares []string) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	template, err := readTemplate(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	to, amount, calldata, err := template.render(config, parameters)
+	if err != nil {
+		return nil, err
+	}
+	var signTx *framework.Path
+	for _, path := range accountPaths(b) {
+		if strings.HasSuffix(path.Pattern, "/sign-tx") {
+			signTx = path
+		}
+	}
+	raw := map[string]interface{}{
+		"name":      template.Account,
+		"to":        to,
+		"amount":    amount,
+		"data":      calldata,
+		"encoding":  HexEncoding,
+		"gas_limit": template.GasLimit,
+		"gas_price": template.GasPrice,
+	}
+	if len(shares) > 0 {
+		raw["passphrase_shares"] = shares
+	}
+	if memo, ok := req.Data["memo"]; ok {
+		raw["memo"] = memo
+	}
+	resp, err := b.withSigningGuards(b.pathSignTx)(ctx, req, &framework.FieldData{Raw: raw, Schema: signTx.Fields})
+	if err != nil || resp == nil || resp.IsError() {
+		return resp, err
+	}
+	if template.MaxGasPrice != Empty {
+		gasPrice := parseRuleNumber(fmt.Sprint(resp.Data["gas_price"]))
+		if gasPrice == nil || gasPrice.Cmp(parseRuleNumber(template.MaxGasPrice)) > 0 {
+			return nil, fmt.Errorf("%w: the gas price of %v is above the template's max_gas_price of %s", ErrPolicyViolation, resp.Data["gas_price"], template.MaxGasPrice)
+		}
+	}
+	resp.Data["template"] = name
+	resp.Data["parameters"] = parameters
+	if !template.Send {
+		return resp, nil
+	}
+	encoded, err := hexutil.Decode(resp.Data["signed_transaction"].(string))
+	if err != nil {
+		return nil, err
+	}
+	var signedTx types.Transaction
+	if err := rlp.DecodeBytes(encoded, &signedTx); err != nil {
+		return nil, err
+	}
+	// the transaction is sent the way its account broadcasts
+	ctx, err = b.withBroadcast(ctx, req, template.Account)
+	if err != nil {
+		return nil, err
+	}
+	client, err := b.dialRPC(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, &signedTx); err != nil {
+		return nil, classifySendError(err)
+	}
+	if err := trackTransaction(ctx, req, template.Account, &signedTx); err != nil {
+		return nil, err
+	}
+	resp.Data["sent"] = true
+	return resp, nil
+}
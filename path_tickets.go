@@ -0,0 +1,420 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/wrapping"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// DefaultSignTicketTTL is how long a sign ticket may wait for its redemption, in seconds
+	DefaultSignTicketTTL int = 300
+	maxSignTicketTTL     int = 86400
+
+	ticketIssued   string = "issued"
+	ticketRedeemed string = "redeemed"
+	ticketRevoked  string = "revoked"
+	ticketExpired  string = "expired"
+)
+
+// ticketOperations are the signing requests of an account a sign ticket can describe
+var ticketOperations = []string{"transfer", "sign-tx", "deploy", "sign", "sign-digest"}
+
+// ticketLock serializes redemptions, so a ticket cannot be redeemed twice
+var ticketLock sync.Mutex
+
+// SignTicketJSON is one signing request of an account, described in full by
+// its issuer, that whoever holds the ticket can make once
+type SignTicketJSON struct {
+	ID         string                 `json:"id"`
+	Account    string                 `json:"account"`
+	Operation  string                 `json:"operation"`
+	Parameters map[string]interface{} `json:"parameters"`
+	// SecretHash is the SHA-256 of the secret half of the ticket; the secret is never stored
+	SecretHash       string    `json:"secret_hash"`
+	IssuerEntityID   string    `json:"issuer_entity_id,omitempty"`
+	RedeemerEntityID string    `json:"redeemer_entity_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RedeemedAt       time.Time `json:"redeemed_at"`
+	RedeemedBy       string    `json:"redeemed_by,omitempty"`
+	RevokedAt        time.Time `json:"revoked_at"`
+}
+
+func (ticket *SignTicketJSON) status(now time.Time) string {
+	switch {
+	case !ticket.RedeemedAt.IsZero():
+		return ticketRedeemed
+	case !ticket.RevokedAt.IsZero():
+		return ticketRevoked
+	case now.After(ticket.ExpiresAt):
+		return ticketExpired
+	}
+	return ticketIssued
+}
+
+func (ticket *SignTicketJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"id":         ticket.ID,
+		"account":    ticket.Account,
+		"operation":  ticket.Operation,
+		"parameters": ticket.Parameters,
+		"status":     ticket.status(time.Now()),
+		"created_at": ticket.CreatedAt.UTC().Format(time.RFC3339),
+		"expires_at": ticket.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	for key, value := range map[string]string{
+		"issuer_entity_id":   ticket.IssuerEntityID,
+		"redeemer_entity_id": ticket.RedeemerEntityID,
+		"redeemed_by":        ticket.RedeemedBy,
+	} {
+		if value != Empty {
+			result[key] = value
+		}
+	}
+	if !ticket.RedeemedAt.IsZero() {
+		result["redeemed_at"] = ticket.RedeemedAt.UTC().Format(time.RFC3339)
+	}
+	if !ticket.RevokedAt.IsZero() {
+		result["revoked_at"] = ticket.RevokedAt.UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+func ticketPaths(b *PluginBackend) []*framework.Path {
+	idField := map[string]*framework.FieldSchema{
+		"id": {Type: framework.TypeString, Description: "The ID of the sign ticket."},
+	}
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("accounts/" + framework.GenericNameRegex("name") + "/sign-tickets"),
+			HelpSynopsis: "Issue a single-use ticket for one signing request of an account.",
+			HelpDescription: `
+
+Describe one signing request of the account - operation is transfer, sign-tx,
+deploy, sign or sign-digest and parameters are all of its parameters - and
+receive a ticket that makes exactly that request once. A service that holds
+the ticket redeems it through sign-tickets/redeem without any capability on
+the account, so one service can decide what is signed and another carry it
+out. Every policy of the account applies at redemption, as the issuer; a warm
+account's request needs authorization_id among the parameters.
+
+The response is wrapped for ttl seconds, so the ticket travels as a
+single-use wrapping token. If redeemer_entity_id is set, only that entity can
+redeem it. Passphrase shares are never part of a ticket; the redeemer
+supplies them. Nor is an MFA code, which would expire before most
+redemptions.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"name": {Type: framework.TypeString, Description: "The name of the account."},
+				"operation": {
+					Type:        framework.TypeString,
+					Description: "The signing request: transfer, sign-tx, deploy, sign or sign-digest.",
+				},
+				"parameters": {
+					Type:        framework.TypeMap,
+					Description: "The parameters of the request.",
+				},
+				"ttl": {
+					Type:        framework.TypeInt,
+					Default:     DefaultSignTicketTTL,
+					Description: "How long the ticket can be redeemed, in seconds.",
+				},
+				"redeemer_entity_id": {
+					Type:        framework.TypeString,
+					Description: "The only entity that can redeem the ticket; anyone holding it if empty.",
+				},
+			},
+			ExistenceCheck: pathExistenceCheck,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: b.unlessFrozen(b.pathTicketIssue),
+				logical.UpdateOperation: b.unlessFrozen(b.pathTicketIssue),
+			},
+		},
+		{
+			Pattern:      QualifiedPath("sign-tickets/redeem"),
+			HelpSynopsis: "Make the signing request a sign ticket describes.",
+			HelpDescription: `
+
+Redeem a ticket: the request it describes is made and its response returned.
+The ticket is used up by the redemption whatever the outcome; a refused
+request needs a new ticket.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"ticket": {
+					Type:        framework.TypeString,
+					Description: "The ticket, as issued.",
+				},
+				"passphrase_shares": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Passphrase shares that unseal a sealed account for this request.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathTicketRedeem,
+			},
+		},
+		{
+			Pattern: QualifiedPath("sign-tickets/?"),
+			Fields:  listPageSchema(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathTicketsList,
+			},
+			HelpSynopsis: "List all the sign tickets.",
+			HelpDescription: `
+			All the sign tickets will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("sign-tickets/" + framework.GenericNameRegex("id")),
+			HelpSynopsis: "Return a sign ticket: what it describes and whether it is issued, redeemed, revoked or expired.",
+			Fields:       idField,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathTicketRead,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("sign-tickets/" + framework.GenericNameRegex("id") + "/revoke"),
+			HelpSynopsis: "Revoke a sign ticket that has not been redeemed.",
+			Fields:       idField,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathTicketRevoke,
+			},
+		},
+	}
+}
+
+func ticketStoragePath(id string) string {
+	return QualifiedPath(fmt.Sprintf("sign-tickets/%s", id))
+}
+
+func readTicket(ctx context.Context, s logical.Storage, id string) (*SignTicketJSON, error) {
+	entry, err := s.Get(ctx, ticketStoragePath(id))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: no sign ticket %s", ErrInvalidInput, id)
+	}
+	var ticket SignTicketJSON
+	if err := entry.DecodeJSON(&ticket); err != nil {
+		return nil, err
+	}
+	return &ticket, nil
+}
+
+func writeTicket(ctx context.Context, s logical.Storage, ticket *SignTicketJSON) error {
+	entry, err := logical.StorageEntryJSON(ticketStoragePath(ticket.ID), ticket)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// ticketOperation returns the account path of an operation a ticket can describe
+func ticketOperation(b *PluginBackend, operation string) (*framework.Path, error) {
+	if util.Contains(ticketOperations, operation) {
+		for _, path := range accountPaths(b) {
+			if strings.HasSuffix(path.Pattern, "/"+operation) {
+				return path, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: operation must be one of %s", ErrInvalidInput, strings.Join(ticketOperations, ", "))
+}
+
+func (b *PluginBackend) pathTicketIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	name := data.Get("name").(string)
+	if _, err := readAccount(ctx, req, name); err != nil {
+		return nil, err
+	}
+	operation := data.Get("operation").(string)
+	path, err := ticketOperation(b, operation)
+	if err != nil {
+		return nil, err
+	}
+	parameters := data.Get("parameters").(map[string]interface{})
+	for key := range parameters {
+		if _, ok := path.Fields[key]; !ok || key == "name" || key == "passphrase_shares" || key == "mfa_code" {
+			return nil, fmt.Errorf("%w: %s is not a parameter a ticket for %s can carry", ErrInvalidInput, key, operation)
+		}
+	}
+	if err := (&framework.FieldData{Raw: parameters, Schema: path.Fields}).Validate(); err != nil {
+		return nil, wrapError(ErrInvalidInput, err)
+	}
+	ttl := data.Get("ttl").(int)
+	if ttl <= 0 || ttl > maxSignTicketTTL {
+		return nil, fmt.Errorf("%w: ttl must be 1 to %d seconds", ErrInvalidInput, maxSignTicketTTL)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	secretHash := sha256.Sum256(secret)
+	now := time.Now()
+	ticket := &SignTicketJSON{
+		ID:               uuid.New(),
+		Account:          name,
+		Operation:        operation,
+		Parameters:       parameters,
+		SecretHash:       hex.EncodeToString(secretHash[:]),
+		IssuerEntityID:   req.EntityID,
+		RedeemerEntityID: data.Get("redeemer_entity_id").(string),
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(time.Duration(ttl) * time.Second),
+	}
+	if err := writeTicket(ctx, req.Storage, ticket); err != nil {
+		return nil, err
+	}
+	b.recordActivity(ctx, req, name, &ActivityJSON{Event: "sign_ticket_issued"}, nil, nil)
+	responseData := ticket.responseData()
+	responseData["ticket"] = ticket.ID + "." + hex.EncodeToString(secret)
+	return &logical.Response{
+		Data:     responseData,
+		WrapInfo: &wrapping.ResponseWrapInfo{TTL: time.Duration(ttl) * time.Second},
+	}, nil
+}
+
+// redeemTicket uses up the ticket a redemption presents
+func redeemTicket(ctx context.Context, req *logical.Request, presented string) (*SignTicketJSON, error) {
+	parts := strings.SplitN(presented, ".", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%w: the ticket is malformed", ErrInvalidInput)
+	}
+	id := parts[0]
+	decoded, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: the ticket is malformed", ErrInvalidInput)
+	}
+	ticketLock.Lock()
+	defer ticketLock.Unlock()
+	ticket, err := readTicket(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+	secretHash := sha256.Sum256(decoded)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(secretHash[:])), []byte(ticket.SecretHash)) != 1 {
+		return nil, fmt.Errorf("%w: the ticket is not valid", ErrSourceUnauthorized)
+	}
+	if status := ticket.status(time.Now()); status != ticketIssued {
+		return nil, fmt.Errorf("%w: the ticket is %s", ErrApprovalRequired, status)
+	}
+	if ticket.RedeemerEntityID != Empty && ticket.RedeemerEntityID != req.EntityID {
+		return nil, fmt.Errorf("%w: the ticket is for another redeemer", ErrSourceUnauthorized)
+	}
+	ticket.RedeemedAt = time.Now()
+	ticket.RedeemedBy = req.EntityID
+	if err := writeTicket(ctx, req.Storage, ticket); err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+func (b *PluginBackend) pathTicketRedeem(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := redeemTicket(ctx, req, data.Get("ticket").(string))
+	if err != nil {
+		return nil, err
+	}
+	path, err := ticketOperation(b, ticket.Operation)
+	if err != nil {
+		return nil, err
+	}
+	parameters := make(map[string]interface{}, len(ticket.Parameters)+1)
+	for key, value := range ticket.Parameters {
+		parameters[key] = value
+	}
+	if shares := data.Get("passphrase_shares").([]string); len(shares) > 0 {
+		parameters["passphrase_shares"] = shares
+	}
+	raw := map[string]interface{}{"name": ticket.Account}
+	for key, value := range parameters {
+		raw[key] = value
+	}
+	// the request is made as the issuer, on the account path, so it is
+	// authorized, limited and logged as if the issuer had made it
+	redemption := *req
+	redemption.Path = fmt.Sprintf("accounts/%s/%s", ticket.Account, ticket.Operation)
+	redemption.Data = parameters
+	redemption.EntityID = ticket.IssuerEntityID
+	resp, err := path.Callbacks[logical.UpdateOperation](ctx, &redemption, &framework.FieldData{Raw: raw, Schema: path.Fields})
+	if err != nil || resp == nil || resp.IsError() {
+		return resp, err
+	}
+	resp.Data["ticket_id"] = ticket.ID
+	return resp, nil
+}
+
+func (b *PluginBackend) pathTicketsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ids, err := req.Storage.List(ctx, QualifiedPath("sign-tickets/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(listPage(ids, data)), nil
+}
+
+func (b *PluginBackend) pathTicketRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ticket, err := readTicket(ctx, req.Storage, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: ticket.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathTicketRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ticketLock.Lock()
+	defer ticketLock.Unlock()
+	ticket, err := readTicket(ctx, req.Storage, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if status := ticket.status(time.Now()); status != ticketIssued {
+		return nil, fmt.Errorf("%w: the ticket is %s", ErrInvalidInput, status)
+	}
+	ticket.RevokedAt = time.Now()
+	if err := writeTicket(ctx, req.Storage, ticket); err != nil {
+		return nil, err
+	}
+	b.recordActivity(ctx, req, ticket.Account, &ActivityJSON{Event: "sign_ticket_revoked"}, nil, nil)
+	return &logical.Response{
+		Data: ticket.responseData(),
+	}, nil
+}
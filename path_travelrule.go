@@ -0,0 +1,395 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// travelRuleKeys are the top-level members of an IVMS101 payload
+var travelRuleKeys = map[string]bool{
+	"originator":      true,
+	"beneficiary":     true,
+	"originatingVASP": true,
+	"beneficiaryVASP": true,
+	"transferPath":    true,
+	"payloadMetadata": true,
+}
+
+// travelRuleSchema is the IVMS101 metadata a send operation carries for travel-rule reporting
+var travelRuleSchema = &framework.FieldSchema{
+	Type:        framework.TypeMap,
+	Description: "The originator and beneficiary of the transfer as an IVMS101 payload, kept with the transaction for travel-rule reporting. It is not signed.",
+}
+
+// TravelRuleRecordJSON is the IVMS101 metadata of a transaction sent from this
+// mount, with what the mount knows of the transfer itself
+type TravelRuleRecordJSON struct {
+	TransactionHash string                 `json:"transaction_hash"`
+	Account         string                 `json:"account"`
+	Path            string                 `json:"path"`
+	EntityID        string                 `json:"entity_id,omitempty"`
+	Chain           string                 `json:"chain,omitempty"`
+	From            string                 `json:"from"`
+	To              string                 `json:"to"`
+	Amount          string                 `json:"amount"`
+	Contract        string                 `json:"contract,omitempty"`
+	Symbol          string                 `json:"symbol,omitempty"`
+	Memo            string                 `json:"memo,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	IVMS101         map[string]interface{} `json:"ivms101"`
+}
+
+func (record *TravelRuleRecordJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"transaction_hash": record.TransactionHash,
+		"account":          record.Account,
+		"path":             record.Path,
+		"from":             record.From,
+		"to":               record.To,
+		"amount":           record.Amount,
+		"created_at":       record.CreatedAt.Format(time.RFC3339),
+		"ivms101":          record.IVMS101,
+	}
+	for key, value := range map[string]string{
+		"entity_id": record.EntityID,
+		"chain":     record.Chain,
+		"contract":  record.Contract,
+		"symbol":    record.Symbol,
+		"memo":      record.Memo,
+	} {
+		if value != Empty {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func travelRuleStoragePath(hash string) string {
+	return QualifiedPath("travel-rule/" + strings.ToLower(hash))
+}
+
+func travelRulePaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("travel-rule/?"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathTravelRuleList,
+			},
+			HelpSynopsis: "List the transactions that carry travel-rule metadata.",
+			HelpDescription: `
+
+List the hashes of the transactions sent with travel-rule metadata. A
+transfer, a signed transaction or an ERC-20 transfer carries it as
+travel_rule: an IVMS101 payload naming at least the originator and the
+beneficiary. The payload is checked before anything is signed and kept, with
+the account, the destination and the amount, under the hash of the
+transaction once it is signed.
+
+`,
+		},
+		{
+			Pattern:      QualifiedPath("travel-rule/export"),
+			HelpSynopsis: "Export the travel-rule metadata of the transactions sent in a period.",
+			HelpDescription: `
+
+Return the travel-rule records created between since and until, oldest first.
+As json every record carries its IVMS101 payload unchanged, for a travel-rule
+messaging provider; as csv there is a row per transaction with the names,
+account numbers and VASPs of the originator and the beneficiary, for a
+regulator or an auditor.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"since": {
+					Type:        framework.TypeString,
+					Description: "Export only the records created at or after this time, in RFC 3339.",
+				},
+				"until": {
+					Type:        framework.TypeString,
+					Description: "Export only the records created before this time, in RFC 3339.",
+				},
+				"format": {
+					Type:          framework.TypeString,
+					AllowedValues: []interface{}{formatJSON, formatCSV},
+					Default:       formatJSON,
+					Description:   "The export format: json or csv.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathTravelRuleExport,
+			},
+		},
+		{
+			Pattern:      QualifiedPath("travel-rule/" + framework.GenericNameRegex("hash")),
+			HelpSynopsis: "Return the travel-rule metadata of a transaction.",
+			HelpDescription: `
+
+Return the IVMS101 payload a transaction was sent with, and the account,
+destination and amount of the transfer.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"hash": {Type: framework.TypeString, Description: "The hash of the transaction."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathTravelRuleRead,
+			},
+		},
+	}
+}
+
+// parseTravelRule returns the IVMS101 payload of a send operation, or nil if
+// it carries none or the path does not take one
+func parseTravelRule(data *framework.FieldData) (map[string]interface{}, error) {
+	if _, ok := data.Schema["travel_rule"]; !ok {
+		return nil, nil
+	}
+	raw, ok := data.GetOk("travel_rule")
+	if !ok {
+		return nil, nil
+	}
+	payload, _ := raw.(map[string]interface{})
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	for key := range payload {
+		if !travelRuleKeys[key] {
+			return nil, fmt.Errorf("%w: travel_rule has an unknown member %s", ErrInvalidInput, key)
+		}
+	}
+	for _, party := range []string{"originator", "beneficiary"} {
+		members, _ := payload[party].(map[string]interface{})
+		persons, _ := members[party+"Persons"].([]interface{})
+		if len(persons) == 0 {
+			return nil, fmt.Errorf("%w: travel_rule must name at least one %s in %s.%sPersons", ErrInvalidInput, party, party, party)
+		}
+		for i, person := range persons {
+			if travelRuleName(person) == Empty {
+				return nil, fmt.Errorf("%w: travel_rule %s.%sPersons[%d] must be a naturalPerson or a legalPerson with a name", ErrInvalidInput, party, party, i)
+			}
+		}
+	}
+	return payload, nil
+}
+
+// recordTravelRule keeps the IVMS101 payload of a send operation under the
+// hash of the transaction it signed
+func (b *PluginBackend) recordTravelRule(ctx context.Context, req *logical.Request, name string, payload map[string]interface{}, resp *logical.Response) error {
+	if payload == nil || resp == nil || resp.Data == nil {
+		return nil
+	}
+	hash, ok := resp.Data["transaction_hash"].(string)
+	if !ok || hash == Empty {
+		return nil
+	}
+	record := &TravelRuleRecordJSON{
+		TransactionHash: hash,
+		Account:         name,
+		Path:            req.Path,
+		EntityID:        req.EntityID,
+		From:            responseString(resp, "from"),
+		To:              responseString(resp, "to"),
+		Amount:          responseString(resp, "amount"),
+		Contract:        responseString(resp, "contract"),
+		Symbol:          responseString(resp, "symbol"),
+		CreatedAt:       time.Now().UTC(),
+		IVMS101:         payload,
+	}
+	if recorder := decisionFromContext(ctx); recorder != nil {
+		recorder.Lock()
+		record.Chain = recorder.chain
+		record.Memo = recorder.memo
+		recorder.Unlock()
+	}
+	entry, err := logical.StorageEntryJSON(travelRuleStoragePath(hash), record)
+	if err != nil {
+		return err
+	}
+	return req.Storage.Put(ctx, entry)
+}
+
+func responseString(resp *logical.Response, key string) string {
+	value, ok := resp.Data[key]
+	if !ok || value == nil {
+		return Empty
+	}
+	return fmt.Sprint(value)
+}
+
+func readTravelRule(ctx context.Context, s logical.Storage, hash string) (*TravelRuleRecordJSON, error) {
+	entry, err := s.Get(ctx, travelRuleStoragePath(hash))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var record TravelRuleRecordJSON
+	if err := entry.DecodeJSON(&record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (b *PluginBackend) pathTravelRuleList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	hashes, err := req.Storage.List(ctx, QualifiedPath("travel-rule/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(hashes), nil
+}
+
+func (b *PluginBackend) pathTravelRuleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	record, err := readTravelRule(ctx, req.Storage, data.Get("hash").(string))
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: record.responseData(),
+	}, nil
+}
+
+func (b *PluginBackend) pathTravelRuleExport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var since, until time.Time
+	var err error
+	if value := data.Get("since").(string); value != Empty {
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("%w: since must be a time in RFC 3339", ErrInvalidInput)
+		}
+	}
+	if value := data.Get("until").(string); value != Empty {
+		if until, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("%w: until must be a time in RFC 3339", ErrInvalidInput)
+		}
+	}
+	format := data.Get("format").(string)
+	if format != formatJSON && format != formatCSV {
+		return nil, fmt.Errorf("%w: unknown format %s", ErrInvalidInput, format)
+	}
+	hashes, err := req.Storage.List(ctx, QualifiedPath("travel-rule/"))
+	if err != nil {
+		return nil, err
+	}
+	records := []*TravelRuleRecordJSON{}
+	for _, hash := range hashes {
+		record, err := readTravelRule(ctx, req.Storage, hash)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil || record.CreatedAt.Before(since) || (!until.IsZero() && !record.CreatedAt.Before(until)) {
+			continue
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+
+	if format == formatCSV {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: "text/csv",
+				logical.HTTPRawBody:     encodeTravelRuleCSV(records),
+				logical.HTTPStatusCode:  http.StatusOK,
+			},
+		}, nil
+	}
+	exported := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		exported = append(exported, record.responseData())
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"records": exported,
+		},
+	}, nil
+}
+
+func encodeTravelRuleCSV(records []*TravelRuleRecordJSON) []byte {
+	var buff bytes.Buffer
+	writer := csv.NewWriter(&buff)
+	writer.Write([]string{
+		"created_at", "transaction_hash", "account", "chain", "from", "to", "amount", "contract", "symbol",
+		"originator_names", "originator_accounts", "originating_vasp",
+		"beneficiary_names", "beneficiary_accounts", "beneficiary_vasp",
+	})
+	for _, record := range records {
+		row := []string{
+			record.CreatedAt.Format(time.RFC3339), record.TransactionHash, record.Account, record.Chain,
+			record.From, record.To, record.Amount, record.Contract, record.Symbol,
+		}
+		for _, party := range []string{"originator", "beneficiary"} {
+			members, _ := record.IVMS101[party].(map[string]interface{})
+			persons, _ := members[party+"Persons"].([]interface{})
+			names := make([]string, 0, len(persons))
+			for _, person := range persons {
+				names = append(names, travelRuleName(person))
+			}
+			accounts := []string{}
+			numbers, _ := members["accountNumber"].([]interface{})
+			for _, number := range numbers {
+				accounts = append(accounts, fmt.Sprint(number))
+			}
+			vasp := "originatingVASP"
+			if party == "beneficiary" {
+				vasp = "beneficiaryVASP"
+			}
+			// IVMS101 nests the VASP in a member of the same name
+			outer, _ := record.IVMS101[vasp].(map[string]interface{})
+			row = append(row, strings.Join(names, ";"), strings.Join(accounts, ";"), travelRuleName(outer[vasp]))
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	return buff.Bytes()
+}
+
+// travelRuleName returns the first name of an IVMS101 person, natural or
+// legal, or Empty if it has none
+func travelRuleName(raw interface{}) string {
+	person, _ := raw.(map[string]interface{})
+	if natural, ok := person["naturalPerson"].(map[string]interface{}); ok {
+		name, _ := natural["name"].(map[string]interface{})
+		identifiers, _ := name["nameIdentifier"].([]interface{})
+		for _, identifier := range identifiers {
+			parts, _ := identifier.(map[string]interface{})
+			primary, _ := parts["primaryIdentifier"].(string)
+			secondary, _ := parts["secondaryIdentifier"].(string)
+			if full := strings.TrimSpace(secondary + " " + primary); full != Empty {
+				return full
+			}
+		}
+	}
+	if legal, ok := person["legalPerson"].(map[string]interface{}); ok {
+		name, _ := legal["name"].(map[string]interface{})
+		identifiers, _ := name["nameIdentifier"].([]interface{})
+		for _, identifier := range identifiers {
+			parts, _ := identifier.(map[string]interface{})
+			if legalName, _ := parts["legalPersonName"].(string); legalName != Empty {
+				return legalName
+			}
+		}
+	}
+	return Empty
+}
@@ -0,0 +1,427 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/core-coin/go-core"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/rlp"
+	"github.com/core-coin/go-core/rpc"
+	"github.com/core-coin/go-core/xcbclient"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// DefaultConfirmationDepth is the number of blocks after which a transaction is confirmed
+	DefaultConfirmationDepth int = 12
+
+	txPending   string = "pending"
+	txMined     string = "mined"
+	txConfirmed string = "confirmed"
+	txReorged   string = "reorged"
+)
+
+// TxJSON tracks a transaction this mount has broadcast
+type TxJSON struct {
+	Hash              string `json:"hash"`
+	Account           string `json:"account"`
+	Chain             string `json:"chain,omitempty"`
+	SignedTransaction string `json:"signed_transaction"`
+	Value             string `json:"value"`
+	EnergyPrice       string `json:"energy_price"`
+	EnergyUsed        uint64 `json:"energy_used"`
+	Token             string `json:"token"`
+	Memo              string `json:"memo,omitempty"`
+	// Private transactions were sent to the private relays, and are sent there again
+	Private       bool      `json:"private,omitempty"`
+	TokenAmount   string    `json:"token_amount"`
+	Status        string    `json:"status"`
+	BlockNumber   uint64    `json:"block_number"`
+	BlockHash     string    `json:"block_hash"`
+	Confirmations uint64    `json:"confirmations"`
+	Reorgs        int       `json:"reorgs"`
+	Rebroadcasts  int       `json:"rebroadcasts"`
+	LastError     string    `json:"last_error"`
+	SubmittedAt   time.Time `json:"submitted_at"`
+	CheckedAt     time.Time `json:"checked_at"`
+}
+
+func (tx *TxJSON) responseData() map[string]interface{} {
+	result := map[string]interface{}{
+		"hash":          tx.Hash,
+		"account":       tx.Account,
+		"status":        tx.Status,
+		"confirmations": tx.Confirmations,
+		"reorgs":        tx.Reorgs,
+		"rebroadcasts":  tx.Rebroadcasts,
+		"submitted_at":  tx.SubmittedAt.UTC().Format(time.RFC3339),
+	}
+	if tx.BlockHash != Empty {
+		result["block_number"] = tx.BlockNumber
+		result["block_hash"] = tx.BlockHash
+	}
+	if tx.Chain != Empty {
+		result["chain"] = tx.Chain
+	}
+	if tx.LastError != Empty {
+		result["last_error"] = tx.LastError
+	}
+	if tx.Memo != Empty {
+		result["memo"] = tx.Memo
+	}
+	if tx.Private {
+		result["private"] = true
+	}
+	if !tx.CheckedAt.IsZero() {
+		result["checked_at"] = tx.CheckedAt.UTC().Format(time.RFC3339)
+	}
+	return result
+}
+
+func txPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: QualifiedPath("tx/?"),
+			Fields:  listPageSchema(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathTxList,
+			},
+			HelpSynopsis: "List all the transactions broadcast by this mount.",
+			HelpDescription: `
+			All the tracked transaction hashes will be listed.
+			`,
+		},
+		{
+			Pattern:      QualifiedPath("tx/(?P<hash>(0x)?[0-9a-fA-F]{64})"),
+			HelpSynopsis: "Return the confirmation status of a broadcast transaction.",
+			HelpDescription: `
+
+Return the status of a transaction broadcast by this mount: pending, mined,
+confirmed once it is confirmation_depth blocks deep, or reorged when the block
+that included it left the canonical chain. Reorged transactions are
+re-broadcast when rebroadcast_reorged is set. Tracking also runs in the
+background: on every new block for a chain with a WebSocket or IPC endpoint,
+which is subscribed to newHeads, and periodically for the others. Tracked transactions are kept in local storage: under
+performance replication each cluster tracks the transactions it broadcast.
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"hash": {Type: framework.TypeString, Description: "The transaction hash."},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathTxRead,
+			},
+		},
+	}
+}
+
+func txStoragePath(hash common.Hash) string {
+	return QualifiedPath(fmt.Sprintf("tx/%s", hash.Hex()))
+}
+
+func readTx(ctx context.Context, s logical.Storage, hash common.Hash) (*TxJSON, error) {
+	entry, err := s.Get(ctx, txStoragePath(hash))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w: transaction %s is not tracked by this mount", ErrInvalidInput, hash.Hex())
+	}
+	var tx TxJSON
+	if err := entry.DecodeJSON(&tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+func writeTx(ctx context.Context, s logical.Storage, tx *TxJSON) error {
+	entry, err := storageEntryJSON(txStoragePath(common.HexToHash(tx.Hash)), tx)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func newTxJSON(name string, signedTx *types.Transaction) (*TxJSON, error) {
+	var signedTxBuff bytes.Buffer
+	if err := signedTx.EncodeRLP(&signedTxBuff); err != nil {
+		return nil, err
+	}
+	return &TxJSON{
+		Hash:              signedTx.Hash().Hex(),
+		Account:           name,
+		SignedTransaction: hexutil.Encode(signedTxBuff.Bytes()),
+		Value:             signedTx.Value().String(),
+		EnergyPrice:       signedTx.EnergyPrice().String(),
+		Status:            txPending,
+		SubmittedAt:       time.Now(),
+	}, nil
+}
+
+// trackTransaction records a broadcast transaction for confirmation tracking
+func trackTransaction(ctx context.Context, req *logical.Request, name string, signedTx *types.Transaction) error {
+	tx, err := newTxJSON(name, signedTx)
+	if err != nil {
+		return err
+	}
+	tx.Chain, _ = chainFromContext(ctx)
+	tx.Memo = memoFromContext(ctx)
+	tx.Private = privateBroadcast(ctx)
+	return writeTx(ctx, req.Storage, tx)
+}
+
+// trackTokenTransfer records a broadcast token transfer along with the amount of tokens sent
+func trackTokenTransfer(ctx context.Context, req *logical.Request, name string, signedTx *types.Transaction, token common.Address, amount *big.Int) error {
+	tx, err := newTxJSON(name, signedTx)
+	if err != nil {
+		return err
+	}
+	tx.Chain, _ = chainFromContext(ctx)
+	tx.Memo = memoFromContext(ctx)
+	tx.Private = privateBroadcast(ctx)
+	tx.Token = token.Hex()
+	tx.TokenAmount = amount.String()
+	return writeTx(ctx, req.Storage, tx)
+}
+
+// canonicalReceipt returns the receipt of a transaction if the block that
+// included it is still part of the canonical chain
+func canonicalReceipt(ctx context.Context, raw *rpc.Client, hash common.Hash) (*types.Receipt, error) {
+	receipt, err := xcbclient.NewClient(raw).TransactionReceipt(ctx, hash)
+	if errors.Is(err, core.NotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// only the hash of the canonical block is needed, so the header is not decoded
+	var block *struct {
+		Hash common.Hash `json:"hash"`
+	}
+	if err := raw.CallContext(ctx, &block, "xcb_getBlockByNumber", hexutil.EncodeBig(receipt.BlockNumber), false); err != nil {
+		return nil, err
+	}
+	if block == nil || block.Hash != receipt.BlockHash {
+		return nil, nil
+	}
+	return receipt, nil
+}
+
+// refreshTx updates the status of a tracked transaction against the chain
+func refreshTx(ctx context.Context, config *ConfigJSON, raw *rpc.Client, tx *TxJSON) error {
+	client := xcbclient.NewClient(raw)
+	receipt, err := canonicalReceipt(ctx, raw, common.HexToHash(tx.Hash))
+	if err != nil {
+		return err
+	}
+	tx.CheckedAt = time.Now()
+	if receipt == nil {
+		if tx.BlockHash != Empty {
+			// the transaction was mined in a block that is no longer canonical
+			tx.Reorgs++
+			tx.Status = txReorged
+			tx.BlockHash = Empty
+			tx.BlockNumber = 0
+			tx.EnergyUsed = 0
+			tx.Confirmations = 0
+		}
+		if tx.Status == txReorged && config.RebroadcastReorged {
+			return rebroadcastTx(ctx, config, client, tx)
+		}
+		return nil
+	}
+
+	if tx.BlockHash != Empty && tx.BlockHash != receipt.BlockHash.Hex() {
+		tx.Reorgs++
+	}
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	tx.BlockHash = receipt.BlockHash.Hex()
+	tx.BlockNumber = receipt.BlockNumber.Uint64()
+	tx.EnergyUsed = receipt.EnergyUsed
+	tx.Confirmations = 0
+	if head >= tx.BlockNumber {
+		tx.Confirmations = head - tx.BlockNumber + 1
+	}
+	tx.Status = txMined
+	if tx.Confirmations >= uint64(config.confirmationDepth()) {
+		tx.Status = txConfirmed
+	}
+	tx.LastError = Empty
+	return nil
+}
+
+func rebroadcastTx(ctx context.Context, config *ConfigJSON, client *xcbclient.Client, tx *TxJSON) error {
+	if tx.Private {
+		// a private transaction must not reach the mempool when it is sent again either
+		tx.Rebroadcasts++
+		if err := relayRawTransaction(ctx, config, tx.SignedTransaction); err != nil {
+			tx.LastError = err.Error()
+		}
+		return nil
+	}
+	raw, err := hexutil.Decode(tx.SignedTransaction)
+	if err != nil {
+		return err
+	}
+	var signedTx types.Transaction
+	if err := rlp.DecodeBytes(raw, &signedTx); err != nil {
+		return err
+	}
+	tx.Rebroadcasts++
+	if err := client.SendTransaction(ctx, &signedTx); err != nil {
+		message := strings.ToLower(err.Error())
+		if strings.Contains(message, "already known") || strings.Contains(message, "known transaction") {
+			// the node put it back in its pool on its own
+			return nil
+		}
+		tx.LastError = err.Error()
+	}
+	return nil
+}
+
+// trackTransactions is the periodic function that refreshes every unconfirmed
+// transaction; those of a chain subscribed to newHeads are handed to its
+// watcher instead
+func (b *PluginBackend) trackTransactions(ctx context.Context, req *logical.Request) error {
+	_, err := b.readConfig(ctx, req.Storage)
+	if errors.Is(err, ErrNotConfigured) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	hashes, err := req.Storage.List(ctx, QualifiedPath("tx/"))
+	if err != nil || len(hashes) == 0 {
+		return err
+	}
+	// one client for each chain the transactions were sent on
+	configs := map[string]*ConfigJSON{}
+	clients := map[string]*rpc.Client{}
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	for _, hash := range hashes {
+		tx, err := readTx(ctx, req.Storage, common.HexToHash(hash))
+		if err != nil {
+			return err
+		}
+		if tx.Status == txConfirmed || b.headWatchers.follow(tx.Chain, hash) {
+			continue
+		}
+		if _, ok := configs[tx.Chain]; !ok {
+			chainCtx, err := txChainContext(ctx, req.Storage, tx)
+			if err != nil {
+				return err
+			}
+			configs[tx.Chain] = nil
+			if chainCtx != nil {
+				config, err := b.readConfig(chainCtx, req.Storage)
+				if err != nil {
+					return err
+				}
+				client, err := b.dialRPCClient(chainCtx, config)
+				if err != nil {
+					return err
+				}
+				configs[tx.Chain] = config
+				clients[tx.Chain] = client
+			}
+		}
+		config := configs[tx.Chain]
+		if config == nil {
+			// the chain it was sent on has been deleted
+			continue
+		}
+		if err := refreshTx(ctx, config, clients[tx.Chain], tx); err != nil {
+			return err
+		}
+		if err := writeTx(ctx, req.Storage, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// txChainContext returns the context to read the config of the chain a
+// transaction was sent on with, nil if that chain no longer exists
+func txChainContext(ctx context.Context, s logical.Storage, tx *TxJSON) (context.Context, error) {
+	if tx.Chain == Empty {
+		return ctx, nil
+	}
+	chain, err := readChain(ctx, s, tx.Chain)
+	if err != nil || chain == nil {
+		return nil, err
+	}
+	return withChain(ctx, tx.Chain, chain), nil
+}
+
+func (b *PluginBackend) pathTxList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, QualifiedPath("tx/"))
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(listPage(vals, data)), nil
+}
+
+func (b *PluginBackend) pathTxRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := readTx(ctx, req.Storage, common.HexToHash(data.Get("hash").(string)))
+	if err != nil {
+		return nil, err
+	}
+	chainCtx, err := txChainContext(ctx, req.Storage, tx)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Status != txConfirmed && chainCtx != nil {
+		config, err := b.readConfig(chainCtx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		client, err := b.dialRPCClient(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+		if err := refreshTx(ctx, config, client, tx); err != nil {
+			return nil, err
+		}
+		if err := writeTx(ctx, req.Storage, tx); err != nil {
+			return nil, err
+		}
+	}
+	return &logical.Response{
+		Data: tx.responseData(),
+	}, nil
+}
@@ -0,0 +1,257 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+)
+
+const (
+	// DefaultPolicyHookTimeout bounds a call to the policy hook, in seconds
+	DefaultPolicyHookTimeout int = 5
+)
+
+// PolicyInput is what the policy hook is asked about a transaction before it is signed
+type PolicyInput struct {
+	Path          string       `json:"path"`
+	Operation     string       `json:"operation"`
+	EntityID      string       `json:"entity_id,omitempty"`
+	RemoteAddress string       `json:"remote_address,omitempty"`
+	Account       string       `json:"account"`
+	Chain         string       `json:"chain,omitempty"`
+	ChainID       string       `json:"chain_id"`
+	From          string       `json:"from"`
+	To            string       `json:"to,omitempty"`
+	Amount        string       `json:"amount"`
+	Nonce         uint64       `json:"nonce"`
+	GasLimit      uint64       `json:"gas_limit"`
+	GasPrice      string       `json:"gas_price"`
+	Data          string       `json:"data,omitempty"`
+	Call          *DecodedCall `json:"call,omitempty"`
+}
+
+// policyResult is the answer of the policy hook
+type policyResult struct {
+	allow   bool
+	reason  string
+	expires time.Time
+}
+
+// policyCache remembers answers of the policy hook for policy_hook_cache_ttl
+type policyCache struct {
+	sync.Mutex
+	results map[[sha256.Size]byte]*policyResult
+}
+
+func newPolicyCache() *policyCache {
+	return &policyCache{results: map[[sha256.Size]byte]*policyResult{}}
+}
+
+func (c *policyCache) get(key [sha256.Size]byte) *policyResult {
+	c.Lock()
+	defer c.Unlock()
+	result := c.results[key]
+	if result != nil && time.Now().After(result.expires) {
+		delete(c.results, key)
+		return nil
+	}
+	return result
+}
+
+func (c *policyCache) put(key [sha256.Size]byte, result *policyResult) {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	for k, cached := range c.results {
+		if now.After(cached.expires) {
+			delete(c.results, k)
+		}
+	}
+	c.results[key] = result
+}
+
+// checkTransaction enforces the chain pin, the calldata rules and the
+// constraints of a signing grant, checks the destinations against the
+// sanctions list and the screening API, enforces the USD limits, the control
+// group minimums and the MFA step-up and asks the policy hook before a
+// transaction is signed
+func (b *PluginBackend) checkTransaction(ctx context.Context, tx *types.Transaction) error {
+	scope, _ := ctx.Value(signingScopeKey{}).(*signingScope)
+	if scope == nil {
+		return nil
+	}
+	config, err := b.readConfig(ctx, scope.req.Storage)
+	if err != nil {
+		return err
+	}
+	accountJSON, err := readAccount(ctx, scope.req, scope.account)
+	if err != nil {
+		return err
+	}
+	if err := checkChainPin(ctx, config, accountJSON); err != nil {
+		return err
+	}
+	call, err := b.checkCalldata(ctx, scope, config, accountJSON, tx.To(), tx.Data())
+	if err != nil {
+		return err
+	}
+	if err := checkGrantCall(ctx, tx, call); err != nil {
+		return err
+	}
+	if err := b.checkSanctions(ctx, scope.req.Storage, destinations(tx, call)); err != nil {
+		return err
+	}
+	if err := b.checkScreening(ctx, scope, config, tx, call); err != nil {
+		return err
+	}
+	if err := b.checkUSDLimits(ctx, scope, config, accountJSON, tx, call); err != nil {
+		return err
+	}
+	if err := b.checkHighValue(ctx, scope, config, tx, call); err != nil {
+		return err
+	}
+	if err := b.checkAnomalies(ctx, scope, config, tx, call); err != nil {
+		return err
+	}
+	if err := b.checkMFA(ctx, scope, config, tx, call); err != nil {
+		return err
+	}
+	if config.PolicyHookURL == Empty {
+		return nil
+	}
+	input := &PolicyInput{
+		Path:      scope.req.Path,
+		Operation: string(scope.req.Operation),
+		EntityID:  scope.req.EntityID,
+		Account:   scope.account,
+		ChainID:   config.ChainID,
+		From:      accountJSON.Address,
+		Amount:    tx.Value().String(),
+		Nonce:     tx.Nonce(),
+		GasLimit:  tx.Energy(),
+		GasPrice:  tx.EnergyPrice().String(),
+		Call:      call,
+	}
+	if scope.req.Connection != nil {
+		input.RemoteAddress = scope.req.Connection.RemoteAddr
+	}
+	if recorder := decisionFromContext(ctx); recorder != nil {
+		recorder.Lock()
+		input.Chain = recorder.chain
+		recorder.Unlock()
+	}
+	if tx.To() != nil {
+		input.To = tx.To().Hex()
+	}
+	if len(tx.Data()) > 0 {
+		input.Data = hexutil.Encode(tx.Data())
+	}
+	err = b.askPolicyHook(ctx, config, input)
+	recordRule(ctx, "policy_hook", err)
+	return err
+}
+
+// askPolicyHook posts the input to policy_hook_url the way OPA's data API
+// expects it, as {"input": ...}. The transaction is allowed only if the hook
+// answers true, or an object whose allow is true; anything else, including a
+// hook that cannot be reached, refuses it.
+func (b *PluginBackend) askPolicyHook(ctx context.Context, config *ConfigJSON, input *PolicyInput) error {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return err
+	}
+	key := sha256.Sum256(append([]byte(config.PolicyHookURL+"\n"), body...))
+	result := b.policyCache.get(key)
+	if result == nil {
+		result, err = postPolicyHook(ctx, config, body)
+		if err != nil {
+			b.Logger().Error("policy hook failed; refusing to sign", "url", config.PolicyHookURL, "error", err)
+			return wrapError(ErrPolicyUnavailable, err)
+		}
+		if ttl := config.PolicyHookCacheTTL; ttl > 0 {
+			result.expires = time.Now().Add(time.Duration(ttl) * time.Second)
+			b.policyCache.put(key, result)
+		}
+	}
+	if !result.allow {
+		if result.reason != Empty {
+			return fmt.Errorf("%w: refused by the policy hook: %s", ErrPolicyViolation, result.reason)
+		}
+		return fmt.Errorf("%w: refused by the policy hook", ErrPolicyViolation)
+	}
+	return nil
+}
+
+func postPolicyHook(ctx context.Context, config *ConfigJSON, body []byte) (*policyResult, error) {
+	timeout := DefaultPolicyHookTimeout
+	if config.PolicyHookTimeout > 0 {
+		timeout = config.PolicyHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, config.PolicyHookURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	answer, err := ioutil.ReadAll(io.LimitReader(response.Body, maxExternalResponse))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", response.StatusCode)
+	}
+	var decoded struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(answer, &decoded); err != nil {
+		return nil, fmt.Errorf("cannot decode the answer: %v", err)
+	}
+	result := &policyResult{}
+	var allow bool
+	var object struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	switch {
+	case len(decoded.Result) == 0:
+		// OPA leaves out result when the rule is undefined for the input
+		result.reason = "the policy is undefined for this transaction"
+	case json.Unmarshal(decoded.Result, &allow) == nil:
+		result.allow = allow
+	case json.Unmarshal(decoded.Result, &object) == nil:
+		result.allow, result.reason = object.Allow, object.Reason
+	default:
+		return nil, fmt.Errorf("result is neither a boolean nor an object with allow")
+	}
+	return result, nil
+}
@@ -0,0 +1,200 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/cidrutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// weekdays are the day names of signing windows, in the order of time.Weekday
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// sourceCIDRsSchema restricts where the signing requests of an account come from
+var sourceCIDRsSchema = &framework.FieldSchema{
+	Type: framework.TypeCommaStringSlice,
+	Description: `The only networks, as CIDR blocks, the account's signing requests may come
+from; any if empty. A request from elsewhere needs an approved authorization.`,
+}
+
+// signingWindowsSchema restricts when an account signs
+var signingWindowsSchema = &framework.FieldSchema{
+	Type: framework.TypeCommaStringSlice,
+	Description: `The only times, in UTC, the account signs, such as "mon-fri 09:00-17:00" or
+"sat 10:00-12:00"; any time if empty. A request outside every window needs an
+approved authorization.`,
+}
+
+// signingWindow is a daily span of minutes on some days of the week
+type signingWindow struct {
+	days       [7]bool
+	start, end int
+}
+
+func (window *signingWindow) contains(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	return window.days[now.Weekday()] && minute >= window.start && minute < window.end
+}
+
+// parseSigningWindow reads a window such as "mon-fri 09:00-17:00": a day or a
+// range of days, which may wrap through the weekend, and a span of the day
+// that ends after it starts, at 24:00 at the latest
+func parseSigningWindow(raw string) (*signingWindow, error) {
+	fields := strings.Fields(strings.ToLower(raw))
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("%w: signing window %q is not days and a span of the day", ErrInvalidInput, raw)
+	}
+	window := &signingWindow{}
+	days := strings.SplitN(fields[0], "-", 2)
+	first, last := dayIndex(days[0]), dayIndex(days[len(days)-1])
+	if first < 0 || last < 0 {
+		return nil, fmt.Errorf("%w: signing window %q names an unknown day", ErrInvalidInput, raw)
+	}
+	for day := first; ; day = (day + 1) % 7 {
+		window.days[day] = true
+		if day == last {
+			break
+		}
+	}
+	span := strings.SplitN(fields[1], "-", 2)
+	if len(span) != 2 {
+		return nil, fmt.Errorf("%w: signing window %q has no end", ErrInvalidInput, raw)
+	}
+	var err error
+	if window.start, err = minuteOfDay(span[0]); err != nil {
+		return nil, fmt.Errorf("%w: signing window %q: %v", ErrInvalidInput, raw, err)
+	}
+	if window.end, err = minuteOfDay(span[1]); err != nil {
+		return nil, fmt.Errorf("%w: signing window %q: %v", ErrInvalidInput, raw, err)
+	}
+	if window.end <= window.start {
+		return nil, fmt.Errorf("%w: signing window %q ends before it starts; split a span through midnight in two", ErrInvalidInput, raw)
+	}
+	return window, nil
+}
+
+func dayIndex(name string) int {
+	for i, day := range weekdays {
+		if day == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func minuteOfDay(clock string) (int, error) {
+	var hour, minute int
+	if n, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute); err != nil || n != 2 || len(clock) != 5 {
+		return 0, fmt.Errorf("%s is not HH:MM", clock)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("%s is not a time of day", clock)
+	}
+	return hour*60 + minute, nil
+}
+
+// parseSigningWindows validates and normalizes the signing windows of an account
+func parseSigningWindows(windows []string) ([]string, error) {
+	var normalized []string
+	for _, raw := range windows {
+		if _, err := parseSigningWindow(raw); err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, strings.Join(strings.Fields(strings.ToLower(raw)), " "))
+	}
+	return normalized, nil
+}
+
+// parseSourceCIDRs validates and normalizes the source networks of an account
+func parseSourceCIDRs(cidrs []string) ([]string, error) {
+	var normalized []string
+	for _, raw := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s is not a CIDR block", ErrInvalidInput, raw)
+		}
+		normalized = append(normalized, network.String())
+	}
+	return normalized, nil
+}
+
+// checkRestrictions holds a signing request from outside the account's source
+// networks, or outside all of its signing windows, to an approved
+// authorization, which is how exceptions are made. Export requests have their
+// own dual control.
+func (b *PluginBackend) checkRestrictions(ctx context.Context, req *logical.Request, name string) error {
+	if exportRequest(req) {
+		return nil
+	}
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return err
+	}
+	if len(accountJSON.SourceCIDRs) > 0 {
+		remote := Empty
+		if req.Connection != nil {
+			remote = req.Connection.RemoteAddr
+		}
+		belongs := false
+		if remote != Empty {
+			if belongs, err = cidrutil.IPBelongsToCIDRBlocksSlice(remote, accountJSON.SourceCIDRs); err != nil {
+				return err
+			}
+		}
+		if !belongs {
+			err = b.restrictionException(ctx, req, name, fmt.Sprintf("%s signs only for requests from %s, not from %q", name, strings.Join(accountJSON.SourceCIDRs, ", "), remote))
+			recordRule(ctx, "source_cidrs", err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(accountJSON.SigningWindows) > 0 {
+		now := time.Now().UTC()
+		open := false
+		for _, raw := range accountJSON.SigningWindows {
+			window, err := parseSigningWindow(raw)
+			if err != nil {
+				return err
+			}
+			open = open || window.contains(now)
+		}
+		if !open {
+			err = b.restrictionException(ctx, req, name, fmt.Sprintf("%s signs only %s UTC", name, strings.Join(accountJSON.SigningWindows, ", ")))
+			recordRule(ctx, "signing_windows", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// restrictionException lets a request the account's restrictions refuse
+// through with the approved authorization it names
+func (b *PluginBackend) restrictionException(ctx context.Context, req *logical.Request, name, restriction string) error {
+	if id, _ := req.Data["authorization_id"].(string); id == Empty {
+		return fmt.Errorf("%w: %s; an approved authorization through accounts/%s/authorizations makes an exception", ErrPolicyViolation, restriction, name)
+	}
+	if err := b.useAuthorization(ctx, req, name); err != nil {
+		return fmt.Errorf("%w (%s)", err, restriction)
+	}
+	return nil
+}
@@ -0,0 +1,534 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/rpc"
+	"github.com/core-coin/go-core/xcbclient"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// DefaultRPCTimeout bounds a single RPC round trip, in seconds
+	DefaultRPCTimeout int = 30
+	// DefaultRPCRetries is the number of retries after a failed round trip
+	DefaultRPCRetries int = 2
+	// DefaultRPCBackoff is the initial delay between retries, in seconds
+	DefaultRPCBackoff int = 1
+	// DefaultCircuitThreshold is the number of consecutive failures that opens the circuit
+	DefaultCircuitThreshold int = 5
+	// DefaultCircuitCooldown is how long an open circuit rejects calls, in seconds
+	DefaultCircuitCooldown int = 30
+
+	// StrategyPriority always tries endpoints in the configured order
+	StrategyPriority string = "priority"
+	// StrategyRoundRobin rotates the first endpoint tried on every call
+	StrategyRoundRobin string = "round-robin"
+
+	// TransportHTTP, TransportWebSocket and TransportIPC are the ways an RPC
+	// endpoint is reached: http(s):// and ws(s):// URLs, and the path of a
+	// node's IPC socket
+	TransportHTTP      string = "http"
+	TransportWebSocket string = "websocket"
+	TransportIPC       string = "ipc"
+
+	circuitClosed   string = "closed"
+	circuitOpen     string = "open"
+	circuitHalfOpen string = "half-open"
+)
+
+// rpcEndpoint tracks the health of a single RPC URL
+type rpcEndpoint struct {
+	URL                 string
+	ConsecutiveFailures int
+	OpenUntil           time.Time
+	LastError           string
+	LastSuccess         time.Time
+	LastFailure         time.Time
+	// Probing is set while the one call a half-open circuit lets through runs
+	Probing bool
+}
+
+func (e *rpcEndpoint) state(now time.Time) string {
+	if e.OpenUntil.IsZero() {
+		return circuitClosed
+	}
+	if now.Before(e.OpenUntil) {
+		return circuitOpen
+	}
+	return circuitHalfOpen
+}
+
+// rpcRegistry holds the in-memory health of every RPC endpoint this mount has used
+type rpcRegistry struct {
+	sync.Mutex
+	endpoints map[string]*rpcEndpoint
+	next      int
+}
+
+func newRPCRegistry() *rpcRegistry {
+	return &rpcRegistry{endpoints: make(map[string]*rpcEndpoint)}
+}
+
+func (r *rpcRegistry) endpoint(url string) *rpcEndpoint {
+	endpoint, ok := r.endpoints[url]
+	if !ok {
+		endpoint = &rpcEndpoint{URL: url}
+		r.endpoints[url] = endpoint
+	}
+	return endpoint
+}
+
+// order returns the endpoints in the sequence they should be tried; healthy
+// endpoints come before ones with an open circuit
+func (r *rpcRegistry) order(urls []string, strategy string) []string {
+	r.Lock()
+	defer r.Unlock()
+	ordered := make([]string, 0, len(urls))
+	start := 0
+	if strategy == StrategyRoundRobin && len(urls) > 0 {
+		start = r.next % len(urls)
+		r.next++
+	}
+	for i := range urls {
+		ordered = append(ordered, urls[(start+i)%len(urls)])
+	}
+	now := time.Now()
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return r.endpoint(ordered[i]).state(now) != circuitOpen && r.endpoint(ordered[j]).state(now) == circuitOpen
+	})
+	return ordered
+}
+
+// allow reports whether a call to url may proceed through the circuit
+// breaker. Once the cooldown of an open circuit has passed, a single call is
+// let through as a probe, and the others are refused until its outcome
+// closes the circuit or opens it again.
+func (r *rpcRegistry) allow(url string) bool {
+	r.Lock()
+	defer r.Unlock()
+	endpoint := r.endpoint(url)
+	switch endpoint.state(time.Now()) {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		if endpoint.Probing {
+			return false
+		}
+		endpoint.Probing = true
+	}
+	return true
+}
+
+// available reports whether the circuit of url is not open, without
+// claiming the probe of a half-open circuit
+func (r *rpcRegistry) available(url string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.endpoint(url).state(time.Now()) != circuitOpen
+}
+
+// tripped reports whether the circuit of url is no longer closed
+func (r *rpcRegistry) tripped(url string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.endpoint(url).state(time.Now()) != circuitClosed
+}
+
+func (r *rpcRegistry) recordSuccess(url string) {
+	r.Lock()
+	defer r.Unlock()
+	endpoint := r.endpoint(url)
+	endpoint.ConsecutiveFailures = 0
+	endpoint.OpenUntil = time.Time{}
+	endpoint.Probing = false
+	endpoint.LastSuccess = time.Now()
+}
+
+func (r *rpcRegistry) recordFailure(url string, err error, threshold int, cooldown time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	endpoint := r.endpoint(url)
+	endpoint.ConsecutiveFailures++
+	endpoint.Probing = false
+	endpoint.LastFailure = time.Now()
+	endpoint.LastError = err.Error()
+	if endpoint.ConsecutiveFailures >= threshold {
+		endpoint.OpenUntil = endpoint.LastFailure.Add(cooldown)
+	}
+}
+
+func (r *rpcRegistry) status() []map[string]interface{} {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	var urls []string
+	for url := range r.endpoints {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	var result []map[string]interface{}
+	for _, url := range urls {
+		endpoint := r.endpoints[url]
+		transport, _ := rpcTransportOf(endpoint.URL)
+		entry := map[string]interface{}{
+			"url":                  endpoint.URL,
+			"transport":            transport,
+			"state":                endpoint.state(now),
+			"consecutive_failures": endpoint.ConsecutiveFailures,
+			"last_error":           endpoint.LastError,
+		}
+		if !endpoint.LastSuccess.IsZero() {
+			entry["last_success"] = endpoint.LastSuccess.UTC().Format(time.RFC3339)
+		}
+		if !endpoint.LastFailure.IsZero() {
+			entry["last_failure"] = endpoint.LastFailure.UTC().Format(time.RFC3339)
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// rpcTransportOf returns the transport an RPC endpoint is reached with
+func rpcTransportOf(url string) (string, error) {
+	if strings.HasPrefix(url, "/") {
+		return TransportIPC, nil
+	}
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return Empty, fmt.Errorf("%w: %s is not an RPC endpoint: %v", ErrInvalidInput, url, err)
+	}
+	switch parsed.Scheme {
+	case "http", "https":
+		return TransportHTTP, nil
+	case "ws", "wss":
+		return TransportWebSocket, nil
+	}
+	return Empty, fmt.Errorf("%w: %s is not an RPC endpoint: use an http(s):// or ws(s):// URL or the absolute path of an IPC socket", ErrInvalidInput, url)
+}
+
+// validRPCURLs returns an error for the first of urls no transport can reach
+func validRPCURLs(urls ...string) error {
+	for _, url := range urls {
+		if url == Empty {
+			continue
+		}
+		if _, err := rpcTransportOf(url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribable reports whether any endpoint of config is reached over
+// WebSocket or IPC, and so can be subscribed to
+func (config *ConfigJSON) subscribable() bool {
+	for _, url := range config.rpcURLs() {
+		if transport, err := rpcTransportOf(url); err == nil && transport != TransportHTTP {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcTransport retries failed round trips with exponential backoff, fails
+// over between endpoints and feeds each outcome into the circuit breaker.
+// With relays, the transactions it broadcasts go to them instead. A broadcast
+// is sent once: a node may have taken a transaction whose answer timed out,
+// so it is only failed over when the endpoint could not be connected to.
+type rpcTransport struct {
+	urls     []string
+	relays   []string
+	config   *ConfigJSON
+	registry *rpcRegistry
+	base     http.RoundTripper
+}
+
+func (t *rpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	defer timed(req.Context(), rpcTime)()
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(t.relays) > 0 {
+		sends, err := sendsTransaction(body)
+		if err != nil {
+			return nil, err
+		}
+		if sends {
+			return t.relay(req, body)
+		}
+	}
+	broadcast := false
+	for _, method := range rpcMethods(body) {
+		broadcast = broadcast || method == sendRawTransaction
+	}
+	retries := t.config.rpcRetries()
+	if broadcast {
+		retries = 0
+	}
+	var lastErr error
+	for _, url := range t.registry.order(t.urls, t.config.rpcStrategy()) {
+		if !t.registry.allow(url) {
+			lastErr = fmt.Errorf("circuit open for %s", url)
+			continue
+		}
+		resp, err := t.roundTripEndpoint(req, url, body, retries)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+		if broadcast && !isDialError(err) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrRPCUnavailable, lastErr)
+}
+
+// relay answers a broadcast with the answer of the private relays
+func (t *rpcTransport) relay(req *http.Request, body []byte) (*http.Response, error) {
+	result, err := relayTransaction(req.Context(), t.relays, body, time.Duration(t.config.rpcTimeout())*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", result.status, http.StatusText(result.status)),
+		StatusCode:    result.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(result.body)),
+		ContentLength: int64(len(result.body)),
+		Request:       req,
+	}, nil
+}
+
+// isDialError reports whether a round trip failed to connect, and so never
+// reached the node
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (t *rpcTransport) roundTripEndpoint(req *http.Request, url string, body []byte, retries int) (*http.Response, error) {
+	target, err := neturl.Parse(url)
+	if err != nil {
+		t.registry.recordFailure(url, err, t.config.circuitThreshold(), time.Duration(t.config.circuitCooldown())*time.Second)
+		return nil, err
+	}
+	backoff := time.Duration(t.config.rpcBackoff()) * time.Second
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		attemptReq := req.Clone(req.Context())
+		attemptReq.URL = target
+		attemptReq.Host = target.Host
+		attemptReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if requestID := requestIDFromContext(req.Context()); requestID != Empty {
+			attemptReq.Header.Set("X-Request-Id", requestID)
+			attemptReq.Header.Set("traceparent", traceParent(requestID))
+		}
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			t.registry.recordSuccess(url)
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		lastErr = fmt.Errorf("%s: %w", url, err)
+		t.registry.recordFailure(url, err, t.config.circuitThreshold(), time.Duration(t.config.circuitCooldown())*time.Second)
+		if req.Context().Err() != nil || t.registry.tripped(url) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// dialRPC connects to the configured RPC endpoints with timeouts, retries,
+// failover and circuit breaking applied
+func (b *PluginBackend) dialRPC(ctx context.Context, config *ConfigJSON) (*xcbclient.Client, error) {
+	client, err := b.dialRPCClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return xcbclient.NewClient(client), nil
+}
+
+// dialRPCClient is dialRPC for callers that need raw JSON-RPC access. The
+// endpoints are tried in order: the first that is reached over HTTP is
+// returned with the HTTP endpoints to fail over to on every call, while a
+// WebSocket or IPC endpoint is a single connection and is only failed over
+// from when it cannot be connected to; rpc_timeout bounds the connection,
+// and the caller's context each call made over it.
+func (b *PluginBackend) dialRPCClient(ctx context.Context, config *ConfigJSON) (*rpc.Client, error) {
+	urls := config.rpcURLs()
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("%w: no RPC endpoint configured", ErrRPCUnavailable)
+	}
+	timeout := time.Duration(config.rpcTimeout()) * time.Second
+	var httpURLs []string
+	for _, url := range urls {
+		if transport, _ := rpcTransportOf(url); transport == TransportHTTP {
+			httpURLs = append(httpURLs, url)
+		}
+	}
+	if privateBroadcast(ctx) {
+		// only rpcTransport can hold a broadcast back from the node
+		if len(config.PrivateRelayURLs) == 0 {
+			return nil, fmt.Errorf("%w: the account broadcasts privately and no private_relay_urls are configured", ErrInvalidInput)
+		}
+		if len(httpURLs) == 0 {
+			return nil, fmt.Errorf("%w: an account that broadcasts privately needs an http or https RPC endpoint", ErrRPCUnavailable)
+		}
+		return dialHTTPRPC(httpURLs[0], httpURLs, config.PrivateRelayURLs, config, b.rpcRegistry, timeout)
+	}
+	if len(httpURLs) == len(urls) {
+		return dialHTTPRPC(urls[0], httpURLs, nil, config, b.rpcRegistry, timeout)
+	}
+	// rpcTransport rotates the HTTP endpoints on its own, so the order here is
+	// that of the config
+	var lastErr error
+	for _, url := range b.rpcRegistry.order(urls, StrategyPriority) {
+		transport, err := rpcTransportOf(url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if transport == TransportHTTP && b.rpcRegistry.available(url) {
+			// rpcTransport passes each call through the circuit breaker
+			return dialHTTPRPC(url, httpURLs, nil, config, b.rpcRegistry, timeout)
+		}
+		if transport == TransportHTTP || !b.rpcRegistry.allow(url) {
+			lastErr = fmt.Errorf("circuit open for %s", url)
+			continue
+		}
+		client, err := dialPersistentRPC(ctx, url, timeout)
+		if err == nil {
+			b.rpcRegistry.recordSuccess(url)
+			return client, nil
+		}
+		lastErr = fmt.Errorf("%s: %v", url, err)
+		b.rpcRegistry.recordFailure(url, err, config.circuitThreshold(), time.Duration(config.circuitCooldown())*time.Second)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrRPCUnavailable, lastErr)
+}
+
+// dialHTTPRPC returns a client that sends every call through rpcTransport,
+// and its broadcasts to relays if there are any
+func dialHTTPRPC(url string, urls, relays []string, config *ConfigJSON, registry *rpcRegistry, timeout time.Duration) (*rpc.Client, error) {
+	httpClient := &http.Client{
+		Transport: &rpcTransport{
+			urls:     urls,
+			relays:   relays,
+			config:   config,
+			registry: registry,
+			base: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: timeout}).DialContext,
+				TLSHandshakeTimeout:   timeout,
+				ResponseHeaderTimeout: timeout,
+			},
+		},
+	}
+	client, err := rpc.DialHTTPWithClient(url, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot connect to %s", ErrRPCUnavailable, url)
+	}
+	return client, nil
+}
+
+// dialPersistentRPC connects to a WebSocket or IPC endpoint within timeout
+func dialPersistentRPC(ctx context.Context, url string, timeout time.Duration) (*rpc.Client, error) {
+	defer timed(ctx, rpcTime)()
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return rpc.DialContext(dialCtx, url)
+}
+
+func rpcStatusPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("config/rpc/status"),
+			HelpSynopsis: "Return the health of the RPC endpoints used by this mount.",
+			HelpDescription: `
+
+Return the transport, circuit breaker state, consecutive failures and last
+error for each configured RPC endpoint and any other endpoint this mount has
+called since the plugin started, and the newHeads subscription of every
+chain with a WebSocket or IPC endpoint: the head it last saw and the
+transactions it is tracking.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathReadRPCStatus,
+			},
+		},
+	}
+}
+
+func (b *PluginBackend) pathReadRPCStatus(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	b.rpcRegistry.Lock()
+	for _, url := range config.rpcURLs() {
+		b.rpcRegistry.endpoint(url)
+	}
+	b.rpcRegistry.Unlock()
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"strategy":      config.rpcStrategy(),
+			"endpoints":     b.rpcRegistry.status(),
+			"subscriptions": b.headWatchers.status(),
+		},
+	}, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBroadcastIsSentOnce(t *testing.T) {
+	var calls int32
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer node.Close()
+	transport := &rpcTransport{
+		urls:     []string{node.URL + "/a", node.URL + "/b"},
+		config:   &ConfigJSON{RPCRetries: 2, RPCBackoff: 0},
+		registry: newRPCRegistry(),
+		base:     http.DefaultTransport,
+	}
+	roundTrip := func(method string) {
+		body := []byte(`{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":[]}`)
+		req, err := http.NewRequest(http.MethodPost, node.URL, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := transport.RoundTrip(req); err == nil {
+			t.Fatalf("%s succeeded against a failing node", method)
+		}
+	}
+	roundTrip(sendRawTransaction)
+	if calls != 1 {
+		t.Fatalf("a broadcast was sent %d times", calls)
+	}
+	roundTrip("xcb_blockNumber")
+	if calls != 7 {
+		t.Fatalf("a read was sent %d times, want 3 to each endpoint", calls-1)
+	}
+}
+
+func TestHalfOpenCircuitAdmitsOneProbe(t *testing.T) {
+	registry := newRPCRegistry()
+	url := "http://node"
+	for i := 0; i < DefaultCircuitThreshold; i++ {
+		registry.recordFailure(url, http.ErrHandlerTimeout, DefaultCircuitThreshold, time.Millisecond)
+	}
+	if registry.allow(url) {
+		t.Fatal("an open circuit let a call through")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if !registry.allow(url) {
+		t.Fatal("a half-open circuit let no probe through")
+	}
+	if registry.allow(url) {
+		t.Fatal("a half-open circuit let a second call through while the probe runs")
+	}
+	registry.recordSuccess(url)
+	if !registry.allow(url) || !registry.allow(url) {
+		t.Fatal("a circuit closed by its probe refused calls")
+	}
+}
+
+func TestAlreadyKnownIsBroadcast(t *testing.T) {
+	if err := classifySendError(errors.New("already known")); err != nil {
+		t.Fatalf("a transaction the node already holds failed: %v", err)
+	}
+	if err := classifySendError(errors.New("nonce too low")); !errors.Is(err, ErrNonceConflict) {
+		t.Fatalf("a stale nonce was classified as %v", err)
+	}
+}
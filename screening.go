@@ -0,0 +1,291 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// DefaultScreeningTimeout bounds a call to the screening API, in seconds
+	DefaultScreeningTimeout int = 5
+	// DefaultScreeningCacheTTL is how long a screening verdict is reused, in seconds
+	DefaultScreeningCacheTTL int = 3600
+
+	riskLow    string = "low"
+	riskMedium string = "medium"
+	riskHigh   string = "high"
+	riskSevere string = "severe"
+)
+
+// riskLevels are the risk levels of screening verdicts, lowest first, as
+// Chainalysis and TRM name them
+var riskLevels = []string{riskLow, riskMedium, riskHigh, riskSevere}
+
+func riskRank(level string) int {
+	for i, known := range riskLevels {
+		if known == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// ScreeningInput is what the screening API is asked about a destination
+type ScreeningInput struct {
+	Address string `json:"address"`
+	Chain   string `json:"chain,omitempty"`
+	ChainID string `json:"chain_id"`
+}
+
+// ScreeningVerdict is the risk the screening API gave a destination of a transaction
+type ScreeningVerdict struct {
+	Address string `json:"address"`
+	Risk    string `json:"risk"`
+	Reason  string `json:"reason,omitempty"`
+	Cached  bool   `json:"cached,omitempty"`
+	expires time.Time
+}
+
+// screeningCache remembers verdicts of the screening API for screening_cache_ttl
+type screeningCache struct {
+	sync.Mutex
+	verdicts map[string]*ScreeningVerdict
+}
+
+func newScreeningCache() *screeningCache {
+	return &screeningCache{verdicts: map[string]*ScreeningVerdict{}}
+}
+
+func (c *screeningCache) get(key string) *ScreeningVerdict {
+	c.Lock()
+	defer c.Unlock()
+	verdict := c.verdicts[key]
+	if verdict != nil && time.Now().After(verdict.expires) {
+		delete(c.verdicts, key)
+		return nil
+	}
+	return verdict
+}
+
+func (c *screeningCache) put(key string, verdict *ScreeningVerdict) {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	for k, cached := range c.verdicts {
+		if now.After(cached.expires) {
+			delete(c.verdicts, k)
+		}
+	}
+	c.verdicts[key] = verdict
+}
+
+// destinations returns where a transaction sends value: its recipient and
+// the addresses among the arguments of its decoded call, such as the
+// recipient of a token transfer
+func destinations(tx *types.Transaction, call *DecodedCall) []string {
+	var addresses []string
+	if tx.To() != nil {
+		addresses = append(addresses, tx.To().Hex())
+	}
+	if call != nil {
+		for _, argument := range call.Arguments {
+			value, ok := argument.(string)
+			if !ok || strings.HasPrefix(value, "0x") || !common.IsHexAddress(value) {
+				continue
+			}
+			if address, err := common.HexToAddress(value); err == nil {
+				addresses = append(addresses, address.Hex())
+			}
+		}
+	}
+	return util.Dedup(addresses)
+}
+
+// checkScreening asks the screening API about every destination of a
+// transaction. A destination at or above screening_block_risk refuses it, and
+// one at or above screening_approval_risk holds it to an approved
+// authorization. An API that cannot be reached refuses it too.
+func (b *PluginBackend) checkScreening(ctx context.Context, scope *signingScope, config *ConfigJSON, tx *types.Transaction, call *DecodedCall) error {
+	if config.ScreeningURL == Empty {
+		return nil
+	}
+	worst, err := b.screenDestinations(ctx, config, config.ChainID, destinations(tx, call))
+	if err != nil || worst == nil {
+		return err
+	}
+	switch rank := riskRank(worst.Risk); {
+	case rank >= riskRank(config.screeningBlockRisk()):
+		err = fmt.Errorf("%w: %s", ErrPolicyViolation, worst.described())
+	case rank >= riskRank(config.screeningApprovalRisk()):
+		if err = b.useAuthorization(ctx, scope.req, scope.account); err != nil {
+			err = fmt.Errorf("%w (%s)", err, worst.described())
+		}
+	}
+	recordRule(ctx, "screening", err)
+	return err
+}
+
+// checkKeyDestinations holds a transaction signed with a key of keys/ to the
+// sanctions list and the screening API, as checkTransaction holds those of
+// accounts. A key has no authorizations, so a destination at or above
+// screening_approval_risk refuses the transaction.
+func (b *PluginBackend) checkKeyDestinations(ctx context.Context, req *logical.Request, chainID string, addresses []string) error {
+	if err := b.checkSanctions(ctx, req.Storage, addresses); err != nil {
+		return err
+	}
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil || config.ScreeningURL == Empty {
+		return err
+	}
+	worst, err := b.screenDestinations(ctx, config, chainID, addresses)
+	if err != nil || worst == nil {
+		return err
+	}
+	if rank := riskRank(worst.Risk); rank >= riskRank(config.screeningBlockRisk()) || rank >= riskRank(config.screeningApprovalRisk()) {
+		err = fmt.Errorf("%w: %s, and keys/ has no authorizations to approve it", ErrPolicyViolation, worst.described())
+	}
+	recordRule(ctx, "screening", err)
+	return err
+}
+
+// refuseUnscreened refuses to sign what has destinations the mount does not
+// decode while it screens destinations, with the screening API or a sanctions
+// list: what cannot be screened is not signed.
+func (b *PluginBackend) refuseUnscreened(ctx context.Context, req *logical.Request, what string) error {
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	_, listed, err := b.sanctioned(ctx, req.Storage, nil)
+	if err != nil || (config.ScreeningURL == Empty && !listed) {
+		return err
+	}
+	err = fmt.Errorf("%w: the destinations of %s are not decoded, so they cannot be screened", ErrPolicyViolation, what)
+	recordRule(ctx, "screening", err)
+	return err
+}
+
+// screenDestinations asks the screening API about each address and returns
+// the riskiest verdict, nil if there is no address
+func (b *PluginBackend) screenDestinations(ctx context.Context, config *ConfigJSON, chainID string, addresses []string) (*ScreeningVerdict, error) {
+	chain := Empty
+	recorder := decisionFromContext(ctx)
+	if recorder != nil {
+		recorder.Lock()
+		chain = recorder.chain
+		recorder.Unlock()
+	}
+	var worst *ScreeningVerdict
+	for _, address := range addresses {
+		verdict, err := b.screen(ctx, config, &ScreeningInput{Address: address, Chain: chain, ChainID: chainID})
+		if err != nil {
+			b.Logger().Error("screening failed; refusing to sign", "url", config.ScreeningURL, "address", address, "error", err)
+			err = wrapError(ErrScreeningUnavailable, err)
+			recordRule(ctx, "screening", err)
+			return nil, err
+		}
+		if recorder != nil {
+			recorder.Lock()
+			recorder.screening = append(recorder.screening, *verdict)
+			recorder.Unlock()
+		}
+		if worst == nil || riskRank(verdict.Risk) > riskRank(worst.Risk) {
+			worst = verdict
+		}
+	}
+	return worst, nil
+}
+
+// described says why a verdict refuses or holds a transaction
+func (verdict *ScreeningVerdict) described() string {
+	described := fmt.Sprintf("destination %s is %s risk", verdict.Address, verdict.Risk)
+	if verdict.Reason != Empty {
+		described += ": " + verdict.Reason
+	}
+	return described
+}
+
+// screen returns the verdict of the screening API on a destination, from the
+// cache while it is fresh
+func (b *PluginBackend) screen(ctx context.Context, config *ConfigJSON, input *ScreeningInput) (*ScreeningVerdict, error) {
+	key := strings.Join([]string{config.ScreeningURL, input.ChainID, input.Address}, "\n")
+	if cached := b.screeningCache.get(key); cached != nil {
+		verdict := *cached
+		verdict.Cached = true
+		return &verdict, nil
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	timeout := DefaultScreeningTimeout
+	if config.ScreeningTimeout > 0 {
+		timeout = config.ScreeningTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, config.ScreeningURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if config.ScreeningAPIKey != Empty {
+		request.Header.Set("Authorization", "Bearer "+config.ScreeningAPIKey)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	answer, err := ioutil.ReadAll(io.LimitReader(response.Body, maxExternalResponse))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", response.StatusCode)
+	}
+	var decoded struct {
+		Risk   string `json:"risk"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(answer, &decoded); err != nil {
+		return nil, fmt.Errorf("cannot decode the answer: %v", err)
+	}
+	verdict := &ScreeningVerdict{Address: input.Address, Risk: strings.ToLower(decoded.Risk), Reason: decoded.Reason}
+	if riskRank(verdict.Risk) < 0 {
+		return nil, fmt.Errorf("unknown risk %q", decoded.Risk)
+	}
+	if ttl := config.ScreeningCacheTTL; ttl > 0 {
+		verdict.expires = time.Now().Add(time.Duration(ttl) * time.Second)
+		b.screeningCache.put(key, verdict)
+	}
+	return verdict, nil
+}
@@ -0,0 +1,192 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// MnemonicScrubWords is the shortest run of BIP-39 words that is taken for a mnemonic
+const MnemonicScrubWords int = 12
+
+var (
+	// a bare ed448 private key is 57 bytes
+	privateKeyPattern = regexp.MustCompile(`\b(0x)?[0-9a-fA-F]{114}\b`)
+	wordPattern       = regexp.MustCompile(`[a-z]+`)
+)
+
+// scrubber masks sensitive values in everything the plugin logs, whatever
+// the call site: field names from sensitiveFields, private keys, mnemonics and
+// the patterns of log_redact_patterns.
+type scrubber struct {
+	sync.RWMutex
+	source   []string
+	patterns []*regexp.Regexp
+}
+
+// setPatterns replaces the configured patterns; they were validated when config was written
+func (s *scrubber) setPatterns(patterns []string) {
+	s.RLock()
+	unchanged := strings.Join(s.source, "\n") == strings.Join(patterns, "\n")
+	s.RUnlock()
+	if unchanged {
+		return
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if re, err := regexp.Compile(pattern); err == nil {
+			compiled = append(compiled, re)
+		}
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.source = patterns
+	s.patterns = compiled
+}
+
+// scrubString masks whatever looks sensitive in a string
+func (s *scrubber) scrubString(value string) string {
+	value = privateKeyPattern.ReplaceAllString(value, redacted)
+	value = scrubMnemonics(value)
+	s.RLock()
+	defer s.RUnlock()
+	for _, re := range s.patterns {
+		value = re.ReplaceAllString(value, redacted)
+	}
+	return value
+}
+
+// scrubMnemonics masks every run of MnemonicScrubWords or more BIP-39 words
+func scrubMnemonics(value string) string {
+	words := wordPattern.FindAllStringIndex(value, -1)
+	var out strings.Builder
+	last := 0
+	for i := 0; i < len(words); {
+		j := i
+		for j < len(words) {
+			if _, ok := bip39.GetWordIndex(value[words[j][0]:words[j][1]]); !ok {
+				break
+			}
+			if j > i && strings.TrimSpace(value[words[j-1][1]:words[j][0]]) != Empty {
+				break
+			}
+			j++
+		}
+		if j-i >= MnemonicScrubWords {
+			out.WriteString(value[last:words[i][0]])
+			out.WriteString(redacted)
+			last = words[j-1][1]
+			i = j
+			continue
+		}
+		if j == i {
+			j++
+		}
+		i = j
+	}
+	if last == 0 {
+		return value
+	}
+	out.WriteString(value[last:])
+	return out.String()
+}
+
+// scrubValue masks a log argument
+func (s *scrubber) scrubValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return s.scrubString(v)
+	case error:
+		return s.scrubString(v.Error())
+	case fmt.Stringer:
+		return s.scrubString(v.String())
+	case map[string]interface{}:
+		safe := redact(v)
+		for key, field := range safe {
+			safe[key] = s.scrubValue(field)
+		}
+		return safe
+	default:
+		return value
+	}
+}
+
+// scrubArgs masks the key/value pairs of a log line
+func (s *scrubber) scrubArgs(args []interface{}) []interface{} {
+	safe := make([]interface{}, len(args))
+	for i, arg := range args {
+		if i%2 == 1 {
+			if key, ok := args[i-1].(string); ok && sensitiveField(key) {
+				safe[i] = redacted
+				continue
+			}
+		}
+		safe[i] = s.scrubValue(arg)
+	}
+	return safe
+}
+
+// scrubbingLogger is an hclog.Logger that scrubs every line before it is written
+type scrubbingLogger struct {
+	hclog.Logger
+	scrubber *scrubber
+}
+
+func (l *scrubbingLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	l.Logger.Log(level, l.scrubber.scrubString(msg), l.scrubber.scrubArgs(args)...)
+}
+
+func (l *scrubbingLogger) Trace(msg string, args ...interface{}) {
+	l.Logger.Trace(l.scrubber.scrubString(msg), l.scrubber.scrubArgs(args)...)
+}
+
+func (l *scrubbingLogger) Debug(msg string, args ...interface{}) {
+	l.Logger.Debug(l.scrubber.scrubString(msg), l.scrubber.scrubArgs(args)...)
+}
+
+func (l *scrubbingLogger) Info(msg string, args ...interface{}) {
+	l.Logger.Info(l.scrubber.scrubString(msg), l.scrubber.scrubArgs(args)...)
+}
+
+func (l *scrubbingLogger) Warn(msg string, args ...interface{}) {
+	l.Logger.Warn(l.scrubber.scrubString(msg), l.scrubber.scrubArgs(args)...)
+}
+
+func (l *scrubbingLogger) Error(msg string, args ...interface{}) {
+	l.Logger.Error(l.scrubber.scrubString(msg), l.scrubber.scrubArgs(args)...)
+}
+
+func (l *scrubbingLogger) With(args ...interface{}) hclog.Logger {
+	return &scrubbingLogger{Logger: l.Logger.With(l.scrubber.scrubArgs(args)...), scrubber: l.scrubber}
+}
+
+func (l *scrubbingLogger) Named(name string) hclog.Logger {
+	return &scrubbingLogger{Logger: l.Logger.Named(name), scrubber: l.scrubber}
+}
+
+func (l *scrubbingLogger) ResetNamed(name string) hclog.Logger {
+	return &scrubbingLogger{Logger: l.Logger.ResetNamed(name), scrubber: l.scrubber}
+}
+
+// Logger returns the logger of the backend with every line scrubbed
+func (b *PluginBackend) Logger() hclog.Logger {
+	return &scrubbingLogger{Logger: b.Backend.Logger(), scrubber: b.scrubber}
+}
@@ -0,0 +1,258 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// DefaultShadowTimeout is how long a shadow mount has to sign, in seconds
+	DefaultShadowTimeout int = 10
+
+	eventShadowMismatch string = "shadow_mismatch"
+)
+
+// shadowOperations are the operations that only sign, which a shadow mount
+// can repeat without sending anything twice
+var shadowOperations = []string{"/sign", "/sign-tx", "/sign-digest"}
+
+// shadowCompared are the results of a signing that must match byte for byte
+var shadowCompared = []string{"signature", "signed_transaction", "transaction_hash"}
+
+// shadowWithheld are the parameters a shadow mount is not sent: they are
+// single-use or unseal an account, and a shadow mount has no use for them
+var shadowWithheld = []string{"authorization_id", "mfa_code", "passphrase_shares"}
+
+// ShadowMismatch is a signing whose result the shadow mount did not reproduce
+type ShadowMismatch struct {
+	Time    time.Time `json:"time"`
+	Path    string    `json:"path"`
+	Field   string    `json:"field"`
+	Primary string    `json:"primary"`
+	Shadow  string    `json:"shadow"`
+}
+
+// shadowStats counts the signings compared with the shadow mount since the plugin started
+type shadowStats struct {
+	sync.Mutex
+	compared     uint64
+	matched      uint64
+	mismatched   uint64
+	failed       uint64
+	lastMismatch *ShadowMismatch
+	lastError    string
+}
+
+func shadowPaths(b *PluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      QualifiedPath("shadow"),
+			HelpSynopsis: "Return how the signings repeated on the shadow mount compared.",
+			HelpDescription: `
+
+When shadow_url is configured, every sign, sign-tx and sign-digest that
+succeeds is repeated on that mount - another cluster, or the same accounts on
+a new version of this plugin - and the signatures, signed transactions and
+transaction hashes of the two are compared byte for byte. The comparison runs
+in the background and never delays or fails the request; a mismatch is
+logged and raises a shadow_mismatch event. Transfers, deployments and other
+operations that send are never repeated.
+
+The shadow mount is sent the request as it was made, with the nonce and gas
+this mount settled on, but without authorization IDs, MFA codes or passphrase
+shares, so its accounts must sign without them, and it must not shadow back
+to this mount. Canaries are not shadowed.
+
+Return the signings compared, matched, mismatched and failed since the plugin
+started, with the last mismatch and the last failure; delete to reset them.
+
+`,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.pathShadowRead,
+				logical.DeleteOperation: b.pathShadowDelete,
+			},
+		},
+	}
+}
+
+// shadowSign repeats a successful signing on the shadow mount and compares
+// the results in the background
+func (b *PluginBackend) shadowSign(ctx context.Context, req *logical.Request, data *framework.FieldData, resp *logical.Response) {
+	if resp == nil || resp.Data == nil {
+		return
+	}
+	shadowed := false
+	for _, suffix := range shadowOperations {
+		if strings.HasSuffix(req.Path, suffix) {
+			shadowed = true
+		}
+	}
+	if !shadowed {
+		return
+	}
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil || config.ShadowURL == Empty {
+		return
+	}
+	body := map[string]interface{}{}
+	for key, value := range data.Raw {
+		body[key] = value
+	}
+	for _, key := range shadowWithheld {
+		delete(body, key)
+	}
+	// the shadow mount signs with what this mount settled on, not what it would look up
+	for _, key := range []string{"nonce", "gas_price", "gas_limit"} {
+		if value, ok := resp.Data[key]; ok && strings.HasSuffix(req.Path, "/sign-tx") {
+			body[key] = fmt.Sprint(value)
+		}
+	}
+	primary := map[string]string{}
+	for _, key := range shadowCompared {
+		if value, ok := resp.Data[key]; ok {
+			primary[key] = fmt.Sprint(value)
+		}
+	}
+	if len(primary) == 0 {
+		return
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	url := strings.TrimSuffix(config.ShadowURL, "/") + "/" + req.Path
+	timeout := time.Duration(config.shadowTimeout()) * time.Second
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		shadow, err := askShadow(ctx, url, config.ShadowToken, encoded)
+		b.shadowStats.Lock()
+		defer b.shadowStats.Unlock()
+		b.shadowStats.compared++
+		if err != nil {
+			b.shadowStats.failed++
+			b.shadowStats.lastError = err.Error()
+			b.Logger().Warn("the shadow mount did not sign", "path", req.Path, "error", err)
+			return
+		}
+		for _, key := range shadowCompared {
+			value, ok := primary[key]
+			if !ok || shadow[key] == value {
+				continue
+			}
+			mismatch := &ShadowMismatch{Time: time.Now().UTC(), Path: req.Path, Field: key, Primary: value, Shadow: shadow[key]}
+			b.shadowStats.mismatched++
+			b.shadowStats.lastMismatch = mismatch
+			b.Logger().Error("the shadow mount signed differently", "path", req.Path, "field", key, "primary", value, "shadow", shadow[key])
+			b.notify(config, req, eventShadowMismatch, map[string]interface{}{
+				"field":   key,
+				"primary": value,
+				"shadow":  shadow[key],
+			})
+			return
+		}
+		b.shadowStats.matched++
+	}()
+}
+
+// askShadow sends a signing request to the shadow mount and returns the
+// results to compare
+func askShadow(ctx context.Context, url, token string, body []byte) (map[string]string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if token != Empty {
+		request.Header.Set("X-Vault-Token", token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	answer, err := ioutil.ReadAll(io.LimitReader(response.Body, maxExternalResponse))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the shadow mount answered status %d: %s", response.StatusCode, strings.TrimSpace(string(answer)))
+	}
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(answer, &result); err != nil {
+		return nil, fmt.Errorf("cannot decode the answer of the shadow mount: %v", err)
+	}
+	shadow := map[string]string{}
+	for _, key := range shadowCompared {
+		if value, ok := result.Data[key]; ok {
+			shadow[key] = fmt.Sprint(value)
+		}
+	}
+	return shadow, nil
+}
+
+func (b *PluginBackend) pathShadowRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.configured(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	b.shadowStats.Lock()
+	defer b.shadowStats.Unlock()
+	responseData := map[string]interface{}{
+		"shadow_url": config.ShadowURL,
+		"compared":   b.shadowStats.compared,
+		"matched":    b.shadowStats.matched,
+		"mismatched": b.shadowStats.mismatched,
+		"failed":     b.shadowStats.failed,
+	}
+	if mismatch := b.shadowStats.lastMismatch; mismatch != nil {
+		responseData["last_mismatch"] = map[string]interface{}{
+			"time":    mismatch.Time.Format(time.RFC3339),
+			"path":    mismatch.Path,
+			"field":   mismatch.Field,
+			"primary": mismatch.Primary,
+			"shadow":  mismatch.Shadow,
+		}
+	}
+	if b.shadowStats.lastError != Empty {
+		responseData["last_error"] = b.shadowStats.lastError
+	}
+	return &logical.Response{
+		Data: responseData,
+	}, nil
+}
+
+func (b *PluginBackend) pathShadowDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.shadowStats.Lock()
+	defer b.shadowStats.Unlock()
+	b.shadowStats.compared, b.shadowStats.matched, b.shadowStats.mismatched, b.shadowStats.failed = 0, 0, 0, 0
+	b.shadowStats.lastMismatch, b.shadowStats.lastError = nil, Empty
+	return nil, nil
+}
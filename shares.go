@@ -0,0 +1,154 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+// passphraseSharesSchema describes the shares that unseal a sealed account for one request
+var passphraseSharesSchema = &framework.FieldSchema{
+	Type:        framework.TypeCommaStringSlice,
+	Description: "For sealed accounts: at least passphrase_threshold of the shares returned when the account was created.",
+}
+
+// sealed returns true if the account's mnemonic is only stored encrypted under a split key
+func (account *AccountJSON) sealed() bool {
+	return account.SealedMnemonic != Empty
+}
+
+// accountAddress returns the address of an account without needing its key:
+// the recorded address, or the one its key derives
+func accountAddress(ctx context.Context, accountJSON AccountJSON) (common.Address, error) {
+	if accountJSON.Address != Empty {
+		return common.HexToAddress(accountJSON.Address)
+	}
+	_, account, err := getWalletAndAccount(ctx, accountJSON)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return account.Address, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealAccount encrypts the account's mnemonic under a fresh key, splits the key
+// into parts shares and removes the plaintext mnemonic. Only the shares can
+// unseal the account again; Vault never stores them.
+func sealAccount(accountJSON *AccountJSON, address common.Address, parts, threshold int) ([]string, error) {
+	key := make([]byte, 32)
+	defer util.ZeroBytes(key)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	shares, err := util.SplitSecret(key, parts, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	encodedShares := make([]string, len(shares))
+	for i, share := range shares {
+		encodedShares[i] = hexutil.Encode(share)
+		util.ZeroBytes(share)
+	}
+	accountJSON.SealedMnemonic = hexutil.Encode(gcm.Seal(nonce, nonce, []byte(accountJSON.Mnemonic), nil))
+	accountJSON.ShareThreshold = threshold
+	accountJSON.Address = address.Hex()
+	accountJSON.Mnemonic = Empty
+	return encodedShares, nil
+}
+
+// unsealAccount combines the shares in memory and decrypts the mnemonic into
+// accountJSON for the duration of the request. The shares and the combined key
+// are zeroed; the mnemonic is not: it is a string, as the hdwallet takes it,
+// and stays in memory until it is collected.
+func unsealAccount(accountJSON *AccountJSON, encodedShares []string) error {
+	if len(encodedShares) < accountJSON.ShareThreshold {
+		return fmt.Errorf("%w: %d of %d passphrase shares supplied", ErrApprovalRequired, len(encodedShares), accountJSON.ShareThreshold)
+	}
+	shares := make([][]byte, len(encodedShares))
+	for i, encoded := range encodedShares {
+		share, err := hexutil.Decode(encoded)
+		if err != nil {
+			return fmt.Errorf("%w: malformed passphrase share", ErrInvalidInput)
+		}
+		shares[i] = share
+	}
+	key, err := util.CombineShares(shares)
+	for _, share := range shares {
+		util.ZeroBytes(share)
+	}
+	if err != nil {
+		return wrapError(ErrKeystoreDecrypt, err)
+	}
+	defer util.ZeroBytes(key)
+	sealed, err := hexutil.Decode(accountJSON.SealedMnemonic)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return fmt.Errorf("%w: sealed mnemonic is corrupt", ErrKeystoreDecrypt)
+	}
+	mnemonic, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return fmt.Errorf("%w: the passphrase shares do not unseal this account", ErrKeystoreDecrypt)
+	}
+	accountJSON.Mnemonic = string(mnemonic)
+	return nil
+}
+
+// unsealFromRequest unseals a sealed account if the request carries passphrase shares
+func unsealFromRequest(req *logical.Request, accountJSON *AccountJSON) error {
+	if !accountJSON.sealed() {
+		return nil
+	}
+	data := &framework.FieldData{
+		Raw:    req.Data,
+		Schema: map[string]*framework.FieldSchema{"passphrase_shares": passphraseSharesSchema},
+	}
+	sharesRaw, ok := data.GetOk("passphrase_shares")
+	if !ok {
+		return nil
+	}
+	return unsealAccount(accountJSON, sharesRaw.([]string))
+}
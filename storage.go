@@ -0,0 +1,158 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/core-coin/go-core/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/compressutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// CompressionThreshold is the size above which storage entries are compressed
+const CompressionThreshold int = 1024
+
+// storageEntryJSON is logical.StorageEntryJSON, compressed with snappy above
+// CompressionThreshold. DecodeJSON recognizes compressed entries by their
+// canary byte, so entries written by either can be read by both.
+func storageEntryJSON(key string, v interface{}) (*logical.StorageEntry, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) > CompressionThreshold {
+		value, err = compressutil.Compress(value, &compressutil.CompressionConfig{Type: compressutil.CompressionTypeSnappy})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &logical.StorageEntry{Key: key, Value: value}, nil
+}
+
+// listPageSchema are the fields of list operations that page through many keys
+func listPageSchema() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"after": {
+			Type:        framework.TypeString,
+			Description: "List only the keys that sort after this one.",
+		},
+		"limit": {
+			Type:        framework.TypeInt,
+			Description: "The most keys to list; all of them if unset.",
+		},
+	}
+}
+
+// listPage returns the sorted keys after after, at most limit of them if limit is positive
+func listPage(keys []string, data *framework.FieldData) []string {
+	sort.Strings(keys)
+	if after := data.Get("after").(string); after != Empty {
+		keys = keys[sort.Search(len(keys), func(i int) bool { return keys[i] > after }):]
+	}
+	if limit := data.Get("limit").(int); limit > 0 && limit < len(keys) {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+// accountIndex maps addresses to account names in memory. It is built from
+// storage on first use; addresses it does not hold fall back to the addresses/
+// entries, which other nodes may have written since.
+type accountIndex struct {
+	sync.RWMutex
+	built bool
+	names map[common.Address]string
+}
+
+func newAccountIndex() *accountIndex {
+	return &accountIndex{names: map[common.Address]string{}}
+}
+
+func (index *accountIndex) lookup(address common.Address) (string, bool) {
+	index.RLock()
+	defer index.RUnlock()
+	name, ok := index.names[address]
+	return name, ok
+}
+
+func (index *accountIndex) set(address common.Address, name string) {
+	index.Lock()
+	defer index.Unlock()
+	index.names[address] = name
+}
+
+func (index *accountIndex) remove(address common.Address) {
+	index.Lock()
+	defer index.Unlock()
+	delete(index.names, address)
+}
+
+// build reads every account once. Accounts created before the addresses/
+// index existed are indexed in storage on the way.
+func (index *accountIndex) build(ctx context.Context, req *logical.Request) error {
+	index.RLock()
+	built := index.built
+	index.RUnlock()
+	if built {
+		return nil
+	}
+	index.Lock()
+	defer index.Unlock()
+	if index.built {
+		return nil
+	}
+	names, err := req.Storage.List(ctx, QualifiedPath("accounts/"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		// an account that cannot be read is left to the addresses/ entries
+		accountJSON, err := readAccount(ctx, req, name)
+		if err != nil {
+			continue
+		}
+		address, err := accountAddress(ctx, *accountJSON)
+		if err != nil {
+			continue
+		}
+		if indexed, err := readAddressIndex(ctx, req, address); err != nil {
+			return err
+		} else if indexed == Empty {
+			// best effort: a standby cannot write, and memory holds it either way
+			_ = writeAddressIndex(ctx, req, address, name)
+		}
+		index.names[address] = name
+	}
+	index.built = true
+	return nil
+}
+
+// invalidate drops what another node changed
+func (b *PluginBackend) invalidate(ctx context.Context, key string) {
+	if strings.HasPrefix(key, QualifiedPath("addresses/")) {
+		if address, err := common.HexToAddress(strings.TrimPrefix(key, QualifiedPath("addresses/"))); err == nil {
+			b.accountIndex.remove(address)
+		}
+	}
+}
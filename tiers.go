@@ -0,0 +1,93 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// TierHot accounts sign automatically, within their policy
+	TierHot string = "hot"
+	// TierWarm accounts sign each request only once an authorizer approved it
+	TierWarm string = "warm"
+	// TierCold accounts never sign online; their key only leaves through an approved export
+	TierCold string = "cold"
+)
+
+// tierSchema sets the tier of an account
+var tierSchema = &framework.FieldSchema{
+	Type:          framework.TypeString,
+	AllowedValues: []interface{}{TierHot, TierWarm, TierCold},
+	Description: `The tier of the account: hot accounts sign within their policy, warm accounts
+sign each request only with an approved authorization, and cold accounts refuse
+to sign at all and only release their key through an approved export. Changing
+the tier of an existing account needs an authorization.`,
+}
+
+// tier returns the tier of the account; accounts written before tiers are hot
+func (account *AccountJSON) tier() string {
+	if account.Tier == Empty {
+		return TierHot
+	}
+	return account.Tier
+}
+
+// parseTier checks a tier; Empty is hot
+func parseTier(tier string) (string, error) {
+	switch tier {
+	case Empty, TierHot:
+		return Empty, nil
+	case TierWarm, TierCold:
+		return tier, nil
+	}
+	return Empty, fmt.Errorf("%w: unknown tier %s", ErrInvalidInput, tier)
+}
+
+// exportRequest reports whether a request asks for the export of an
+// account's key, through accounts/<name>/export or an alias of it
+func exportRequest(req *logical.Request) bool {
+	return path.Base(strings.Trim(req.Path, "/")) == "export"
+}
+
+// checkTier enforces the tier of the account on a signing request: a warm
+// account holds it to the authorization the request names, used up once it
+// has signed, and a cold one refuses it. Export requests have their own dual
+// control and pass for every tier.
+func (b *PluginBackend) checkTier(ctx context.Context, req *logical.Request, name string) error {
+	if exportRequest(req) {
+		return nil
+	}
+	accountJSON, err := readAccount(ctx, req, name)
+	if err != nil {
+		return err
+	}
+	switch accountJSON.tier() {
+	case TierCold:
+		err = fmt.Errorf("%w: %s is a cold account, which does not sign online; its key only leaves through an approved export", ErrPolicyViolation, name)
+	case TierWarm:
+		err = b.useAuthorization(ctx, req, name)
+	default:
+		return nil
+	}
+	recordRule(ctx, "tier", err)
+	return err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestWarmAuthorizationIsUsedOnlyBySigning(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	handle := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "accounts/warm",
+		Storage:   storage,
+		Data:      map[string]interface{}{"tier": TierWarm, "allow_digest_signing": true},
+	})
+	if refused(resp, err) {
+		t.Fatalf("account: %v %v", err, resp)
+	}
+	parameters := map[string]interface{}{"digest": "0x" + strings.Repeat("ab", 32)}
+	hash, err := parametersHash(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := writeAuthorization(ctx, storage, &AuthorizationJSON{
+		ID:             "approved",
+		Account:        "warm",
+		Path:           "accounts/warm/sign-digest",
+		Parameters:     parameters,
+		ParametersHash: hash,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(time.Hour),
+		ApprovedAt:     now,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	signDigest := func() (*logical.Response, error) {
+		return handle("accounts/warm/sign-digest", map[string]interface{}{"digest": parameters["digest"], "authorization_id": "approved"})
+	}
+	status := func() string {
+		authorization, err := readAuthorization(ctx, storage, "approved")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return authorization.status(time.Now())
+	}
+
+	// the mount refuses digests, so the request fails after the tier passed it
+	if resp, err := signDigest(); !refused(resp, err) {
+		t.Fatal("a digest was signed while the mount refuses digests")
+	}
+	if got := status(); got != authorizationApproved {
+		t.Fatalf("a request that signed nothing left its authorization %s", got)
+	}
+	if resp, err := handle("config", map[string]interface{}{"allow_digest_signing": true}); refused(resp, err) {
+		t.Fatalf("config: %v %v", err, resp)
+	}
+	if resp, err := signDigest(); refused(resp, err) {
+		t.Fatalf("sign-digest: %v %v", err, resp)
+	}
+	if got := status(); got != authorizationUsed {
+		t.Fatalf("a request that signed left its authorization %s", got)
+	}
+	if resp, err := signDigest(); !refused(resp, err) {
+		t.Fatal("an authorization was used twice")
+	}
+}
+
+func TestExportAliasesPassTheTier(t *testing.T) {
+	for _, path := range []string{"accounts/cold/export", "addresses/cb0000000000000000000000000000000000000000/export/", "chains/core/accounts/cold/export"} {
+		if !exportRequest(&logical.Request{Path: path}) {
+			t.Fatalf("%s is not taken for an export request", path)
+		}
+	}
+	for _, path := range []string{"accounts/export/sign", "accounts/cold/sign-tx"} {
+		if exportRequest(&logical.Request{Path: path}) {
+			t.Fatalf("%s is taken for an export request", path)
+		}
+	}
+}
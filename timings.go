@@ -0,0 +1,93 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// requestTimings adds up where the time of a request went
+type requestTimings struct {
+	storage int64
+	kdf     int64
+	rpc     int64
+}
+
+type timingsKey struct{}
+
+func withRequestTimings(ctx context.Context) (context.Context, *requestTimings) {
+	timings := &requestTimings{}
+	return context.WithValue(ctx, timingsKey{}, timings), timings
+}
+
+// timed starts timing a storage, KDF or RPC call; call the result when it returns
+func timed(ctx context.Context, counter func(*requestTimings) *int64) func() {
+	timings, _ := ctx.Value(timingsKey{}).(*requestTimings)
+	if timings == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		atomic.AddInt64(counter(timings), int64(time.Since(start)))
+	}
+}
+
+func storageTime(timings *requestTimings) *int64 { return &timings.storage }
+func kdfTime(timings *requestTimings) *int64     { return &timings.kdf }
+func rpcTime(timings *requestTimings) *int64     { return &timings.rpc }
+
+// breakdown returns the log arguments for the time a request took
+func (timings *requestTimings) breakdown(duration time.Duration) []interface{} {
+	storage := time.Duration(atomic.LoadInt64(&timings.storage))
+	kdf := time.Duration(atomic.LoadInt64(&timings.kdf))
+	rpc := time.Duration(atomic.LoadInt64(&timings.rpc))
+	return []interface{}{
+		"duration", duration,
+		"storage", storage,
+		"kdf", kdf,
+		"rpc", rpc,
+		"other", duration - storage - kdf - rpc,
+	}
+}
+
+// timedStorage adds the time spent in storage to the timings of a request
+type timedStorage struct {
+	logical.Storage
+	ctx context.Context
+}
+
+func (s *timedStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	defer timed(s.ctx, storageTime)()
+	return s.Storage.List(ctx, prefix)
+}
+
+func (s *timedStorage) Get(ctx context.Context, key string) (*logical.StorageEntry, error) {
+	defer timed(s.ctx, storageTime)()
+	return s.Storage.Get(ctx, key)
+}
+
+func (s *timedStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	defer timed(s.ctx, storageTime)()
+	return s.Storage.Put(ctx, entry)
+}
+
+func (s *timedStorage) Delete(ctx context.Context, key string) error {
+	defer timed(s.ctx, storageTime)()
+	return s.Storage.Delete(ctx, key)
+}
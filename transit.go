@@ -0,0 +1,160 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// transitTimeout is how long a transit mount has to answer, in seconds
+	transitTimeout int = 10
+	// transitKeyPrefix names the transit keys that wrap data keys
+	transitKeyPrefix string = "vault-core-dek-"
+)
+
+// TransitDataKeyJSON is a data key wrapped under a transit key of its own
+type TransitDataKeyJSON struct {
+	URL        string `json:"url"`
+	Key        string `json:"key"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+func transitDataKeyStoragePath(name string) string {
+	return QualifiedPath(fmt.Sprintf("envelope/transit-deks/%s", name))
+}
+
+// envelopeTransit returns the transit mount and token of the mount's
+// config; the URL is empty when data keys are wrapped under the mount key
+func envelopeTransit(ctx context.Context, s logical.Storage) (string, string, error) {
+	entry, err := s.Get(ctx, "config")
+	if err != nil || entry == nil {
+		return Empty, Empty, err
+	}
+	var config ConfigJSON
+	if err := entry.DecodeJSON(&config); err != nil {
+		return Empty, Empty, fmt.Errorf("error reading configuration: %s", err)
+	}
+	return config.EnvelopeTransitURL, config.EnvelopeTransitToken, nil
+}
+
+func readTransitDataKey(ctx context.Context, s logical.Storage, name string) (*TransitDataKeyJSON, error) {
+	entry, err := s.Get(ctx, transitDataKeyStoragePath(name))
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	var wrapped TransitDataKeyJSON
+	if err := entry.DecodeJSON(&wrapped); err != nil {
+		return nil, err
+	}
+	return &wrapped, nil
+}
+
+// askTransit calls the API of a transit mount and returns the data of its answer
+func askTransit(ctx context.Context, method, url, token string, body interface{}) (map[string]interface{}, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(transitTimeout)*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if token != Empty {
+		request.Header.Set("X-Vault-Token", token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	answer, err := ioutil.ReadAll(io.LimitReader(response.Body, maxExternalResponse))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("the transit mount answered status %d: %s", response.StatusCode, strings.TrimSpace(string(answer)))
+	}
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if len(answer) > 0 {
+		if err := json.Unmarshal(answer, &result); err != nil {
+			return nil, fmt.Errorf("cannot decode the answer of the transit mount: %v", err)
+		}
+	}
+	return result.Data, nil
+}
+
+// transitWrap creates a transit key for the data key of an account and
+// wraps the data key under it
+func transitWrap(ctx context.Context, url, token string, dek []byte) (*TransitDataKeyJSON, error) {
+	key := transitKeyPrefix + uuid.New()
+	if _, err := askTransit(ctx, http.MethodPost, url+"/keys/"+key, token, map[string]interface{}{"type": "aes256-gcm96"}); err != nil {
+		return nil, err
+	}
+	answer, err := askTransit(ctx, http.MethodPost, url+"/encrypt/"+key, token, map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(dek),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, _ := answer["ciphertext"].(string)
+	if ciphertext == Empty {
+		return nil, fmt.Errorf("the transit mount returned no ciphertext")
+	}
+	return &TransitDataKeyJSON{URL: url, Key: key, Ciphertext: ciphertext}, nil
+}
+
+// transitUnwrap returns a data key wrapped under a transit key
+func transitUnwrap(ctx context.Context, token string, wrapped *TransitDataKeyJSON) ([]byte, error) {
+	answer, err := askTransit(ctx, http.MethodPost, wrapped.URL+"/decrypt/"+wrapped.Key, token, map[string]interface{}{
+		"ciphertext": wrapped.Ciphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	plaintext, _ := answer["plaintext"].(string)
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+// transitDestroy deletes the transit key a data key is wrapped under; every
+// copy of the wrapped data key is useless after it
+func transitDestroy(ctx context.Context, token string, wrapped *TransitDataKeyJSON) error {
+	if _, err := askTransit(ctx, http.MethodPost, wrapped.URL+"/keys/"+wrapped.Key+"/config", token, map[string]interface{}{"deletion_allowed": true}); err != nil {
+		return err
+	}
+	_, err := askTransit(ctx, http.MethodDelete, wrapped.URL+"/keys/"+wrapped.Key, token, nil)
+	return err
+}
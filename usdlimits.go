@@ -0,0 +1,282 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	core "github.com/core-coin/go-core"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/common/hexutil"
+	"github.com/core-coin/go-core/core/types"
+	"github.com/core-coin/go-core/xcbclient"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/util"
+)
+
+const (
+	// DefaultUSDPriceMaxAge is how old, in seconds, a price feed's answer may be
+	DefaultUSDPriceMaxAge int = 3600
+	// nativeAsset is the key of usd_prices for the native coin
+	nativeAsset string = "native"
+	// nativeDecimals are the decimals of the native coin
+	nativeDecimals int = 18
+)
+
+var (
+	maxUSDPerTxSchema = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The most a transaction may be worth in USD, at the prices when it is signed. Unlimited if empty.",
+	}
+	dailyUSDLimitSchema = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The most in USD an account may sign for in a UTC day, at the prices when each transaction is signed. Unlimited if empty.",
+	}
+)
+
+// usdSpendLock serializes the check and update of the daily USD spend
+var usdSpendLock sync.Mutex
+
+// USDValuation is what a transaction was worth when it was signed, and the
+// prices it was valued at
+type USDValuation struct {
+	Value   string            `json:"value"`
+	Prices  map[string]string `json:"prices"`
+	Sources map[string]string `json:"sources"`
+}
+
+// parseUSD parses an amount in USD, such as 2500 or 1999.99
+func parseUSD(value string) *big.Rat {
+	amount, ok := new(big.Rat).SetString(value)
+	if !ok || amount.Sign() < 0 {
+		return nil
+	}
+	return amount
+}
+
+// parseUSDLimit validates a USD limit as it is written to the config or an account
+func parseUSDLimit(field, value string) (string, error) {
+	if value != Empty && parseUSD(value) == nil {
+		return Empty, fmt.Errorf("%w: %s must be an amount in USD", ErrInvalidInput, field)
+	}
+	return value, nil
+}
+
+// normalizeUSDPrices validates usd_prices: each key is native or the address
+// of a token, each value a USD price for one whole coin or token or the
+// address of a Chainlink aggregator that answers it
+func normalizeUSDPrices(prices map[string]string, lowercaseOnly bool) (map[string]string, error) {
+	normalized := map[string]string{}
+	for asset, source := range prices {
+		if asset != nativeAsset {
+			address, err := util.ParseAddress(asset, lowercaseOnly)
+			if err != nil {
+				return nil, fmt.Errorf("%w: usd_prices: %v", ErrInvalidAddress, err)
+			}
+			asset = address.Hex()
+		}
+		if feed, err := util.ParseAddress(source, lowercaseOnly); err == nil {
+			source = feed.Hex()
+		} else if price := parseUSD(source); price == nil || price.Sign() == 0 {
+			return nil, fmt.Errorf("%w: usd_prices: the price of %s is neither a positive amount nor the address of a feed", ErrInvalidInput, asset)
+		}
+		normalized[asset] = source
+	}
+	return normalized, nil
+}
+
+// strictestUSDLimit returns the lower of the limits that are set, or nil
+func strictestUSDLimit(limits ...string) *big.Rat {
+	var strictest *big.Rat
+	for _, limit := range limits {
+		if limit == Empty {
+			continue
+		}
+		if amount := parseUSD(limit); amount != nil && (strictest == nil || amount.Cmp(strictest) < 0) {
+			strictest = amount
+		}
+	}
+	return strictest
+}
+
+// callWords calls a view function without arguments and returns its 32 byte words
+func callWords(ctx context.Context, client *xcbclient.Client, to common.Address, signature string, words int) ([][]byte, error) {
+	input, err := hexutil.Decode(selectorOf(signature))
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.CallContract(ctx, core.CallMsg{To: &to, Data: input}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) < 32*words {
+		return nil, fmt.Errorf("%s of %s returned %d bytes", signature, to.Hex(), len(output))
+	}
+	result := make([][]byte, words)
+	for i := range result {
+		result[i] = output[32*i : 32*(i+1)]
+	}
+	return result, nil
+}
+
+// usdPrice returns the USD price of one whole unit of an asset and where it came from
+func usdPrice(ctx context.Context, client *xcbclient.Client, config *ConfigJSON, asset string) (*big.Rat, string, error) {
+	source, ok := config.USDPrices[asset]
+	if !ok {
+		return nil, Empty, fmt.Errorf("%w: no USD price for %s", ErrPriceUnavailable, asset)
+	}
+	if price := parseUSD(source); price != nil {
+		return price, "static", nil
+	}
+	feed, err := util.ParseAddress(source, false)
+	if err != nil {
+		return nil, Empty, wrapError(ErrPriceUnavailable, err)
+	}
+	decimals, err := callWords(ctx, client, feed, "decimals()", 1)
+	if err != nil {
+		return nil, Empty, wrapError(ErrPriceUnavailable, err)
+	}
+	round, err := callWords(ctx, client, feed, "latestRoundData()", 5)
+	if err != nil {
+		return nil, Empty, wrapError(ErrPriceUnavailable, err)
+	}
+	answer := new(big.Int).SetBytes(round[1])
+	if round[1][0]&0x80 != 0 || answer.Sign() == 0 {
+		return nil, Empty, fmt.Errorf("%w: the feed %s answers no positive price for %s", ErrPriceUnavailable, source, asset)
+	}
+	maxAge := config.USDPriceMaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultUSDPriceMaxAge
+	}
+	updatedAt := time.Unix(new(big.Int).SetBytes(round[3]).Int64(), 0)
+	if time.Since(updatedAt) > time.Duration(maxAge)*time.Second {
+		return nil, Empty, fmt.Errorf("%w: the feed %s for %s was last updated at %s", ErrPriceUnavailable, source, asset, updatedAt.UTC().Format(time.RFC3339))
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), new(big.Int).SetBytes(decimals[0]), nil)
+	return new(big.Rat).SetFrac(answer, scale), source, nil
+}
+
+// valueInUSD values the coins a transaction sends and, for ERC-20 transfers,
+// the tokens it moves
+func valueInUSD(ctx context.Context, client *xcbclient.Client, config *ConfigJSON, tx *types.Transaction, call *DecodedCall) (*big.Rat, *USDValuation, error) {
+	valuation := &USDValuation{Prices: map[string]string{}, Sources: map[string]string{}}
+	total := new(big.Rat)
+	add := func(asset string, amount *big.Int, decimals int) error {
+		price, source, err := usdPrice(ctx, client, config, asset)
+		if err != nil {
+			return err
+		}
+		valuation.Prices[asset] = price.FloatString(8)
+		valuation.Sources[asset] = source
+		units := new(big.Rat).SetFrac(amount, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+		total.Add(total, units.Mul(units, price))
+		return nil
+	}
+	if tx.Value().Sign() > 0 {
+		if err := add(nativeAsset, tx.Value(), nativeDecimals); err != nil {
+			return nil, nil, err
+		}
+	}
+	if call != nil && call.ABI == erc20Contract && (call.Method == "transfer" || call.Method == "transferFrom") {
+		tokens, ok := new(big.Int).SetString(fmt.Sprint(call.Arguments["tokens"]), 10)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: cannot read the tokens of %s", ErrPolicyViolation, call.Signature)
+		}
+		decimals, err := callWords(ctx, client, *tx.To(), "decimals()", 1)
+		if err != nil {
+			return nil, nil, wrapError(ErrPriceUnavailable, err)
+		}
+		if err := add(tx.To().Hex(), tokens, int(new(big.Int).SetBytes(decimals[0]).Int64())); err != nil {
+			return nil, nil, err
+		}
+	}
+	valuation.Value = total.FloatString(2)
+	return total, valuation, nil
+}
+
+func usdSpendStoragePath(account string, day time.Time) string {
+	return QualifiedPath(fmt.Sprintf("usd-spend/%s/%s", account, day.UTC().Format("2006-01-02")))
+}
+
+// checkUSDLimits values a transaction in USD and holds it to the per
+// transaction and daily USD limits of the mount, the account and its groups.
+// What passes is added to the account's spend for the day when it is signed,
+// whether or not it is ever sent.
+func (b *PluginBackend) checkUSDLimits(ctx context.Context, scope *signingScope, config *ConfigJSON, accountJSON *AccountJSON, tx *types.Transaction, call *DecodedCall) error {
+	perTxLimits := []string{config.MaxUSDPerTx, accountJSON.MaxUSDPerTx}
+	dailyLimits := []string{config.DailyUSDLimit, accountJSON.DailyUSDLimit}
+	groups, err := accountGroups(ctx, scope.req.Storage, scope.account)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		perTxLimits = append(perTxLimits, group.MaxUSDPerTx)
+		dailyLimits = append(dailyLimits, group.DailyUSDLimit)
+	}
+	perTx := strictestUSDLimit(perTxLimits...)
+	daily := strictestUSDLimit(dailyLimits...)
+	if perTx == nil && daily == nil {
+		return nil
+	}
+	err = b.enforceUSDLimits(ctx, scope, config, tx, call, perTx, daily)
+	recordRule(ctx, "usd_limit", err)
+	return err
+}
+
+func (b *PluginBackend) enforceUSDLimits(ctx context.Context, scope *signingScope, config *ConfigJSON, tx *types.Transaction, call *DecodedCall, perTx, daily *big.Rat) error {
+	client, err := b.dialRPC(ctx, config)
+	if err != nil {
+		return err
+	}
+	value, valuation, err := valueInUSD(ctx, client, config, tx, call)
+	if err != nil {
+		return err
+	}
+	if recorder := decisionFromContext(ctx); recorder != nil {
+		recorder.Lock()
+		recorder.usd = valuation
+		recorder.Unlock()
+	}
+	if perTx != nil && value.Cmp(perTx) > 0 {
+		return fmt.Errorf("%w: the transaction is worth %s USD, above the limit of %s USD", ErrPolicyViolation, valuation.Value, perTx.FloatString(2))
+	}
+	if daily == nil || value.Sign() == 0 {
+		return nil
+	}
+	usdSpendLock.Lock()
+	defer usdSpendLock.Unlock()
+	path := usdSpendStoragePath(scope.account, time.Now())
+	spent := new(big.Rat)
+	entry, err := scope.req.Storage.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		if _, ok := spent.SetString(string(entry.Value)); !ok {
+			return fmt.Errorf("cannot read the USD spend at %s", path)
+		}
+	}
+	spent.Add(spent, value)
+	if spent.Cmp(daily) > 0 {
+		return fmt.Errorf("%w: the transaction is worth %s USD and would bring today's spend to %s USD, above the daily limit of %s USD", ErrPolicyViolation, valuation.Value, spent.FloatString(2), daily.FloatString(2))
+	}
+	return scope.req.Storage.Put(ctx, &logical.StorageEntry{Key: path, Value: []byte(spent.RatString())})
+}
@@ -0,0 +1,182 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/core-coin/go-core/accounts/keystore"
+	"github.com/core-coin/go-core/common"
+	"github.com/core-coin/go-core/crypto"
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/pborman/uuid"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// KDFArgon2id is the memory-hard key derivation function keystores may use in place of scrypt
+	KDFArgon2id = "argon2id"
+
+	argon2idDKLen = 32
+	// maxArgon2idMemory bounds the memory, in KiB, a keystore may ask argon2id for
+	maxArgon2idMemory = 1024 * 1024
+	// maxArgon2idTime bounds the passes a keystore may ask argon2id for
+	maxArgon2idTime = 64
+)
+
+// Argon2idParams are the costs of argon2id: passes over memory, the memory in
+// KiB, and the lanes computed in parallel
+type Argon2idParams struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultArgon2idParams are the second recommended option of RFC 9106, for
+// machines that cannot spend 2 GiB on every key derivation
+var DefaultArgon2idParams = Argon2idParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// Validate checks that the costs are within what argon2id and this plugin allow
+func (params Argon2idParams) Validate() error {
+	if params.Time < 1 || params.Time > maxArgon2idTime {
+		return fmt.Errorf("argon2id time must be 1 to %d", maxArgon2idTime)
+	}
+	if params.Threads < 1 {
+		return fmt.Errorf("argon2id threads must be 1 to 255")
+	}
+	if params.Memory < 8*uint32(params.Threads) || params.Memory > maxArgon2idMemory {
+		return fmt.Errorf("argon2id memory must be %d to %d KiB", 8*uint32(params.Threads), maxArgon2idMemory)
+	}
+	return nil
+}
+
+func (params Argon2idParams) deriveKey(auth, salt []byte) []byte {
+	return argon2.IDKey(auth, salt, params.Time, params.Memory, params.Threads, argon2idDKLen)
+}
+
+// EncryptKeyArgon2id encrypts a private key into a JSON keystore as EncryptKey
+// does, with argon2id in place of scrypt. The MAC is that of Core keystores.
+func EncryptKeyArgon2id(ctx context.Context, key *eddsa.PrivateKey, address *common.Address, id uuid.UUID, auth string, params Argon2idParams) ([]byte, error) {
+	// argon2id cannot be interrupted, so don't start it for an abandoned request
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	derivedKey := params.deriveKey([]byte(auth), salt)
+	defer ZeroBytes(derivedKey)
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	cipherText, err := aesCTRXOR(derivedKey[:16], key[:], iv)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encryptedKeyJSONV3{
+		Address: hex.EncodeToString(address[:]),
+		Crypto: cryptoJSON{
+			Cipher:       "aes-128-ctr",
+			CipherText:   hex.EncodeToString(cipherText),
+			CipherParams: cipherparamsJSON{IV: hex.EncodeToString(iv)},
+			KDF:          KDFArgon2id,
+			KDFParams: map[string]interface{}{
+				"t":     params.Time,
+				"m":     params.Memory,
+				"p":     params.Threads,
+				"dklen": argon2idDKLen,
+				"salt":  hex.EncodeToString(salt),
+			},
+			MAC: hex.EncodeToString(crypto.SHA3(derivedKey[16:32], cipherText)),
+		},
+		ID:      id.String(),
+		Version: version,
+	})
+}
+
+// argon2idParam reads a cost from the kdfparams of a keystore
+func argon2idParam(kdfParams map[string]interface{}, name string, max float64) (float64, error) {
+	value, ok := kdfParams[name].(float64)
+	if !ok || value < 1 || value > max || value != float64(int64(value)) {
+		return 0, fmt.Errorf("argon2id %s must be a whole number from 1 to %.0f", name, max)
+	}
+	return value, nil
+}
+
+// DecryptDataArgon2id decrypts the crypto section of a keystore encrypted by
+// EncryptKeyArgon2id. A wrong passphrase returns keystore.ErrDecrypt.
+func DecryptDataArgon2id(cryptoJSON keystore.CryptoJSON, auth string) ([]byte, error) {
+	if cryptoJSON.KDF != KDFArgon2id {
+		return nil, fmt.Errorf("kdf %q is not %s", cryptoJSON.KDF, KDFArgon2id)
+	}
+	if cryptoJSON.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("cipher not supported: %v", cryptoJSON.Cipher)
+	}
+	time, err := argon2idParam(cryptoJSON.KDFParams, "t", maxArgon2idTime)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := argon2idParam(cryptoJSON.KDFParams, "m", maxArgon2idMemory)
+	if err != nil {
+		return nil, err
+	}
+	threads, err := argon2idParam(cryptoJSON.KDFParams, "p", 255)
+	if err != nil {
+		return nil, err
+	}
+	params := Argon2idParams{Time: uint32(time), Memory: uint32(memory), Threads: uint8(threads)}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if dklen, ok := cryptoJSON.KDFParams["dklen"].(float64); !ok || dklen != argon2idDKLen {
+		return nil, fmt.Errorf("argon2id dklen must be %d", argon2idDKLen)
+	}
+	saltHex, _ := cryptoJSON.KDFParams["salt"].(string)
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("argon2id salt must be hex")
+	}
+	mac, err := hex.DecodeString(cryptoJSON.MAC)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(cryptoJSON.CipherParams.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("cipherparams iv must be %d hex bytes", aes.BlockSize)
+	}
+	cipherText, err := hex.DecodeString(cryptoJSON.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	derivedKey := params.deriveKey([]byte(auth), salt)
+	defer ZeroBytes(derivedKey)
+	if !bytes.Equal(crypto.SHA3(derivedKey[16:32], cipherText), mac) {
+		return nil, keystore.ErrDecrypt
+	}
+	return aesCTRXOR(derivedKey[:16], cipherText, iv)
+}
@@ -0,0 +1,55 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/core-coin/go-core/accounts/keystore"
+)
+
+// coreTestKey is the Ed448 key of very-light-scrypt.json in the keystore
+// tests of go-core, whose address is cb45f23d9ab6aefb2c22dfff511e29703435a3b50f50
+const coreTestKey = "4a75ca14baf1b7c64dac6ba73fe32a57e1d2b68243b938294b4008c3e10f948f8d00e51e6b424dc7c626cc54747ce7e5598ff3db211a703051"
+
+func TestArgon2idKeystoreVector(t *testing.T) {
+	// coreTestKey under the passphrase foobar, with salt 00..1f and iv
+	// 00..0f, made by an argon2id implementation that reproduces the
+	// argon2id vector of RFC 9106
+	var crypto keystore.CryptoJSON
+	if err := json.Unmarshal([]byte(`{
+		"cipher": "aes-128-ctr",
+		"ciphertext": "fac75dda600b0620f170f6d3b43476f0c73db7a289ee7f9aa5bdcf869311e0a7440407608d14af0ac61e33ad1266f6d65270dc4ab6a5967b88",
+		"cipherparams": {"iv": "000102030405060708090a0b0c0d0e0f"},
+		"kdf": "argon2id",
+		"kdfparams": {"t": 2, "m": 64, "p": 2, "dklen": 32, "salt": "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"},
+		"mac": "87c21305f6ef8ad3c56ea9e6501d451d258b611d71d1f7d5e543a9577b282a98"
+	}`), &crypto); err != nil {
+		t.Fatal(err)
+	}
+	key, err := DecryptDataArgon2id(crypto, "foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(key) != coreTestKey {
+		t.Fatalf("decrypted %x", key)
+	}
+	if _, err := DecryptDataArgon2id(crypto, "foobaz"); !errors.Is(err, keystore.ErrDecrypt) {
+		t.Fatalf("a wrong passphrase returned %v", err)
+	}
+}
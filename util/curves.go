@@ -0,0 +1,201 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+const (
+	// CurveEd448 is the curve of Core accounts
+	CurveEd448 string = "ed448"
+	// CurveSecp256r1 is NIST P-256, signed with ECDSA over SHA-256 with hedged
+	// random nonces and no S normalization
+	CurveSecp256r1 string = "secp256r1"
+	// CurveSecp256k1 is the curve of Bitcoin and the XRP Ledger, signed with RFC 6979 ECDSA
+	CurveSecp256k1 string = "secp256k1"
+	// CurveEd25519 is signed with pure Ed25519
+	CurveEd25519 string = "ed25519"
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// GenerateCurveKey returns a new private key on the curve: the 32 byte scalar
+// of a secp256r1 or secp256k1 key or the 32 byte seed of an ed25519 key
+func GenerateCurveKey(curve string) ([]byte, error) {
+	switch curve {
+	case CurveSecp256r1:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return key.D.FillBytes(make([]byte, 32)), nil
+	case CurveSecp256k1:
+		key, err := btcec.NewPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		return key.Serialize(), nil
+	case CurveEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return key.Seed(), nil
+	}
+	return nil, fmt.Errorf("unsupported curve %s", curve)
+}
+
+func validScalar(curve string, privateKey []byte, n *big.Int) error {
+	d := new(big.Int).SetBytes(privateKey)
+	if d.Sign() == 0 || d.Cmp(n) >= 0 {
+		return fmt.Errorf("the private key is not a %s scalar", curve)
+	}
+	return nil
+}
+
+func curveSigner(curve string, privateKey []byte) (crypto.Signer, error) {
+	if len(privateKey) != 32 {
+		return nil, fmt.Errorf("a %s private key is 32 bytes, not %d", curve, len(privateKey))
+	}
+	switch curve {
+	case CurveSecp256r1:
+		p256 := elliptic.P256()
+		if err := validScalar(curve, privateKey, p256.Params().N); err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(privateKey)}
+		key.PublicKey.Curve = p256
+		key.PublicKey.X, key.PublicKey.Y = p256.ScalarBaseMult(privateKey)
+		return key, nil
+	case CurveEd25519:
+		return ed25519.NewKeyFromSeed(privateKey), nil
+	}
+	return nil, fmt.Errorf("unsupported curve %s", curve)
+}
+
+func secp256k1Key(privateKey []byte) (*btcec.PrivateKey, error) {
+	if len(privateKey) != 32 {
+		return nil, fmt.Errorf("a %s private key is 32 bytes, not %d", CurveSecp256k1, len(privateKey))
+	}
+	if err := validScalar(CurveSecp256k1, privateKey, btcec.S256().N); err != nil {
+		return nil, err
+	}
+	key, _ := btcec.PrivKeyFromBytes(privateKey)
+	return key, nil
+}
+
+// CurvePublicKey returns the public key of a private key on the curve, raw
+// (uncompressed SEC 1 for the ECDSA curves) and as a PEM SubjectPublicKeyInfo
+func CurvePublicKey(curve string, privateKey []byte) ([]byte, string, error) {
+	var raw, der []byte
+	if curve == CurveSecp256k1 {
+		key, err := secp256k1Key(privateKey)
+		if err != nil {
+			return nil, "", err
+		}
+		raw = key.PubKey().SerializeUncompressed()
+		// x509 only marshals the NIST curves
+		der, err = asn1.Marshal(struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: mustMarshal(oidSecp256k1)}},
+			PublicKey: asn1.BitString{Bytes: raw, BitLength: 8 * len(raw)},
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		signer, err := curveSigner(curve, privateKey)
+		if err != nil {
+			return nil, "", err
+		}
+		switch public := signer.Public().(type) {
+		case *ecdsa.PublicKey:
+			raw = elliptic.Marshal(public.Curve, public.X, public.Y)
+		case ed25519.PublicKey:
+			raw = public
+		}
+		der, err = x509.MarshalPKIXPublicKey(signer.Public())
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return raw, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// CompressedPublicKey returns the 33 byte compressed public key of a secp256k1 private key
+func CompressedPublicKey(privateKey []byte) ([]byte, error) {
+	key, err := secp256k1Key(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return key.PubKey().SerializeCompressed(), nil
+}
+
+func mustMarshal(value interface{}) []byte {
+	encoded, err := asn1.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return encoded
+}
+
+// SignWithCurve signs a message with a private key on the curve. The ECDSA
+// curves sign the SHA-256 of the message and return ASN.1 DER signatures, as
+// X.509 and WebAuthn expect; ed25519 signatures are the 64 bytes of RFC 8032.
+func SignWithCurve(curve string, privateKey, message []byte) ([]byte, error) {
+	if curve == CurveSecp256k1 {
+		digest := sha256.Sum256(message)
+		return SignSecp256k1Digest(privateKey, digest[:])
+	}
+	signer, err := curveSigner(curve, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if curve == CurveSecp256r1 {
+		digest := sha256.Sum256(message)
+		return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	return signer.Sign(rand.Reader, message, crypto.Hash(0))
+}
+
+// SignSecp256k1Digest signs a 32 byte digest with a secp256k1 private key and
+// returns the DER signature, with the low S that Bitcoin and the XRP Ledger require
+func SignSecp256k1Digest(privateKey, digest []byte) ([]byte, error) {
+	key, err := secp256k1Key(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return btcecdsa.Sign(key, digest).Serialize(), nil
+}
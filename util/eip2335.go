@@ -0,0 +1,312 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/pborman/uuid"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// EIP2335Version is the keystore version EIP-2335 defines
+	EIP2335Version = 4
+	// KDFScrypt and KDFPBKDF2 are the key derivation functions EIP-2335 allows
+	KDFScrypt = "scrypt"
+	KDFPBKDF2 = "pbkdf2"
+
+	eip2335ScryptN     = 262144
+	eip2335PBKDF2Count = 262144
+	eip2335Cipher      = "aes-128-ctr"
+	eip2335Checksum    = "sha256"
+	eip2335PRF         = "hmac-sha256"
+
+	// maxScryptMemory bounds the memory, in bytes, a keystore may ask scrypt for: 128 * n * r
+	maxScryptMemory = 1024 * 1024 * 1024
+	// maxScryptP bounds the parallelism a keystore may ask scrypt for
+	maxScryptP = 16
+	// maxPBKDF2Count bounds the iterations a keystore may ask PBKDF2 for
+	maxPBKDF2Count = 10000000
+	// maxKDFDKLen bounds the length of the key a keystore derives
+	maxKDFDKLen = 64
+)
+
+// blsCurveOrder is the order r of BLS12-381; secret keys must be below it
+var blsCurveOrder, _ = new(big.Int).SetString("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001", 16)
+
+// EIP2335Keystore is a version 4 keystore as defined by EIP-2335
+type EIP2335Keystore struct {
+	Crypto      eip2335Crypto `json:"crypto"`
+	Description string        `json:"description,omitempty"`
+	Pubkey      string        `json:"pubkey"`
+	Path        string        `json:"path"`
+	UUID        string        `json:"uuid"`
+	Version     int           `json:"version"`
+}
+
+type eip2335Crypto struct {
+	KDF      eip2335Module `json:"kdf"`
+	Checksum eip2335Module `json:"checksum"`
+	Cipher   eip2335Module `json:"cipher"`
+}
+
+type eip2335Module struct {
+	Function string                 `json:"function"`
+	Params   map[string]interface{} `json:"params"`
+	Message  string                 `json:"message"`
+}
+
+// eip2335Password normalizes a password to NFKD and strips the C0, C1 and
+// Delete control codes, as EIP-2335 requires before key derivation
+func eip2335Password(password string) []byte {
+	return []byte(strings.Map(func(r rune) rune {
+		if r < 0x20 || (r >= 0x7f && r <= 0x9f) {
+			return -1
+		}
+		return r
+	}, norm.NFKD.String(password)))
+}
+
+func intParam(params map[string]interface{}, name string) (int, error) {
+	switch value := params[name].(type) {
+	case int:
+		if value > 0 {
+			return value, nil
+		}
+	case float64:
+		// params decoded from JSON
+		if value > 0 && value == float64(int(value)) {
+			return int(value), nil
+		}
+	}
+	return 0, fmt.Errorf("keystore kdf param %s must be a positive integer", name)
+}
+
+// CheckKDFCosts refuses the kdfparams of a scrypt or PBKDF2 keystore that
+// would cost more memory or time than argon2id keystores are allowed, before
+// they reach the key derivation: the costs come with the file, from callers
+func CheckKDFCosts(kdf string, params map[string]interface{}) error {
+	dklen, err := intParam(params, "dklen")
+	if err != nil {
+		return err
+	}
+	if dklen > maxKDFDKLen {
+		return fmt.Errorf("keystore kdf dklen must be at most %d", maxKDFDKLen)
+	}
+	switch kdf {
+	case KDFScrypt:
+		n, err := intParam(params, "n")
+		if err != nil {
+			return err
+		}
+		r, err := intParam(params, "r")
+		if err != nil {
+			return err
+		}
+		p, err := intParam(params, "p")
+		if err != nil {
+			return err
+		}
+		if n > maxScryptMemory/128/r || p > maxScryptP {
+			return fmt.Errorf("keystore scrypt costs must fit in %d MiB and %d lanes", maxScryptMemory>>20, maxScryptP)
+		}
+	case KDFPBKDF2:
+		c, err := intParam(params, "c")
+		if err != nil {
+			return err
+		}
+		if c > maxPBKDF2Count {
+			return fmt.Errorf("keystore pbkdf2 c must be at most %d", maxPBKDF2Count)
+		}
+	}
+	return nil
+}
+
+func hexParam(params map[string]interface{}, name string) ([]byte, error) {
+	value, ok := params[name].(string)
+	if !ok {
+		return nil, fmt.Errorf("keystore param %s is missing", name)
+	}
+	return hex.DecodeString(value)
+}
+
+func (module eip2335Module) deriveKey(password []byte) ([]byte, error) {
+	salt, err := hexParam(module.Params, "salt")
+	if err != nil {
+		return nil, err
+	}
+	dklen, err := intParam(module.Params, "dklen")
+	if err != nil {
+		return nil, err
+	}
+	if dklen < 32 {
+		return nil, fmt.Errorf("keystore kdf dklen must be at least 32")
+	}
+	if err := CheckKDFCosts(module.Function, module.Params); err != nil {
+		return nil, err
+	}
+	switch module.Function {
+	case KDFScrypt:
+		n, err := intParam(module.Params, "n")
+		if err != nil {
+			return nil, err
+		}
+		r, err := intParam(module.Params, "r")
+		if err != nil {
+			return nil, err
+		}
+		p, err := intParam(module.Params, "p")
+		if err != nil {
+			return nil, err
+		}
+		return scrypt.Key(password, salt, n, r, p, dklen)
+	case KDFPBKDF2:
+		if prf, _ := module.Params["prf"].(string); prf != eip2335PRF {
+			return nil, fmt.Errorf("unsupported keystore pbkdf2 prf %s", prf)
+		}
+		c, err := intParam(module.Params, "c")
+		if err != nil {
+			return nil, err
+		}
+		return pbkdf2.Key(password, salt, c, dklen, sha256.New), nil
+	}
+	return nil, fmt.Errorf("unsupported keystore kdf %s", module.Function)
+}
+
+func aes128CTR(key, iv, input []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	output := make([]byte, len(input))
+	cipher.NewCTR(block, iv).XORKeyStream(output, input)
+	return output, nil
+}
+
+// ValidBLSSecretKey returns an error unless the key is a 32 byte BLS12-381 scalar
+func ValidBLSSecretKey(secret []byte) error {
+	if len(secret) != 32 {
+		return fmt.Errorf("BLS secret key must be 32 bytes, not %d", len(secret))
+	}
+	scalar := new(big.Int).SetBytes(secret)
+	if scalar.Sign() == 0 || scalar.Cmp(blsCurveOrder) >= 0 {
+		return errors.New("BLS secret key is not a valid BLS12-381 scalar")
+	}
+	return nil
+}
+
+// DecryptEIP2335 verifies the checksum of an EIP-2335 keystore and returns
+// the keystore with the secret key it holds
+func DecryptEIP2335(keystoreJSON []byte, password string) (*EIP2335Keystore, []byte, error) {
+	var keystore EIP2335Keystore
+	if err := json.Unmarshal(keystoreJSON, &keystore); err != nil {
+		return nil, nil, err
+	}
+	if keystore.Version != EIP2335Version {
+		return nil, nil, fmt.Errorf("keystore version %d is not %d", keystore.Version, EIP2335Version)
+	}
+	if keystore.Crypto.Cipher.Function != eip2335Cipher {
+		return nil, nil, fmt.Errorf("unsupported keystore cipher %s", keystore.Crypto.Cipher.Function)
+	}
+	if keystore.Crypto.Checksum.Function != eip2335Checksum {
+		return nil, nil, fmt.Errorf("unsupported keystore checksum %s", keystore.Crypto.Checksum.Function)
+	}
+	key, err := keystore.Crypto.KDF.deriveKey(eip2335Password(password))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ZeroBytes(key)
+	cipherMessage, err := hex.DecodeString(keystore.Crypto.Cipher.Message)
+	if err != nil {
+		return nil, nil, err
+	}
+	checksum, err := hex.DecodeString(keystore.Crypto.Checksum.Message)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := sha256.Sum256(append(append([]byte{}, key[16:32]...), cipherMessage...))
+	if !bytes.Equal(digest[:], checksum) {
+		return nil, nil, errors.New("keystore checksum mismatch: wrong password")
+	}
+	iv, err := hexParam(keystore.Crypto.Cipher.Params, "iv")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, nil, fmt.Errorf("keystore iv must be %d bytes", aes.BlockSize)
+	}
+	secret, err := aes128CTR(key[:16], iv, cipherMessage)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &keystore, secret, nil
+}
+
+// EncryptEIP2335 encrypts a secret key into an EIP-2335 keystore with the
+// standard parameters of the given kdf
+func EncryptEIP2335(secret []byte, pubkey, path, description, password, kdf string) ([]byte, error) {
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	module := eip2335Module{Function: kdf}
+	switch kdf {
+	case KDFScrypt:
+		module.Params = map[string]interface{}{"dklen": 32, "n": eip2335ScryptN, "r": 8, "p": 1, "salt": hex.EncodeToString(salt)}
+	case KDFPBKDF2:
+		module.Params = map[string]interface{}{"dklen": 32, "c": eip2335PBKDF2Count, "prf": eip2335PRF, "salt": hex.EncodeToString(salt)}
+	default:
+		return nil, fmt.Errorf("unsupported keystore kdf %s", kdf)
+	}
+	key, err := module.deriveKey(eip2335Password(password))
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(key)
+	cipherMessage, err := aes128CTR(key[:16], iv, secret)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(append(append([]byte{}, key[16:32]...), cipherMessage...))
+	return json.Marshal(&EIP2335Keystore{
+		Crypto: eip2335Crypto{
+			KDF:      module,
+			Checksum: eip2335Module{Function: eip2335Checksum, Params: map[string]interface{}{}, Message: hex.EncodeToString(checksum[:])},
+			Cipher:   eip2335Module{Function: eip2335Cipher, Params: map[string]interface{}{"iv": hex.EncodeToString(iv)}, Message: hex.EncodeToString(cipherMessage)},
+		},
+		Description: description,
+		Pubkey:      pubkey,
+		Path:        path,
+		UUID:        uuid.NewRandom().String(),
+		Version:     EIP2335Version,
+	})
+}
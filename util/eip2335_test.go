@@ -0,0 +1,61 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// eip2335Secret and eip2335TestPassword are those of the EIP-2335 test vectors
+const (
+	eip2335Secret       = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	eip2335TestPassword = "𝔱𝔢𝔰𝔱𝔭𝔞𝔰𝔰𝔴𝔬𝔯𝔡🔑"
+)
+
+func TestEIP2335Vectors(t *testing.T) {
+	for _, keystore := range []string{
+		`{"crypto":{"kdf":{"function":"scrypt","params":{"dklen":32,"n":262144,"p":1,"r":8,"salt":"d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"},"message":""},"checksum":{"function":"sha256","params":{},"message":"d2217fe5f3e9a1e34581ef8a78f7c9928e436d36dacc5e846690a5581e8ea484"},"cipher":{"function":"aes-128-ctr","params":{"iv":"264daa3f303d7259501c93d997d84fe6"},"message":"06ae90d55fe0a6e9c5c3bc5b170827b2e5cce3929ed3f116c2811e6366dfe20f"}},"description":"This is a test keystore that uses scrypt to secure the secret.","pubkey":"9612d7a727c9d0a22e185a1c768478dfe919cada9266988cb32359c11f2b7b27f4ae4040902382ae2910c15e2b420d07","path":"m/12381/60/3141592653/589793238","uuid":"1d85ae20-35c5-4611-98e8-aa14a633906f","version":4}`,
+		`{"crypto":{"kdf":{"function":"pbkdf2","params":{"dklen":32,"c":262144,"prf":"hmac-sha256","salt":"d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"},"message":""},"checksum":{"function":"sha256","params":{},"message":"8a9f5d9912ed7e75ea794bc5a89bca5f193721d30868ade6f73043c6ea6febf1"},"cipher":{"function":"aes-128-ctr","params":{"iv":"264daa3f303d7259501c93d997d84fe6"},"message":"cee03fde2af33149775b7223e7845e4fb2c8ae1792e5f99fe9ecf474cc8c16ad"}},"description":"This is a test keystore that uses PBKDF2 to secure the secret.","pubkey":"9612d7a727c9d0a22e185a1c768478dfe919cada9266988cb32359c11f2b7b27f4ae4040902382ae2910c15e2b420d07","path":"m/12381/60/0/0","uuid":"64625def-3331-4eea-ab6f-782f3ed16a83","version":4}`,
+	} {
+		decoded, secret, err := DecryptEIP2335([]byte(keystore), eip2335TestPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(secret) != eip2335Secret {
+			t.Fatalf("the %s vector decrypted to %x", decoded.Crypto.KDF.Function, secret)
+		}
+		// the password is used after NFKD and the removal of control codes
+		if _, _, err := DecryptEIP2335([]byte(keystore), "testpassword\x7f🔑"); err != nil {
+			t.Fatalf("the normalized password was refused: %v", err)
+		}
+		if _, _, err := DecryptEIP2335([]byte(keystore), "testpassword"); err == nil {
+			t.Fatal("a wrong password passed the checksum")
+		}
+	}
+}
+
+func TestEIP2335RoundTrip(t *testing.T) {
+	secret, _ := hex.DecodeString(eip2335Secret)
+	for _, kdf := range []string{KDFScrypt, KDFPBKDF2} {
+		keystore, err := EncryptEIP2335(secret, "", "m/12381/3600/0/0/0", "", eip2335TestPassword, kdf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, decrypted, err := DecryptEIP2335(keystore, eip2335TestPassword); err != nil || hex.EncodeToString(decrypted) != eip2335Secret {
+			t.Fatalf("a %s keystore decrypted to %x: %v", kdf, decrypted, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/core-coin/go-core/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// evmDynamicFeeTxType is the EIP-2718 type of EIP-1559 transactions
+const evmDynamicFeeTxType byte = 0x02
+
+// EVMTransaction is a transaction for an EVM chain. A legacy transaction is
+// priced by GasPrice and signed for its chain as EIP-155 specifies; a dynamic
+// fee one by MaxFeePerGas and MaxPriorityFeePerGas, as EIP-1559 specifies.
+type EVMTransaction struct {
+	ChainID              *big.Int
+	DynamicFee           bool
+	Nonce                uint64
+	GasLimit             uint64
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	// To is nil for a contract creation
+	To    []byte
+	Value *big.Int
+	Data  []byte
+}
+
+func keccak256(data ...[]byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	for _, part := range data {
+		hash.Write(part)
+	}
+	return hash.Sum(nil)
+}
+
+// EVMAddress returns the 20 byte address of a secp256k1 private key on EVM
+// chains, and on Tron with its own encoding
+func EVMAddress(privateKey []byte) ([]byte, error) {
+	key, err := secp256k1Key(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(key.PubKey().SerializeUncompressed()[1:])[12:], nil
+}
+
+// signRecoverable signs a hash and returns r, s and the recovery ID
+func signRecoverable(privateKey, hash []byte) (*big.Int, *big.Int, byte, error) {
+	key, err := secp256k1Key(privateKey)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	compact, err := btcecdsa.SignCompact(key, hash, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// compact signatures start with 27 plus the recovery ID
+	return new(big.Int).SetBytes(compact[1:33]), new(big.Int).SetBytes(compact[33:]), compact[0] - 27, nil
+}
+
+// SignEVMTransaction signs a transaction with a secp256k1 private key and
+// returns the raw transaction to broadcast and its hash
+func SignEVMTransaction(privateKey []byte, tx *EVMTransaction) ([]byte, []byte, error) {
+	if tx.ChainID == nil || tx.ChainID.Sign() <= 0 {
+		return nil, nil, errors.New("a chain ID is required")
+	}
+	to := tx.To
+	if to == nil {
+		to = []byte{}
+	}
+	value := tx.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	if tx.DynamicFee {
+		fields := []interface{}{tx.ChainID, tx.Nonce, tx.MaxPriorityFeePerGas, tx.MaxFeePerGas, tx.GasLimit, to, value, tx.Data, []interface{}{}}
+		unsigned, err := rlp.EncodeToBytes(fields)
+		if err != nil {
+			return nil, nil, err
+		}
+		r, s, recovery, err := signRecoverable(privateKey, keccak256([]byte{evmDynamicFeeTxType}, unsigned))
+		if err != nil {
+			return nil, nil, err
+		}
+		signed, err := rlp.EncodeToBytes(append(fields, uint64(recovery), r, s))
+		if err != nil {
+			return nil, nil, err
+		}
+		raw := append([]byte{evmDynamicFeeTxType}, signed...)
+		return raw, keccak256(raw), nil
+	}
+	fields := []interface{}{tx.Nonce, tx.GasPrice, tx.GasLimit, to, value, tx.Data}
+	unsigned, err := rlp.EncodeToBytes(append(fields, tx.ChainID, uint64(0), uint64(0)))
+	if err != nil {
+		return nil, nil, err
+	}
+	r, s, recovery, err := signRecoverable(privateKey, keccak256(unsigned))
+	if err != nil {
+		return nil, nil, err
+	}
+	// EIP-155 folds the chain ID into v
+	v := new(big.Int).Add(new(big.Int).Mul(tx.ChainID, big.NewInt(2)), big.NewInt(35+int64(recovery)))
+	raw, err := rlp.EncodeToBytes(append(fields, v, r, s))
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, keccak256(raw), nil
+}
+
+// SignTronTransaction signs the raw_data of a Tron transaction, protobuf as
+// TronWeb and the node APIs return it, with a secp256k1 private key. It returns
+// the transaction ID and the 65 byte signature, r, s and 27 plus the recovery ID.
+func SignTronTransaction(privateKey, rawData []byte) ([]byte, []byte, error) {
+	txID := sha256.Sum256(rawData)
+	r, s, recovery, err := signRecoverable(privateKey, txID[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return txID[:], append(signature, 27+recovery), nil
+}
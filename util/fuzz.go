@@ -0,0 +1,89 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/core-coin/go-core/accounts/keystore"
+)
+
+// The targets here take the bytes callers send in place of keystores and
+// ledger transactions. Run one with go-fuzz from this directory:
+//
+//	go-fuzz-build -func FuzzKeystore
+//	go-fuzz -func FuzzKeystore -workdir testdata/fuzz/FuzzKeystore
+
+// fuzzKey is the private key the ledger targets sign with
+var fuzzKey = append(bytes.Repeat([]byte{0}, 31), 1)
+
+// FuzzKeystore decrypts a keystore JSON as an EIP-2335 BLS keystore and as
+// an argon2id keystore v3, and checks the costs of a scrypt or PBKDF2 one:
+// costs past the bounds of CheckKDFCosts are refused before any derivation.
+func FuzzKeystore(data []byte) int {
+	interesting := 0
+	if _, secret, err := DecryptEIP2335(data, "fuzz"); err == nil {
+		if ValidBLSSecretKey(secret) != nil {
+			panic("DecryptEIP2335 returned an invalid BLS secret key")
+		}
+		interesting = 1
+	}
+	var file struct {
+		Crypto keystore.CryptoJSON `json:"crypto"`
+	}
+	if json.Unmarshal(data, &file) != nil {
+		return interesting
+	}
+	if file.Crypto.KDF == KDFArgon2id {
+		if _, err := DecryptDataArgon2id(file.Crypto, "fuzz"); err == nil {
+			interesting = 1
+		}
+	} else if CheckKDFCosts(file.Crypto.KDF, file.Crypto.KDFParams) == nil {
+		interesting = 1
+	}
+	return interesting
+}
+
+// FuzzStellarEnvelope parses an unsigned Stellar transaction envelope and
+// signs what it parsed into a signed envelope
+func FuzzStellarEnvelope(data []byte) int {
+	tx, err := ParseStellarEnvelope(data)
+	if err != nil {
+		return 0
+	}
+	StellarSignedEnvelope(tx.XDR, make([]byte, 32), make([]byte, 64))
+	return 1
+}
+
+// FuzzXRPLBlob signs an XRP Ledger transaction blob with a secp256k1 and an
+// ed25519 key; only one that carries the key's SigningPubKey signs
+func FuzzXRPLBlob(data []byte) int {
+	interesting := 0
+	for _, curve := range []string{CurveSecp256k1, CurveEd25519} {
+		signed, _, err := XRPLSign(curve, fuzzKey, data)
+		if err != nil {
+			continue
+		}
+		if len(signed) <= len(data) {
+			panic("XRPLSign returned a transaction without its signature")
+		}
+		interesting = 1
+	}
+	return interesting
+}
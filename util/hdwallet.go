@@ -0,0 +1,91 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/core-coin/go-core/accounts"
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/sha3"
+)
+
+// hdEd448Domain separates the Ed448 keys expanded from BIP-32 children from
+// any other use of the same child keys
+const hdEd448Domain string = "vault-core ed448 from bip32"
+
+// HDWallet derives the Ed448 keys of Core accounts from a BIP-39 mnemonic.
+// Ed448 has no BIP-32 of its own: a path is derived as a BIP-32 secp256k1
+// child, and its 32 byte key is expanded with SHAKE-256 into an Ed448 key.
+type HDWallet struct {
+	master *hdkeychain.ExtendedKey
+}
+
+// NewHDWallet stretches the seed of a mnemonic, with no passphrase
+func NewHDWallet(mnemonic string) (*HDWallet, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(seed)
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	return &HDWallet{master: master}, nil
+}
+
+// DeriveKey returns the Ed448 private key at a derivation path
+func (w *HDWallet) DeriveKey(path accounts.DerivationPath) (*eddsa.PrivateKey, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot derive from an empty path")
+	}
+	key := w.master
+	for _, index := range path {
+		child, err := key.Derive(index)
+		if key != w.master {
+			key.Zero()
+		}
+		if err != nil {
+			return nil, err
+		}
+		key = child
+	}
+	defer key.Zero()
+	ecKey, err := key.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	defer ecKey.Zero()
+	scalar := ecKey.Serialize()
+	defer ZeroBytes(scalar)
+
+	shake := sha3.NewShake256()
+	shake.Write([]byte(hdEd448Domain))
+	shake.Write(scalar)
+	var privateKey eddsa.PrivateKey
+	shake.Read(privateKey[:])
+	// a clear top bit marks the 57 bytes as an RFC 8032 private key
+	privateKey[56] &= 0x7f
+	return &privateKey, nil
+}
+
+// Zero clears the master key; the wallet derives nothing after it
+func (w *HDWallet) Zero() {
+	w.master.Zero()
+}
@@ -0,0 +1,76 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/core-coin/go-core/accounts"
+	"golang.org/x/crypto/sha3"
+)
+
+// testMnemonic is the BIP-39 test mnemonic
+const testMnemonic string = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestHDWalletDerivesFromBIP32Child(t *testing.T) {
+	wallet, err := NewHDWallet(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wallet.Zero()
+	key, err := wallet.DeriveKey(accounts.DerivationPath{0x80000000 + 44, 0x80000000 + 60, 0x80000000, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the secp256k1 key of m/44'/60'/0'/0/0 of the test mnemonic, whose
+	// Ethereum address is 0x9858EfFD232B4033E47d90003D41EC34EcaEda94
+	child, _ := hex.DecodeString("1ab42cc412b618bdea3a599e3c9bae199ebf030895b039e9db1e30dafb12b727")
+	shake := sha3.NewShake256()
+	shake.Write([]byte(hdEd448Domain))
+	shake.Write(child)
+	want := make([]byte, 57)
+	shake.Read(want)
+	want[56] &= 0x7f
+	if !bytes.Equal(key[:], want) {
+		t.Fatalf("derived %x, want %x", key[:], want)
+	}
+}
+
+func TestHDWalletDerivesDistinctKeys(t *testing.T) {
+	wallet, err := NewHDWallet(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wallet.Zero()
+	first, err := wallet.DeriveKey(accounts.DerivationPath{0x80000000 + 44, 0x80000000 + 60, 0x80000000, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := wallet.DeriveKey(accounts.DerivationPath{0x80000000 + 44, 0x80000000 + 60, 0x80000000, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *first == *second {
+		t.Fatal("indexes 0 and 1 derived the same key")
+	}
+	if *first == [57]byte{} {
+		t.Fatal("derived the zero key")
+	}
+	if _, err := NewHDWallet("abandon abandon abandon"); err == nil {
+		t.Fatal("an invalid mnemonic was accepted")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// exp and log tables for GF(2^8) with the AES polynomial and generator 3
+var gfExp, gfLog [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		// multiply by the generator 3 = x + 1
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])-int(gfLog[b])+255)%255]
+}
+
+// SplitSecret splits a secret into parts shares, any threshold of which
+// recombine to the secret. The x coordinate of each share is its last byte.
+func SplitSecret(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("cannot split an empty secret")
+	}
+	if threshold < 2 || threshold > parts || parts > 255 {
+		return nil, fmt.Errorf("threshold must be between 2 and the number of shares, which is at most 255")
+	}
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	coefficients := make([]byte, threshold)
+	defer ZeroBytes(coefficients)
+	for i, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			x := share[len(secret)]
+			// Horner's method from the highest coefficient down
+			var y byte
+			for j := threshold - 1; j >= 0; j-- {
+				y = gfMul(y, x) ^ coefficients[j]
+			}
+			share[i] = y
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares recombines shares produced by SplitSecret
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least two shares are required")
+	}
+	length := len(shares[0])
+	if length < 2 {
+		return nil, fmt.Errorf("shares are too short")
+	}
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != length {
+			return nil, fmt.Errorf("shares must all have the same length")
+		}
+		x := share[length-1]
+		if x == 0 || seen[x] {
+			return nil, fmt.Errorf("shares must be distinct")
+		}
+		seen[x] = true
+	}
+	secret := make([]byte, length-1)
+	for i := range secret {
+		// Lagrange interpolation at x = 0
+		var value byte
+		for j, share := range shares {
+			xj := share[length-1]
+			basis := byte(1)
+			for k, other := range shares {
+				if k == j {
+					continue
+				}
+				xk := other[length-1]
+				basis = gfMul(basis, gfDiv(xk, xk^xj))
+			}
+			value ^= gfMul(share[i], basis)
+		}
+		secret[i] = value
+	}
+	return secret, nil
+}
+
+// ZeroBytes overwrites a buffer holding secret material
+func ZeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
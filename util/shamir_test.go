@@ -0,0 +1,149 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// slowMul multiplies in GF(2^8) modulo the AES polynomial bit by bit
+func slowMul(a, b byte) byte {
+	var product byte
+	for b != 0 {
+		if b&1 != 0 {
+			product ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return product
+}
+
+func TestGFArithmetic(t *testing.T) {
+	// the worked products of FIPS-197 sections 4.2 and 4.2.1
+	for _, vector := range []struct{ a, b, product byte }{
+		{0x57, 0x83, 0xc1},
+		{0x57, 0x13, 0xfe},
+		{0x53, 0xca, 0x01},
+	} {
+		if got := gfMul(vector.a, vector.b); got != vector.product {
+			t.Fatalf("%#02x * %#02x = %#02x, want %#02x", vector.a, vector.b, got, vector.product)
+		}
+	}
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			product := gfMul(byte(a), byte(b))
+			if want := slowMul(byte(a), byte(b)); product != want {
+				t.Fatalf("%#02x * %#02x = %#02x, want %#02x", a, b, product, want)
+			}
+			if b != 0 && gfDiv(product, byte(b)) != byte(a) {
+				t.Fatalf("%#02x / %#02x is not %#02x", product, b, a)
+			}
+		}
+	}
+}
+
+func TestCombineSharesKnownAnswers(t *testing.T) {
+	// f(x) = 0x2a + 0x07x: f(1) = 0x2d, f(2) = 0x24, f(3) = 0x23
+	line := [][]byte{{0x2d, 1}, {0x24, 2}, {0x23, 3}}
+	for _, pair := range [][][]byte{{line[0], line[1]}, {line[0], line[2]}, {line[2], line[1]}} {
+		secret, err := CombineShares(pair)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(secret, []byte{0x2a}) {
+			t.Fatalf("combined %x, want 2a", secret)
+		}
+	}
+	// f(x) = 0x53 + 0xcax + 0x01x^2: f(1) = 0x98, f(2) = 0xd8, f(3) = 0x13
+	secret, err := CombineShares([][]byte{{0x13, 3}, {0x98, 1}, {0xd8, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret, []byte{0x53}) {
+		t.Fatalf("combined %x, want 53", secret)
+	}
+}
+
+func TestSplitSecretRoundTrip(t *testing.T) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked [][]byte
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		combined, err := CombineShares(picked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(combined, secret) {
+			t.Fatalf("shares %v combined to %x, want %x", subset, combined, secret)
+		}
+	}
+	if _, err := CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Fatal("a repeated share was accepted")
+	}
+}
+
+func TestSplitSecretBelowThreshold(t *testing.T) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	combined, err := CombineShares(shares[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(combined, secret) {
+		t.Fatal("two shares of a threshold of three recovered the secret")
+	}
+
+	// a share below the threshold is uniform whatever the secret: the first
+	// share of a zero secret and of an all ones secret takes every value
+	for _, value := range []byte{0x00, 0xff} {
+		var seen [256]bool
+		count := 0
+		for i := 0; i < 8192 && count < 256; i++ {
+			shares, err := SplitSecret([]byte{value}, 2, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !seen[shares[0][0]] {
+				seen[shares[0][0]] = true
+				count++
+			}
+		}
+		if count != 256 {
+			t.Fatalf("a share of %#02x took %d of 256 values", value, count)
+		}
+	}
+}
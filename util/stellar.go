@@ -0,0 +1,148 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// StellarPublicNetwork is the network passphrase of the Stellar public network
+	StellarPublicNetwork string = "Public Global Stellar Network ; September 2015"
+	// StellarTestNetwork is the network passphrase of the Stellar test network
+	StellarTestNetwork string = "Test SDF Network ; September 2015"
+
+	stellarEnvelopeTypeTx  uint32 = 2
+	stellarKeyTypeEd25519  uint32 = 0
+	stellarKeyTypeMuxed    uint32 = 0x100
+	stellarVersionAccount  byte   = 6 << 3
+	stellarVersionMuxed    byte   = 12 << 3
+	stellarSignatureLength uint32 = 64
+)
+
+// StellarTransaction is the header of a Stellar transaction, enough to say
+// who sends it; its operations are not decoded
+type StellarTransaction struct {
+	// XDR is the encoded transaction, without envelope or signatures
+	XDR           []byte
+	SourceAccount string
+	Fee           uint32
+	SequenceNum   int64
+}
+
+// ParseStellarEnvelope returns the transaction of an unsigned v1 transaction
+// envelope, as the Stellar SDKs encode it
+func ParseStellarEnvelope(envelope []byte) (*StellarTransaction, error) {
+	if len(envelope) < 8 || len(envelope)%4 != 0 {
+		return nil, errors.New("the transaction envelope is not XDR")
+	}
+	if envelopeType := binary.BigEndian.Uint32(envelope); envelopeType != stellarEnvelopeTypeTx {
+		return nil, fmt.Errorf("only v1 transaction envelopes are signed, not envelope type %d", envelopeType)
+	}
+	// an unsigned envelope ends with an empty signature array
+	if binary.BigEndian.Uint32(envelope[len(envelope)-4:]) != 0 {
+		return nil, errors.New("the transaction envelope is already signed; sign the unsigned envelope and combine the signatures")
+	}
+	tx := &StellarTransaction{XDR: envelope[4 : len(envelope)-4]}
+	body := tx.XDR
+	if len(body) < 4 {
+		return nil, errors.New("the transaction is truncated")
+	}
+	var key, payload []byte
+	switch keyType := binary.BigEndian.Uint32(body); keyType {
+	case stellarKeyTypeEd25519:
+		if len(body) < 4+32 {
+			return nil, errors.New("the transaction is truncated")
+		}
+		key = body[4:36]
+		tx.SourceAccount = StellarStrKey(stellarVersionAccount, key)
+		body = body[36:]
+	case stellarKeyTypeMuxed:
+		if len(body) < 4+8+32 {
+			return nil, errors.New("the transaction is truncated")
+		}
+		key = body[12:44]
+		payload = append(append(payload, key...), body[4:12]...)
+		tx.SourceAccount = StellarStrKey(stellarVersionMuxed, payload)
+		body = body[44:]
+	default:
+		return nil, fmt.Errorf("unknown source account type %d", keyType)
+	}
+	if len(body) < 12 {
+		return nil, errors.New("the transaction is truncated")
+	}
+	tx.Fee = binary.BigEndian.Uint32(body)
+	tx.SequenceNum = int64(binary.BigEndian.Uint64(body[4:]))
+	return tx, nil
+}
+
+// StellarTransactionHash is the hash a Stellar transaction is signed by and known as on the network
+func StellarTransactionHash(networkPassphrase string, tx []byte) []byte {
+	networkID := sha256.Sum256([]byte(networkPassphrase))
+	var base bytes.Buffer
+	base.Write(networkID[:])
+	binary.Write(&base, binary.BigEndian, stellarEnvelopeTypeTx)
+	base.Write(tx)
+	hash := sha256.Sum256(base.Bytes())
+	return hash[:]
+}
+
+// StellarSignedEnvelope wraps a transaction and the ed25519 signature of its
+// hash in an envelope the network accepts
+func StellarSignedEnvelope(tx, publicKey, signature []byte) []byte {
+	var envelope bytes.Buffer
+	binary.Write(&envelope, binary.BigEndian, stellarEnvelopeTypeTx)
+	envelope.Write(tx)
+	binary.Write(&envelope, binary.BigEndian, uint32(1))
+	// the hint is the last four bytes of the signer's key
+	envelope.Write(publicKey[len(publicKey)-4:])
+	binary.Write(&envelope, binary.BigEndian, stellarSignatureLength)
+	envelope.Write(signature)
+	return envelope.Bytes()
+}
+
+// StellarAccount returns the G... address of an ed25519 public key
+func StellarAccount(publicKey []byte) string {
+	return StellarStrKey(stellarVersionAccount, publicKey)
+}
+
+// StellarStrKey encodes a payload as a Stellar StrKey: base32 of the version
+// byte, the payload and its CRC16-XModem checksum
+func StellarStrKey(version byte, payload []byte) string {
+	raw := append([]byte{version}, payload...)
+	checksum := crc16XModem(raw)
+	raw = append(raw, byte(checksum), byte(checksum>>8))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+}
+
+func crc16XModem(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,33 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestStellarStrKeyVectors(t *testing.T) {
+	// the account IDs of SEP-23
+	for _, vector := range []struct{ key, account string }{
+		{"0000000000000000000000000000000000000000000000000000000000000000", "GAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAWHF"},
+		{"3f0c34bf93ad0d9971d04ccc90f705511c838aad9734a4a2fb0d7a03fc7fe89a", "GA7QYNF7SOWQ3GLR2BGMZEHXAVIRZA4KVWLTJJFC7MGXUA74P7UJVSGZ"},
+	} {
+		key, _ := hex.DecodeString(vector.key)
+		if account := StellarAccount(key); account != vector.account {
+			t.Fatalf("%s encoded as %s, want %s", vector.key, account, vector.account)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	// TOTPPeriod is the seconds each TOTP code is valid for
+	TOTPPeriod int64 = 30
+	// TOTPDigits is the length of a TOTP code
+	TOTPDigits int = 6
+)
+
+// TOTPStep returns the RFC 6238 time step of a moment
+func TOTPStep(now time.Time) uint64 {
+	return uint64(now.Unix() / TOTPPeriod)
+}
+
+// TOTP returns the RFC 6238 code of a secret for a time step, with HMAC-SHA1
+// and six digits as authenticator apps expect by default
+func TOTP(secret []byte, step uint64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], step)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, code%1000000)
+}
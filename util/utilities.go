@@ -24,11 +24,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/big"
-	"os"
-	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 
     eddsa "github.com/core-coin/go-goldilocks"
@@ -46,6 +44,8 @@ import (
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/cryptohub-digital/vault-core/address"
 )
 
 // ZeroAddress RLP empty byte sequence.
@@ -80,6 +80,37 @@ func Contains(stringSlice []string, searchString string) bool {
 	return false
 }
 
+// ParseAddress validates and decodes a Core address; see address.ParseCore
+func ParseAddress(input string, lowercaseOnly bool) (common.Address, error) {
+	return address.ParseCore(input, lowercaseOnly)
+}
+
+// NormalizeAddresses validates a list of addresses and returns them in canonical
+// form without duplicates
+func NormalizeAddresses(inputs []string, lowercaseOnly bool) ([]string, error) {
+	var result []string
+	for _, input := range inputs {
+		address, err := ParseAddress(input, lowercaseOnly)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, address.Hex())
+	}
+	return Dedup(result), nil
+}
+
+// ContainsAddress returns true if the address is present in a list, tolerating
+// entries stored before addresses were normalized
+func ContainsAddress(addresses []string, address common.Address) bool {
+	for _, value := range addresses {
+		value = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(value), "0x"), "0X")
+		if strings.EqualFold(value, address.Hex()) {
+			return true
+		}
+	}
+	return false
+}
+
 // Encode will encode a raw key or seed
 func Encode(src []byte) ([]byte, error) {
 	buf := make([]byte, hex.EncodedLen(len(src)))
@@ -151,7 +182,12 @@ func Pow(a, b int64) int64 {
 
 // ZeroKey removes the key from memory
 func ZeroKey(k *eddsa.PrivateKey) {
-    k = new(eddsa.PrivateKey)
+	if k == nil {
+		return
+	}
+	for i := range k {
+		k[i] = 0
+	}
 }
 
 // EstimateGas attempts to determine the cost for a contract deploy... super annoying
@@ -238,7 +274,11 @@ func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
 }
 
 // EncryptKey encrypts an ecdsa.PrivateKey and returns a JSON keystore
-func EncryptKey(key *eddsa.PrivateKey, address *common.Address, id uuid.UUID, auth string, scryptN, scryptP int) ([]byte, error) {
+func EncryptKey(ctx context.Context, key *eddsa.PrivateKey, address *common.Address, id uuid.UUID, auth string, scryptN, scryptP int) ([]byte, error) {
+	// scrypt cannot be interrupted, so don't start it for an abandoned request
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	authArray := []byte(auth)
 
 	salt := make([]byte, 32)
@@ -260,7 +300,7 @@ func EncryptKey(key *eddsa.PrivateKey, address *common.Address, id uuid.UUID, au
 	if err != nil {
 		return nil, err
 	}
-	mac := crypto.Keccak256(derivedKey[16:32], cipherText)
+	mac := crypto.SHA3(derivedKey[16:32], cipherText)
 
 	scryptParamsJSON := make(map[string]interface{}, 5)
 	scryptParamsJSON["n"] = scryptN
@@ -291,7 +331,10 @@ func EncryptKey(key *eddsa.PrivateKey, address *common.Address, id uuid.UUID, au
 }
 
 // ImportJSONKeystore decrypts a JSON keystore given a passphrase
-func ImportJSONKeystore(keystoreBytes []byte, passphrase string) (*eddsa.PrivateKey, error) {
+func ImportJSONKeystore(ctx context.Context, keystoreBytes []byte, passphrase string) (*eddsa.PrivateKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var key *keystore.Key
 	key, err := keystore.DecryptKey(keystoreBytes, passphrase)
 	if err != nil {
@@ -304,30 +347,6 @@ func ImportJSONKeystore(keystoreBytes []byte, passphrase string) (*eddsa.Private
 	return key.PrivateKey, err
 }
 
-// WriteKeyFile will create the keystore directory with appropriate permissions
-// in case it is not present yet.
-func WriteKeyFile(file string, content []byte) error {
-	// Create the keystore directory with appropriate permissions
-	// in case it is not present yet.
-	const dirPerm = 0700
-	if err := os.MkdirAll(filepath.Dir(file), dirPerm); err != nil {
-		return err
-	}
-	// Atomic write: create a temporary hidden file first
-	// then move it into place. TempFile assigns mode 0600.
-	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
-	if err != nil {
-		return err
-	}
-	if _, err := f.Write(content); err != nil {
-		f.Close()
-		os.Remove(f.Name())
-		return err
-	}
-	f.Close()
-	return os.Rename(f.Name(), file)
-}
-
 // TokenAmount does the requisite math on tokens
 func TokenAmount(amount int64, decimals uint8) *big.Int {
 	var bigDecimal big.Int
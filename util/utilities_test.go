@@ -0,0 +1,57 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/core-coin/go-core/crypto"
+	eddsa "github.com/core-coin/go-goldilocks"
+	"github.com/pborman/uuid"
+)
+
+func TestScryptKeystoreVector(t *testing.T) {
+	// very-light-scrypt.json of the keystore tests of go-core, under the passphrase foobar
+	vector := `{"address":"0000000000000000000000000000000000000000000b","crypto":{"cipher":"aes-128-ctr","ciphertext":"e79c76c0565907d5432b991f29116f68e8da521194b5824e1d4a52f98a32ee944ac915f332d9f832be4c2c832c3366e2745453c557901a31fe","cipherparams":{"iv":"0c18f7d89e16cab5ba6b9dd13203b7cb"},"kdf":"scrypt","kdfparams":{"dklen":32,"n":2,"p":1,"r":8,"salt":"c835a021e40381b09b0ac1335bd05e9d06b84f030f9fe5c19d591ad9f073d755"},"mac":"2640475c9cd7c4f628317a9542dd3e1600750d2019b659b8a47cf1a042ae1578"},"id":"2355858f-b495-3d1d-846c-b65ecf3265db","version":3}`
+	key, err := ImportJSONKeystore(context.Background(), []byte(vector), "foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(key[:]) != coreTestKey {
+		t.Fatalf("decrypted %x", key[:])
+	}
+	address := crypto.PubkeyToAddress(eddsa.Ed448DerivePublicKey(*key))
+	if address.Hex() != "cb45f23d9ab6aefb2c22dfff511e29703435a3b50f50" {
+		t.Fatalf("the key is that of %s", address.Hex())
+	}
+	if _, err := ImportJSONKeystore(context.Background(), []byte(vector), "foobaz"); err == nil {
+		t.Fatal("a wrong passphrase decrypted the keystore")
+	}
+
+	// the keystores EncryptKey writes must carry the SHA3 MAC Core verifies
+	keystore, err := EncryptKey(context.Background(), key, &address, uuid.NewRandom(), "foobar", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ImportJSONKeystore(context.Background(), keystore, "foobar")
+	if err != nil {
+		t.Fatalf("an exported keystore does not import: %v", err)
+	}
+	if *decrypted != *key {
+		t.Fatal("an exported keystore imported another key")
+	}
+}
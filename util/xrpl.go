@@ -0,0 +1,238 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	xrplAlphabet string = "rpshnaf39wBUDNEGHJKLM4PQRST7VWXYZ2bcdeCg65jkm8oFqi1tuvAxyz"
+
+	xrplTypeUInt16  = 1
+	xrplTypeUInt32  = 2
+	xrplTypeUInt64  = 3
+	xrplTypeHash128 = 4
+	xrplTypeHash256 = 5
+	xrplTypeAmount  = 6
+	xrplTypeBlob    = 7
+
+	xrplFieldSigningPubKey = 3
+	xrplFieldTxnSignature  = 4
+)
+
+var (
+	// xrplSigningPrefix is prepended to a transaction to sign it, xrplTxPrefix to hash a signed one
+	xrplSigningPrefix = []byte{0x53, 0x54, 0x58, 0x00}
+	xrplTxPrefix      = []byte{0x54, 0x58, 0x4E, 0x00}
+)
+
+// XRPLPublicKey returns the public key an XRP Ledger account signs with: the
+// compressed secp256k1 key, or the ed25519 key prefixed with 0xED
+func XRPLPublicKey(curve string, privateKey []byte) ([]byte, error) {
+	switch curve {
+	case CurveSecp256k1:
+		return CompressedPublicKey(privateKey)
+	case CurveEd25519:
+		if len(privateKey) != ed25519.SeedSize {
+			return nil, fmt.Errorf("an ed25519 private key is 32 bytes, not %d", len(privateKey))
+		}
+		public := ed25519.NewKeyFromSeed(privateKey).Public().(ed25519.PublicKey)
+		return append([]byte{0xED}, public...), nil
+	}
+	return nil, fmt.Errorf("the XRP Ledger does not sign with %s keys", curve)
+}
+
+// XRPLAddress returns the classic r... address of an XRP Ledger public key
+func XRPLAddress(publicKey []byte) string {
+	sha := sha256.Sum256(publicKey)
+	ripemd := ripemd160.New()
+	ripemd.Write(sha[:])
+	payload := append([]byte{0x00}, ripemd.Sum(nil)...)
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return xrplBase58(append(payload, second[:4]...))
+}
+
+func xrplBase58(data []byte) string {
+	value := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	modulus := new(big.Int)
+	var encoded []byte
+	for value.Sign() > 0 {
+		value.DivMod(value, radix, modulus)
+		encoded = append(encoded, xrplAlphabet[modulus.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, xrplAlphabet[0])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+// sha512Half is the hash of the XRP Ledger: the first half of SHA-512
+func sha512Half(parts ...[]byte) []byte {
+	hash := sha512.New()
+	for _, part := range parts {
+		hash.Write(part)
+	}
+	return hash.Sum(nil)[:32]
+}
+
+// XRPLSign signs a transaction in the canonical binary format of the XRP
+// Ledger, which must carry the signer's SigningPubKey and no TxnSignature. It
+// returns the signed transaction and its hash.
+func XRPLSign(curve string, privateKey, blob []byte) ([]byte, []byte, error) {
+	publicKey, err := XRPLPublicKey(curve, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	end, err := xrplSigningPubKeyEnd(blob, publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var signature []byte
+	if curve == CurveEd25519 {
+		signature = ed25519.Sign(ed25519.NewKeyFromSeed(privateKey), append(append([]byte{}, xrplSigningPrefix...), blob...))
+	} else {
+		signature, err = SignSecp256k1Digest(privateKey, sha512Half(xrplSigningPrefix, blob))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// TxnSignature sorts right after SigningPubKey, the blob field before it
+	var signed bytes.Buffer
+	signed.Write(blob[:end])
+	signed.WriteByte(xrplTypeBlob<<4 | xrplFieldTxnSignature)
+	signed.Write(xrplLength(len(signature)))
+	signed.Write(signature)
+	signed.Write(blob[end:])
+	return signed.Bytes(), sha512Half(xrplTxPrefix, signed.Bytes()), nil
+}
+
+// xrplSigningPubKeyEnd walks the fields of a transaction up to its
+// SigningPubKey, checks it is publicKey, and returns where it ends. Fields are
+// sorted by type, and every field before a blob has a fixed or VL length.
+func xrplSigningPubKeyEnd(blob, publicKey []byte) (int, error) {
+	truncated := errors.New("the transaction is truncated")
+	for offset := 0; offset < len(blob); {
+		typeCode, fieldCode := int(blob[offset]>>4), int(blob[offset]&0x0F)
+		offset++
+		if typeCode == 0 {
+			if offset >= len(blob) {
+				return 0, truncated
+			}
+			typeCode = int(blob[offset])
+			offset++
+		}
+		if fieldCode == 0 {
+			if offset >= len(blob) {
+				return 0, truncated
+			}
+			fieldCode = int(blob[offset])
+			offset++
+		}
+		var length int
+		switch typeCode {
+		case xrplTypeUInt16:
+			length = 2
+		case xrplTypeUInt32:
+			length = 4
+		case xrplTypeUInt64:
+			length = 8
+		case xrplTypeHash128:
+			length = 16
+		case xrplTypeHash256:
+			length = 32
+		case xrplTypeAmount:
+			if offset >= len(blob) {
+				return 0, truncated
+			}
+			switch {
+			case blob[offset]&0x80 != 0:
+				length = 48
+			case blob[offset]&0x20 != 0:
+				length = 33
+			default:
+				length = 8
+			}
+		case xrplTypeBlob:
+			var size int
+			length, size = xrplReadLength(blob[offset:])
+			if size == 0 {
+				return 0, truncated
+			}
+			offset += size
+		default:
+			return 0, errors.New("the transaction has no SigningPubKey")
+		}
+		if offset+length > len(blob) {
+			return 0, truncated
+		}
+		if typeCode == xrplTypeBlob {
+			switch fieldCode {
+			case xrplFieldSigningPubKey:
+				if !bytes.Equal(blob[offset:offset+length], publicKey) {
+					return 0, fmt.Errorf("the SigningPubKey of the transaction is not %X", publicKey)
+				}
+				end := offset + length
+				if end < len(blob) && blob[end] == xrplTypeBlob<<4|xrplFieldTxnSignature {
+					return 0, errors.New("the transaction is already signed")
+				}
+				return end, nil
+			}
+		}
+		offset += length
+	}
+	return 0, errors.New("the transaction has no SigningPubKey")
+}
+
+// xrplReadLength decodes a VL length prefix; its size is 0 when it is truncated
+func xrplReadLength(data []byte) (int, int) {
+	switch {
+	case len(data) >= 1 && data[0] <= 192:
+		return int(data[0]), 1
+	case len(data) >= 2 && data[0] <= 240:
+		return 193 + (int(data[0])-193)<<8 + int(data[1]), 2
+	case len(data) >= 3 && data[0] <= 254:
+		return 12481 + (int(data[0])-241)<<16 + int(data[1])<<8 + int(data[2]), 3
+	}
+	return 0, 0
+}
+
+func xrplLength(length int) []byte {
+	switch {
+	case length <= 192:
+		return []byte{byte(length)}
+	case length <= 12480:
+		length -= 193
+		return []byte{byte(193 + length>>8), byte(length)}
+	}
+	length -= 12481
+	return []byte{byte(241 + length>>16), byte(length >> 8), byte(length)}
+}
@@ -0,0 +1,53 @@
+// Copyright © 2018 Immutability, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestXRPLAddressVectors(t *testing.T) {
+	for _, vector := range []struct{ curve, privateKey, publicKey, address string }{
+		// the genesis account, of the seed of the passphrase masterpassphrase
+		{CurveSecp256k1, "1acaaedece405b2a958212629e16f2eb46b153eee94cdd350fdeff52795525b7", "0330e7fc9d56bb25d6893ba3f317ae5bcf33b3291bd63db32654a313222f7fd020", "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh"},
+		// the ed25519 key of test 1 of RFC 8032
+		{CurveEd25519, "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60", "edd75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a", ""},
+		// the ed25519 account of the key derivation example of the XRP Ledger docs
+		{CurveEd25519, "", "ed01fa53fa5a7e77798f882ece20b1abc00bb358a9e55a202d0d0676bd0ce37a63", "rLUEXYuLiQptky37CqLcm9USQpPiz5rkpD"},
+	} {
+		publicKey, _ := hex.DecodeString(vector.publicKey)
+		if vector.privateKey != "" {
+			privateKey, _ := hex.DecodeString(vector.privateKey)
+			derived, err := XRPLPublicKey(vector.curve, privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(derived) != vector.publicKey {
+				t.Fatalf("%s derived %x, want %s", vector.privateKey, derived, vector.publicKey)
+			}
+		}
+		if vector.address == "" {
+			continue
+		}
+		if address := XRPLAddress(publicKey); address != vector.address {
+			t.Fatalf("%s encoded as %s, want %s", vector.publicKey, address, vector.address)
+		}
+	}
+	if _, err := XRPLPublicKey(CurveSecp256r1, make([]byte, 32)); err == nil || !strings.Contains(err.Error(), "does not sign") {
+		t.Fatalf("a secp256r1 key was accepted: %v", err)
+	}
+}